@@ -0,0 +1,68 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+)
+
+// SetBaggage 在context的baggage中设置一个键值对
+// baggage会通过全局propagator随请求传播到下游服务
+func SetBaggage(ctx context.Context, key, value string) (context.Context, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	member, err := baggage.NewMemberRaw(key, value)
+	if err != nil {
+		return ctx, fmt.Errorf("invalid baggage member %q: %w", key, err)
+	}
+
+	bag, err := baggage.FromContext(ctx).SetMember(member)
+	if err != nil {
+		return ctx, fmt.Errorf("failed to set baggage member %q: %w", key, err)
+	}
+	return baggage.ContextWithBaggage(ctx, bag), nil
+}
+
+// GetBaggage 获取context中指定键的baggage值，不存在时返回空字符串
+func GetBaggage(ctx context.Context, key string) string {
+	if ctx == nil {
+		return ""
+	}
+	return baggage.FromContext(ctx).Member(key).Value()
+}
+
+// BaggageMap 返回context中所有baggage键值对
+func BaggageMap(ctx context.Context) map[string]string {
+	result := make(map[string]string)
+	if ctx == nil {
+		return result
+	}
+	for _, member := range baggage.FromContext(ctx).Members() {
+		result[member.Key()] = member.Value()
+	}
+	return result
+}
+
+// baggageAttributes 将允许列表中的baggage转换为span属性
+func baggageAttributes(ctx context.Context, keys []string) []attribute.KeyValue {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	bag := baggage.FromContext(ctx)
+	if bag.Len() == 0 {
+		return nil
+	}
+
+	var attrs []attribute.KeyValue
+	for _, key := range keys {
+		if member := bag.Member(key); member.Key() != "" {
+			attrs = append(attrs, attribute.String(key, member.Value()))
+		}
+	}
+	return attrs
+}
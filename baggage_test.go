@@ -0,0 +1,73 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/HsiaoL1/trace/tracetest"
+)
+
+func TestSetAndGetBaggage(t *testing.T) {
+	ctx, err := SetBaggage(context.Background(), "tenant_id", "acme")
+	if err != nil {
+		t.Fatalf("SetBaggage failed: %v", err)
+	}
+	ctx, err = SetBaggage(ctx, "user_id", "42")
+	if err != nil {
+		t.Fatalf("SetBaggage failed: %v", err)
+	}
+
+	if got := GetBaggage(ctx, "tenant_id"); got != "acme" {
+		t.Errorf("Expected tenant_id acme, got %q", got)
+	}
+	if got := GetBaggage(ctx, "missing"); got != "" {
+		t.Errorf("Expected empty value for missing key, got %q", got)
+	}
+	if bag := BaggageMap(ctx); len(bag) != 2 || bag["user_id"] != "42" {
+		t.Errorf("Unexpected baggage map: %v", bag)
+	}
+
+	if _, err := SetBaggage(context.Background(), "", "value"); err == nil {
+		t.Error("Expected error for invalid baggage key")
+	}
+}
+
+func TestBaggagePropagatesThroughHTTP(t *testing.T) {
+	recorder := tracetest.Start(t)
+
+	var serverTenant string
+	handler := OpenTelemetryMiddlewareWithOptions(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverTenant = GetBaggage(r.Context(), "tenant_id")
+		w.WriteHeader(http.StatusOK)
+	}), WithBaggageAttributes("tenant_id"))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	ctx, err := SetBaggage(context.Background(), "tenant_id", "acme")
+	if err != nil {
+		t.Fatalf("SetBaggage failed: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/orders", nil)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+
+	client := NewTracedHTTPClient(0, WithClientBaggageAttributes("tenant_id"))
+	resp, err := client.Do(ctx, req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if serverTenant != "acme" {
+		t.Errorf("Expected server to receive tenant_id acme, got %q", serverTenant)
+	}
+
+	clientSpan := recorder.RequireSpan(t, "GET "+server.Listener.Addr().String())
+	serverSpan := recorder.RequireSpan(t, "GET /orders")
+	recorder.AssertAttr(t, clientSpan, "tenant_id", "acme")
+	recorder.AssertAttr(t, serverSpan, "tenant_id", "acme")
+	recorder.AssertParent(t, serverSpan, clientSpan)
+}
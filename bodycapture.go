@@ -0,0 +1,120 @@
+package trace
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// body相关的span属性键
+const (
+	HTTPRequestBodyKey           = "http.request.body"
+	HTTPRequestBodyTruncatedKey  = "http.request.body.truncated"
+	HTTPResponseBodyKey          = "http.response.body"
+	HTTPResponseBodyTruncatedKey = "http.response.body.truncated"
+)
+
+// BodyRedactor 在body写入span属性之前对其脱敏，返回脱敏后的内容
+type BodyRedactor func(contentType string, body []byte) []byte
+
+// bodyCaptureConfig 错误时记录body的配置
+type bodyCaptureConfig struct {
+	maxBytes  int
+	redactors []BodyRedactor
+}
+
+// enabled 是否启用body记录
+func (c *bodyCaptureConfig) enabled() bool {
+	return c != nil && c.maxBytes > 0
+}
+
+// newBuffer 为允许记录的内容类型创建缓冲区，不允许时返回nil
+func (c *bodyCaptureConfig) newBuffer(contentType string) *cappedBuffer {
+	if !c.enabled() || !isCapturableContentType(contentType) {
+		return nil
+	}
+	return &cappedBuffer{max: c.maxBytes, contentType: contentType}
+}
+
+// setAttributes 将缓冲区中的body脱敏后写入span属性
+func (c *bodyCaptureConfig) setAttributes(span trace.Span, bodyKey, truncatedKey string, buf *cappedBuffer) {
+	if buf == nil || len(buf.data) == 0 {
+		return
+	}
+
+	body := buf.data
+	for _, redact := range c.redactors {
+		body = redact(buf.contentType, body)
+	}
+
+	span.SetAttributes(attribute.String(bodyKey, string(body)))
+	if buf.truncated {
+		span.SetAttributes(attribute.Bool(truncatedKey, true))
+	}
+}
+
+// isCapturableContentType 只记录JSON和文本类型的body
+func isCapturableContentType(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") ||
+		mediaType == "application/json" ||
+		strings.HasSuffix(mediaType, "+json")
+}
+
+// cappedBuffer 最多保留max字节的缓冲区，超出部分丢弃
+type cappedBuffer struct {
+	data        []byte
+	max         int
+	truncated   bool
+	contentType string
+}
+
+// Write 写入数据，始终返回完整长度以免影响TeeReader
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	remaining := b.max - len(b.data)
+	if remaining > 0 {
+		n := len(p)
+		if n > remaining {
+			n = remaining
+		}
+		b.data = append(b.data, p[:n]...)
+	}
+	if len(p) > remaining {
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+// teeReadCloser 读取时同时写入缓冲区的ReadCloser
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// teeBody 包装body，使读取的内容同时写入缓冲区
+func teeBody(body io.ReadCloser, buf *cappedBuffer) io.ReadCloser {
+	return &teeReadCloser{
+		Reader: io.TeeReader(body, buf),
+		Closer: body,
+	}
+}
+
+// peekBody 预读最多max字节到缓冲区，返回仍可完整读取的body
+func peekBody(body io.ReadCloser, buf *cappedBuffer) io.ReadCloser {
+	peeked, _ := io.ReadAll(io.LimitReader(body, int64(buf.max)+1))
+	buf.Write(peeked)
+	return &teeReadCloser{
+		Reader: io.MultiReader(bytes.NewReader(peeked), body),
+		Closer: body,
+	}
+}
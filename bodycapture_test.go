@@ -0,0 +1,183 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/HsiaoL1/trace/tracetest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// spanAttr 返回span中指定属性的字符串值
+func spanAttr(span sdktrace.ReadOnlySpan, key string) (string, bool) {
+	for _, attr := range span.Attributes() {
+		if string(attr.Key) == key {
+			return attr.Value.Emit(), true
+		}
+	}
+	return "", false
+}
+
+func TestClientBodyCaptureOnError(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxBytes     int
+		status       int
+		contentType  string
+		responseBody string
+		wantRequest  string
+		wantResponse string
+		wantCaptured bool
+	}{
+		{
+			name:         "CaptureOn500",
+			maxBytes:     64,
+			status:       http.StatusInternalServerError,
+			contentType:  "application/json",
+			responseBody: `{"error":"db down"}`,
+			wantRequest:  `{"id":1}`,
+			wantResponse: `{"error":"db down"}`,
+			wantCaptured: true,
+		},
+		{
+			name:         "NoCaptureOn200",
+			maxBytes:     64,
+			status:       http.StatusOK,
+			contentType:  "application/json",
+			responseBody: `{"ok":true}`,
+		},
+		{
+			name:         "ByteCap",
+			maxBytes:     7,
+			status:       http.StatusBadRequest,
+			contentType:  "text/plain; charset=utf-8",
+			responseBody: strings.Repeat("x", 100),
+			wantRequest:  `{"id":1`,
+			wantResponse: strings.Repeat("x", 7),
+			wantCaptured: true,
+		},
+		{
+			name:         "BinaryNotCaptured",
+			maxBytes:     64,
+			status:       http.StatusInternalServerError,
+			contentType:  "application/octet-stream",
+			responseBody: "binary",
+			wantRequest:  `{"id":1}`,
+			wantCaptured: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.Start(t)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.Copy(io.Discard, r.Body)
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.responseBody)
+			}))
+			defer server.Close()
+
+			client := NewTracedHTTPClient(0, WithBodyCaptureOnError(tt.maxBytes))
+			resp, err := client.Post(context.Background(), server.URL, "application/json", bytes.NewBufferString(`{"id":1}`))
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if string(body) != tt.responseBody {
+				t.Errorf("Expected caller to read full body %q, got %q", tt.responseBody, body)
+			}
+
+			span := recorder.RequireSpan(t, "POST "+server.Listener.Addr().String())
+			requestBody, hasRequest := spanAttr(span, HTTPRequestBodyKey)
+			if hasRequest != tt.wantCaptured || requestBody != tt.wantRequest {
+				t.Errorf("Expected request body %q, got %q (present=%v)", tt.wantRequest, requestBody, hasRequest)
+			}
+			responseBody, _ := spanAttr(span, HTTPResponseBodyKey)
+			if responseBody != tt.wantResponse {
+				t.Errorf("Expected response body %q, got %q", tt.wantResponse, responseBody)
+			}
+			if tt.maxBytes < len(tt.responseBody) {
+				recorder.AssertAttr(t, span, HTTPResponseBodyTruncatedKey, true)
+			}
+		})
+	}
+}
+
+func TestClientBodyRedactor(t *testing.T) {
+	recorder := tracetest.Start(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"token":"secret"}`)
+	}))
+	defer server.Close()
+
+	client := NewTracedHTTPClient(0,
+		WithBodyCaptureOnError(1024),
+		WithBodyRedactor(func(contentType string, body []byte) []byte {
+			return bytes.ReplaceAll(body, []byte("secret"), []byte("***"))
+		}),
+	)
+	resp, err := client.Get(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != `{"token":"secret"}` {
+		t.Errorf("Redaction must not change the body seen by the caller, got %q", body)
+	}
+	recorder.AssertAttr(t, recorder.RequireSpan(t, "GET "+server.Listener.Addr().String()), HTTPResponseBodyKey, `{"token":"***"}`)
+}
+
+func TestServerBodyCaptureOnError(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		wantResponse string
+	}{
+		{name: "CaptureOn500", status: http.StatusInternalServerError, wantResponse: "failed to save order\n"},
+		{name: "NoCaptureOn400", status: http.StatusBadRequest},
+		{name: "NoCaptureOn200", status: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.Start(t)
+
+			var received string
+			handler := OpenTelemetryMiddlewareWithOptions(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				received = string(body)
+				http.Error(w, "failed to save order", tt.status)
+			}), WithServerBodyCaptureOnError(1024))
+
+			req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"sku":"A1"}`))
+			req.Header.Set("Content-Type", "application/json")
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			if received != `{"sku":"A1"}` {
+				t.Errorf("Expected handler to read full request body, got %q", received)
+			}
+
+			span := recorder.RequireSpan(t, "POST /orders")
+			responseBody, _ := spanAttr(span, HTTPResponseBodyKey)
+			if responseBody != tt.wantResponse {
+				t.Errorf("Expected response body %q, got %q", tt.wantResponse, responseBody)
+			}
+			if tt.wantResponse != "" {
+				recorder.AssertAttr(t, span, HTTPRequestBodyKey, `{"sku":"A1"}`)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// 请求截止时间和取消原因相关的span属性键
+const (
+	HTTPClientDeadlineKey = "http.client.deadline_ms" // 发送请求时距离实际截止时间的剩余毫秒数
+	CancelReasonKey       = "cancel.reason"
+	CancelElapsedKey      = "elapsed_ms"
+
+	// RequestCancelledEvent 请求因超时或取消而失败时添加的span事件
+	RequestCancelledEvent = "request.cancelled"
+)
+
+// CancelReason 客户端请求失败的原因
+type CancelReason string
+
+const (
+	CancelClientTimeout  CancelReason = "client_timeout"  // 客户端配置的超时时间已到
+	CancelParentDeadline CancelReason = "parent_deadline" // 调用方context的截止时间已到
+	CancelParentCanceled CancelReason = "parent_canceled" // 调用方context被取消
+	CancelTransportError CancelReason = "transport_error" // 连接、读写等传输错误
+)
+
+// effectiveDeadline 返回context截止时间和客户端超时中较早的一个，都没有时返回false
+func effectiveDeadline(ctx context.Context, timeout time.Duration, start time.Time) (time.Time, bool) {
+	deadline, ok := ctx.Deadline()
+	if timeout > 0 {
+		if clientDeadline := start.Add(timeout); !ok || clientDeadline.Before(deadline) {
+			deadline, ok = clientDeadline, true
+		}
+	}
+	return deadline, ok
+}
+
+// classifyCancel 根据context状态和请求错误判断失败原因
+// context已结束时归因于调用方；否则超时错误在设置了客户端超时时归因于客户端超时
+func classifyCancel(ctx context.Context, timeout time.Duration, err error) CancelReason {
+	switch ctxErr := ctx.Err(); {
+	case errors.Is(ctxErr, context.DeadlineExceeded):
+		return CancelParentDeadline
+	case ctxErr != nil:
+		return CancelParentCanceled
+	}
+
+	if timeout > 0 {
+		var netErr net.Error
+		if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+			return CancelClientTimeout
+		}
+	}
+	return CancelTransportError
+}
+
+// recordCancel 将失败原因记录为span属性，超时或取消时添加request.cancelled事件
+func recordCancel(span trace.Span, reason CancelReason, elapsed time.Duration) {
+	span.SetAttributes(attribute.String(CancelReasonKey, string(reason)))
+	if reason != CancelTransportError {
+		AddEvent(span, RequestCancelledEvent,
+			attribute.String(CancelReasonKey, string(reason)),
+			attribute.Int64(CancelElapsedKey, elapsed.Milliseconds()),
+		)
+	}
+}
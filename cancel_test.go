@@ -0,0 +1,145 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/HsiaoL1/trace/tracetest"
+)
+
+// stallingServer 返回一个直到客户端断开才返回的服务器
+func stallingServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTracedHTTPClientCancelReason(t *testing.T) {
+	stalled := stallingServer(t)
+
+	// 收到请求后直接关闭连接
+	hangup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err == nil {
+			conn.Close()
+		}
+	}))
+	defer hangup.Close()
+
+	tests := []struct {
+		name        string
+		timeout     time.Duration
+		ctx         func() (context.Context, context.CancelFunc)
+		server      *httptest.Server
+		want        CancelReason
+		wantEvent   bool
+		maxDeadline int64 // 期望的最大剩余毫秒数，0表示不应记录截止时间
+	}{
+		{
+			name:    "ClientTimeout",
+			timeout: 50 * time.Millisecond,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 5*time.Second)
+			},
+			server:      stalled,
+			want:        CancelClientTimeout,
+			wantEvent:   true,
+			maxDeadline: 50,
+		},
+		{
+			name:    "ParentDeadline",
+			timeout: 5 * time.Second,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 50*time.Millisecond)
+			},
+			server:      stalled,
+			want:        CancelParentDeadline,
+			wantEvent:   true,
+			maxDeadline: 50,
+		},
+		{
+			name: "ParentCanceled",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(50*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			server:    stalled,
+			want:      CancelParentCanceled,
+			wantEvent: true,
+		},
+		{
+			name:    "TransportError",
+			timeout: 5 * time.Second,
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+			server:      hangup,
+			want:        CancelTransportError,
+			maxDeadline: 5000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.Start(t)
+			ctx, cancel := tt.ctx()
+			defer cancel()
+
+			start := time.Now()
+			resp, err := NewTracedHTTPClient(tt.timeout).Get(ctx, tt.server.URL)
+			if err == nil {
+				resp.Body.Close()
+				t.Fatal("Expected request to fail")
+			}
+			elapsed := time.Since(start)
+
+			span := recorder.RequireSpan(t, "GET "+tt.server.Listener.Addr().String())
+			recorder.AssertAttr(t, span, CancelReasonKey, string(tt.want))
+
+			deadline, ok := spanAttr(span, HTTPClientDeadlineKey)
+			if tt.maxDeadline == 0 {
+				if ok {
+					t.Errorf("Expected no deadline attribute, got %s", deadline)
+				}
+			} else if ms, err := strconv.ParseInt(deadline, 10, 64); !ok || err != nil || ms <= 0 || ms > tt.maxDeadline {
+				t.Errorf("Expected deadline in (0, %d]ms, got %q", tt.maxDeadline, deadline)
+			}
+
+			var events int
+			for _, event := range span.Events() {
+				if event.Name != RequestCancelledEvent {
+					continue
+				}
+				events++
+				for _, attr := range event.Attributes {
+					if string(attr.Key) == CancelElapsedKey {
+						if ms := attr.Value.AsInt64(); ms < 40 || ms > elapsed.Milliseconds() {
+							t.Errorf("Expected elapsed between 40ms and %dms, got %dms", elapsed.Milliseconds(), ms)
+						}
+					}
+				}
+			}
+			if tt.wantEvent && events != 1 || !tt.wantEvent && events != 0 {
+				t.Errorf("Expected wantEvent=%v, got %d %s events", tt.wantEvent, events, RequestCancelledEvent)
+			}
+		})
+	}
+}
+
+func TestClassifyCancelWithoutClientTimeout(t *testing.T) {
+	// 没有配置客户端超时时，超时错误不归因于客户端
+	if got := classifyCancel(context.Background(), 0, context.DeadlineExceeded); got != CancelTransportError {
+		t.Errorf("Expected %s, got %s", CancelTransportError, got)
+	}
+}
@@ -0,0 +1,99 @@
+package trace
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ParseTrustedProxies 解析受信任代理列表，每个值可以包含逗号分隔的多个CIDR或IP地址
+// 单个IP地址视为/32（IPv6为/128）
+func ParseTrustedProxies(values ...string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			if strings.Contains(item, "/") {
+				prefix, err := netip.ParsePrefix(item)
+				if err != nil {
+					return nil, fmt.Errorf("invalid trusted proxy %q: %w", item, err)
+				}
+				prefixes = append(prefixes, prefix.Masked())
+				continue
+			}
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", item, err)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+		}
+	}
+	return prefixes, nil
+}
+
+// ClientIP 返回请求的客户端IP
+// 只有直接连接的对端属于受信任代理时才使用X-Forwarded-For：从右向左跳过受信任代理，返回第一个不受信任的地址；
+// 没有X-Forwarded-For时使用X-Real-IP。对端不受信任时忽略这两个请求头，防止客户端伪造
+func ClientIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	peer, ok := parseHopAddr(r.RemoteAddr)
+	if !ok {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return r.RemoteAddr
+		}
+		return host
+	}
+	if !isTrustedProxy(peer, trustedProxies) {
+		return peer.String()
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		client := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop, ok := parseHopAddr(strings.TrimSpace(hops[i]))
+			if !ok {
+				// 无法解析的地址之后的内容不可信，使用最后一个受信任代理报告的地址
+				break
+			}
+			client = hop
+			if !isTrustedProxy(hop, trustedProxies) {
+				break
+			}
+		}
+		return client.String()
+	}
+
+	if realIP, ok := parseHopAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ok {
+		return realIP.String()
+	}
+	return peer.String()
+}
+
+// parseHopAddr 解析IP或IP:端口形式的地址，IPv4映射的IPv6地址转换为IPv4
+func parseHopAddr(value string) (netip.Addr, bool) {
+	if addrPort, err := netip.ParseAddrPort(value); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	addr, err := netip.ParseAddr(strings.Trim(value, "[]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// isTrustedProxy 检查地址是否属于受信任代理
+func isTrustedProxy(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
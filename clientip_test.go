@@ -0,0 +1,90 @@
+package trace
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/HsiaoL1/trace/tracetest"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.1", "fd00::/8")
+	if err != nil {
+		t.Fatalf("Failed to parse trusted proxies: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		realIP     string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:5000", nil, "", "203.0.113.7"},
+		{"spoofed XFF from untrusted peer", "203.0.113.7:5000", []string{"1.2.3.4"}, "", "203.0.113.7"},
+		{"spoofed X-Real-IP from untrusted peer", "203.0.113.7:5000", nil, "1.2.3.4", "203.0.113.7"},
+		{"single hop", "10.0.0.1:443", []string{"198.51.100.9"}, "", "198.51.100.9"},
+		{"chain resolves to first untrusted hop", "10.0.0.1:443", []string{"1.2.3.4, 198.51.100.9, 10.2.3.4"}, "", "198.51.100.9"},
+		{"chain across headers", "10.0.0.1:443", []string{"1.2.3.4, 198.51.100.9", "192.168.1.1"}, "", "198.51.100.9"},
+		{"all hops trusted", "10.0.0.1:443", []string{"10.9.9.9, 10.2.3.4"}, "", "10.9.9.9"},
+		{"hop with port", "10.0.0.1:443", []string{"198.51.100.9:1234"}, "", "198.51.100.9"},
+		{"garbage hop stops walk", "10.0.0.1:443", []string{"198.51.100.9, unknown, 10.2.3.4"}, "", "10.2.3.4"},
+		{"X-Real-IP from trusted peer", "10.0.0.1:443", nil, "198.51.100.9", "198.51.100.9"},
+		{"trusted peer without headers", "10.0.0.1:443", nil, "", "10.0.0.1"},
+		{"IPv6 peer", "[fd00::1]:443", []string{"2001:db8::5"}, "", "2001:db8::5"},
+		{"IPv4-mapped peer", "[::ffff:10.0.0.1]:443", []string{"198.51.100.9"}, "", "198.51.100.9"},
+		{"unparseable remote addr", "pipe", []string{"198.51.100.9"}, "", "pipe"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if got := ClientIP(r, trusted); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesErrors(t *testing.T) {
+	for _, value := range []string{"10.0.0.0/33", "not-an-ip", "10.0.0.1:80"} {
+		if _, err := ParseTrustedProxies(value); err == nil {
+			t.Errorf("Expected error for %q", value)
+		}
+	}
+
+	config := DefaultConfig()
+	config.TrustedProxies = []string{"10.0.0.0/8", "bogus"}
+	if err := config.Validate(); err == nil {
+		t.Error("Expected Validate to reject invalid trusted proxy")
+	}
+	config.Fix()
+	if len(config.TrustedProxies) != 1 || config.TrustedProxies[0] != "10.0.0.0/8" {
+		t.Errorf("Expected Fix to drop invalid proxy, got %v", config.TrustedProxies)
+	}
+}
+
+func TestMiddlewareTrustedProxies(t *testing.T) {
+	recorder := tracetest.Start(t)
+	trusted, _ := ParseTrustedProxies("10.0.0.0/8")
+
+	handler := OpenTelemetryMiddlewareWithOptions(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		WithTrustedProxies(trusted...))
+
+	r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	r.RemoteAddr = "10.0.0.1:443"
+	r.Header.Set("X-Forwarded-For", "198.51.100.9")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	span := recorder.RequireSpan(t, "GET /orders")
+	recorder.AssertAttr(t, span, "net.peer.ip", "198.51.100.9")
+	recorder.AssertAttr(t, span, "net.sock.peer.addr", "10.0.0.1")
+}
@@ -0,0 +1,475 @@
+// trace-logs 查询和管理logz聚合日志的命令行工具
+//
+// 用法:
+//
+//	trace-logs query --trace-id abc123 --dir logs --limit 20
+//	trace-logs query --file customer.log.gz --level error
+//	zcat app.log.gz | trace-logs query --stdin --trace-id abc123
+//	trace-logs tail --level error
+//	trace-logs stats
+//	trace-logs cleanup --days 7 --dry-run
+//	trace-logs rebuild-index
+//
+// 退出码: 0 成功，1 query没有匹配的日志，2 参数或执行错误
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz"
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// 退出码
+const (
+	exitOK      = 0
+	exitNoMatch = 1
+	exitError   = 2
+)
+
+// 输出格式
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+const usage = `用法: trace-logs <命令> [参数]
+
+命令:
+  query          查询日志，没有匹配的日志时退出码为1
+  tail           持续输出新写入的日志，Ctrl+C退出
+  stats          显示日志文件统计信息
+  cleanup        删除超过保留天数的日志文件
+  rebuild-index  根据数据文件重建索引
+
+使用 "trace-logs <命令> -h" 查看命令的参数
+`
+
+// now 返回当前时间，测试中可替换以固定--since/--until的基准时间
+var now = time.Now
+
+// stdin query --stdin读取的输入，测试中可替换
+var stdin io.Reader = os.Stdin
+
+// errUsage 参数错误，错误信息已由flag包输出
+var errUsage = errors.New("参数错误")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run 执行命令并返回退出码
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitError
+	}
+
+	var matched = true
+	var err error
+	switch name, args := args[0], args[1:]; name {
+	case "query":
+		matched, err = runQuery(ctx, args, stdout, stderr)
+	case "tail":
+		err = runTail(ctx, args, stdout, stderr)
+	case "stats":
+		err = runStats(args, stdout, stderr)
+	case "cleanup":
+		err = runCleanup(args, stdout, stderr)
+	case "rebuild-index":
+		err = runRebuildIndex(ctx, args, stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "未知命令: %s\n\n%s", name, usage)
+		return exitError
+	}
+
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.Is(err, errUsage):
+		return exitError
+	case err != nil:
+		fmt.Fprintf(stderr, "trace-logs %s: %v\n", args[0], err)
+		return exitError
+	case !matched:
+		return exitNoMatch
+	}
+	return exitOK
+}
+
+// defaultLogDir 默认日志目录，与Web服务器一致使用LOG_DIR环境变量
+func defaultLogDir() string {
+	if dir := os.Getenv("LOG_DIR"); dir != "" {
+		return dir
+	}
+	return "logs"
+}
+
+// newFlagSet 创建子命令的参数集，解析错误时由调用方返回退出码而不是直接退出
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("trace-logs "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
+
+// parseFlags 解析参数，不接受多余的位置参数
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if fs.NArg() > 0 {
+		return usageError(fs, "多余的参数: %s", strings.Join(fs.Args(), " "))
+	}
+	return nil
+}
+
+// usageError 输出参数错误和用法，返回errUsage
+func usageError(fs *flag.FlagSet, format string, args ...any) error {
+	fmt.Fprintf(fs.Output(), format+"\n", args...)
+	fs.Usage()
+	return errUsage
+}
+
+// queryOptions query和tail命令的参数
+type queryOptions struct {
+	dir      string
+	output   string
+	interval time.Duration // 仅tail使用
+	files    fileList      // 仅query使用，设置时查询这些文件而不是目录
+	stdin    bool          // 仅query使用，查询标准输入
+	query    aggregate.LogQuery
+}
+
+// fileList 可重复指定的--file参数
+type fileList []string
+
+func (f *fileList) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *fileList) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// parseQueryArgs 解析query和tail命令的参数
+func parseQueryArgs(name string, args []string, stderr io.Writer) (*queryOptions, error) {
+	fs := newFlagSet(name, stderr)
+	opts := &queryOptions{}
+	q := &opts.query
+
+	fs.StringVar(&opts.dir, "dir", defaultLogDir(), "日志目录")
+	fs.StringVar(&opts.output, "output", outputText, "输出格式: text或json")
+	fs.StringVar(&q.TraceID, "trace-id", "", "按TraceID过滤")
+	fs.StringVar(&q.SpanID, "span-id", "", "按SpanID过滤")
+	fs.StringVar(&q.Level, "level", "", "按日志级别过滤，支持warning、err等别名")
+	fs.StringVar(&q.Service, "service", "", "按服务名过滤")
+	fs.StringVar(&q.Hostname, "hostname", "", "按主机名过滤")
+	fs.StringVar(&q.Message, "message", "", "按消息内容过滤（正则表达式）")
+	fs.BoolVar(&q.Recursive, "recursive", false, "在子目录中查找日志文件")
+	patterns := fs.String("pattern", "", "逗号分隔的日志文件匹配模式，默认*.log")
+	since := fs.String("since", "", "只显示该时间之后的日志，如30m、24h、today、yesterday或RFC3339时间")
+	until := fs.String("until", "", "只显示该时间之前的日志，格式同--since")
+	if name == "query" {
+		fs.IntVar(&q.Limit, "limit", 100, "最多返回的条数")
+		fs.IntVar(&q.Offset, "offset", 0, "跳过的条数")
+		fs.Var(&opts.files, "file", "查询指定的日志文件而不是--dir，可重复指定，gzip文件按内容自动识别")
+		fs.BoolVar(&opts.stdin, "stdin", false, "查询标准输入中的日志，gzip内容自动解压")
+	} else {
+		fs.DurationVar(&opts.interval, "interval", aggregate.DefaultTailInterval, "检查新内容的间隔")
+	}
+
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+
+	if opts.output != outputText && opts.output != outputJSON {
+		return nil, usageError(fs, "无效的输出格式: %s", opts.output)
+	}
+	if opts.stdin && len(opts.files) > 0 {
+		return nil, usageError(fs, "--file和--stdin不能同时使用")
+	}
+	if q.Level != "" {
+		level, err := logz.NormalizeLevel(q.Level)
+		if err != nil {
+			return nil, usageError(fs, "%v", err)
+		}
+		q.Level = level
+	}
+	if q.Limit < 0 || q.Offset < 0 {
+		return nil, usageError(fs, "--limit和--offset不能为负数")
+	}
+	if *patterns != "" {
+		for _, pattern := range strings.Split(*patterns, ",") {
+			if pattern = strings.TrimSpace(pattern); pattern != "" {
+				q.PathPatterns = append(q.PathPatterns, pattern)
+			}
+		}
+	}
+
+	// today和yesterday按本地时区的日期边界解析
+	var err error
+	var queryErr *aggregate.QueryError
+	if q.StartTime, q.EndTime, err = aggregate.ResolveTimeRange(*since, *until, now(), time.Local); errors.As(err, &queryErr) {
+		return nil, usageError(fs, "无效的--%s: %v", queryErr.Field, queryErr.Err)
+	}
+	return opts, nil
+}
+
+// runQuery 执行query命令，返回是否有匹配的日志
+func runQuery(ctx context.Context, args []string, stdout, stderr io.Writer) (bool, error) {
+	opts, err := parseQueryArgs("query", args, stderr)
+	if err != nil {
+		return false, err
+	}
+
+	var result *aggregate.LogQueryResult
+	switch {
+	case opts.stdin:
+		result, err = aggregate.QueryReader(ctx, stdin, opts.query)
+	case len(opts.files) > 0:
+		result, err = aggregate.QueryFiles(ctx, opts.files, opts.query)
+	default:
+		result, err = aggregate.QueryLogsContext(ctx, opts.query, opts.dir)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if opts.output == outputJSON {
+		return result.Total > 0, writeJSON(stdout, result)
+	}
+
+	tw := newTableWriter(stdout)
+	fmt.Fprintln(tw, "TIMESTAMP\tLEVEL\tSERVICE\tTRACE_ID\tMESSAGE")
+	for _, entry := range result.Entries {
+		fmt.Fprintln(tw, strings.Join(entryColumns(entry), "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return false, err
+	}
+	if shown := len(result.Entries); shown > 0 && shown < result.Total {
+		fmt.Fprintf(stderr, "共 %d 条，显示第 %d-%d 条\n", result.Total, result.Offset+1, result.Offset+shown)
+	}
+	for _, file := range sortedKeys(result.ParseErrors) {
+		fmt.Fprintf(stderr, "%s: 跳过 %d 行无效日志\n", file, result.ParseErrors[file])
+	}
+	return result.Total > 0, nil
+}
+
+// runTail 执行tail命令，直到ctx取消
+func runTail(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	opts, err := parseQueryArgs("tail", args, stderr)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(stdout)
+	return aggregate.TailLogs(ctx, opts.query, opts.dir, opts.interval, func(entry aggregate.LogEntry) error {
+		if opts.output == outputJSON {
+			return encoder.Encode(entry)
+		}
+		_, err := fmt.Fprintln(stdout, strings.Join(entryColumns(entry), "  "))
+		return err
+	})
+}
+
+// runStats 执行stats命令
+func runStats(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("stats", stderr)
+	dir := fs.String("dir", defaultLogDir(), "日志目录")
+	output := fs.String("output", outputText, "输出格式: text或json")
+	recursive := fs.Bool("recursive", false, "在子目录中查找日志文件")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *output != outputText && *output != outputJSON {
+		return usageError(fs, "无效的输出格式: %s", *output)
+	}
+
+	stats, err := aggregate.GetLogStatsWithOptions(*dir, aggregate.DiscoverOptions{Recursive: *recursive})
+	if err != nil {
+		return err
+	}
+	services, err := aggregate.DiscoverServices(*dir)
+	if err != nil {
+		return err
+	}
+	stats["services"] = services
+
+	if *output == outputJSON {
+		return writeJSON(stdout, stats)
+	}
+
+	tw := newTableWriter(stdout)
+	fmt.Fprintf(tw, "文件数:\t%d\n", stats["total_files"])
+	fmt.Fprintf(tw, "总大小:\t%s\n", formatBytes(stats["total_size"].(int64)))
+	fmt.Fprintf(tw, "无效行数:\t%d\n", stats["malformed_lines"])
+	fmt.Fprintf(tw, "最早的文件:\t%s\n", valueOrDash(stats["oldest_file"].(string)))
+	fmt.Fprintf(tw, "最新的文件:\t%s\n", valueOrDash(stats["newest_file"].(string)))
+	fmt.Fprintf(tw, "服务:\t%s\n", valueOrDash(strings.Join(services, ", ")))
+	return tw.Flush()
+}
+
+// runCleanup 执行cleanup命令
+func runCleanup(args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("cleanup", stderr)
+	dir := fs.String("dir", defaultLogDir(), "日志目录")
+	days := fs.Int("days", 7, "保留天数")
+	dryRun := fs.Bool("dry-run", false, "只列出将被删除的文件")
+	output := fs.String("output", outputText, "输出格式: text或json")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *output != outputText && *output != outputJSON {
+		return usageError(fs, "无效的输出格式: %s", *output)
+	}
+	if *days < 1 {
+		return usageError(fs, "--days必须大于0")
+	}
+
+	report, err := aggregate.CleanupOldLogsWithDryRun(*dir, *days, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	if *output == outputJSON {
+		if err := writeJSON(stdout, report); err != nil {
+			return err
+		}
+	} else {
+		action := "已删除"
+		if report.DryRun {
+			action = "将删除"
+		}
+		for _, file := range report.Files {
+			fmt.Fprintf(stdout, "%s %s\n", action, file)
+		}
+		fmt.Fprintf(stdout, "%s %d 个文件，释放 %s\n", action, report.FilesDeleted, formatBytes(report.BytesFreed))
+	}
+
+	// 没有运行中的聚合器时不会同步清理索引
+	if !report.DryRun && report.FilesDeleted > 0 {
+		if _, err := os.Stat(filepath.Join(*dir, "index")); err == nil {
+			fmt.Fprintln(stderr, "索引中可能仍引用已删除的文件，可运行 trace-logs rebuild-index 重建索引")
+		}
+	}
+	return errors.Join(report.Errors...)
+}
+
+// runRebuildIndex 执行rebuild-index命令，未指定服务时重建所有服务的索引
+func runRebuildIndex(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	fs := newFlagSet("rebuild-index", stderr)
+	dir := fs.String("dir", defaultLogDir(), "日志目录")
+	service := fs.String("service", "", "服务名，为空时重建所有服务的索引")
+	output := fs.String("output", outputText, "输出格式: text或json")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *output != outputText && *output != outputJSON {
+		return usageError(fs, "无效的输出格式: %s", *output)
+	}
+
+	services := []string{*service}
+	if *service == "" {
+		var err error
+		if services, err = aggregate.DiscoverServices(*dir); err != nil {
+			return err
+		}
+		if len(services) == 0 {
+			return fmt.Errorf("%s中没有聚合器写入的日志文件", *dir)
+		}
+	}
+
+	indexed := make(map[string]int, len(services))
+	for _, name := range services {
+		n, err := aggregate.RebuildIndexContext(ctx, *dir, name)
+		if err != nil {
+			return fmt.Errorf("重建服务%s的索引失败: %w", name, err)
+		}
+		indexed[name] = n
+		if *output == outputText {
+			fmt.Fprintf(stdout, "%s: 已索引 %d 条日志\n", name, n)
+		}
+	}
+
+	if *output == outputJSON {
+		return writeJSON(stdout, indexed)
+	}
+	return nil
+}
+
+// entryColumns 返回日志条目的输出列，空字段显示为"-"
+func entryColumns(entry aggregate.LogEntry) []string {
+	return []string{
+		valueOrDash(entry.Timestamp),
+		valueOrDash(strings.ToUpper(entry.Level)),
+		valueOrDash(entry.Service),
+		valueOrDash(entry.TraceID),
+		strings.ReplaceAll(entry.Message, "\n", `\n`),
+	}
+}
+
+func valueOrDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func newTableWriter(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+}
+
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// formatBytes 以易读的单位格式化字节数
+func formatBytes(n int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	size := float64(n)
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.1f %s", size, units[i])
+}
+
+// sortedKeys 返回map的键（已排序）
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
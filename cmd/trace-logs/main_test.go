@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "更新testdata中的golden文件")
+
+// fixedNow 固定--since/--until的基准时间
+func fixedNow(t *testing.T) time.Time {
+	t.Helper()
+	current := time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC)
+	original := now
+	now = func() time.Time { return current }
+	t.Cleanup(func() { now = original })
+	return current
+}
+
+func TestParseQueryArgs(t *testing.T) {
+	current := fixedNow(t)
+	t.Setenv("LOG_DIR", "/var/log/app")
+
+	opts, err := parseQueryArgs("query", []string{
+		"--trace-id", "abc123", "--level", "WARNING", "--service", "payments",
+		"--since", "2h", "--until", "2024-01-15T10:30:00Z",
+		"--limit", "20", "--offset", "5", "--pattern", "*.log, *.jsonl", "--output", "json",
+	}, io.Discard)
+	if err != nil {
+		t.Fatalf("解析参数失败: %v", err)
+	}
+
+	q := opts.query
+	if opts.dir != "/var/log/app" {
+		t.Errorf("期望默认目录取自LOG_DIR，得到 %q", opts.dir)
+	}
+	if opts.output != outputJSON {
+		t.Errorf("期望输出格式json，得到 %q", opts.output)
+	}
+	if q.TraceID != "abc123" || q.Service != "payments" {
+		t.Errorf("期望TraceID和服务名被设置，得到 %+v", q)
+	}
+	if q.Level != "warn" {
+		t.Errorf("期望级别被规范化为warn，得到 %q", q.Level)
+	}
+	if !q.StartTime.Equal(current.Add(-2 * time.Hour)) {
+		t.Errorf("期望--since 2h为 %v，得到 %v", current.Add(-2*time.Hour), q.StartTime)
+	}
+	if want := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC); !q.EndTime.Equal(want) {
+		t.Errorf("期望--until为 %v，得到 %v", want, q.EndTime)
+	}
+	if q.Limit != 20 || q.Offset != 5 {
+		t.Errorf("期望limit=20 offset=5，得到 %d %d", q.Limit, q.Offset)
+	}
+	if len(q.PathPatterns) != 2 || q.PathPatterns[0] != "*.log" || q.PathPatterns[1] != "*.jsonl" {
+		t.Errorf("期望两个匹配模式，得到 %q", q.PathPatterns)
+	}
+
+	// today和yesterday按本地时区的日期边界解析
+	opts, err = parseQueryArgs("query", []string{"--since", "yesterday", "--until", "yesterday"}, io.Discard)
+	if err != nil {
+		t.Fatalf("解析参数失败: %v", err)
+	}
+	year, month, day := current.In(time.Local).Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+	if q := opts.query; !q.StartTime.Equal(today.AddDate(0, 0, -1)) || !q.EndTime.Equal(today.Add(-time.Nanosecond)) {
+		t.Errorf("期望yesterday为前一天的零点到最后一刻，得到 %v - %v", q.StartTime, q.EndTime)
+	}
+
+	// tail没有分页参数，默认每秒检查一次
+	opts, err = parseQueryArgs("tail", []string{"--level", "error", "--dir", "logs"}, io.Discard)
+	if err != nil {
+		t.Fatalf("解析tail参数失败: %v", err)
+	}
+	if opts.query.Limit != 0 || opts.interval != time.Second || opts.dir != "logs" {
+		t.Errorf("tail参数不符合预期: %+v", opts)
+	}
+}
+
+func TestParseQueryArgsErrors(t *testing.T) {
+	fixedNow(t)
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"未知参数", []string{"--bogus"}},
+		{"多余的位置参数", []string{"--limit", "5", "extra"}},
+		{"无效级别", []string{"--level", "verbose"}},
+		{"无效输出格式", []string{"--output", "yaml"}},
+		{"无效时间", []string{"--since", "someday"}},
+		{"负数时长", []string{"--since", "-1h"}},
+		{"时间范围颠倒", []string{"--since", "10m", "--until", "1h"}},
+		{"负数limit", []string{"--limit", "-1"}},
+		{"tail不支持limit", []string{"--limit", "5"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := "query"
+			if strings.HasPrefix(tt.name, "tail") {
+				name = "tail"
+			}
+			if _, err := parseQueryArgs(name, tt.args, io.Discard); err != errUsage {
+				t.Errorf("期望errUsage，得到 %v", err)
+			}
+		})
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	fixedNow(t)
+	dir := filepath.Join("testdata", "logs")
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"有匹配", []string{"query", "--dir", dir, "--level", "error"}, exitOK},
+		{"无匹配", []string{"query", "--dir", dir, "--trace-id", "missing"}, exitNoMatch},
+		{"参数错误", []string{"query", "--dir", dir, "--level", "verbose"}, exitError},
+		{"查询错误", []string{"query", "--dir", dir, "--pattern", "["}, exitError},
+		{"帮助", []string{"query", "-h"}, exitOK},
+		{"未知命令", []string{"grep"}, exitError},
+		{"没有命令", nil, exitError},
+		{"stats", []string{"stats", "--dir", dir}, exitOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if got := run(context.Background(), tt.args, &stdout, &stderr); got != tt.want {
+				t.Errorf("期望退出码 %d，得到 %d\nstderr: %s", tt.want, got, stderr.String())
+			}
+		})
+	}
+}
+
+func TestQueryGolden(t *testing.T) {
+	fixedNow(t)
+	dir := filepath.Join("testdata", "logs")
+
+	tests := []struct {
+		golden string
+		args   []string
+	}{
+		{"query_trace.golden", []string{"query", "--dir", dir, "--trace-id", "4bf92f3577b34da6a3ce929d0e0e4736"}},
+		{"query_since.golden", []string{"query", "--dir", dir, "--since", "45m", "--level", "err"}},
+		{"query_json.golden", []string{"query", "--dir", dir, "--service", "payments", "--limit", "1", "--output", "json"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			var stdout bytes.Buffer
+			if code := run(context.Background(), tt.args, &stdout, io.Discard); code != exitOK {
+				t.Fatalf("期望退出码0，得到 %d", code)
+			}
+
+			path := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(path, stdout.Bytes(), 0644); err != nil {
+					t.Fatalf("写入golden文件失败: %v", err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("读取golden文件失败: %v", err)
+			}
+			if got := stdout.String(); got != string(want) {
+				t.Errorf("输出与%s不一致\n期望:\n%s\n得到:\n%s", tt.golden, want, got)
+			}
+		})
+	}
+}
+
+func TestQueryFileAndStdin(t *testing.T) {
+	fixedNow(t)
+	path := filepath.Join("testdata", "logs", "checkout_2024-01-15_001.log")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("读取测试数据失败: %v", err)
+	}
+	want, err := os.ReadFile(filepath.Join("testdata", "query_trace.golden"))
+	if err != nil {
+		t.Fatalf("读取golden文件失败: %v", err)
+	}
+
+	// 管道输入为gzip压缩的内容
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write(data)
+	gz.Close()
+	original := stdin
+	stdin = &compressed
+	t.Cleanup(func() { stdin = original })
+
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	for name, args := range map[string][]string{
+		"file":  {"query", "--file", path, "--trace-id", traceID},
+		"stdin": {"query", "--stdin", "--trace-id", traceID},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := run(context.Background(), args, &stdout, &stderr); code != exitOK {
+				t.Fatalf("期望退出码0，得到 %d\nstderr: %s", code, stderr.String())
+			}
+			if got := stdout.String(); got != string(want) {
+				t.Errorf("期望输出与目录查询一致\n期望:\n%s\n得到:\n%s", want, got)
+			}
+		})
+	}
+
+	args := []string{"query", "--stdin", "--file", path}
+	if code := run(context.Background(), args, io.Discard, io.Discard); code != exitError {
+		t.Errorf("期望--file和--stdin同时使用时退出码为2，得到 %d", code)
+	}
+	args = []string{"query", "--file", filepath.Join("testdata", "missing.log")}
+	if code := run(context.Background(), args, io.Discard, io.Discard); code != exitError {
+		t.Errorf("期望文件不存在时退出码为2，得到 %d", code)
+	}
+}
+
+func TestRebuildIndexCommand(t *testing.T) {
+	dir := t.TempDir()
+	data, err := os.ReadFile(filepath.Join("testdata", "logs", "checkout_2024-01-15_001.log"))
+	if err != nil {
+		t.Fatalf("读取测试数据失败: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "checkout_2024-01-15_001.log"), data, 0644); err != nil {
+		t.Fatalf("写入测试数据失败: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run(context.Background(), []string{"rebuild-index", "--dir", dir}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("期望退出码0，得到 %d: %s", code, stderr.String())
+	}
+	if got, want := stdout.String(), "checkout: 已索引 6 条日志\n"; got != want {
+		t.Errorf("期望输出 %q，得到 %q", want, got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "index", "checkout.db")); err != nil {
+		t.Errorf("期望创建索引数据库: %v", err)
+	}
+}
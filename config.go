@@ -1,12 +1,43 @@
 package trace
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
 )
 
+// ValidLogLevels 规范化后的日志级别
+var ValidLogLevels = []string{"trace", "debug", "info", "warn", "error", "fatal", "panic"}
+
+// logLevelAliases 日志级别别名到规范名称的映射
+var logLevelAliases = map[string]string{
+	"warning":     "warn",
+	"err":         "error",
+	"information": "info",
+	"dbg":         "debug",
+}
+
+// ErrInvalidLogLevel 无法识别的日志级别
+var ErrInvalidLogLevel = errors.New("invalid log level")
+
+// NormalizeLogLevel 将日志级别规范化为ValidLogLevels之一，忽略大小写和首尾空白
+// 支持常见别名（如warning→warn、err→error），无法识别时返回包含ErrInvalidLogLevel的错误
+func NormalizeLogLevel(level string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(level))
+	for _, valid := range ValidLogLevels {
+		if normalized == valid {
+			return valid, nil
+		}
+	}
+	if canonical, ok := logLevelAliases[normalized]; ok {
+		return canonical, nil
+	}
+	return "", fmt.Errorf("%w %q, valid levels are: %s (aliases: warning, err, information, dbg)",
+		ErrInvalidLogLevel, level, strings.Join(ValidLogLevels, ", "))
+}
+
 // Config 追踪配置
 type Config struct {
 	// Jaeger配置
@@ -22,6 +53,9 @@ type Config struct {
 	// 邮件配置
 	SMTP SMTPConfig `json:"smtp" yaml:"smtp"`
 
+	// 受信任的代理（CIDR或IP），来自这些代理的请求使用X-Forwarded-For中的客户端IP
+	TrustedProxies []string `json:"trusted_proxies" yaml:"trusted_proxies"`
+
 	// 其他配置
 	Debug   bool `json:"debug" yaml:"debug"`
 	Metrics bool `json:"metrics" yaml:"metrics"`
@@ -68,6 +102,11 @@ func LoadConfigFromEnv() *Config {
 	// 加载SMTP配置
 	config.SMTP = LoadSMTPConfigFromEnv()
 
+	// 加载受信任代理配置
+	if proxies := os.Getenv("TRACE_TRUSTED_PROXIES"); proxies != "" {
+		config.TrustedProxies = strings.Split(proxies, ",")
+	}
+
 	// 加载其他配置
 	if debug := os.Getenv("TRACE_DEBUG"); debug != "" {
 		if parsed, err := strconv.ParseBool(debug); err == nil {
@@ -96,18 +135,8 @@ func (c *Config) Validate() error {
 	}
 
 	// 验证日志级别
-	validLogLevels := map[string]bool{
-		"debug":   true,
-		"info":    true,
-		"warn":    true,
-		"warning": true,
-		"error":   true,
-		"fatal":   true,
-		"panic":   true,
-	}
-
-	if !validLogLevels[strings.ToLower(c.LogLevel)] {
-		return fmt.Errorf("invalid log level: %s, valid levels are: debug, info, warn, warning, error, fatal, panic", c.LogLevel)
+	if _, err := NormalizeLogLevel(c.LogLevel); err != nil {
+		return err
 	}
 
 	// 验证Jaeger配置
@@ -115,6 +144,11 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid Jaeger config: %w", err)
 	}
 
+	// 验证受信任代理
+	if _, err := ParseTrustedProxies(c.TrustedProxies...); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -130,17 +164,9 @@ func (c *Config) Fix() {
 	}
 
 	// 修复日志级别
-	validLogLevels := map[string]bool{
-		"debug":   true,
-		"info":    true,
-		"warn":    true,
-		"warning": true,
-		"error":   true,
-		"fatal":   true,
-		"panic":   true,
-	}
-
-	if !validLogLevels[strings.ToLower(c.LogLevel)] {
+	if level, err := NormalizeLogLevel(c.LogLevel); err == nil {
+		c.LogLevel = level
+	} else {
 		c.LogLevel = "info"
 	}
 
@@ -157,6 +183,16 @@ func (c *Config) Fix() {
 	if c.Jaeger.Version == "" {
 		c.Jaeger.Version = "1.0.0"
 	}
+	fixSpanLimits(&c.Jaeger)
+
+	// 移除无效的受信任代理
+	var proxies []string
+	for _, proxy := range c.TrustedProxies {
+		if _, err := ParseTrustedProxies(proxy); err == nil {
+			proxies = append(proxies, proxy)
+		}
+	}
+	c.TrustedProxies = proxies
 }
 
 // String 返回配置的字符串表示
@@ -164,6 +200,10 @@ func (c *Config) String() string {
 	if c == nil {
 		return "<nil config>"
 	}
+	jaeger := c.Jaeger
+	if jaeger.ForceSampleToken != "" {
+		jaeger.ForceSampleToken = "***"
+	}
 	return fmt.Sprintf("Config{Jaeger: %+v, LogLevel: %s, LogFile: %s, SamplingRatio: %f, Debug: %t, Metrics: %t}",
-		c.Jaeger, c.LogLevel, c.LogFile, c.SamplingRatio, c.Debug, c.Metrics)
+		jaeger, c.LogLevel, c.LogFile, c.SamplingRatio, c.Debug, c.Metrics)
 }
@@ -0,0 +1,248 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// InitJaeger的调用状态
+const (
+	InitStateNotInitialized = "not_initialized" // 没有调用InitJaeger
+	InitStateDisabled       = "disabled"        // 以Enabled=false调用InitJaeger，没有安装provider
+	InitStateEnabled        = "enabled"
+)
+
+// DiagnosticsProbeTimeout Diagnostics连接导出端点的超时时间
+var DiagnosticsProbeTimeout = 2 * time.Second
+
+// DiagnosticsReport 追踪配置的自检结果
+type DiagnosticsReport struct {
+	// ProviderInstalled 全局TracerProvider是否会产生真实的span（不是OpenTelemetry默认的no-op provider）
+	ProviderInstalled bool   `json:"provider_installed"`
+	ProviderType      string `json:"provider_type"`
+	InitState         string `json:"init_state"`
+
+	// 以下字段只在InitJaeger安装provider后有值
+	ServiceName       string            `json:"service_name,omitempty"`
+	Endpoint          string            `json:"endpoint,omitempty"`           // 导出端点host:port和路径
+	EndpointReachable bool              `json:"endpoint_reachable,omitempty"` // 在DiagnosticsProbeTimeout内建立了TCP连接
+	EndpointError     string            `json:"endpoint_error,omitempty"`
+	Sampler           string            `json:"sampler,omitempty"`
+	Resource          map[string]string `json:"resource,omitempty"`
+
+	// Propagators 全局propagator注入和提取的请求头
+	Propagators []string `json:"propagators"`
+
+	// 导出统计
+	ExportedSpans   uint64    `json:"exported_spans"`
+	ExportBatches   uint64    `json:"export_batches"`
+	ExportErrors    uint64    `json:"export_errors"`
+	LastExportAt    time.Time `json:"last_export_at,omitempty"`
+	LastExportError string    `json:"last_export_error,omitempty"`
+	LastErrorAt     time.Time `json:"last_error_at,omitempty"`
+
+	// Warnings 发现的问题，为空表示没有问题
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// tracingSetup InitJaeger记录的配置
+type tracingSetup struct {
+	state       string
+	serviceName string
+	endpoint    otlpEndpoint
+	sampler     string
+	resource    *resource.Resource
+	exports     *exportStats
+}
+
+var (
+	setupMutex   sync.Mutex
+	currentSetup = tracingSetup{state: InitStateNotInitialized}
+)
+
+// recordSetup 记录InitJaeger的配置
+func recordSetup(setup tracingSetup) {
+	setupMutex.Lock()
+	defer setupMutex.Unlock()
+	currentSetup = setup
+}
+
+// exportStats 导出器的调用统计
+type exportStats struct {
+	batches atomic.Uint64
+	spans   atomic.Uint64
+	errors  atomic.Uint64
+
+	mutex        sync.Mutex
+	lastExportAt time.Time
+	lastErr      string
+	lastErrAt    time.Time
+}
+
+// diagnosticExporter 统计导出的span数和错误
+type diagnosticExporter struct {
+	sdktrace.SpanExporter
+	stats *exportStats
+}
+
+// ExportSpans 实现SpanExporter接口
+func (e *diagnosticExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	now := time.Now()
+	e.stats.batches.Add(1)
+	e.stats.mutex.Lock()
+	defer e.stats.mutex.Unlock()
+	if err != nil {
+		e.stats.errors.Add(1)
+		e.stats.lastErr, e.stats.lastErrAt = err.Error(), now
+		return err
+	}
+	e.stats.spans.Add(uint64(len(spans)))
+	e.stats.lastExportAt = now
+	return nil
+}
+
+// providerInstalled 检查provider是否产生真实的span：OpenTelemetry在SetTracerProvider之前返回的全局provider
+// 和noop.TracerProvider都只产生no-op span
+func providerInstalled(tp trace.TracerProvider) bool {
+	switch tp.(type) {
+	case *sdktrace.TracerProvider:
+		return true
+	case noop.TracerProvider, *noop.TracerProvider, nil:
+		return false
+	}
+	t := reflect.TypeOf(tp)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t.PkgPath() != "go.opentelemetry.io/otel/internal/global"
+}
+
+// Diagnostics 检查追踪配置：是否安装了真实的TracerProvider、导出端点能否连接、propagator、采样器、
+// 资源属性和导出统计；连接端点最多等待DiagnosticsProbeTimeout
+func Diagnostics() DiagnosticsReport {
+	tp := otel.GetTracerProvider()
+	setupMutex.Lock()
+	setup := currentSetup
+	setupMutex.Unlock()
+
+	report := DiagnosticsReport{
+		ProviderInstalled: providerInstalled(tp),
+		ProviderType:      fmt.Sprintf("%T", tp),
+		InitState:         setup.state,
+		Propagators:       otel.GetTextMapPropagator().Fields(),
+	}
+	if !report.ProviderInstalled {
+		if setup.state == InitStateDisabled {
+			report.Warnings = append(report.Warnings, "InitJaeger was called with Enabled=false, spans are no-op")
+		} else {
+			report.Warnings = append(report.Warnings, "no TracerProvider installed, spans are no-op: call trace.InitJaeger before starting spans")
+		}
+	}
+	if len(report.Propagators) == 0 {
+		report.Warnings = append(report.Warnings, "no propagator installed, trace context is not propagated across services")
+	}
+	if setup.state != InitStateEnabled {
+		return report
+	}
+
+	report.ServiceName = setup.serviceName
+	report.Endpoint = setup.endpoint.hostPort + setup.endpoint.path
+	report.Sampler = setup.sampler
+	if setup.resource != nil {
+		report.Resource = make(map[string]string)
+		for _, kv := range setup.resource.Attributes() {
+			report.Resource[string(kv.Key)] = kv.Value.Emit()
+		}
+	}
+	if conn, err := net.DialTimeout("tcp", setup.endpoint.hostPort, DiagnosticsProbeTimeout); err != nil {
+		report.EndpointError = err.Error()
+		report.Warnings = append(report.Warnings, fmt.Sprintf("exporter endpoint %s is unreachable: %v", setup.endpoint.hostPort, err))
+	} else {
+		conn.Close()
+		report.EndpointReachable = true
+	}
+
+	if stats := setup.exports; stats != nil {
+		report.ExportBatches = stats.batches.Load()
+		report.ExportedSpans = stats.spans.Load()
+		report.ExportErrors = stats.errors.Load()
+		stats.mutex.Lock()
+		report.LastExportAt = stats.lastExportAt
+		report.LastExportError = stats.lastErr
+		report.LastErrorAt = stats.lastErrAt
+		stats.mutex.Unlock()
+		if report.LastErrorAt.After(report.LastExportAt) {
+			report.Warnings = append(report.Warnings, "last export failed: "+report.LastExportError)
+		}
+	}
+	return report
+}
+
+// MustBeInitialized 全局TracerProvider是no-op provider时panic，用于在启动时确认已调用InitJaeger
+func MustBeInitialized() {
+	if tp := otel.GetTracerProvider(); !providerInstalled(tp) {
+		setupMutex.Lock()
+		state := currentSetup.state
+		setupMutex.Unlock()
+		panic(fmt.Sprintf("trace: no TracerProvider installed (init state %s, provider %T), call trace.InitJaeger with Enabled=true first", state, tp))
+	}
+}
+
+// DiagnosticsHandler 返回以JSON输出Diagnostics结果的HTTP处理器，用于调试端口
+// 有警告时状态码为503，便于探活检查
+func DiagnosticsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := Diagnostics()
+		w.Header().Set("Content-Type", "application/json")
+		if len(report.Warnings) > 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	})
+}
+
+// no-op provider警告的状态
+var (
+	noopWarningDisabled atomic.Bool
+	noopWarned          atomic.Bool
+)
+
+// SetNoopWarning 设置第一次在no-op provider上开始span时是否记录警告，默认开启
+func SetNoopWarning(enabled bool) {
+	noopWarningDisabled.Store(!enabled)
+}
+
+// warnIfNoop 第一次在no-op provider上开始span时记录一次警告
+func warnIfNoop(operationName string) {
+	if noopWarned.Load() || noopWarningDisabled.Load() || providerInstalled(otel.GetTracerProvider()) {
+		return
+	}
+	if !noopWarned.CompareAndSwap(false, true) {
+		return
+	}
+	setupMutex.Lock()
+	state := currentSetup.state
+	setupMutex.Unlock()
+	reason := "trace.InitJaeger has not been called"
+	if state == InitStateDisabled {
+		reason = "trace.InitJaeger was called with Enabled=false"
+	}
+	log.Printf("Warning: span %q started against the no-op TracerProvider (%s), spans will not be exported; see trace.Diagnostics", operationName, reason)
+}
@@ -0,0 +1,192 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/HsiaoL1/trace/tracetest"
+)
+
+// useNoopProvider 安装no-op provider并重置InitJaeger的记录，测试结束时恢复
+func useNoopProvider(t *testing.T) {
+	t.Helper()
+	prevProvider := otel.GetTracerProvider()
+	prevPropagator := otel.GetTextMapPropagator()
+	setupMutex.Lock()
+	prevSetup := currentSetup
+	setupMutex.Unlock()
+
+	otel.SetTracerProvider(noop.NewTracerProvider())
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	recordSetup(tracingSetup{state: InitStateNotInitialized})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+		recordSetup(prevSetup)
+	})
+}
+
+// captureLog 将标准库log的输出写入缓冲区，测试结束时恢复
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	flags := log.Flags()
+	log.SetOutput(&buf)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+	})
+	return &buf
+}
+
+func TestNoopWarningOnce(t *testing.T) {
+	useNoopProvider(t)
+	output := captureLog(t)
+	noopWarned.Store(false)
+	t.Cleanup(func() { noopWarned.Store(true) })
+
+	for _, name := range []string{"first", "second", "third"} {
+		_, span := StartSpan(context.Background(), name)
+		span.End()
+	}
+	_, span := StartInternalSpan(context.Background(), "internal")
+	span.End()
+	if count := strings.Count(output.String(), "no-op TracerProvider"); count != 1 || !strings.Contains(output.String(), `"first"`) {
+		t.Fatalf("期望只在第一个span时警告一次，得到 %d 次: %s", count, output.String())
+	}
+	if !strings.Contains(output.String(), "InitJaeger has not been called") {
+		t.Errorf("期望警告说明没有调用InitJaeger，得到 %s", output.String())
+	}
+
+	// 关闭警告后不再记录
+	output.Reset()
+	noopWarned.Store(false)
+	SetNoopWarning(false)
+	defer SetNoopWarning(true)
+	_, span = StartSpan(context.Background(), "disabled")
+	span.End()
+	if output.Len() != 0 {
+		t.Errorf("期望关闭后不记录警告，得到 %s", output.String())
+	}
+
+	// 安装了provider时不警告
+	SetNoopWarning(true)
+	tracetest.Start(t)
+	_, span = StartSpan(context.Background(), "recorded")
+	span.End()
+	if output.Len() != 0 || noopWarned.Load() {
+		t.Errorf("期望安装provider后不警告，得到 %s", output.String())
+	}
+}
+
+func TestDiagnosticsBeforeInit(t *testing.T) {
+	useNoopProvider(t)
+
+	report := Diagnostics()
+	if report.ProviderInstalled || report.InitState != InitStateNotInitialized || report.Endpoint != "" || len(report.Warnings) != 2 {
+		t.Errorf("期望报告没有安装provider和propagator，得到 %+v", report)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r == nil || !strings.Contains(r.(string), "InitJaeger") {
+				t.Errorf("期望MustBeInitialized在没有provider时panic，得到 %v", r)
+			}
+		}()
+		MustBeInitialized()
+	}()
+
+	// Enabled=false时警告说明原因
+	if _, err := InitJaeger(&JaegerConfig{ServiceName: "svc", Enabled: false}); err != nil {
+		t.Fatalf("InitJaeger失败: %v", err)
+	}
+	report = Diagnostics()
+	if report.InitState != InitStateDisabled || !strings.Contains(report.Warnings[0], "Enabled=false") {
+		t.Errorf("期望报告Enabled=false，得到 %+v", report)
+	}
+
+	// 其他测试工具安装的provider同样视为已安装
+	tracetest.Start(t)
+	MustBeInitialized()
+	if report := Diagnostics(); !report.ProviderInstalled || len(report.Warnings) != 0 {
+		t.Errorf("期望tracetest的provider视为已安装，得到 %+v", report)
+	}
+}
+
+func TestDiagnosticsAfterInit(t *testing.T) {
+	useNoopProvider(t)
+	var status, requests atomic.Int32
+	status.Store(http.StatusOK)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer collector.Close()
+
+	config := &JaegerConfig{Endpoint: collector.URL, ServiceName: "diag-svc", Environment: "development", Version: "1.2.3", Enabled: true}
+	shutdown, err := InitJaeger(config)
+	if err != nil {
+		t.Fatalf("InitJaeger失败: %v", err)
+	}
+	report := Diagnostics()
+	if !report.ProviderInstalled || report.InitState != InitStateEnabled || !report.EndpointReachable || len(report.Warnings) != 0 {
+		t.Fatalf("期望初始化后没有问题，得到 %+v", report)
+	}
+	if report.ServiceName != "diag-svc" || report.Resource["service.name"] != "diag-svc" || report.Resource["service.version"] != "1.2.3" {
+		t.Errorf("期望报告资源属性，得到 %+v", report.Resource)
+	}
+	if !strings.Contains(report.Sampler, "AlwaysOnSampler") || !strings.HasPrefix(report.Endpoint, strings.TrimPrefix(collector.URL, "http://")) {
+		t.Errorf("期望报告采样器和端点，得到 %q %q", report.Sampler, report.Endpoint)
+	}
+	if !slices.Contains(report.Propagators, "traceparent") || !slices.Contains(report.Propagators, "baggage") {
+		t.Errorf("期望报告propagator的请求头，得到 %v", report.Propagators)
+	}
+
+	_, span := StartSpan(context.Background(), "exported")
+	span.End()
+	if err := globalProvider.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+	report = Diagnostics()
+	if report.ExportedSpans != 1 || report.ExportBatches != 1 || report.ExportErrors != 0 || report.LastExportAt.IsZero() || requests.Load() != 1 {
+		t.Errorf("期望导出1个span，得到 %+v（请求 %d 次）", report, requests.Load())
+	}
+
+	// 导出失败记录最近的错误
+	status.Store(http.StatusBadRequest)
+	_, span = StartSpan(context.Background(), "rejected")
+	span.End()
+	globalProvider.ForceFlush(context.Background())
+	report = Diagnostics()
+	if report.ExportErrors != 1 || report.LastExportError == "" || len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0], "last export failed") {
+		t.Errorf("期望报告导出错误，得到 %+v", report)
+	}
+
+	// 处理器以JSON返回报告，有警告时返回503
+	w := httptest.NewRecorder()
+	DiagnosticsHandler().ServeHTTP(w, httptest.NewRequest("GET", "/debug/tracing", nil))
+	var decoded DiagnosticsReport
+	if err := json.Unmarshal(w.Body.Bytes(), &decoded); err != nil || w.Code != http.StatusServiceUnavailable || decoded.ExportErrors != 1 {
+		t.Errorf("期望503和报告，得到 %d %s", w.Code, w.Body.String())
+	}
+
+	// 端点无法连接
+	shutdown()
+	collector.Close()
+	report = Diagnostics()
+	if report.EndpointReachable || report.EndpointError == "" {
+		t.Errorf("期望报告端点无法连接，得到 %+v", report)
+	}
+}
@@ -1,22 +1,55 @@
 package trace
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/smtp"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"gopkg.in/gomail.v2"
 )
 
+// SMTP加密方式
+const (
+	EncryptionSTARTTLS = "starttls" // 先建立明文连接，再通过STARTTLS升级（通常为587或25端口）
+	EncryptionTLS      = "tls"      // 隐式TLS，连接建立后立即进行TLS握手（通常为465端口）
+	EncryptionNone     = "none"     // 不加密
+)
+
+// DefaultSMTPDialTimeout 默认的SMTP连接超时时间
+const DefaultSMTPDialTimeout = 10 * time.Second
+
 // SMTPConfig SMTP配置结构体
 type SMTPConfig struct {
-	Host     string
-	Port     int
-	User     string
-	Password string
-	TLSEnabled bool
+	Host               string
+	Port               int
+	User               string
+	Password           string
+	TLSEnabled         bool // Deprecated: 使用Encryption指定加密方式
 	InsecureSkipVerify bool
+	Encryption         string        // 加密方式：starttls、tls或none，为空时根据端口自动选择
+	DialTimeout        time.Duration // 建立连接（包括TLS握手和认证）的超时时间，为0时使用DefaultSMTPDialTimeout
+}
+
+// EffectiveEncryption 返回实际使用的加密方式
+// 未设置Encryption时，465端口使用隐式TLS，其他端口（如587、25）使用STARTTLS
+func (c SMTPConfig) EffectiveEncryption() string {
+	if c.Encryption != "" {
+		return strings.ToLower(c.Encryption)
+	}
+	if c.Port == 465 {
+		return EncryptionTLS
+	}
+	return EncryptionSTARTTLS
 }
 
 // EmailSender 邮件发送器接口
@@ -41,11 +74,11 @@ func NewEmailSender() EmailSender {
 // DefaultSMTPConfig 默认SMTP配置
 func DefaultSMTPConfig() SMTPConfig {
 	return SMTPConfig{
-		Host:     "smtp.qq.com",
-		Port:     587,
-		User:     "",
-		Password: "",
-		TLSEnabled: true,
+		Host:               "smtp.qq.com",
+		Port:               587,
+		User:               "",
+		Password:           "",
+		TLSEnabled:         true,
 		InsecureSkipVerify: false,
 	}
 }
@@ -63,31 +96,39 @@ func (e *DefaultEmailSender) GetSMTPConfig() SMTPConfig {
 // LoadSMTPConfigFromEnv 从环境变量加载SMTP配置
 func LoadSMTPConfigFromEnv() SMTPConfig {
 	config := DefaultSMTPConfig()
-	
+
 	if host := os.Getenv("SMTP_HOST"); host != "" {
 		config.Host = host
 	}
-	
+
 	if port := getEnvIntOrDefault("SMTP_PORT", 587); port > 0 {
 		config.Port = port
 	}
-	
+
 	if user := os.Getenv("SMTP_USER"); user != "" {
 		config.User = user
 	}
-	
+
 	if password := os.Getenv("SMTP_PASSWORD"); password != "" {
 		config.Password = password
 	}
-	
+
 	if tlsEnabled := getEnvBoolOrDefault("SMTP_TLS_ENABLED", true); tlsEnabled {
 		config.TLSEnabled = tlsEnabled
 	}
-	
+
 	if insecureSkipVerify := getEnvBoolOrDefault("SMTP_INSECURE_SKIP_VERIFY", false); insecureSkipVerify {
 		config.InsecureSkipVerify = insecureSkipVerify
 	}
-	
+
+	if encryption := os.Getenv("SMTP_ENCRYPTION"); encryption != "" {
+		config.Encryption = encryption
+	}
+
+	if timeout, err := time.ParseDuration(os.Getenv("SMTP_DIAL_TIMEOUT")); err == nil && timeout > 0 {
+		config.DialTimeout = timeout
+	}
+
 	return config
 }
 
@@ -111,7 +152,6 @@ func getEnvBoolOrDefault(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
-
 // SendEmail 发送邮件的方法
 func (e *DefaultEmailSender) SendEmail(to, subject, body string) error {
 	// 验证输入参数
@@ -131,23 +171,176 @@ func (e *DefaultEmailSender) SendEmail(to, subject, body string) error {
 	m.SetHeader("Subject", subject)
 	m.SetBody("text/html", body)
 
-	// 创建邮件客户端
-	d := gomail.NewDialer(e.config.Host, e.config.Port, e.config.User, e.config.Password)
-
-	// 设置TLS配置
-	if e.config.TLSEnabled {
-		d.TLSConfig = &tls.Config{
-			ServerName:         e.config.Host,
-			InsecureSkipVerify: e.config.InsecureSkipVerify,
-		}
+	// 连接并认证
+	c, err := e.dial(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
 	}
+	defer c.Close()
 
 	// 发送邮件
-	if err := d.DialAndSend(m); err != nil {
+	sender := gomail.SendFunc(func(from string, to []string, msg io.WriterTo) error {
+		if err := c.Mail(from); err != nil {
+			return err
+		}
+		for _, addr := range to {
+			if err := c.Rcpt(addr); err != nil {
+				return err
+			}
+		}
+		w, err := c.Data()
+		if err != nil {
+			return err
+		}
+		if _, err := msg.WriteTo(w); err != nil {
+			w.Close()
+			return err
+		}
+		return w.Close()
+	})
+	if err := gomail.Send(sender, m); err != nil {
 		return fmt.Errorf("failed to send email: %w", err)
 	}
 
-	return nil
+	return c.Quit()
+}
+
+// VerifyConnection 连接SMTP服务器并完成认证，但不发送邮件
+func (e *DefaultEmailSender) VerifyConnection(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := e.validateSMTPConfig(); err != nil {
+		return fmt.Errorf("invalid SMTP config: %w", err)
+	}
+
+	c, err := e.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.Quit()
+}
+
+// dial 按加密方式连接SMTP服务器并完成认证
+// 连接、TLS握手和认证都受DialTimeout和ctx限制，避免加密方式与端口不匹配时一直等待
+func (e *DefaultEmailSender) dial(ctx context.Context) (*smtp.Client, error) {
+	timeout := e.config.DialTimeout
+	if timeout <= 0 {
+		timeout = DefaultSMTPDialTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+
+	addr := net.JoinHostPort(e.config.Host, strconv.Itoa(e.config.Port))
+	dialer := &net.Dialer{Deadline: deadline}
+	rawConn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SMTP server %s: %w", addr, err)
+	}
+	rawConn.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() {
+		rawConn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	c, err := e.handshake(rawConn)
+	if err != nil {
+		rawConn.Close()
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+
+	rawConn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+// handshake 在已建立的连接上完成TLS协商和认证
+func (e *DefaultEmailSender) handshake(conn net.Conn) (*smtp.Client, error) {
+	encryption := e.config.EffectiveEncryption()
+	tlsConfig := &tls.Config{
+		ServerName:         e.config.Host,
+		InsecureSkipVerify: e.config.InsecureSkipVerify,
+	}
+
+	if encryption == EncryptionTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	c, err := smtp.NewClient(conn, e.config.Host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SMTP greeting (encryption %q): %w", encryption, err)
+	}
+
+	if encryption == EncryptionSTARTTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return nil, errors.New("SMTP server does not support STARTTLS")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return nil, fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+
+	if auth := e.auth(c); auth != nil {
+		if err := c.Auth(auth); err != nil {
+			return nil, fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// auth 根据服务器支持的认证方式选择认证机制
+func (e *DefaultEmailSender) auth(c *smtp.Client) smtp.Auth {
+	if e.config.User == "" {
+		return nil
+	}
+	ok, auths := c.Extension("AUTH")
+	if !ok {
+		return nil
+	}
+	switch {
+	case strings.Contains(auths, "CRAM-MD5"):
+		return smtp.CRAMMD5Auth(e.config.User, e.config.Password)
+	case strings.Contains(auths, "LOGIN") && !strings.Contains(auths, "PLAIN"):
+		return &loginAuth{username: e.config.User, password: e.config.Password, host: e.config.Host}
+	default:
+		return smtp.PlainAuth("", e.config.User, e.config.Password, e.config.Host)
+	}
+}
+
+// loginAuth LOGIN认证机制，与smtp.PlainAuth一样只在TLS连接或本机服务器上发送密码
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch {
+	case bytes.EqualFold(fromServer, []byte("Username:")):
+		return []byte(a.username), nil
+	case bytes.EqualFold(fromServer, []byte("Password:")):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected server challenge: %s", fromServer)
+	}
 }
 
 // validateEmailParams 验证邮件参数
@@ -178,6 +371,11 @@ func (e *DefaultEmailSender) validateSMTPConfig() error {
 	if e.config.Password == "" {
 		return fmt.Errorf("SMTP password cannot be empty, please set SMTP_PASSWORD environment variable")
 	}
+	switch e.config.EffectiveEncryption() {
+	case EncryptionSTARTTLS, EncryptionTLS, EncryptionNone:
+	default:
+		return fmt.Errorf("unknown SMTP encryption %q, expected starttls, tls or none", e.config.Encryption)
+	}
 	return nil
 }
 
@@ -187,8 +385,69 @@ func SendEmailWithConfig(config SMTPConfig, to, subject, body string) error {
 	return sender.SendEmail(to, subject, body)
 }
 
-// SendEmail 使用默认配置发送邮件（全局函数，向后兼容）
-func SendEmail(to, subject, body string) error {
+// isLocalhost 检查主机名是否为本机
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+// VerifySMTPConnection 使用指定配置连接SMTP服务器并完成认证，不发送邮件
+func VerifySMTPConnection(ctx context.Context, config SMTPConfig) error {
+	sender := &DefaultEmailSender{config: config}
+	return sender.VerifyConnection(ctx)
+}
+
+// 全局默认收件人和SMTP配置
+var (
+	defaultEmail      string
+	defaultSMTPConfig *SMTPConfig
+	defaultEmailMutex sync.RWMutex
+)
+
+// SetEmail 设置默认的通知收件人，SendEmail的收件人为空时使用
+func SetEmail(addr string) {
+	defaultEmailMutex.Lock()
+	defer defaultEmailMutex.Unlock()
+	defaultEmail = addr
+}
+
+// GetEmail 获取默认的通知收件人
+func GetEmail() string {
+	defaultEmailMutex.RLock()
+	defer defaultEmailMutex.RUnlock()
+	return defaultEmail
+}
+
+// SetSMTPConfig 设置全局SMTP服务器和账号，供SendEmail使用
+// 加密方式、超时等其他选项仍从环境变量读取
+func SetSMTPConfig(host string, port int, user, password string) {
 	config := LoadSMTPConfigFromEnv()
-	return SendEmailWithConfig(config, to, subject, body)
+	config.Host = host
+	config.Port = port
+	config.User = user
+	config.Password = password
+
+	defaultEmailMutex.Lock()
+	defer defaultEmailMutex.Unlock()
+	defaultSMTPConfig = &config
+}
+
+// GetSMTPConfig 获取SendEmail使用的SMTP配置：已调用SetSMTPConfig时返回其配置，否则从环境变量加载
+func GetSMTPConfig() SMTPConfig {
+	defaultEmailMutex.RLock()
+	config := defaultSMTPConfig
+	defaultEmailMutex.RUnlock()
+
+	if config != nil {
+		return *config
+	}
+	return LoadSMTPConfigFromEnv()
+}
+
+// SendEmail 使用全局配置发送邮件（全局函数，向后兼容）
+// to为空时发送给SetEmail设置的默认收件人
+func SendEmail(to, subject, body string) error {
+	if to == "" {
+		to = GetEmail()
+	}
+	return SendEmailWithConfig(GetSMTPConfig(), to, subject, body)
 }
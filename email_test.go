@@ -0,0 +1,346 @@
+package trace
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSMTPServer 支持隐式TLS和STARTTLS的最小SMTP服务器
+type testSMTPServer struct {
+	ln          net.Listener
+	tlsConfig   *tls.Config
+	implicitTLS bool
+
+	mu         sync.Mutex
+	messages   []string
+	recipients []string
+	sawTLS     bool
+}
+
+func newTestSMTPServer(t *testing.T, implicitTLS bool) *testSMTPServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := &testSMTPServer{
+		ln:          ln,
+		tlsConfig:   &tls.Config{Certificates: []tls.Certificate{testCertificate(t)}},
+		implicitTLS: implicitTLS,
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *testSMTPServer) config() SMTPConfig {
+	return SMTPConfig{
+		Host:               "127.0.0.1",
+		Port:               s.ln.Addr().(*net.TCPAddr).Port,
+		User:               "sender@example.com",
+		Password:           "secret",
+		InsecureSkipVerify: true,
+		DialTimeout:        2 * time.Second,
+	}
+}
+
+func (s *testSMTPServer) serve(conn net.Conn) {
+	defer func() { conn.Close() }() // conn在STARTTLS后会被替换
+
+	isTLS := false
+	if s.implicitTLS {
+		conn = tls.Server(conn, s.tlsConfig)
+		isTLS = true
+	}
+	tp := textproto.NewConn(conn)
+	reply := func(format string, args ...any) { tp.PrintfLine(format, args...) }
+
+	reply("220 test ESMTP")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(cmd) {
+		case "EHLO", "HELO":
+			reply("250-test")
+			if !isTLS {
+				reply("250-STARTTLS")
+			}
+			reply("250 AUTH PLAIN")
+		case "STARTTLS":
+			reply("220 ready")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+			isTLS = true
+		case "AUTH":
+			_, encoded, _ := strings.Cut(arg, " ")
+			decoded, _ := base64.StdEncoding.DecodeString(encoded)
+			if string(decoded) != "\x00sender@example.com\x00secret" {
+				reply("535 authentication failed")
+				continue
+			}
+			s.mu.Lock()
+			s.sawTLS = isTLS
+			s.mu.Unlock()
+			reply("235 ok")
+		case "MAIL":
+			reply("250 ok")
+		case "RCPT":
+			s.mu.Lock()
+			s.recipients = append(s.recipients, strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>"))
+			s.mu.Unlock()
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			data, err := tp.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, string(data))
+			s.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 unknown command")
+		}
+	}
+}
+
+func (s *testSMTPServer) result() ([]string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.messages...), s.sawTLS
+}
+
+func testCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestEffectiveEncryption(t *testing.T) {
+	tests := []struct {
+		config SMTPConfig
+		want   string
+	}{
+		{SMTPConfig{Port: 465}, EncryptionTLS},
+		{SMTPConfig{Port: 587}, EncryptionSTARTTLS},
+		{SMTPConfig{Port: 25}, EncryptionSTARTTLS},
+		{SMTPConfig{Port: 465, Encryption: "STARTTLS"}, EncryptionSTARTTLS},
+		{SMTPConfig{Port: 587, Encryption: "none"}, EncryptionNone},
+	}
+
+	for _, tt := range tests {
+		if got := tt.config.EffectiveEncryption(); got != tt.want {
+			t.Errorf("EffectiveEncryption(%+v) = %q, want %q", tt.config, got, tt.want)
+		}
+	}
+}
+
+func TestLoadSMTPConfigFromEnvEncryption(t *testing.T) {
+	t.Setenv("SMTP_PORT", "465")
+	t.Setenv("SMTP_ENCRYPTION", "tls")
+	t.Setenv("SMTP_DIAL_TIMEOUT", "3s")
+
+	config := LoadSMTPConfigFromEnv()
+	if config.Encryption != "tls" {
+		t.Errorf("expected encryption tls, got %q", config.Encryption)
+	}
+	if config.DialTimeout != 3*time.Second {
+		t.Errorf("expected dial timeout 3s, got %v", config.DialTimeout)
+	}
+}
+
+func TestSMTPImplicitTLS(t *testing.T) {
+	server := newTestSMTPServer(t, true)
+	config := server.config()
+	config.Encryption = EncryptionTLS
+
+	if err := VerifySMTPConnection(context.Background(), config); err != nil {
+		t.Fatalf("VerifySMTPConnection failed: %v", err)
+	}
+	if err := SendEmailWithConfig(config, "ops@example.com", "alert", "<p>disk full</p>"); err != nil {
+		t.Fatalf("SendEmailWithConfig failed: %v", err)
+	}
+
+	messages, sawTLS := server.result()
+	if !sawTLS {
+		t.Error("expected authentication over TLS")
+	}
+	if len(messages) != 1 || !strings.Contains(messages[0], "Subject: alert") {
+		t.Errorf("expected one message with subject, got %q", messages)
+	}
+}
+
+func TestSMTPStartTLS(t *testing.T) {
+	server := newTestSMTPServer(t, false)
+	config := server.config() // 非465端口自动使用STARTTLS
+
+	if err := VerifySMTPConnection(context.Background(), config); err != nil {
+		t.Fatalf("VerifySMTPConnection failed: %v", err)
+	}
+	if err := SendEmailWithConfig(config, "ops@example.com", "alert", "<p>disk full</p>"); err != nil {
+		t.Fatalf("SendEmailWithConfig failed: %v", err)
+	}
+
+	messages, sawTLS := server.result()
+	if !sawTLS {
+		t.Error("expected authentication after STARTTLS")
+	}
+	if len(messages) != 1 {
+		t.Errorf("expected one message, got %d", len(messages))
+	}
+}
+
+func TestSMTPVerifyConnectionErrors(t *testing.T) {
+	t.Run("wrong password", func(t *testing.T) {
+		config := newTestSMTPServer(t, false).config()
+		config.Password = "wrong"
+		if err := VerifySMTPConnection(context.Background(), config); err == nil || !strings.Contains(err.Error(), "authentication failed") {
+			t.Errorf("expected authentication error, got %v", err)
+		}
+	})
+
+	t.Run("implicit TLS server with STARTTLS client times out", func(t *testing.T) {
+		config := newTestSMTPServer(t, true).config()
+		config.Encryption = EncryptionSTARTTLS
+		config.DialTimeout = 200 * time.Millisecond
+
+		start := time.Now()
+		err := VerifySMTPConnection(context.Background(), config)
+		if err == nil {
+			t.Fatal("expected timeout error")
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("expected dial timeout to bound the handshake, took %v", elapsed)
+		}
+	})
+
+	t.Run("context cancellation", func(t *testing.T) {
+		config := newTestSMTPServer(t, true).config()
+		config.Encryption = EncryptionSTARTTLS
+		config.DialTimeout = time.Minute
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		if err := VerifySMTPConnection(ctx, config); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected context.DeadlineExceeded, got %v", err)
+		}
+	})
+
+	t.Run("unknown encryption", func(t *testing.T) {
+		config := newTestSMTPServer(t, false).config()
+		config.Encryption = "ssl3"
+		if err := VerifySMTPConnection(context.Background(), config); err == nil {
+			t.Error("expected error for unknown encryption")
+		}
+	})
+}
+
+func TestSMTPWithoutEncryption(t *testing.T) {
+	server := newTestSMTPServer(t, false)
+	config := server.config()
+	config.Encryption = EncryptionNone
+
+	if err := VerifySMTPConnection(context.Background(), config); err != nil {
+		t.Fatalf("VerifySMTPConnection failed: %v", err)
+	}
+	if _, sawTLS := server.result(); sawTLS {
+		t.Error("expected plaintext session when encryption is none")
+	}
+}
+
+func TestSendEmailDefaultRecipient(t *testing.T) {
+	t.Cleanup(func() {
+		SetEmail("")
+		defaultEmailMutex.Lock()
+		defaultSMTPConfig = nil
+		defaultEmailMutex.Unlock()
+	})
+
+	server := newTestSMTPServer(t, false)
+	config := server.config()
+	t.Setenv("SMTP_INSECURE_SKIP_VERIFY", "true")
+	SetSMTPConfig(config.Host, config.Port, config.User, config.Password)
+
+	if got := GetSMTPConfig(); got.Host != config.Host || got.Port != config.Port || !got.InsecureSkipVerify {
+		t.Fatalf("unexpected SMTP config: %+v", got)
+	}
+
+	SetEmail("default@example.com")
+	if GetEmail() != "default@example.com" {
+		t.Fatalf("expected default recipient, got %q", GetEmail())
+	}
+
+	// 显式收件人优先于默认收件人
+	if err := SendEmail("explicit@example.com", "alert", "<p>explicit</p>"); err != nil {
+		t.Fatalf("SendEmail failed: %v", err)
+	}
+	if err := SendEmail("", "alert", "<p>default</p>"); err != nil {
+		t.Fatalf("SendEmail failed: %v", err)
+	}
+
+	server.mu.Lock()
+	recipients := append([]string(nil), server.recipients...)
+	server.mu.Unlock()
+	want := []string{"explicit@example.com", "default@example.com"}
+	if strings.Join(recipients, ",") != strings.Join(want, ",") {
+		t.Errorf("expected recipients %v, got %v", want, recipients)
+	}
+
+	SetEmail("")
+	if err := SendEmail("", "alert", "<p>nobody</p>"); err == nil {
+		t.Error("expected error without any recipient")
+	}
+}
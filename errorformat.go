@@ -0,0 +1,197 @@
+package trace
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.20.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultErrorMessageLimit 默认错误格式化函数保留的错误消息最大字节数
+const DefaultErrorMessageLimit = 1024
+
+// RedactedPlaceholder 错误消息中匹配敏感信息模式的部分替换成的内容
+const RedactedPlaceholder = "[REDACTED]"
+
+// 错误链的最大深度，超过时不再记录类型
+const maxErrorChainTypes = 16
+
+// 记录到span的错误属性
+const (
+	// ErrorTypesKey 错误链中每个错误的类型，从最外层开始
+	ErrorTypesKey = attribute.Key("error.types")
+	// ExceptionCountKey span上RecordError的调用次数，重复的错误只记录一个事件
+	ExceptionCountKey = attribute.Key("exception.count")
+)
+
+// ErrorFormatter 将错误转换为span状态描述和exception事件的消息，以及添加到事件上的属性
+type ErrorFormatter func(err error) (message string, attrs []attribute.KeyValue)
+
+// errorFormatter SetErrorFormatter设置的格式化函数，为nil时使用DefaultErrorFormatter
+var errorFormatter atomic.Pointer[ErrorFormatter]
+
+// errorSecretPatterns SetErrorSecretPatterns设置的敏感信息模式
+var errorSecretPatterns atomic.Pointer[[]*regexp.Regexp]
+
+// SetErrorFormatter 设置RecordError和FinishHTTPClientSpan使用的错误格式化函数，传入nil时恢复DefaultErrorFormatter
+// 包装了整个响应body的错误会产生很大的span，超过收集器的限制，可以在这里截断或脱敏
+func SetErrorFormatter(formatter ErrorFormatter) {
+	if formatter == nil {
+		errorFormatter.Store(nil)
+		return
+	}
+	errorFormatter.Store(&formatter)
+}
+
+// SetErrorSecretPatterns 设置DefaultErrorFormatter脱敏的模式，错误消息中匹配的部分替换为RedactedPlaceholder
+// 如regexp.MustCompile(`(?i)(token|password)=\S+`)；不传参数时清除
+func SetErrorSecretPatterns(patterns ...*regexp.Regexp) {
+	patterns = append([]*regexp.Regexp(nil), patterns...)
+	errorSecretPatterns.Store(&patterns)
+}
+
+// DefaultErrorFormatter 默认的错误格式化函数：对消息脱敏后截断到DefaultErrorMessageLimit字节（以TruncatedSuffix结尾），
+// 并在error.types属性中记录errors.Unwrap链上每个错误的类型
+func DefaultErrorFormatter(err error) (string, []attribute.KeyValue) {
+	message := err.Error()
+	if patterns := errorSecretPatterns.Load(); patterns != nil {
+		for _, pattern := range *patterns {
+			message = pattern.ReplaceAllString(message, RedactedPlaceholder)
+		}
+	}
+	return truncateErrorMessage(message, DefaultErrorMessageLimit), []attribute.KeyValue{ErrorTypesKey.StringSlice(errorChainTypes(err))}
+}
+
+// truncateErrorMessage 将超过limit字节的消息按UTF-8字符截断，截断后包括TruncatedSuffix不超过limit字节
+func truncateErrorMessage(message string, limit int) string {
+	if len(message) <= limit {
+		return message
+	}
+	keep := max(limit-len(TruncatedSuffix), 0)
+	for keep > 0 && !utf8.RuneStart(message[keep]) {
+		keep--
+	}
+	return message[:keep] + TruncatedSuffix
+}
+
+// errorChainTypes 返回errors.Unwrap链上每个错误的类型
+func errorChainTypes(err error) []string {
+	var types []string
+	for ; err != nil && len(types) < maxErrorChainTypes; err = errors.Unwrap(err) {
+		types = append(types, fmt.Sprintf("%T", err))
+	}
+	return types
+}
+
+// formatError 使用当前的格式化函数格式化错误
+func formatError(err error) (string, []attribute.KeyValue) {
+	if formatter := errorFormatter.Load(); formatter != nil {
+		return (*formatter)(err)
+	}
+	return DefaultErrorFormatter(err)
+}
+
+// recordSpanError 将格式化后的错误记录为span的exception事件并设置错误状态
+// 同一个span上格式化结果相同的错误只记录一个事件，exception.count属性为RecordError的调用次数
+func recordSpanError(span trace.Span, err error) {
+	message, attrs := formatError(err)
+	span.SetStatus(codes.Error, message)
+
+	count, first := spanErrors.record(span, message, attrs)
+	if count > 0 {
+		span.SetAttributes(ExceptionCountKey.Int(count))
+	}
+	if !first {
+		return
+	}
+	eventAttrs := make([]attribute.KeyValue, 0, len(attrs)+2)
+	eventAttrs = append(eventAttrs, semconv.ExceptionType(fmt.Sprintf("%T", err)), semconv.ExceptionMessage(message))
+	eventAttrs = append(eventAttrs, attrs...)
+	span.AddEvent(semconv.ExceptionEventName, trace.WithAttributes(eventAttrs...))
+}
+
+// maxTrackedErrorSpans 记录错误去重状态的span数上限，超过时清除已结束的span
+const maxTrackedErrorSpans = 4096
+
+// spanErrorKey 记录错误去重状态的span，按TraceID和SpanID区分
+type spanErrorKey struct {
+	traceID trace.TraceID
+	spanID  trace.SpanID
+}
+
+// spanErrorState 一个span上已记录的错误
+type spanErrorState struct {
+	span   trace.Span
+	count  int
+	errors map[string]struct{} // 格式化后的消息和属性
+}
+
+// spanErrorTracker 每个正在记录的span上已记录的错误
+type spanErrorTracker struct {
+	mutex sync.Mutex
+	spans map[spanErrorKey]*spanErrorState
+}
+
+var spanErrors = &spanErrorTracker{spans: make(map[spanErrorKey]*spanErrorState)}
+
+// record 记录span上的一次错误，返回span上RecordError的调用次数和该错误是否第一次出现
+// span不在记录或没有有效的SpanContext时不去重，返回0和true
+func (t *spanErrorTracker) record(span trace.Span, message string, attrs []attribute.KeyValue) (int, bool) {
+	sc := span.SpanContext()
+	if !span.IsRecording() || !sc.IsValid() {
+		return 0, true
+	}
+	key := spanErrorKey{traceID: sc.TraceID(), spanID: sc.SpanID()}
+	fingerprint := errorFingerprint(message, attrs)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	// 已结束的span的状态属于之前使用相同ID的span（如测试中固定的ID生成器）
+	state, ok := t.spans[key]
+	if !ok || !state.span.IsRecording() {
+		if len(t.spans) >= maxTrackedErrorSpans {
+			t.evictEnded()
+		}
+		state = &spanErrorState{span: span, errors: make(map[string]struct{})}
+		t.spans[key] = state
+	}
+	state.count++
+	if _, seen := state.errors[fingerprint]; seen {
+		return state.count, false
+	}
+	state.errors[fingerprint] = struct{}{}
+	return state.count, true
+}
+
+// evictEnded 清除已结束的span，仍然超过上限时清除所有span，调用方需持有mutex
+func (t *spanErrorTracker) evictEnded() {
+	for key, state := range t.spans {
+		if !state.span.IsRecording() {
+			delete(t.spans, key)
+		}
+	}
+	if len(t.spans) >= maxTrackedErrorSpans {
+		clear(t.spans)
+	}
+}
+
+// errorFingerprint 判断两个错误是否相同的依据：格式化后的消息和属性
+func errorFingerprint(message string, attrs []attribute.KeyValue) string {
+	var sb strings.Builder
+	sb.WriteString(message)
+	for _, attr := range attrs {
+		sb.WriteByte(0)
+		sb.WriteString(string(attr.Key))
+		sb.WriteByte('=')
+		sb.WriteString(attr.Value.Emit())
+	}
+	return sb.String()
+}
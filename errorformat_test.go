@@ -0,0 +1,115 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/HsiaoL1/trace/tracetest"
+)
+
+type responseError struct{ body string }
+
+func (e *responseError) Error() string { return "unexpected response: " + e.body }
+
+// eventAttr 返回事件中key的值
+func eventAttr(event sdktrace.Event, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range event.Attributes {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestRecordErrorTruncatesAndRedacts(t *testing.T) {
+	recorder := tracetest.Start(t)
+	SetErrorSecretPatterns(regexp.MustCompile(`token=\S+`))
+	t.Cleanup(func() { SetErrorSecretPatterns() })
+
+	body := "token=abc123 " + strings.Repeat("日志", 50000)
+	err := fmt.Errorf("call inventory: %w", fmt.Errorf("decode: %w", &responseError{body: body}))
+	_, span := StartSpan(context.Background(), "large-error")
+	RecordError(span, err)
+	span.End()
+
+	got := recorder.RequireSpan(t, "large-error")
+	description := got.Status().Description
+	if got.Status().Code != codes.Error || len(description) > DefaultErrorMessageLimit || !strings.HasSuffix(description, TruncatedSuffix) {
+		t.Errorf("期望状态描述截断到 %d 字节，得到 %d 字节", DefaultErrorMessageLimit, len(description))
+	}
+	if strings.Contains(description, "abc123") || !strings.Contains(description, RedactedPlaceholder) {
+		t.Errorf("期望脱敏token，得到 %.80q", description)
+	}
+	if len(got.Events()) != 1 {
+		t.Fatalf("期望1个exception事件，得到 %d", len(got.Events()))
+	}
+	if message, _ := eventAttr(got.Events()[0], "exception.message"); message.AsString() != description {
+		t.Errorf("期望事件消息与状态描述相同，得到 %d 字节", len(message.AsString()))
+	}
+
+	types, _ := eventAttr(got.Events()[0], ErrorTypesKey)
+	want := []string{"*fmt.wrapError", "*fmt.wrapError", "*trace.responseError"}
+	if !slices.Equal(types.AsStringSlice(), want) {
+		t.Errorf("期望错误链类型 %v，得到 %v", want, types.AsStringSlice())
+	}
+}
+
+func TestRecordErrorDedup(t *testing.T) {
+	recorder := tracetest.Start(t)
+	_, span := StartSpan(context.Background(), "retries")
+	err := errors.New("connection refused")
+	RecordError(span, err)
+	RecordError(span, err)
+	RecordError(span, errors.New("connection refused")) // 消息和类型相同视为同一个错误
+	RecordError(span, errors.New("timeout"))
+	span.End()
+
+	got := recorder.RequireSpan(t, "retries")
+	if len(got.Events()) != 2 {
+		t.Errorf("期望重复的错误只记录一个事件，得到 %d 个", len(got.Events()))
+	}
+	for _, kv := range got.Attributes() {
+		if kv.Key == ExceptionCountKey && kv.Value.AsInt64() != 4 {
+			t.Errorf("期望exception.count为4，得到 %d", kv.Value.AsInt64())
+		}
+	}
+	if !slices.ContainsFunc(got.Attributes(), func(kv attribute.KeyValue) bool { return kv.Key == ExceptionCountKey }) {
+		t.Error("期望span带有exception.count属性")
+	}
+
+	// 不同的span分别记录
+	_, other := StartSpan(context.Background(), "other")
+	RecordError(other, err)
+	other.End()
+	if len(recorder.RequireSpan(t, "other").Events()) != 1 {
+		t.Error("期望其他span上的相同错误仍然记录事件")
+	}
+}
+
+func TestSetErrorFormatter(t *testing.T) {
+	recorder := tracetest.Start(t)
+	SetErrorFormatter(func(err error) (string, []attribute.KeyValue) {
+		return "formatted", []attribute.KeyValue{attribute.String("error.kind", "upstream")}
+	})
+	t.Cleanup(func() { SetErrorFormatter(nil) })
+
+	_, span := StartHTTPClientSpan(context.Background(), "GET", "http://inventory/items")
+	FinishHTTPClientSpan(span, nil, errors.New("dial tcp: connection refused"))
+
+	got := recorder.RequireSpan(t, "GET inventory")
+	if got.Status().Description != "formatted" || len(got.Events()) != 1 {
+		t.Fatalf("期望使用设置的格式化函数，得到 %q，%d 个事件", got.Status().Description, len(got.Events()))
+	}
+	if kind, ok := eventAttr(got.Events()[0], "error.kind"); !ok || kind.AsString() != "upstream" {
+		t.Errorf("期望事件带有格式化函数返回的属性，得到 %v", got.Events()[0].Attributes)
+	}
+}
@@ -0,0 +1,194 @@
+// fullstack 演示追踪、日志聚合和Web API的完整流程：
+// 追踪的HTTP请求通过logz.WithContext记录日志，日志写入聚合器，再通过日志管理Web服务器的API按TraceID查回
+//
+// 在模块目录中运行：
+//
+//	go run ./example/fullstack
+//
+// Web服务器（logz/web）是独立的程序，示例用"go run"在随机端口上启动它，也可以用-web指定编译好的可执行文件
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/HsiaoL1/trace"
+	"github.com/HsiaoL1/trace/logz"
+	"github.com/HsiaoL1/trace/logz/aggregate"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	sdktracetest "go.opentelemetry.io/otel/sdk/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+func main() {
+	webBin := flag.String("web", "", "日志管理Web服务器的可执行文件，为空时使用go run github.com/HsiaoL1/trace/logz/web")
+	flag.Parse()
+
+	logDir, err := os.MkdirTemp("", "trace-fullstack-")
+	if err != nil {
+		log.Fatalf("创建日志目录失败: %v", err)
+	}
+	defer os.RemoveAll(logDir)
+
+	// 不连接Jaeger，span导出到内存中
+	exporter := sdktracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	defer provider.Shutdown(context.Background())
+
+	if err := aggregate.InitWithAggregation("", logDir, "fullstack", 0, 0); err != nil {
+		log.Fatalf("初始化聚合日志失败: %v", err)
+	}
+
+	// 1. 追踪的HTTP服务，/order处理时调用自己的/inventory
+	traceID, err := placeOrder()
+	if err != nil {
+		log.Fatalf("请求失败: %v", err)
+	}
+	fmt.Printf("请求完成，TraceID: %s\n", traceID)
+	for _, span := range exporter.GetSpans() {
+		fmt.Printf("  span %-22s kind=%-8s span_id=%s\n", span.Name, span.SpanKind, span.SpanContext.SpanID())
+	}
+
+	// 关闭聚合器，日志全部落盘，Web服务器才能打开同一目录的索引
+	if err := aggregate.CloseAggregator(); err != nil {
+		log.Fatalf("关闭聚合器失败: %v", err)
+	}
+
+	// 2. 在随机端口上启动Web服务器
+	port, err := freePort()
+	if err != nil {
+		log.Fatalf("分配端口失败: %v", err)
+	}
+	stop, err := startWebServer(*webBin, logDir, port)
+	if err != nil {
+		log.Fatalf("启动Web服务器失败: %v", err)
+	}
+	defer stop()
+
+	// 3. 通过Web API按TraceID查询日志
+	entries, err := queryTrace("http://127.0.0.1:"+port, traceID)
+	if err != nil {
+		log.Fatalf("查询日志失败: %v", err)
+	}
+	fmt.Printf("\nWeb API返回 %d 条关联日志:\n", len(entries))
+	for _, entry := range entries {
+		fmt.Printf("  %s [%s] %s trace_id=%s span_id=%s\n", entry.Timestamp, entry.Level, entry.Message, entry.TraceID, entry.SpanID)
+	}
+}
+
+// placeOrder 启动追踪的HTTP服务并调用/order，返回请求的TraceID
+func placeOrder() (string, error) {
+	client := trace.NewTracedHTTPClient(5 * time.Second)
+	mux := http.NewServeMux()
+	app := httptest.NewServer(trace.OpenTelemetryMiddleware(mux))
+	defer app.Close()
+
+	mux.HandleFunc("/inventory", func(w http.ResponseWriter, r *http.Request) {
+		logz.WithContext(r.Context()).Info("库存充足")
+		fmt.Fprint(w, "ok")
+	})
+	mux.HandleFunc("/order", func(w http.ResponseWriter, r *http.Request) {
+		logz.WithContext(r.Context()).Info("收到订单")
+		resp, err := client.Get(r.Context(), app.URL+"/inventory")
+		if err != nil {
+			logz.WithContext(r.Context()).WithError(err).Error("查询库存失败")
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		logz.WithContext(r.Context()).Info("订单完成")
+		fmt.Fprint(w, "ok")
+	})
+
+	ctx, span := trace.StartSpan(context.Background(), "place-order")
+	defer span.End()
+	resp, err := client.Get(ctx, app.URL+"/order")
+	if err != nil {
+		return "", err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return oteltrace.SpanContextFromContext(ctx).TraceID().String(), nil
+}
+
+// freePort 返回一个当前空闲的本地端口
+func freePort() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer listener.Close()
+	_, port, err := net.SplitHostPort(listener.Addr().String())
+	return port, err
+}
+
+// startWebServer 启动日志管理Web服务器并等待健康检查通过，返回停止函数
+func startWebServer(bin, logDir, port string) (func(), error) {
+	cmd := exec.Command("go", "run", "github.com/HsiaoL1/trace/logz/web")
+	if bin != "" {
+		cmd = exec.Command(bin)
+	}
+	cmd.Env = append(os.Environ(), "LOG_DIR="+logDir, "PORT="+port)
+	cmd.Stdout, cmd.Stderr = io.Discard, os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	stop := func() {
+		cmd.Process.Signal(os.Interrupt)
+		cmd.Wait()
+	}
+
+	// go run需要先编译，最多等待两分钟
+	deadline := time.Now().Add(2 * time.Minute)
+	for time.Now().Before(deadline) {
+		resp, err := http.Get("http://127.0.0.1:" + port + "/api/v1/health")
+		if err == nil {
+			resp.Body.Close()
+			return stop, nil
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	stop()
+	return nil, fmt.Errorf("web server did not become ready on port %s", port)
+}
+
+// queryTrace 调用/api/v1/logs/trace/{id}，返回与TraceID关联的日志
+func queryTrace(baseURL, traceID string) ([]aggregate.LogEntry, error) {
+	resp, err := http.Get(baseURL + "/api/v1/logs/trace/" + traceID)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Success bool                     `json:"success"`
+		Error   string                   `json:"error"`
+		Data    aggregate.LogQueryResult `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	if !response.Success {
+		return nil, fmt.Errorf("query failed: %s", strings.TrimSpace(response.Error))
+	}
+	return response.Data.Entries, nil
+}
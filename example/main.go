@@ -46,7 +46,7 @@ func basicSpanExample() {
 	ctx := context.Background()
 
 	// 创建根span
-	ctx, span := trace.StartSpan(ctx, "basic-operation")
+	ctx, span := trace.StartInternalSpan(ctx, "basic-operation")
 	defer span.End()
 
 	// 设置属性
@@ -60,7 +60,7 @@ func basicSpanExample() {
 	time.Sleep(100 * time.Millisecond)
 
 	// 创建子span
-	_, childSpan := trace.StartSpan(ctx, "child-operation")
+	_, childSpan := trace.StartInternalSpan(ctx, "child-operation")
 	trace.SetAttribute(childSpan, "step", "data-processing")
 	
 	// 模拟错误处理
@@ -83,14 +83,14 @@ func httpServerExample() {
 		ctx := trace.ExtractOtelTraceContext(r)
 
 		// 创建业务逻辑span
-		ctx, span := trace.StartSpan(ctx, "get-users")
+		ctx, span := trace.StartInternalSpan(ctx, "get-users")
 		defer span.End()
 
 		trace.SetAttribute(span, "http.method", r.Method)
 		trace.SetAttribute(span, "http.route", "/api/users")
 
 		// 模拟数据库查询
-		ctx, dbSpan := trace.StartSpan(ctx, "database-query")
+		ctx, dbSpan := trace.StartClientSpan(ctx, "database-query")
 		trace.SetAttribute(dbSpan, "db.operation", "SELECT")
 		trace.SetAttribute(dbSpan, "db.table", "users")
 		
@@ -124,7 +124,7 @@ func httpClientExample() {
 	client := trace.NewTracedHTTPClient(10 * time.Second)
 
 	// 创建请求span
-	ctx, span := trace.StartSpan(ctx, "http-client-request")
+	ctx, span := trace.StartInternalSpan(ctx, "http-client-request")
 	defer span.End()
 
 	trace.SetAttribute(span, "client.name", "example-client")
@@ -3,6 +3,7 @@ module github.com/HsiaoL1/trace
 go 1.24.3
 
 require (
+	github.com/fsnotify/fsnotify v1.10.1
 	github.com/sirupsen/logrus v1.9.3
 	go.etcd.io/bbolt v1.4.1
 	go.opentelemetry.io/otel v1.37.0
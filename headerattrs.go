@@ -0,0 +1,69 @@
+package trace
+
+import (
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// HTTPRequestHeaderKeyPrefix 请求头span属性键的前缀，后接小写的请求头名称
+const HTTPRequestHeaderKeyPrefix = "http.request.header."
+
+// maxHeaderAttributeBytes 请求头属性值的最大字节数，超出部分截断
+const maxHeaderAttributeBytes = 256
+
+// sensitiveHeaders 无论如何配置都不会记录到span的请求头
+var sensitiveHeaders = map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"set-cookie":          true,
+	"x-api-key":           true,
+}
+
+// SpanEnricher 在标准属性设置之后为HTTP span添加自定义属性
+type SpanEnricher func(span trace.Span, r *http.Request)
+
+// headerAttributes 将允许列表中的请求头转换为span属性
+// 属性键为小写的请求头名称，多个值用逗号连接，敏感请求头总是被跳过
+func headerAttributes(header http.Header, names []string) []attribute.KeyValue {
+	if len(names) == 0 || len(header) == 0 {
+		return nil
+	}
+
+	var attrs []attribute.KeyValue
+	for _, name := range names {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if key == "" || sensitiveHeaders[key] {
+			continue
+		}
+		values := header.Values(key)
+		if len(values) == 0 {
+			continue
+		}
+		value := truncateUTF8(strings.Join(values, ","), maxHeaderAttributeBytes)
+		attrs = append(attrs, attribute.String(HTTPRequestHeaderKeyPrefix+key, value))
+	}
+	return attrs
+}
+
+// truncateUTF8 将字符串截断为最多max字节，不截断多字节字符
+func truncateUTF8(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max]
+}
+
+// enrichSpan 依次调用span增强函数
+func enrichSpan(span trace.Span, r *http.Request, enrichers []SpanEnricher) {
+	for _, enrich := range enrichers {
+		enrich(span, r)
+	}
+}
@@ -0,0 +1,93 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/HsiaoL1/trace/tracetest"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// assertNoHeaderAttrs 断言span上没有指定请求头的属性
+func assertNoHeaderAttrs(t *testing.T, span sdktrace.ReadOnlySpan, names ...string) {
+	t.Helper()
+	for _, attr := range span.Attributes() {
+		for _, name := range names {
+			if string(attr.Key) == HTTPRequestHeaderKeyPrefix+name {
+				t.Errorf("Sensitive header %q must not be recorded, got %q", name, attr.Value.AsString())
+			}
+		}
+	}
+}
+
+func TestMiddlewareRequestHeaderAttributes(t *testing.T) {
+	recorder := tracetest.Start(t)
+
+	var enrichedPath string
+	handler := OpenTelemetryMiddlewareWithOptions(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		WithRequestHeaderAttributes("X-Tenant-ID", "x-experiment", "Authorization", "Cookie", "X-Missing", "X-Long"),
+		WithSpanEnricher(func(span trace.Span, r *http.Request) {
+			enrichedPath = r.URL.Path
+			span.SetAttributes(attribute.String("app.plan", "enterprise"))
+		}),
+	)
+
+	r := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	r.Header.Set("X-Tenant-Id", "acme")
+	r.Header.Add("X-Experiment", "new-checkout")
+	r.Header.Add("X-Experiment", "dark-mode")
+	r.Header.Set("Authorization", "Bearer secret")
+	r.Header.Set("Cookie", "session=secret")
+	r.Header.Set("X-Long", strings.Repeat("界", 100))
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	span := recorder.RequireSpan(t, "GET /orders")
+	recorder.AssertAttr(t, span, "http.request.header.x-tenant-id", "acme")
+	recorder.AssertAttr(t, span, "http.request.header.x-experiment", "new-checkout,dark-mode")
+	recorder.AssertAttr(t, span, "app.plan", "enterprise")
+	assertNoHeaderAttrs(t, span, "authorization", "cookie", "x-missing")
+	if enrichedPath != "/orders" {
+		t.Errorf("Expected enricher to receive the request, got path %q", enrichedPath)
+	}
+
+	for _, attr := range span.Attributes() {
+		if attr.Key == "http.request.header.x-long" {
+			if value := attr.Value.AsString(); len(value) > maxHeaderAttributeBytes || !strings.HasPrefix(value, "界") || len(value)%3 != 0 {
+				t.Errorf("Expected value capped at a rune boundary, got %d bytes", len(value))
+			}
+		}
+	}
+}
+
+func TestClientRequestHeaderAttributes(t *testing.T) {
+	recorder := tracetest.Start(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := NewTracedHTTPClient(0,
+		WithClientRequestHeaderAttributes("x-tenant-id", "PROXY-AUTHORIZATION", "x-api-key"),
+		WithClientSpanEnricher(func(span trace.Span, r *http.Request) {
+			span.SetAttributes(attribute.String("peer.service", r.URL.Hostname()))
+		}),
+	)
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/users", nil)
+	req.Header.Set("X-Tenant-ID", "acme")
+	req.Header.Set("Proxy-Authorization", "Basic secret")
+	req.Header.Set("X-API-Key", "secret")
+	resp, err := client.Do(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	span := recorder.RequireSpan(t, "GET "+server.Listener.Addr().String())
+	recorder.AssertAttr(t, span, "http.request.header.x-tenant-id", "acme")
+	recorder.AssertAttr(t, span, "peer.service", "127.0.0.1")
+	assertNoHeaderAttrs(t, span, "proxy-authorization", "x-api-key")
+}
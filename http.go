@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"net/netip"
 	"strconv"
 	"strings"
 
@@ -11,8 +12,8 @@ import (
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.20.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // HTTP头部常量定义
@@ -39,8 +40,12 @@ const (
 
 // SetTraceContextToHttpHeader 将完整的追踪上下文设置到HTTP头部
 // 同时设置自定义头部和OpenTelemetry标准头部
+// ctx中有有效的OpenTelemetry span时优先使用span的ID，使自定义头部与traceparent属于同一条trace
 func SetTraceContextToHttpHeader(ctx context.Context, traceCtx TraceContext) {
 	if req, ok := ctx.Value(HttpRequestKey).(*http.Request); ok {
+		if spanCtx, ok := otelTraceContext(ctx); ok {
+			traceCtx = spanCtx
+		}
 		// 设置自定义头部（向后兼容）
 		if traceCtx.TraceID != "" {
 			req.Header.Set(TraceIDHeader, traceCtx.TraceID)
@@ -73,11 +78,49 @@ func GetTraceContextFromContext(ctx context.Context) TraceContext {
 	return TraceContext{}
 }
 
+// CurrentTraceContext 返回ctx中当前的追踪上下文，有OpenTelemetry span时使用span的ID，与导出的span一致，
+// 否则返回GetTraceContextFromContext的结果；用于日志等需要与Jaeger中的trace关联的场景
+func CurrentTraceContext(ctx context.Context) TraceContext {
+	if traceCtx, ok := otelTraceContext(ctx); ok {
+		return traceCtx
+	}
+	return GetTraceContextFromContext(ctx)
+}
+
 // WithTraceContext 将追踪上下文注入到context中
 func WithTraceContext(ctx context.Context, traceCtx TraceContext) context.Context {
 	return context.WithValue(ctx, TraceContextKey, traceCtx)
 }
 
+// spanTraceContext 由OpenTelemetry span上下文生成追踪上下文，TraceID和SpanID与导出的span一致
+func spanTraceContext(sc, parent trace.SpanContext) TraceContext {
+	traceCtx := TraceContext{
+		TraceID: sc.TraceID().String(),
+		SpanID:  sc.SpanID().String(),
+	}
+	if parent.IsValid() && parent.TraceID() == sc.TraceID() && parent.SpanID() != sc.SpanID() {
+		traceCtx.ParentSpanID = parent.SpanID().String()
+	}
+	return traceCtx
+}
+
+// otelTraceContext 返回ctx中OpenTelemetry span对应的追踪上下文，没有有效的span时返回false
+// ctx中已有同一条trace的追踪上下文时，沿用它的ParentSpanID或以它的SpanID作为父span
+func otelTraceContext(ctx context.Context) (TraceContext, bool) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return TraceContext{}, false
+	}
+	traceCtx := spanTraceContext(sc, trace.SpanContext{})
+	if current := GetTraceContextFromContext(ctx); current.TraceID == traceCtx.TraceID {
+		if current.SpanID == traceCtx.SpanID {
+			return current, true
+		}
+		traceCtx.ParentSpanID = current.SpanID
+	}
+	return traceCtx, true
+}
+
 // WithHttpRequest 将HTTP请求注入到context中
 func WithHttpRequest(ctx context.Context, req *http.Request) context.Context {
 	return context.WithValue(ctx, HttpRequestKey, req)
@@ -89,7 +132,7 @@ func CreateChildSpan(parentTraceCtx TraceContext) TraceContext {
 	if !parentTraceCtx.IsValid() {
 		return CreateRootSpan()
 	}
-	
+
 	// 生成新的span ID作为当前span
 	newSpanID := GenerateSpanID().String()
 
@@ -112,9 +155,9 @@ func CreateRootSpan() TraceContext {
 
 // IsValid 验证追踪上下文是否有效
 func (tc TraceContext) IsValid() bool {
-	return tc.TraceID != "" && tc.SpanID != "" && 
-		   len(strings.TrimSpace(tc.TraceID)) > 0 && 
-		   len(strings.TrimSpace(tc.SpanID)) > 0
+	return tc.TraceID != "" && tc.SpanID != "" &&
+		len(strings.TrimSpace(tc.TraceID)) > 0 &&
+		len(strings.TrimSpace(tc.SpanID)) > 0
 }
 
 // String 返回追踪上下文的字符串表示
@@ -126,21 +169,133 @@ func (tc TraceContext) String() string {
 	return fmt.Sprintf("TraceID: %s, SpanID: %s", tc.TraceID, tc.SpanID)
 }
 
+// MiddlewareOption OpenTelemetry中间件配置选项
+type MiddlewareOption func(*middlewareConfig)
+
+// middlewareConfig OpenTelemetry中间件配置
+type middlewareConfig struct {
+	baggageKeys    []string
+	headers        []string
+	enrichers      []SpanEnricher
+	bodyCapture    *bodyCaptureConfig
+	trustedProxies []netip.Prefix
+	isErrorStatus  func(int) bool
+}
+
+// ServerErrorStatus 服务端span的默认错误判断：只有5xx响应标记为错误（OpenTelemetry语义约定）
+func ServerErrorStatus(statusCode int) bool {
+	return statusCode >= 500
+}
+
+// ClientErrorStatus 客户端span的默认错误判断：4xx和5xx响应都标记为错误（OpenTelemetry语义约定）
+func ClientErrorStatus(statusCode int) bool {
+	return statusCode >= 400
+}
+
+// WithBaggageAttributes 将允许列表中的baggage键复制为服务端span属性
+func WithBaggageAttributes(keys ...string) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.baggageKeys = append(c.baggageKeys, keys...)
+	}
+}
+
+// WithRequestHeaderAttributes 将允许列表中的请求头复制为服务端span属性（http.request.header.<小写名称>）
+// 多个值用逗号连接，超过256字节的值被截断；Authorization、Cookie等敏感请求头不会被记录
+func WithRequestHeaderAttributes(headers ...string) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.headers = append(c.headers, headers...)
+	}
+}
+
+// WithSpanEnricher 添加span增强函数，在标准属性设置之后、调用下一个处理器之前按添加顺序调用
+func WithSpanEnricher(enricher SpanEnricher) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		if enricher != nil {
+			c.enrichers = append(c.enrichers, enricher)
+		}
+	}
+}
+
+// WithErrorStatusCodes 设置哪些响应状态码将服务端span标记为错误，默认为ServerErrorStatus（只有5xx）
+// 需要把4xx也视为错误时可以传入ClientErrorStatus；无论是否为错误都会记录http.status_code属性
+func WithErrorStatusCodes(isError func(statusCode int) bool) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.isErrorStatus = isError
+	}
+}
+
+// WithTrustedProxies 设置受信任的代理，来自这些代理的请求使用X-Forwarded-For中的客户端IP作为net.peer.ip
+// 可以用ParseTrustedProxies解析Config.TrustedProxies
+func WithTrustedProxies(prefixes ...netip.Prefix) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.trustedProxies = append(c.trustedProxies, prefixes...)
+	}
+}
+
+// WithServerBodyCaptureOnError 在响应状态码≥500时，将最多maxBytes字节的请求和响应body记录为span属性
+// 只记录JSON和文本类型的body
+func WithServerBodyCaptureOnError(maxBytes int) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		if c.bodyCapture == nil {
+			c.bodyCapture = &bodyCaptureConfig{}
+		}
+		c.bodyCapture.maxBytes = maxBytes
+	}
+}
+
+// WithServerBodyRedactor 添加body脱敏函数，在记录到span之前按添加顺序调用
+func WithServerBodyRedactor(redactor BodyRedactor) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		if c.bodyCapture == nil {
+			c.bodyCapture = &bodyCaptureConfig{}
+		}
+		c.bodyCapture.redactors = append(c.bodyCapture.redactors, redactor)
+	}
+}
+
 // OpenTelemetryMiddleware OpenTelemetry HTTP中间件
 func OpenTelemetryMiddleware(next http.Handler) http.Handler {
+	return OpenTelemetryMiddlewareWithOptions(next)
+}
+
+// OpenTelemetryMiddlewareWithOptions 带配置选项的OpenTelemetry HTTP中间件
+func OpenTelemetryMiddlewareWithOptions(next http.Handler, opts ...MiddlewareOption) http.Handler {
+	config := &middlewareConfig{isErrorStatus: ServerErrorStatus}
+	for _, opt := range opts {
+		opt(config)
+	}
+	if config.isErrorStatus == nil {
+		config.isErrorStatus = ServerErrorStatus
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// 从请求头部提取追踪上下文
 		propagator := otel.GetTextMapPropagator()
 		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx = withForceSampleHeader(ctx, r.Header)
 
 		// 创建span
-		tracer := otel.Tracer("github.com/HsiaoL1/trace/http")
+		parent := trace.SpanContextFromContext(ctx)
 		spanName := generateSpanName(r)
-		ctx, span := tracer.Start(ctx, spanName, trace.WithSpanKind(trace.SpanKindServer))
+		ctx, span := startSpan(ctx, "github.com/HsiaoL1/trace/http", spanName, trace.WithSpanKind(trace.SpanKindServer))
 		defer span.End()
 
+		// 同时保存自定义追踪上下文，使HTTPMiddleware和日志使用与span相同的ID
+		if sc := span.SpanContext(); sc.IsValid() {
+			traceCtx := spanTraceContext(sc, parent)
+			ctx = WithTraceContext(ctx, traceCtx)
+			// 外层的HTTPMiddleware已设置追踪响应头时改为span的ID
+			if w.Header().Get(TraceIDHeader) != "" {
+				w.Header().Set(TraceIDHeader, traceCtx.TraceID)
+				w.Header().Set(SpanIDHeader, traceCtx.SpanID)
+			}
+		}
+
 		// 设置HTTP相关属性
-		setHTTPServerSpanAttributes(span, r)
+		setHTTPServerSpanAttributes(span, r, config.trustedProxies)
+		span.SetAttributes(baggageAttributes(ctx, config.baggageKeys)...)
+		span.SetAttributes(headerAttributes(r.Header, config.headers)...)
+		enrichSpan(span, r, config.enrichers)
 
 		// 创建响应writer包装器来捕获状态码
 		wrappedWriter := &responseWriter{
@@ -148,11 +303,31 @@ func OpenTelemetryMiddleware(next http.Handler) http.Handler {
 			statusCode:     200,
 		}
 
+		// 记录请求和响应body
+		var requestBody *cappedBuffer
+		if config.bodyCapture.enabled() {
+			if r.Body != nil && r.Body != http.NoBody {
+				if requestBody = config.bodyCapture.newBuffer(r.Header.Get("Content-Type")); requestBody != nil {
+					r.Body = teeBody(r.Body, requestBody)
+				}
+			}
+			wrappedWriter.body = &cappedBuffer{max: config.bodyCapture.maxBytes}
+		}
+
 		// 将上下文传递给下一个处理器
 		next.ServeHTTP(wrappedWriter, r.WithContext(ctx))
 
 		// 设置响应属性
-		setHTTPResponseSpanAttributes(span, wrappedWriter.statusCode)
+		setHTTPResponseSpanAttributes(span, wrappedWriter.statusCode, config.isErrorStatus)
+
+		// 服务端错误时将body记录到span
+		if config.bodyCapture.enabled() && wrappedWriter.statusCode >= 500 {
+			config.bodyCapture.setAttributes(span, HTTPRequestBodyKey, HTTPRequestBodyTruncatedKey, requestBody)
+			if contentType := w.Header().Get("Content-Type"); isCapturableContentType(contentType) {
+				wrappedWriter.body.contentType = contentType
+				config.bodyCapture.setAttributes(span, HTTPResponseBodyKey, HTTPResponseBodyTruncatedKey, wrappedWriter.body)
+			}
+		}
 	})
 }
 
@@ -160,6 +335,7 @@ func OpenTelemetryMiddleware(next http.Handler) http.Handler {
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	body       *cappedBuffer
 }
 
 func (w *responseWriter) WriteHeader(statusCode int) {
@@ -168,9 +344,17 @@ func (w *responseWriter) WriteHeader(statusCode int) {
 }
 
 func (w *responseWriter) Write(data []byte) (int, error) {
+	if w.body != nil {
+		w.body.Write(data)
+	}
 	return w.ResponseWriter.Write(data)
 }
 
+// Unwrap 供http.ResponseController访问底层的ResponseWriter，被追踪的流式响应也可以Flush
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 // generateSpanName 生成span名称
 func generateSpanName(r *http.Request) string {
 	path := r.URL.Path
@@ -181,7 +365,8 @@ func generateSpanName(r *http.Request) string {
 }
 
 // setHTTPServerSpanAttributes 设置HTTP服务器span属性
-func setHTTPServerSpanAttributes(span trace.Span, r *http.Request) {
+// net.peer.ip为客户端IP，经过受信任代理转发时直接连接的代理地址记录在net.sock.peer.addr
+func setHTTPServerSpanAttributes(span trace.Span, r *http.Request, trustedProxies []netip.Prefix) {
 	span.SetAttributes(
 		semconv.HTTPMethod(r.Method),
 		semconv.HTTPURL(r.URL.String()),
@@ -200,12 +385,12 @@ func setHTTPServerSpanAttributes(span trace.Span, r *http.Request) {
 		span.SetAttributes(attribute.String("http.user_agent", userAgent))
 	}
 
-	if remoteAddr := r.RemoteAddr; remoteAddr != "" {
-		// 提取IP地址（移除端口）
-		if colonIndex := strings.LastIndex(remoteAddr, ":"); colonIndex != -1 {
-			remoteAddr = remoteAddr[:colonIndex]
+	if r.RemoteAddr != "" {
+		clientIP := ClientIP(r, trustedProxies)
+		span.SetAttributes(attribute.String("net.peer.ip", clientIP))
+		if peer, ok := parseHopAddr(r.RemoteAddr); ok && peer.String() != clientIP {
+			span.SetAttributes(semconv.NetSockPeerAddr(peer.String()))
 		}
-		span.SetAttributes(attribute.String("net.peer.ip", remoteAddr))
 	}
 
 	if host := r.Host; host != "" {
@@ -214,13 +399,15 @@ func setHTTPServerSpanAttributes(span trace.Span, r *http.Request) {
 }
 
 // setHTTPResponseSpanAttributes 设置HTTP响应span属性
-func setHTTPResponseSpanAttributes(span trace.Span, statusCode int) {
+// isError判断为错误的状态码标记为Error，<400标记为Ok，其余（如未视为错误的4xx）保持Unset
+func setHTTPResponseSpanAttributes(span trace.Span, statusCode int, isError func(int) bool) {
 	span.SetAttributes(semconv.HTTPStatusCode(statusCode))
 
 	// 根据状态码设置span状态
-	if statusCode >= 400 {
+	switch {
+	case isError(statusCode):
 		span.SetStatus(codes.Error, http.StatusText(statusCode))
-	} else {
+	case statusCode < 400:
 		span.SetStatus(codes.Ok, "")
 	}
 }
@@ -238,32 +425,44 @@ func ExtractOtelTraceContext(req *http.Request) context.Context {
 }
 
 // StartHTTPClientSpan 为HTTP客户端请求创建span
+// span名称优先使用WithRouteTemplate设置的模板，否则为 "METHOD host"，完整URL记录在http.url属性中
 func StartHTTPClientSpan(ctx context.Context, method, url string) (context.Context, trace.Span) {
-	tracer := otel.Tracer("github.com/HsiaoL1/trace/http-client")
-	spanName := fmt.Sprintf("%s %s", method, url)
-	ctx, span := tracer.Start(ctx, spanName, trace.WithSpanKind(trace.SpanKindClient))
-	
+	spanName := RouteTemplateFromContext(ctx)
+	if spanName == "" {
+		spanName = defaultClientSpanName(method, hostFromURL(url))
+	}
+	return startHTTPClientSpan(ctx, spanName, method, url)
+}
+
+// startHTTPClientSpan 使用指定名称为HTTP客户端请求创建span
+func startHTTPClientSpan(ctx context.Context, spanName, method, url string) (context.Context, trace.Span) {
+	ctx, span := startSpan(ctx, "github.com/HsiaoL1/trace/http-client", spanName, trace.WithSpanKind(trace.SpanKindClient))
+
 	// 设置HTTP客户端属性
 	span.SetAttributes(
 		semconv.HTTPMethod(method),
 		semconv.HTTPURL(url),
 	)
-	
+
 	return ctx, span
 }
 
-// FinishHTTPClientSpan 完成HTTP客户端span
+// FinishHTTPClientSpan 完成HTTP客户端span，响应状态码≥400时标记为错误
 func FinishHTTPClientSpan(span trace.Span, resp *http.Response, err error) {
+	finishHTTPClientSpan(span, resp, err, ClientErrorStatus)
+}
+
+// finishHTTPClientSpan 完成HTTP客户端span，isError判断响应状态码是否标记为错误
+func finishHTTPClientSpan(span trace.Span, resp *http.Response, err error, isError func(int) bool) {
 	if err != nil {
-		span.RecordError(err)
-		span.SetStatus(codes.Error, err.Error())
+		recordSpanError(span, err)
 	} else if resp != nil {
 		span.SetAttributes(
 			semconv.HTTPStatusCode(resp.StatusCode),
 			attribute.String("http.response.content_length", strconv.FormatInt(resp.ContentLength, 10)),
 		)
-		
-		if resp.StatusCode >= 400 {
+
+		if isError(resp.StatusCode) {
 			span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
 		}
 	}
@@ -7,20 +7,90 @@ import (
 	"log"
 	"net/http"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // TracedHTTPClient 带追踪功能的HTTP客户端
 type TracedHTTPClient struct {
-	client *http.Client
+	client        *http.Client
+	baggageKeys   []string
+	headers       []string
+	enrichers     []SpanEnricher
+	bodyCapture   *bodyCaptureConfig
+	urlTemplater  URLTemplater
+	isErrorStatus func(int) bool
+}
+
+// ClientOption 带追踪功能的HTTP客户端配置选项
+type ClientOption func(*TracedHTTPClient)
+
+// WithClientBaggageAttributes 将允许列表中的baggage键复制为客户端span属性
+func WithClientBaggageAttributes(keys ...string) ClientOption {
+	return func(c *TracedHTTPClient) {
+		c.baggageKeys = append(c.baggageKeys, keys...)
+	}
+}
+
+// WithClientRequestHeaderAttributes 将允许列表中的请求头复制为客户端span属性，规则与WithRequestHeaderAttributes相同
+func WithClientRequestHeaderAttributes(headers ...string) ClientOption {
+	return func(c *TracedHTTPClient) {
+		c.headers = append(c.headers, headers...)
+	}
+}
+
+// WithClientSpanEnricher 添加span增强函数，在标准属性设置之后、发送请求之前按添加顺序调用
+func WithClientSpanEnricher(enricher SpanEnricher) ClientOption {
+	return func(c *TracedHTTPClient) {
+		if enricher != nil {
+			c.enrichers = append(c.enrichers, enricher)
+		}
+	}
+}
+
+// WithClientErrorStatusCodes 设置哪些响应状态码将客户端span标记为错误，默认为ClientErrorStatus（4xx和5xx）
+// 例如把404视为正常结果的客户端可以传入ServerErrorStatus；无论是否为错误都会记录http.status_code属性
+func WithClientErrorStatusCodes(isError func(statusCode int) bool) ClientOption {
+	return func(c *TracedHTTPClient) {
+		c.isErrorStatus = isError
+	}
+}
+
+// WithBodyCaptureOnError 在请求出错或响应状态码≥400时，将最多maxBytes字节的请求和响应body记录为span属性
+// 只记录JSON和文本类型的body，调用方仍可正常读取响应body
+func WithBodyCaptureOnError(maxBytes int) ClientOption {
+	return func(c *TracedHTTPClient) {
+		if c.bodyCapture == nil {
+			c.bodyCapture = &bodyCaptureConfig{}
+		}
+		c.bodyCapture.maxBytes = maxBytes
+	}
+}
+
+// WithBodyRedactor 添加body脱敏函数，在记录到span之前按添加顺序调用
+func WithBodyRedactor(redactor BodyRedactor) ClientOption {
+	return func(c *TracedHTTPClient) {
+		if c.bodyCapture == nil {
+			c.bodyCapture = &bodyCaptureConfig{}
+		}
+		c.bodyCapture.redactors = append(c.bodyCapture.redactors, redactor)
+	}
 }
 
 // NewTracedHTTPClient 创建新的带追踪功能的HTTP客户端
-func NewTracedHTTPClient(timeout time.Duration) *TracedHTTPClient {
-	return &TracedHTTPClient{
+func NewTracedHTTPClient(timeout time.Duration, opts ...ClientOption) *TracedHTTPClient {
+	c := &TracedHTTPClient{
 		client: &http.Client{
 			Timeout: timeout,
 		},
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.isErrorStatus == nil {
+		c.isErrorStatus = ClientErrorStatus
+	}
+	return c
 }
 
 // Do 执行HTTP请求，自动传递追踪上下文
@@ -30,7 +100,11 @@ func (c *TracedHTTPClient) Do(ctx context.Context, req *http.Request) (*http.Res
 	}
 
 	// 创建HTTP客户端span
-	ctx, span := StartHTTPClientSpan(ctx, req.Method, req.URL.String())
+	spanName := clientSpanName(ctx, req, c.urlTemplater)
+	ctx, span := startHTTPClientSpan(ctx, spanName, req.Method, req.URL.String())
+	span.SetAttributes(baggageAttributes(ctx, c.baggageKeys)...)
+	span.SetAttributes(headerAttributes(req.Header, c.headers)...)
+	enrichSpan(span, req, c.enrichers)
 	defer func() {
 		if span != nil {
 			span.End()
@@ -51,11 +125,39 @@ func (c *TracedHTTPClient) Do(ctx context.Context, req *http.Request) (*http.Res
 	ctx = WithHttpRequest(ctx, req)
 	SetTraceContextToHttpHeader(ctx, traceCtx)
 
+	// 记录请求body
+	var requestBody *cappedBuffer
+	if req.Body != nil && req.Body != http.NoBody {
+		if requestBody = c.bodyCapture.newBuffer(req.Header.Get("Content-Type")); requestBody != nil {
+			req.Body = teeBody(req.Body, requestBody)
+		}
+	}
+
+	// 记录距离实际截止时间的剩余时间
+	start := time.Now()
+	if deadline, ok := effectiveDeadline(ctx, c.client.Timeout, start); ok {
+		span.SetAttributes(attribute.Int64(HTTPClientDeadlineKey, deadline.Sub(start).Milliseconds()))
+	}
+
 	// 执行HTTP请求
 	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		recordCancel(span, classifyCancel(ctx, c.client.Timeout, err), time.Since(start))
+	}
+
+	// 出错时将body记录到span
+	if c.bodyCapture.enabled() && (err != nil || resp.StatusCode >= 400) {
+		c.bodyCapture.setAttributes(span, HTTPRequestBodyKey, HTTPRequestBodyTruncatedKey, requestBody)
+		if resp != nil && resp.Body != nil {
+			if responseBody := c.bodyCapture.newBuffer(resp.Header.Get("Content-Type")); responseBody != nil {
+				resp.Body = peekBody(resp.Body, responseBody)
+				c.bodyCapture.setAttributes(span, HTTPResponseBodyKey, HTTPResponseBodyTruncatedKey, responseBody)
+			}
+		}
+	}
 
 	// 完成span
-	FinishHTTPClientSpan(span, resp, err)
+	finishHTTPClientSpan(span, resp, err, c.isErrorStatus)
 
 	return resp, err
 }
@@ -105,18 +207,8 @@ func HTTPMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// 从HTTP头部获取追踪上下文
-		traceCtx := GetTraceContextFromHttpHeader(r)
-
-		// 如果没有追踪上下文，创建一个根span
-		if !traceCtx.IsValid() {
-			traceCtx = CreateRootSpan()
-		} else {
-			// 如果有追踪上下文，创建子span
-			traceCtx = CreateChildSpan(traceCtx)
-		}
-
 		// 将追踪上下文注入到请求的context中
+		traceCtx := requestTraceContext(r)
 		ctx := WithTraceContext(r.Context(), traceCtx)
 		ctx = WithHttpRequest(ctx, r)
 
@@ -131,20 +223,27 @@ func HTTPMiddleware(next http.Handler) http.Handler {
 
 // ExtractTraceContext 从HTTP请求中提取追踪上下文并注入到context
 func ExtractTraceContext(r *http.Request) context.Context {
-	traceCtx := GetTraceContextFromHttpHeader(r)
-
-	if !traceCtx.IsValid() {
-		traceCtx = CreateRootSpan()
-	} else {
-		traceCtx = CreateChildSpan(traceCtx)
-	}
-
-	ctx := WithTraceContext(r.Context(), traceCtx)
+	ctx := WithTraceContext(r.Context(), requestTraceContext(r))
 	ctx = WithHttpRequest(ctx, r)
 
 	return ctx
 }
 
+// requestTraceContext 返回请求的追踪上下文
+// 请求已经过OpenTelemetryMiddleware（context中有有效的span）时使用span的ID，
+// 否则根据HTTP头部创建子span，没有追踪头部时创建根span
+func requestTraceContext(r *http.Request) TraceContext {
+	if traceCtx, ok := otelTraceContext(r.Context()); ok {
+		return traceCtx
+	}
+
+	traceCtx := GetTraceContextFromHttpHeader(r)
+	if !traceCtx.IsValid() {
+		return CreateRootSpan()
+	}
+	return CreateChildSpan(traceCtx)
+}
+
 // LogTraceContext 记录追踪上下文信息（用于调试）
 func LogTraceContext(ctx context.Context, operation string) {
 	traceCtx := GetTraceContextFromContext(ctx)
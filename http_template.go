@@ -0,0 +1,133 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// routeTemplateKey 路由模板在context中的key
+type routeTemplateKey struct{}
+
+// URLTemplater 根据请求生成客户端span名称，返回空字符串时使用默认名称
+type URLTemplater func(*http.Request) string
+
+// WithRouteTemplate 设置本次调用的span名称模板，如 "GET /users/{id}/orders/{orderID}"
+// 优先级高于客户端配置的URLTemplater
+func WithRouteTemplate(ctx context.Context, template string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, routeTemplateKey{}, template)
+}
+
+// RouteTemplateFromContext 获取context中的路由模板
+func RouteTemplateFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	template, _ := ctx.Value(routeTemplateKey{}).(string)
+	return template
+}
+
+// WithURLTemplater 设置客户端span名称的生成函数
+func WithURLTemplater(templater URLTemplater) ClientOption {
+	return func(c *TracedHTTPClient) {
+		c.urlTemplater = templater
+	}
+}
+
+// IDPathTemplater 内置的URLTemplater，将纯数字和UUID路径段替换为{id}
+// 例如 GET /users/83721/orders/99 -> GET /users/{id}/orders/{id}
+func IDPathTemplater(req *http.Request) string {
+	if req == nil || req.URL == nil {
+		return ""
+	}
+	return req.Method + " " + TemplatePath(req.URL.Path)
+}
+
+// TemplatePath 将路径中的纯数字和UUID段替换为{id}
+func TemplatePath(path string) string {
+	if path == "" {
+		return "/"
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if isNumericSegment(segment) || isUUIDSegment(segment) {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// isNumericSegment 判断路径段是否为纯数字
+func isNumericSegment(segment string) bool {
+	if segment == "" {
+		return false
+	}
+	for i := 0; i < len(segment); i++ {
+		if segment[i] < '0' || segment[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// isUUIDSegment 判断路径段是否为UUID（8-4-4-4-12格式）
+func isUUIDSegment(segment string) bool {
+	if len(segment) != 36 {
+		return false
+	}
+	for i := 0; i < len(segment); i++ {
+		c := segment[i]
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !isHexChar(c) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isHexChar 判断是否为十六进制字符
+func isHexChar(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// clientSpanName 生成客户端span名称
+// 优先使用context中的路由模板，其次是URLTemplater，最后回退为 "METHOD host"
+func clientSpanName(ctx context.Context, req *http.Request, templater URLTemplater) string {
+	if template := RouteTemplateFromContext(ctx); template != "" {
+		return template
+	}
+	if templater != nil {
+		if name := templater(req); name != "" {
+			return name
+		}
+	}
+	return defaultClientSpanName(req.Method, req.URL.Host)
+}
+
+// defaultClientSpanName 生成默认的客户端span名称 "METHOD host"
+func defaultClientSpanName(method, host string) string {
+	if host == "" {
+		return method
+	}
+	return method + " " + host
+}
+
+// hostFromURL 从URL字符串中提取host
+func hostFromURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return parsed.Host
+}
@@ -0,0 +1,90 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/HsiaoL1/trace/tracetest"
+)
+
+func TestTemplatePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"", "/"},
+		{"/", "/"},
+		{"/users", "/users"},
+		{"/users/83721", "/users/{id}"},
+		{"/users/83721/orders/99", "/users/{id}/orders/{id}"},
+		{"/users/83721/orders/99/", "/users/{id}/orders/{id}/"},
+		{"/orders/3f2504e0-4f89-11d3-9a0c-0305e82c3301", "/orders/{id}"},
+		{"/orders/3F2504E0-4F89-11D3-9A0C-0305E82C3301/items", "/orders/{id}/items"},
+		{"/v2/users/abc123", "/v2/users/abc123"},
+		{"/files/3f2504e0-4f89-11d3-9a0c-0305e82c330", "/files/3f2504e0-4f89-11d3-9a0c-0305e82c330"},
+		{"/files/3f2504e0x4f89-11d3-9a0c-0305e82c3301", "/files/3f2504e0x4f89-11d3-9a0c-0305e82c3301"},
+		{"/items/-1", "/items/-1"},
+	}
+
+	for _, tt := range tests {
+		if got := TemplatePath(tt.path); got != tt.want {
+			t.Errorf("TemplatePath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestIDPathTemplater(t *testing.T) {
+	req := httptest.NewRequest(http.MethodDelete, "http://api.internal/users/42?force=true", nil)
+	if got := IDPathTemplater(req); got != "DELETE /users/{id}" {
+		t.Errorf("Expected DELETE /users/{id}, got %q", got)
+	}
+}
+
+func TestClientSpanNaming(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	host := server.Listener.Addr().String()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		opts     []ClientOption
+		wantSpan string
+	}{
+		{
+			name:     "FallbackToHost",
+			ctx:      context.Background(),
+			wantSpan: "GET " + host,
+		},
+		{
+			name:     "Templater",
+			ctx:      context.Background(),
+			opts:     []ClientOption{WithURLTemplater(IDPathTemplater)},
+			wantSpan: "GET /users/{id}/orders/{id}",
+		},
+		{
+			name:     "ContextTemplateWins",
+			ctx:      WithRouteTemplate(context.Background(), "GET /users/{id}/orders/{orderID}"),
+			opts:     []ClientOption{WithURLTemplater(IDPathTemplater)},
+			wantSpan: "GET /users/{id}/orders/{orderID}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.Start(t)
+
+			url := server.URL + "/users/83721/orders/99"
+			resp, err := NewTracedHTTPClient(0, tt.opts...).Get(tt.ctx, url)
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+
+			span := recorder.RequireSpan(t, tt.wantSpan)
+			recorder.AssertAttr(t, span, "http.url", url)
+		})
+	}
+}
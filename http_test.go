@@ -0,0 +1,196 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/HsiaoL1/trace/tracetest"
+	"go.opentelemetry.io/otel/codes"
+)
+
+func TestOpenTelemetryMiddleware(t *testing.T) {
+	recorder := tracetest.Start(t)
+
+	handler := OpenTelemetryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users/42", nil))
+
+	span := recorder.RequireSpan(t, "GET /users/42")
+	recorder.AssertAttr(t, span, "http.method", "GET")
+	recorder.AssertAttr(t, span, "http.route", "/users/42")
+	recorder.AssertAttr(t, span, "http.status_code", http.StatusNotFound)
+	if span.Status().Code != codes.Unset {
+		t.Errorf("Expected unset status for 404, got %v", span.Status().Code)
+	}
+}
+
+func TestOpenTelemetryMiddlewareFlush(t *testing.T) {
+	tracetest.Start(t)
+
+	handler := OpenTelemetryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data: first\n\n"))
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("Expected traced response to support Flush, got %v", err)
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+	if !w.Flushed {
+		t.Error("Expected response to be flushed")
+	}
+}
+
+func TestSpanStatusPolicy(t *testing.T) {
+	recorder := tracetest.Start(t)
+
+	var status int
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	})
+	server := httptest.NewServer(backend)
+	defer server.Close()
+
+	tests := []struct {
+		status       int
+		server       codes.Code // 默认策略：只有5xx为错误
+		serverStrict codes.Code // WithErrorStatusCodes(ClientErrorStatus)
+		client       codes.Code // 默认策略：4xx和5xx为错误
+		clientLax    codes.Code // WithClientErrorStatusCodes(ServerErrorStatus)
+	}{
+		{http.StatusOK, codes.Ok, codes.Ok, codes.Unset, codes.Unset},
+		{http.StatusNotFound, codes.Unset, codes.Error, codes.Error, codes.Unset},
+		{http.StatusTooManyRequests, codes.Unset, codes.Error, codes.Error, codes.Unset},
+		{http.StatusInternalServerError, codes.Error, codes.Error, codes.Error, codes.Error},
+	}
+
+	servers := map[string]http.Handler{
+		"default": OpenTelemetryMiddleware(backend),
+		"strict":  OpenTelemetryMiddlewareWithOptions(backend, WithErrorStatusCodes(ClientErrorStatus)),
+	}
+	clients := map[string]*TracedHTTPClient{
+		"default": NewTracedHTTPClient(0),
+		"lax":     NewTracedHTTPClient(0, WithClientErrorStatusCodes(ServerErrorStatus)),
+	}
+	clientSpan := "GET " + server.Listener.Addr().String()
+
+	for _, tt := range tests {
+		status = tt.status
+		for name, want := range map[string]codes.Code{"default": tt.server, "strict": tt.serverStrict} {
+			recorder.Reset()
+			servers[name].ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/status", nil))
+			span := recorder.RequireSpan(t, "GET /status")
+			recorder.AssertAttr(t, span, "http.status_code", tt.status)
+			if got := span.Status().Code; got != want {
+				t.Errorf("server %s, status %d: expected %v, got %v", name, tt.status, want, got)
+			}
+		}
+		for name, want := range map[string]codes.Code{"default": tt.client, "lax": tt.clientLax} {
+			recorder.Reset()
+			resp, err := clients[name].Get(context.Background(), server.URL+"/status")
+			if err != nil {
+				t.Fatalf("Request failed: %v", err)
+			}
+			resp.Body.Close()
+			span := recorder.RequireSpan(t, clientSpan)
+			recorder.AssertAttr(t, span, "http.status_code", tt.status)
+			if got := span.Status().Code; got != want {
+				t.Errorf("client %s, status %d: expected %v, got %v", name, tt.status, want, got)
+			}
+		}
+	}
+}
+
+func TestTracedHTTPClientPropagatesContext(t *testing.T) {
+	recorder := tracetest.Start(t)
+
+	server := httptest.NewServer(OpenTelemetryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	defer server.Close()
+
+	ctx, parent := StartSpan(context.Background(), "parent")
+	resp, err := NewTracedHTTPClient(0).Get(ctx, server.URL+"/health")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	parent.End()
+
+	parentSpan := recorder.RequireSpan(t, "parent")
+	clientSpan := recorder.RequireSpan(t, "GET "+server.Listener.Addr().String())
+	serverSpan := recorder.RequireSpan(t, "GET /health")
+	recorder.AssertAttr(t, clientSpan, "http.status_code", http.StatusOK)
+	recorder.AssertParent(t, clientSpan, parentSpan)
+	recorder.AssertParent(t, serverSpan, clientSpan)
+
+	if got := parentSpan.SpanContext().TraceID().String(); got != "00000000000000000000000000000001" {
+		t.Errorf("Expected deterministic trace ID, got %s", got)
+	}
+}
+
+func TestLegacyMiddlewareSharesOTelIDs(t *testing.T) {
+	recorder := tracetest.Start(t)
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	// 下游服务只使用旧的中间件，记录收到的自定义追踪头部
+	var downstream TraceContext
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downstream = GetTraceContextFromHttpHeader(r)
+	}))
+	defer server.Close()
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		LogTraceContext(r.Context(), "handle")
+		resp, err := NewTracedHTTPClient(0).Get(r.Context(), server.URL+"/downstream")
+		if err != nil {
+			t.Errorf("Request failed: %v", err)
+			return
+		}
+		resp.Body.Close()
+	})
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+	}{
+		{"otel then legacy", OpenTelemetryMiddleware(HTTPMiddleware(handler))},
+		{"legacy then otel", HTTPMiddleware(OpenTelemetryMiddleware(handler))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder.Reset()
+			logs.Reset()
+			w := httptest.NewRecorder()
+			tt.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/orders", nil))
+
+			serverSpan := recorder.RequireSpan(t, "GET /orders")
+			clientSpan := recorder.RequireSpan(t, "GET "+server.Listener.Addr().String())
+			traceID := serverSpan.SpanContext().TraceID().String()
+			spanID := serverSpan.SpanContext().SpanID().String()
+
+			if want := "TraceID: " + traceID + ", SpanID: " + spanID; !strings.Contains(logs.String(), want) {
+				t.Errorf("Expected logged trace context %q, got %q", want, logs.String())
+			}
+			if w.Header().Get(TraceIDHeader) != traceID || w.Header().Get(SpanIDHeader) != spanID {
+				t.Errorf("Expected response headers %s/%s, got %s/%s", traceID, spanID, w.Header().Get(TraceIDHeader), w.Header().Get(SpanIDHeader))
+			}
+			// 自定义头部与traceparent一致：下游的父span是客户端span
+			want := TraceContext{TraceID: traceID, SpanID: clientSpan.SpanContext().SpanID().String(), ParentSpanID: spanID}
+			if downstream != want {
+				t.Errorf("Expected downstream headers %+v, got %+v", want, downstream)
+			}
+		})
+	}
+}
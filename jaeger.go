@@ -2,7 +2,10 @@ package trace
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -19,11 +22,28 @@ import (
 
 // JaegerConfig 配置结构
 type JaegerConfig struct {
+	// Endpoint 支持 http(s)://host:port[/path]、host:port 或 host 三种形式
 	Endpoint    string
 	ServiceName string
 	Environment string
 	Version     string
 	Enabled     bool
+	// Insecure 不使用TLS，用于不带协议的端点；http:// 端点总是不使用TLS
+	Insecure bool
+	// AllowForceSample 接受X-Trace-Force-Sample请求头和上游traceparent中的采样标志，不受采样率限制
+	AllowForceSample bool
+	// ForceSampleToken 不为空时X-Trace-Force-Sample的值必须等于此令牌，防止外部请求滥用
+	ForceSampleToken string
+
+	// Span限制，为0时使用OpenTelemetry SDK的默认值（或OTEL_SPAN_*环境变量），不能为负数
+	// AttributeValueLengthLimit 字符串属性值的最大长度（按字符计），SetAttribute会在超过时截断并加上TruncatedSuffix
+	AttributeValueLengthLimit int
+	// AttributeCountLimit 每个span的最大属性数，超出的属性被丢弃
+	AttributeCountLimit int
+	// EventCountLimit 每个span的最大事件数，超出时丢弃最早的事件
+	EventCountLimit int
+	// LinkCountLimit 每个span的最大link数，超出时丢弃最早的link
+	LinkCountLimit int
 }
 
 // DefaultJaegerConfig 默认配置
@@ -58,6 +78,21 @@ func LoadJaegerConfigFromEnv() *JaegerConfig {
 		config.Version = version
 	}
 
+	if insecure := getFirstEnv("OTEL_EXPORTER_OTLP_TRACES_INSECURE", "OTEL_EXPORTER_OTLP_INSECURE", "JAEGER_INSECURE"); insecure != "" {
+		if parsed, err := strconv.ParseBool(insecure); err == nil {
+			config.Insecure = parsed
+		}
+	}
+
+	if allow := os.Getenv("TRACE_ALLOW_FORCE_SAMPLE"); allow != "" {
+		if parsed, err := strconv.ParseBool(allow); err == nil {
+			config.AllowForceSample = parsed
+		}
+	}
+	config.ForceSampleToken = os.Getenv("TRACE_FORCE_SAMPLE_TOKEN")
+
+	loadSpanLimitsFromEnv(config)
+
 	if enabled := getFirstEnv("OTEL_TRACES_EXPORTER", "JAEGER_ENABLED"); enabled != "" {
 		if enabled == "otlp" || enabled == "jaeger" {
 			config.Enabled = true
@@ -69,13 +104,32 @@ func LoadJaegerConfigFromEnv() *JaegerConfig {
 	return config
 }
 
+// JaegerOption InitJaeger的可选配置
+type JaegerOption func(*jaegerOptions)
+
+// jaegerOptions InitJaeger的可选配置
+type jaegerOptions struct {
+	slo           bool
+	sloThresholds SLOThresholds
+}
+
+// WithSLOProcessor 在导出span之前安装SLOProcessor，thresholds为按span名称前缀的默认阈值，可以为nil
+// 超过阈值的span带有slo.breached=true属性和slo.breached事件，可以在Jaeger中按标签查找慢操作
+func WithSLOProcessor(thresholds SLOThresholds) JaegerOption {
+	return func(o *jaegerOptions) {
+		o.slo = true
+		o.sloThresholds = thresholds
+	}
+}
+
 // InitJaeger 初始化Jaeger追踪
-func InitJaeger(config *JaegerConfig) (func(), error) {
+func InitJaeger(config *JaegerConfig, opts ...JaegerOption) (func(), error) {
 	if config == nil {
 		return nil, fmt.Errorf("config cannot be nil")
 	}
 
 	if !config.Enabled {
+		recordSetup(tracingSetup{state: InitStateDisabled, serviceName: config.ServiceName})
 		return func() {}, nil
 	}
 
@@ -99,15 +153,31 @@ func InitJaeger(config *JaegerConfig) (func(), error) {
 		return nil, fmt.Errorf("failed to create resource: %w", err)
 	}
 
-	// 创建trace provider
+	var options jaegerOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	// 统计导出的span数和最近的错误，用于Diagnostics
+	exports := &exportStats{}
+	var processor sdktrace.SpanProcessor = sdktrace.NewBatchSpanProcessor(&diagnosticExporter{SpanExporter: exporter, stats: exports})
+	if options.slo {
+		processor = NewSLOProcessor(processor, options.sloThresholds)
+	}
+
+	// 创建trace provider，SetAttribute按SDK实际使用的长度限制截断
+	limits := spanLimits(config)
+	sampler := createSampler(config)
 	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSpanProcessor(processor),
 		sdktrace.WithResource(res),
-		sdktrace.WithSampler(createSampler(config)),
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithRawSpanLimits(limits),
 	)
+	setAttributeValueLengthLimit(limits.AttributeValueLengthLimit)
 
 	// 设置全局trace provider
 	otel.SetTracerProvider(tp)
+	setTracerProvider(tp)
 
 	// 设置全局propagator
 	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
@@ -115,6 +185,16 @@ func InitJaeger(config *JaegerConfig) (func(), error) {
 		propagation.Baggage{},
 	))
 
+	endpoint, _ := normalizeEndpoint(config)
+	recordSetup(tracingSetup{
+		state:       InitStateEnabled,
+		serviceName: config.ServiceName,
+		endpoint:    endpoint,
+		sampler:     sampler.Description(),
+		resource:    res,
+		exports:     exports,
+	})
+
 	// 返回清理函数
 	return func() {
 		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -148,20 +228,102 @@ func validateJaegerConfig(config *JaegerConfig) error {
 	if config.ServiceName == "" {
 		return fmt.Errorf("service name cannot be empty")
 	}
-	if config.Endpoint == "" {
-		return fmt.Errorf("endpoint cannot be empty")
+	if err := validateSpanLimits(config); err != nil {
+		return err
+	}
+	if _, err := normalizeEndpoint(config); err != nil {
+		return err
 	}
 	return nil
 }
 
+// defaultOTLPPort 不带协议且未指定端口的端点使用的OTLP HTTP端口
+const defaultOTLPPort = "4318"
+
+// otlpEndpoint 规范化后的OTLP HTTP端点
+type otlpEndpoint struct {
+	hostPort string // 传给WithEndpoint的host:port
+	path     string // 为空时使用导出器默认的/v1/traces
+	insecure bool
+}
+
+// normalizeEndpoint 将配置中的端点拆分为host:port、URL路径和是否使用TLS
+// 带协议的端点由协议决定是否使用TLS，未指定端口时使用协议的默认端口；
+// 不带协议的端点由Insecure决定，未指定端口时使用4318
+func normalizeEndpoint(config *JaegerConfig) (otlpEndpoint, error) {
+	raw := strings.TrimSpace(config.Endpoint)
+	if raw == "" {
+		return otlpEndpoint{}, fmt.Errorf("endpoint cannot be empty")
+	}
+
+	hasScheme := strings.Contains(raw, "://")
+	toParse := raw
+	if !hasScheme {
+		toParse = "//" + raw
+	}
+	u, err := url.Parse(toParse)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return otlpEndpoint{}, fmt.Errorf("invalid endpoint %q: %v", raw, err)
+	}
+
+	endpoint := otlpEndpoint{insecure: config.Insecure}
+	if hasScheme {
+		switch u.Scheme {
+		case "http":
+			endpoint.insecure = true
+		case "https":
+			if config.Insecure {
+				return otlpEndpoint{}, fmt.Errorf("endpoint %q uses https but Insecure is set", raw)
+			}
+		default:
+			return otlpEndpoint{}, fmt.Errorf("invalid endpoint %q: unsupported scheme %q, want http or https", raw, u.Scheme)
+		}
+	}
+
+	switch {
+	case u.Hostname() == "":
+		return otlpEndpoint{}, fmt.Errorf("invalid endpoint %q: missing host", raw)
+	case u.User != nil:
+		return otlpEndpoint{}, fmt.Errorf("invalid endpoint %q: credentials are not supported, use headers instead", raw)
+	case u.RawQuery != "" || u.Fragment != "":
+		return otlpEndpoint{}, fmt.Errorf("invalid endpoint %q: query and fragment are not supported", raw)
+	}
+
+	endpoint.hostPort = u.Host
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return otlpEndpoint{}, fmt.Errorf("invalid endpoint %q: port %s out of range", raw, port)
+		}
+	} else if !hasScheme {
+		endpoint.hostPort = net.JoinHostPort(u.Hostname(), defaultOTLPPort)
+	} else {
+		endpoint.hostPort = strings.TrimSuffix(u.Host, ":")
+	}
+
+	if u.Path != "" && u.Path != "/" {
+		endpoint.path = u.Path
+	}
+	return endpoint, nil
+}
+
 // createOTLPExporter 创建OTLP导出器
 func createOTLPExporter(ctx context.Context, config *JaegerConfig) (sdktrace.SpanExporter, error) {
-	opts := []otlptracehttp.Option{
-		otlptracehttp.WithEndpoint(config.Endpoint),
+	endpoint, err := normalizeEndpoint(config)
+	if err != nil {
+		return nil, err
 	}
 
-	// 根据端点协议决定是否使用TLS
-	if strings.HasPrefix(config.Endpoint, "http://") {
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(endpoint.hostPort),
+	}
+	if endpoint.path != "" {
+		opts = append(opts, otlptracehttp.WithURLPath(endpoint.path))
+	}
+	if endpoint.insecure {
 		opts = append(opts, otlptracehttp.WithInsecure())
 	}
 
@@ -180,10 +342,21 @@ func createResource(ctx context.Context, config *JaegerConfig) (*resource.Resour
 }
 
 // createSampler 创建采样器
+// 在开发环境中使用全量采样，生产环境中使用概率采样
 func createSampler(config *JaegerConfig) sdktrace.Sampler {
-	// 在开发环境中使用全量采样，生产环境中使用概率采样
+	root := sdktrace.TraceIDRatioBased(0.1) // 10%采样率
 	if config.Environment == "development" || config.Environment == "dev" {
-		return sdktrace.AlwaysSample()
+		root = sdktrace.AlwaysSample()
 	}
-	return sdktrace.TraceIDRatioBased(0.1) // 10%采样率
+	return newSampler(root, config)
+}
+
+// newSampler 组合根span采样器和强制采样
+// 上游的采样标志只在允许强制采样时生效，本地子span跟随父span的采样决定，以便强制采样的请求记录完整的trace
+func newSampler(root sdktrace.Sampler, config *JaegerConfig) sdktrace.Sampler {
+	base := sdktrace.ParentBased(root,
+		sdktrace.WithRemoteParentSampled(root),
+		sdktrace.WithRemoteParentNotSampled(root),
+	)
+	return NewForceSampleSampler(base, config.AllowForceSample, config.ForceSampleToken)
 }
@@ -0,0 +1,181 @@
+package aggregate
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 自适应刷新的默认值
+const (
+	DefaultAdaptiveMaxLatency    = time.Second
+	DefaultAdaptiveMaxBatchBytes = 1 << 20 // 1MB
+)
+
+// 自适应刷新的内部参数
+const (
+	maxAdaptiveBatchEntries = 100000 // 单批条目数的上限
+	adaptiveInitialEntry    = 256    // 还没有刷新过时估计的单条字节数
+	adaptiveMinTick         = 10 * time.Millisecond
+	adaptiveSmoothing       = 0.3 // 写入速率和单条大小的指数平滑系数
+)
+
+// 刷新直方图的桶边界，计数与桶一一对应，最后一个为+Inf
+var (
+	flushSizeBuckets    = []int{1, 10, 100, 1000, 10000, 100000}
+	flushLatencyBuckets = []time.Duration{
+		100 * time.Microsecond, 500 * time.Microsecond, time.Millisecond, 5 * time.Millisecond,
+		10 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond, 500 * time.Millisecond, time.Second,
+	}
+)
+
+// WithAdaptiveFlush 启用自适应刷新，代替固定的批量大小和刷新间隔：
+// 缓冲区中最早的条目等待maxLatency或缓冲的字节数估计超过maxBatchBytes时刷新，以先到者为准；
+// 批次条目数根据观察到的写入速率和单条大小动态调整，写入量大时每次写入更多条目，减少系统调用，空闲时最多丢失maxLatency内的条目
+// maxLatency为0时使用DefaultAdaptiveMaxLatency，maxBatchBytes为0时使用DefaultAdaptiveMaxBatchBytes
+func WithAdaptiveFlush(maxLatency time.Duration, maxBatchBytes int) AggregatorOption {
+	return func(o *aggregatorOptions) error {
+		if maxLatency < 0 {
+			return fmt.Errorf("最大刷新延迟不能为负数: %v", maxLatency)
+		}
+		if maxBatchBytes < 0 {
+			return fmt.Errorf("最大批次字节数不能为负数: %d", maxBatchBytes)
+		}
+		if maxLatency == 0 {
+			maxLatency = DefaultAdaptiveMaxLatency
+		}
+		if maxBatchBytes == 0 {
+			maxBatchBytes = DefaultAdaptiveMaxBatchBytes
+		}
+		o.adaptiveMaxLatency = maxLatency
+		o.adaptiveMaxBytes = maxBatchBytes
+		return nil
+	}
+}
+
+// adaptiveFlush 自适应刷新的状态，由batchMutex保护
+type adaptiveFlush struct {
+	maxLatency time.Duration
+	maxBytes   int
+
+	rate        float64   // 平滑后的写入速率（条/秒）
+	entryBytes  float64   // 平滑后的单条序列化字节数
+	target      int       // 当前的批次条目数
+	bufferStart time.Time // 缓冲区中第一条条目进入的时间，缓冲区为空时为零值
+	lastFlush   time.Time
+}
+
+// newAdaptiveFlush 创建自适应刷新状态，maxLatency不大于0时返回nil（使用固定的批量大小和刷新间隔）
+func newAdaptiveFlush(maxLatency time.Duration, maxBytes int) *adaptiveFlush {
+	if maxLatency <= 0 {
+		return nil
+	}
+	a := &adaptiveFlush{maxLatency: maxLatency, maxBytes: maxBytes, entryBytes: adaptiveInitialEntry, lastFlush: time.Now()}
+	a.target = a.byteLimit()
+	return a
+}
+
+// tick 定时检查的间隔，缓冲区中的条目最多等待maxLatency
+func (a *adaptiveFlush) tick() time.Duration {
+	return max(a.maxLatency/2, adaptiveMinTick)
+}
+
+// byteLimit 按单条大小估计的、不超过maxBytes的批次条目数
+func (a *adaptiveFlush) byteLimit() int {
+	return min(max(int(float64(a.maxBytes)/a.entryBytes), 1), maxAdaptiveBatchEntries)
+}
+
+// added 记录条目进入缓冲区，返回是否应立即刷新；buffered为加入后缓冲区中的条目数
+func (a *adaptiveFlush) added(buffered int, now time.Time) bool {
+	if buffered == 1 {
+		a.bufferStart = now
+	}
+	return buffered >= a.target || now.Sub(a.bufferStart) >= a.maxLatency
+}
+
+// due 定时检查时缓冲区是否应该刷新，等待时间超过一个检查间隔的缓冲区在下一次检查前会超过maxLatency
+func (a *adaptiveFlush) due(buffered int, now time.Time) bool {
+	return buffered > 0 && now.Sub(a.bufferStart) >= a.maxLatency-a.tick()
+}
+
+// observe 根据一次刷新的条目数和字节数更新写入速率、单条大小和批次条目数
+// 批次条目数为maxLatency内预计写入的条目数，不超过maxBytes对应的条目数
+func (a *adaptiveFlush) observe(entries, bytes int, now time.Time) {
+	if entries <= 0 {
+		return
+	}
+	if elapsed := now.Sub(a.lastFlush).Seconds(); elapsed > 0 {
+		a.rate += adaptiveSmoothing * (float64(entries)/elapsed - a.rate)
+	}
+	a.entryBytes += adaptiveSmoothing * (float64(bytes)/float64(entries) - a.entryBytes)
+	a.entryBytes = max(a.entryBytes, 1)
+	a.lastFlush = now
+	a.bufferStart = time.Time{}
+	a.target = min(max(int(a.rate*a.maxLatency.Seconds()), 1), a.byteLimit())
+}
+
+// FlushStats 批量缓冲区写入文件的统计
+type FlushStats struct {
+	Count             uint64          `json:"count"`
+	Entries           uint64          `json:"entries"`
+	Bytes             uint64          `json:"bytes"`
+	LatencySum        time.Duration   `json:"latency_sum"`
+	SizeBuckets       []int           `json:"size_buckets"`        // 每次刷新条目数的桶边界
+	SizeCounts        []uint64        `json:"size_counts"`         // 与SizeBuckets一一对应的非累积计数，最后一个为+Inf
+	LatencyBuckets    []time.Duration `json:"latency_buckets"`     // 每次刷新耗时的桶边界
+	LatencyCounts     []uint64        `json:"latency_counts"`      // 与LatencyBuckets一一对应的非累积计数，最后一个为+Inf
+	AdaptiveBatchSize int             `json:"adaptive_batch_size"` // 自适应刷新当前的批次条目数，未启用时为0
+}
+
+// flushHistogram 记录每次刷新的条目数和耗时
+type flushHistogram struct {
+	mutex sync.Mutex
+	stats FlushStats
+}
+
+// record 记录一次刷新，target为自适应刷新之后的批次条目数，未启用时为0
+func (h *flushHistogram) record(entries, bytes int, latency time.Duration, target int) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.stats.SizeCounts == nil {
+		h.stats.SizeCounts = make([]uint64, len(flushSizeBuckets)+1)
+		h.stats.LatencyCounts = make([]uint64, len(flushLatencyBuckets)+1)
+	}
+	h.stats.Count++
+	h.stats.Entries += uint64(entries)
+	h.stats.Bytes += uint64(bytes)
+	h.stats.LatencySum += latency
+	h.stats.AdaptiveBatchSize = target
+	h.stats.SizeCounts[sort.SearchInts(flushSizeBuckets, entries)]++
+	h.stats.LatencyCounts[sort.Search(len(flushLatencyBuckets), func(i int) bool { return latency <= flushLatencyBuckets[i] })]++
+}
+
+// snapshot 返回统计的副本
+func (h *flushHistogram) snapshot() FlushStats {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	stats := h.stats
+	stats.SizeBuckets = slices.Clone(flushSizeBuckets)
+	stats.LatencyBuckets = slices.Clone(flushLatencyBuckets)
+	stats.SizeCounts = make([]uint64, len(flushSizeBuckets)+1)
+	stats.LatencyCounts = make([]uint64, len(flushLatencyBuckets)+1)
+	copy(stats.SizeCounts, h.stats.SizeCounts)
+	copy(stats.LatencyCounts, h.stats.LatencyCounts)
+	return stats
+}
+
+// recordFlush 记录一次批量写入并更新自适应刷新的批次条目数，调用方需持有batchMutex
+func (la *LogAggregator) recordFlush(entries, bytes int, start time.Time) {
+	if entries == 0 {
+		return
+	}
+	now := time.Now()
+	target := 0
+	if la.adaptive != nil {
+		la.adaptive.observe(entries, bytes, now)
+		target = la.adaptive.target
+	}
+	la.flushes.record(entries, bytes, now.Sub(start), target)
+}
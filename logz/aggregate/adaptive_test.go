@@ -0,0 +1,128 @@
+package aggregate
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveFlushTarget(t *testing.T) {
+	a := newAdaptiveFlush(time.Second, 1<<20)
+	if a.target != (1<<20)/adaptiveInitialEntry {
+		t.Fatalf("期望初始批次按默认单条大小计算，得到 %d", a.target)
+	}
+
+	// 高写入量：每100ms写入5000条200字节的条目，批次受字节数限制
+	now := a.lastFlush
+	for i := 0; i < 20; i++ {
+		now = now.Add(100 * time.Millisecond)
+		a.observe(5000, 5000*200, now)
+	}
+	if want := (1 << 20) / 200; a.target < want*9/10 || a.target > want {
+		t.Errorf("期望批次接近 %d 条（1MB/200B），得到 %d", want, a.target)
+	}
+
+	// 空闲：每秒5条，批次随写入速率下降，条目等待不超过最大延迟
+	for i := 0; i < 30; i++ {
+		now = now.Add(time.Second)
+		a.observe(5, 5*200, now)
+	}
+	if a.target < 4 || a.target > 6 {
+		t.Errorf("期望批次接近每秒写入的5条，得到 %d", a.target)
+	}
+
+	if a.added(1, now) {
+		t.Error("期望未达到批次且未超过最大延迟时不刷新")
+	}
+	if !a.added(2, now.Add(time.Second)) {
+		t.Error("期望最早的条目等待超过最大延迟时刷新")
+	}
+}
+
+func TestAdaptiveFlushAggregator(t *testing.T) {
+	if _, err := applyAggregatorOptions([]AggregatorOption{WithAdaptiveFlush(-time.Second, 0)}); err == nil {
+		t.Error("期望拒绝负数的最大延迟")
+	}
+
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "adaptive", WithAdaptiveFlush(50*time.Millisecond, 4096))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+
+	// 空闲时由定时检查在最大延迟内写入文件，不需要Flush
+	if err := aggregator.WriteLog(LogEntry{Level: "info", Message: "quiet-entry"}); err != nil {
+		t.Fatalf("写入日志失败: %v", err)
+	}
+	path := filepath.Join(dir, aggregator.output.fileID+".log")
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if content, _ := os.ReadFile(path); strings.Contains(string(content), "quiet-entry") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("期望条目在最大延迟后写入文件")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 大量写入时按字节数刷新，每批不超过约4KB
+	message := strings.Repeat("x", 200)
+	for i := 0; i < 1000; i++ {
+		if err := aggregator.WriteLog(LogEntry{Level: "info", Message: message}); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+	}
+	stats := aggregator.Stats()
+	if !stats.AdaptiveFlush || stats.FlushInterval != 50*time.Millisecond {
+		t.Errorf("期望统计中包含自适应刷新配置，得到 %+v", stats)
+	}
+	flushes := stats.Flushes
+	if flushes.Count < 20 || flushes.AdaptiveBatchSize < 1 || flushes.AdaptiveBatchSize > 4096/200 {
+		t.Errorf("期望按4KB分批刷新，得到 %d 次刷新，批次 %d 条", flushes.Count, flushes.AdaptiveBatchSize)
+	}
+	var sizeTotal, latencyTotal uint64
+	for _, n := range flushes.SizeCounts {
+		sizeTotal += n
+	}
+	for _, n := range flushes.LatencyCounts {
+		latencyTotal += n
+	}
+	if sizeTotal != flushes.Count || latencyTotal != flushes.Count ||
+		len(flushes.SizeCounts) != len(flushes.SizeBuckets)+1 || len(flushes.LatencyCounts) != len(flushes.LatencyBuckets)+1 {
+		t.Errorf("直方图计数与刷新次数不一致: %+v", flushes)
+	}
+}
+
+func TestFlushStatsFixed(t *testing.T) {
+	aggregator, err := NewLogAggregatorWithOptions(t.TempDir(), "fixed", WithBatchSize(10), WithFlushInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+
+	for i := 0; i < 25; i++ {
+		if err := aggregator.WriteLog(LogEntry{Level: "info", Message: "fixed"}); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+	}
+	if err := aggregator.Flush(); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+	stats := aggregator.Stats()
+	if stats.AdaptiveFlush || stats.BatchSize != 10 || stats.FlushInterval != time.Hour {
+		t.Errorf("期望统计中包含固定的批量配置，得到 %+v", stats)
+	}
+	// 两批10条和一批5条，都落在(1,10]的桶中
+	if stats.Flushes.Count != 3 || stats.Flushes.Entries != 25 || stats.Flushes.SizeCounts[1] != 3 {
+		t.Errorf("期望3次刷新共25条，得到 %+v", stats.Flushes)
+	}
+	stats.Flushes.SizeBuckets[0] = -1
+	if slices.Contains(aggregator.Stats().Flushes.SizeBuckets, -1) {
+		t.Error("期望返回的桶边界是副本")
+	}
+}
@@ -0,0 +1,68 @@
+// Package aggregate 日志聚合、索引和查询
+//
+// 聚合器把logz默认日志器的日志写入按服务和日期命名的聚合文件，并在bbolt数据库中为TraceID、级别等字段建立索引；
+// 查询函数读取聚合目录，设置了全局聚合器时使用其索引。只使用logz分级日志的程序不需要导入本包，不会链接bbolt。
+//
+// 这些功能原来在logz中，标识符保持不变（logz.LogAggregator即aggregate.LogAggregator），迁移时把logz.改为aggregate.即可；
+// 聚合器的接口由logz.Aggregator改名为Writer，与Aggregator（即LogAggregator）区分。
+// 导入本包后已弃用的logz.InitWithAggregation转发到本包的InitWithAggregation，logz.Close同时关闭全局聚合器
+package aggregate
+
+import "context"
+
+// Aggregator 写入聚合文件和索引的日志聚合器
+type Aggregator = LogAggregator
+
+// Memory 只保存在内存中的聚合器，用于测试
+type Memory = MemoryAggregator
+
+// Option 聚合器的配置选项
+type Option = AggregatorOption
+
+// Entry 聚合日志条目
+type Entry = LogEntry
+
+// Query 查询条件
+type Query = LogQuery
+
+// Result 查询结果
+type Result = LogQueryResult
+
+// Store 日志目录的查询接口
+type Store = LogStore
+
+// New 创建聚合器，输出到outputDir中以serviceName开头的文件
+func New(outputDir, serviceName string, opts ...Option) (*Aggregator, error) {
+	return NewLogAggregatorWithOptions(outputDir, serviceName, opts...)
+}
+
+// NewMemory 创建内存聚合器
+func NewMemory(serviceName string, opts ...Option) (*Memory, error) {
+	return NewMemoryAggregator(serviceName, opts...)
+}
+
+// Init 初始化带聚合功能的日志系统，与InitWithAggregationOptions相同
+// logFile不为空时同时写入原始日志文件，serviceName为空时自动检测；可以重复调用，之前的聚合器被关闭
+func Init(logFile, aggregateDir, serviceName string, opts ...Option) error {
+	return InitWithAggregationOptions(logFile, aggregateDir, serviceName, opts...)
+}
+
+// Search 查询日志目录，设置了全局聚合器时使用其索引，ctx取消或超时后停止扫描文件
+func Search(ctx context.Context, query Query, logDir string) (*Result, error) {
+	return QueryLogsContext(ctx, query, logDir)
+}
+
+// NewStore 创建查询日志目录的Store
+func NewStore(logDir string, opts ...DirStoreOption) Store {
+	return NewDirStore(logDir, opts...)
+}
+
+// Global 返回全局聚合器，没有设置时返回nil
+func Global() Writer {
+	return GlobalAggregator()
+}
+
+// SetGlobal 设置全局聚合器，替换的聚合器被关闭，nil只清除全局聚合器
+func SetGlobal(aggregator Writer) {
+	SetGlobalAggregator(aggregator)
+}
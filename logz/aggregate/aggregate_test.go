@@ -0,0 +1,62 @@
+package aggregate
+
+import (
+	"context"
+	"testing"
+
+	"github.com/HsiaoL1/trace/logz"
+)
+
+func TestAggregatorAliases(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := New(dir, "svc", WithBatchSize(1))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+
+	// 别名与原来的类型相同，可以混用
+	var writer Writer = aggregator
+	SetGlobal(writer)
+	defer SetGlobal(nil)
+	if Global() != writer || GetGlobalAggregator() != aggregator {
+		t.Fatalf("期望全局聚合器为新创建的聚合器")
+	}
+
+	for _, entry := range []Entry{
+		{Level: logz.LevelInfo, Message: "first", TraceID: "trace-1"},
+		{Level: logz.LevelError, Message: "second", TraceID: "trace-1"},
+		{Level: logz.LevelInfo, Message: "other", TraceID: "trace-2"},
+	} {
+		if err := aggregator.WriteLog(entry); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+	}
+	if err := aggregator.Flush(); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+
+	var result *LogQueryResult
+	result, err = Search(context.Background(), Query{TraceID: "trace-1", Limit: 10}, dir)
+	if err != nil || result.Total != 2 {
+		t.Fatalf("期望查询到2条日志，得到 %+v, %v", result, err)
+	}
+	storeResult, err := NewStore(dir).Query(context.Background(), LogQuery{Level: logz.LevelError, Limit: 10})
+	if err != nil || len(storeResult.Entries) != 1 || storeResult.Entries[0].Message != "second" {
+		t.Fatalf("期望通过Store查询到错误日志，得到 %+v, %v", storeResult, err)
+	}
+}
+
+func TestMemoryAlias(t *testing.T) {
+	memory, err := NewMemory("svc")
+	if err != nil {
+		t.Fatalf("创建内存聚合器失败: %v", err)
+	}
+	if err := memory.WriteLog(LogEntry{Level: logz.LevelWarn, Message: "hello"}); err != nil {
+		t.Fatalf("写入日志失败: %v", err)
+	}
+	var entries []Entry = memory.Entries()
+	if len(entries) != 1 || entries[0].Message != "hello" || entries[0].Seq != 1 {
+		t.Errorf("期望内存聚合器保存1条带序号的日志，得到 %+v", entries)
+	}
+}
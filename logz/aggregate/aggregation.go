@@ -0,0 +1,147 @@
+package aggregate
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// AggregateOptions 聚合结果中排行和最近错误的数量
+type AggregateOptions struct {
+	TopN         int // 每个排行返回的条数，默认5
+	RecentErrors int // 返回的最近错误条数，默认10
+}
+
+// KeyCount 排行中的一项
+type KeyCount struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// LogAggregation 一次扫描得到的日志统计
+type LogAggregation struct {
+	Total            int            `json:"total"`
+	ErrorCount       int            `json:"error_count"` // error、fatal和panic级别的条目数
+	Levels           map[string]int `json:"levels"`
+	TopTraces        []KeyCount     `json:"top_traces"`         // 按条目数排序的TraceID
+	TopErrorServices []KeyCount     `json:"top_error_services"` // 按错误数排序的服务
+	RecentErrors     []LogEntry     `json:"recent_errors"`      // 按时间倒序的最近错误
+}
+
+// AggregateLogs 扫描日志目录中匹配query的日志并统计，query的分页条件不生效
+func AggregateLogs(query LogQuery, logDir string, opts AggregateOptions) (*LogAggregation, error) {
+	return AggregateLogsContext(context.Background(), query, logDir, opts)
+}
+
+// AggregateLogsContext 与AggregateLogs相同，但在ctx取消时停止扫描
+func AggregateLogsContext(ctx context.Context, query LogQuery, logDir string, opts AggregateOptions) (*LogAggregation, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkLogDir(logDir); err != nil {
+		return nil, err
+	}
+	if opts.TopN <= 0 {
+		opts.TopN = 5
+	}
+	if opts.RecentErrors <= 0 {
+		opts.RecentErrors = 10
+	}
+
+	files, err := DiscoverLogFiles(logDir, query.DiscoverOptions())
+	if err != nil {
+		return nil, fmt.Errorf("获取日志文件失败: %w", err)
+	}
+	files = dedupeCompressedFiles(files)
+	query.Limit, query.Offset = 0, 0
+
+	result := &LogAggregation{Levels: make(map[string]int)}
+	traces := make(map[string]int)
+	errorServices := make(map[string]int)
+	var recent []timedEntry
+	for _, file := range files {
+		entries, _, err := queryFile(ctx, openLogReader, file, query, nil)
+		if err != nil {
+			var parseErr *ParseError
+			if errors.As(err, &parseErr) {
+				return nil, err
+			}
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			continue // 跳过有问题的文件
+		}
+
+		for _, entry := range entries {
+			level := canonicalLevel(entry.Level)
+			result.Total++
+			result.Levels[level]++
+			if entry.TraceID != "" {
+				traces[entry.TraceID]++
+			}
+			if !isLevelIn(level, errorLevels) {
+				continue
+			}
+			result.ErrorCount++
+			if entry.Service != "" {
+				errorServices[entry.Service]++
+			}
+			recent = addRecent(recent, entry, opts.RecentErrors)
+		}
+	}
+
+	result.TopTraces = topCounts(traces, opts.TopN)
+	result.TopErrorServices = topCounts(errorServices, opts.TopN)
+	result.RecentErrors = make([]LogEntry, len(recent))
+	for i, item := range recent {
+		result.RecentErrors[i] = item.entry
+	}
+	return result, nil
+}
+
+// timedEntry 带解析后时间的日志条目
+type timedEntry struct {
+	entry LogEntry
+	ts    time.Time
+}
+
+// addRecent 将条目插入按时间倒序排列的列表，列表最多保留limit条
+func addRecent(recent []timedEntry, entry LogEntry, limit int) []timedEntry {
+	ts, _ := time.Parse(time.RFC3339, entry.Timestamp)
+	i := len(recent)
+	for i > 0 && ts.After(recent[i-1].ts) {
+		i--
+	}
+	if i >= limit {
+		return recent
+	}
+	recent = slices.Insert(recent, i, timedEntry{entry: entry, ts: ts})
+	if len(recent) > limit {
+		recent = recent[:limit]
+	}
+	return recent
+}
+
+// topCounts 返回计数最大的n项，计数相同时按键排序
+func topCounts(counts map[string]int, n int) []KeyCount {
+	items := make([]KeyCount, 0, len(counts))
+	for key, count := range counts {
+		items = append(items, KeyCount{Key: key, Count: count})
+	}
+	slices.SortFunc(items, func(a, b KeyCount) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return cmp.Compare(a.Key, b.Key)
+	})
+	if len(items) > n {
+		items = items[:n]
+	}
+	return items
+}
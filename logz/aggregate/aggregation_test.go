@@ -0,0 +1,62 @@
+package aggregate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAggregateLogs(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	at := func(minutes int) string {
+		return base.Add(time.Duration(minutes) * time.Minute).Format(time.RFC3339)
+	}
+
+	writeGroupTestLog(t, dir, []LogEntry{
+		{Timestamp: at(0), Level: "info", Message: "start", Service: "api", TraceID: "trace-a"},
+		{Timestamp: at(1), Level: "error", Message: "db down", Service: "api", TraceID: "trace-a"},
+		{Timestamp: at(2), Level: "fatal", Message: "crash", Service: "worker", TraceID: "trace-b"},
+		{Timestamp: at(3), Level: "ERROR", Message: "retry failed", Service: "api", TraceID: "trace-a"},
+		{Timestamp: at(4), Level: "warning", Message: "slow", Service: "worker", TraceID: "trace-c"},
+		{Timestamp: at(5), Level: "error", Message: "queue full", Service: "worker"},
+		{Timestamp: at(6), Level: "debug", Message: "tick", Service: "worker", TraceID: "trace-b"},
+	})
+
+	result, err := AggregateLogs(LogQuery{Limit: 1}, dir, AggregateOptions{TopN: 2, RecentErrors: 3})
+	if err != nil {
+		t.Fatalf("统计失败: %v", err)
+	}
+	if result.Total != 7 || result.ErrorCount != 4 {
+		t.Errorf("期望共 7 条、错误 4 条，得到 %d、%d", result.Total, result.ErrorCount)
+	}
+	if result.Levels["error"] != 3 || result.Levels["warn"] != 1 || result.Levels["fatal"] != 1 {
+		t.Errorf("级别统计错误: %v", result.Levels)
+	}
+
+	wantTraces := []KeyCount{{"trace-a", 3}, {"trace-b", 2}}
+	if len(result.TopTraces) != 2 || result.TopTraces[0] != wantTraces[0] || result.TopTraces[1] != wantTraces[1] {
+		t.Errorf("期望 %v，得到 %v", wantTraces, result.TopTraces)
+	}
+	// 错误数相同时按服务名排序
+	wantServices := []KeyCount{{"api", 2}, {"worker", 2}}
+	if len(result.TopErrorServices) != 2 || result.TopErrorServices[0] != wantServices[0] || result.TopErrorServices[1] != wantServices[1] {
+		t.Errorf("期望 %v，得到 %v", wantServices, result.TopErrorServices)
+	}
+
+	var messages []string
+	for _, entry := range result.RecentErrors {
+		messages = append(messages, entry.Message)
+	}
+	if len(messages) != 3 || messages[0] != "queue full" || messages[1] != "retry failed" || messages[2] != "crash" {
+		t.Errorf("最近错误错误: %v", messages)
+	}
+
+	// 时间范围过滤
+	result, err = AggregateLogs(LogQuery{StartTime: base.Add(3 * time.Minute)}, dir, AggregateOptions{})
+	if err != nil {
+		t.Fatalf("统计失败: %v", err)
+	}
+	if result.Total != 4 || result.ErrorCount != 2 || len(result.RecentErrors) != 2 {
+		t.Errorf("期望共 4 条、错误 2 条，得到 %d、%d、%d", result.Total, result.ErrorCount, len(result.RecentErrors))
+	}
+}
@@ -0,0 +1,234 @@
+package aggregate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// 索引压缩的默认值
+const (
+	DefaultIndexCompactFreeRatio       = 0.5              // 空闲页超过文件大小的一半时压缩
+	indexCompactMinSize          int64 = 64 * 1024 * 1024 // 小于64MB的索引不按空闲页比例压缩
+	indexCompactTxMaxSize        int64 = 64 * 1024 * 1024 // 压缩时每个事务复制的最大字节数
+	indexCompactTempSuffix             = ".compact"
+	indexCompactBackupSuffix           = ".bak"
+)
+
+// indexDBOptions 打开索引数据库的选项
+var indexDBOptions = &bbolt.Options{
+	Timeout: 5 * time.Second,
+	NoSync:  false,
+}
+
+// openIndexDB 打开索引数据库
+func openIndexDB(path string) (*bbolt.DB, error) {
+	return bbolt.Open(path, 0600, indexDBOptions)
+}
+
+// IndexCompactionStats 索引压缩前后的大小
+type IndexCompactionStats struct {
+	BeforeSize int64         `json:"before_size"`
+	AfterSize  int64         `json:"after_size"`
+	FreeBytes  int64         `json:"free_bytes"` // 压缩前空闲页占用的字节数
+	Duration   time.Duration `json:"duration"`
+}
+
+// CompactIndex 将索引数据库中的有效数据复制到临时数据库并替换原数据库，释放删除倒排列表后留下的空闲页
+// bbolt不会把空闲页还给操作系统，清理过期文件后索引文件不会变小，需要压缩
+// 压缩期间暂停索引写入和索引查询，写入的条目在索引队列中等待
+// 临时数据库校验通过后才替换原数据库，替换后无法打开时恢复原数据库；原数据库也无法打开时索引停用，
+// 返回ErrIndexUnavailable，Describe的IndexError记录原因，下次调用CompactIndex时会先尝试重新打开
+func (la *LogAggregator) CompactIndex(ctx context.Context) (*IndexCompactionStats, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	la.closeMutex.Lock()
+	closed := la.closed
+	la.closeMutex.Unlock()
+	if closed {
+		return nil, errors.New("聚合器已关闭")
+	}
+
+	la.indexMutex.Lock()
+	defer la.indexMutex.Unlock()
+	if la.indexDB == nil {
+		if la.indexErr == nil {
+			return nil, errors.New("聚合器已关闭")
+		}
+		if err := la.reopenIndexLocked(); err != nil {
+			return nil, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	path := la.indexPath
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取索引数据库失败: %w", err)
+	}
+	stats := &IndexCompactionStats{
+		BeforeSize: stat.Size(),
+		FreeBytes:  int64(la.indexDB.Stats().FreeAlloc),
+	}
+
+	tmpPath := path + indexCompactTempSuffix
+	os.Remove(tmpPath)
+	tmp, err := bbolt.Open(tmpPath, 0600, indexDBOptions)
+	if err != nil {
+		return nil, fmt.Errorf("创建临时索引数据库失败: %w", err)
+	}
+	if err := bbolt.Compact(tmp, la.indexDB, indexCompactTxMaxSize); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("压缩索引数据库失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("关闭临时索引数据库失败: %w", err)
+	}
+	if err := verifyCompactedIndex(tmpPath, la.indexDB); err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+
+	// 关闭原数据库后用重命名替换，原数据库先保留为备份
+	if err := la.indexDB.Close(); err != nil {
+		os.Remove(tmpPath)
+		return nil, fmt.Errorf("关闭索引数据库失败: %w", err)
+	}
+	la.indexDB = nil
+	backupPath := path + indexCompactBackupSuffix
+	swapErr := swapIndexFiles(path, tmpPath, backupPath)
+	if swapErr == nil {
+		db, err := la.openIndex(path)
+		if err == nil {
+			la.indexDB = db
+			os.Remove(backupPath)
+			if stat, err := os.Stat(path); err == nil {
+				stats.AfterSize = stat.Size()
+			}
+			stats.Duration = time.Since(start)
+			return stats, nil
+		}
+		swapErr = fmt.Errorf("打开压缩后的索引数据库失败: %w", err)
+		if err := os.Rename(backupPath, path); err != nil {
+			swapErr = fmt.Errorf("%w; 恢复原索引数据库失败: %w", swapErr, err)
+		}
+	}
+
+	if err := la.reopenIndexLocked(); err != nil {
+		return nil, fmt.Errorf("%w; %w", swapErr, err)
+	}
+	return nil, swapErr
+}
+
+// swapIndexFiles 将path重命名为backupPath，再将tmpPath重命名为path，第二步失败时恢复path
+func swapIndexFiles(path, tmpPath, backupPath string) error {
+	os.Remove(backupPath)
+	if err := os.Rename(path, backupPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("备份索引数据库失败: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		if restoreErr := os.Rename(backupPath, path); restoreErr != nil {
+			return fmt.Errorf("替换索引数据库失败: %w; 恢复原索引数据库失败: %w", err, restoreErr)
+		}
+		return fmt.Errorf("替换索引数据库失败: %w", err)
+	}
+	return nil
+}
+
+// verifyCompactedIndex 检查压缩后的数据库可以打开，且每个索引桶的键数与原数据库相同
+func verifyCompactedIndex(path string, src *bbolt.DB) error {
+	want, err := countBucketKeys(src)
+	if err != nil {
+		return err
+	}
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: indexDBOptions.Timeout, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("打开压缩后的索引数据库失败: %w", err)
+	}
+	defer db.Close()
+	got, err := countBucketKeys(db)
+	if err != nil {
+		return err
+	}
+	if !maps.Equal(got, want) {
+		return fmt.Errorf("压缩后的索引数据库与原数据库不一致: %v != %v", got, want)
+	}
+	return nil
+}
+
+// indexClosedErrLocked 返回indexDB为nil的原因，调用方需持有indexMutex
+func (la *LogAggregator) indexClosedErrLocked() error {
+	if la.indexErr != nil {
+		return fmt.Errorf("索引数据库已停用: %w", la.indexErr)
+	}
+	return errors.New("聚合器已关闭")
+}
+
+// reopenIndexLocked 重新打开索引数据库，失败时停用索引并记录原因，调用方需持有indexMutex写锁
+func (la *LogAggregator) reopenIndexLocked() error {
+	db, err := la.openIndex(la.indexPath)
+	if err != nil {
+		la.indexErr = err
+		return fmt.Errorf("%w: 重新打开索引数据库失败: %w", ErrIndexUnavailable, err)
+	}
+	la.indexDB = db
+	la.indexErr = nil
+	return nil
+}
+
+// indexCompactionDue 索引文件超过配置的大小，或空闲页比例超过配置的比例时需要压缩
+// 索引停用时也需要压缩，由CompactIndex在维护任务中重试打开索引数据库
+func (la *LogAggregator) indexCompactionDue() bool {
+	la.indexMutex.RLock()
+	defer la.indexMutex.RUnlock()
+	if la.indexDB == nil {
+		return la.indexErr != nil
+	}
+	stat, err := os.Stat(la.indexDB.Path())
+	if err != nil {
+		return false
+	}
+	size := stat.Size()
+	if la.compactMaxSize > 0 && size > la.compactMaxSize {
+		return true
+	}
+	if la.compactFreeRatio > 0 && size >= indexCompactMinSize {
+		return float64(la.indexDB.Stats().FreeAlloc) >= la.compactFreeRatio*float64(size)
+	}
+	return false
+}
+
+// compactIndexIfDue 在维护任务中按需压缩索引
+func (la *LogAggregator) compactIndexIfDue() {
+	if !la.indexCompactionDue() {
+		return
+	}
+	stats, err := la.CompactIndex(la.ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[索引压缩错误] %v\n", err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "[索引] 压缩索引数据库: %d -> %d 字节，耗时 %v\n", stats.BeforeSize, stats.AfterSize, stats.Duration)
+}
+
+// CompactAggregatorIndex 压缩全局聚合器的索引数据库，没有写入文件的全局聚合器时返回ErrNoAggregator
+func CompactAggregatorIndex(ctx context.Context) (*IndexCompactionStats, error) {
+	aggregator := GetGlobalAggregator()
+	if aggregator == nil {
+		return nil, ErrNoAggregator
+	}
+	return aggregator.CompactIndex(ctx)
+}
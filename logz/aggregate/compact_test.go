@@ -0,0 +1,200 @@
+package aggregate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+// bloatIndex 为不存在的文件写入大量索引条目，返回写入的文件ID
+func bloatIndex(t *testing.T, aggregator *LogAggregator, entries int) string {
+	t.Helper()
+	fileID := aggregator.serviceName + "_2020-01-01_001"
+	err := aggregator.indexDB.Update(func(tx *bbolt.Tx) error {
+		for i := 0; i < entries; i++ {
+			entry := LogEntry{
+				Timestamp: "2020-01-01T00:00:00Z",
+				Level:     "info",
+				Service:   aggregator.serviceName,
+				TraceID:   fmt.Sprintf("bloat-%06d-%s", i, strings.Repeat("x", 64)),
+				SpanID:    fmt.Sprintf("span-%06d", i),
+				FileID:    fileID,
+				Offset:    int64(i) * 100,
+			}
+			if err := putPostings(tx, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("写入索引失败: %v", err)
+	}
+	return fileID
+}
+
+func TestCompactIndex(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "compact", WithBatchSize(1))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+	SetGlobalAggregator(aggregator)
+	defer SetGlobalAggregator(nil)
+
+	for i := 0; i < 10; i++ {
+		if err := aggregator.WriteLog(LogEntry{Level: "info", Message: fmt.Sprintf("live %d", i), TraceID: "trace-live"}); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+	}
+	if err := aggregator.Flush(); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+
+	// 删除倒排列表后文件不会变小
+	fileID := bloatIndex(t, aggregator, 5000)
+	if _, err := aggregator.removeIndexPostings(map[string]bool{fileID: true}, false); err != nil {
+		t.Fatalf("删除索引失败: %v", err)
+	}
+
+	stats, err := CompactAggregatorIndex(context.Background())
+	if err != nil {
+		t.Fatalf("压缩索引失败: %v", err)
+	}
+	if stats.AfterSize <= 0 || stats.AfterSize*4 > stats.BeforeSize || stats.FreeBytes == 0 {
+		t.Errorf("期望压缩后文件明显变小，得到 %+v", stats)
+	}
+
+	// 压缩后索引查询和写入仍然正常
+	if err := aggregator.WriteLog(LogEntry{Level: "info", Message: "after compact", TraceID: "trace-live"}); err != nil {
+		t.Fatalf("写入日志失败: %v", err)
+	}
+	if err := aggregator.Flush(); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+	result, err := QueryLogs(LogQuery{TraceID: "trace-live", UseIndex: true, RequireIndex: true, Limit: 100}, dir)
+	if err != nil || result.Total != 11 {
+		t.Fatalf("期望通过索引查询到 11 条，得到 %+v %v", result, err)
+	}
+	info, err := aggregator.Describe()
+	if err != nil || info.IndexDBSize >= stats.BeforeSize || info.IndexBuckets["trace_id"] != 11 {
+		t.Errorf("期望Describe反映压缩后的索引，得到 size=%d buckets=%v %v", info.IndexDBSize, info.IndexBuckets, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := aggregator.CompactIndex(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("期望返回context.Canceled，得到 %v", err)
+	}
+}
+
+// flakyIndexOpener 打开索引数据库的函数，接下来的fail次打开返回错误
+type flakyIndexOpener struct {
+	fail atomic.Int32
+}
+
+// option 替换聚合器打开索引数据库的函数
+func (o *flakyIndexOpener) option() AggregatorOption {
+	return func(opts *aggregatorOptions) error {
+		opts.openIndex = func(path string) (*bbolt.DB, error) {
+			if o.fail.Add(-1) >= 0 {
+				return nil, errors.New("模拟打开失败")
+			}
+			return openIndexDB(path)
+		}
+		return nil
+	}
+}
+
+func TestCompactIndexReopenFailure(t *testing.T) {
+	dir := t.TempDir()
+	opener := &flakyIndexOpener{}
+	aggregator, err := NewLogAggregatorWithOptions(dir, "reopen", WithBatchSize(1), opener.option())
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+	SetGlobalAggregator(aggregator)
+	defer SetGlobalAggregator(nil)
+
+	for i := 0; i < 5; i++ {
+		if err := aggregator.WriteLog(LogEntry{Level: "info", Message: fmt.Sprintf("entry %d", i), TraceID: "trace-reopen"}); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+	}
+	if err := aggregator.Flush(); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+	query := LogQuery{TraceID: "trace-reopen", UseIndex: true, RequireIndex: true, Limit: 100}
+
+	// 压缩后的数据库无法打开时恢复并重新打开原数据库
+	opener.fail.Store(1)
+	if _, err := aggregator.CompactIndex(context.Background()); err == nil || errors.Is(err, ErrIndexUnavailable) {
+		t.Fatalf("期望压缩失败但索引仍可用，得到 %v", err)
+	}
+	if result, err := QueryLogs(query, dir); err != nil || result.Total != 5 {
+		t.Fatalf("期望恢复原索引后查询到 5 条，得到 %+v %v", result, err)
+	}
+
+	// 原数据库也无法打开时索引停用，Describe报告原因
+	opener.fail.Store(2)
+	if _, err := aggregator.CompactIndex(context.Background()); !errors.Is(err, ErrIndexUnavailable) {
+		t.Fatalf("期望返回ErrIndexUnavailable，得到 %v", err)
+	}
+	info, err := aggregator.Describe()
+	if err != nil || !strings.Contains(info.IndexError, "模拟打开失败") {
+		t.Errorf("期望Describe报告索引停用原因，得到 %q %v", info.IndexError, err)
+	}
+	if !aggregator.indexCompactionDue() {
+		t.Error("期望索引停用时在维护任务中重试")
+	}
+	if _, err := QueryLogs(query, dir); err == nil {
+		t.Error("期望索引停用时要求索引的查询返回错误")
+	}
+	if result, err := QueryLogs(LogQuery{TraceID: "trace-reopen", Limit: 100}, dir); err != nil || result.Total != 5 {
+		t.Errorf("期望索引停用时扫描文件查询到 5 条，得到 %+v %v", result, err)
+	}
+
+	// 再次压缩时重新打开索引数据库
+	if _, err := aggregator.CompactIndex(context.Background()); err != nil {
+		t.Fatalf("期望重新打开后压缩成功，得到 %v", err)
+	}
+	info, err = aggregator.Describe()
+	if err != nil || info.IndexError != "" || info.IndexBuckets["trace_id"] != 5 {
+		t.Errorf("期望索引恢复，得到 %+v %v", info, err)
+	}
+	if result, err := QueryLogs(query, dir); err != nil || result.Total != 5 {
+		t.Errorf("期望恢复后通过索引查询到 5 条，得到 %+v %v", result, err)
+	}
+}
+
+func TestIndexCompactionDue(t *testing.T) {
+	aggregator, err := NewLogAggregatorWithOptions(t.TempDir(), "due", WithIndexCompaction(1, 0))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+	if !aggregator.indexCompactionDue() {
+		t.Error("期望索引超过配置的大小时需要压缩")
+	}
+
+	aggregator.compactMaxSize = 0
+	aggregator.compactFreeRatio = DefaultIndexCompactFreeRatio
+	if aggregator.indexCompactionDue() {
+		t.Error("期望小于64MB的索引不按空闲页比例压缩")
+	}
+
+	aggregator.Close()
+	if _, err := aggregator.CompactIndex(context.Background()); err == nil {
+		t.Error("期望关闭后压缩返回错误")
+	}
+	if _, err := CompactAggregatorIndex(context.Background()); !errors.Is(err, ErrNoAggregator) {
+		t.Errorf("期望返回ErrNoAggregator，得到 %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+package aggregate
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// compressTempSuffix 压缩过程中临时文件的后缀，压缩完成后重命名为.log.gz
+const compressTempSuffix = ".tmp"
+
+// compressFile 压缩文件
+// 先写入临时文件并同步到磁盘，再重命名为.log.gz并删除原文件，
+// 中途退出时最多留下临时文件或同时存在的原文件和压缩文件，由reconcileCompression在启动时处理
+func (la *LogAggregator) compressFile(filePath string) error {
+	// 打开原文件
+	file, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("打开文件失败: %w", err)
+	}
+	defer file.Close()
+
+	// 创建临时压缩文件
+	gzPath := filePath + ".gz"
+	tmpPath := gzPath + compressTempSuffix
+	gzFile, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("创建压缩文件失败: %w", err)
+	}
+	defer gzFile.Close()
+
+	fail := func(format string, err error) error {
+		gzFile.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf(format, err)
+	}
+
+	// 复制内容
+	gzWriter := gzip.NewWriter(gzFile)
+	if _, err := io.Copy(gzWriter, file); err != nil {
+		return fail("压缩文件失败: %w", err)
+	}
+
+	// 确保数据写入磁盘
+	if err := gzWriter.Close(); err != nil {
+		return fail("关闭压缩文件失败: %w", err)
+	}
+	if err := gzFile.Sync(); err != nil {
+		return fail("同步压缩文件失败: %w", err)
+	}
+	if err := gzFile.Close(); err != nil {
+		return fail("关闭压缩文件失败: %w", err)
+	}
+
+	// 压缩文件完整后才出现在最终路径上
+	if err := os.Rename(tmpPath, gzPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("重命名压缩文件失败: %w", err)
+	}
+
+	// 删除原文件
+	if err := os.Remove(filePath); err != nil {
+		return fmt.Errorf("删除原文件失败: %w", err)
+	}
+
+	return nil
+}
+
+// reconcileCompression 处理上次退出时未完成的压缩：删除残留的临时文件；
+// 原文件和压缩文件同时存在时，压缩文件完整且不短于原文件则删除原文件（完成压缩），否则删除压缩文件（回滚）
+func (la *LogAggregator) reconcileCompression() {
+	prefix := filepath.Join(la.outputDir, la.serviceName+"_")
+
+	temps, _ := filepath.Glob(prefix + "*.log.gz" + compressTempSuffix)
+	for _, tmp := range temps {
+		if err := os.Remove(tmp); err != nil {
+			fmt.Fprintf(os.Stderr, "[压缩恢复错误] %s: %v\n", tmp, err)
+		}
+	}
+
+	gzFiles, _ := filepath.Glob(prefix + "*.log.gz")
+	for _, gzPath := range gzFiles {
+		plainPath := strings.TrimSuffix(gzPath, ".gz")
+		plain, err := os.Stat(plainPath)
+		if err != nil {
+			continue
+		}
+
+		remove := gzPath
+		if size, err := gzipContentSize(gzPath); err == nil && size >= plain.Size() {
+			remove = plainPath
+		}
+		if err := os.Remove(remove); err != nil {
+			fmt.Fprintf(os.Stderr, "[压缩恢复错误] %s: %v\n", remove, err)
+		}
+	}
+}
+
+// gzipContentSize 解压整个文件并返回解压后的字节数，文件损坏或被截断时返回错误
+func gzipContentSize(path string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	gzReader, err := gzip.NewReader(file)
+	if err != nil {
+		return 0, err
+	}
+	defer gzReader.Close()
+	return io.Copy(io.Discard, gzReader)
+}
+
+// gzipTrailerSize 读取gzip尾部记录的解压后大小（对2^32取模），不解压文件
+func gzipTrailerSize(path string) (uint32, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var trailer [4]byte
+	if _, err := file.Seek(-4, io.SeekEnd); err != nil {
+		return 0, err
+	}
+	if _, err := io.ReadFull(file, trailer[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(trailer[:]), nil
+}
+
+// dedupeCompressedFiles 去掉压缩中断留下的重复文件，避免查询返回重复的条目
+// X.log和X.log.gz同时存在时使用X.log，X.log比压缩文件短（被截断）时使用X.log.gz；压缩临时文件总是被跳过
+func dedupeCompressedFiles(files []string) []string {
+	present := make(map[string]bool, len(files))
+	for _, file := range files {
+		present[file] = true
+	}
+
+	result := files[:0:0]
+	for _, file := range files {
+		switch {
+		case strings.HasSuffix(file, ".gz"+compressTempSuffix):
+			continue
+		case strings.HasSuffix(file, ".gz"):
+			plain := strings.TrimSuffix(file, ".gz")
+			if present[plain] && preferPlainFile(plain, file) {
+				continue
+			}
+		case present[file+".gz"]:
+			if !preferPlainFile(file, file+".gz") {
+				continue
+			}
+		}
+		result = append(result, file)
+	}
+	return result
+}
+
+// preferPlainFile 原文件不短于压缩文件的内容时使用原文件，无法读取压缩文件的大小时也使用原文件
+// gzip尾部的大小对2^32取模，原文件不小于4GiB时无法用它比较，改为解压统计压缩文件内容的完整大小
+func preferPlainFile(plainPath, gzPath string) bool {
+	plain, err := os.Stat(plainPath)
+	if err != nil {
+		return false
+	}
+	if plain.Size() >= 1<<32 {
+		size, err := gzipContentSize(gzPath)
+		return err != nil || plain.Size() >= size
+	}
+	size, err := gzipTrailerSize(gzPath)
+	if err != nil {
+		return true
+	}
+	return uint32(plain.Size()) >= size
+}
+
+// gzipReadCloser 关闭时同时关闭gzip读取器和底层文件
+type gzipReadCloser struct {
+	*gzip.Reader
+	file io.Closer
+}
+
+func (r gzipReadCloser) Close() error {
+	r.Reader.Close()
+	return r.file.Close()
+}
+
+// openLogReader 打开日志文件，.gz文件透明解压
+func openLogReader(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return file, nil
+	}
+	gzReader, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("创建gzip读取器失败: %w", err)
+	}
+	return gzipReadCloser{Reader: gzReader, file: file}, nil
+}
+
+// gzipMagic gzip数据的前两个字节
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// detectGzip 根据前两个字节判断r是否为gzip数据，是则返回解压后的读取器，否则返回原内容
+func detectGzip(r io.Reader) (io.Reader, error) {
+	buffered := bufio.NewReader(r)
+	magic, err := buffered.Peek(len(gzipMagic))
+	if err != nil || !bytes.Equal(magic, gzipMagic) {
+		return buffered, nil // 内容不足两个字节时按普通文本读取
+	}
+	gzReader, err := gzip.NewReader(buffered)
+	if err != nil {
+		return nil, fmt.Errorf("创建gzip读取器失败: %w", err)
+	}
+	return gzReader, nil
+}
+
+// openLogDetect 打开日志文件，按文件内容而不是扩展名判断是否需要解压
+func openLogDetect(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := detectGzip(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{reader, file}, nil
+}
+
+// openLogFrom 打开数据文件并定位到offset
+// 文件已被压缩时改为读取同名的.gz文件，并跳过解压后offset之前的内容
+func openLogFrom(path string, offset int64) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err == nil {
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return file, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	reader, gzErr := openLogReader(path + ".gz")
+	if gzErr != nil {
+		return nil, err // 返回原文件的错误，调用方据此判断文件不存在
+	}
+	if _, err := io.CopyN(io.Discard, reader, offset); err != nil {
+		reader.Close()
+		return nil, fmt.Errorf("定位压缩文件%s失败: %w", filepath.Base(path)+".gz", err)
+	}
+	return reader, nil
+}
@@ -0,0 +1,173 @@
+package aggregate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeCompressionPair 写入lines行日志到plain文件，并把前gzLines行压缩写入同名的.gz文件
+func writeCompressionPair(t *testing.T, plainPath string, plainLines, gzLines int) {
+	t.Helper()
+	content := func(lines int) []byte {
+		var buf bytes.Buffer
+		for i := 0; i < lines; i++ {
+			fmt.Fprintf(&buf, `{"timestamp":"2024-01-15T10:00:00Z","level":"info","trace_id":"trace-dup","msg":"request %d"}`+"\n", i)
+		}
+		return buf.Bytes()
+	}
+	if err := os.WriteFile(plainPath, content(plainLines), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(content(gzLines))
+	if err := gz.Close(); err != nil {
+		t.Fatalf("压缩失败: %v", err)
+	}
+	if err := os.WriteFile(plainPath+".gz", buf.Bytes(), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+}
+
+// assertEachOnce 检查查询结果中request 0到request n-1各出现一次
+func assertEachOnce(t *testing.T, result *LogQueryResult, n int) {
+	t.Helper()
+	seen := make(map[string]int)
+	for _, entry := range result.Entries {
+		seen[entry.Message]++
+	}
+	if result.Total != n || len(seen) != n {
+		t.Fatalf("期望 %d 条不重复的日志，得到 %d 条（%d 条不重复）", n, result.Total, len(seen))
+	}
+	for message, count := range seen {
+		if count != 1 {
+			t.Errorf("%s 出现了 %d 次", message, count)
+		}
+	}
+}
+
+func TestQueryDedupesInterruptedCompression(t *testing.T) {
+	tests := []struct {
+		name       string
+		plainLines int
+		gzLines    int
+	}{
+		{"完整的原文件", 20, 20},
+		{"原文件被截断", 8, 20},
+		{"压缩文件不完整", 20, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeCompressionPair(t, filepath.Join(dir, "svc_2024-01-15_001.log"), tt.plainLines, tt.gzLines)
+			os.WriteFile(filepath.Join(dir, "svc_2024-01-15_002.log.gz.tmp"), []byte("partial"), 0644)
+
+			query := LogQuery{TraceID: "trace-dup", PathPatterns: []string{"*.log*"}, Limit: 100}
+			result, err := QueryLogs(query, dir)
+			if err != nil {
+				t.Fatalf("查询失败: %v", err)
+			}
+			assertEachOnce(t, result, max(tt.plainLines, tt.gzLines))
+			if len(result.ParseErrors) != 0 {
+				t.Errorf("期望跳过压缩临时文件，得到解析错误 %v", result.ParseErrors)
+			}
+
+			aggregation, err := AggregateLogs(query, dir, AggregateOptions{})
+			if err != nil {
+				t.Fatalf("聚合失败: %v", err)
+			}
+			if aggregation.Total != max(tt.plainLines, tt.gzLines) {
+				t.Errorf("期望聚合 %d 条日志，得到 %d", max(tt.plainLines, tt.gzLines), aggregation.Total)
+			}
+		})
+	}
+}
+
+func TestReconcileCompressionOnStartup(t *testing.T) {
+	dir := t.TempDir()
+	finished := filepath.Join(dir, "svc_2024-01-01_001.log")
+	rolledBack := filepath.Join(dir, "svc_2024-01-01_002.log")
+	corrupt := filepath.Join(dir, "svc_2024-01-01_003.log")
+	writeCompressionPair(t, finished, 20, 20)
+	writeCompressionPair(t, rolledBack, 20, 8)
+	writeCompressionPair(t, corrupt, 20, 20)
+	data, _ := os.ReadFile(corrupt + ".gz")
+	os.WriteFile(corrupt+".gz", data[:len(data)/2], 0644)
+	tmp := filepath.Join(dir, "svc_2024-01-01_004.log.gz"+compressTempSuffix)
+	os.WriteFile(tmp, []byte("partial"), 0644)
+
+	aggregator, err := NewLogAggregatorWithOptions(dir, "svc")
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+	want := map[string]bool{
+		finished:           false,
+		finished + ".gz":   true,
+		rolledBack:         true,
+		rolledBack + ".gz": false,
+		corrupt:            true,
+		corrupt + ".gz":    false,
+		tmp:                false,
+	}
+	for path, present := range want {
+		if exists(path) != present {
+			t.Errorf("%s: 期望存在=%v", filepath.Base(path), present)
+		}
+	}
+
+	result, err := QueryLogs(LogQuery{TraceID: "trace-dup", PathPatterns: []string{"*.log*"}, Limit: 100}, dir)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if result.Total != 60 {
+		t.Errorf("期望三个文件共 60 条日志，得到 %d", result.Total)
+	}
+}
+
+func TestCompressFileLeavesNoTempFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "svc_2024-01-01_001.log")
+	writeCompressionPair(t, path, 10, 0)
+	os.Remove(path + ".gz")
+
+	la := &LogAggregator{}
+	if err := la.compressFile(path); err != nil {
+		t.Fatalf("压缩失败: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || entries[0].Name() != "svc_2024-01-01_001.log.gz" {
+		t.Fatalf("期望只留下压缩文件，得到 %v", entries)
+	}
+	if size, err := gzipContentSize(path + ".gz"); err != nil || size == 0 {
+		t.Errorf("压缩文件无效: %d %v", size, err)
+	}
+}
+
+func TestPreferPlainFileOver4GiB(t *testing.T) {
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "svc_2024-01-01_001.log")
+	writeCompressionPair(t, plain, 1, 20)
+
+	// 原文件比压缩文件的内容短
+	if preferPlainFile(plain, plain+".gz") {
+		t.Error("期望原文件被截断时使用压缩文件")
+	}
+
+	// 稀疏文件：4GiB+1字节对2^32取模为1，比压缩文件的内容短，但实际大小更大
+	if err := os.Truncate(plain, 1<<32+1); err != nil {
+		t.Skipf("无法创建4GiB的稀疏文件: %v", err)
+	}
+	if !preferPlainFile(plain, plain+".gz") {
+		t.Error("期望原文件不小于4GiB时比较完整的大小，使用原文件")
+	}
+}
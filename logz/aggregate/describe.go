@@ -0,0 +1,372 @@
+package aggregate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// AggregatorInfo 聚合器元数据，用于排查查询无结果等问题
+type AggregatorInfo struct {
+	OutputDir          string            `json:"output_dir"`
+	ServiceName        string            `json:"service_name,omitempty"`
+	Live               bool              `json:"live"` // 是否来自运行中的聚合器
+	CurrentFileID      string            `json:"current_file_id,omitempty"`
+	CurrentOffset      int64             `json:"current_offset"`
+	LevelFiles         map[string]string `json:"level_files,omitempty"` // 按级别拆分时各级别正在写入的文件ID
+	RetentionDays      int               `json:"retention_days,omitempty"`
+	LevelRetentionDays map[string]int    `json:"level_retention_days,omitempty"` // 单独保留的级别 -> 保留天数
+	Files              []DataFileInfo    `json:"files"`
+	TotalEntries       int               `json:"total_entries"`
+	SchemaVersions     map[int]int       `json:"schema_versions,omitempty"` // 格式版本 -> 条目数，0为没有版本号的条目
+	TotalSize          int64             `json:"total_size"`
+	IndexDBSize        int64             `json:"index_db_size"`
+	IndexBuckets       map[string]int    `json:"index_buckets"`
+	IndexError         string            `json:"index_error,omitempty"` // 压缩后无法重新打开索引数据库时的错误，此时索引停用
+	BatchQueueDepth    int               `json:"batch_queue_depth"`
+	IndexQueueDepth    int               `json:"index_queue_depth"`
+	IndexQueueCapacity int               `json:"index_queue_capacity"`
+	IndexLagEntries    int               `json:"index_lag_entries"`  // 已写入但尚未建立索引的条目数
+	IndexLagDuration   time.Duration     `json:"index_lag_duration"` // 最早的未建立索引条目已等待的时间（纳秒）
+	LastRotation       time.Time         `json:"last_rotation,omitempty"`
+	LastCompression    time.Time         `json:"last_compression,omitempty"`
+}
+
+// DataFileInfo 数据文件信息
+type DataFileInfo struct {
+	FileID     string    `json:"file_id"`
+	Name       string    `json:"name"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mod_time"`
+	Compressed bool      `json:"compressed"`
+	Level      string    `json:"level,omitempty"` // 按级别拆分的文件的级别
+	Current    bool      `json:"current"`
+	Entries    int       `json:"entries"`
+	// SchemaVersions 格式版本 -> 条目数，0为没有版本号的条目，不是JSON对象的行不计入
+	SchemaVersions map[int]int `json:"schema_versions,omitempty"`
+	Error          string      `json:"error,omitempty"` // 统计条目数失败时的错误
+}
+
+// Describe 返回聚合器的元数据，包括数据文件、索引和队列状态
+func (la *LogAggregator) Describe() (AggregatorInfo, error) {
+	info := AggregatorInfo{
+		OutputDir:          la.outputDir,
+		ServiceName:        la.serviceName,
+		Live:               true,
+		IndexQueueDepth:    len(la.indexQueue),
+		IndexQueueCapacity: cap(la.indexQueue),
+	}
+	info.IndexLagEntries, info.IndexLagDuration = la.indexLag.lag(time.Now())
+
+	info.RetentionDays = la.retention.Default
+	info.LevelRetentionDays = maps.Clone(la.retention.Levels)
+
+	current := make(map[string]bool)
+	la.batchMutex.Lock()
+	info.BatchQueueDepth = len(la.batchBuffer)
+	info.LastRotation = la.output.lastRotation
+	la.mutex.RLock()
+	info.CurrentFileID = la.output.fileID
+	info.CurrentOffset = la.output.offset
+	current[la.output.fileID] = true
+	for level, set := range la.levelOutputs {
+		if set.fileID == "" {
+			continue
+		}
+		if info.LevelFiles == nil {
+			info.LevelFiles = make(map[string]string)
+		}
+		info.LevelFiles[level] = set.fileID
+		current[set.fileID] = true
+	}
+	la.mutex.RUnlock()
+	la.batchMutex.Unlock()
+
+	la.compressMutex.Lock()
+	info.LastCompression = la.lastCompression
+	la.compressMutex.Unlock()
+
+	files, err := describeDataFiles(filepath.Join(la.outputDir, la.serviceName+"_*"), current)
+	if err != nil {
+		return info, err
+	}
+	info.setFiles(files)
+
+	la.closeMutex.Lock()
+	closed := la.closed
+	la.closeMutex.Unlock()
+
+	la.indexMutex.RLock()
+	defer la.indexMutex.RUnlock()
+	if !closed && la.indexDB == nil && la.indexErr != nil {
+		info.IndexError = la.indexErr.Error()
+		return info, nil
+	}
+	if closed || la.indexDB == nil {
+		return info, errors.New("聚合器已关闭")
+	}
+
+	if stat, err := os.Stat(la.indexDB.Path()); err == nil {
+		info.IndexDBSize = stat.Size()
+	}
+	info.IndexBuckets, err = countBucketKeys(la.indexDB)
+	if err != nil {
+		return info, err
+	}
+
+	return info, nil
+}
+
+// AggregatorHealth 聚合器队列和索引延迟的快照，不读取数据文件，可以频繁调用
+type AggregatorHealth struct {
+	ServiceName        string        `json:"service_name,omitempty"`
+	Closed             bool          `json:"closed"`
+	CurrentFileID      string        `json:"current_file_id,omitempty"`
+	BatchQueueDepth    int           `json:"batch_queue_depth"`
+	IndexQueueDepth    int           `json:"index_queue_depth"`
+	IndexQueueCapacity int           `json:"index_queue_capacity"`
+	IndexLagEntries    int           `json:"index_lag_entries"`
+	IndexLagDuration   time.Duration `json:"index_lag_duration"`
+
+	// 设置了磁盘空间保护时的磁盘状态
+	DiskStage     string `json:"disk_stage,omitempty"` // ok、low、dropping或full
+	DiskFreeBytes uint64 `json:"disk_free_bytes,omitempty"`
+	DiskDropped   int64  `json:"disk_dropped,omitempty"` // DiskDropping阶段丢弃的条目数
+
+	// 写入文件失败的情况
+	Writes WriteFailureStats `json:"writes"`
+}
+
+// Health 返回聚合器队列和索引延迟的快照
+func (la *LogAggregator) Health() AggregatorHealth {
+	health := AggregatorHealth{
+		ServiceName:        la.serviceName,
+		IndexQueueDepth:    len(la.indexQueue),
+		IndexQueueCapacity: cap(la.indexQueue),
+	}
+	health.IndexLagEntries, health.IndexLagDuration = la.indexLag.lag(time.Now())
+	if la.disk.guard.enabled() {
+		health.DiskStage = la.disk.current().String()
+		health.DiskFreeBytes = la.disk.lastUsage().Free
+		health.DiskDropped = la.disk.dropped.Load()
+	}
+	health.Writes = la.writes.snapshot()
+
+	la.closeMutex.Lock()
+	health.Closed = la.closed
+	la.closeMutex.Unlock()
+
+	la.batchMutex.Lock()
+	health.BatchQueueDepth = len(la.batchBuffer)
+	la.mutex.RLock()
+	health.CurrentFileID = la.output.fileID
+	la.mutex.RUnlock()
+	la.batchMutex.Unlock()
+	return health
+}
+
+// DescribeLogDir 返回日志目录的元数据
+// 如果全局聚合器正在写入该目录则返回其实时信息，否则只读取磁盘上的文件和索引
+func DescribeLogDir(logDir string) (AggregatorInfo, error) {
+	if aggregator := GetGlobalAggregator(); aggregator != nil && aggregator.ownsDir(logDir) {
+		return aggregator.Describe()
+	}
+
+	info := AggregatorInfo{
+		OutputDir:    logDir,
+		IndexBuckets: make(map[string]int),
+	}
+
+	files, err := describeDataFiles(filepath.Join(logDir, "*"), nil)
+	if err != nil {
+		return info, err
+	}
+	info.setFiles(files)
+
+	dbPaths, err := filepath.Glob(filepath.Join(logDir, "index", "*.db"))
+	if err != nil {
+		return info, err
+	}
+	for _, dbPath := range dbPaths {
+		if stat, err := os.Stat(dbPath); err == nil {
+			info.IndexDBSize += stat.Size()
+		}
+
+		db, err := bbolt.Open(dbPath, 0600, &bbolt.Options{ReadOnly: true, Timeout: time.Second})
+		if err != nil {
+			return info, fmt.Errorf("打开索引数据库%s失败: %w", filepath.Base(dbPath), err)
+		}
+		counts, err := countBucketKeys(db)
+		db.Close()
+		if err != nil {
+			return info, err
+		}
+		for name, count := range counts {
+			info.IndexBuckets[name] += count
+		}
+	}
+
+	return info, nil
+}
+
+// setFiles 设置数据文件列表并汇总
+func (info *AggregatorInfo) setFiles(files []DataFileInfo) {
+	info.Files = files
+	for _, file := range files {
+		info.TotalEntries += file.Entries
+		info.TotalSize += file.Size
+		for version, count := range file.SchemaVersions {
+			if info.SchemaVersions == nil {
+				info.SchemaVersions = make(map[int]int)
+			}
+			info.SchemaVersions[version] += count
+		}
+	}
+}
+
+// describeDataFiles 列出匹配的数据文件（.log和.log.gz），按文件名排序，current为正在写入的文件ID
+func describeDataFiles(pattern string, current map[string]bool) ([]DataFileInfo, error) {
+	var paths []string
+	for _, suffix := range []string{".log", ".log.gz"} {
+		matches, err := filepath.Glob(pattern + suffix)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+
+	files := make([]DataFileInfo, 0, len(paths))
+	for _, path := range paths {
+		stat, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		file := DataFileInfo{
+			FileID:     fileIDFromPath(path),
+			Name:       filepath.Base(path),
+			Size:       stat.Size(),
+			ModTime:    stat.ModTime(),
+			Compressed: strings.HasSuffix(path, ".gz"),
+		}
+		file.Level = fileLevel(file.FileID, "")
+		file.Current = current[file.FileID] && !file.Compressed
+
+		entries, versions, err := cachedEntryCount(path, stat)
+		if err != nil {
+			file.Error = err.Error()
+		}
+		file.Entries = entries
+		file.SchemaVersions = versions
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// countBucketKeys 统计每个索引桶中的键数量
+func countBucketKeys(db *bbolt.DB) (map[string]int, error) {
+	counts := make(map[string]int)
+	err := db.View(func(tx *bbolt.Tx) error {
+		return tx.ForEach(func(name []byte, bucket *bbolt.Bucket) error {
+			counts[string(name)] = bucket.Stats().KeyN
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("统计索引桶失败: %w", err)
+	}
+	return counts, nil
+}
+
+// entryCountCacheEntry 文件条目数缓存
+type entryCountCacheEntry struct {
+	size     int64
+	modTime  time.Time
+	entries  int
+	versions map[int]int
+}
+
+// 文件条目数缓存，文件大小或修改时间变化后重新统计
+var entryCountCache = make(map[string]entryCountCacheEntry)
+var entryCountMutex sync.Mutex
+
+// cachedEntryCount 获取文件的条目数和各格式版本的条目数，优先使用缓存，返回的map不能修改
+func cachedEntryCount(path string, stat os.FileInfo) (int, map[int]int, error) {
+	entryCountMutex.Lock()
+	cached, ok := entryCountCache[path]
+	entryCountMutex.Unlock()
+	if ok && cached.size == stat.Size() && cached.modTime.Equal(stat.ModTime()) {
+		return cached.entries, cached.versions, nil
+	}
+
+	entries, versions, err := countEntries(path)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	entryCountMutex.Lock()
+	entryCountCache[path] = entryCountCacheEntry{
+		size:     stat.Size(),
+		modTime:  stat.ModTime(),
+		entries:  entries,
+		versions: versions,
+	}
+	entryCountMutex.Unlock()
+	return entries, versions, nil
+}
+
+// countEntries 统计文件中的非空行数和各格式版本的条目数，支持gzip压缩文件
+func countEntries(path string) (int, map[int]int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, nil, fmt.Errorf("打开文件失败: %w", err)
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gzReader, err := gzip.NewReader(file)
+		if err != nil {
+			return 0, nil, fmt.Errorf("创建gzip读取器失败: %w", err)
+		}
+		defer gzReader.Close()
+		reader = gzReader
+	}
+
+	scanner := NewLineReader(reader)
+	entries := 0
+	var versions map[int]int
+	for scanner.Scan() {
+		if scanner.TooLong() {
+			entries++
+			continue
+		}
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		entries++
+		if version, ok := schemaVersionOf(line); ok {
+			if versions == nil {
+				versions = make(map[int]int)
+			}
+			versions[version]++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return entries, versions, fmt.Errorf("读取文件失败: %w", err)
+	}
+	return entries, versions, nil
+}
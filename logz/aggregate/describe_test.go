@@ -0,0 +1,82 @@
+package aggregate
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDescribeAggregator(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "describe-service", WithBatchSize(1))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+
+	writeEntries := func(start, count int) {
+		for i := start; i < start+count; i++ {
+			entry := LogEntry{
+				Level:   "info",
+				Message: fmt.Sprintf("message %d", i),
+				TraceID: fmt.Sprintf("trace-%d", i),
+			}
+			if err := aggregator.WriteLog(entry); err != nil {
+				t.Fatalf("写入日志失败: %v", err)
+			}
+		}
+	}
+
+	writeEntries(0, 5)
+	firstFileID := aggregator.output.fileID
+	if err := aggregator.Rotate(); err != nil {
+		t.Fatalf("轮转文件失败: %v", err)
+	}
+	writeEntries(5, 3)
+
+	// 等待后台线程写入索引
+	if err := aggregator.Flush(); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+	info, err := aggregator.Describe()
+	if err != nil {
+		t.Fatalf("获取聚合器信息失败: %v", err)
+	}
+
+	if len(info.Files) != 2 {
+		t.Fatalf("期望2个数据文件，得到 %d", len(info.Files))
+	}
+	if info.Files[0].FileID != firstFileID || info.Files[0].Entries != 5 || info.Files[0].Current {
+		t.Errorf("第一个文件信息错误: %+v", info.Files[0])
+	}
+	if info.Files[1].FileID != info.CurrentFileID || info.Files[1].Entries != 3 || !info.Files[1].Current {
+		t.Errorf("当前文件信息错误: %+v", info.Files[1])
+	}
+	if info.TotalEntries != 8 {
+		t.Errorf("期望共8条日志，得到 %d", info.TotalEntries)
+	}
+	if info.CurrentOffset != info.Files[1].Size {
+		t.Errorf("当前偏移量 %d 与文件大小 %d 不一致", info.CurrentOffset, info.Files[1].Size)
+	}
+	if info.IndexBuckets["trace_id"] != 8 {
+		t.Errorf("期望trace_id索引有8个键，得到 %d", info.IndexBuckets["trace_id"])
+	}
+	if info.IndexDBSize == 0 {
+		t.Error("索引数据库大小不应为0")
+	}
+	if info.LastRotation.IsZero() || !info.Live {
+		t.Errorf("期望实时信息包含轮转时间: %+v", info)
+	}
+
+	aggregator.Close()
+
+	dirInfo, err := DescribeLogDir(dir)
+	if err != nil {
+		t.Fatalf("获取目录信息失败: %v", err)
+	}
+	if dirInfo.Live || dirInfo.TotalEntries != 8 || len(dirInfo.Files) != 2 {
+		t.Errorf("目录信息错误: live=%v entries=%d files=%d", dirInfo.Live, dirInfo.TotalEntries, len(dirInfo.Files))
+	}
+	if dirInfo.IndexBuckets["trace_id"] != 8 {
+		t.Errorf("期望trace_id索引有8个键，得到 %d", dirInfo.IndexBuckets["trace_id"])
+	}
+}
@@ -0,0 +1,192 @@
+package aggregate
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultLockStaleTimeout 目录锁的心跳超过此时间未更新时，其他聚合器可以接管
+const DefaultLockStaleTimeout = 30 * time.Second
+
+// WithLockStaleTimeout 设置目录锁的过期时间，持有锁的聚合器每隔三分之一的过期时间更新一次心跳
+// 同一主机上持有者退出后锁立即释放；共享存储上其他主机持有的锁在心跳过期后才能接管
+func WithLockStaleTimeout(d time.Duration) AggregatorOption {
+	return func(o *aggregatorOptions) error {
+		if d <= 0 {
+			return fmt.Errorf("目录锁过期时间必须大于0: %v", d)
+		}
+		o.lockStaleTimeout = d
+		return nil
+	}
+}
+
+// dirLockInfo 写入锁文件的持有者信息
+type dirLockInfo struct {
+	Service   string    `json:"service"`
+	Hostname  string    `json:"hostname"`
+	PID       int       `json:"pid"`
+	Token     string    `json:"token"` // 每次获得锁时随机生成，用于确认锁没有被接管
+	Acquired  time.Time `json:"acquired"`
+	Heartbeat time.Time `json:"heartbeat"`
+}
+
+// dirLock 输出目录中每个服务的锁文件{service}.lock，防止两个聚合器写入同一组文件
+// 锁文件在聚合器运行期间保持flock（支持的平台上），并定期写入心跳，
+// 不支持flock的共享存储（如部分NFS）上依靠心跳判断持有者是否仍在运行
+type dirLock struct {
+	path         string
+	staleTimeout time.Duration
+
+	mutex sync.Mutex
+	file  *os.File
+	info  dirLockInfo
+}
+
+// acquireDirLock 获得输出目录中serviceName的锁，已被其他聚合器持有时返回ErrDirectoryLocked
+func acquireDirLock(dir, serviceName, hostname string, pid int, staleTimeout time.Duration) (*dirLock, error) {
+	path := filepath.Join(dir, serviceName+".lock")
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("打开目录锁失败: %w", err)
+	}
+	if err := lockFile(file); err != nil {
+		holder, _ := readLockInfo(file)
+		file.Close()
+		return nil, lockedError(path, holder)
+	}
+
+	// 获得flock说明同一主机上的持有者已经退出；其他主机的心跳未过期时仍然视为被锁定，
+	// 不支持flock的平台上任何未过期的心跳都视为被锁定
+	now := time.Now()
+	holder, err := readLockInfo(file)
+	if err == nil && holder.Token != "" && now.Sub(holder.Heartbeat) < staleTimeout &&
+		(holder.Hostname != hostname || !flockSupported) {
+		unlockFile(file)
+		file.Close()
+		return nil, lockedError(path, holder)
+	}
+	if err == nil && holder.Token != "" {
+		fmt.Fprintf(os.Stderr, "[目录锁] 接管 %s：之前的持有者 %s (pid %d) 最后心跳于 %s\n",
+			path, holder.Hostname, holder.PID, holder.Heartbeat.Format(time.RFC3339))
+	}
+
+	lock := &dirLock{
+		path:         path,
+		staleTimeout: staleTimeout,
+		file:         file,
+		info: dirLockInfo{
+			Service:   serviceName,
+			Hostname:  hostname,
+			PID:       pid,
+			Token:     newLockToken(),
+			Acquired:  now,
+			Heartbeat: now,
+		},
+	}
+	if err := lock.write(); err != nil {
+		unlockFile(file)
+		file.Close()
+		return nil, err
+	}
+	return lock, nil
+}
+
+// lockedError 返回包含持有者信息的ErrDirectoryLocked
+func lockedError(path string, holder dirLockInfo) error {
+	if holder.Token == "" {
+		return fmt.Errorf("%w: %s", ErrDirectoryLocked, path)
+	}
+	return fmt.Errorf("%w: %s 由 %s (pid %d) 持有，最后心跳于 %s", ErrDirectoryLocked, path,
+		holder.Hostname, holder.PID, holder.Heartbeat.Format(time.RFC3339))
+}
+
+// newLockToken 生成随机的锁令牌
+func newLockToken() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// readLockInfo 读取锁文件中的持有者信息，文件为空时返回零值
+func readLockInfo(file *os.File) (dirLockInfo, error) {
+	var info dirLockInfo
+	data, err := io.ReadAll(io.NewSectionReader(file, 0, 1<<20))
+	if err != nil || len(data) == 0 {
+		return info, err
+	}
+	err = json.Unmarshal(data, &info)
+	return info, err
+}
+
+// write 将持有者信息写入锁文件，调用方需持有mutex或独占lock
+func (l *dirLock) write() error {
+	data, err := json.Marshal(l.info)
+	if err != nil {
+		return err
+	}
+	if err := l.file.Truncate(0); err != nil {
+		return fmt.Errorf("写入目录锁失败: %w", err)
+	}
+	if _, err := l.file.WriteAt(append(data, '\n'), 0); err != nil {
+		return fmt.Errorf("写入目录锁失败: %w", err)
+	}
+	return nil
+}
+
+// heartbeatInterval 更新心跳的间隔
+func (l *dirLock) heartbeatInterval() time.Duration {
+	return max(l.staleTimeout/3, time.Millisecond)
+}
+
+// heartbeat 更新锁文件中的心跳时间，锁已被其他聚合器接管时返回ErrDirectoryLocked
+func (l *dirLock) heartbeat(now time.Time) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	if holder, err := readLockInfo(l.file); err == nil && holder.Token != l.info.Token {
+		return lockedError(l.path, holder)
+	}
+	l.info.Heartbeat = now
+	return l.write()
+}
+
+// release 清空锁文件并释放flock，锁已被接管时不修改锁文件
+// 锁文件不删除，避免其他进程打开旧文件后与新建的锁文件各自获得flock
+func (l *dirLock) release() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file == nil {
+		return
+	}
+	if holder, err := readLockInfo(l.file); err == nil && holder.Token == l.info.Token {
+		l.file.Truncate(0)
+	}
+	unlockFile(l.file)
+	l.file.Close()
+	l.file = nil
+}
+
+// lockHeartbeatTask 定期更新目录锁的心跳，锁被接管时写入警告
+func (la *LogAggregator) lockHeartbeatTask() {
+	ticker := time.NewTicker(la.lock.heartbeatInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			if err := la.lock.heartbeat(now); err != nil {
+				fmt.Fprintf(os.Stderr, "[目录锁] %v\n", err)
+			}
+		case <-la.ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,21 @@
+//go:build linux || darwin || freebsd
+
+package aggregate
+
+import (
+	"os"
+	"syscall"
+)
+
+// flockSupported 当前平台支持flock，同一主机上持有者退出后锁立即释放
+const flockSupported = true
+
+// lockFile 以非阻塞方式获得文件的排他flock
+func lockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+}
+
+// unlockFile 释放文件的flock
+func unlockFile(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
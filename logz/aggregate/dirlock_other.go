@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !freebsd
+
+package aggregate
+
+import "os"
+
+// flockSupported 当前平台不支持flock（如Windows、OpenBSD），只依靠锁文件中的心跳判断持有者是否仍在运行
+const flockSupported = false
+
+// lockFile 当前平台不支持flock，总是成功
+func lockFile(file *os.File) error {
+	return nil
+}
+
+// unlockFile 当前平台不支持flock
+func unlockFile(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,114 @@
+package aggregate
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDirectoryLock(t *testing.T) {
+	dir := t.TempDir()
+	first, err := NewLogAggregatorWithOptions(dir, "locked")
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+
+	// 同一目录和服务名的第二个聚合器立即失败，不等待索引数据库的超时
+	start := time.Now()
+	if _, err := NewLogAggregatorWithOptions(dir, "locked"); !errors.Is(err, ErrDirectoryLocked) {
+		t.Fatalf("期望ErrDirectoryLocked，得到 %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("期望立即失败，耗时 %v", elapsed)
+	}
+	if ErrorCode(ErrDirectoryLocked) != CodeDirectoryLocked {
+		t.Errorf("期望错误码 %s，得到 %s", CodeDirectoryLocked, ErrorCode(ErrDirectoryLocked))
+	}
+
+	// 其他服务名使用各自的锁文件
+	other, err := NewLogAggregatorWithOptions(dir, "other")
+	if err != nil {
+		t.Fatalf("期望其他服务可以使用同一目录，得到 %v", err)
+	}
+	other.Close()
+
+	// 关闭后锁被释放
+	if err := first.Close(); err != nil {
+		t.Fatalf("关闭聚合器失败: %v", err)
+	}
+	second, err := NewLogAggregatorWithOptions(dir, "locked")
+	if err != nil {
+		t.Fatalf("期望关闭后可以重新打开，得到 %v", err)
+	}
+	second.Close()
+}
+
+func TestDirectoryLockStaleTakeover(t *testing.T) {
+	dir := t.TempDir()
+	writeLock := func(heartbeat time.Time) {
+		data, _ := json.Marshal(dirLockInfo{Service: "stale", Hostname: "other-host", PID: 42, Token: "remote", Heartbeat: heartbeat})
+		if err := os.WriteFile(filepath.Join(dir, "stale.lock"), data, 0644); err != nil {
+			t.Fatalf("写入锁文件失败: %v", err)
+		}
+	}
+
+	// 其他主机的心跳未过期时视为被锁定
+	writeLock(time.Now())
+	if _, err := NewLogAggregatorWithOptions(dir, "stale", WithLockStaleTimeout(time.Minute)); !errors.Is(err, ErrDirectoryLocked) {
+		t.Fatalf("期望其他主机持有的锁未过期时失败，得到 %v", err)
+	}
+
+	// 心跳过期后接管，并写入自己的心跳
+	writeLock(time.Now().Add(-2 * time.Minute))
+	aggregator, err := NewLogAggregatorWithOptions(dir, "stale", WithLockStaleTimeout(time.Minute))
+	if err != nil {
+		t.Fatalf("期望接管过期的锁，得到 %v", err)
+	}
+	defer aggregator.Close()
+	data, _ := os.ReadFile(filepath.Join(dir, "stale.lock"))
+	var info dirLockInfo
+	if err := json.Unmarshal(data, &info); err != nil || info.Token == "remote" || info.PID != os.Getpid() {
+		t.Errorf("期望锁文件记录新的持有者，得到 %s", data)
+	}
+
+	if _, err := applyAggregatorOptions([]AggregatorOption{WithLockStaleTimeout(0)}); err == nil {
+		t.Error("期望拒绝不大于0的过期时间")
+	}
+}
+
+func TestSetGlobalAggregatorClosesPrevious(t *testing.T) {
+	first, err := NewMemoryAggregator("first")
+	if err != nil {
+		t.Fatalf("创建内存聚合器失败: %v", err)
+	}
+	second, err := NewMemoryAggregator("second")
+	if err != nil {
+		t.Fatalf("创建内存聚合器失败: %v", err)
+	}
+	defer second.Close()
+	prev := swapGlobalAggregator(first)
+	defer swapGlobalAggregator(prev)
+
+	// 设置同一个聚合器不关闭它
+	SetGlobalAggregator(first)
+	if err := first.WriteLog(LogEntry{Level: "info", Message: "still open"}); err != nil {
+		t.Fatalf("期望重复设置不关闭聚合器，得到 %v", err)
+	}
+
+	SetGlobalAggregator(second)
+	if GlobalAggregator() != second {
+		t.Fatal("期望全局聚合器被替换")
+	}
+	if err := first.WriteLog(LogEntry{Level: "info", Message: "closed"}); err == nil {
+		t.Error("期望被替换的聚合器已关闭")
+	}
+
+	// 清除全局聚合器不关闭它
+	SetGlobalAggregator(nil)
+	if err := second.WriteLog(LogEntry{Level: "info", Message: "still open"}); err != nil {
+		t.Errorf("期望清除不关闭聚合器，得到 %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// DefaultPathPatterns 未指定匹配模式时查找的日志文件
+var DefaultPathPatterns = []string{"*.log"}
+
+// DefaultMaxDepth 递归查找日志文件时的默认最大目录深度
+const DefaultMaxDepth = 8
+
+// ErrPathOutsideRoot 路径解析后不在日志根目录内
+var ErrPathOutsideRoot = errors.New("路径超出日志目录")
+
+// DiscoverOptions 日志文件查找选项
+type DiscoverOptions struct {
+	Patterns  []string // 文件名匹配模式（filepath.Match语法），含路径分隔符的模式匹配相对路径
+	Recursive bool     // 是否查找子目录
+	MaxDepth  int      // 递归时的最大目录深度，<=0时使用DefaultMaxDepth
+	Subdirs   []string // 不递归时也查找的子目录（相对logDir，如"received"），不包括其下的子目录
+}
+
+// DiscoverOptions 根据查询条件构造查找选项，与文件扫描查询使用的选项相同
+func (q LogQuery) DiscoverOptions() DiscoverOptions {
+	return DiscoverOptions{Patterns: q.PathPatterns, Recursive: q.Recursive, Subdirs: q.Subdirs}
+}
+
+// DiscoverLogFiles 在logDir中查找匹配的日志文件，返回排序后的完整路径
+// 不会进入指向目录的符号链接，指向logDir之外的文件符号链接会被跳过
+func DiscoverLogFiles(logDir string, opts DiscoverOptions) ([]string, error) {
+	patterns := opts.Patterns
+	if len(patterns) == 0 {
+		patterns = DefaultPathPatterns
+	}
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("无效的文件匹配模式 %q: %w", pattern, err)
+		}
+	}
+	maxDepth := opts.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+
+	root, err := filepath.EvalSymlinks(logDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("解析日志目录失败: %w", err)
+	}
+
+	var files []string
+	// 从解析后的根目录开始遍历，logDir本身可以是符号链接
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil // 跳过无法访问的子目录
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+
+		if d.IsDir() {
+			if rel == "." {
+				return nil
+			}
+			if opts.Recursive && pathDepth(rel) <= maxDepth {
+				return nil
+			}
+			if !opts.Recursive && slices.Contains(opts.Subdirs, filepath.ToSlash(rel)) {
+				return nil
+			}
+			return filepath.SkipDir
+		}
+
+		if !matchesAnyPattern(rel, patterns) {
+			return nil
+		}
+
+		if d.Type()&fs.ModeSymlink != 0 {
+			target, err := filepath.EvalSymlinks(path)
+			if err != nil || !isWithinRoot(root, target) {
+				return nil
+			}
+			if info, err := os.Stat(target); err != nil || !info.Mode().IsRegular() {
+				return nil
+			}
+		} else if !d.Type().IsRegular() {
+			return nil
+		}
+
+		files = append(files, filepath.Join(logDir, rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("查找日志文件失败: %w", err)
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// ResolveLogPath 将相对路径解析为logDir内的完整路径
+// 拒绝绝对路径、包含".."的路径，以及通过符号链接指向logDir之外的路径
+func ResolveLogPath(logDir, rel string) (string, error) {
+	if rel == "" {
+		return "", fmt.Errorf("文件名不能为空")
+	}
+	rel = filepath.FromSlash(rel)
+	if filepath.IsAbs(rel) || strings.HasPrefix(rel, `\`) {
+		return "", ErrPathOutsideRoot
+	}
+
+	cleaned := filepath.Clean(rel)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", ErrPathOutsideRoot
+	}
+	path := filepath.Join(logDir, cleaned)
+
+	// 文件不存在时无法解析符号链接，只检查其所在目录
+	root, err := filepath.EvalSymlinks(logDir)
+	if err != nil {
+		return "", fmt.Errorf("解析日志目录失败: %w", err)
+	}
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		dir, dirErr := filepath.EvalSymlinks(filepath.Dir(path))
+		if dirErr != nil {
+			return path, nil
+		}
+		target = filepath.Join(dir, filepath.Base(path))
+	}
+	if !isWithinRoot(root, target) {
+		return "", ErrPathOutsideRoot
+	}
+	return path, nil
+}
+
+// RelativeLogPath 返回日志文件相对于logDir的路径（使用"/"分隔）
+func RelativeLogPath(logDir, path string) string {
+	rel, err := filepath.Rel(logDir, path)
+	if err != nil {
+		return filepath.Base(path)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// matchesAnyPattern 检查相对路径是否匹配任一模式
+func matchesAnyPattern(rel string, patterns []string) bool {
+	name := filepath.Base(rel)
+	for _, pattern := range patterns {
+		target := name
+		if strings.ContainsAny(pattern, `/\`) {
+			target = filepath.ToSlash(rel)
+			pattern = filepath.ToSlash(pattern)
+		}
+		if ok, _ := filepath.Match(pattern, target); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pathDepth 返回相对路径的目录深度，logDir的直接子目录深度为1
+func pathDepth(rel string) int {
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// isWithinRoot 检查已解析的路径是否位于root内
+func isWithinRoot(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
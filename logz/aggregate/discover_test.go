@@ -0,0 +1,141 @@
+package aggregate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// newDiscoverTree 创建嵌套的日志目录和一个日志目录之外的文件
+//
+//	root/a.log
+//	root/b.jsonl
+//	root/svc1/c.log
+//	root/svc1/deep/d.log
+//	root/escape.log -> outside/secret.log
+//	root/linkdir -> outside
+func newDiscoverTree(t *testing.T) (root, outside string) {
+	t.Helper()
+	base := t.TempDir()
+	root = filepath.Join(base, "logs")
+	outside = filepath.Join(base, "outside")
+
+	line := []byte(`{"timestamp":"2024-01-15T10:30:00Z","level":"info","msg":"hello"}` + "\n")
+	for _, name := range []string{"a.log", "b.jsonl", "svc1/c.log", "svc1/deep/d.log"} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("创建目录失败: %v", err)
+		}
+		if err := os.WriteFile(path, line, 0644); err != nil {
+			t.Fatalf("创建文件失败: %v", err)
+		}
+	}
+	if err := os.MkdirAll(outside, 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret.log"), line, 0644); err != nil {
+		t.Fatalf("创建文件失败: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "secret.log"), filepath.Join(root, "escape.log")); err != nil {
+		t.Skipf("不支持符号链接: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "linkdir")); err != nil {
+		t.Skipf("不支持符号链接: %v", err)
+	}
+	return root, outside
+}
+
+func relPaths(root string, files []string) []string {
+	var result []string
+	for _, file := range files {
+		result = append(result, RelativeLogPath(root, file))
+	}
+	return result
+}
+
+func TestDiscoverLogFiles(t *testing.T) {
+	root, _ := newDiscoverTree(t)
+
+	tests := []struct {
+		name string
+		opts DiscoverOptions
+		want []string
+	}{
+		{"默认只查找顶层", DiscoverOptions{}, []string{"a.log"}},
+		{"递归", DiscoverOptions{Recursive: true}, []string{"a.log", "svc1/c.log", "svc1/deep/d.log"}},
+		{"深度限制", DiscoverOptions{Recursive: true, MaxDepth: 1}, []string{"a.log", "svc1/c.log"}},
+		{"多个模式", DiscoverOptions{Patterns: []string{"*.log", "*.jsonl"}}, []string{"a.log", "b.jsonl"}},
+		{"相对路径模式", DiscoverOptions{Patterns: []string{"svc1/*.log"}, Recursive: true}, []string{"svc1/c.log"}},
+		{"指定子目录", DiscoverOptions{Subdirs: []string{"svc1"}}, []string{"a.log", "svc1/c.log"}},
+		{"子目录符号链接", DiscoverOptions{Subdirs: []string{"linkdir"}}, []string{"a.log"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := DiscoverLogFiles(root, tt.opts)
+			if err != nil {
+				t.Fatalf("查找日志文件失败: %v", err)
+			}
+			if got := relPaths(root, files); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("期望 %v，得到 %v", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := DiscoverLogFiles(root, DiscoverOptions{Patterns: []string{"["}}); err == nil {
+		t.Error("期望无效的匹配模式返回错误")
+	}
+}
+
+func TestResolveLogPath(t *testing.T) {
+	root, _ := newDiscoverTree(t)
+
+	valid := []string{"a.log", "svc1/c.log", "svc1/../a.log", "./svc1/deep/d.log", "svc1/new.log"}
+	for _, rel := range valid {
+		path, err := ResolveLogPath(root, rel)
+		if err != nil {
+			t.Errorf("ResolveLogPath(%q) 返回错误: %v", rel, err)
+			continue
+		}
+		if want := filepath.Join(root, filepath.Clean(rel)); path != want {
+			t.Errorf("ResolveLogPath(%q) 期望 %q，得到 %q", rel, want, path)
+		}
+	}
+
+	invalid := []string{"../outside/secret.log", "svc1/../../outside/secret.log", "/etc/passwd", "escape.log", "linkdir/secret.log", ".."}
+	for _, rel := range invalid {
+		if _, err := ResolveLogPath(root, rel); !errors.Is(err, ErrPathOutsideRoot) {
+			t.Errorf("ResolveLogPath(%q) 期望 ErrPathOutsideRoot，得到 %v", rel, err)
+		}
+	}
+}
+
+func TestQueryLogsRecursive(t *testing.T) {
+	root, _ := newDiscoverTree(t)
+
+	result, err := QueryLogs(LogQuery{Limit: 100}, root)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if result.Total != 1 {
+		t.Errorf("期望顶层1条日志，得到 %d", result.Total)
+	}
+
+	result, err = QueryLogs(LogQuery{Limit: 100, Recursive: true, PathPatterns: []string{"*.log", "*.jsonl"}}, root)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if result.Total != 4 {
+		t.Errorf("期望递归查询到4条日志（不包括目录外的文件），得到 %d", result.Total)
+	}
+
+	stats, err := GetLogStatsWithOptions(root, DiscoverOptions{Recursive: true})
+	if err != nil {
+		t.Fatalf("获取统计失败: %v", err)
+	}
+	if stats["total_files"] != 3 {
+		t.Errorf("期望3个日志文件，得到 %v", stats["total_files"])
+	}
+}
@@ -0,0 +1,260 @@
+package aggregate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/HsiaoL1/trace"
+	"github.com/HsiaoL1/trace/logz"
+	"github.com/sirupsen/logrus"
+)
+
+// 磁盘空间检查的默认值
+const (
+	DefaultDiskCheckInterval = time.Minute
+	diskAlertTimeout         = 10 * time.Second
+)
+
+// DiskStage 输出目录所在磁盘的空间阶段，空间越少阶段越高
+type DiskStage int32
+
+// 磁盘空间阶段，阈值见DiskGuard
+const (
+	DiskOK       DiskStage = iota // 空间充足
+	DiskLow                       // 低于阈值，已进行紧急清理和压缩
+	DiskDropping                  // 低于阈值的1/2，丢弃trace、debug和info级别的条目
+	DiskFull                      // 低于阈值的1/4，拒绝所有写入并返回ErrDiskFull
+)
+
+// String 返回阶段名称
+func (s DiskStage) String() string {
+	switch s {
+	case DiskOK:
+		return "ok"
+	case DiskLow:
+		return "low"
+	case DiskDropping:
+		return "dropping"
+	case DiskFull:
+		return "full"
+	}
+	return fmt.Sprintf("DiskStage(%d)", int32(s))
+}
+
+// MarshalText 以阶段名称序列化
+func (s DiskStage) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText 解析阶段名称
+func (s *DiskStage) UnmarshalText(text []byte) error {
+	for stage := DiskOK; stage <= DiskFull; stage++ {
+		if stage.String() == string(text) {
+			*s = stage
+			return nil
+		}
+	}
+	return fmt.Errorf("未知的磁盘空间阶段: %q", text)
+}
+
+// DiskUsage 磁盘空间（字节）
+type DiskUsage struct {
+	Free  uint64 `json:"free"` // 非特权用户可用的空间
+	Total uint64 `json:"total"`
+}
+
+// DiskGuard 磁盘空间保护配置
+// 可用空间低于阈值时进入DiskLow并立即压缩所有非当前文件、清理过期文件；
+// 低于阈值的1/2时进入DiskDropping，低于1/4时进入DiskFull
+type DiskGuard struct {
+	MinFreeBytes   uint64        // 可用空间阈值（字节）
+	MinFreePercent float64       // 可用空间占总空间的百分比阈值，与MinFreeBytes同时设置时取较大的阈值
+	CheckInterval  time.Duration // 检查间隔，默认1分钟
+	EmailAlert     bool          // 进入和退出各阶段时发送邮件通知（受邮件限流影响）
+	WebhookURL     string        // 进入和退出各阶段时POST DiskAlert
+}
+
+// enabled 是否设置了阈值
+func (g DiskGuard) enabled() bool {
+	return g.MinFreeBytes > 0 || g.MinFreePercent > 0
+}
+
+// threshold 返回可用空间阈值
+func (g DiskGuard) threshold(usage DiskUsage) uint64 {
+	return max(g.MinFreeBytes, uint64(float64(usage.Total)*g.MinFreePercent/100))
+}
+
+// stage 返回可用空间对应的阶段
+func (g DiskGuard) stage(usage DiskUsage) DiskStage {
+	threshold := g.threshold(usage)
+	switch {
+	case usage.Free >= threshold:
+		return DiskOK
+	case usage.Free >= threshold/2:
+		return DiskLow
+	case usage.Free >= threshold/4:
+		return DiskDropping
+	}
+	return DiskFull
+}
+
+// DiskAlert 磁盘空间阶段变化时发送到WebhookURL的内容
+type DiskAlert struct {
+	Service        string    `json:"service"`
+	OutputDir      string    `json:"output_dir"`
+	Stage          DiskStage `json:"stage"`
+	Previous       DiskStage `json:"previous"`
+	FreeBytes      uint64    `json:"free_bytes"`
+	TotalBytes     uint64    `json:"total_bytes"`
+	ThresholdBytes uint64    `json:"threshold_bytes"`
+	Dropped        int64     `json:"dropped"` // 累计丢弃的条目数
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// droppableLevels DiskDropping阶段丢弃的级别
+var droppableLevels = []string{"trace", "debug", "info"}
+
+// diskWatcher 聚合器的磁盘空间状态，未设置阈值时stage始终为DiskOK
+type diskWatcher struct {
+	guard   DiskGuard
+	stat    func(path string) (DiskUsage, error)
+	stage   atomic.Int32
+	dropped atomic.Int64
+
+	checkMutex sync.Mutex // 保证同一时间只有一次检查
+	mu         sync.Mutex
+	usage      DiskUsage // 最近一次检查的结果
+}
+
+// current 返回当前阶段
+func (d *diskWatcher) current() DiskStage {
+	return DiskStage(d.stage.Load())
+}
+
+// admit 检查当前阶段是否允许写入canonical级别的条目
+// DiskDropping阶段丢弃的条目返回false并计数，DiskFull阶段返回ErrDiskFull
+func (d *diskWatcher) admit(level string) (bool, error) {
+	switch d.current() {
+	case DiskFull:
+		return false, ErrDiskFull
+	case DiskDropping:
+		if isLevelIn(level, droppableLevels) {
+			d.dropped.Add(1)
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// lastUsage 返回最近一次检查的磁盘空间
+func (d *diskWatcher) lastUsage() DiskUsage {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.usage
+}
+
+// checkDisk 检查输出目录所在磁盘的可用空间并更新阶段
+// 阶段升高时先进行紧急压缩和清理，再按清理后的空间确定阶段
+func (la *LogAggregator) checkDisk() {
+	la.disk.checkMutex.Lock()
+	defer la.disk.checkMutex.Unlock()
+
+	usage, err := la.disk.stat(la.outputDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[磁盘检查错误] %v\n", err)
+		return
+	}
+
+	previous := la.disk.current()
+	stage := la.disk.guard.stage(usage)
+	if stage > previous && stage >= DiskLow {
+		la.emergencyCleanup()
+		if after, err := la.disk.stat(la.outputDir); err == nil {
+			usage, stage = after, la.disk.guard.stage(after)
+		}
+	}
+
+	la.disk.mu.Lock()
+	la.disk.usage = usage
+	la.disk.mu.Unlock()
+	la.disk.stage.Store(int32(stage))
+	if stage != previous {
+		la.alertDiskStage(previous, stage, usage)
+	}
+}
+
+// emergencyCleanup 压缩所有非当前文件并清理过期文件
+func (la *LogAggregator) emergencyCleanup() {
+	la.compressFilesBefore(time.Now())
+	if err := la.cleanupOldFiles(); err != nil {
+		fmt.Fprintf(os.Stderr, "[清理错误] %v\n", err)
+	}
+}
+
+// alertDiskStage 输出error级别日志，并按配置发送邮件和webhook
+func (la *LogAggregator) alertDiskStage(previous, stage DiskStage, usage DiskUsage) {
+	alert := DiskAlert{
+		Service:        la.serviceName,
+		OutputDir:      la.outputDir,
+		Stage:          stage,
+		Previous:       previous,
+		FreeBytes:      usage.Free,
+		TotalBytes:     usage.Total,
+		ThresholdBytes: la.disk.guard.threshold(usage),
+		Dropped:        la.disk.dropped.Load(),
+		Timestamp:      time.Now(),
+	}
+
+	action := fmt.Sprintf("退出%s阶段", previous)
+	if stage > previous {
+		action = fmt.Sprintf("进入%s阶段", stage)
+	}
+	message := fmt.Sprintf("[磁盘空间] %s %s，可用 %d/%d 字节，阈值 %d 字节", la.outputDir, action, usage.Free, usage.Total, alert.ThresholdBytes)
+	logz.WithFields(logrus.Fields{
+		"service":    la.serviceName,
+		"disk_stage": stage.String(),
+		"dropped":    alert.Dropped,
+	}).Error(message)
+
+	if la.disk.guard.EmailAlert {
+		logz.NotifyEmail(logz.LevelError, message, "", "")
+	}
+	if la.disk.guard.WebhookURL != "" {
+		go func() {
+			if err := la.postDiskAlert(alert); err != nil {
+				fmt.Fprintf(os.Stderr, "[磁盘告警webhook失败] %v\n", err)
+			}
+		}()
+	}
+}
+
+// postDiskAlert 将告警POST到WebhookURL
+func (la *LogAggregator) postDiskAlert(alert DiskAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), diskAlertTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", la.disk.guard.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := trace.NewTracedHTTPClient(diskAlertTimeout).Do(ctx, req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook返回 %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package aggregate
+
+import "errors"
+
+// statDisk 当前平台不支持检查磁盘空间（如Windows、OpenBSD），设置DiskGuard时阶段保持DiskOK
+func statDisk(path string) (DiskUsage, error) {
+	return DiskUsage{}, errors.New("当前平台不支持检查磁盘空间")
+}
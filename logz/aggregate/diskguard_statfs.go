@@ -0,0 +1,17 @@
+//go:build linux || darwin || freebsd
+
+package aggregate
+
+import "syscall"
+
+// statDisk 返回path所在文件系统的可用空间和总空间
+func statDisk(path string) (DiskUsage, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return DiskUsage{}, err
+	}
+	return DiskUsage{
+		Free:  uint64(stat.Bavail) * uint64(stat.Bsize),
+		Total: uint64(stat.Blocks) * uint64(stat.Bsize),
+	}, nil
+}
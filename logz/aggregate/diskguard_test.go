@@ -0,0 +1,157 @@
+package aggregate
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeDisk 可调整可用空间的磁盘，总空间为10000字节
+type fakeDisk struct {
+	free atomic.Uint64
+}
+
+// option 替换聚合器检查磁盘空间的函数
+func (d *fakeDisk) option() AggregatorOption {
+	return func(o *aggregatorOptions) error {
+		o.statDisk = func(string) (DiskUsage, error) {
+			return DiskUsage{Free: d.free.Load(), Total: 10000}, nil
+		}
+		return nil
+	}
+}
+
+func TestDiskGuardStage(t *testing.T) {
+	tests := []struct {
+		guard DiskGuard
+		free  uint64
+		want  DiskStage
+	}{
+		{DiskGuard{MinFreeBytes: 1000}, 1000, DiskOK},
+		{DiskGuard{MinFreeBytes: 1000}, 999, DiskLow},
+		{DiskGuard{MinFreeBytes: 1000}, 499, DiskDropping},
+		{DiskGuard{MinFreeBytes: 1000}, 249, DiskFull},
+		{DiskGuard{MinFreePercent: 20}, 1500, DiskLow},
+		// 两个阈值都设置时取较大的
+		{DiskGuard{MinFreeBytes: 100, MinFreePercent: 20}, 900, DiskDropping},
+	}
+	for _, tt := range tests {
+		if got := tt.guard.stage(DiskUsage{Free: tt.free, Total: 10000}); got != tt.want {
+			t.Errorf("%+v 可用 %d: 期望 %s，得到 %s", tt.guard, tt.free, tt.want, got)
+		}
+	}
+
+	for _, guard := range []DiskGuard{{}, {MinFreePercent: 150}, {MinFreeBytes: 1, CheckInterval: -time.Second}} {
+		if _, err := applyAggregatorOptions([]AggregatorOption{WithDiskGuard(guard)}); err == nil {
+			t.Errorf("%+v: 期望返回错误", guard)
+		}
+	}
+}
+
+func TestDiskGuardEscalation(t *testing.T) {
+	alerts := make(chan DiskAlert, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert DiskAlert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+			t.Errorf("解析告警失败: %v", err)
+		}
+		alerts <- alert
+	}))
+	defer server.Close()
+	waitAlert := func(previous, stage DiskStage) {
+		t.Helper()
+		select {
+		case alert := <-alerts:
+			if alert.Previous != previous || alert.Stage != stage || alert.Service != "disk" {
+				t.Errorf("期望告警 %s -> %s，得到 %+v", previous, stage, alert)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("等待告警 %s -> %s 超时", previous, stage)
+		}
+	}
+
+	dir := t.TempDir()
+	today := time.Now().Format("2006-01-02")
+	oldFile := filepath.Join(dir, "disk_"+today+"_900.log")
+	expiredFile := filepath.Join(dir, "disk_"+today+"_901.log")
+	writeBackdatedFile(t, oldFile, `{"level":"info","message":"old"}`+"\n", 1)
+	writeBackdatedFile(t, expiredFile, `{"level":"info","message":"expired"}`+"\n", 30)
+
+	disk := &fakeDisk{}
+	disk.free.Store(5000)
+	aggregator, err := NewLogAggregatorWithOptions(dir, "disk", WithBatchSize(1), disk.option(),
+		WithDiskGuard(DiskGuard{MinFreeBytes: 1000, CheckInterval: time.Hour, WebhookURL: server.URL}))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+
+	aggregator.checkDisk()
+	if health := aggregator.Health(); health.DiskStage != "ok" || health.DiskFreeBytes != 5000 {
+		t.Errorf("期望空间充足，得到 %s %d", health.DiskStage, health.DiskFreeBytes)
+	}
+
+	// 低于阈值：紧急压缩和清理
+	disk.free.Store(800)
+	aggregator.checkDisk()
+	waitAlert(DiskOK, DiskLow)
+	if _, err := os.Stat(oldFile + ".gz"); err != nil {
+		t.Errorf("期望压缩非当前文件: %v", err)
+	}
+	if _, err := os.Stat(expiredFile); !os.IsNotExist(err) {
+		t.Errorf("期望删除过期文件，得到 %v", err)
+	}
+	if err := aggregator.WriteLog(LogEntry{Level: "info", Message: "low"}); err != nil {
+		t.Errorf("低空间阶段期望正常写入，得到 %v", err)
+	}
+
+	// 低于阈值的1/2：丢弃debug和info
+	disk.free.Store(400)
+	aggregator.checkDisk()
+	waitAlert(DiskLow, DiskDropping)
+	for _, level := range []string{"debug", "INFO", "error"} {
+		if err := aggregator.WriteLog(LogEntry{Level: level, Message: "dropping " + level}); err != nil {
+			t.Errorf("%s: 期望不返回错误，得到 %v", level, err)
+		}
+	}
+	if health := aggregator.Health(); health.DiskStage != "dropping" || health.DiskDropped != 2 {
+		t.Errorf("期望丢弃 2 条，得到 %s %d", health.DiskStage, health.DiskDropped)
+	}
+
+	// 低于阈值的1/4：拒绝所有写入
+	disk.free.Store(100)
+	aggregator.checkDisk()
+	waitAlert(DiskDropping, DiskFull)
+	if err := aggregator.WriteLog(LogEntry{Level: "fatal", Message: "full"}); !errors.Is(err, ErrDiskFull) {
+		t.Errorf("期望 ErrDiskFull，得到 %v", err)
+	}
+
+	// 空间恢复后正常写入
+	disk.free.Store(5000)
+	aggregator.checkDisk()
+	waitAlert(DiskFull, DiskOK)
+	if err := aggregator.WriteLog(LogEntry{Level: "debug", Message: "recovered"}); err != nil {
+		t.Errorf("期望恢复写入，得到 %v", err)
+	}
+
+	waitIndexed(t, aggregator)
+	result, err := QueryLogs(LogQuery{Limit: 100}, dir)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	written := make(map[string]bool)
+	for _, entry := range result.Entries {
+		written[entry.Message] = true
+	}
+	for message, want := range map[string]bool{"low": true, "dropping debug": false, "dropping INFO": false, "dropping error": true, "full": false, "recovered": true} {
+		if written[message] != want {
+			t.Errorf("%s: 期望写入=%v", message, want)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package aggregate
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+)
+
+// entryEncoder 手写的LogEntry序列化器，输出与json.Marshal逐字节一致
+// 写入热路径上用它代替json.Marshal，避免反射和每条日志的临时分配
+type entryEncoder struct {
+	buf  []byte
+	keys []string
+}
+
+// 编码器池，超过该大小的缓冲区不放回池中，避免长期占用内存
+const maxPooledEncoderBuffer = 4 << 20
+
+var entryEncoderPool = sync.Pool{
+	New: func() any {
+		return &entryEncoder{buf: make([]byte, 0, 32*1024)}
+	},
+}
+
+// getEntryEncoder 从池中获取编码器
+func getEntryEncoder() *entryEncoder {
+	enc := entryEncoderPool.Get().(*entryEncoder)
+	enc.buf = enc.buf[:0]
+	return enc
+}
+
+// putEntryEncoder 将编码器放回池中
+func putEntryEncoder(enc *entryEncoder) {
+	if cap(enc.buf) > maxPooledEncoderBuffer {
+		return
+	}
+	entryEncoderPool.Put(enc)
+}
+
+// appendEntry 追加一条日志的JSON编码，字段顺序和omitempty规则与LogEntry的json标签一致
+func (enc *entryEncoder) appendEntry(entry *LogEntry) error {
+	b := enc.buf
+	b = append(b, `{"timestamp":`...)
+	b = appendJSONString(b, entry.Timestamp)
+	b = append(b, `,"level":`...)
+	b = appendJSONString(b, entry.Level)
+	b = append(b, `,"msg":`...)
+	b = appendJSONString(b, entry.Message)
+	b = appendOptionalString(b, `,"trace_id":`, entry.TraceID)
+	b = appendOptionalString(b, `,"span_id":`, entry.SpanID)
+	b = appendOptionalString(b, `,"caller":`, entry.Caller)
+
+	if len(entry.Fields) > 0 {
+		b = append(b, `,"fields":`...)
+		var err error
+		if b, err = enc.appendFields(b, entry.Fields); err != nil {
+			return err
+		}
+	}
+
+	b = appendOptionalString(b, `,"service":`, entry.Service)
+	b = appendOptionalString(b, `,"hostname":`, entry.Hostname)
+	if entry.PID != 0 {
+		b = append(b, `,"pid":`...)
+		b = strconv.AppendInt(b, int64(entry.PID), 10)
+	}
+	b = appendOptionalString(b, `,"file":`, entry.File)
+	b = appendOptionalString(b, `,"file_id":`, entry.FileID)
+	if entry.Offset != 0 {
+		b = append(b, `,"offset":`...)
+		b = strconv.AppendInt(b, entry.Offset, 10)
+	}
+	if entry.Truncated {
+		b = append(b, `,"truncated":true`...)
+	}
+	if entry.FieldsDropped != 0 {
+		b = append(b, `,"fields_dropped":`...)
+		b = strconv.AppendInt(b, int64(entry.FieldsDropped), 10)
+	}
+	if entry.SchemaVersion != 0 {
+		b = append(b, `,"schema_version":`...)
+		b = strconv.AppendInt(b, int64(entry.SchemaVersion), 10)
+	}
+	if entry.Seq != 0 {
+		b = append(b, `,"seq":`...)
+		b = strconv.AppendUint(b, entry.Seq, 10)
+	}
+	if len(entry.Extra) > 0 {
+		var err error
+		for _, key := range entry.extraKeys() {
+			if b, err = appendExtraField(b, key, entry.Extra[key]); err != nil {
+				return err
+			}
+		}
+	}
+	enc.buf = append(b, '}')
+	return nil
+}
+
+// 截断后的内容以该后缀结尾
+const truncatedSuffix = "...(truncated)"
+
+// maxTruncatedField 截断的字段值保留的最大字节数
+const maxTruncatedField = 256
+
+// appendTruncated 追加序列化后超过limit字节的条目：先截断消息（至少保留开头的maxTruncatedField字节），
+// 再将编码后最长的字段值依次替换为截断的字符串，仍然超过时去掉所有字段并继续截断消息
+// entry被修改为实际写入的内容并设置Truncated，调用方的Fields不会被修改
+func (enc *entryEncoder) appendTruncated(entry *LogEntry, limit int) error {
+	start := len(enc.buf)
+	entry.Truncated = true
+	encode := func() (int, error) {
+		enc.buf = enc.buf[:start]
+		err := enc.appendEntry(entry)
+		return len(enc.buf) - start, err
+	}
+	size, err := encode()
+	if err != nil || size <= limit {
+		return err
+	}
+
+	// 转义后的长度不小于原始长度，截去超出的字节数即可；先保留消息开头，字段仍然过大时再处理字段
+	if len(entry.Message) > maxTruncatedField {
+		entry.Message = truncateString(entry.Message, max(len(entry.Message)-(size-limit)-len(truncatedSuffix), maxTruncatedField))
+		if size, err = encode(); err != nil || size <= limit {
+			return err
+		}
+	}
+
+	if len(entry.Fields) > 0 {
+		type encodedField struct {
+			key   string
+			value []byte
+		}
+		fields := make([]encodedField, 0, len(entry.Fields))
+		for key, value := range entry.Fields {
+			encoded, err := appendJSONValue(nil, value)
+			if err != nil {
+				return err
+			}
+			fields = append(fields, encodedField{key, encoded})
+		}
+		sort.Slice(fields, func(i, j int) bool { return len(fields[i].value) > len(fields[j].value) })
+
+		truncated := make(map[string]any, len(entry.Fields))
+		for key, value := range entry.Fields {
+			truncated[key] = value
+		}
+		entry.Fields = truncated
+		for _, field := range fields {
+			if len(field.value) <= maxTruncatedField {
+				break
+			}
+			truncated[field.key] = truncateString(string(field.value), maxTruncatedField)
+			if size, err = encode(); err != nil || size <= limit {
+				return err
+			}
+		}
+		entry.Fields = nil
+		if size, err = encode(); err != nil || size <= limit {
+			return err
+		}
+	}
+
+	entry.Message = truncateString(entry.Message, len(entry.Message)-(size-limit)-len(truncatedSuffix))
+	_, err = encode()
+	return err
+}
+
+// truncateString 将s截断到不超过n字节（不切断UTF-8字符）并加上truncatedSuffix
+func truncateString(s string, n int) string {
+	if n >= len(s) {
+		return s
+	}
+	n = max(n, 0)
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + truncatedSuffix
+}
+
+// appendFields 按键排序追加字段映射
+func (enc *entryEncoder) appendFields(b []byte, fields map[string]any) ([]byte, error) {
+	enc.keys = enc.keys[:0]
+	for key := range fields {
+		enc.keys = append(enc.keys, key)
+	}
+	sort.Strings(enc.keys)
+
+	b = append(b, '{')
+	for i, key := range enc.keys {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendJSONString(b, key)
+		b = append(b, ':')
+
+		var err error
+		if b, err = appendJSONValue(b, fields[key]); err != nil {
+			return b, err
+		}
+	}
+	return append(b, '}'), nil
+}
+
+// appendOptionalString 追加omitempty的字符串字段
+func appendOptionalString(b []byte, prefix, value string) []byte {
+	if value == "" {
+		return b
+	}
+	b = append(b, prefix...)
+	return appendJSONString(b, value)
+}
+
+// appendJSONValue 追加常见类型的值，其他类型回退到json.Marshal
+func appendJSONValue(b []byte, value any) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(b, "null"...), nil
+	case string:
+		return appendJSONString(b, v), nil
+	case bool:
+		return strconv.AppendBool(b, v), nil
+	case int:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case int8:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case int16:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case int32:
+		return strconv.AppendInt(b, int64(v), 10), nil
+	case int64:
+		return strconv.AppendInt(b, v, 10), nil
+	case uint:
+		return strconv.AppendUint(b, uint64(v), 10), nil
+	case uint8:
+		return strconv.AppendUint(b, uint64(v), 10), nil
+	case uint16:
+		return strconv.AppendUint(b, uint64(v), 10), nil
+	case uint32:
+		return strconv.AppendUint(b, uint64(v), 10), nil
+	case uint64:
+		return strconv.AppendUint(b, v, 10), nil
+	case float64:
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			return appendJSONFloat64(b, v), nil
+		}
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return b, err
+	}
+	return append(b, data...), nil
+}
+
+// appendJSONFloat64 按encoding/json的规则格式化float64
+func appendJSONFloat64(b []byte, f float64) []byte {
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	b = strconv.AppendFloat(b, f, format, -1, 64)
+	if format == 'e' {
+		// 将 e-09 规范为 e-9
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b
+}
+
+const hexDigits = "0123456789abcdef"
+
+// appendJSONString 按encoding/json的规则（包括HTML转义）追加字符串
+func appendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\b':
+				b = append(b, '\\', 'b')
+			case '\f':
+				b = append(b, '\\', 'f')
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hexDigits[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
@@ -0,0 +1,151 @@
+package aggregate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz"
+)
+
+// MaxGroupTraceIDs 每个错误分组最多保留的不同TraceID数量
+const MaxGroupTraceIDs = 10
+
+// ErrorGroup 按指纹聚合的一组错误日志
+type ErrorGroup struct {
+	Fingerprint string    `json:"fingerprint"`
+	Message     string    `json:"message"` // 归一化后的消息
+	Caller      string    `json:"caller,omitempty"`
+	Level       string    `json:"level"`
+	Count       int       `json:"count"`
+	FirstSeen   time.Time `json:"first_seen"`
+	LastSeen    time.Time `json:"last_seen"`
+	Sample      LogEntry  `json:"sample"` // 最近一条日志
+	TraceIDs    []string  `json:"trace_ids,omitempty"`
+}
+
+// errorLevels 默认参与分组的日志级别
+var errorLevels = []string{"error", "fatal", "panic"}
+
+// GroupErrors 扫描日志目录中的错误日志并按指纹分组
+// query.Level为空时统计error、fatal和panic级别；结果按出现次数降序排列，query.Limit限制返回的分组数
+func GroupErrors(query LogQuery, logDir string) ([]ErrorGroup, error) {
+	return GroupErrorsContext(context.Background(), query, logDir)
+}
+
+// GroupErrorsContext 与GroupErrors相同，但在ctx取消时停止扫描
+func GroupErrorsContext(ctx context.Context, query LogQuery, logDir string) ([]ErrorGroup, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkLogDir(logDir); err != nil {
+		return nil, err
+	}
+
+	files, err := DiscoverLogFiles(logDir, query.DiscoverOptions())
+	if err != nil {
+		return nil, fmt.Errorf("获取日志文件失败: %w", err)
+	}
+	files = dedupeCompressedFiles(files)
+
+	levels := errorLevels
+	if query.Level != "" {
+		levels = []string{canonicalLevel(query.Level)}
+	}
+	scanQuery := query
+	scanQuery.Level = ""
+
+	groups := make(map[string]*ErrorGroup)
+	for _, file := range files {
+		entries, _, err := queryFile(ctx, openLogReader, file, scanQuery, nil)
+		if err != nil {
+			var parseErr *ParseError
+			if errors.As(err, &parseErr) {
+				return nil, err
+			}
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			continue // 跳过有问题的文件
+		}
+
+		for _, entry := range entries {
+			if !isLevelIn(canonicalLevel(entry.Level), levels) {
+				continue
+			}
+			addToGroup(groups, entry)
+		}
+	}
+
+	result := make([]ErrorGroup, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, *group)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		if !result[i].LastSeen.Equal(result[j].LastSeen) {
+			return result[i].LastSeen.After(result[j].LastSeen)
+		}
+		return result[i].Fingerprint < result[j].Fingerprint
+	})
+
+	if query.Limit > 0 && len(result) > query.Limit {
+		result = result[:query.Limit]
+	}
+	return result, nil
+}
+
+// addToGroup 将日志条目计入对应的分组
+func addToGroup(groups map[string]*ErrorGroup, entry LogEntry) {
+	fingerprint := logz.ErrorFingerprint(entry.Message, entry.Caller)
+	ts, _ := time.Parse(time.RFC3339, entry.Timestamp)
+
+	group, ok := groups[fingerprint]
+	if !ok {
+		group = &ErrorGroup{
+			Fingerprint: fingerprint,
+			Message:     logz.NormalizeErrorMessage(entry.Message),
+			Caller:      entry.Caller,
+			Level:       canonicalLevel(entry.Level),
+			FirstSeen:   ts,
+			LastSeen:    ts,
+			Sample:      entry,
+		}
+		groups[fingerprint] = group
+	}
+
+	group.Count++
+	if ts.Before(group.FirstSeen) {
+		group.FirstSeen = ts
+	}
+	if ts.After(group.LastSeen) {
+		group.LastSeen = ts
+		group.Sample = entry
+	}
+
+	if entry.TraceID != "" && len(group.TraceIDs) < MaxGroupTraceIDs {
+		for _, id := range group.TraceIDs {
+			if id == entry.TraceID {
+				return
+			}
+		}
+		group.TraceIDs = append(group.TraceIDs, entry.TraceID)
+	}
+}
+
+// isLevelIn 判断规范化后的日志级别是否在列表中
+func isLevelIn(level string, levels []string) bool {
+	for _, l := range levels {
+		if level == l {
+			return true
+		}
+	}
+	return false
+}
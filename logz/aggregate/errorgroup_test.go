@@ -0,0 +1,104 @@
+package aggregate
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeGroupTestLog(t *testing.T, dir string, entries []LogEntry) {
+	t.Helper()
+	var sb strings.Builder
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			t.Fatalf("序列化日志失败: %v", err)
+		}
+		sb.Write(data)
+		sb.WriteByte('\n')
+	}
+	if err := os.WriteFile(filepath.Join(dir, "svc_2024-01-15_001.log"), []byte(sb.String()), 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+}
+
+func TestGroupErrors(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	at := func(minutes int) string {
+		return base.Add(time.Duration(minutes) * time.Minute).Format(time.RFC3339)
+	}
+
+	writeGroupTestLog(t, dir, []LogEntry{
+		{Timestamp: at(0), Level: "error", Message: "timeout after 31ms", Caller: "db.go:42", TraceID: "trace-a"},
+		{Timestamp: at(5), Level: "error", Message: "timeout after 87ms", Caller: "db.go:42", TraceID: "trace-b"},
+		{Timestamp: at(3), Level: "fatal", Message: "timeout after 12ms", Caller: "db.go:42", TraceID: "trace-a"},
+		{Timestamp: at(1), Level: "error", Message: "timeout after 50ms", Caller: "http.go:10"},
+		{Timestamp: at(2), Level: "info", Message: "timeout after 5ms", Caller: "db.go:42"},
+	})
+
+	groups, err := GroupErrors(LogQuery{}, dir)
+	if err != nil {
+		t.Fatalf("分组失败: %v", err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("期望2个分组，得到 %d", len(groups))
+	}
+
+	top := groups[0]
+	if top.Count != 3 {
+		t.Errorf("期望3条错误，得到 %d", top.Count)
+	}
+	if top.Message != "timeout after <n>ms" || top.Caller != "db.go:42" {
+		t.Errorf("分组消息或调用者错误: %q %q", top.Message, top.Caller)
+	}
+	if top.FirstSeen.Format(time.RFC3339) != at(0) || top.LastSeen.Format(time.RFC3339) != at(5) {
+		t.Errorf("首次/最近出现时间错误: %v %v", top.FirstSeen, top.LastSeen)
+	}
+	if top.Sample.Message != "timeout after 87ms" {
+		t.Errorf("期望样例为最近一条日志，得到 %q", top.Sample.Message)
+	}
+	if len(top.TraceIDs) != 2 {
+		t.Errorf("期望2个不同的TraceID，得到 %v", top.TraceIDs)
+	}
+	if groups[1].Caller != "http.go:10" || groups[1].Count != 1 {
+		t.Errorf("第二个分组错误: %+v", groups[1])
+	}
+
+	// 时间窗口过滤
+	groups, err = GroupErrors(LogQuery{StartTime: base.Add(4 * time.Minute)}, dir)
+	if err != nil {
+		t.Fatalf("分组失败: %v", err)
+	}
+	if len(groups) != 1 || groups[0].Count != 1 {
+		t.Errorf("期望时间窗口内只有1个分组1条错误，得到 %+v", groups)
+	}
+}
+
+func TestGroupErrorsTraceIDLimit(t *testing.T) {
+	dir := t.TempDir()
+	var entries []LogEntry
+	for i := 0; i < MaxGroupTraceIDs+5; i++ {
+		entries = append(entries, LogEntry{
+			Timestamp: time.Now().Format(time.RFC3339),
+			Level:     "error",
+			Message:   "connection reset",
+			TraceID:   "trace-" + string(rune('a'+i)),
+		})
+	}
+	writeGroupTestLog(t, dir, entries)
+
+	groups, err := GroupErrors(LogQuery{}, dir)
+	if err != nil {
+		t.Fatalf("分组失败: %v", err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("期望1个分组，得到 %d", len(groups))
+	}
+	if len(groups[0].TraceIDs) != MaxGroupTraceIDs {
+		t.Errorf("期望最多%d个TraceID，得到 %d", MaxGroupTraceIDs, len(groups[0].TraceIDs))
+	}
+}
@@ -0,0 +1,142 @@
+package aggregate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/HsiaoL1/trace/logz"
+)
+
+// 查询、写入和清理接口返回的错误，可用errors.Is判断，具体原因通过%w包装在错误信息中
+var (
+	ErrLogDirNotFound   = errors.New("日志目录不存在")
+	ErrInvalidQuery     = errors.New("查询参数无效")
+	ErrIndexUnavailable = errors.New("索引不可用")
+	ErrNoAggregator     = errors.New("全局聚合器未设置")
+	ErrDiskFull         = errors.New("磁盘空间不足，拒绝写入")
+	ErrLogFileRemoved   = errors.New("日志文件已被清理")
+	ErrDirectoryLocked  = errors.New("日志目录已被其他聚合器锁定")
+	ErrWriteFailing     = errors.New("写入日志文件持续失败")
+	ErrEntryTooLarge    = errors.New("日志条目超过大小限制")
+)
+
+// Web API响应中的error_code，与上面的错误一一对应；CodeTimeout对应context.DeadlineExceeded
+const (
+	CodeLogDirNotFound   = "log_dir_not_found"
+	CodeInvalidQuery     = "invalid_query"
+	CodeIndexUnavailable = "index_unavailable"
+	CodeNoAggregator     = "no_aggregator"
+	CodeDiskFull         = "disk_full"
+	CodeLogFileRemoved   = "log_file_removed"
+	CodeDirectoryLocked  = "directory_locked"
+	CodeWriteFailing     = "write_failing"
+	CodeEntryTooLarge    = "entry_too_large"
+	CodeTimeout          = "timeout"
+	CodeInternal         = "internal_error"
+)
+
+// errorCodes 错误码对应的错误，按顺序匹配
+// 一个错误可能同时包装多个哨兵错误（如ErrIndexUnavailable包装ErrNoAggregator），先匹配的优先
+var errorCodes = []struct {
+	code string
+	err  error
+}{
+	{CodeLogDirNotFound, ErrLogDirNotFound},
+	{CodeInvalidQuery, ErrInvalidQuery},
+	{CodeIndexUnavailable, ErrIndexUnavailable},
+	{CodeNoAggregator, ErrNoAggregator},
+	{CodeDiskFull, ErrDiskFull},
+	{CodeLogFileRemoved, ErrLogFileRemoved},
+	{CodeDirectoryLocked, ErrDirectoryLocked},
+	{CodeWriteFailing, ErrWriteFailing},
+	{CodeEntryTooLarge, ErrEntryTooLarge},
+	{CodeTimeout, context.DeadlineExceeded},
+}
+
+// ErrorCode 返回错误对应的错误码，不是以上错误时返回CodeInternal
+func ErrorCode(err error) string {
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return c.code
+		}
+	}
+	return CodeInternal
+}
+
+// errorForCode 返回错误码对应的错误，未知的错误码返回nil
+func errorForCode(code string) error {
+	for _, c := range errorCodes {
+		if c.code == code {
+			return c.err
+		}
+	}
+	return nil
+}
+
+// QueryError 查询参数错误，errors.Is(err, ErrInvalidQuery)为true
+type QueryError struct {
+	Field string // 出错的参数，与LogQuery的JSON字段名相同
+	Err   error
+}
+
+// Error 实现error接口
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s %s: %v", ErrInvalidQuery, e.Field, e.Err)
+}
+
+// Unwrap 返回ErrInvalidQuery和具体原因
+func (e *QueryError) Unwrap() []error {
+	return []error{ErrInvalidQuery, e.Err}
+}
+
+// Validate 检查查询参数：级别可识别、消息是有效的正则表达式、时间范围和分页参数有效、文件匹配模式有效
+func (q LogQuery) Validate() error {
+	if q.Level != "" {
+		if _, err := logz.NormalizeLevel(q.Level); err != nil {
+			return &QueryError{Field: "level", Err: err}
+		}
+	}
+	if q.Message != "" {
+		if _, err := regexp.Compile(q.Message); err != nil {
+			return &QueryError{Field: "message", Err: err}
+		}
+	}
+	if !q.StartTime.IsZero() && !q.EndTime.IsZero() && q.StartTime.After(q.EndTime) {
+		return &QueryError{Field: "start_time", Err: errors.New("开始时间晚于结束时间")}
+	}
+	if q.Limit < 0 {
+		return &QueryError{Field: "limit", Err: fmt.Errorf("不能为负数: %d", q.Limit)}
+	}
+	if q.Offset < 0 {
+		return &QueryError{Field: "offset", Err: fmt.Errorf("不能为负数: %d", q.Offset)}
+	}
+	switch q.SortOrder {
+	case "", SortAsc, SortDesc:
+	default:
+		return &QueryError{Field: "sort_order", Err: fmt.Errorf("应为%s或%s: %q", SortAsc, SortDesc, q.SortOrder)}
+	}
+	for _, pattern := range q.PathPatterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return &QueryError{Field: "path_patterns", Err: fmt.Errorf("%q: %w", pattern, err)}
+		}
+	}
+	return nil
+}
+
+// checkLogDir 检查日志目录是否存在，不存在时返回包装了ErrLogDirNotFound的错误
+func checkLogDir(logDir string) error {
+	stat, err := os.Stat(logDir)
+	switch {
+	case os.IsNotExist(err):
+		return fmt.Errorf("%w: %s", ErrLogDirNotFound, logDir)
+	case err != nil:
+		return err
+	case !stat.IsDir():
+		return fmt.Errorf("%w: %s不是目录", ErrLogDirNotFound, logDir)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package aggregate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQueryErrors(t *testing.T) {
+	SetGlobalAggregator(nil)
+	dir := t.TempDir()
+	writeGroupTestLog(t, dir, []LogEntry{
+		{Timestamp: time.Now().Format(time.RFC3339), Level: "error", Message: "db down", TraceID: "trace-a"},
+	})
+	missing := filepath.Join(dir, "missing")
+
+	tests := []struct {
+		name  string
+		query func() error
+		want  error
+		field string
+	}{
+		{"目录不存在", func() error { _, err := QueryLogs(LogQuery{}, missing); return err }, ErrLogDirNotFound, ""},
+		{"按TraceID查询目录不存在", func() error { _, err := QueryLogsByTraceID("trace-a", missing, 10, 0); return err }, ErrLogDirNotFound, ""},
+		{"无效的正则", func() error { _, err := QueryLogsByMessage("(", dir, 10, 0); return err }, ErrInvalidQuery, "message"},
+		{"无效的级别", func() error { _, err := QueryLogsByLevel("loud", dir, 10, 0); return err }, ErrInvalidQuery, "level"},
+		{"时间范围颠倒", func() error {
+			_, err := QueryLogsByTimeRange(time.Now(), time.Now().Add(-time.Hour), dir, 10, 0)
+			return err
+		}, ErrInvalidQuery, "start_time"},
+		{"负数偏移", func() error { _, err := QueryLogsByService("api", dir, 10, -1); return err }, ErrInvalidQuery, "offset"},
+		{"没有聚合器时强制使用索引", func() error { _, err := QueryLogsWithIndex(LogQuery{TraceID: "trace-a"}, dir); return err }, ErrIndexUnavailable, ""},
+		{"写入时没有聚合器", func() error { return WriteToAggregator(LogEntry{Message: "dropped"}) }, ErrNoAggregator, ""},
+		{"清理目录不存在", func() error { _, err := CleanupOldLogs(missing, 7); return err }, ErrLogDirNotFound, ""},
+		{"保留天数为负数", func() error { _, err := CleanupOldLogs(dir, -1); return err }, ErrInvalidQuery, "retention_days"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.query()
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("期望 %v，得到 %v", tt.want, err)
+			}
+			if tt.field == "" {
+				return
+			}
+			var queryErr *QueryError
+			if !errors.As(err, &queryErr) || queryErr.Field != tt.field {
+				t.Errorf("期望参数 %s 出错，得到 %v", tt.field, err)
+			}
+		})
+	}
+
+	// 强制使用索引时，没有聚合器的错误同时匹配ErrNoAggregator
+	if _, err := QueryLogsWithIndex(LogQuery{TraceID: "trace-a"}, dir); !errors.Is(err, ErrNoAggregator) || ErrorCode(err) != CodeIndexUnavailable {
+		t.Errorf("期望 ErrNoAggregator 和 %s，得到 %v", CodeIndexUnavailable, err)
+	}
+	// 不强制使用索引时回退到文件扫描
+	result, err := QueryLogs(LogQuery{TraceID: "trace-a", UseIndex: true}, dir)
+	if err != nil || result.Total != 1 {
+		t.Errorf("期望回退到文件扫描找到 1 条，得到 %v %v", result, err)
+	}
+	if code := ErrorCode(errors.New("other")); code != CodeInternal {
+		t.Errorf("期望 %s，得到 %s", CodeInternal, code)
+	}
+	if code := ErrorCode(fmt.Errorf("查询失败: %w", context.DeadlineExceeded)); code != CodeTimeout {
+		t.Errorf("期望 %s，得到 %s", CodeTimeout, code)
+	}
+}
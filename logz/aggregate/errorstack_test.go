@@ -0,0 +1,51 @@
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/HsiaoL1/trace/logz"
+)
+
+func TestErrorStackQuery(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "stack", WithBatchSize(1))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+	SetGlobalAggregator(aggregator)
+	defer SetGlobalAggregator(nil)
+
+	logger := logz.NewDefaultLogger(&logz.LoggerConfig{Level: logz.LevelInfo, Format: logz.FormatJSON, Output: io.Discard})
+	logger.AddNamedHook(logz.HookNameAggregator, NewAggregatorHook(aggregator, "stack"), logz.HookPriorityAggregator)
+	logger.WithErrorDetailed(fmt.Errorf("charge: %w", errors.New("declined"))).WithField("trace_id", "trace-stack").Error("payment failed")
+	logger.WithError(errors.New("plain")).WithField("trace_id", "trace-stack").Error("no stack")
+
+	waitIndexed(t, aggregator)
+	for _, useIndex := range []bool{true, false} {
+		result, err := QueryLogs(LogQuery{TraceID: "trace-stack", HasStack: true, UseIndex: useIndex, Limit: 10}, dir)
+		if err != nil {
+			t.Fatalf("查询失败: %v", err)
+		}
+		if result.Total != 1 || result.Entries[0].Message != "payment failed" {
+			t.Fatalf("UseIndex=%v: 期望只查到带调用栈的日志，得到 %+v", useIndex, result.Entries)
+		}
+		fields := result.Entries[0].Fields
+		if stack, _ := fields[logz.ErrorStackKey].(string); !strings.Contains(stack, "TestErrorStackQuery") {
+			t.Errorf("期望调用栈指向测试函数，得到 %q", stack)
+		}
+		if chain, _ := fields[logz.ErrorChainKey].([]any); len(chain) != 2 {
+			t.Errorf("期望错误链有 2 项，得到 %v", fields[logz.ErrorChainKey])
+		}
+	}
+
+	// 普通的WithError也以消息而不是空对象写入聚合文件
+	result, err := QueryLogs(LogQuery{Message: "no stack", Limit: 10}, dir)
+	if err != nil || result.Total != 1 || result.Entries[0].Fields["error"] != "plain" {
+		t.Errorf("期望error字段为plain，得到 %+v %v", result, err)
+	}
+}
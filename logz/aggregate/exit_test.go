@@ -0,0 +1,56 @@
+package aggregate
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz"
+	"github.com/sirupsen/logrus"
+)
+
+func TestFatalFlushesAggregatorBeforeExit(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "fatal", WithBatchSize(1000), WithFlushInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+	SetGlobalAggregator(aggregator)
+	defer SetGlobalAggregator(nil)
+
+	output := logz.Logrus.Out
+	hooks := logz.Logrus.ReplaceHooks(logrus.LevelHooks{})
+	logz.Logrus.SetOutput(io.Discard)
+	logz.Logrus.AddHook(NewAggregatorHook(aggregator, "fatal"))
+	defer func() {
+		logz.Logrus.ReplaceHooks(hooks)
+		logz.Logrus.SetOutput(output)
+		logz.SetExitFunc(nil)
+	}()
+
+	var exitCodes []int
+	var total int
+	logz.SetExitFunc(func(code int) {
+		exitCodes = append(exitCodes, code)
+		result, err := QueryLogs(LogQuery{Service: "fatal", Limit: 10}, dir)
+		if err != nil {
+			t.Errorf("查询失败: %v", err)
+			return
+		}
+		total = result.Total
+	})
+
+	logz.Info("starting")
+	logz.Fatalf("config broken: %s", "missing key")
+
+	if len(exitCodes) != 1 || exitCodes[0] != 1 {
+		t.Fatalf("期望以1调用一次退出函数，得到 %v", exitCodes)
+	}
+	if total != 2 {
+		t.Errorf("期望退出前批量缓冲区中的 2 条日志已写入文件，得到 %d", total)
+	}
+	if err := aggregator.WriteLog(LogEntry{Level: "info", Message: "after exit"}); err == nil {
+		t.Error("期望退出前关闭聚合器")
+	}
+}
@@ -0,0 +1,143 @@
+package aggregate
+
+import "time"
+
+// 查询执行策略
+const (
+	StrategyIndex = "index" // 通过索引定位候选条目
+	StrategyScan  = "scan"  // 逐个扫描日志文件
+	StrategyCache = "cache" // 按缓存的条目位置读取（ReadRefsPage）
+)
+
+// QueryExplain 查询的执行过程，LogQuery.Explain为true时填充，用于排查慢查询
+type QueryExplain struct {
+	Strategy     string   `json:"strategy"`
+	IndexBuckets []string `json:"index_buckets,omitempty"` // 使用或尝试使用的索引桶，组合索引在前
+	IndexError   string   `json:"index_error,omitempty"`   // 读取索引失败、回退到文件扫描的原因
+	Postings     int      `json:"postings,omitempty"`      // 索引返回的候选位置数
+
+	FilesConsidered int `json:"files_considered"` // 候选文件数
+	FilesOpened     int `json:"files_opened"`     // 实际打开读取的文件数
+	LinesScanned    int `json:"lines_scanned"`    // 读取的行数
+	ParseErrors     int `json:"parse_errors"`     // 无法解析的行数
+
+	Matched  int `json:"matched"`  // 分页前匹配的条目数
+	Returned int `json:"returned"` // 分页后返回的条目数
+
+	Phases   []QueryPhase  `json:"phases"`
+	Duration time.Duration `json:"duration"` // 查询总耗时（纳秒）
+}
+
+// QueryPhase 查询阶段的耗时
+type QueryPhase struct {
+	Name     string        `json:"name"`     // discover、index_lookup、read_postings、unindexed、scan、read_refs
+	Duration time.Duration `json:"duration"` // 纳秒
+}
+
+// queryStats 收集查询的执行统计，为nil时所有方法不做任何事，未开启Explain的查询没有额外开销
+// 文件扫描和索引读取都是顺序执行的，不需要加锁
+type queryStats struct {
+	start   time.Time
+	explain QueryExplain
+}
+
+// newQueryStats query.Explain为true时返回统计收集器，否则返回nil
+func newQueryStats(query LogQuery) *queryStats {
+	if !query.Explain {
+		return nil
+	}
+	return &queryStats{start: time.Now()}
+}
+
+// useIndex 记录使用索引查询及使用的索引桶
+func (s *queryStats) useIndex(query LogQuery) {
+	if s == nil {
+		return
+	}
+	s.explain.Strategy = StrategyIndex
+	s.explain.IndexBuckets = explainBuckets(query)
+}
+
+// fallback 记录读取索引失败，回退到文件扫描
+func (s *queryStats) fallback(err error) {
+	if s == nil {
+		return
+	}
+	s.explain.IndexError = err.Error()
+	s.explain.FilesConsidered, s.explain.FilesOpened, s.explain.LinesScanned, s.explain.Postings = 0, 0, 0, 0
+}
+
+// phaseStart 返回阶段的开始时间
+func (s *queryStats) phaseStart() time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// phaseEnd 记录从start开始的阶段耗时
+func (s *queryStats) phaseEnd(name string, start time.Time) {
+	if s == nil {
+		return
+	}
+	s.explain.Phases = append(s.explain.Phases, QueryPhase{Name: name, Duration: time.Since(start)})
+}
+
+// considered 记录候选文件数
+func (s *queryStats) considered(files int) {
+	if s != nil {
+		s.explain.FilesConsidered += files
+	}
+}
+
+// opened 记录打开了一个文件
+func (s *queryStats) opened() {
+	if s != nil {
+		s.explain.FilesOpened++
+	}
+}
+
+// scanned 记录读取的行数
+func (s *queryStats) scanned(lines int) {
+	if s != nil {
+		s.explain.LinesScanned += lines
+	}
+}
+
+// postings 记录索引返回的候选位置数
+func (s *queryStats) postings(n int) {
+	if s != nil {
+		s.explain.Postings = n
+	}
+}
+
+// finish 根据查询结果补全统计，并设置到result.Explain
+func (s *queryStats) finish(result *LogQueryResult) {
+	if s == nil {
+		return
+	}
+	if s.explain.Strategy == "" || s.explain.IndexError != "" {
+		s.explain.Strategy = StrategyScan
+	}
+	s.explain.Matched = result.Total
+	s.explain.Returned = len(result.Entries)
+	for _, count := range result.ParseErrors {
+		s.explain.ParseErrors += count
+	}
+	s.explain.Duration = time.Since(s.start)
+	result.Explain = &s.explain
+}
+
+// explainBuckets 返回查询使用的索引桶，可以使用组合索引时组合索引在前，其余为组合索引未覆盖的条件
+func explainBuckets(query LogQuery) []string {
+	var buckets []string
+	conditions := indexConditions(query)
+	if scan, rest := planComposite(query); scan != nil {
+		buckets = append(buckets, scan.bucket)
+		conditions = rest
+	}
+	for _, cond := range conditions {
+		buckets = append(buckets, cond.bucket)
+	}
+	return buckets
+}
@@ -0,0 +1,95 @@
+package aggregate
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryExplainStrategy(t *testing.T) {
+	dir, _ := newIndexedCorpus(t)
+	start := time.Date(2024, 1, 15, 10, 1, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		query    LogQuery
+		strategy string
+		buckets  []string
+		phases   []string
+	}{
+		{"TraceID和时间范围使用组合索引", LogQuery{TraceID: "trace-7", StartTime: start, UseIndex: true}, StrategyIndex, []string{"trace_time"}, []string{"index_lookup", "read_postings"}},
+		{"服务名和级别使用组合索引", LogQuery{Service: "orders", Level: "warn", TraceID: "trace-10", UseIndex: true}, StrategyIndex, []string{"service_level", "trace_id"}, []string{"index_lookup", "read_postings"}},
+		{"多个条件求交集", LogQuery{TraceID: "trace-3", Service: "payments", UseIndex: true}, StrategyIndex, []string{"trace_id", "service"}, []string{"index_lookup", "read_postings"}},
+		{"只有消息条件时扫描", LogQuery{Message: "took 1ms", UseIndex: true}, StrategyScan, nil, []string{"discover", "scan"}},
+		{"未开启索引时扫描", LogQuery{Service: "payments"}, StrategyScan, nil, []string{"discover", "scan"}},
+		{"索引中没有时回退到扫描", LogQuery{TraceID: "missing", UseIndex: true}, StrategyScan, []string{"trace_id"}, []string{"index_lookup", "discover", "scan"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := tt.query
+			query.Limit = 3
+			query.Explain = true
+			result, err := QueryLogs(query, dir)
+			if err != nil {
+				t.Fatalf("查询失败: %v", err)
+			}
+			explain := result.Explain
+			if explain == nil {
+				t.Fatal("期望返回执行过程")
+			}
+			if explain.Strategy != tt.strategy || !reflect.DeepEqual(explain.IndexBuckets, tt.buckets) {
+				t.Errorf("期望策略 %s 索引桶 %v，得到 %s %v", tt.strategy, tt.buckets, explain.Strategy, explain.IndexBuckets)
+			}
+			var phases []string
+			for _, phase := range explain.Phases {
+				phases = append(phases, phase.Name)
+			}
+			if !reflect.DeepEqual(phases, tt.phases) {
+				t.Errorf("期望阶段 %v，得到 %v", tt.phases, phases)
+			}
+			if (explain.IndexError != "") != (tt.buckets != nil && tt.strategy == StrategyScan) {
+				t.Errorf("回退原因错误: %q", explain.IndexError)
+			}
+			if explain.Matched != result.Total || explain.Returned != len(result.Entries) || explain.Duration <= 0 {
+				t.Errorf("匹配和返回条目数错误: %+v", explain)
+			}
+
+			switch tt.strategy {
+			case StrategyScan:
+				// 两个数据文件都被完整扫描
+				if explain.FilesConsidered != 2 || explain.FilesOpened != 2 || explain.LinesScanned != 300 {
+					t.Errorf("期望扫描 2 个文件 300 行，得到 %+v", explain)
+				}
+			case StrategyIndex:
+				// 只读取索引返回的候选位置
+				if explain.Postings == 0 || explain.LinesScanned != explain.Postings || explain.Matched > explain.Postings {
+					t.Errorf("索引候选位置统计错误: %+v", explain)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryExplainDisabled(t *testing.T) {
+	dir, _ := newIndexedCorpus(t)
+	result, err := QueryLogs(LogQuery{Service: "payments", Limit: 10, UseIndex: true}, dir)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if result.Explain != nil {
+		t.Errorf("期望未开启Explain时不返回执行过程，得到 %+v", result.Explain)
+	}
+
+	// QueryReader同样支持Explain
+	input := `{"level":"info","msg":"a"}` + "\nnot json\n" + `{"level":"error","msg":"b"}` + "\n"
+	result, err = QueryReader(t.Context(), strings.NewReader(input), LogQuery{Level: "error", Limit: 10, Explain: true})
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if explain := result.Explain; explain == nil || explain.Strategy != StrategyScan || explain.LinesScanned != 3 ||
+		explain.ParseErrors != 1 || explain.Matched != 1 {
+		t.Errorf("QueryReader执行过程错误: %+v", result.Explain)
+	}
+}
@@ -0,0 +1,214 @@
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz"
+	"github.com/sirupsen/logrus"
+)
+
+// WriteDestination 日志条目实际写入的位置
+type WriteDestination string
+
+const (
+	WrittenToAggregator WriteDestination = "aggregator" // 全局聚合器
+	WrittenToFile       WriteDestination = "file"       // 备用目录中的文件
+	WrittenToLogger     WriteDestination = "logger"     // 默认日志器
+)
+
+// FallbackMode 没有全局聚合器时的写入方式
+type FallbackMode string
+
+const (
+	FallbackNone   FallbackMode = "none"   // 返回ErrNoAggregator
+	FallbackFile   FallbackMode = "file"   // 以JSON行追加到WriteFallback.Dir中的received_{date}.log
+	FallbackLogger FallbackMode = "logger" // 通过默认日志器输出，附带条目的字段
+)
+
+// ParseFallbackMode 解析备用写入方式（none、file、logger，忽略大小写）
+func ParseFallbackMode(mode string) (FallbackMode, error) {
+	switch FallbackMode(strings.ToLower(strings.TrimSpace(mode))) {
+	case FallbackNone:
+		return FallbackNone, nil
+	case FallbackFile:
+		return FallbackFile, nil
+	case FallbackLogger:
+		return FallbackLogger, nil
+	}
+	return "", fmt.Errorf("无效的备用写入方式: %q（可用: none、file、logger）", mode)
+}
+
+// WriteFallback 没有全局聚合器时的写入配置
+type WriteFallback struct {
+	Mode FallbackMode
+	Dir  string // FallbackFile写入的目录，不存在时自动创建
+}
+
+// fallbackFileMutex 串行化备用文件的追加写入
+var fallbackFileMutex sync.Mutex
+
+// WriteWithFallback 写入全局聚合器，没有聚合器时按fallback写入，返回实际写入的位置
+func WriteWithFallback(entry LogEntry, fallback WriteFallback) (WriteDestination, error) {
+	if aggregator := GlobalAggregator(); aggregator != nil {
+		return WrittenToAggregator, aggregator.WriteLog(entry)
+	}
+
+	prepareFallbackEntry(&entry)
+	switch fallback.Mode {
+	case FallbackFile:
+		_, err := writeFallbackFile(entry, fallback.Dir, false)
+		return WrittenToFile, err
+	case FallbackLogger:
+		writeFallbackLogger(entry)
+		return WrittenToLogger, nil
+	}
+	return "", ErrNoAggregator
+}
+
+// WriteWithFallbackSync 与WriteWithFallback相同，但立即写入并返回条目的位置（见LogAggregator.WriteLogSync）
+// 写入备用文件时FileID为文件名（不含.log），durable为true时同步到磁盘；
+// 写入默认日志器或MemoryAggregator等不写文件的聚合器时位置为空
+func WriteWithFallbackSync(entry LogEntry, fallback WriteFallback, durable bool) (WriteDestination, WritePosition, error) {
+	if aggregator := GlobalAggregator(); aggregator != nil {
+		if la, ok := aggregator.(*LogAggregator); ok {
+			position, err := la.WriteLogSync(entry, durable)
+			return WrittenToAggregator, position, err
+		}
+		if err := aggregator.WriteLog(entry); err != nil {
+			return WrittenToAggregator, WritePosition{}, err
+		}
+		return WrittenToAggregator, WritePosition{}, aggregator.Flush()
+	}
+
+	prepareFallbackEntry(&entry)
+	switch fallback.Mode {
+	case FallbackFile:
+		position, err := writeFallbackFile(entry, fallback.Dir, durable)
+		return WrittenToFile, position, err
+	case FallbackLogger:
+		writeFallbackLogger(entry)
+		return WrittenToLogger, WritePosition{}, nil
+	}
+	return "", WritePosition{}, ErrNoAggregator
+}
+
+// SyncWithFallback 将之前写入的条目同步到磁盘：全局聚合器写入文件时调用其Sync（同时等待建立索引），
+// 其他聚合器调用Flush，没有聚合器时同步当天的备用文件；写入默认日志器时不做任何事
+func SyncWithFallback(fallback WriteFallback) error {
+	if aggregator := GlobalAggregator(); aggregator != nil {
+		if la, ok := aggregator.(*LogAggregator); ok {
+			return la.Sync()
+		}
+		return aggregator.Flush()
+	}
+	if fallback.Mode != FallbackFile || fallback.Dir == "" {
+		return nil
+	}
+
+	fallbackFileMutex.Lock()
+	defer fallbackFileMutex.Unlock()
+	file, err := os.OpenFile(fallbackFilePath(fallback.Dir), os.O_WRONLY, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("打开备用写入文件失败: %w", err)
+	}
+	defer file.Close()
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("同步备用写入文件失败: %w", err)
+	}
+	return nil
+}
+
+// prepareFallbackEntry 填充写入备用位置的条目的默认字段
+func prepareFallbackEntry(entry *LogEntry) {
+	if entry.Timestamp == "" {
+		entry.Timestamp = time.Now().Format(time.RFC3339Nano)
+	}
+	entry.Level = canonicalLevel(entry.Level)
+	entry.FileID, entry.Offset = "", 0
+}
+
+// fallbackFilePath 返回dir中当天的备用写入文件
+func fallbackFilePath(dir string) string {
+	return filepath.Join(dir, "received_"+time.Now().Format("2006-01-02")+".log")
+}
+
+// writeFallbackFile 将条目以JSON行追加到dir中当天的received_{date}.log，返回条目的位置
+// durable为true时写入后同步到磁盘
+func writeFallbackFile(entry LogEntry, dir string, durable bool) (WritePosition, error) {
+	if dir == "" {
+		return WritePosition{}, errors.New("备用写入目录不能为空")
+	}
+
+	enc := getEntryEncoder()
+	defer putEntryEncoder(enc)
+	if err := enc.appendEntry(&entry); err != nil {
+		return WritePosition{}, fmt.Errorf("序列化日志条目失败: %w", err)
+	}
+	enc.buf = append(enc.buf, '\n')
+
+	fallbackFileMutex.Lock()
+	defer fallbackFileMutex.Unlock()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return WritePosition{}, fmt.Errorf("创建备用写入目录失败: %w", err)
+	}
+	path := fallbackFilePath(dir)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return WritePosition{}, fmt.Errorf("打开备用写入文件失败: %w", err)
+	}
+	defer file.Close()
+
+	// 追加写入由fallbackFileMutex串行化，写入前的文件大小即条目的偏移量
+	info, err := file.Stat()
+	if err != nil {
+		return WritePosition{}, fmt.Errorf("获取备用写入文件信息失败: %w", err)
+	}
+	position := WritePosition{FileID: strings.TrimSuffix(filepath.Base(path), ".log"), Offset: info.Size()}
+	if _, err := file.Write(enc.buf); err != nil {
+		return WritePosition{}, fmt.Errorf("写入备用文件失败: %w", err)
+	}
+	if durable {
+		if err := file.Sync(); err != nil {
+			return position, fmt.Errorf("同步备用写入文件失败: %w", err)
+		}
+		position.Durable = true
+	}
+	return position, file.Close()
+}
+
+// writeFallbackLogger 通过默认日志器输出条目，panic级别按fatal输出，不会panic或退出进程
+func writeFallbackLogger(entry LogEntry) {
+	fields := make(logrus.Fields, len(entry.Fields)+5)
+	for key, value := range entry.Fields {
+		fields[key] = value
+	}
+	for key, value := range map[string]string{
+		"trace_id":  entry.TraceID,
+		"span_id":   entry.SpanID,
+		"service":   entry.Service,
+		"caller":    entry.Caller,
+		"timestamp": entry.Timestamp,
+	} {
+		if value != "" {
+			fields[key] = value
+		}
+	}
+
+	level, err := logrus.ParseLevel(entry.Level)
+	if err != nil {
+		level = logrus.InfoLevel
+	}
+	if level < logrus.FatalLevel {
+		level = logrus.FatalLevel
+	}
+	logz.WithFields(fields).Log(level, entry.Message)
+}
@@ -0,0 +1,50 @@
+package aggregate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/HsiaoL1/trace/logz"
+)
+
+func TestParseFallbackMode(t *testing.T) {
+	for input, want := range map[string]FallbackMode{"file": FallbackFile, " Logger ": FallbackLogger, "NONE": FallbackNone} {
+		if got, err := ParseFallbackMode(input); err != nil || got != want {
+			t.Errorf("ParseFallbackMode(%q): 期望 %s，得到 %s %v", input, want, got, err)
+		}
+	}
+	if _, err := ParseFallbackMode("stdout"); err == nil {
+		t.Error("期望无效的写入方式返回错误")
+	}
+}
+
+func TestWriteWithFallbackWithoutAggregator(t *testing.T) {
+	SetGlobalAggregator(nil)
+
+	if err := WriteToAggregator(LogEntry{Message: "dropped"}); !errors.Is(err, ErrNoAggregator) {
+		t.Errorf("期望 ErrNoAggregator，得到 %v", err)
+	}
+	if _, err := WriteWithFallback(LogEntry{Message: "m"}, WriteFallback{Mode: FallbackFile}); err == nil {
+		t.Error("期望未指定目录时返回错误")
+	}
+
+	// panic级别按fatal输出，不会panic
+	original := logz.GetDefaultLogger()
+	defer logz.SetDefaultLogger(original)
+	var buf bytes.Buffer
+	logz.SetDefaultLogger(logz.NewDefaultLogger(&logz.LoggerConfig{Level: logz.LevelInfo, Format: logz.FormatJSON, Output: &buf}))
+
+	destination, err := WriteWithFallback(LogEntry{Level: "PANIC", Message: "boom", SpanID: "span-1"}, WriteFallback{Mode: FallbackLogger})
+	if err != nil || destination != WrittenToLogger {
+		t.Fatalf("期望写入日志器，得到 %s %v", destination, err)
+	}
+	var logged map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &logged); err != nil {
+		t.Fatalf("解析日志输出失败: %v", err)
+	}
+	if logged["level"] != "fatal" || logged["span_id"] != "span-1" {
+		t.Errorf("日志输出错误: %v", logged)
+	}
+}
@@ -0,0 +1,1844 @@
+package aggregate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz"
+	"github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+)
+
+// 这里需要对日志文件进行聚合，以及对聚合之后的文件进行查询
+// 比如通过traceID进行查询，或者通过时间范围进行查询
+// 需要删除一个星期之前的日志文件
+
+// LogEntry 日志条目结构
+type LogEntry struct {
+	Timestamp string         `json:"timestamp"`
+	Level     string         `json:"level"`
+	Message   string         `json:"msg"`
+	TraceID   string         `json:"trace_id,omitempty"`
+	SpanID    string         `json:"span_id,omitempty"`
+	Caller    string         `json:"caller,omitempty"`
+	Fields    map[string]any `json:"fields,omitempty"`
+	Service   string         `json:"service,omitempty"`
+	Hostname  string         `json:"hostname,omitempty"` // 写入条目的主机名，区分共享目录中同一服务的多个副本
+	PID       int            `json:"pid,omitempty"`      // 写入条目的进程ID
+	File      string         `json:"file,omitempty"`
+	FileID    string         `json:"file_id,omitempty"`   // 文件标识
+	Offset    int64          `json:"offset,omitempty"`    // 在文件中的偏移量
+	Truncated bool           `json:"truncated,omitempty"` // 超过聚合器的单条大小限制或写入限制，消息或字段被截断
+	// FieldsDropped 字段数超过写入限制时去掉的字段数
+	FieldsDropped int `json:"fields_dropped,omitempty"`
+
+	// SchemaVersion 写入条目时的格式版本，聚合器写入时为CurrentSchemaVersion，0表示引入版本号之前写入的条目
+	SchemaVersion int `json:"schema_version,omitempty"`
+	// Seq 聚合器写入时分配的序号，同一服务内单调递增，时间戳相同的条目按序号排列；0表示引入序号之前写入的条目
+	Seq uint64 `json:"seq,omitempty"`
+	// Extra 解析时不认识的顶层字段（如更新版本写入的字段），序列化时原样写回
+	Extra map[string]json.RawMessage `json:"-"`
+
+	ref EntryRef // LogQuery.Refs为true时扫描文件记录的位置
+}
+
+// LogAggregator 日志聚合器
+//
+// 锁顺序：closeMutex → batchMutex → compressMutex → mutex → indexMutex，持有后者时不得再获取前者；
+// indexLag的锁在最内层，持有时不获取其他锁。
+// 当前文件状态（各fileSet的字段）只在同时持有batchMutex和mutex时修改，读取时持有其中之一即可：
+// 写入、刷新和轮转持有batchMutex，查询和维护任务持有mutex。
+// 因此条目的FileID和Offset总是与写入它的文件一致。
+type LogAggregator struct {
+	outputDir    string
+	serviceName  string
+	rotationSize int64
+	maxBackups   int
+	retention    RetentionPolicy
+	mutex        sync.RWMutex
+	output       *fileSet            // 默认文件集合，保留策略中未单独配置的级别写入这里
+	levelOutputs map[string]*fileSet // 保留策略中单独配置的级别 -> 文件集合，创建后不再增减
+
+	// 索引相关
+	indexDB          *bbolt.DB
+	indexMutex       sync.RWMutex
+	indexPath        string
+	indexErr         error                                // 索引数据库无法重新打开时的错误，此时indexDB为nil
+	openIndex        func(path string) (*bbolt.DB, error) // 打开索引数据库
+	compactMaxSize   int64                                // 索引文件超过此大小时在维护任务中压缩，0表示不按大小压缩
+	compactFreeRatio float64                              // 空闲页比例超过此值时在维护任务中压缩，0表示不按比例压缩
+
+	indexSweepInterval time.Duration // 全量扫描索引的间隔，0表示不扫描
+	gc                 indexGC       // 清理已删除文件的索引条目的计数
+	indexStats         indexStatsCache
+
+	// 批量写入
+	batchSize     int
+	maxEntrySize  int          // 单条日志序列化后的最大字节数
+	limits        IngestLimits // WriteLog对单条日志的限制
+	batchBuffer   []LogEntry
+	batchMutex    sync.Mutex
+	seq           uint64 // 最后分配的条目序号，持有batchMutex时修改
+	filesClosed   bool   // Close已关闭文件，持有batchMutex时读写
+	writes        writeFailure
+	wrapFile      func(w io.Writer) io.Writer
+	batchTicker   *time.Ticker
+	flushInterval time.Duration
+	adaptive      *adaptiveFlush // 自适应刷新，未启用时为nil
+	flushes       flushHistogram
+
+	// 压缩相关
+	compressAfter   time.Duration
+	compressMutex   sync.Mutex
+	lastCompression time.Time
+
+	// 生命周期管理
+	ctx        context.Context
+	cancel     context.CancelFunc
+	done       chan struct{} // 后台任务全部退出后关闭
+	wg         sync.WaitGroup
+	closed     bool
+	closeMutex sync.Mutex
+
+	// 索引工作队列
+	indexQueue   chan indexItem
+	indexWorkers int
+	indexLag     indexLag // 已写入但尚未建立索引的条目
+
+	// 磁盘空间保护
+	disk diskWatcher
+
+	// 写入条目的来源，创建时确定
+	hostname string
+	pid      int
+
+	// 聚合Hook的异步写入队列，未启用时为nil
+	hookQueue *hookQueue
+
+	// 输出目录中本服务的锁，防止两个聚合器写入同一组文件
+	lock *dirLock
+}
+
+// fileSet 按日期和序列号轮转的一组聚合文件
+// 默认文件集合的文件ID为{service}_{date}_{seq}，按级别拆分的为{service}_{level}_{date}_{seq}
+type fileSet struct {
+	level        string // 默认文件集合为空
+	file         *os.File
+	out          io.Writer // writer写入的目标，通常为file
+	writer       *bufio.Writer
+	fileID       string
+	offset       int64
+	entries      int // 写入当前文件的条目数
+	lastRotation time.Time
+}
+
+// LogQuery 日志查询条件
+type LogQuery struct {
+	TraceID   string    `json:"trace_id,omitempty"`
+	SpanID    string    `json:"span_id,omitempty"`
+	Level     string    `json:"level,omitempty"`
+	Service   string    `json:"service,omitempty"`
+	Hostname  string    `json:"hostname,omitempty"` // 没有主机名的旧条目不匹配
+	StartTime time.Time `json:"start_time,omitempty"`
+	EndTime   time.Time `json:"end_time,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Limit     int       `json:"limit,omitempty"`
+	Offset    int       `json:"offset,omitempty"`
+	UseIndex  bool      `json:"use_index,omitempty"` // 是否使用索引
+
+	// 索引无法处理查询（没有全局聚合器、查询不含索引字段或读取索引失败）时返回ErrIndexUnavailable，而不是回退到文件扫描
+	RequireIndex bool `json:"require_index,omitempty"`
+
+	Strict bool `json:"strict,omitempty"` // 遇到无法解析的行时中止查询
+
+	// context取消或超时时返回已扫描到的部分结果（Truncated为true），否则返回ctx.Err()
+	AllowPartial bool `json:"allow_partial,omitempty"`
+
+	// 文件扫描时的文件名匹配模式，为空时使用DefaultPathPatterns
+	PathPatterns []string `json:"path_patterns,omitempty"`
+	Recursive    bool     `json:"recursive,omitempty"` // 是否扫描子目录
+	Subdirs      []string `json:"subdirs,omitempty"`   // 不递归时也扫描的子目录
+
+	HasStack bool `json:"has_stack,omitempty"` // 只返回带有error.stack字段的条目
+
+	// 文件扫描时同时解析原始的logrus日志（InitWithAggregation写入的JSON文件或文本格式的文件），
+	// 时间、级别和消息之外的顶层字段保存到Fields中；聚合日志格式的行不受影响
+	IncludeRawLogs bool `json:"include_raw_logs,omitempty"`
+
+	Explain bool `json:"explain,omitempty"` // 在结果中返回查询的执行过程（QueryExplain）
+
+	// 结果按时间戳排列的顺序：SortAsc（默认，trace按调用顺序显示）或SortDesc（最新的在前）
+	// 时间戳相同的条目按文件修改时间从新到旧、文件内按写入顺序排列
+	SortOrder string `json:"sort_order,omitempty"`
+
+	// 在结果中返回分页前所有匹配条目的位置（LogQueryResult.Refs）和读取的文件的修改时间（Sources），
+	// 用于缓存查询结果后通过ReadRefsPage按页读取
+	Refs bool `json:"-"`
+}
+
+// LogQueryResult 查询结果
+type LogQueryResult struct {
+	Entries     []LogEntry     `json:"entries"`
+	Total       int            `json:"total"`
+	Limit       int            `json:"limit"`
+	Offset      int            `json:"offset"`
+	ParseErrors map[string]int `json:"parse_errors,omitempty"` // 每个文件中被跳过的无效行数
+	Truncated   bool           `json:"truncated,omitempty"`    // 查询被取消，结果不完整
+	Explain     *QueryExplain  `json:"explain,omitempty"`      // LogQuery.Explain为true时返回
+
+	// 无法打开或读取中途出错的文件及错误信息，出错前读到的条目仍在结果中
+	ReadErrors map[string]string `json:"read_errors,omitempty"`
+
+	// LogQuery.Refs为true时返回：分页前所有匹配条目的位置，顺序与结果相同，条目没有位置时（如内存聚合器）为nil；
+	// 以及查询前日志目录（键为"."）和读取的文件（相对路径）的修改时间，参见SourcesChanged
+	Refs    []EntryRef           `json:"-"`
+	Sources map[string]time.Time `json:"-"`
+}
+
+// 文件扫描时检查context的行间隔
+const ctxCheckInterval = 1000
+
+// logOpener 打开日志文件进行读取，文件扫描通过参数接收，便于测试统计打开的文件
+type logOpener func(path string) (io.ReadCloser, error)
+
+// ParseError 日志行解析错误
+type ParseError struct {
+	File string
+	Line int
+	Err  error
+}
+
+// Error 实现error接口
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("解析日志行失败 %s:%d: %v", e.File, e.Line, e.Err)
+}
+
+// Unwrap 返回底层错误
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// IndexEntry 索引条目
+type IndexEntry struct {
+	FileID string `json:"file_id"`
+	Offset int64  `json:"offset"`
+	Size   int    `json:"size"`
+}
+
+// NewLogAggregator 创建新的日志聚合器
+func NewLogAggregator(outputDir, serviceName string, rotationSize int64, maxBackups int) (*LogAggregator, error) {
+	var opts []AggregatorOption
+	if rotationSize > 0 {
+		opts = append(opts, WithRotationSize(rotationSize))
+	}
+	if maxBackups > 0 {
+		opts = append(opts, WithMaxBackups(maxBackups))
+	}
+	return NewLogAggregatorWithOptions(outputDir, serviceName, opts...)
+}
+
+// NewLogAggregatorWithOptions 使用配置选项创建新的日志聚合器
+func NewLogAggregatorWithOptions(outputDir, serviceName string, opts ...AggregatorOption) (*LogAggregator, error) {
+	// 参数验证
+	if outputDir == "" {
+		return nil, errors.New("输出目录不能为空")
+	}
+	if serviceName == "" {
+		return nil, errors.New("服务名不能为空")
+	}
+	options, err := applyAggregatorOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// 确保输出目录存在
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, fmt.Errorf("创建日志聚合目录失败: %w", err)
+	}
+
+	// 两个聚合器使用同一目录和服务名时会选择相同的文件ID并交错写入，先获得目录锁
+	lock, err := acquireDirLock(outputDir, serviceName, options.hostname, options.pid, options.lockStaleTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// 创建索引目录
+	indexDir := filepath.Join(outputDir, "index")
+	if err := os.MkdirAll(indexDir, 0755); err != nil {
+		lock.release()
+		return nil, fmt.Errorf("创建索引目录失败: %w", err)
+	}
+
+	// 打开索引数据库
+	indexPath := filepath.Join(indexDir, serviceName+".db")
+	indexDB, err := options.openIndex(indexPath)
+	if err != nil {
+		lock.release()
+		return nil, fmt.Errorf("打开索引数据库失败: %w", err)
+	}
+
+	// 初始化索引桶
+	var composite bool
+	err = indexDB.Update(func(tx *bbolt.Tx) error {
+		var err error
+		if composite, err = createIndexBuckets(tx); err != nil {
+			return err
+		}
+		return migrateIndex(tx)
+	})
+	if err != nil {
+		indexDB.Close()
+		lock.release()
+		return nil, err
+	}
+	if !composite {
+		fmt.Fprintf(os.Stderr, "[索引] %s的索引缺少组合索引，停止服务后运行 trace-logs rebuild-index --service %s 重建索引可加快按服务和级别的查询\n", serviceName, serviceName)
+	}
+
+	// 创建上下文
+	ctx, cancel := context.WithCancel(context.Background())
+
+	aggregator := &LogAggregator{
+		outputDir:     outputDir,
+		serviceName:   serviceName,
+		rotationSize:  options.rotationSize,
+		maxBackups:    options.maxBackups,
+		retention:     RetentionPolicy{Default: options.retentionDays, Levels: options.levelRetention},
+		output:        &fileSet{},
+		levelOutputs:  make(map[string]*fileSet, len(options.levelRetention)),
+		indexDB:       indexDB,
+		indexPath:     indexPath,
+		openIndex:     options.openIndex,
+		batchSize:     options.batchSize,
+		maxEntrySize:  options.maxEntrySize,
+		limits:        options.ingestLimits,
+		batchBuffer:   make([]LogEntry, 0, options.batchSize),
+		flushInterval: options.flushInterval,
+		adaptive:      newAdaptiveFlush(options.adaptiveMaxLatency, options.adaptiveMaxBytes),
+		compressAfter: options.compressAfter,
+		ctx:           ctx,
+		cancel:        cancel,
+		done:          make(chan struct{}),
+		indexQueue:    make(chan indexItem, options.indexQueueSize), // 缓冲队列
+		indexWorkers:  options.indexWorkers,                         // 索引工作线程数
+		disk:          diskWatcher{guard: options.diskGuard, stat: options.statDisk},
+		hostname:      options.hostname,
+		pid:           options.pid,
+
+		compactMaxSize:   options.compactMaxSize,
+		compactFreeRatio: options.compactFreeRatio,
+
+		indexSweepInterval: options.indexSweepInterval,
+
+		writes:   writeFailure{maxBuffered: options.writeRetryBuffer, timeout: options.writeFailureTimeout},
+		wrapFile: options.wrapFile,
+
+		lock: lock,
+	}
+
+	// 处理上次退出时未完成的压缩
+	aggregator.reconcileCompression()
+	logRecordError(aggregator.reconcileFileRegistry())
+
+	// 从之前的文件中恢复条目序号，重启后继续递增；需要在创建新的当前文件之前读取
+	if aggregator.seq, err = recoverSeq(outputDir, serviceName); err != nil {
+		fmt.Fprintf(os.Stderr, "[条目序号] %v\n", err)
+	}
+
+	// 初始化默认聚合文件，按级别拆分的文件在第一次写入该级别时创建
+	for level := range options.levelRetention {
+		aggregator.levelOutputs[level] = &fileSet{level: level}
+	}
+	if err := aggregator.initializeFile(aggregator.output); err != nil {
+		cancel()
+		indexDB.Close()
+		lock.release()
+		return nil, err
+	}
+
+	// 启动后台任务
+	aggregator.startBackgroundTasks()
+	if options.hookQueueSize > 0 {
+		aggregator.hookQueue = newHookQueue(aggregator, options.hookQueueSize, options.hookOverflow, options.hookDropReport)
+	}
+
+	return aggregator, nil
+}
+
+// initializeFile 关闭文件集合的当前文件并打开新的聚合文件，失败时返回可以重试的fileWriteError
+// 调用方需持有batchMutex和mutex，创建聚合器时后台任务尚未启动，无需加锁
+func (la *LogAggregator) initializeFile(set *fileSet) error {
+	// 关闭现有文件
+	if set.writer != nil {
+		if err := set.writer.Flush(); err != nil {
+			set.discardPartialWrite()
+			return &fileWriteError{fmt.Errorf("刷新缓冲区失败: %w", err)}
+		}
+	}
+	if set.file != nil {
+		if err := set.file.Close(); err != nil {
+			set.file, set.out, set.writer = nil, nil, nil
+			return &fileWriteError{fmt.Errorf("关闭文件失败: %w", err)}
+		}
+	}
+
+	// 生成文件ID
+	now := time.Now()
+	if set.file != nil {
+		logRecordError(la.recordFiles([]string{set.fileID}, rotatedUpdate(now, set.offset, set.entries)))
+	}
+	prefix := la.serviceName + "_"
+	if set.level != "" {
+		prefix += set.level + "_"
+	}
+	set.fileID = fmt.Sprintf("%s%s_%03d", prefix, now.Format("2006-01-02"), la.getFileSequence(prefix, now))
+	set.offset = 0
+
+	// 创建新的聚合文件
+	filename := set.fileID + ".log"
+	filePath := filepath.Join(la.outputDir, filename)
+
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		set.file, set.out, set.writer = nil, nil, nil
+		return &fileWriteError{fmt.Errorf("创建聚合日志文件失败: %w", err)}
+	}
+
+	// 获取文件当前大小作为偏移量
+	if stat, err := file.Stat(); err == nil {
+		set.offset = stat.Size()
+	}
+
+	set.file, set.out = file, io.Writer(file)
+	if la.wrapFile != nil {
+		set.out = la.wrapFile(file)
+	}
+	set.writer = bufio.NewWriterSize(set.out, 32*1024) // 32KB缓冲
+	set.entries = 0
+	set.lastRotation = now
+	logRecordError(la.recordFiles([]string{set.fileID}, func(record *FileRecord) {
+		record.State = FileStateActive
+		record.CreatedAt = now
+	}))
+	return nil
+}
+
+// getFileSequence 获取文件集合当天的文件序列号，prefix为文件集合的文件名前缀
+// 取已有文件（包括已压缩的文件）的最大序列号加一，避免压缩后重复使用序列号而追加到旧文件
+func (la *LogAggregator) getFileSequence(prefix string, date time.Time) int {
+	prefix += date.Format("2006-01-02") + "_"
+	files, err := filepath.Glob(filepath.Join(la.outputDir, prefix+"*.log*"))
+	if err != nil {
+		return 1
+	}
+
+	maxSeq := 0
+	for _, file := range files {
+		name := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(file), ".gz"), ".log")
+		if seq, err := strconv.Atoi(strings.TrimPrefix(name, prefix)); err == nil && seq > maxSeq {
+			maxSeq = seq
+		}
+	}
+	return maxSeq + 1
+}
+
+// WriteLog 写入日志到聚合文件
+// 条目先进入批量缓冲区，达到批次大小或定时刷新时才写入文件，需要立即知道写入位置时使用WriteLogSync
+// 写入文件失败时条目留在缓冲区中由定时刷新重试，缓冲已满或持续失败超时后才返回ErrWriteFailing（参见WithWriteRetry）
+func (la *LogAggregator) WriteLog(entry LogEntry) error {
+	if ok, err := la.admit(entry.Level); !ok {
+		return err
+	}
+	if err := la.limits.Apply(&entry); err != nil {
+		return err
+	}
+
+	la.batchMutex.Lock()
+	defer la.batchMutex.Unlock()
+	if err := la.writes.admit(len(la.batchBuffer), time.Now()); err != nil {
+		return err
+	}
+	if err := la.prepareEntry(&entry); err != nil {
+		return err
+	}
+
+	// 添加到批量缓冲区
+	la.batchBuffer = append(la.batchBuffer, entry)
+
+	// 写入失败期间只由定时刷新重试，不在每次写入时访问出错的文件
+	if la.writes.failing(len(la.batchBuffer)) {
+		return nil
+	}
+
+	// 检查是否需要批量写入
+	flush := len(la.batchBuffer) >= la.batchSize
+	if la.adaptive != nil {
+		flush = la.adaptive.added(len(la.batchBuffer), time.Now())
+	}
+	if !flush {
+		return nil
+	}
+	if err := la.flushBatch(); err != nil && !isRetryableWrite(err) {
+		return err
+	}
+	return nil
+}
+
+// admit 检查聚合器是否已关闭，以及磁盘空间是否允许写入该级别的条目
+// 返回false时不写入条目，被磁盘空间保护丢弃的条目返回的错误为nil
+func (la *LogAggregator) admit(level string) (bool, error) {
+	la.closeMutex.Lock()
+	if la.closed {
+		la.closeMutex.Unlock()
+		return false, errors.New("聚合器已关闭")
+	}
+	la.closeMutex.Unlock()
+
+	// 磁盘空间不足时丢弃低级别条目或拒绝写入
+	return la.disk.admit(canonicalLevel(level))
+}
+
+// prepareEntry 填充条目的默认字段，条目所在的文件集合需要轮转时先轮转，调用方需持有batchMutex
+func (la *LogAggregator) prepareEntry(entry *LogEntry) error {
+	// Close已关闭文件（检查closed之后才开始关闭的情况）
+	if la.filesClosed {
+		return errors.New("聚合器已关闭")
+	}
+
+	// 文件ID和偏移量在flushBatch写入时设置
+	if entry.Timestamp == "" {
+		entry.Timestamp = time.Now().Format(time.RFC3339Nano)
+	}
+	entry.Level = canonicalLevel(entry.Level)
+	// 保留调用方指定的来源（如转发其他主机的日志）
+	if entry.Hostname == "" {
+		entry.Hostname = la.hostname
+	}
+	if entry.PID == 0 {
+		entry.PID = la.pid
+	}
+	// 保留更新版本写入的条目的版本号（如导入的条目）
+	if entry.SchemaVersion == 0 {
+		entry.SchemaVersion = CurrentSchemaVersion
+	}
+
+	// 条目所在的文件集合需要轮转时先轮转，之前缓冲的条目写入旧文件，本条目写入新文件
+	// 轮转失败或写入失败期间条目留在缓冲区中，由定时刷新重试写入和轮转
+	if set := la.outputFor(entry.Level); !la.writes.failing(len(la.batchBuffer)) && la.shouldRotate(set) {
+		if err := la.rotateFile(set); err != nil && !isRetryableWrite(err) {
+			return fmt.Errorf("轮转文件失败: %w", err)
+		}
+	}
+
+	// 序号在准备成功后分配，被拒绝的条目不占用序号；导入的条目也使用本聚合器的序号
+	la.seq++
+	entry.Seq = la.seq
+	return nil
+}
+
+// flushBatch 刷新批量缓冲区，调用方需持有batchMutex
+func (la *LogAggregator) flushBatch() error {
+	if len(la.batchBuffer) == 0 {
+		return nil
+	}
+
+	la.mutex.Lock()
+	defer la.mutex.Unlock()
+	return la.writeBatch()
+}
+
+// writeBatch 将批量缓冲区写入各文件集合的当前文件，调用方需持有batchMutex和mutex
+// 文件写入失败时尚未写入的条目留在缓冲区中等待重试，其他错误（如序列化失败）丢弃本批次中尚未写入的条目
+func (la *LogAggregator) writeBatch() error {
+	if len(la.batchBuffer) == 0 {
+		return nil
+	}
+	if la.filesClosed {
+		return errors.New("聚合器已关闭")
+	}
+	batch := la.batchBuffer
+
+	// 按级别拆分文件时，将同一文件集合的条目排在一起，每个集合一次写入
+	if len(la.levelOutputs) > 0 {
+		sort.SliceStable(batch, func(i, j int) bool {
+			return la.outputFor(batch[i].Level).level < la.outputFor(batch[j].Level).level
+		})
+	}
+
+	start := time.Now()
+	enc := getEntryEncoder()
+	defer putEntryEncoder(enc)
+	var err error
+	written, bytes := 0, 0
+	for written < len(batch) {
+		set := la.outputFor(batch[written].Level)
+		end := written + 1
+		for end < len(batch) && la.outputFor(batch[end].Level) == set {
+			end++
+		}
+		if err = la.writeEntries(set, batch[written:end], enc); err != nil {
+			break
+		}
+		written, bytes = end, bytes+len(enc.buf)
+	}
+	la.enqueueIndex(batch[:written])
+	la.recordFlush(written, bytes, start)
+
+	if err != nil && isRetryableWrite(err) {
+		n := copy(batch, batch[written:])
+		clear(batch[n:])
+		la.batchBuffer = batch[:n]
+		if la.writes.fail(err, n, time.Now()) {
+			fmt.Fprintf(os.Stderr, "[写入错误] %v，%d条日志留在缓冲区中等待重试\n", err, n)
+		}
+		return err
+	}
+	clear(batch)
+	la.batchBuffer = batch[:0]
+	if err == nil {
+		la.writes.succeed(written, time.Now())
+	}
+	return err
+}
+
+// writeEntries 将同一文件集合的条目写入其当前文件，文件集合还没有文件时先创建，调用方需持有batchMutex和mutex
+func (la *LogAggregator) writeEntries(set *fileSet, entries []LogEntry, enc *entryEncoder) error {
+	if set.writer == nil {
+		if err := la.initializeFile(set); err != nil {
+			return err
+		}
+	}
+
+	// 整批序列化到复用的缓冲区，一次写入文件
+	// 大于bufio缓冲区的写入会直接落盘，无需按批次大小调整writer
+	enc.buf = enc.buf[:0]
+	for i := range entries {
+		start := len(enc.buf)
+		entries[i].FileID = set.fileID
+		entries[i].Offset = set.offset + int64(start)
+		if err := enc.appendEntry(&entries[i]); err != nil {
+			return fmt.Errorf("序列化日志条目失败: %w", err)
+		}
+		if len(enc.buf)-start > la.maxEntrySize {
+			enc.buf = enc.buf[:start]
+			if err := enc.appendTruncated(&entries[i], la.maxEntrySize); err != nil {
+				return fmt.Errorf("序列化日志条目失败: %w", err)
+			}
+		}
+		enc.buf = append(enc.buf, '\n')
+	}
+
+	if _, err := set.writer.Write(enc.buf); err != nil {
+		set.discardPartialWrite()
+		return &fileWriteError{fmt.Errorf("写入日志文件失败: %w", err)}
+	}
+	if err := set.writer.Flush(); err != nil {
+		set.discardPartialWrite()
+		return &fileWriteError{fmt.Errorf("刷新文件缓冲区失败: %w", err)}
+	}
+
+	// 更新偏移量
+	set.offset += int64(len(enc.buf))
+	set.entries += len(entries)
+	return nil
+}
+
+// enqueueIndex 将已写入文件的条目加入索引队列，调用方需持有batchMutex
+func (la *LogAggregator) enqueueIndex(batch []LogEntry) {
+	// 异步添加到索引队列，关闭时队列中剩余的条目由Close建立索引
+	// 先登记再入队，查询时可扫描尚未建立索引的文件尾部
+	now := time.Now()
+	for i := range batch {
+		seq := la.indexLag.add(batch[i].FileID, batch[i].Offset, now)
+		select {
+		case la.indexQueue <- indexItem{entry: batch[i], seq: seq}:
+		default:
+			// 队列已满，跳过索引
+			la.indexLag.done(seq)
+		}
+	}
+}
+
+// outputFor 返回级别对应的文件集合，level需已规范化
+func (la *LogAggregator) outputFor(level string) *fileSet {
+	if set, ok := la.levelOutputs[level]; ok {
+		return set
+	}
+	return la.output
+}
+
+// fileSets 返回所有文件集合，默认文件集合在前，其余按级别排序
+func (la *LogAggregator) fileSets() []*fileSet {
+	sets := make([]*fileSet, 0, len(la.levelOutputs)+1)
+	sets = append(sets, la.output)
+	for _, set := range la.levelOutputs {
+		sets = append(sets, set)
+	}
+	sort.Slice(sets[1:], func(i, j int) bool { return sets[1+i].level < sets[1+j].level })
+	return sets
+}
+
+// currentFileIDs 返回各文件集合正在写入的文件ID
+func (la *LogAggregator) currentFileIDs() map[string]bool {
+	la.mutex.RLock()
+	defer la.mutex.RUnlock()
+	current := make(map[string]bool, len(la.levelOutputs)+1)
+	for _, set := range la.fileSets() {
+		if set.fileID != "" {
+			current[set.fileID] = true
+		}
+	}
+	return current
+}
+
+// addToIndex 添加到索引（在工作线程中调用），压缩索引期间等待
+func (la *LogAggregator) addToIndex(entry LogEntry) error {
+	la.indexMutex.RLock()
+	defer la.indexMutex.RUnlock()
+	if la.indexDB == nil {
+		return la.indexClosedErrLocked()
+	}
+	return la.indexDB.Update(func(tx *bbolt.Tx) error {
+		return putPostings(tx, entry)
+	})
+}
+
+// shouldRotate 检查文件集合是否需要轮转文件，还没有文件的集合在写入时创建，调用方需持有batchMutex
+func (la *LogAggregator) shouldRotate(set *fileSet) bool {
+	if set.file == nil {
+		return false
+	}
+
+	// 检查文件大小，每批写入后都会刷新，偏移量即文件大小
+	if set.offset >= la.rotationSize {
+		return true
+	}
+
+	// 检查日期变化（跨天轮转）
+	now := time.Now()
+	return now.Day() != set.lastRotation.Day() || now.Month() != set.lastRotation.Month() || now.Year() != set.lastRotation.Year()
+}
+
+// rotateFile 轮转文件集合，调用方需持有batchMutex
+func (la *LogAggregator) rotateFile(set *fileSet) error {
+	return la.rotateSets([]*fileSet{set})
+}
+
+// rotateDue 轮转大小超过轮转大小或日期已变化的文件集合，调用方需持有batchMutex
+// 没有新条目的文件集合也会在跨天后切换到新一天的文件
+func (la *LogAggregator) rotateDue() error {
+	var due []*fileSet
+	for _, set := range la.fileSets() {
+		if la.shouldRotate(set) {
+			due = append(due, set)
+		}
+	}
+	if len(due) == 0 {
+		return nil
+	}
+	return la.rotateSets(due)
+}
+
+// rotateSets 轮转多个文件集合，调用方需持有batchMutex
+// 缓冲区中的条目先写入各自的旧文件，然后在同一次持有mutex期间切换到新文件，查询不会看到中间状态
+// 条目的文件ID和偏移量在实际写入时设置，轮转前缓冲的条目不会指向新文件
+func (la *LogAggregator) rotateSets(sets []*fileSet) error {
+	la.mutex.Lock()
+	err := la.writeBatch()
+	if err != nil {
+		err = fmt.Errorf("轮转前刷新失败: %w", err)
+	} else {
+		for _, set := range sets {
+			if err = la.initializeFile(set); err != nil {
+				err = fmt.Errorf("初始化新文件失败: %w", err)
+				break
+			}
+		}
+	}
+	la.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// 清理旧文件
+	if err := la.cleanupOldFiles(); err != nil {
+		// 清理失败不影响轮转操作
+		fmt.Fprintf(os.Stderr, "[清理旧文件错误] %v\n", err)
+	}
+	return nil
+}
+
+// cleanupOldFiles 按保留策略删除超过保留期的文件（包括已压缩的文件）及其索引，跳过正在写入的文件
+// 调用方不能持有mutex和indexMutex
+func (la *LogAggregator) cleanupOldFiles() error {
+	var files []string
+	for _, pattern := range []string{"_*.log", "_*.log.gz"} {
+		matches, err := filepath.Glob(filepath.Join(la.outputDir, la.serviceName+pattern))
+		if err != nil {
+			return err
+		}
+		files = append(files, matches...)
+	}
+
+	report, deletedIDs := removeExpiredFiles(files, func(fileID string) int {
+		return la.retention.days(fileLevel(fileID, la.serviceName))
+	}, la.currentFileIDs(), false)
+
+	if len(deletedIDs) > 0 {
+		if _, err := la.removeIndexPostings(deletedIDs, false); err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("清理索引失败: %w", err))
+		}
+	}
+	return errors.Join(report.Errors...)
+}
+
+// startBackgroundTasks 启动后台任务
+func (la *LogAggregator) startBackgroundTasks() {
+	// 启动索引工作线程
+	for i := 0; i < la.indexWorkers; i++ {
+		la.wg.Add(1)
+		go func() {
+			defer la.wg.Done()
+			la.indexWorker()
+		}()
+	}
+
+	// 启动定时刷新任务，自适应刷新时按最大延迟检查
+	interval := la.flushInterval
+	if la.adaptive != nil {
+		interval = la.adaptive.tick()
+	}
+	la.batchTicker = time.NewTicker(interval)
+	la.wg.Add(2)
+	go func() {
+		defer la.wg.Done()
+		la.flushTask()
+	}()
+
+	// 启动清理和压缩任务
+	go func() {
+		defer la.wg.Done()
+		la.maintenanceTask()
+	}()
+
+	// 更新目录锁的心跳
+	la.wg.Add(1)
+	go func() {
+		defer la.wg.Done()
+		la.lockHeartbeatTask()
+	}()
+}
+
+// indexWorker 索引工作线程
+func (la *LogAggregator) indexWorker() {
+	for {
+		select {
+		case item := <-la.indexQueue:
+			if err := la.addToIndex(item.entry); err != nil {
+				// 索引失败不影响主流程，只记录错误
+				fmt.Fprintf(os.Stderr, "[索引错误] %v\n", err)
+			}
+			la.indexLag.done(item.seq)
+		case <-la.ctx.Done():
+			return
+		}
+	}
+}
+
+// drainIndexQueue 在一个事务中为索引队列中剩余的条目建立索引，在索引工作线程退出后调用
+func (la *LogAggregator) drainIndexQueue() {
+	var items []indexItem
+	for drained := false; !drained; {
+		select {
+		case item := <-la.indexQueue:
+			items = append(items, item)
+		default:
+			drained = true
+		}
+	}
+	if len(items) == 0 {
+		return
+	}
+
+	err := la.indexDB.Update(func(tx *bbolt.Tx) error {
+		for _, item := range items {
+			if err := putPostings(tx, item.entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[索引错误] %v\n", err)
+	}
+	for _, item := range items {
+		la.indexLag.done(item.seq)
+	}
+}
+
+// flushTask 定时刷新任务
+func (la *LogAggregator) flushTask() {
+	defer la.batchTicker.Stop()
+
+	for {
+		select {
+		case <-la.batchTicker.C:
+			la.batchMutex.Lock()
+			var err error
+			if la.adaptive == nil || la.adaptive.due(len(la.batchBuffer), time.Now()) {
+				err = la.flushBatch()
+			}
+			if err == nil {
+				err = la.rotateDue()
+			}
+			la.batchMutex.Unlock()
+			// 文件写入失败由writeBatch按间隔报告
+			if err != nil && !isRetryableWrite(err) {
+				fmt.Fprintf(os.Stderr, "[刷新错误] %v\n", err)
+			}
+		case <-la.ctx.Done():
+			return
+		}
+	}
+}
+
+// maintenanceTask 维护任务（压缩旧文件、清理过期文件、扫描和压缩索引），设置了磁盘空间保护时同时定期检查磁盘空间
+func (la *LogAggregator) maintenanceTask() {
+	maintenanceTicker := time.NewTicker(1 * time.Hour)
+	defer maintenanceTicker.Stop()
+
+	var diskCheck <-chan time.Time
+	if la.disk.guard.enabled() {
+		la.checkDisk()
+		diskTicker := time.NewTicker(la.disk.guard.CheckInterval)
+		defer diskTicker.Stop()
+		diskCheck = diskTicker.C
+	}
+
+	for {
+		select {
+		case <-diskCheck:
+			la.checkDisk()
+		case <-maintenanceTicker.C:
+			// 压缩旧文件
+			la.compressOldFiles()
+
+			// 清理过期文件
+			if err := la.cleanupOldFiles(); err != nil {
+				fmt.Fprintf(os.Stderr, "[清理错误] %v\n", err)
+			}
+
+			// 删除指向已不存在文件的索引条目
+			la.sweepIndexIfDue()
+
+			// 清理删除了索引条目后按需压缩索引
+			la.compactIndexIfDue()
+		case <-la.ctx.Done():
+			return
+		}
+	}
+}
+
+// compressOldFiles 压缩旧文件
+func (la *LogAggregator) compressOldFiles() {
+	la.compressFilesBefore(time.Now().Add(-la.compressAfter))
+}
+
+// compressFilesBefore 压缩修改时间早于cutoffTime的非当前文件
+func (la *LogAggregator) compressFilesBefore(cutoffTime time.Time) {
+	la.compressMutex.Lock()
+	defer la.compressMutex.Unlock()
+
+	pattern := filepath.Join(la.outputDir, la.serviceName+"_*.log")
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[获取文件列表错误] %v\n", err)
+		return
+	}
+
+	current := la.currentFileIDs()
+
+	for _, file := range files {
+		// 跳过当前正在写入的文件
+		if current[fileIDFromPath(file)] {
+			continue
+		}
+
+		stat, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+
+		// 检查文件是否过期且未压缩
+		if stat.ModTime().Before(cutoffTime) && !strings.HasSuffix(file, ".gz") {
+			if err := la.compressFile(file); err != nil {
+				fmt.Fprintf(os.Stderr, "[压缩文件错误] %s: %v\n", file, err)
+			} else {
+				// 索引条目不变，读取时按注册表中的状态打开.gz文件
+				la.lastCompression = time.Now()
+				logRecordError(la.recordFiles([]string{fileIDFromPath(file)}, func(record *FileRecord) {
+					record.State = FileStateCompressed
+					record.Path = filepath.Base(file) + ".gz"
+					record.CompressedAt = la.lastCompression
+				}))
+			}
+		}
+	}
+}
+
+// Close 关闭聚合器
+func (la *LogAggregator) Close() error {
+	// 先写入异步Hook队列中剩余的条目
+	if la.hookQueue != nil {
+		la.hookQueue.close()
+	}
+
+	la.closeMutex.Lock()
+	defer la.closeMutex.Unlock()
+
+	if la.closed {
+		return nil // 已经关闭
+	}
+	la.closed = true
+
+	// 取消上下文，停止所有后台任务
+	la.cancel()
+
+	// 等待后台任务结束
+	go func() {
+		la.wg.Wait()
+		close(la.done)
+	}()
+	select {
+	case <-la.done:
+	case <-time.After(10 * time.Second):
+		// 超时保护
+	}
+
+	// 最后一次刷新批量缓冲区并关闭文件，之后的WriteLog返回错误，不再有条目进入索引队列
+	la.batchMutex.Lock()
+	la.mutex.Lock()
+	if err := la.writeBatch(); err != nil {
+		fmt.Fprintf(os.Stderr, "[刷新错误] %v\n", err)
+	}
+	if len(la.batchBuffer) > 0 {
+		fmt.Fprintf(os.Stderr, "[刷新错误] 关闭时仍无法写入文件，丢弃%d条缓冲的日志\n", len(la.batchBuffer))
+		clear(la.batchBuffer)
+		la.batchBuffer = la.batchBuffer[:0]
+	}
+	la.filesClosed = true
+	now := time.Now()
+	for _, set := range la.fileSets() {
+		// 下次启动时创建新文件，关闭时的文件不会再被写入
+		if set.file != nil {
+			logRecordError(la.recordFiles([]string{set.fileID}, rotatedUpdate(now, set.offset, set.entries)))
+		}
+		if set.writer != nil {
+			set.writer.Flush()
+			set.writer = nil
+		}
+		if set.file != nil {
+			set.file.Close()
+			set.file = nil
+		}
+	}
+	la.mutex.Unlock()
+	la.batchMutex.Unlock()
+
+	// 为索引队列中剩余的条目建立索引，然后关闭索引数据库
+	la.indexMutex.Lock()
+	if la.indexDB != nil {
+		la.drainIndexQueue()
+		la.indexDB.Close()
+		la.indexDB = nil
+	}
+	la.indexErr = nil
+	la.indexMutex.Unlock()
+
+	// 关闭索引队列
+	close(la.indexQueue)
+
+	// 文件和索引都已关闭，其他聚合器可以使用该目录
+	la.lock.release()
+	return nil
+}
+
+// QueryLogs 查询日志
+func QueryLogs(query LogQuery, logDir string) (*LogQueryResult, error) {
+	return QueryLogsContext(context.Background(), query, logDir)
+}
+
+// QueryLogsContext 查询日志，ctx取消或超时后停止扫描文件
+// 查询参数无效时返回*QueryError（ErrInvalidQuery），日志目录不存在时返回ErrLogDirNotFound
+func QueryLogsContext(ctx context.Context, query LogQuery, logDir string) (*LogQueryResult, error) {
+	return queryLogs(ctx, query, logDir, GetGlobalAggregator())
+}
+
+// Query 先写入批量缓冲区，再查询聚合器输出目录中的日志，开启UseIndex时使用该聚合器的索引
+// 关闭后仍然可以查询已写入的条目
+func (la *LogAggregator) Query(ctx context.Context, query LogQuery) (*LogQueryResult, error) {
+	la.closeMutex.Lock()
+	closed := la.closed
+	la.closeMutex.Unlock()
+	if !closed {
+		if err := la.Flush(); err != nil {
+			return nil, err
+		}
+	}
+	return queryLogs(ctx, query, la.outputDir, la)
+}
+
+// queryLogs 查询logDir中的日志，aggregator不为nil时可以使用它的索引
+func queryLogs(ctx context.Context, query LogQuery, logDir string, aggregator *LogAggregator) (*LogQueryResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	if err := checkLogDir(logDir); err != nil {
+		return nil, err
+	}
+
+	result := &LogQueryResult{
+		Entries: make([]LogEntry, 0),
+		Limit:   query.Limit,
+		Offset:  query.Offset,
+	}
+
+	// 如果使用索引且查询条件简单，尝试使用索引
+	if query.RequireIndex {
+		switch {
+		case aggregator == nil:
+			return nil, fmt.Errorf("%w: %w", ErrIndexUnavailable, ErrNoAggregator)
+		case !canUseIndex(query):
+			return nil, fmt.Errorf("%w: 查询条件不包含索引字段", ErrIndexUnavailable)
+		}
+	}
+	stats := newQueryStats(query)
+	if (query.UseIndex || query.RequireIndex) && aggregator != nil && canUseIndex(query) {
+		stats.useIndex(query)
+		var sources map[string]time.Time
+		if query.Refs {
+			// 新条目只写入当前文件，查询前记录它们的修改时间
+			var current []string
+			for fileID := range aggregator.currentFileIDs() {
+				current = append(current, fileID+".log")
+			}
+			sources = sourceModTimes(logDir, current)
+		}
+		entries, err := queryWithIndex(ctx, query, logDir, aggregator, stats)
+		if err == nil {
+			result.Entries = mergeByTime([][]LogEntry{entries}, query.sortOrder())
+			paginate(result, query)
+			if query.Refs {
+				addSourceModTimes(sources, logDir, refFiles(result.Refs))
+				result.Sources = sources
+			}
+			stats.finish(result)
+			return result, nil
+		}
+		if query.RequireIndex {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			return nil, fmt.Errorf("%w: %w", ErrIndexUnavailable, err)
+		}
+		stats.fallback(err)
+		if admit, ok := ctx.Value(scanAdmissionKey{}).(ScanAdmitter); ok {
+			release, err := admit(ctx)
+			if err != nil {
+				return nil, err
+			}
+			defer release()
+		}
+	}
+
+	// 回退到文件扫描
+	result, err := queryWithFileScan(ctx, query, logDir, openLogReader, stats)
+	if err != nil {
+		return nil, err
+	}
+	stats.finish(result)
+	return result, nil
+}
+
+// ScanAdmitter 在文件扫描开始前获取执行名额，返回释放函数
+type ScanAdmitter func(ctx context.Context) (release func(), err error)
+
+// scanAdmissionKey context中ScanAdmitter的键
+type scanAdmissionKey struct{}
+
+// WithScanAdmission 返回携带admit的context
+// 使用索引的查询在读取索引失败、回退到文件扫描前调用admit，扫描结束后释放；admit返回错误时查询返回该错误
+func WithScanAdmission(ctx context.Context, admit ScanAdmitter) context.Context {
+	return context.WithValue(ctx, scanAdmissionKey{}, admit)
+}
+
+// CanUseIndex 检查查询是否会使用全局聚合器的索引而不是扫描文件
+// 读取索引失败时QueryLogs仍会回退到文件扫描，可通过WithScanAdmission限制回退的扫描
+func CanUseIndex(query LogQuery) bool {
+	return query.UseIndex && GetGlobalAggregator() != nil && canUseIndex(query)
+}
+
+// canUseIndex 检查是否可以使用索引
+// 至少包含一个索引字段（TraceID、SpanID、级别、服务名）时使用索引，多个条件求倒排列表交集，
+// 消息和时间范围等其他条件在读取日志后过滤
+func canUseIndex(query LogQuery) bool {
+	return len(indexConditions(query)) > 0
+}
+
+// queryWithIndex 使用索引查询，返回所有匹配的条目（未分页）
+// stats不为nil时记录各阶段的耗时和读取的文件、行数
+func queryWithIndex(ctx context.Context, query LogQuery, logDir string, aggregator *LogAggregator, stats *queryStats) ([]LogEntry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// 先记录尚未建立索引的位置再查索引：之后才完成索引的条目会被扫描到，之前完成的一定在索引中
+	tails := aggregator.indexLag.unindexed()
+
+	// 优先使用组合索引，否则求所有索引条件倒排列表的交集
+	var postings []string
+	var records map[string]FileRecord
+	start := stats.phaseStart()
+	aggregator.indexMutex.RLock()
+	if aggregator.indexDB == nil {
+		err := aggregator.indexClosedErrLocked()
+		aggregator.indexMutex.RUnlock()
+		return nil, err
+	}
+	err := aggregator.indexDB.View(func(tx *bbolt.Tx) error {
+		var err error
+		if postings, err = lookupPostings(tx, query); err != nil {
+			return err
+		}
+		records, err = lookupFileRecords(tx, postings)
+		return err
+	})
+	aggregator.indexMutex.RUnlock()
+	stats.phaseEnd("index_lookup", start)
+	if err != nil {
+		return nil, err
+	}
+	stats.postings(len(postings))
+
+	start = stats.phaseStart()
+	entries, err := readPostings(ctx, postings, query, logDir, records, stats)
+	stats.phaseEnd("read_postings", start)
+	if err != nil || len(tails) == 0 {
+		return entries, err
+	}
+
+	start = stats.phaseStart()
+	entries, err = appendUnindexed(ctx, entries, tails, query, logDir, stats)
+	stats.phaseEnd("unindexed", start)
+	return entries, err
+}
+
+// readPostings 读取候选位置的日志条目，并过滤消息、时间范围等非索引条件
+// records为文件注册表中的记录，用于确定文件在磁盘上是普通文件、.gz文件还是已被清理
+func readPostings(ctx context.Context, postings []string, query LogQuery, logDir string, records map[string]FileRecord, stats *queryStats) ([]LogEntry, error) {
+	fileIDs, offsets, err := parsePostings(postings, logDir)
+	if err != nil {
+		return nil, err
+	}
+	stats.considered(len(fileIDs))
+	entries := make([]LogEntry, 0, len(postings))
+	for _, fileID := range fileIDs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		var record *FileRecord
+		if r, ok := records[fileID]; ok {
+			record = &r
+		}
+		candidates, err := readFileEntries(logDir, fileID, record, offsets[fileID])
+		if err != nil {
+			return nil, err
+		}
+		stats.opened()
+		stats.scanned(len(candidates))
+		for _, entry := range candidates {
+			if matchesQuery(entry, query) {
+				entries = append(entries, entry)
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// readLogEntry 从文件中读取指定偏移量的日志条目
+func readLogEntry(filepath string, offset int64) (LogEntry, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return LogEntry{}, err
+	}
+	defer file.Close()
+
+	// 定位到指定偏移量
+	_, err = file.Seek(offset, 0)
+	if err != nil {
+		return LogEntry{}, err
+	}
+
+	// 读取一行
+	lines := NewLineReader(file)
+	if lines.Scan() {
+		if lines.TooLong() {
+			return LogEntry{}, ErrLineTooLong
+		}
+		var entry LogEntry
+		if err := json.Unmarshal(lines.Bytes(), &entry); err != nil {
+			return LogEntry{}, err
+		}
+		return entry, nil
+	}
+	if err := lines.Err(); err != nil {
+		return LogEntry{}, fmt.Errorf("无法读取日志条目: %w", err)
+	}
+
+	return LogEntry{}, fmt.Errorf("无法读取日志条目")
+}
+
+// queryWithFileScan 使用文件扫描查询，通过open打开每个日志文件
+func queryWithFileScan(ctx context.Context, query LogQuery, logDir string, open logOpener, stats *queryStats) (*LogQueryResult, error) {
+	// 获取所有日志文件
+	start := stats.phaseStart()
+	files, err := DiscoverLogFiles(logDir, query.DiscoverOptions())
+	if err != nil {
+		return nil, fmt.Errorf("获取日志文件失败: %w", err)
+	}
+	files = dedupeCompressedFiles(files)
+
+	// 按时间排序文件（最新的在前）
+	sort.Slice(files, func(i, j int) bool {
+		statI, _ := os.Stat(files[i])
+		statJ, _ := os.Stat(files[j])
+		return statI.ModTime().After(statJ.ModTime())
+	})
+	stats.phaseEnd("discover", start)
+	stats.considered(len(files))
+	var sources map[string]time.Time
+	if query.Refs {
+		names := make([]string, len(files))
+		for i, file := range files {
+			names[i] = RelativeLogPath(logDir, file)
+		}
+		sources = sourceModTimes(logDir, names)
+	}
+
+	start = stats.phaseStart()
+	defer stats.phaseEnd("scan", start)
+	result, err := scanLogFiles(ctx, query, files, open, func(file string) string {
+		return RelativeLogPath(logDir, file)
+	}, stats)
+	if err != nil {
+		return nil, err
+	}
+	result.Sources = sources
+	return result, nil
+}
+
+// scanLogFiles 按顺序扫描files，将各文件的结果按时间戳合并后分页，name返回文件在ParseErrors中的键
+// 时间戳相同的条目按files中的顺序排列
+// 无法读取的文件记录在ReadErrors中，严格模式下遇到无法解析的行返回*ParseError
+func scanLogFiles(ctx context.Context, query LogQuery, files []string, open logOpener, name func(file string) string, stats *queryStats) (*LogQueryResult, error) {
+	result := &LogQueryResult{
+		Entries: make([]LogEntry, 0),
+		Limit:   query.Limit,
+		Offset:  query.Offset,
+	}
+
+	groups := make([][]LogEntry, 0, len(files))
+	for _, file := range files {
+		if ctx.Err() != nil {
+			break
+		}
+
+		entries, malformed, err := queryFile(ctx, open, file, query, stats)
+		if err != nil {
+			var parseErr *ParseError
+			if errors.As(err, &parseErr) {
+				return nil, err
+			}
+			if ctx.Err() == nil {
+				// 保留出错前读到的条目，并报告出错的文件
+				if result.ReadErrors == nil {
+					result.ReadErrors = make(map[string]string)
+				}
+				result.ReadErrors[name(file)] = err.Error()
+			}
+		}
+
+		if malformed > 0 {
+			if result.ParseErrors == nil {
+				result.ParseErrors = make(map[string]int)
+			}
+			result.ParseErrors[name(file)] = malformed
+		}
+		if query.Refs {
+			for i := range entries {
+				entries[i].ref.File = name(file)
+			}
+		}
+		groups = append(groups, entries)
+	}
+	result.Entries = mergeByTime(groups, query.sortOrder())
+
+	// 查询被取消时，根据AllowPartial返回部分结果或错误
+	if err := ctx.Err(); err != nil {
+		if !query.AllowPartial {
+			return nil, err
+		}
+		result.Truncated = true
+	}
+
+	paginate(result, query)
+	return result, nil
+}
+
+// paginate 记录匹配总数并对结果应用分页，query.Refs为true时先记录所有条目的位置
+func paginate(result *LogQueryResult, query LogQuery) {
+	if query.Refs {
+		result.Refs = entryRefs(result.Entries)
+	}
+	total := len(result.Entries)
+	if query.Offset >= total {
+		result.Entries = []LogEntry{}
+	} else {
+		end := query.Offset + query.Limit
+		if end > total {
+			end = total
+		}
+		result.Entries = result.Entries[query.Offset:end]
+	}
+
+	result.Total = total
+}
+
+// queryFile 查询单个文件（.gz文件透明解压），返回匹配的条目和无法解析的行数
+// 严格模式下遇到第一条无法解析的行即返回*ParseError
+// ctx取消时返回已匹配的条目和ctx.Err()
+func queryFile(ctx context.Context, open logOpener, path string, query LogQuery, stats *queryStats) ([]LogEntry, int, error) {
+	file, err := open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+	stats.opened()
+	return scanEntries(ctx, file, filepath.Base(path), query, stats)
+}
+
+// scanEntries 逐行读取r中的日志，返回匹配的条目和无法解析的行数，name用于*ParseError
+// 超过MaxLineSize的行计入无法解析的行数，读取出错时返回已匹配的条目和错误
+// stats不为nil时记录读取的行数
+func scanEntries(ctx context.Context, r io.Reader, name string, query LogQuery, stats *queryStats) ([]LogEntry, int, error) {
+	var entries []LogEntry
+	var malformed int
+	var lineNo int
+	lines := NewLineReader(r)
+	defer func() { stats.scanned(lineNo) }()
+
+	for lines.Scan() {
+		lineNo++
+		if lineNo%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return entries, malformed, err
+			}
+		}
+
+		if lines.TooLong() {
+			if query.Strict {
+				return nil, malformed, &ParseError{File: name, Line: lineNo, Err: ErrLineTooLong}
+			}
+			malformed++
+			continue
+		}
+		line := bytes.TrimSpace(lines.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		entry, _, err := decodeEntryLine(line, query.IncludeRawLogs)
+		if err != nil {
+			if query.Strict {
+				return nil, malformed, &ParseError{File: name, Line: lineNo, Err: err}
+			}
+			malformed++
+			continue
+		}
+
+		// 应用查询条件
+		if !matchesQuery(entry, query) {
+			continue
+		}
+		if query.Refs {
+			entry.ref.Offset = lines.Offset()
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, malformed, lines.Err()
+}
+
+// CountMalformedLines 统计日志文件中无法解析为JSON的行数
+func CountMalformedLines(path string) (int, error) {
+	_, malformed, err := CountLines(path)
+	return malformed, err
+}
+
+// CountLines 一次读取统计日志文件的总行数和无法解析为JSON的行数，.gz文件透明解压
+// 超过MaxLineSize的行计入无法解析的行数
+func CountLines(path string) (lines, malformed int, err error) {
+	return CountLinesContext(context.Background(), path)
+}
+
+// CountLinesContext 与CountLines相同，ctx取消或超时后停止读取并返回ctx的错误
+func CountLinesContext(ctx context.Context, path string) (lines, malformed int, err error) {
+	reader, err := openLogReader(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer reader.Close()
+
+	scanner := NewLineReader(reader)
+	for scanner.Scan() {
+		lines++
+		if lines%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return lines, malformed, err
+			}
+		}
+		if scanner.TooLong() {
+			malformed++
+			continue
+		}
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var entry LogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			malformed++
+		}
+	}
+
+	return lines, malformed, scanner.Err()
+}
+
+// matchesQuery 检查日志条目是否匹配查询条件
+func matchesQuery(entry LogEntry, query LogQuery) bool {
+	// 检查TraceID
+	if query.TraceID != "" && entry.TraceID != query.TraceID {
+		return false
+	}
+
+	// 检查SpanID
+	if query.SpanID != "" && entry.SpanID != query.SpanID {
+		return false
+	}
+
+	// 检查日志级别
+	if query.Level != "" && canonicalLevel(entry.Level) != canonicalLevel(query.Level) {
+		return false
+	}
+
+	// 检查服务名
+	if query.Service != "" && entry.Service != query.Service {
+		return false
+	}
+
+	// 检查主机名
+	if query.Hostname != "" && entry.Hostname != query.Hostname {
+		return false
+	}
+
+	// 检查调用栈
+	if query.HasStack && !hasErrorStack(entry) {
+		return false
+	}
+
+	// 检查消息内容
+	if query.Message != "" {
+		matched, _ := regexp.MatchString(query.Message, entry.Message)
+		if !matched {
+			return false
+		}
+	}
+
+	// 检查时间范围
+	if !query.StartTime.IsZero() || !query.EndTime.IsZero() {
+		entryTime, err := time.Parse(time.RFC3339, entry.Timestamp)
+		if err != nil {
+			return false
+		}
+
+		if !query.StartTime.IsZero() && entryTime.Before(query.StartTime) {
+			return false
+		}
+
+		if !query.EndTime.IsZero() && entryTime.After(query.EndTime) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CleanupReport 日志清理结果
+type CleanupReport struct {
+	DryRun               bool     `json:"dry_run"`
+	FilesDeleted         int      `json:"files_deleted"`
+	BytesFreed           int64    `json:"bytes_freed"`
+	Files                []string `json:"files"`
+	IndexPostingsRemoved int      `json:"index_postings_removed"`
+	Errors               []error  `json:"-"`
+}
+
+// CleanupOldLogs 清理旧日志文件（包括已压缩的.log.gz文件）
+func CleanupOldLogs(logDir string, daysToKeep int) (*CleanupReport, error) {
+	return CleanupOldLogsWithDryRun(logDir, daysToKeep, false)
+}
+
+// CleanupOldLogsWithDryRun 清理旧日志文件，dryRun为true时只统计不删除
+func CleanupOldLogsWithDryRun(logDir string, daysToKeep int, dryRun bool) (*CleanupReport, error) {
+	return CleanupWithPolicy(logDir, RetentionPolicy{Default: daysToKeep}, dryRun)
+}
+
+// fileIDFromPath 从日志文件路径中提取文件ID
+func fileIDFromPath(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), ".gz")
+	return strings.TrimSuffix(name, ".log")
+}
+
+// ownsDir 检查聚合器的输出目录是否为指定目录
+func (la *LogAggregator) ownsDir(dir string) bool {
+	aggregatorDir, err := filepath.Abs(la.outputDir)
+	if err != nil {
+		return false
+	}
+	targetDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	return aggregatorDir == targetDir
+}
+
+// GetLogStats 获取日志统计信息
+func GetLogStats(logDir string) (map[string]any, error) {
+	return GetLogStatsWithOptions(logDir, DiscoverOptions{})
+}
+
+// GetLogStatsWithOptions 按指定的文件查找选项获取日志统计信息
+func GetLogStatsWithOptions(logDir string, opts DiscoverOptions) (map[string]any, error) {
+	stats, err := CollectLogStats(context.Background(), logDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"total_files":     stats.TotalFiles,
+		"total_size":      stats.TotalSize,
+		"oldest_file":     stats.OldestFile,
+		"newest_file":     stats.NewestFile,
+		"malformed_lines": stats.MalformedLines,
+		"oldest_time":     stats.OldestTime,
+		"newest_time":     stats.NewestTime,
+	}, nil
+}
+
+// CollectLogStats 统计日志目录中的文件数量、大小、最早和最新的文件以及无法解析的行数
+// ctx取消时停止统计并返回ctx.Err()
+func CollectLogStats(ctx context.Context, logDir string, opts DiscoverOptions) (*LogStats, error) {
+	files, err := DiscoverLogFiles(logDir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &LogStats{TotalFiles: len(files)}
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		stat, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		stats.TotalSize += stat.Size()
+
+		if malformed, err := CountMalformedLines(file); err == nil {
+			stats.MalformedLines += malformed
+		}
+
+		if stats.OldestTime.IsZero() || stat.ModTime().Before(stats.OldestTime) {
+			stats.OldestTime = stat.ModTime()
+			stats.OldestFile = RelativeLogPath(logDir, file)
+		}
+		if stats.NewestTime.IsZero() || stat.ModTime().After(stats.NewestTime) {
+			stats.NewestTime = stat.ModTime()
+			stats.NewestFile = RelativeLogPath(logDir, file)
+		}
+	}
+	return stats, nil
+}
+
+// 全局聚合器实例
+var globalAggregator Writer
+var aggregatorMutex sync.Mutex
+
+// SetGlobalAggregator 设置全局聚合器，可以是LogAggregator或MemoryAggregator，传入nil时清除
+// 替换另一个仍在使用的全局聚合器时会关闭它并在标准错误输出中提示，避免两个聚合器同时写入；
+// 传入nil只清除全局聚合器，不关闭之前的聚合器
+func SetGlobalAggregator(aggregator Writer) {
+	previous := swapGlobalAggregator(aggregator)
+	if previous == nil || aggregator == nil || previous == aggregator {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "[全局聚合器] 替换仍在使用的聚合器，已关闭之前的%T\n", previous)
+	if err := previous.Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "[关闭聚合器错误] %v\n", err)
+	}
+}
+
+// swapGlobalAggregator 设置全局聚合器并返回之前的聚合器，不关闭之前的聚合器
+func swapGlobalAggregator(aggregator Writer) Writer {
+	aggregatorMutex.Lock()
+	defer aggregatorMutex.Unlock()
+	// 值为nil的指针也视为清除，避免之后的nil检查失效
+	switch a := aggregator.(type) {
+	case *LogAggregator:
+		if a == nil {
+			aggregator = nil
+		}
+	case *MemoryAggregator:
+		if a == nil {
+			aggregator = nil
+		}
+	}
+	previous := globalAggregator
+	globalAggregator = aggregator
+	return previous
+}
+
+// GlobalAggregator 获取全局聚合器，没有时返回nil
+func GlobalAggregator() Writer {
+	aggregatorMutex.Lock()
+	defer aggregatorMutex.Unlock()
+	return globalAggregator
+}
+
+// GetGlobalAggregator 获取写入文件的全局聚合器，没有聚合器或全局聚合器是MemoryAggregator时返回nil
+// 索引查询、轮转、压缩和清理等依赖文件的功能使用它
+func GetGlobalAggregator() *LogAggregator {
+	aggregator, _ := GlobalAggregator().(*LogAggregator)
+	return aggregator
+}
+
+// WriteToAggregator 写入日志到全局聚合器，没有聚合器时返回ErrNoAggregator
+// 需要在没有聚合器时写入文件或默认日志器，使用WriteWithFallback
+func WriteToAggregator(entry LogEntry) error {
+	_, err := WriteWithFallback(entry, WriteFallback{Mode: FallbackNone})
+	return err
+}
+
+// 扩展logrus的Hook来支持聚合
+type AggregatorHook struct {
+	aggregator Writer
+	service    string
+	errors     hookErrorReporter
+}
+
+// NewAggregatorHook 创建新的聚合器Hook
+func NewAggregatorHook(aggregator Writer, service string) *AggregatorHook {
+	return &AggregatorHook{
+		aggregator: aggregator,
+		service:    service,
+	}
+}
+
+// Levels 返回支持的日志级别
+func (h *AggregatorHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire 处理日志条目
+// 条目的service字段为非空字符串时作为服务名（如代插件记录的日志），否则使用创建Hook时指定的服务名
+// 聚合器启用了WithHookQueue时只放入队列，不等待写入；写入失败时不返回错误，而是每个间隔向标准错误报告一次
+func (h *AggregatorHook) Fire(entry *logrus.Entry) error {
+	logEntry := LogEntry{
+		Timestamp: entry.Time.Format(time.RFC3339Nano),
+		Level:     canonicalLevel(entry.Level.String()),
+		Message:   entry.Message,
+		Service:   h.service,
+		Fields:    make(map[string]any, len(entry.Data)),
+	}
+	service, promoted := entry.Data["service"].(string)
+	if promoted = promoted && service != ""; promoted {
+		logEntry.Service = service
+	}
+
+	// 补充baggage字段，避免依赖Hook的注册顺序
+	logz.AddBaggageFields(entry)
+
+	// 提取TraceID和SpanID
+	if traceID, ok := entry.Data["trace_id"].(string); ok {
+		logEntry.TraceID = traceID
+	}
+	if spanID, ok := entry.Data["span_id"].(string); ok {
+		logEntry.SpanID = spanID
+	}
+
+	// 提取调用者信息
+	if entry.Caller != nil {
+		logEntry.Caller = fmt.Sprintf("%s:%d", filepath.Base(entry.Caller.File), entry.Caller.Line)
+	}
+
+	// 复制其他字段，与logrus的JSON格式一致，错误记录为消息
+	for key, value := range entry.Data {
+		if key == "trace_id" || key == "span_id" || (key == "service" && promoted) {
+			continue
+		}
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		logEntry.Fields[key] = value
+	}
+
+	// 写入失败时计数并按间隔报告，不返回给logrus，避免每条日志都输出一行"Failed to fire hook"
+	var err error
+	if la, ok := h.aggregator.(*LogAggregator); ok && la.hookQueue != nil {
+		err = la.hookQueue.enqueue(logEntry)
+	} else {
+		err = h.aggregator.WriteLog(logEntry)
+	}
+	if err != nil {
+		h.errors.record(err, time.Now())
+	}
+	return nil
+}
+
+// Errors 返回Fire写入聚合器失败的累计次数
+func (h *AggregatorHook) Errors() uint64 {
+	return h.errors.count()
+}
+
+// hasErrorStack 条目是否带有调用栈字段
+func hasErrorStack(entry LogEntry) bool {
+	stack, ok := entry.Fields[logz.ErrorStackKey].(string)
+	return ok && stack != ""
+}
@@ -0,0 +1,263 @@
+package aggregate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// benchEntry 返回用于测试的典型日志条目
+func benchEntry(i int) LogEntry {
+	return LogEntry{
+		Timestamp: "2024-01-15T10:30:00+08:00",
+		Level:     "info",
+		Message:   fmt.Sprintf("处理请求 <user-%d> & 返回结果", i),
+		TraceID:   fmt.Sprintf("trace-%08d", i),
+		SpanID:    fmt.Sprintf("span-%08d", i),
+		Caller:    "handler.go:42",
+		Fields:    map[string]any{"user_id": i, "path": "/api/v1/users", "ok": true},
+		Service:   "bench-service",
+		FileID:    "bench-service_2024-01-15_001",
+		Offset:    int64(i) * 256,
+	}
+}
+
+func TestFlushBatchOutputFormat(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "format-service", WithBatchSize(10000))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+
+	var expected bytes.Buffer
+	for i := 0; i < 50; i++ {
+		entry := benchEntry(i)
+		if err := aggregator.WriteLog(entry); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+
+		// 写入时记录每条日志的来源、格式版本、序号、所在的文件和起始偏移量
+		entry.Hostname, entry.PID = aggregator.hostname, aggregator.pid
+		entry.SchemaVersion = CurrentSchemaVersion
+		entry.Seq = uint64(i + 1)
+		entry.FileID = aggregator.output.fileID
+		entry.Offset = int64(expected.Len())
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			t.Fatalf("序列化失败: %v", err)
+		}
+		expected.Write(data)
+		expected.WriteByte('\n')
+	}
+	if err := aggregator.Flush(); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+
+	actual, err := os.ReadFile(filepath.Join(dir, aggregator.output.fileID+".log"))
+	if err != nil {
+		t.Fatalf("读取聚合文件失败: %v", err)
+	}
+	if !bytes.Equal(actual, expected.Bytes()) {
+		t.Errorf("输出格式与json.Marshal不一致\n期望: %s\n得到: %s", expected.Bytes(), actual)
+	}
+	if aggregator.output.offset != int64(expected.Len()) {
+		t.Errorf("偏移量错误: 期望 %d，得到 %d", expected.Len(), aggregator.output.offset)
+	}
+}
+
+func BenchmarkWriteLog(b *testing.B) {
+	aggregator, err := NewLogAggregatorWithOptions(b.TempDir(), "bench-service", WithBatchSize(1000))
+	if err != nil {
+		b.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+
+	entry := benchEntry(1)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := aggregator.WriteLog(entry); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFlushBatch(b *testing.B) {
+	for _, size := range []int{100, 1000, 10000} {
+		b.Run(fmt.Sprintf("entries=%d", size), func(b *testing.B) {
+			aggregator, err := NewLogAggregatorWithOptions(b.TempDir(), "bench-service", WithBatchSize(10000))
+			if err != nil {
+				b.Fatalf("创建聚合器失败: %v", err)
+			}
+			defer aggregator.Close()
+
+			entries := make([]LogEntry, size)
+			for i := range entries {
+				entries[i] = benchEntry(i)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				aggregator.batchMutex.Lock()
+				aggregator.batchBuffer = append(aggregator.batchBuffer, entries...)
+				err := aggregator.flushBatch()
+				aggregator.batchMutex.Unlock()
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestEntryEncoderMatchesJSONMarshal(t *testing.T) {
+	entries := []LogEntry{
+		{},
+		benchEntry(7),
+		{
+			Timestamp: "2024-01-15T10:30:00Z",
+			Level:     "error",
+			Message:   "quote \" backslash \\ ctrl \x01\b\f\n\r\t html <a href='x'>&</a> 中文    bad \xff\xfe end",
+			Fields: map[string]any{
+				"nil":      nil,
+				"float":    0.1,
+				"tiny":     1e-7,
+				"huge":     1e21,
+				"negzero":  math.Copysign(0, -1),
+				"int8":     int8(-8),
+				"uint64":   uint64(math.MaxUint64),
+				"float32":  float32(1.5),
+				"slice":    []string{"a", "<b>"},
+				"nested":   map[string]any{"z": 1, "a": "x"},
+				"err":      errors.New("boom"),
+				"time":     time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC),
+				"<escape>": "key needs escaping",
+			},
+			Hostname:      "replica-1",
+			PID:           4242,
+			Offset:        -1,
+			Truncated:     true,
+			FieldsDropped: 3,
+			SchemaVersion: CurrentSchemaVersion,
+			Extra: map[string]json.RawMessage{
+				"stack": json.RawMessage(`[ "a.go:1", "<b>" ]`),
+				"level": json.RawMessage(`"shadow"`),
+			},
+		},
+	}
+
+	enc := getEntryEncoder()
+	defer putEntryEncoder(enc)
+	for i := range entries {
+		expected, err := json.Marshal(entries[i])
+		if err != nil {
+			t.Fatalf("json.Marshal失败: %v", err)
+		}
+		enc.buf = enc.buf[:0]
+		if err := enc.appendEntry(&entries[i]); err != nil {
+			t.Fatalf("序列化失败: %v", err)
+		}
+		if !bytes.Equal(enc.buf, expected) {
+			t.Errorf("第%d条输出不一致\n期望: %s\n得到: %s", i, expected, enc.buf)
+		}
+	}
+
+	enc.buf = enc.buf[:0]
+	if err := enc.appendEntry(&LogEntry{Fields: map[string]any{"nan": math.NaN()}}); err == nil {
+		t.Error("NaN应返回错误，与json.Marshal一致")
+	}
+}
+
+// BenchmarkAggregatorHookFire 比较同步写入和异步队列下Fire的耗时，"stalled"时写入协程阻塞在批量缓冲区的锁上
+func BenchmarkAggregatorHookFire(b *testing.B) {
+	modes := []struct {
+		name    string
+		opts    []AggregatorOption
+		stalled bool
+	}{
+		{"sync", nil, false},
+		{"queue", []AggregatorOption{WithHookQueue(65536, OverflowDrop)}, false},
+		{"queue-stalled", []AggregatorOption{WithHookQueue(65536, OverflowDrop)}, true},
+	}
+	for _, mode := range modes {
+		b.Run(mode.name, func(b *testing.B) {
+			opts := append([]AggregatorOption{WithBatchSize(1000)}, mode.opts...)
+			aggregator, err := NewLogAggregatorWithOptions(b.TempDir(), "bench-service", opts...)
+			if err != nil {
+				b.Fatalf("创建聚合器失败: %v", err)
+			}
+			defer aggregator.Close()
+			hook := NewAggregatorHook(aggregator, "bench-service")
+			if mode.stalled {
+				aggregator.batchMutex.Lock()
+				defer aggregator.batchMutex.Unlock()
+			}
+
+			entry := &logrus.Entry{
+				Time:    time.Now(),
+				Level:   logrus.InfoLevel,
+				Message: "处理请求",
+				Data:    logrus.Fields{"trace_id": "trace-00000001", "span_id": "span-00000001", "user_id": 1},
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := hook.Fire(entry); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkBurstyFlush 比较固定批量和自适应刷新在突发写入下的刷新次数和单次写入的尾延迟
+// 每次突发写入2000条后空闲2ms，flushes/1k-writes越少系统调用越少
+func BenchmarkBurstyFlush(b *testing.B) {
+	configs := map[string][]AggregatorOption{
+		"fixed":    nil,
+		"adaptive": {WithAdaptiveFlush(0, 0)},
+	}
+	for _, name := range []string{"fixed", "adaptive"} {
+		b.Run(name, func(b *testing.B) {
+			aggregator, err := NewLogAggregatorWithOptions(b.TempDir(), "bench-service", configs[name]...)
+			if err != nil {
+				b.Fatalf("创建聚合器失败: %v", err)
+			}
+			defer aggregator.Close()
+
+			entry := benchEntry(1)
+			latencies := make([]time.Duration, 0, b.N)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if i > 0 && i%2000 == 0 {
+					b.StopTimer()
+					time.Sleep(2 * time.Millisecond)
+					b.StartTimer()
+				}
+				start := time.Now()
+				if err := aggregator.WriteLog(entry); err != nil {
+					b.Fatal(err)
+				}
+				latencies = append(latencies, time.Since(start))
+			}
+			b.StopTimer()
+
+			slices.Sort(latencies)
+			b.ReportMetric(float64(latencies[len(latencies)*99/100].Nanoseconds()), "p99-ns/write")
+			b.ReportMetric(float64(aggregator.Stats().Flushes.Count)*1000/float64(b.N), "flushes/1k-writes")
+		})
+	}
+}
@@ -0,0 +1,515 @@
+package aggregate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"go.etcd.io/bbolt"
+)
+
+// writeBackdatedFile 创建文件并将修改时间设置为指定天数之前
+func writeBackdatedFile(t *testing.T, path, content string, daysAgo int) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("创建测试文件失败: %v", err)
+	}
+	mtime := time.Now().AddDate(0, 0, -daysAgo)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatalf("设置文件修改时间失败: %v", err)
+	}
+}
+
+func TestCleanupOldLogs(t *testing.T) {
+	dir := t.TempDir()
+	writeBackdatedFile(t, filepath.Join(dir, "old.log"), "old log line\n", 10)
+	writeBackdatedFile(t, filepath.Join(dir, "old.log.gz"), "compressed", 10)
+	writeBackdatedFile(t, filepath.Join(dir, "recent.log"), "recent log line\n", 1)
+
+	t.Run("DryRun", func(t *testing.T) {
+		report, err := CleanupOldLogsWithDryRun(dir, 7, true)
+		if err != nil {
+			t.Fatalf("清理失败: %v", err)
+		}
+		if report.FilesDeleted != 2 {
+			t.Errorf("期望统计到2个文件，得到 %d", report.FilesDeleted)
+		}
+		if report.BytesFreed != int64(len("old log line\n")+len("compressed")) {
+			t.Errorf("释放字节数错误: %d", report.BytesFreed)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "old.log")); err != nil {
+			t.Error("dry run不应删除文件")
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		report, err := CleanupOldLogs(dir, 7)
+		if err != nil {
+			t.Fatalf("清理失败: %v", err)
+		}
+		if report.FilesDeleted != 2 {
+			t.Errorf("期望删除2个文件，得到 %d", report.FilesDeleted)
+		}
+		if len(report.Errors) != 0 {
+			t.Errorf("期望没有错误，得到 %v", report.Errors)
+		}
+		for _, name := range []string{"old.log", "old.log.gz"} {
+			if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+				t.Errorf("文件%s应该已被删除", name)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(dir, "recent.log")); err != nil {
+			t.Error("未过期的文件不应被删除")
+		}
+	})
+}
+
+func TestCleanupOldLogsRemovesIndexPostings(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregator(dir, "cleanup-service", 0, 0)
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+	SetGlobalAggregator(aggregator)
+	defer SetGlobalAggregator(nil)
+
+	oldFileID := "cleanup-service_2020-01-01_001"
+	writeBackdatedFile(t, filepath.Join(dir, oldFileID+".log.gz"), "compressed", 30)
+	entry := LogEntry{
+		Timestamp: "2020-01-01T00:00:00Z",
+		Level:     "info",
+		TraceID:   "trace-old",
+		FileID:    oldFileID,
+	}
+	if err := aggregator.addToIndex(entry); err != nil {
+		t.Fatalf("添加索引失败: %v", err)
+	}
+
+	// trace_id、level、time三个倒排列表和trace_time组合索引各一条
+	report, err := CleanupOldLogsWithDryRun(dir, 7, true)
+	if err != nil {
+		t.Fatalf("清理失败: %v", err)
+	}
+	if report.IndexPostingsRemoved != 4 {
+		t.Errorf("期望统计到4条索引，得到 %d", report.IndexPostingsRemoved)
+	}
+
+	report, err = CleanupOldLogs(dir, 7)
+	if err != nil {
+		t.Fatalf("清理失败: %v", err)
+	}
+	if report.FilesDeleted != 1 {
+		t.Errorf("期望删除1个文件，得到 %d", report.FilesDeleted)
+	}
+	if report.IndexPostingsRemoved != 4 {
+		t.Errorf("期望清理4条索引，得到 %d", report.IndexPostingsRemoved)
+	}
+
+	aggregator.indexDB.View(func(tx *bbolt.Tx) error {
+		if value := tx.Bucket([]byte("trace_id")).Get([]byte("trace-old")); value != nil {
+			t.Errorf("索引条目应该已被删除，得到 %s", value)
+		}
+		return nil
+	})
+}
+
+// writeMixedLogFile 创建一个夹杂无效行的日志文件
+func writeMixedLogFile(t *testing.T, dir string) string {
+	t.Helper()
+	content := `{"timestamp":"2024-01-15T10:30:00Z","level":"info","msg":"first","trace_id":"trace-1"}
+plain text line written by another service
+{"timestamp":"2024-01-15T10:30:01Z","level":"error","msg":"second","trace_id":"trace-1"}
+{"timestamp":"2024-01-15T10:30:02Z","level":
+{"timestamp":"2024-01-15T10:30:03Z","level":"info","msg":"third","trace_id":"trace-2"}
+`
+	path := filepath.Join(dir, "mixed.log")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+	return path
+}
+
+func TestQueryLogsParseErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeMixedLogFile(t, dir)
+
+	t.Run("Lenient", func(t *testing.T) {
+		result, err := QueryLogsWithoutIndex(LogQuery{TraceID: "trace-1", Limit: 10}, dir)
+		if err != nil {
+			t.Fatalf("查询失败: %v", err)
+		}
+		if result.Total != 2 {
+			t.Errorf("期望2条结果，得到 %d", result.Total)
+		}
+		if result.ParseErrors["mixed.log"] != 2 {
+			t.Errorf("期望mixed.log有2行无效数据，得到 %v", result.ParseErrors)
+		}
+	})
+
+	t.Run("Strict", func(t *testing.T) {
+		_, err := QueryLogsWithoutIndex(LogQuery{TraceID: "trace-1", Limit: 10, Strict: true}, dir)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Fatalf("期望ParseError，得到 %v", err)
+		}
+		if parseErr.File != "mixed.log" || parseErr.Line != 2 {
+			t.Errorf("期望错误位置 mixed.log:2，得到 %s:%d", parseErr.File, parseErr.Line)
+		}
+	})
+
+	t.Run("Stats", func(t *testing.T) {
+		stats, err := GetLogStats(dir)
+		if err != nil {
+			t.Fatalf("获取统计信息失败: %v", err)
+		}
+		if stats["malformed_lines"] != 2 {
+			t.Errorf("期望2行无效数据，得到 %v", stats["malformed_lines"])
+		}
+	})
+
+	t.Run("CountLinesGzip", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		writeCompressionPair(t, path, 0, 3)
+		lines, malformed, err := CountLines(path + ".gz")
+		if err != nil {
+			t.Fatalf("统计行数失败: %v", err)
+		}
+		if lines != 3 || malformed != 0 {
+			t.Errorf("期望3行且无无效数据，得到 %d 行 %d 行无效", lines, malformed)
+		}
+	})
+}
+
+func TestQueryLogsContextCancellation(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 5; i++ {
+		path := filepath.Join(dir, fmt.Sprintf("app-%d.log", i))
+		writeBackdatedFile(t, path, `{"timestamp":"2024-01-15T10:30:00Z","level":"info","msg":"hit","trace_id":"trace-1"}`+"\n", i)
+	}
+
+	// 打开第一个文件后取消查询
+	runQuery := func(allowPartial bool) (*LogQueryResult, int, error) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		opened := 0
+		open := func(name string) (io.ReadCloser, error) {
+			opened++
+			cancel()
+			return openLogReader(name)
+		}
+
+		query := LogQuery{TraceID: "trace-1", Limit: 10, AllowPartial: allowPartial}
+		result, err := queryWithFileScan(ctx, query, dir, open, nil)
+		return result, opened, err
+	}
+
+	t.Run("Error", func(t *testing.T) {
+		_, opened, err := runQuery(false)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("期望context.Canceled，得到 %v", err)
+		}
+		if opened != 1 {
+			t.Errorf("取消后应停止扫描，打开了%d个文件", opened)
+		}
+	})
+
+	t.Run("Partial", func(t *testing.T) {
+		result, opened, err := runQuery(true)
+		if err != nil {
+			t.Fatalf("期望返回部分结果，得到错误 %v", err)
+		}
+		if !result.Truncated || result.Total != 1 {
+			t.Errorf("期望1条不完整的结果，得到 truncated=%v total=%d", result.Truncated, result.Total)
+		}
+		if opened != 1 {
+			t.Errorf("取消后应停止扫描，打开了%d个文件", opened)
+		}
+	})
+}
+
+// assertPostings 检查索引桶中的每条倒排索引都指向被索引的条目，返回被索引的值，值重复时报错
+// id返回条目中与索引桶对应的字段
+func assertPostings(t *testing.T, db *bbolt.DB, dir, bucket string, id func(LogEntry) string) map[string]bool {
+	t.Helper()
+	indexed := make(map[string]bool)
+	err := db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).ForEach(func(k, v []byte) error {
+			term, posting, _ := splitPostingKey(k)
+			fileID, offsets, err := parsePostings([]string{posting}, dir)
+			if err != nil {
+				return err
+			}
+			entries, err := readLogEntries(filepath.Join(dir, fileID[0]+".log"), offsets[fileID[0]])
+			if err != nil {
+				return fmt.Errorf("%s: %w", posting, err)
+			}
+			got := entries[0]
+			if id(got) != term || got.FileID != fileID[0] || got.Offset != offsets[fileID[0]][0] {
+				t.Errorf("%s索引 %s -> %s 指向了 %s（%s:%d）", bucket, term, posting, id(got), got.FileID, got.Offset)
+			}
+			if indexed[term] {
+				t.Errorf("%s 被重复索引", term)
+			}
+			indexed[term] = true
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatalf("读取索引失败: %v", err)
+	}
+	return indexed
+}
+
+func TestConcurrentWriteLogWithRotation(t *testing.T) {
+	const (
+		writers   = 50
+		perWriter = 100
+	)
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "stress",
+		WithRotationSize(4096),
+		WithBatchSize(7),
+		WithFlushInterval(time.Millisecond),
+		WithIndexQueueSize(writers*perWriter),
+		WithRetentionPolicy(RetentionPolicy{Levels: map[string]int{"error": 30}}),
+	)
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+
+	// 写入的同时轮转、定时刷新和读取元数据
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				aggregator.Describe()
+			}
+		}
+	}()
+
+	// 所有条目使用同一时间戳，轮转前后同一毫秒内写入的条目也要指向正确的文件
+	timestamp := time.Now().Format(time.RFC3339Nano)
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				level := "info"
+				if i%5 == 0 {
+					level = "error"
+				}
+				entry := LogEntry{
+					Timestamp: timestamp,
+					Level:     level,
+					Message:   fmt.Sprintf("writer %d entry %d", w, i),
+					TraceID:   fmt.Sprintf("trace-%d-%d", w, i),
+					SpanID:    fmt.Sprintf("span-%d-%d", w, i),
+					Service:   "stress",
+				}
+				if err := aggregator.WriteLog(entry); err != nil {
+					t.Errorf("写入日志失败: %v", err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+	if err := aggregator.Close(); err != nil {
+		t.Fatalf("关闭聚合器失败: %v", err)
+	}
+	if err := aggregator.WriteLog(LogEntry{Message: "after close"}); err == nil {
+		t.Error("关闭后写入应返回错误")
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "stress_*.log"))
+	levelFiles, _ := filepath.Glob(filepath.Join(dir, "stress_error_*.log"))
+	if len(files)-len(levelFiles) < 2 || len(levelFiles) < 2 {
+		t.Fatalf("期望两个文件集合都发生轮转，得到 %d 个文件，其中error级别 %d 个", len(files), len(levelFiles))
+	}
+
+	db, err := bbolt.Open(filepath.Join(dir, "index", "stress.db"), 0600, &bbolt.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("打开索引失败: %v", err)
+	}
+	defer db.Close()
+
+	// 每条trace_id和span_id索引都指向写入该条目的文件和偏移量
+	traces := assertPostings(t, db, dir, "trace_id", func(e LogEntry) string { return e.TraceID })
+	spans := assertPostings(t, db, dir, "span_id", func(e LogEntry) string { return e.SpanID })
+	if len(traces) != writers*perWriter || len(spans) != writers*perWriter {
+		t.Errorf("期望索引 %d 条日志，得到 %d、%d", writers*perWriter, len(traces), len(spans))
+	}
+
+	// 每条日志恰好写入一次
+	var lines int
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("读取数据文件失败: %v", err)
+		}
+		lines += strings.Count(string(data), "\n")
+	}
+	if lines != writers*perWriter {
+		t.Errorf("期望写入 %d 行，得到 %d", writers*perWriter, lines)
+	}
+}
+
+func TestRotateAcrossDays(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "daily", WithBatchSize(100), WithFlushInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+
+	write := func(start, end int) {
+		for i := start; i < end; i++ {
+			if err := aggregator.WriteLog(LogEntry{Level: "info", Message: "m", TraceID: fmt.Sprintf("trace-%d", i)}); err != nil {
+				t.Fatalf("写入日志失败: %v", err)
+			}
+		}
+	}
+
+	// 模拟文件在前一天打开，缓冲区中还有未写入的条目
+	write(0, 3)
+	aggregator.batchMutex.Lock()
+	oldFileID := aggregator.output.fileID
+	aggregator.output.lastRotation = aggregator.output.lastRotation.AddDate(0, 0, -1)
+	aggregator.batchMutex.Unlock()
+
+	// 定时刷新时先将缓冲的条目写入旧文件，再切换到新文件
+	aggregator.batchMutex.Lock()
+	err = aggregator.flushBatch()
+	if err == nil {
+		err = aggregator.rotateDue()
+	}
+	newFileID, newOffset := aggregator.output.fileID, aggregator.output.offset
+	aggregator.batchMutex.Unlock()
+	if err != nil {
+		t.Fatalf("轮转失败: %v", err)
+	}
+	if newFileID == oldFileID || newOffset != 0 {
+		t.Fatalf("期望切换到新文件，得到 %s:%d", newFileID, newOffset)
+	}
+
+	// 跨天后第一次写入时轮转：之前缓冲的条目写入旧文件，新条目写入新文件
+	write(3, 5)
+	aggregator.batchMutex.Lock()
+	aggregator.output.lastRotation = aggregator.output.lastRotation.AddDate(0, 0, -1)
+	aggregator.batchMutex.Unlock()
+	write(5, 6)
+	if err := aggregator.Flush(); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+	aggregator.batchMutex.Lock()
+	lastFileID := aggregator.output.fileID
+	aggregator.batchMutex.Unlock()
+
+	aggregator.indexMutex.RLock()
+	traces := assertPostings(t, aggregator.indexDB, dir, "trace_id", func(e LogEntry) string { return e.TraceID })
+	fileOf := make(map[string]string)
+	err = aggregator.indexDB.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("trace_id")).ForEach(func(k, v []byte) error {
+			term, posting, _ := splitPostingKey(k)
+			fileID, _, _ := strings.Cut(posting, ":")
+			fileOf[term] = fileID
+			return nil
+		})
+	})
+	aggregator.indexMutex.RUnlock()
+	if err != nil {
+		t.Fatalf("读取索引失败: %v", err)
+	}
+	if len(traces) != 6 {
+		t.Fatalf("期望索引 6 条日志，得到 %d", len(traces))
+	}
+	for i, fileID := range []string{oldFileID, oldFileID, oldFileID, newFileID, newFileID, lastFileID} {
+		if got := fileOf[fmt.Sprintf("trace-%d", i)]; got != fileID {
+			t.Errorf("trace-%d: 期望写入 %s，得到 %s", i, fileID, got)
+		}
+	}
+	if lastFileID == newFileID {
+		t.Error("期望跨天后写入时轮转")
+	}
+}
+
+func TestAggregatorHookServiceOverride(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "host", WithBatchSize(1))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+	SetGlobalAggregator(aggregator)
+	defer SetGlobalAggregator(nil)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	logger.AddHook(NewAggregatorHook(aggregator, "host"))
+	logger.WithFields(logrus.Fields{"service": "plugin-a", "trace_id": "trace-1", "plugin_version": 2}).Info("from plugin")
+	logger.WithField("trace_id", "trace-1").Info("from host")
+	logger.WithFields(logrus.Fields{"service": "", "trace_id": "trace-1"}).Info("empty service")
+	logger.WithFields(logrus.Fields{"service": 42, "trace_id": "trace-1"}).Info("non-string service")
+
+	waitIndexed(t, aggregator)
+	for _, useIndex := range []bool{true, false} {
+		result, err := QueryLogs(LogQuery{TraceID: "trace-1", UseIndex: useIndex, Limit: 10}, dir)
+		if err != nil {
+			t.Fatalf("查询失败: %v", err)
+		}
+		services := make(map[string]string)
+		for _, entry := range result.Entries {
+			services[entry.Message] = entry.Service
+			_, hasService := entry.Fields["service"]
+			if wantField := entry.Message == "empty service" || entry.Message == "non-string service"; hasService != wantField {
+				t.Errorf("%s: 期望Fields中有service=%v，得到 %v", entry.Message, wantField, entry.Fields)
+			}
+		}
+		want := map[string]string{"from plugin": "plugin-a", "from host": "host", "empty service": "host", "non-string service": "host"}
+		for message, service := range want {
+			if services[message] != service {
+				t.Errorf("UseIndex=%v %s: 期望服务 %s，得到 %s", useIndex, message, service, services[message])
+			}
+		}
+
+		// 服务索引使用条目自己的服务名
+		result, err = QueryLogs(LogQuery{Service: "plugin-a", UseIndex: useIndex, Limit: 10}, dir)
+		if err != nil {
+			t.Fatalf("查询失败: %v", err)
+		}
+		if result.Total != 1 || result.Entries[0].Message != "from plugin" || result.Entries[0].Fields["plugin_version"] != float64(2) {
+			t.Errorf("UseIndex=%v: 期望按plugin-a查询到插件日志，得到 %+v", useIndex, result.Entries)
+		}
+	}
+}
+
+func TestDetectServiceName(t *testing.T) {
+	t.Setenv("OTEL_SERVICE_NAME", " checkout ")
+	if got := detectServiceName(); got != "checkout" {
+		t.Errorf("期望使用OTEL_SERVICE_NAME，得到 %q", got)
+	}
+
+	t.Setenv("OTEL_SERVICE_NAME", "")
+	if got, want := detectServiceName(), strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe"); got != want {
+		t.Errorf("期望使用程序名 %q，得到 %q", want, got)
+	}
+}
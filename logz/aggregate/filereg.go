@@ -0,0 +1,293 @@
+package aggregate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// filesBucket 索引数据库中的文件注册表，键为文件ID，值为JSON编码的FileRecord
+// 注册表不是索引，重建索引时保留
+const filesBucket = "files"
+
+// 文件注册表中文件的状态
+const (
+	FileStateActive     = "active"     // 正在写入
+	FileStateRotated    = "rotated"    // 已轮转，不再写入
+	FileStateCompressed = "compressed" // 已压缩为.log.gz
+	FileStateDeleted    = "deleted"    // 已被保留策略清理
+)
+
+// FileRecord 聚合文件的注册表记录，记录每个文件ID的轮转、压缩和清理历史
+type FileRecord struct {
+	FileID       string    `json:"file_id"`
+	Path         string    `json:"path"` // 当前在磁盘上的文件名（相对于输出目录），压缩后为.log.gz
+	State        string    `json:"state"`
+	CreatedAt    time.Time `json:"created_at"`
+	RotatedAt    time.Time `json:"rotated_at,omitzero"`
+	CompressedAt time.Time `json:"compressed_at,omitzero"`
+	DeletedAt    time.Time `json:"deleted_at,omitzero"`
+	SizeBytes    int64     `json:"size_bytes"`  // 压缩前的大小，轮转时记录，正在写入的文件为当前大小
+	EntryCount   int       `json:"entry_count"` // 本进程写入的条目数，轮转时记录
+}
+
+// LogFileRemovedError 索引指向的文件已被保留策略清理，errors.Is(err, ErrLogFileRemoved)为true
+type LogFileRemovedError struct {
+	FileID    string
+	DeletedAt time.Time
+}
+
+// Error 实现error接口
+func (e *LogFileRemovedError) Error() string {
+	return fmt.Sprintf("%s: %s（%s清理）", ErrLogFileRemoved, e.FileID, e.DeletedAt.Format(time.RFC3339))
+}
+
+// Unwrap 返回ErrLogFileRemoved
+func (e *LogFileRemovedError) Unwrap() error {
+	return ErrLogFileRemoved
+}
+
+// getFileRecord 读取文件ID的注册表记录，没有记录时返回false
+func getFileRecord(bucket *bbolt.Bucket, fileID string) (FileRecord, bool, error) {
+	data := bucket.Get([]byte(fileID))
+	if data == nil {
+		return FileRecord{}, false, nil
+	}
+	var record FileRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return FileRecord{}, false, fmt.Errorf("解析文件记录%s失败: %w", fileID, err)
+	}
+	return record, true, nil
+}
+
+// updateFileRecords 修改多个文件ID的注册表记录，没有记录时update收到只设置了FileID的新记录
+func updateFileRecords(tx *bbolt.Tx, fileIDs []string, update func(*FileRecord)) error {
+	bucket, err := tx.CreateBucketIfNotExists([]byte(filesBucket))
+	if err != nil {
+		return fmt.Errorf("创建文件注册表失败: %w", err)
+	}
+	for _, fileID := range fileIDs {
+		record, found, err := getFileRecord(bucket, fileID)
+		if err != nil {
+			return err
+		}
+		if !found {
+			record = FileRecord{FileID: fileID, Path: fileID + ".log"}
+		}
+		update(&record)
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if err := bucket.Put([]byte(fileID), data); err != nil {
+			return fmt.Errorf("写入文件记录%s失败: %w", fileID, err)
+		}
+	}
+	return nil
+}
+
+// recordFiles 在索引数据库中修改文件记录，索引不可用时返回错误
+// 注册表只用于诊断和解析文件位置，调用方记录错误后继续，缺少记录时读取按扩展名查找文件
+func (la *LogAggregator) recordFiles(fileIDs []string, update func(*FileRecord)) error {
+	if len(fileIDs) == 0 {
+		return nil
+	}
+	la.indexMutex.RLock()
+	defer la.indexMutex.RUnlock()
+	if la.indexDB == nil {
+		return la.indexClosedErrLocked()
+	}
+	return la.indexDB.Update(func(tx *bbolt.Tx) error {
+		return updateFileRecords(tx, fileIDs, update)
+	})
+}
+
+// logRecordError 输出文件注册表的更新错误
+func logRecordError(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[文件注册表错误] %v\n", err)
+	}
+}
+
+// rotatedUpdate 返回把文件记录标记为已轮转的更新函数，size和entries为文件集合轮转前的偏移量和写入条数
+func rotatedUpdate(now time.Time, size int64, entries int) func(*FileRecord) {
+	return func(record *FileRecord) {
+		record.State = FileStateRotated
+		record.RotatedAt = now
+		record.SizeBytes = size
+		record.EntryCount += entries
+	}
+}
+
+// reconcileFileRegistry 按磁盘上的文件修正上次运行留下的记录，在创建当前文件之前调用
+// 上次运行时正在写入的文件标记为已轮转；只剩.log.gz的标记为已压缩；两者都不存在的（被外部删除）标记为已删除
+func (la *LogAggregator) reconcileFileRegistry() error {
+	now := time.Now()
+	return la.indexDB.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(filesBucket))
+		if bucket == nil {
+			return nil
+		}
+		var stale []FileRecord
+		err := bucket.ForEach(func(k, v []byte) error {
+			var record FileRecord
+			if err := json.Unmarshal(v, &record); err != nil || record.State == FileStateDeleted {
+				return nil
+			}
+			plain := filepath.Join(la.outputDir, record.FileID+".log")
+			switch {
+			case fileExists(plain):
+				if record.State != FileStateActive {
+					return nil
+				}
+				record.State = FileStateRotated
+				record.RotatedAt = now
+				if stat, err := os.Stat(plain); err == nil {
+					record.SizeBytes = stat.Size()
+				}
+			case fileExists(plain + ".gz"):
+				if record.State == FileStateCompressed {
+					return nil
+				}
+				record.State = FileStateCompressed
+				record.Path = record.FileID + ".log.gz"
+				record.CompressedAt = now
+			default:
+				record.State = FileStateDeleted
+				record.DeletedAt = now
+			}
+			stale = append(stale, record)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, record := range stale {
+			data, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(record.FileID), data); err != nil {
+				return fmt.Errorf("写入文件记录%s失败: %w", record.FileID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// fileExists 检查文件是否存在
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// lookupFileRecords 读取日志位置所在文件的注册表记录，没有记录的文件不在结果中
+func lookupFileRecords(tx *bbolt.Tx, postings []string) (map[string]FileRecord, error) {
+	bucket := tx.Bucket([]byte(filesBucket))
+	if bucket == nil {
+		return nil, nil
+	}
+	records := make(map[string]FileRecord)
+	seen := make(map[string]bool)
+	for _, posting := range postings {
+		fileID, _, _ := strings.Cut(posting, ":")
+		if seen[fileID] {
+			continue
+		}
+		seen[fileID] = true
+		record, found, err := getFileRecord(bucket, fileID)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			records[fileID] = record
+		}
+	}
+	return records, nil
+}
+
+// readFileEntries 读取文件ID对应文件中多个偏移量处的日志条目，偏移量需按升序排列
+// 有注册表记录时按记录的状态打开普通文件或.gz文件，文件已被清理时返回*LogFileRemovedError；
+// 没有记录时（旧版本写入的文件）先打开普通文件，不存在时再打开.gz文件
+func readFileEntries(logDir, fileID string, record *FileRecord, offsets []int64) ([]LogEntry, error) {
+	if record != nil && record.State == FileStateDeleted {
+		return nil, &LogFileRemovedError{FileID: fileID, DeletedAt: record.DeletedAt}
+	}
+	path := filepath.Join(logDir, fileID+".log")
+	if record != nil && record.State == FileStateCompressed {
+		entries, err := readCompressedLogEntries(path+".gz", offsets)
+		if !errors.Is(err, fs.ErrNotExist) {
+			return entries, err
+		}
+	}
+	// 压缩完成到更新记录之间，记录仍为已轮转而文件已是.gz，readLogEntries会回退到.gz文件
+	entries, err := readLogEntries(path, offsets)
+	if errors.Is(err, fs.ErrNotExist) && record != nil {
+		return nil, fmt.Errorf("日志文件%s（注册表状态%s）不存在: %w", fileID, record.State, err)
+	}
+	return entries, err
+}
+
+// Files 返回文件注册表中的所有记录，按文件ID排序，正在写入的文件带有当前大小和写入条数
+func (la *LogAggregator) Files() ([]FileRecord, error) {
+	var records []FileRecord
+	la.indexMutex.RLock()
+	if la.indexDB == nil {
+		err := la.indexClosedErrLocked()
+		la.indexMutex.RUnlock()
+		return nil, err
+	}
+	err := la.indexDB.View(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket([]byte(filesBucket))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var record FileRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return fmt.Errorf("解析文件记录%s失败: %w", k, err)
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	la.indexMutex.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	la.mutex.RLock()
+	live := make(map[string]*fileSet, len(la.levelOutputs)+1)
+	for _, set := range la.fileSets() {
+		if set.fileID != "" {
+			live[set.fileID] = set
+		}
+	}
+	for i := range records {
+		if set, ok := live[records[i].FileID]; ok && records[i].State == FileStateActive {
+			records[i].SizeBytes = set.offset
+			records[i].EntryCount = set.entries
+		}
+	}
+	la.mutex.RUnlock()
+
+	sort.Slice(records, func(i, j int) bool { return records[i].FileID < records[j].FileID })
+	return records, nil
+}
+
+// AggregatorFiles 返回全局聚合器的文件注册表，没有写入文件的全局聚合器时返回ErrNoAggregator
+func AggregatorFiles() ([]FileRecord, error) {
+	aggregator := GetGlobalAggregator()
+	if aggregator == nil {
+		return nil, ErrNoAggregator
+	}
+	return aggregator.Files()
+}
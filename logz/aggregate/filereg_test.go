@@ -0,0 +1,135 @@
+package aggregate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileRegistry(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "svc", WithRetentionDays(7))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := aggregator.WriteLog(LogEntry{Level: "info", Message: "rotated", TraceID: "trace-reg"}); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+	}
+	if err := aggregator.Flush(); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+	if err := aggregator.Rotate(); err != nil {
+		t.Fatalf("轮转失败: %v", err)
+	}
+
+	fileRecord := func(fileID string) FileRecord {
+		t.Helper()
+		records, err := aggregator.Files()
+		if err != nil {
+			t.Fatalf("读取文件注册表失败: %v", err)
+		}
+		for _, record := range records {
+			if record.FileID == fileID {
+				return record
+			}
+		}
+		t.Fatalf("文件注册表中没有 %s: %+v", fileID, records)
+		return FileRecord{}
+	}
+	query := LogQuery{TraceID: "trace-reg", RequireIndex: true, Limit: 10}
+	result, err := aggregator.Query(t.Context(), query)
+	if err != nil || result.Total != 3 {
+		t.Fatalf("期望通过索引查询到 3 条，得到 %+v %v", result, err)
+	}
+	entry := result.Entries[0]
+	record := fileRecord(entry.FileID)
+	if record.State != FileStateRotated || record.EntryCount != 3 || record.SizeBytes == 0 || record.RotatedAt.IsZero() {
+		t.Errorf("期望轮转后的记录带有条目数和大小，得到 %+v", record)
+	}
+	if active := fileRecord(aggregator.output.fileID); active.State != FileStateActive {
+		t.Errorf("期望当前文件为 %s，得到 %+v", FileStateActive, active)
+	}
+
+	// 压缩后按注册表读取.gz文件
+	aggregator.compressFilesBefore(time.Now().Add(time.Hour))
+	record = fileRecord(entry.FileID)
+	if record.State != FileStateCompressed || record.Path != entry.FileID+".log.gz" || record.CompressedAt.IsZero() {
+		t.Errorf("期望压缩后的记录指向.gz文件，得到 %+v", record)
+	}
+	result, err = aggregator.Query(t.Context(), query)
+	if err != nil || result.Total != 3 {
+		t.Fatalf("期望压缩后仍通过索引查询到 3 条，得到 %+v %v", result, err)
+	}
+	entries, err := readFileEntries(dir, entry.FileID, &record, []int64{entry.Offset})
+	if err != nil || len(entries) != 1 || entries[0].Message != "rotated" {
+		t.Errorf("期望从压缩文件读取条目，得到 %+v %v", entries, err)
+	}
+
+	// 清理后记录为已删除，读取返回ErrLogFileRemoved
+	old := time.Now().AddDate(0, 0, -30)
+	if err := os.Chtimes(filepath.Join(dir, record.Path), old, old); err != nil {
+		t.Fatalf("修改文件时间失败: %v", err)
+	}
+	if err := aggregator.cleanupOldFiles(); err != nil {
+		t.Fatalf("清理失败: %v", err)
+	}
+	record = fileRecord(entry.FileID)
+	if record.State != FileStateDeleted || record.DeletedAt.IsZero() {
+		t.Errorf("期望清理后的记录为 %s，得到 %+v", FileStateDeleted, record)
+	}
+	_, err = readFileEntries(dir, entry.FileID, &record, []int64{entry.Offset})
+	var removed *LogFileRemovedError
+	if !errors.Is(err, ErrLogFileRemoved) || !errors.As(err, &removed) || removed.FileID != entry.FileID {
+		t.Errorf("期望 ErrLogFileRemoved，得到 %v", err)
+	}
+	if ErrorCode(err) != CodeLogFileRemoved {
+		t.Errorf("期望错误码 %s，得到 %s", CodeLogFileRemoved, ErrorCode(err))
+	}
+	query.RequireIndex = false
+	if result, err := aggregator.Query(t.Context(), query); err != nil || result.Total != 0 {
+		t.Errorf("期望清理后查询不到条目，得到 %+v %v", result, err)
+	}
+}
+
+func TestReconcileFileRegistry(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "svc")
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	if err := aggregator.WriteLog(LogEntry{Level: "info", Message: "before restart"}); err != nil {
+		t.Fatalf("写入日志失败: %v", err)
+	}
+	first := aggregator.output.fileID
+	aggregator.Close()
+
+	// 关闭时的文件标记为已轮转；外部删除的文件在下次启动时标记为已删除
+	aggregator, err = NewLogAggregatorWithOptions(dir, "svc")
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	records, err := aggregator.Files()
+	aggregator.Close()
+	if err != nil || len(records) != 2 || records[0].FileID != first || records[0].State != FileStateRotated || records[0].EntryCount != 1 {
+		t.Fatalf("期望上次的文件已轮转且有 1 条日志，得到 %+v %v", records, err)
+	}
+
+	if err := os.Remove(filepath.Join(dir, first+".log")); err != nil {
+		t.Fatalf("删除文件失败: %v", err)
+	}
+	aggregator, err = NewLogAggregatorWithOptions(dir, "svc")
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+	records, err = aggregator.Files()
+	if err != nil || records[0].State != FileStateDeleted {
+		t.Errorf("期望被外部删除的文件标记为 %s，得到 %+v %v", FileStateDeleted, records, err)
+	}
+}
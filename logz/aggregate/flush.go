@@ -0,0 +1,131 @@
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// indexWaitInterval Flush等待索引工作线程完成时的检查间隔
+const indexWaitInterval = time.Millisecond
+
+// Flush 将批量缓冲区写入文件，并等待这些条目建立索引后返回，返回后可以通过索引查询到之前写入的所有条目
+// 索引队列已满时被跳过的条目不会建立索引
+func (la *LogAggregator) Flush() error {
+	la.closeMutex.Lock()
+	if la.closed {
+		la.closeMutex.Unlock()
+		return errors.New("聚合器已关闭")
+	}
+	la.closeMutex.Unlock()
+
+	la.batchMutex.Lock()
+	if la.filesClosed {
+		la.batchMutex.Unlock()
+		return errors.New("聚合器已关闭")
+	}
+	err := la.flushBatch()
+	target := la.indexLag.next()
+	la.batchMutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// 在当前goroutine中为队列中剩余的条目建立索引，再等待索引工作线程处理中的条目
+	la.indexMutex.RLock()
+	if la.indexDB != nil {
+		la.drainIndexQueue()
+	}
+	la.indexMutex.RUnlock()
+	for !la.indexLag.indexedBefore(target) {
+		select {
+		case <-la.ctx.Done():
+			// Close会为剩余的条目建立索引
+			return errors.New("聚合器已关闭")
+		case <-time.After(indexWaitInterval):
+		}
+	}
+	return nil
+}
+
+// Rotate 立即轮转所有已打开的聚合文件，缓冲区中的条目先写入旧文件
+// 用于在备份目录之前关闭当前文件，旧文件之后不会再被写入
+func (la *LogAggregator) Rotate() error {
+	la.closeMutex.Lock()
+	if la.closed {
+		la.closeMutex.Unlock()
+		return errors.New("聚合器已关闭")
+	}
+	la.closeMutex.Unlock()
+
+	la.batchMutex.Lock()
+	defer la.batchMutex.Unlock()
+	if la.filesClosed {
+		return errors.New("聚合器已关闭")
+	}
+
+	// 没有写入过条目的空文件无需轮转
+	var sets []*fileSet
+	for _, set := range la.fileSets() {
+		if set.file != nil && (set.offset > 0 || len(la.batchBuffer) > 0) {
+			sets = append(sets, set)
+		}
+	}
+	return la.rotateSets(sets)
+}
+
+// Sync 在Flush之后将当前聚合文件和索引数据库同步到磁盘
+func (la *LogAggregator) Sync() error {
+	if err := la.Flush(); err != nil {
+		return err
+	}
+
+	la.mutex.RLock()
+	for _, set := range la.fileSets() {
+		if set.file == nil {
+			continue
+		}
+		if err := set.file.Sync(); err != nil {
+			la.mutex.RUnlock()
+			return fmt.Errorf("同步日志文件失败: %w", err)
+		}
+	}
+	la.mutex.RUnlock()
+
+	la.indexMutex.RLock()
+	defer la.indexMutex.RUnlock()
+	if la.indexDB == nil {
+		return la.indexClosedErrLocked()
+	}
+	if err := la.indexDB.Sync(); err != nil {
+		return fmt.Errorf("同步索引数据库失败: %w", err)
+	}
+	return nil
+}
+
+// FlushAggregator 刷新全局聚合器，没有聚合器时返回ErrNoAggregator
+func FlushAggregator() error {
+	aggregator := GlobalAggregator()
+	if aggregator == nil {
+		return ErrNoAggregator
+	}
+	return aggregator.Flush()
+}
+
+// RotateAggregator 轮转全局聚合器的文件，没有写入文件的全局聚合器时返回ErrNoAggregator
+func RotateAggregator() error {
+	aggregator := GetGlobalAggregator()
+	if aggregator == nil {
+		return ErrNoAggregator
+	}
+	return aggregator.Rotate()
+}
+
+// SyncAggregator 刷新全局聚合器并同步到磁盘，没有写入文件的全局聚合器时返回ErrNoAggregator
+func SyncAggregator() error {
+	aggregator := GetGlobalAggregator()
+	if aggregator == nil {
+		return ErrNoAggregator
+	}
+	return aggregator.Sync()
+}
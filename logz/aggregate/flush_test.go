@@ -0,0 +1,104 @@
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFlushMakesEntriesIndexQueryable(t *testing.T) {
+	dir := t.TempDir()
+	// 批量大小和刷新间隔都很大，不调用Flush时条目一直留在缓冲区
+	aggregator, err := NewLogAggregatorWithOptions(dir, "flush", WithBatchSize(maxBatchSize))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+	SetGlobalAggregator(aggregator)
+	defer SetGlobalAggregator(nil)
+
+	for i := 0; i < 20; i++ {
+		if err := aggregator.WriteLog(LogEntry{Level: "info", Message: fmt.Sprintf("m%d", i), TraceID: "trace-flush"}); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+	}
+	if err := FlushAggregator(); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+
+	info, err := aggregator.Describe()
+	if err != nil {
+		t.Fatalf("获取聚合器信息失败: %v", err)
+	}
+	if info.BatchQueueDepth != 0 || info.IndexLagEntries != 0 || info.IndexBuckets["trace_id"] != 20 {
+		t.Errorf("期望缓冲区为空且索引完成，得到 batch=%d lag=%d indexed=%d", info.BatchQueueDepth, info.IndexLagEntries, info.IndexBuckets["trace_id"])
+	}
+	result, err := QueryLogs(LogQuery{TraceID: "trace-flush", UseIndex: true, RequireIndex: true, Limit: 100}, dir)
+	if err != nil || result.Total != 20 {
+		t.Errorf("期望通过索引查询到 20 条，得到 %+v %v", result, err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "rotate", WithBatchSize(maxBatchSize))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+
+	// 当前文件为空时不轮转
+	firstFileID := aggregator.output.fileID
+	if err := aggregator.Rotate(); err != nil || aggregator.output.fileID != firstFileID {
+		t.Fatalf("期望空文件不轮转，得到 %s %v", aggregator.output.fileID, err)
+	}
+
+	if err := aggregator.WriteLog(LogEntry{Level: "info", Message: "before rotate"}); err != nil {
+		t.Fatalf("写入日志失败: %v", err)
+	}
+	if err := aggregator.Rotate(); err != nil {
+		t.Fatalf("轮转失败: %v", err)
+	}
+	if aggregator.output.fileID == firstFileID || aggregator.output.offset != 0 {
+		t.Errorf("期望切换到新文件，得到 %s:%d", aggregator.output.fileID, aggregator.output.offset)
+	}
+	// 缓冲的条目写入旧文件
+	if lines, _, err := countEntries(filepath.Join(dir, firstFileID+".log")); err != nil || lines != 1 {
+		t.Errorf("期望旧文件有 1 条日志，得到 %d %v", lines, err)
+	}
+}
+
+func TestSync(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "sync", WithBatchSize(maxBatchSize))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	if err := aggregator.WriteLog(LogEntry{Level: "info", Message: "synced"}); err != nil {
+		t.Fatalf("写入日志失败: %v", err)
+	}
+	if err := aggregator.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, aggregator.output.fileID+".log")); err != nil || len(data) == 0 {
+		t.Errorf("期望同步后文件有内容，得到 %q %v", data, err)
+	}
+
+	aggregator.Close()
+	for name, op := range map[string]func() error{"Flush": aggregator.Flush, "Rotate": aggregator.Rotate, "Sync": aggregator.Sync} {
+		if err := op(); err == nil {
+			t.Errorf("期望关闭后%s返回错误", name)
+		}
+	}
+}
+
+func TestGlobalAggregatorHelpersWithoutAggregator(t *testing.T) {
+	SetGlobalAggregator(nil)
+	for name, op := range map[string]func() error{"Flush": FlushAggregator, "Rotate": RotateAggregator, "Sync": SyncAggregator} {
+		if err := op(); !errors.Is(err, ErrNoAggregator) {
+			t.Errorf("期望%s返回ErrNoAggregator，得到 %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package aggregate
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultHookDropReportInterval 异步Hook队列丢弃条目时写入警告日志的间隔
+const DefaultHookDropReportInterval = time.Minute
+
+// maxHookQueueSize 异步Hook队列容量的上限
+const maxHookQueueSize = 1000000
+
+// OverflowPolicy 异步Hook队列已满时的处理方式
+type OverflowPolicy string
+
+const (
+	OverflowBlock OverflowPolicy = "block" // 等待队列有空位
+	OverflowDrop  OverflowPolicy = "drop"  // 丢弃条目并计数
+)
+
+// WithHookQueue 启用聚合Hook的异步写入：Fire只把条目放入容量为size的队列，由单独的协程写入聚合器
+// 队列已满时按policy等待或丢弃；丢弃的条目数可通过AggregatorStats查询，并定期写入一条警告日志
+// Close时先写入队列中剩余的条目
+func WithHookQueue(size int, policy OverflowPolicy) AggregatorOption {
+	return func(o *aggregatorOptions) error {
+		if size < 1 || size > maxHookQueueSize {
+			return fmt.Errorf("Hook队列容量必须在1到%d之间: %d", maxHookQueueSize, size)
+		}
+		if policy != OverflowBlock && policy != OverflowDrop {
+			return fmt.Errorf("无效的队列溢出策略: %q", policy)
+		}
+		o.hookQueueSize = size
+		o.hookOverflow = policy
+		return nil
+	}
+}
+
+// AggregatorRuntimeStats 聚合器的运行统计
+type AggregatorRuntimeStats struct {
+	HookQueueEnabled  bool           `json:"hook_queue_enabled"`
+	HookQueuePolicy   OverflowPolicy `json:"hook_queue_policy,omitempty"`
+	HookQueueCapacity int            `json:"hook_queue_capacity"`
+	HookQueueLength   int            `json:"hook_queue_length"` // 等待写入的条目数
+	HookEnqueued      uint64         `json:"hook_enqueued"`     // 放入队列的条目数
+	HookDropped       uint64         `json:"hook_dropped"`      // 队列已满被丢弃的条目数
+
+	BatchSize     int           `json:"batch_size"`     // 固定的批量大小，启用自适应刷新时不使用
+	FlushInterval time.Duration `json:"flush_interval"` // 固定的刷新间隔，启用自适应刷新时为最大延迟
+	AdaptiveFlush bool          `json:"adaptive_flush"`
+	Flushes       FlushStats    `json:"flushes"` // 批量写入的条目数和耗时直方图
+
+	Writes WriteFailureStats `json:"writes"` // 写入文件失败和重试的情况
+
+	IndexGC IndexGCStats `json:"index_gc"` // 清理已删除文件的索引条目
+}
+
+// AggregatorStats 返回全局聚合器的运行统计，没有聚合器时返回零值
+func AggregatorStats() AggregatorRuntimeStats {
+	aggregator := GetGlobalAggregator()
+	if aggregator == nil {
+		return AggregatorRuntimeStats{}
+	}
+	return aggregator.Stats()
+}
+
+// Stats 返回聚合器的运行统计
+func (la *LogAggregator) Stats() AggregatorRuntimeStats {
+	stats := AggregatorRuntimeStats{
+		BatchSize:     la.batchSize,
+		FlushInterval: la.flushInterval,
+		AdaptiveFlush: la.adaptive != nil,
+		Flushes:       la.flushes.snapshot(),
+	}
+	if la.adaptive != nil {
+		stats.FlushInterval = la.adaptive.maxLatency
+	}
+	stats.Writes = la.writes.snapshot()
+	stats.IndexGC = la.gc.snapshot()
+	if q := la.hookQueue; q != nil {
+		stats.HookQueueEnabled = true
+		stats.HookQueuePolicy = q.policy
+		stats.HookQueueCapacity = cap(q.entries)
+		stats.HookQueueLength = len(q.entries)
+		stats.HookEnqueued = q.enqueued.Load()
+		stats.HookDropped = q.dropped.Load()
+	}
+	return stats
+}
+
+// hookQueue 聚合Hook的异步写入队列
+type hookQueue struct {
+	aggregator     *LogAggregator
+	entries        chan LogEntry
+	policy         OverflowPolicy
+	reportInterval time.Duration
+
+	mutex  sync.RWMutex // 发送时持有读锁，关闭entries时持有写锁
+	closed bool
+
+	enqueued atomic.Uint64
+	dropped  atomic.Uint64
+	reported uint64 // 已写入警告日志的丢弃数，只由run协程访问
+	errors   hookErrorReporter
+	done     chan struct{}
+}
+
+// newHookQueue 创建异步写入队列并启动写入协程
+func newHookQueue(aggregator *LogAggregator, size int, policy OverflowPolicy, reportInterval time.Duration) *hookQueue {
+	q := &hookQueue{
+		aggregator:     aggregator,
+		entries:        make(chan LogEntry, size),
+		policy:         policy,
+		reportInterval: reportInterval,
+		done:           make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// enqueue 将条目放入队列，队列关闭后直接写入聚合器
+func (q *hookQueue) enqueue(entry LogEntry) error {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	if q.closed {
+		return q.aggregator.WriteLog(entry)
+	}
+
+	if q.policy == OverflowDrop {
+		select {
+		case q.entries <- entry:
+			q.enqueued.Add(1)
+		default:
+			q.dropped.Add(1)
+		}
+		return nil
+	}
+	q.entries <- entry
+	q.enqueued.Add(1)
+	return nil
+}
+
+// run 依次写入队列中的条目，定期报告丢弃的条目数，队列关闭后写完剩余条目退出
+func (q *hookQueue) run() {
+	defer close(q.done)
+	ticker := time.NewTicker(q.reportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case entry, ok := <-q.entries:
+			if !ok {
+				q.reportDropped()
+				return
+			}
+			if err := q.aggregator.WriteLog(entry); err != nil {
+				q.errors.record(err, time.Now())
+			}
+		case <-ticker.C:
+			q.reportDropped()
+		}
+	}
+}
+
+// reportDropped 上次报告之后有条目被丢弃时写入一条警告日志
+func (q *hookQueue) reportDropped() {
+	total := q.dropped.Load()
+	if total == q.reported {
+		return
+	}
+	entry := LogEntry{
+		Level:   "warn",
+		Message: "聚合Hook队列已满，部分日志被丢弃",
+		Service: q.aggregator.serviceName,
+		Fields:  map[string]any{"dropped": total - q.reported, "total_dropped": total},
+	}
+	q.reported = total
+	if err := q.aggregator.WriteLog(entry); err != nil {
+		fmt.Fprintf(os.Stderr, "[聚合Hook] 丢弃了 %d 条日志: %v\n", entry.Fields["dropped"], err)
+	}
+}
+
+// close 停止接收条目，等待队列中剩余的条目写入聚合器；之后的条目直接写入聚合器
+func (q *hookQueue) close() {
+	q.mutex.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.entries)
+	}
+	q.mutex.Unlock()
+	<-q.done
+}
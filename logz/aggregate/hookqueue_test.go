@@ -0,0 +1,102 @@
+package aggregate
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestHookQueueOverflow(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "overflow", WithHookQueue(4, OverflowDrop), WithFlushInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	SetGlobalAggregator(aggregator)
+	defer SetGlobalAggregator(nil)
+	hook := NewAggregatorHook(aggregator, "overflow")
+
+	// 写入协程阻塞在批量缓冲区的锁上，Fire不等待
+	aggregator.batchMutex.Lock()
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		entry := &logrus.Entry{Time: time.Now(), Level: logrus.InfoLevel, Message: fmt.Sprintf("entry %d", i), Data: logrus.Fields{}}
+		if err := hook.Fire(entry); err != nil {
+			t.Fatalf("Fire失败: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("期望聚合器阻塞时Fire立即返回，耗时 %s", elapsed)
+	}
+
+	// 队列中最多4条，写入协程取出的1条阻塞在锁上
+	stats := AggregatorStats()
+	if !stats.HookQueueEnabled || stats.HookQueuePolicy != OverflowDrop || stats.HookQueueCapacity != 4 {
+		t.Errorf("队列配置错误: %+v", stats)
+	}
+	if stats.HookEnqueued+stats.HookDropped != 20 || stats.HookDropped < 15 {
+		t.Errorf("期望放入和丢弃合计 20 条且至少丢弃 15 条，得到 %+v", stats)
+	}
+	aggregator.batchMutex.Unlock()
+
+	// 关闭时写完队列中的条目，并报告丢弃的条目数
+	if err := CloseAggregator(); err != nil {
+		t.Fatalf("关闭聚合器失败: %v", err)
+	}
+	result, err := QueryLogs(LogQuery{Service: "overflow", Limit: 100}, dir)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if result.Total != int(stats.HookEnqueued)+1 {
+		t.Fatalf("期望写入 %d 条日志和 1 条警告，得到 %d", stats.HookEnqueued, result.Total)
+	}
+	var warned bool
+	for _, entry := range result.Entries {
+		if entry.Level == "warn" {
+			warned = true
+			if entry.Fields["dropped"] != float64(stats.HookDropped) {
+				t.Errorf("期望警告中丢弃 %d 条，得到 %v", stats.HookDropped, entry.Fields)
+			}
+		}
+	}
+	if !warned {
+		t.Error("期望写入丢弃条目的警告")
+	}
+
+	// 关闭后不再进入队列，写入失败由Hook计数报告，不返回给logrus
+	if err := hook.Fire(&logrus.Entry{Time: time.Now(), Level: logrus.InfoLevel, Message: "closed", Data: logrus.Fields{}}); err != nil || hook.Errors() != 1 {
+		t.Errorf("期望关闭后Fire记录1次写入失败并返回nil，得到 %d %v", hook.Errors(), err)
+	}
+	if stats := aggregator.Stats(); stats.HookEnqueued+stats.HookDropped != 20 {
+		t.Errorf("期望关闭后不再计数，得到 %+v", stats)
+	}
+}
+
+func TestHookQueueDropReport(t *testing.T) {
+	dir := t.TempDir()
+	report := func(o *aggregatorOptions) error {
+		o.hookDropReport = 10 * time.Millisecond
+		return nil
+	}
+	aggregator, err := NewLogAggregatorWithOptions(dir, "report", WithHookQueue(1, OverflowDrop), WithBatchSize(1), report)
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+
+	aggregator.hookQueue.dropped.Add(3)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		result, err := QueryLogs(LogQuery{Service: "report", Level: "warn", Limit: 10}, dir)
+		if err == nil && result.Total == 1 {
+			if result.Entries[0].Fields["dropped"] != float64(3) {
+				t.Errorf("期望警告中丢弃 3 条，得到 %v", result.Entries[0].Fields)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("没有定期写入丢弃条目的警告")
+}
@@ -0,0 +1,666 @@
+package aggregate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// 倒排索引的键为"<值>\x00<文件ID>:<偏移量>"，值为"<文件ID>:<偏移量>"
+// 同一个值的所有位置（倒排列表）按前缀连续存放
+const postingSeparator = '\x00'
+
+// indexBuckets 索引数据库中的索引桶
+// 旧版本写入的条目没有主机名，不会匹配主机名条件，因此升级后新建的hostname桶无需重建索引
+var indexBuckets = []string{"trace_id", "span_id", "level", "service", "hostname", "time"}
+
+// compositeBuckets 组合索引桶，键中包含时间和条目序号，可以按前缀扫描并限定时间范围，
+// 同一前缀下的键按(时间, 序号)排列，与查询结果的顺序一致
+//
+//	service_level: "<服务名>\x00<级别>\x00<时间>\x00<序号>\x00<文件ID>:<偏移量>"
+//	trace_time:    "<TraceID>\x00<时间>\x00<序号>\x00<文件ID>:<偏移量>"
+//
+// 引入序号之前写入的键没有序号部分，按时间扫描时不受影响
+// 旧版本创建的索引数据库没有这些桶，重建索引后才会使用
+var compositeBuckets = []string{"service_level", "trace_time"}
+
+// indexTimeLayout 组合索引键中的时间格式，统一为UTC并且定长，使字典序与时间顺序一致
+const indexTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// maxIndexPostings 最短倒排列表超过该长度时回退到文件扫描，测试中可修改
+var maxIndexPostings = 10000
+
+// errTooManyPostings 候选条目过多，扫描文件更快
+var errTooManyPostings = errors.New("索引候选条目过多")
+
+// indexCondition 可以使用索引的单个查询条件
+type indexCondition struct {
+	bucket string
+	term   string
+}
+
+// indexConditions 返回查询中所有可以使用索引的条件
+func indexConditions(query LogQuery) []indexCondition {
+	var conditions []indexCondition
+	if query.TraceID != "" {
+		conditions = append(conditions, indexCondition{"trace_id", query.TraceID})
+	}
+	if query.SpanID != "" {
+		conditions = append(conditions, indexCondition{"span_id", query.SpanID})
+	}
+	if query.Level != "" {
+		conditions = append(conditions, indexCondition{"level", canonicalLevel(query.Level)})
+	}
+	if query.Service != "" {
+		conditions = append(conditions, indexCondition{"service", query.Service})
+	}
+	if query.Hostname != "" {
+		conditions = append(conditions, indexCondition{"hostname", query.Hostname})
+	}
+	return conditions
+}
+
+// createIndexBuckets 创建缺少的索引桶，返回组合索引是否可用
+// 已有索引数据但缺少组合索引桶时（旧版本创建的数据库）不创建组合索引桶，
+// 否则组合索引只包含之后写入的日志，查询会漏掉旧日志
+func createIndexBuckets(tx *bbolt.Tx) (bool, error) {
+	empty := true
+	for _, name := range indexBuckets {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return false, fmt.Errorf("创建索引桶%s失败: %w", name, err)
+		}
+		if k, _ := bucket.Cursor().First(); k != nil {
+			empty = false
+		}
+	}
+
+	if _, err := tx.CreateBucketIfNotExists([]byte(filesBucket)); err != nil {
+		return false, fmt.Errorf("创建文件注册表失败: %w", err)
+	}
+
+	composite := true
+	for _, name := range compositeBuckets {
+		if tx.Bucket([]byte(name)) != nil {
+			continue
+		}
+		if !empty {
+			composite = false
+			continue
+		}
+		if _, err := tx.CreateBucket([]byte(name)); err != nil {
+			return false, fmt.Errorf("创建索引桶%s失败: %w", name, err)
+		}
+	}
+
+	// 反向桶同样只在索引为空时创建，否则缺少已有条目的记录，清理文件时会遗漏
+	if empty && tx.Bucket([]byte(filePostingsBucket)) == nil {
+		if _, err := tx.CreateBucket([]byte(filePostingsBucket)); err != nil {
+			return false, fmt.Errorf("创建索引桶%s失败: %w", filePostingsBucket, err)
+		}
+	}
+	return composite, nil
+}
+
+// putPostings 将日志位置加入各字段值的倒排列表和组合索引
+// 每个字段值对应一个倒排列表，记录包含该值的所有日志位置
+func putPostings(tx *bbolt.Tx, entry LogEntry) error {
+	posting := fmt.Sprintf("%s:%d", entry.FileID, entry.Offset)
+	level := canonicalLevel(entry.Level)
+	terms := []indexCondition{
+		{"trace_id", entry.TraceID},
+		{"span_id", entry.SpanID},
+		{"level", level},
+		{"service", entry.Service},
+		{"hostname", entry.Hostname},
+		{"time", entry.Timestamp},
+	}
+
+	for _, t := range terms {
+		if t.term == "" {
+			continue
+		}
+		if bucket := tx.Bucket([]byte(t.bucket)); bucket != nil {
+			if err := putIndexKey(tx, bucket, t.bucket, postingKey(t.term, posting), posting); err != nil {
+				return err
+			}
+		}
+	}
+
+	timestamp, seq := indexTime(entry.Timestamp), indexSeq(entry.Seq)
+	if entry.Service != "" && level != "" {
+		if err := putComposite(tx, "service_level", compositeKey(entry.Service, level, timestamp, seq, posting), posting); err != nil {
+			return err
+		}
+	}
+	if entry.TraceID != "" {
+		return putComposite(tx, "trace_time", compositeKey(entry.TraceID, timestamp, seq, posting), posting)
+	}
+	return nil
+}
+
+// putComposite 写入组合索引，索引桶不存在（旧版本数据库）时跳过
+func putComposite(tx *bbolt.Tx, name string, key []byte, posting string) error {
+	bucket := tx.Bucket([]byte(name))
+	if bucket == nil {
+		return nil
+	}
+	return putIndexKey(tx, bucket, name, key, posting)
+}
+
+// indexTime 编码组合索引键中的时间，无法解析的时间编码为空字符串，排在所有时间之前
+func indexTime(timestamp string) string {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return ""
+	}
+	return t.UTC().Format(indexTimeLayout)
+}
+
+// indexSeq 编码组合索引键中的条目序号，定长的十进制使字典序与数值顺序一致
+func indexSeq(seq uint64) string {
+	return fmt.Sprintf("%020d", seq)
+}
+
+// compositeKey 用分隔符连接组合索引键的各部分
+func compositeKey(parts ...string) []byte {
+	return []byte(strings.Join(parts, string(postingSeparator)))
+}
+
+// postingKey 生成倒排索引键
+func postingKey(term, posting string) []byte {
+	key := make([]byte, 0, len(term)+1+len(posting))
+	key = append(key, term...)
+	key = append(key, postingSeparator)
+	return append(key, posting...)
+}
+
+// postingPrefix 返回值对应的倒排列表键前缀
+func postingPrefix(term string) []byte {
+	return append([]byte(term), postingSeparator)
+}
+
+// splitPostingKey 拆分倒排索引键，旧格式的键返回false
+func splitPostingKey(key []byte) (string, string, bool) {
+	i := bytes.IndexByte(key, postingSeparator)
+	if i < 0 {
+		return "", "", false
+	}
+	return string(key[:i]), string(key[i+1:]), true
+}
+
+// countPostings 统计值的倒排列表长度，超过limit时停止计数
+func countPostings(bucket *bbolt.Bucket, term string, limit int) int {
+	prefix := postingPrefix(term)
+	count := 0
+	c := bucket.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		count++
+		if count > limit {
+			break
+		}
+	}
+	return count
+}
+
+// lookupPostings 使用索引查找候选日志位置
+// 查询条件可以由组合索引覆盖时先扫描组合索引，再在其余条件的倒排列表中过滤，否则求所有条件倒排列表的交集
+func lookupPostings(tx *bbolt.Tx, query LogQuery) ([]string, error) {
+	if scan, rest := planComposite(query); scan != nil {
+		if bucket := tx.Bucket([]byte(scan.bucket)); bucket != nil {
+			postings, err := scanComposite(bucket, scan)
+			if err != nil {
+				return nil, err
+			}
+			return probePostings(tx, postings, rest)
+		}
+	}
+	return intersectPostings(tx, indexConditions(query))
+}
+
+// compositeScan 组合索引的扫描范围
+type compositeScan struct {
+	bucket string
+	prefix []byte // 时间之前的部分，以分隔符结尾
+	start  string // 时间下限（含），为空表示不限
+	end    string // 时间上限（含），为空表示不限
+}
+
+// planComposite 选择可以使用的组合索引，返回扫描范围和组合索引未覆盖的条件
+// 同时指定服务名和级别时使用service_level，指定TraceID和时间范围时使用trace_time
+func planComposite(query LogQuery) (*compositeScan, []indexCondition) {
+	var start, end string
+	if !query.StartTime.IsZero() {
+		start = query.StartTime.UTC().Format(indexTimeLayout)
+	}
+	if !query.EndTime.IsZero() {
+		end = query.EndTime.UTC().Format(indexTimeLayout)
+	}
+
+	var scan *compositeScan
+	covered := make(map[string]bool)
+	switch {
+	case query.Service != "" && query.Level != "":
+		scan = &compositeScan{"service_level", compositeKey(query.Service, canonicalLevel(query.Level), ""), start, end}
+		covered["service"], covered["level"] = true, true
+	case query.TraceID != "" && (start != "" || end != ""):
+		scan = &compositeScan{"trace_time", compositeKey(query.TraceID, ""), start, end}
+		covered["trace_id"] = true
+	default:
+		return nil, nil
+	}
+
+	var rest []indexCondition
+	for _, cond := range indexConditions(query) {
+		if !covered[cond.bucket] {
+			rest = append(rest, cond)
+		}
+	}
+	return scan, rest
+}
+
+// scanComposite 按前缀和时间范围扫描组合索引，结果超过maxIndexPostings时返回errTooManyPostings
+// 前缀下没有任何索引条目时返回错误，以便回退到文件扫描
+func scanComposite(bucket *bbolt.Bucket, scan *compositeScan) ([]string, error) {
+	c := bucket.Cursor()
+	if k, _ := c.Seek(scan.prefix); k == nil || !bytes.HasPrefix(k, scan.prefix) {
+		return nil, fmt.Errorf("未找到匹配的索引")
+	}
+
+	var postings []string
+	seek := append(append([]byte(nil), scan.prefix...), scan.start...)
+	for k, v := c.Seek(seek); k != nil && bytes.HasPrefix(k, scan.prefix); k, v = c.Next() {
+		if scan.end != "" {
+			timestamp, _, _ := bytes.Cut(k[len(scan.prefix):], []byte{postingSeparator})
+			if string(timestamp) > scan.end {
+				break
+			}
+		}
+		postings = append(postings, string(v))
+		if len(postings) > maxIndexPostings {
+			return nil, errTooManyPostings
+		}
+	}
+	return postings, nil
+}
+
+// intersectPostings 求多个条件倒排列表的交集
+// 从最短的倒排列表开始，逐个在其余条件中查找，最短列表超过maxIndexPostings时返回errTooManyPostings
+// 某个条件没有任何索引条目时返回错误，以便回退到文件扫描
+func intersectPostings(tx *bbolt.Tx, conditions []indexCondition) ([]string, error) {
+	buckets := make([]*bbolt.Bucket, len(conditions))
+	sizes := make([]int, len(conditions))
+	order := make([]int, len(conditions))
+	for i, cond := range conditions {
+		buckets[i] = tx.Bucket([]byte(cond.bucket))
+		if buckets[i] == nil {
+			return nil, fmt.Errorf("索引桶%s不存在", cond.bucket)
+		}
+		sizes[i] = countPostings(buckets[i], cond.term, maxIndexPostings)
+		if sizes[i] == 0 {
+			return nil, fmt.Errorf("未找到匹配的索引")
+		}
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return sizes[order[a]] < sizes[order[b]] })
+
+	first := order[0]
+	if sizes[first] > maxIndexPostings {
+		return nil, errTooManyPostings
+	}
+
+	var postings []string
+	prefix := postingPrefix(conditions[first].term)
+	c := buckets[first].Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		postings = append(postings, string(v))
+	}
+
+	rest := make([]indexCondition, 0, len(order)-1)
+	for _, i := range order[1:] {
+		rest = append(rest, conditions[i])
+	}
+	return probePostings(tx, postings, rest)
+}
+
+// probePostings 保留同时出现在所有条件倒排列表中的位置
+func probePostings(tx *bbolt.Tx, postings []string, conditions []indexCondition) ([]string, error) {
+	for _, cond := range conditions {
+		bucket := tx.Bucket([]byte(cond.bucket))
+		if bucket == nil {
+			return nil, fmt.Errorf("索引桶%s不存在", cond.bucket)
+		}
+		kept := postings[:0]
+		for _, posting := range postings {
+			if bucket.Get(postingKey(cond.term, posting)) != nil {
+				kept = append(kept, posting)
+			}
+		}
+		postings = kept
+		if len(postings) == 0 {
+			break
+		}
+	}
+	return postings, nil
+}
+
+// parsePostings 解析并按文件分组排序日志位置，文件按修改时间从新到旧排列，与文件扫描的顺序一致
+func parsePostings(postings []string, logDir string) ([]string, map[string][]int64, error) {
+	byFile := make(map[string][]int64)
+	for _, posting := range postings {
+		fileID, offsetStr, found := strings.Cut(posting, ":")
+		if !found {
+			return nil, nil, fmt.Errorf("索引格式错误")
+		}
+		offset, err := strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("索引格式错误: %w", err)
+		}
+		byFile[fileID] = append(byFile[fileID], offset)
+	}
+
+	fileIDs := make([]string, 0, len(byFile))
+	modTimes := make(map[string]int64, len(byFile))
+	for fileID, offsets := range byFile {
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+		if stat, err := os.Stat(filepath.Join(logDir, fileID+".log")); err == nil {
+			modTimes[fileID] = stat.ModTime().UnixNano()
+		} else if stat, err := os.Stat(filepath.Join(logDir, fileID+".log.gz")); err == nil {
+			modTimes[fileID] = stat.ModTime().UnixNano()
+		}
+		fileIDs = append(fileIDs, fileID)
+	}
+	sort.Slice(fileIDs, func(i, j int) bool {
+		if modTimes[fileIDs[i]] != modTimes[fileIDs[j]] {
+			return modTimes[fileIDs[i]] > modTimes[fileIDs[j]]
+		}
+		return fileIDs[i] > fileIDs[j]
+	})
+	return fileIDs, byFile, nil
+}
+
+// readLogEntries 从文件中读取多个偏移量处的日志条目，偏移量需按升序排列
+// 文件已被压缩时从同名的.gz文件中按顺序读取，偏移量仍为压缩前的位置
+func readLogEntries(path string, offsets []int64) ([]LogEntry, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		if entries, gzErr := readCompressedLogEntries(path+".gz", offsets); !errors.Is(gzErr, fs.ErrNotExist) {
+			return entries, gzErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := make([]LogEntry, 0, len(offsets))
+	reader := bufio.NewReader(file)
+	for _, offset := range offsets {
+		if _, err := file.Seek(offset, 0); err != nil {
+			return nil, err
+		}
+		reader.Reset(file)
+		line, err := reader.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			return nil, fmt.Errorf("无法读取日志条目: %w", err)
+		}
+		entry, _, err := decodeEntryLine(line, true)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// readCompressedLogEntries 顺序解压.gz文件，读取多个压缩前偏移量处的日志条目，偏移量需按升序排列
+func readCompressedLogEntries(path string, offsets []int64) ([]LogEntry, error) {
+	file, err := openLogReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := make([]LogEntry, 0, len(offsets))
+	reader := bufio.NewReader(file)
+	var pos int64
+	for i, offset := range offsets {
+		if i > 0 && offset == offsets[i-1] {
+			entries = append(entries, entries[len(entries)-1])
+			continue
+		}
+		if _, err := io.CopyN(io.Discard, reader, offset-pos); err != nil {
+			return nil, fmt.Errorf("无法读取日志条目: %w", err)
+		}
+		line, err := reader.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			return nil, fmt.Errorf("无法读取日志条目: %w", err)
+		}
+		pos = offset + int64(len(line))
+		entry, _, err := decodeEntryLine(line, true)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// migrateIndex 将旧版本的索引迁移到当前格式
+func migrateIndex(tx *bbolt.Tx) error {
+	if err := migratePostings(tx); err != nil {
+		return err
+	}
+	// 旧版本可能以别名或大写写入级别索引
+	return migrateLevelIndex(tx)
+}
+
+// migratePostings 将旧版本"值→最后一个位置"格式的索引键转换为倒排索引键
+func migratePostings(tx *bbolt.Tx) error {
+	return tx.ForEach(func(name []byte, bucket *bbolt.Bucket) error {
+		if string(name) == filesBucket {
+			return nil
+		}
+		type legacyKey struct {
+			key   []byte
+			value []byte
+		}
+		var legacy []legacyKey
+		err := bucket.ForEach(func(k, v []byte) error {
+			if v != nil && bytes.IndexByte(k, postingSeparator) < 0 {
+				legacy = append(legacy, legacyKey{
+					key:   append([]byte(nil), k...),
+					value: append([]byte(nil), v...),
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range legacy {
+			if err := bucket.Put(postingKey(string(entry.key), string(entry.value)), entry.value); err != nil {
+				return fmt.Errorf("迁移索引%s失败: %w", name, err)
+			}
+			if err := bucket.Delete(entry.key); err != nil {
+				return fmt.Errorf("删除旧索引%s失败: %w", name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// dataFileName 聚合器数据文件名：<服务名>_<日期>_<序号>.log
+var dataFileName = regexp.MustCompile(`^(.+)_\d{4}-\d{2}-\d{2}_\d+\.log$`)
+
+// dataFileService 返回聚合器数据文件所属的服务名，不是数据文件时返回false
+// 按级别拆分的文件（<服务名>_<级别>_<日期>_<序号>.log）属于去掉级别后的服务
+func dataFileService(name string) (string, bool) {
+	m := dataFileName.FindStringSubmatch(name)
+	if m == nil {
+		return "", false
+	}
+	if level := fileLevel(strings.TrimSuffix(name, ".log"), ""); level != "" {
+		if service, ok := strings.CutSuffix(m[1], "_"+level); ok && service != "" {
+			return service, true
+		}
+	}
+	return m[1], true
+}
+
+// DiscoverServices 根据聚合器数据文件名返回logDir中的所有服务名（已排序）
+// 压缩后的文件不参与索引，不计入
+func DiscoverServices(logDir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(logDir, "*.log"))
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var services []string
+	for _, file := range files {
+		service, ok := dataFileService(filepath.Base(file))
+		if !ok || seen[service] {
+			continue
+		}
+		seen[service] = true
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+// RebuildIndex 根据数据文件重建服务的索引，返回写入索引的日志条数
+func RebuildIndex(logDir, serviceName string) (int, error) {
+	return RebuildIndexContext(context.Background(), logDir, serviceName)
+}
+
+// RebuildIndexContext 根据数据文件（包括按级别拆分的文件）重建服务的索引，ctx取消后停止并返回ctx.Err()
+// 旧索引会被清空，已压缩的文件无法通过索引读取，不会被索引
+// 索引数据库被运行中的聚合器占用时，等待超时后返回错误
+func RebuildIndexContext(ctx context.Context, logDir, serviceName string) (int, error) {
+	if serviceName == "" {
+		return 0, errors.New("服务名不能为空")
+	}
+
+	files, err := filepath.Glob(filepath.Join(logDir, serviceName+"_*.log"))
+	if err != nil {
+		return 0, err
+	}
+	// 前缀相同的其他服务（如"api"和"api_v2"）的文件不属于该服务，按级别拆分的文件属于该服务
+	dataFiles := files[:0]
+	for _, file := range files {
+		if service, ok := dataFileService(filepath.Base(file)); ok && service == serviceName {
+			dataFiles = append(dataFiles, file)
+		}
+	}
+
+	indexDir := filepath.Join(logDir, "index")
+	if err := os.MkdirAll(indexDir, 0755); err != nil {
+		return 0, fmt.Errorf("创建索引目录失败: %w", err)
+	}
+	db, err := bbolt.Open(filepath.Join(indexDir, serviceName+".db"), 0600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return 0, fmt.Errorf("打开索引数据库失败: %w", err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, bucket := range append(append(indexBuckets, compositeBuckets...), filePostingsBucket) {
+			if err := tx.DeleteBucket([]byte(bucket)); err != nil && !errors.Is(err, bbolt.ErrBucketNotFound) {
+				return fmt.Errorf("清空索引桶%s失败: %w", bucket, err)
+			}
+		}
+		_, err := createIndexBuckets(tx)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var indexed int
+	for _, file := range dataFiles {
+		n, err := indexFile(ctx, db, file)
+		indexed += n
+		if err != nil {
+			return indexed, fmt.Errorf("索引文件%s失败: %w", filepath.Base(file), err)
+		}
+	}
+	return indexed, nil
+}
+
+// rebuildBatchSize 重建索引时每个事务写入的日志条数
+// bbolt在单个大事务中插入大量无序的键时性能急剧下降
+const rebuildBatchSize = 10000
+
+// indexFile 将文件中的所有日志条目加入索引，跳过无法解析的行
+func indexFile(ctx context.Context, db *bbolt.DB, path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var indexed int
+	batch := make([]LogEntry, 0, rebuildBatchSize)
+	flush := func() error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := db.Update(func(tx *bbolt.Tx) error {
+			for _, entry := range batch {
+				if err := putPostings(tx, entry); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		indexed += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	fileID := fileIDFromPath(path)
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			var entry LogEntry
+			if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 && json.Unmarshal(trimmed, &entry) == nil {
+				entry.FileID = fileID
+				entry.Offset = offset
+				batch = append(batch, entry)
+				if len(batch) == rebuildBatchSize {
+					if err := flush(); err != nil {
+						return indexed, err
+					}
+				}
+			}
+			offset += int64(len(line))
+		}
+		if err == io.EOF {
+			return indexed, flush()
+		}
+		if err != nil {
+			return indexed, err
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package aggregate
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// benchCorpusSize 索引查询基准测试的日志条数，-short时为十分之一
+const benchCorpusSize = 1_000_000
+
+// writeBenchCorpus 直接写入数据文件并重建索引，返回日志目录和最后一条日志的时间
+// 10个服务，每200条中连续10条为error（每个服务各1条），相邻日志间隔100ms
+func writeBenchCorpus(b *testing.B, size int) (string, time.Time) {
+	b.Helper()
+	dir := b.TempDir()
+	base := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	const perFile = 100_000
+
+	for fileNo := 0; fileNo*perFile < size; fileNo++ {
+		file, err := os.Create(filepath.Join(dir, fmt.Sprintf("bench_2024-01-15_%03d.log", fileNo+1)))
+		if err != nil {
+			b.Fatalf("创建数据文件失败: %v", err)
+		}
+		writer := bufio.NewWriter(file)
+		encoder := json.NewEncoder(writer)
+		for i := fileNo * perFile; i < min(size, (fileNo+1)*perFile); i++ {
+			level := "info"
+			if (i/10)%20 == 0 {
+				level = "error"
+			}
+			entry := LogEntry{
+				Timestamp: base.Add(time.Duration(i) * 100 * time.Millisecond).Format(time.RFC3339Nano),
+				Level:     level,
+				Message:   fmt.Sprintf("request %d completed", i),
+				TraceID:   fmt.Sprintf("trace-%d", i/10),
+				Service:   fmt.Sprintf("svc-%d", i%10),
+			}
+			if err := encoder.Encode(entry); err != nil {
+				b.Fatalf("写入数据文件失败: %v", err)
+			}
+		}
+		if err := writer.Flush(); err != nil {
+			b.Fatalf("写入数据文件失败: %v", err)
+		}
+		file.Close()
+	}
+
+	if _, err := RebuildIndex(dir, "bench"); err != nil {
+		b.Fatalf("重建索引失败: %v", err)
+	}
+	return dir, base.Add(time.Duration(size-1) * 100 * time.Millisecond)
+}
+
+// BenchmarkIndexedQuery 比较"某服务最近一小时的错误"在组合索引、倒排列表交集和文件扫描下的耗时
+func BenchmarkIndexedQuery(b *testing.B) {
+	size := benchCorpusSize
+	if testing.Short() {
+		size /= 10
+	}
+	dir, last := writeBenchCorpus(b, size)
+
+	aggregator, err := NewLogAggregatorWithOptions(dir, "bench")
+	if err != nil {
+		b.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+
+	// 交集需要遍历整个error倒排列表，不限制候选条目数
+	original := maxIndexPostings
+	maxIndexPostings = math.MaxInt
+	defer func() { maxIndexPostings = original }()
+
+	query := LogQuery{Service: "svc-3", Level: "error", StartTime: last.Add(-time.Hour), EndTime: last, Limit: 1000}
+
+	lookups := []struct {
+		name   string
+		lookup func(tx *bbolt.Tx) ([]string, error)
+	}{
+		{"composite", func(tx *bbolt.Tx) ([]string, error) { return lookupPostings(tx, query) }},
+		{"intersection", func(tx *bbolt.Tx) ([]string, error) { return intersectPostings(tx, indexConditions(query)) }},
+	}
+	for _, l := range lookups {
+		b.Run(l.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var postings []string
+				err := aggregator.indexDB.View(func(tx *bbolt.Tx) error {
+					var err error
+					postings, err = l.lookup(tx)
+					return err
+				})
+				if err != nil {
+					b.Fatalf("索引查找失败: %v", err)
+				}
+				if _, err := readPostings(context.Background(), postings, query, dir, nil, nil); err != nil {
+					b.Fatalf("读取日志失败: %v", err)
+				}
+			}
+		})
+	}
+
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := QueryLogsWithoutIndex(query, dir); err != nil {
+				b.Fatalf("扫描查询失败: %v", err)
+			}
+		}
+	})
+}
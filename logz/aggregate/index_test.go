@@ -0,0 +1,704 @@
+package aggregate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// newIndexedCorpus 通过聚合器写入两个数据文件的日志，等待索引完成后设置为全局聚合器
+func newIndexedCorpus(t *testing.T) (string, *LogAggregator) {
+	t.Helper()
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "corpus", WithBatchSize(7))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	t.Cleanup(func() { aggregator.Close() })
+
+	levels := []string{"info", "info", "warn", "error"}
+	services := []string{"payments", "orders", "users"}
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	const total = 300
+
+	write := func(start, end int) {
+		for i := start; i < end; i++ {
+			entry := LogEntry{
+				Timestamp: base.Add(time.Duration(i) * time.Second).Format(time.RFC3339),
+				Level:     levels[i%len(levels)],
+				Message:   fmt.Sprintf("request %d took %dms", i, i%97),
+				TraceID:   fmt.Sprintf("trace-%d", i%50),
+				Service:   services[i%len(services)],
+			}
+			if err := aggregator.WriteLog(entry); err != nil {
+				t.Fatalf("写入日志失败: %v", err)
+			}
+		}
+	}
+
+	write(0, total/2)
+	firstFile := filepath.Join(dir, aggregator.output.fileID+".log")
+	if err := aggregator.Rotate(); err != nil {
+		t.Fatalf("轮转文件失败: %v", err)
+	}
+	write(total/2, total)
+	if err := aggregator.Flush(); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+
+	// 让两个文件的修改时间不同，文件扫描按修改时间从新到旧排列
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(firstFile, old, old); err != nil {
+		t.Fatalf("修改文件时间失败: %v", err)
+	}
+
+	SetGlobalAggregator(aggregator)
+	t.Cleanup(func() { SetGlobalAggregator(nil) })
+	return dir, aggregator
+}
+
+func TestQueryWithIndexIntersection(t *testing.T) {
+	dir, aggregator := newIndexedCorpus(t)
+	start := time.Date(2024, 1, 15, 10, 1, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		query LogQuery
+	}{
+		{"级别和服务", LogQuery{Level: "error", Service: "payments"}},
+		{"级别别名和服务", LogQuery{Level: "WARNING", Service: "orders"}},
+		{"TraceID和服务", LogQuery{TraceID: "trace-7", Service: "users"}},
+		{"三个条件", LogQuery{TraceID: "trace-3", Level: "error", Service: "payments"}},
+		{"交集为空", LogQuery{TraceID: "trace-1", Level: "info", Service: "users"}},
+		{"索引条件和消息", LogQuery{Level: "info", Service: "orders", Message: `took [1-3]\dms`}},
+		{"索引条件和时间范围", LogQuery{Level: "error", Service: "users", StartTime: start, EndTime: start.Add(2 * time.Minute)}},
+		{"单个条件", LogQuery{Service: "payments"}},
+		{"分页", LogQuery{Level: "info", Service: "payments", Limit: 5, Offset: 10}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := tt.query
+			if query.Limit == 0 {
+				query.Limit = 1000
+			}
+
+			expected, err := QueryLogsWithoutIndex(query, dir)
+			if err != nil {
+				t.Fatalf("扫描查询失败: %v", err)
+			}
+
+			// 直接调用索引查询，确认没有回退到文件扫描
+			entries, err := queryWithIndex(context.Background(), query, dir, aggregator, nil)
+			if err != nil {
+				t.Fatalf("索引查询失败: %v", err)
+			}
+			if len(entries) != expected.Total {
+				t.Errorf("期望索引查询匹配 %d 条，得到 %d", expected.Total, len(entries))
+			}
+
+			query.UseIndex = true
+			actual, err := QueryLogs(query, dir)
+			if err != nil {
+				t.Fatalf("查询失败: %v", err)
+			}
+			if actual.Total != expected.Total || !reflect.DeepEqual(actual.Entries, expected.Entries) {
+				t.Errorf("索引查询结果与文件扫描不一致\n期望(%d): %v\n得到(%d): %v",
+					expected.Total, expected.Entries, actual.Total, actual.Entries)
+			}
+		})
+	}
+}
+
+func TestQueryWithIndexFallback(t *testing.T) {
+	dir, aggregator := newIndexedCorpus(t)
+
+	original := maxIndexPostings
+	maxIndexPostings = 10
+	defer func() { maxIndexPostings = original }()
+
+	// 最短的倒排列表（level=error，75条）超过阈值
+	query := LogQuery{Level: "error", Service: "payments", Limit: 1000}
+	if _, err := queryWithIndex(context.Background(), query, dir, aggregator, nil); !errors.Is(err, errTooManyPostings) {
+		t.Fatalf("期望 errTooManyPostings，得到 %v", err)
+	}
+
+	// 回退到文件扫描，结果不变
+	expected, err := QueryLogsWithoutIndex(query, dir)
+	if err != nil {
+		t.Fatalf("扫描查询失败: %v", err)
+	}
+	query.UseIndex = true
+	actual, err := QueryLogs(query, dir)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("回退查询结果与文件扫描不一致")
+	}
+
+	// 回退的文件扫描需要先获取执行名额
+	admitted, released := 0, 0
+	ctx := WithScanAdmission(context.Background(), func(context.Context) (func(), error) {
+		admitted++
+		return func() { released++ }, nil
+	})
+	if _, err := QueryLogsContext(ctx, query, dir); err != nil || admitted != 1 || released != 1 {
+		t.Errorf("期望回退扫描获取并释放一次名额，得到 admitted=%d released=%d %v", admitted, released, err)
+	}
+	busy := errors.New("busy")
+	ctx = WithScanAdmission(context.Background(), func(context.Context) (func(), error) { return nil, busy })
+	if _, err := QueryLogsContext(ctx, query, dir); !errors.Is(err, busy) {
+		t.Errorf("期望获取名额失败时返回其错误，得到 %v", err)
+	}
+
+	// 最短的倒排列表在阈值内时仍然使用索引（trace-3共6条）
+	query = LogQuery{TraceID: "trace-3", Level: "error", Limit: 1000}
+	if _, err := queryWithIndex(context.Background(), query, dir, aggregator, nil); err != nil {
+		t.Errorf("期望使用最短的倒排列表查询，得到 %v", err)
+	}
+}
+
+// sortedMessages 返回排序后的日志消息列表
+func sortedMessages(entries []LogEntry) []string {
+	messages := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		messages = append(messages, entry.Message)
+	}
+	sort.Strings(messages)
+	return messages
+}
+
+func TestQueryWithIndexCompressedFile(t *testing.T) {
+	dir, aggregator := newIndexedCorpus(t)
+	files, err := filepath.Glob(filepath.Join(dir, "corpus_*.log"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("期望2个数据文件，得到 %v %v", files, err)
+	}
+	queries := []LogQuery{
+		{Level: "error", Limit: 1000},
+		{TraceID: "trace-3", Limit: 1000},
+		{Service: "payments", Level: "warn", Limit: 1000},
+	}
+	expected := make([]*LogQueryResult, len(queries))
+	for i, query := range queries {
+		if expected[i], err = QueryLogsWithoutIndex(query, dir); err != nil {
+			t.Fatalf("扫描查询失败: %v", err)
+		}
+	}
+
+	if err := aggregator.compressFile(files[0]); err != nil {
+		t.Fatalf("压缩文件失败: %v", err)
+	}
+	for i, query := range queries {
+		query.UseIndex, query.RequireIndex = true, true
+		actual, err := QueryLogs(query, dir)
+		if err != nil {
+			t.Fatalf("索引查询已压缩的文件失败: %v", err)
+		}
+		// 压缩后的文件修改时间变化，只比较匹配的条目集合
+		if got, want := sortedMessages(actual.Entries), sortedMessages(expected[i].Entries); !reflect.DeepEqual(got, want) {
+			t.Errorf("%+v: 压缩后的索引查询结果与压缩前的文件扫描不一致（%d/%d条）", query, actual.Total, expected[i].Total)
+		}
+	}
+}
+
+func TestCompositeIndex(t *testing.T) {
+	dir, aggregator := newIndexedCorpus(t)
+	start := time.Date(2024, 1, 15, 10, 1, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		query  LogQuery
+		bucket string
+	}{
+		{"服务和级别", LogQuery{Service: "payments", Level: "error"}, "service_level"},
+		{"服务和级别别名", LogQuery{Service: "orders", Level: "WARNING"}, "service_level"},
+		{"服务、级别和时间范围", LogQuery{Service: "users", Level: "info", StartTime: start, EndTime: start.Add(90 * time.Second)}, "service_level"},
+		{"服务、级别和TraceID", LogQuery{Service: "payments", Level: "error", TraceID: "trace-3"}, "service_level"},
+		{"TraceID和时间范围", LogQuery{TraceID: "trace-7", StartTime: start}, "trace_time"},
+		{"TraceID和结束时间", LogQuery{TraceID: "trace-7", EndTime: start.Add(time.Minute)}, "trace_time"},
+		{"只有TraceID", LogQuery{TraceID: "trace-7"}, ""},
+		{"只有服务", LogQuery{Service: "payments", StartTime: start}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := tt.query
+			query.Limit = 1000
+
+			scan, _ := planComposite(query)
+			if got := ""; scan != nil {
+				got = scan.bucket
+				if got != tt.bucket {
+					t.Fatalf("期望使用组合索引%q，得到 %q", tt.bucket, got)
+				}
+			} else if tt.bucket != "" {
+				t.Fatalf("期望使用组合索引%q，得到倒排列表交集", tt.bucket)
+			}
+
+			expected, err := QueryLogsWithoutIndex(query, dir)
+			if err != nil {
+				t.Fatalf("扫描查询失败: %v", err)
+			}
+
+			// 组合索引已按时间范围过滤，候选位置即为最终结果
+			var postings []string
+			aggregator.indexDB.View(func(tx *bbolt.Tx) error {
+				postings, err = lookupPostings(tx, query)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("索引查找失败: %v", err)
+			}
+			if tt.bucket != "" && len(postings) != expected.Total {
+				t.Errorf("期望 %d 个候选位置，得到 %d", expected.Total, len(postings))
+			}
+
+			query.UseIndex = true
+			actual, err := QueryLogs(query, dir)
+			if err != nil {
+				t.Fatalf("查询失败: %v", err)
+			}
+			if !reflect.DeepEqual(actual.Entries, expected.Entries) {
+				t.Errorf("索引查询结果与文件扫描不一致\n期望: %v\n得到: %v", expected.Entries, actual.Entries)
+			}
+		})
+	}
+}
+
+func TestLegacyIndexWithoutComposite(t *testing.T) {
+	dir, aggregator := newIndexedCorpus(t)
+	SetGlobalAggregator(nil)
+
+	// 模拟旧版本的索引数据库：有倒排列表但没有组合索引
+	err := aggregator.indexDB.Update(func(tx *bbolt.Tx) error {
+		for _, name := range compositeBuckets {
+			if err := tx.DeleteBucket([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("删除组合索引失败: %v", err)
+	}
+	aggregator.Close()
+
+	aggregator, err = NewLogAggregatorWithOptions(dir, "corpus")
+	if err != nil {
+		t.Fatalf("重新打开聚合器失败: %v", err)
+	}
+	aggregator.indexDB.View(func(tx *bbolt.Tx) error {
+		for _, name := range compositeBuckets {
+			if tx.Bucket([]byte(name)) != nil {
+				t.Errorf("已有数据的旧索引不应创建空的组合索引%s", name)
+			}
+		}
+		return nil
+	})
+
+	// 没有组合索引时回退到倒排列表交集
+	query := LogQuery{Service: "payments", Level: "error", Limit: 1000}
+	expected, err := QueryLogsWithoutIndex(query, dir)
+	if err != nil {
+		t.Fatalf("扫描查询失败: %v", err)
+	}
+	entries, err := queryWithIndex(context.Background(), query, dir, aggregator, nil)
+	if err != nil {
+		t.Fatalf("索引查询失败: %v", err)
+	}
+	if len(entries) != expected.Total {
+		t.Errorf("期望 %d 条，得到 %d", expected.Total, len(entries))
+	}
+	aggregator.Close()
+
+	// 重建索引后组合索引可用
+	if _, err := RebuildIndex(dir, "corpus"); err != nil {
+		t.Fatalf("重建索引失败: %v", err)
+	}
+	aggregator, err = NewLogAggregatorWithOptions(dir, "corpus")
+	if err != nil {
+		t.Fatalf("重新打开聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+	aggregator.indexDB.View(func(tx *bbolt.Tx) error {
+		for _, name := range compositeBuckets {
+			if k, _ := tx.Bucket([]byte(name)).Cursor().First(); k == nil {
+				t.Errorf("重建后组合索引%s应包含数据", name)
+			}
+		}
+		return nil
+	})
+}
+
+func TestMigratePostings(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "legacy", WithBatchSize(1))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+
+	// 写入旧格式的索引：每个值只记录一个位置
+	err = aggregator.indexDB.Update(func(tx *bbolt.Tx) error {
+		if err := tx.Bucket([]byte("trace_id")).Put([]byte("trace-old"), []byte("legacy_001:42")); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte("service")).Put([]byte("payments"), []byte("legacy_001:42"))
+	})
+	if err != nil {
+		t.Fatalf("写入旧索引失败: %v", err)
+	}
+	aggregator.Close()
+
+	aggregator, err = NewLogAggregatorWithOptions(dir, "legacy", WithBatchSize(1))
+	if err != nil {
+		t.Fatalf("重新打开聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+
+	aggregator.indexDB.View(func(tx *bbolt.Tx) error {
+		for bucket, term := range map[string]string{"trace_id": "trace-old", "service": "payments"} {
+			b := tx.Bucket([]byte(bucket))
+			if b.Get([]byte(term)) != nil {
+				t.Errorf("%s索引中仍有旧格式的键", bucket)
+			}
+			if got := b.Get(postingKey(term, "legacy_001:42")); string(got) != "legacy_001:42" {
+				t.Errorf("%s索引期望迁移为倒排条目，得到 %q", bucket, got)
+			}
+		}
+		return nil
+	})
+}
+
+// indexSnapshot 返回索引数据库中每个索引桶的所有键
+func indexSnapshot(t *testing.T, db *bbolt.DB) map[string][]string {
+	t.Helper()
+	snapshot := make(map[string][]string)
+	err := db.View(func(tx *bbolt.Tx) error {
+		for _, name := range append(indexBuckets, compositeBuckets...) {
+			err := tx.Bucket([]byte(name)).ForEach(func(k, v []byte) error {
+				snapshot[name] = append(snapshot[name], string(k))
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("读取索引失败: %v", err)
+	}
+	return snapshot
+}
+
+func TestRebuildIndex(t *testing.T) {
+	dir, aggregator := newIndexedCorpus(t)
+	expected := indexSnapshot(t, aggregator.indexDB)
+	SetGlobalAggregator(nil)
+	aggregator.Close()
+
+	// 前缀相同的其他服务的文件不属于corpus
+	other := filepath.Join(dir, "corpus_v2_2024-01-15_001.log")
+	if err := os.WriteFile(other, []byte(`{"level":"info","msg":"other","service":"v2"}`+"\n"), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+
+	dbPath := filepath.Join(dir, "index", "corpus.db")
+	if err := os.Remove(dbPath); err != nil {
+		t.Fatalf("删除索引失败: %v", err)
+	}
+
+	indexed, err := RebuildIndex(dir, "corpus")
+	if err != nil {
+		t.Fatalf("重建索引失败: %v", err)
+	}
+	if indexed != 300 {
+		t.Errorf("期望索引300条日志，得到 %d", indexed)
+	}
+
+	db, err := bbolt.Open(dbPath, 0600, nil)
+	if err != nil {
+		t.Fatalf("打开索引失败: %v", err)
+	}
+	defer db.Close()
+	if actual := indexSnapshot(t, db); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("重建的索引与聚合器写入的索引不一致")
+	}
+
+	services, err := DiscoverServices(dir)
+	if err != nil {
+		t.Fatalf("查找服务失败: %v", err)
+	}
+	if want := []string{"corpus", "corpus_v2"}; !reflect.DeepEqual(services, want) {
+		t.Errorf("期望服务 %v，得到 %v", want, services)
+	}
+}
+
+func TestRebuildIndexWithRetentionPolicy(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "svc", WithRetentionPolicy(RetentionPolicy{Default: 7, Levels: map[string]int{"error": 30}}))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	for i := 0; i < 20; i++ {
+		level := "info"
+		if i%4 == 0 {
+			level = "error"
+		}
+		if err := aggregator.WriteLog(LogEntry{Level: level, Message: fmt.Sprintf("m%d", i), TraceID: fmt.Sprintf("trace-%d", i%3)}); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+	}
+	if err := aggregator.Flush(); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+	expected := indexSnapshot(t, aggregator.indexDB)
+	aggregator.Close()
+
+	if levelFiles, _ := filepath.Glob(filepath.Join(dir, "svc_error_*.log")); len(levelFiles) != 1 {
+		t.Fatalf("期望1个error级别文件，得到 %v", levelFiles)
+	}
+	services, err := DiscoverServices(dir)
+	if err != nil {
+		t.Fatalf("查找服务失败: %v", err)
+	}
+	if want := []string{"svc"}; !reflect.DeepEqual(services, want) {
+		t.Errorf("期望服务 %v，得到 %v", want, services)
+	}
+
+	dbPath := filepath.Join(dir, "index", "svc.db")
+	if err := os.Remove(dbPath); err != nil {
+		t.Fatalf("删除索引失败: %v", err)
+	}
+	indexed, err := RebuildIndex(dir, "svc")
+	if err != nil {
+		t.Fatalf("重建索引失败: %v", err)
+	}
+	if indexed != 20 {
+		t.Errorf("期望索引20条日志，得到 %d", indexed)
+	}
+
+	db, err := bbolt.Open(dbPath, 0600, nil)
+	if err != nil {
+		t.Fatalf("打开索引失败: %v", err)
+	}
+	defer db.Close()
+	if actual := indexSnapshot(t, db); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("重建的索引与聚合器写入的索引不一致")
+	}
+}
+
+func TestQueryWithIndexReadsUnindexedTail(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "lag", WithBatchSize(1))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+	SetGlobalAggregator(aggregator)
+	defer SetGlobalAggregator(nil)
+
+	entry := LogEntry{Level: "info", Message: "已索引", TraceID: "trace-indexed", Service: "lag"}
+	if err := aggregator.WriteLog(entry); err != nil {
+		t.Fatalf("写入日志失败: %v", err)
+	}
+
+	// 写入后立即查询，不等待索引线程
+	result, err := QueryLogs(LogQuery{TraceID: "trace-indexed", UseIndex: true, Limit: 10}, dir)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if result.Total != 1 {
+		t.Fatalf("期望写入后立即查询到 1 条，得到 %d", result.Total)
+	}
+
+	waitIndexed(t, aggregator)
+
+	// 占住索引数据库的写事务，使索引线程无法完成
+	locked := make(chan struct{})
+	release := make(chan struct{})
+	go aggregator.indexDB.Update(func(tx *bbolt.Tx) error {
+		close(locked)
+		<-release
+		return nil
+	})
+	<-locked
+	released := false
+	defer func() {
+		if !released {
+			close(release)
+		}
+	}()
+
+	for i := 0; i < 3; i++ {
+		entry := LogEntry{Level: "error", Message: fmt.Sprintf("未索引 %d", i), TraceID: "trace-lag", Service: "lag"}
+		if err := aggregator.WriteLog(entry); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+	}
+
+	info, err := aggregator.Describe()
+	if err != nil {
+		t.Fatalf("获取聚合器信息失败: %v", err)
+	}
+	if info.IndexLagEntries != 3 {
+		t.Errorf("期望索引滞后 3 条，得到 %d", info.IndexLagEntries)
+	}
+	if info.IndexLagDuration <= 0 {
+		t.Errorf("期望索引滞后时间大于0，得到 %v", info.IndexLagDuration)
+	}
+
+	query := LogQuery{TraceID: "trace-lag", UseIndex: true, Limit: 10}
+	result, err = QueryLogs(query, dir)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if result.Total != 3 {
+		t.Fatalf("期望查询到 3 条未索引的日志，得到 %d", result.Total)
+	}
+	result, err = QueryLogs(LogQuery{Level: "error", Service: "lag", UseIndex: true, Limit: 10}, dir)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if result.Total != 3 {
+		t.Errorf("期望只匹配 3 条 error 日志，得到 %d", result.Total)
+	}
+
+	// 索引完成后滞后归零，结果不重复
+	close(release)
+	released = true
+	if info := waitIndexed(t, aggregator); info.IndexLagDuration != 0 {
+		t.Errorf("期望索引滞后时间为0，得到 %v", info.IndexLagDuration)
+	}
+	result, err = QueryLogs(query, dir)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if result.Total != 3 {
+		t.Errorf("期望索引完成后查询到 3 条，得到 %d", result.Total)
+	}
+}
+
+// waitIndexed 等待聚合器写入的日志全部建立索引
+func waitIndexed(t *testing.T, aggregator *LogAggregator) AggregatorInfo {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		info, err := aggregator.Describe()
+		if err != nil {
+			t.Fatalf("获取聚合器信息失败: %v", err)
+		}
+		if info.IndexLagEntries == 0 {
+			return info
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("等待索引超时: 滞后 %d 条", info.IndexLagEntries)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestIndexLagOutOfOrder(t *testing.T) {
+	var lag indexLag
+	now := time.Now()
+	a := lag.add("f1", 0, now)
+	b := lag.add("f1", 10, now)
+	c := lag.add("f2", 0, now.Add(time.Second))
+
+	lag.done(b)
+	if tails := lag.unindexed(); len(tails) != 2 || tails[0].offset != 0 || tails[1].fileID != "f2" {
+		t.Errorf("期望 f1:0 和 f2:0，得到 %+v", tails)
+	}
+	lag.done(a)
+	if n, d := lag.lag(now.Add(3 * time.Second)); n != 1 || d != 2*time.Second {
+		t.Errorf("期望滞后 1 条 2s，得到 %d 条 %v", n, d)
+	}
+	lag.done(c)
+	lag.done(c)
+	if n, d := lag.lag(now); n != 0 || d != 0 {
+		t.Errorf("期望没有滞后，得到 %d 条 %v", n, d)
+	}
+	if tails := lag.unindexed(); len(tails) != 0 {
+		t.Errorf("期望没有未索引的条目，得到 %+v", tails)
+	}
+}
+
+func TestHostnameFilter(t *testing.T) {
+	dir := t.TempDir()
+	// 两个副本写入同一目录，聚合器之间只有主机名和进程ID不同
+	replicaA, err := NewLogAggregatorWithOptions(dir, "orders-a", WithBatchSize(1), WithHostname("host-a"))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer replicaA.Close()
+	replicaB, err := NewLogAggregatorWithOptions(dir, "orders-b", WithBatchSize(1), WithHostname("host-b"), WithPID(7))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer replicaB.Close()
+	SetGlobalAggregator(replicaA)
+	defer SetGlobalAggregator(nil)
+
+	for _, aggregator := range []*LogAggregator{replicaA, replicaB} {
+		entry := LogEntry{Level: "info", Message: "order placed", TraceID: "trace-replica", Service: "orders"}
+		if err := aggregator.WriteLog(entry); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+	}
+	// 调用方指定的主机名（如转发的日志）不被覆盖
+	if err := replicaB.WriteLog(LogEntry{Level: "info", Message: "forwarded", Service: "orders", Hostname: "edge-1"}); err != nil {
+		t.Fatalf("写入日志失败: %v", err)
+	}
+	// 旧版本写入的条目没有主机名
+	writeBackdatedFile(t, filepath.Join(dir, "legacy.log"),
+		`{"timestamp":"2024-01-15T10:30:00Z","level":"info","msg":"order placed","trace_id":"trace-replica","service":"orders"}`+"\n", 0)
+	waitIndexed(t, replicaA)
+	waitIndexed(t, replicaB)
+
+	tests := []struct {
+		hostname string
+		useIndex bool
+		pid      int
+	}{
+		{"host-a", true, os.Getpid()},
+		{"host-a", false, os.Getpid()},
+		{"host-b", false, 7},
+	}
+	for _, tt := range tests {
+		result, err := QueryLogs(LogQuery{TraceID: "trace-replica", Hostname: tt.hostname, UseIndex: tt.useIndex, RequireIndex: tt.useIndex, Limit: 10}, dir)
+		if err != nil {
+			t.Fatalf("查询失败: %v", err)
+		}
+		if result.Total != 1 || result.Entries[0].Hostname != tt.hostname || result.Entries[0].PID != tt.pid {
+			t.Errorf("%s UseIndex=%v: 期望 1 条进程ID为 %d 的日志，得到 %+v", tt.hostname, tt.useIndex, tt.pid, result.Entries)
+		}
+	}
+
+	// 不按主机名过滤时包括旧条目，旧条目的主机名为空
+	result, err := QueryLogs(LogQuery{TraceID: "trace-replica", Limit: 10}, dir)
+	if err != nil || result.Total != 3 {
+		t.Fatalf("期望查询到 3 条，得到 %+v %v", result, err)
+	}
+	hosts := make(map[string]bool)
+	for _, entry := range result.Entries {
+		hosts[entry.Hostname] = true
+	}
+	if !hosts["host-a"] || !hosts["host-b"] || !hosts[""] {
+		t.Errorf("期望主机名包括host-a、host-b和空，得到 %v", hosts)
+	}
+
+	result, err = QueryLogs(LogQuery{Hostname: "edge-1", Limit: 10}, dir)
+	if err != nil || result.Total != 1 || result.Entries[0].Message != "forwarded" || result.Entries[0].PID != 7 {
+		t.Errorf("期望保留调用方指定的主机名，得到 %+v %v", result, err)
+	}
+}
@@ -0,0 +1,379 @@
+package aggregate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// filePostingsBucket 索引的反向桶，记录每个文件ID写入了哪些索引键，清理文件时按文件ID前缀删除，不需要扫描所有索引桶
+//
+//	file_postings: "<文件ID>\x00<索引桶>\x00<索引键>" -> "<文件ID>:<偏移量>"
+//
+// 值与索引桶中的相同，扫描所有索引桶按值删除时反向条目也会被删除
+// 与组合索引一样只在索引为空时创建，旧版本创建的数据库没有该桶，清理文件时扫描所有索引桶，重建索引后才会使用
+const filePostingsBucket = "file_postings"
+
+// DefaultIndexSweepInterval 维护任务全量扫描索引、删除指向已不存在文件的索引条目的默认间隔
+const DefaultIndexSweepInterval = 24 * time.Hour
+
+// indexGCBatchSize 按反向桶删除索引条目时每个事务删除的条目数，测试中可修改
+var indexGCBatchSize = 10000
+
+// WithIndexSweepInterval 设置维护任务全量扫描索引的间隔，扫描删除指向磁盘上已不存在的文件的索引条目
+// （如在聚合器之外删除的文件）；为0时不扫描，默认24小时
+func WithIndexSweepInterval(d time.Duration) AggregatorOption {
+	return func(o *aggregatorOptions) error {
+		if d < 0 {
+			return fmt.Errorf("索引扫描间隔不能为负数: %v", d)
+		}
+		o.indexSweepInterval = d
+		return nil
+	}
+}
+
+// IndexGCStats 清理已删除文件的索引条目的统计，条目数不包括反向桶中的条目
+type IndexGCStats struct {
+	FilesCollected       uint64    `json:"files_collected"`        // 保留策略删除文件后清理了索引的文件数
+	PostingsRemoved      uint64    `json:"postings_removed"`       // 保留策略删除文件后清理的索引条目数
+	Sweeps               uint64    `json:"sweeps"`                 // 全量扫描次数
+	SweepFilesCollected  uint64    `json:"sweep_files_collected"`  // 全量扫描发现的不存在的文件数
+	SweepPostingsRemoved uint64    `json:"sweep_postings_removed"` // 全量扫描清理的索引条目数
+	LastSweepAt          time.Time `json:"last_sweep_at,omitzero"`
+	LastSweepError       string    `json:"last_sweep_error,omitempty"`
+}
+
+// indexGC 索引清理的计数
+type indexGC struct {
+	filesCollected  atomic.Uint64
+	postingsRemoved atomic.Uint64
+	sweeps          atomic.Uint64
+	sweepFiles      atomic.Uint64
+	sweepPostings   atomic.Uint64
+
+	mutex     sync.Mutex
+	lastSweep time.Time
+	lastErr   string
+}
+
+// snapshot 返回统计的快照
+func (gc *indexGC) snapshot() IndexGCStats {
+	gc.mutex.Lock()
+	defer gc.mutex.Unlock()
+	return IndexGCStats{
+		FilesCollected:       gc.filesCollected.Load(),
+		PostingsRemoved:      gc.postingsRemoved.Load(),
+		Sweeps:               gc.sweeps.Load(),
+		SweepFilesCollected:  gc.sweepFiles.Load(),
+		SweepPostingsRemoved: gc.sweepPostings.Load(),
+		LastSweepAt:          gc.lastSweep,
+		LastSweepError:       gc.lastErr,
+	}
+}
+
+// reverseKey 生成反向桶的键
+func reverseKey(fileID, bucket string, key []byte) []byte {
+	reverse := make([]byte, 0, len(fileID)+len(bucket)+2+len(key))
+	reverse = append(reverse, fileID...)
+	reverse = append(reverse, postingSeparator)
+	reverse = append(reverse, bucket...)
+	reverse = append(reverse, postingSeparator)
+	return append(reverse, key...)
+}
+
+// splitReverseKey 拆分反向桶的键，返回索引桶名和索引键
+func splitReverseKey(key []byte) (string, []byte, bool) {
+	_, rest, found := bytes.Cut(key, []byte{postingSeparator})
+	if !found {
+		return "", nil, false
+	}
+	bucket, indexKey, found := bytes.Cut(rest, []byte{postingSeparator})
+	return string(bucket), indexKey, found
+}
+
+// putIndexKey 写入索引键，并在反向桶中记录，反向桶不存在（旧版本数据库）时只写入索引
+func putIndexKey(tx *bbolt.Tx, bucket *bbolt.Bucket, name string, key []byte, posting string) error {
+	if err := bucket.Put(key, []byte(posting)); err != nil {
+		return fmt.Errorf("添加%s索引失败: %w", name, err)
+	}
+	reverse := tx.Bucket([]byte(filePostingsBucket))
+	if reverse == nil {
+		return nil
+	}
+	fileID, _, _ := strings.Cut(posting, ":")
+	if err := reverse.Put(reverseKey(fileID, name, key), []byte(posting)); err != nil {
+		return fmt.Errorf("添加%s反向索引失败: %w", name, err)
+	}
+	return nil
+}
+
+// viewIndex 在索引数据库的读事务中执行fn，索引不可用时返回错误
+func (la *LogAggregator) viewIndex(fn func(tx *bbolt.Tx) error) error {
+	la.indexMutex.RLock()
+	defer la.indexMutex.RUnlock()
+	if la.indexDB == nil {
+		return la.indexClosedErrLocked()
+	}
+	return la.indexDB.View(fn)
+}
+
+// updateIndex 在索引数据库的写事务中执行fn，索引不可用时返回错误
+// 只持有indexMutex读锁，压缩索引期间等待，多次调用之间索引写入和查询可以继续
+func (la *LogAggregator) updateIndex(fn func(tx *bbolt.Tx) error) error {
+	la.indexMutex.RLock()
+	defer la.indexMutex.RUnlock()
+	if la.indexDB == nil {
+		return la.indexClosedErrLocked()
+	}
+	return la.indexDB.Update(fn)
+}
+
+// removeIndexPostings 删除引用指定文件ID的索引条目，并在文件注册表中标记为已删除，dryRun为true时只统计
+// 有反向桶时先标记文件已删除，再按文件ID前缀分批删除，每个事务最多删除indexGCBatchSize个索引键；
+// 分批删除期间查询到剩余的条目时按注册表返回*LogFileRemovedError。没有反向桶时在一个事务中扫描所有索引桶
+func (la *LogAggregator) removeIndexPostings(fileIDs map[string]bool, dryRun bool) (int, error) {
+	var reverse bool
+	err := la.viewIndex(func(tx *bbolt.Tx) error {
+		reverse = tx.Bucket([]byte(filePostingsBucket)) != nil
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !reverse {
+		removed, err := la.scanIndexPostings(fileIDs, dryRun)
+		if err == nil && !dryRun {
+			la.gc.filesCollected.Add(uint64(len(fileIDs)))
+			la.gc.postingsRemoved.Add(uint64(removed))
+		}
+		return removed, err
+	}
+
+	ids := make([]string, 0, len(fileIDs))
+	for fileID := range fileIDs {
+		ids = append(ids, fileID)
+	}
+	sort.Strings(ids)
+
+	var removed int
+	if dryRun {
+		err := la.viewIndex(func(tx *bbolt.Tx) error {
+			cursor := tx.Bucket([]byte(filePostingsBucket)).Cursor()
+			for _, fileID := range ids {
+				prefix := postingPrefix(fileID)
+				for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+					removed++
+				}
+			}
+			return nil
+		})
+		return removed, err
+	}
+
+	now := time.Now()
+	err = la.updateIndex(func(tx *bbolt.Tx) error {
+		return updateFileRecords(tx, ids, func(record *FileRecord) {
+			record.State = FileStateDeleted
+			record.DeletedAt = now
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, fileID := range ids {
+		for more := true; more; {
+			var n int
+			err := la.updateIndex(func(tx *bbolt.Tx) error {
+				var err error
+				n, more, err = removeFilePostingsBatch(tx, fileID, indexGCBatchSize)
+				return err
+			})
+			removed += n
+			la.gc.postingsRemoved.Add(uint64(n))
+			if err != nil {
+				return removed, err
+			}
+		}
+		la.gc.filesCollected.Add(1)
+	}
+	return removed, nil
+}
+
+// removeFilePostingsBatch 按反向桶删除文件ID的最多limit个索引键及其反向条目，返回删除的索引键数和是否还有剩余
+func removeFilePostingsBatch(tx *bbolt.Tx, fileID string, limit int) (int, bool, error) {
+	reverse := tx.Bucket([]byte(filePostingsBucket))
+	prefix := postingPrefix(fileID)
+	var keys [][]byte
+	more := false
+	cursor := reverse.Cursor()
+	for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+		if len(keys) == limit {
+			more = true
+			break
+		}
+		keys = append(keys, append([]byte(nil), k...))
+	}
+
+	var removed int
+	for _, key := range keys {
+		if name, indexKey, ok := splitReverseKey(key); ok {
+			if bucket := tx.Bucket([]byte(name)); bucket != nil && bucket.Get(indexKey) != nil {
+				if err := bucket.Delete(indexKey); err != nil {
+					return removed, false, fmt.Errorf("删除索引桶%s中的条目失败: %w", name, err)
+				}
+				removed++
+			}
+		}
+		if err := reverse.Delete(key); err != nil {
+			return removed, false, fmt.Errorf("删除反向索引失败: %w", err)
+		}
+	}
+	return removed, more, nil
+}
+
+// scanIndexPostings 扫描所有索引桶，删除值引用指定文件ID的条目（包括反向条目），并在文件注册表中标记为已删除
+// dryRun为true时只统计，返回的条目数不包括反向条目
+func (la *LogAggregator) scanIndexPostings(fileIDs map[string]bool, dryRun bool) (int, error) {
+	la.indexMutex.Lock()
+	defer la.indexMutex.Unlock()
+
+	if la.indexDB == nil {
+		return 0, la.indexClosedErrLocked()
+	}
+
+	var removed int
+	fn := la.indexDB.Update
+	if dryRun {
+		fn = la.indexDB.View
+	}
+	err := fn(func(tx *bbolt.Tx) error {
+		err := tx.ForEach(func(name []byte, bucket *bbolt.Bucket) error {
+			if string(name) == filesBucket {
+				return nil
+			}
+			var keys [][]byte
+			err := bucket.ForEach(func(k, v []byte) error {
+				fileID, _, found := strings.Cut(string(v), ":")
+				if found && fileIDs[fileID] {
+					keys = append(keys, append([]byte(nil), k...))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			if string(name) != filePostingsBucket {
+				removed += len(keys)
+			}
+			if dryRun {
+				return nil
+			}
+			for _, key := range keys {
+				if err := bucket.Delete(key); err != nil {
+					return fmt.Errorf("删除索引桶%s中的条目失败: %w", name, err)
+				}
+			}
+			return nil
+		})
+		if err != nil || dryRun {
+			return err
+		}
+		ids := make([]string, 0, len(fileIDs))
+		for fileID := range fileIDs {
+			ids = append(ids, fileID)
+		}
+		now := time.Now()
+		return updateFileRecords(tx, ids, func(record *FileRecord) {
+			record.State = FileStateDeleted
+			record.DeletedAt = now
+		})
+	})
+	return removed, err
+}
+
+// SweepIndex 全量扫描索引，删除指向磁盘上已不存在的文件（.log和.log.gz都不存在）的索引条目，返回删除的条目数
+// 用于清理在聚合器之外删除的文件和清理失败时遗留的条目，维护任务按WithIndexSweepInterval定期调用
+// 扫描期间暂停压缩文件，避免把正在从.log压缩为.log.gz的文件当作已删除
+func (la *LogAggregator) SweepIndex(ctx context.Context) (int, error) {
+	la.compressMutex.Lock()
+	defer la.compressMutex.Unlock()
+
+	current := la.currentFileIDs()
+	referenced := make(map[string]bool)
+	err := la.viewIndex(func(tx *bbolt.Tx) error {
+		return tx.ForEach(func(name []byte, bucket *bbolt.Bucket) error {
+			if string(name) == filesBucket {
+				return nil
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return bucket.ForEach(func(k, v []byte) error {
+				if fileID, _, found := bytes.Cut(v, []byte(":")); found && !referenced[string(fileID)] {
+					referenced[string(fileID)] = true
+				}
+				return nil
+			})
+		})
+	})
+
+	missing := make(map[string]bool)
+	if err == nil {
+		for fileID := range referenced {
+			plain := filepath.Join(la.outputDir, fileID+".log")
+			if !current[fileID] && !fileExists(plain) && !fileExists(plain+".gz") {
+				missing[fileID] = true
+			}
+		}
+	}
+	var removed int
+	if err == nil && len(missing) > 0 {
+		removed, err = la.scanIndexPostings(missing, false)
+	}
+
+	la.gc.sweeps.Add(1)
+	la.gc.mutex.Lock()
+	la.gc.lastSweep = time.Now()
+	la.gc.lastErr = ""
+	if err != nil {
+		la.gc.lastErr = err.Error()
+	}
+	la.gc.mutex.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	la.gc.sweepFiles.Add(uint64(len(missing)))
+	la.gc.sweepPostings.Add(uint64(removed))
+	return removed, nil
+}
+
+// sweepIndexIfDue 在维护任务中按WithIndexSweepInterval全量扫描索引，启动后的第一次维护任务即扫描
+func (la *LogAggregator) sweepIndexIfDue() {
+	if la.indexSweepInterval <= 0 {
+		return
+	}
+	la.gc.mutex.Lock()
+	last := la.gc.lastSweep
+	la.gc.mutex.Unlock()
+	if !last.IsZero() && time.Since(last) < la.indexSweepInterval {
+		return
+	}
+	removed, err := la.SweepIndex(la.ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[索引清理错误] %v\n", err)
+		return
+	}
+	if removed > 0 {
+		fmt.Fprintf(os.Stderr, "[索引] 删除指向已不存在文件的索引条目 %d 条\n", removed)
+	}
+}
@@ -0,0 +1,205 @@
+package aggregate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+// indexKeyTotal 返回除文件注册表外所有索引桶的键数之和
+func indexKeyTotal(t *testing.T, aggregator *LogAggregator) (int, map[string]int) {
+	t.Helper()
+	counts, err := countBucketKeys(aggregator.indexDB)
+	if err != nil {
+		t.Fatalf("统计索引键失败: %v", err)
+	}
+	total := 0
+	for name, count := range counts {
+		if name != filesBucket {
+			total += count
+		}
+	}
+	return total, counts
+}
+
+// indexEntries 为文件ID加入n个条目的索引
+func indexEntries(t *testing.T, aggregator *LogAggregator, fileID string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		entry := LogEntry{
+			Timestamp: "2020-01-01T00:00:00Z",
+			Level:     "info",
+			Service:   "gc-service",
+			TraceID:   fmt.Sprintf("%s-trace-%d", fileID, i),
+			FileID:    fileID,
+			Offset:    int64(i * 100),
+		}
+		if err := aggregator.addToIndex(entry); err != nil {
+			t.Fatalf("添加索引失败: %v", err)
+		}
+	}
+}
+
+func TestIndexGCOnCleanup(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "gc-service", WithIndexSweepInterval(0))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+	SetGlobalAggregator(aggregator)
+	defer SetGlobalAggregator(nil)
+	defer func(size int) { indexGCBatchSize = size }(indexGCBatchSize)
+	indexGCBatchSize = 7
+
+	oldIDs := []string{"gc-service_2020-01-01_001", "gc-service_2020-01-02_001"}
+	keptID := "gc-service_2020-01-03_001"
+	writeBackdatedFile(t, filepath.Join(dir, oldIDs[0]+".log"), "old\n", 30)
+	writeBackdatedFile(t, filepath.Join(dir, oldIDs[1]+".log.gz"), "compressed", 30)
+	writeBackdatedFile(t, filepath.Join(dir, keptID+".log"), "recent\n", 1)
+	for _, fileID := range append(oldIDs, keptID) {
+		indexEntries(t, aggregator, fileID, 10)
+	}
+
+	// 每个条目有trace_id、level、service、time四个倒排列表和service_level、trace_time两个组合索引，反向桶各记录一次
+	before, counts := indexKeyTotal(t, aggregator)
+	if counts[filePostingsBucket] != 180 || before != 360 {
+		t.Fatalf("期望180个索引键和180个反向条目，得到 %d %v", before, counts)
+	}
+
+	report, err := CleanupOldLogsWithDryRun(dir, 7, true)
+	if err != nil || report.IndexPostingsRemoved != 120 {
+		t.Fatalf("期望统计到120条索引，得到 %+v %v", report, err)
+	}
+	if total, _ := indexKeyTotal(t, aggregator); total != before {
+		t.Errorf("dry run不应删除索引，得到 %d", total)
+	}
+
+	report, err = CleanupOldLogs(dir, 7)
+	if err != nil || report.FilesDeleted != 2 || report.IndexPostingsRemoved != 120 {
+		t.Fatalf("期望删除2个文件和120条索引，得到 %+v %v", report, err)
+	}
+	after, counts := indexKeyTotal(t, aggregator)
+	if after != 120 || counts[filePostingsBucket] != 60 || counts["trace_id"] != 10 {
+		t.Errorf("期望只剩保留文件的索引，得到 %d %v", after, counts)
+	}
+
+	stats := AggregatorStats().IndexGC
+	if stats.FilesCollected != 2 || stats.PostingsRemoved != 120 || stats.Sweeps != 0 {
+		t.Errorf("期望统计清理2个文件和120条索引，得到 %+v", stats)
+	}
+
+	// 查询只返回保留文件中的条目，已删除文件标记在注册表中
+	records, err := aggregator.Files()
+	if err != nil {
+		t.Fatalf("读取文件注册表失败: %v", err)
+	}
+	deleted := 0
+	for _, record := range records {
+		if record.State == FileStateDeleted {
+			deleted++
+		}
+	}
+	if deleted != 2 {
+		t.Errorf("期望2个文件标记为已删除，得到 %+v", records)
+	}
+}
+
+func TestSweepIndex(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "gc-service", WithIndexSweepInterval(0))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+
+	// 在聚合器之外删除的文件
+	goneID, compressedID := "gc-service_2020-01-01_001", "gc-service_2020-01-02_001"
+	writeBackdatedFile(t, filepath.Join(dir, compressedID+".log.gz"), "compressed", 1)
+	indexEntries(t, aggregator, goneID, 5)
+	indexEntries(t, aggregator, compressedID, 5)
+	before, _ := indexKeyTotal(t, aggregator)
+
+	removed, err := aggregator.SweepIndex(context.Background())
+	if err != nil || removed != 30 {
+		t.Fatalf("期望删除30条索引，得到 %d %v", removed, err)
+	}
+	after, counts := indexKeyTotal(t, aggregator)
+	if after != before/2 || counts[filePostingsBucket] != 30 {
+		t.Errorf("期望只剩压缩文件的索引，得到 %d -> %d %v", before, after, counts)
+	}
+
+	// 再次扫描没有可删除的条目
+	if removed, err := aggregator.SweepIndex(context.Background()); err != nil || removed != 0 {
+		t.Errorf("期望第二次扫描不删除条目，得到 %d %v", removed, err)
+	}
+	stats := aggregator.Stats().IndexGC
+	if stats.Sweeps != 2 || stats.SweepFilesCollected != 1 || stats.SweepPostingsRemoved != 30 || stats.LastSweepAt.IsZero() {
+		t.Errorf("期望统计2次扫描，得到 %+v", stats)
+	}
+
+	if _, err := aggregator.SweepIndex(canceledContext()); err == nil {
+		t.Error("期望ctx取消时返回错误")
+	}
+}
+
+// canceledContext 返回已取消的ctx
+func canceledContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}
+
+func TestIndexGCWithoutReverseBucket(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "gc-service", WithIndexSweepInterval(0))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	oldID := "gc-service_2020-01-01_001"
+	indexEntries(t, aggregator, oldID, 3)
+	// 模拟旧版本创建的数据库：删除反向桶后重新打开，已有索引时不再创建
+	aggregator.indexDB.Update(func(tx *bbolt.Tx) error {
+		return tx.DeleteBucket([]byte(filePostingsBucket))
+	})
+	aggregator.Close()
+
+	aggregator, err = NewLogAggregatorWithOptions(dir, "gc-service", WithIndexSweepInterval(0))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+	if _, counts := indexKeyTotal(t, aggregator); counts[filePostingsBucket] != 0 {
+		t.Fatalf("期望没有反向桶，得到 %v", counts)
+	}
+	indexEntries(t, aggregator, "gc-service_2020-01-02_001", 1)
+
+	// 没有反向桶时扫描所有索引桶
+	removed, err := aggregator.removeIndexPostings(map[string]bool{oldID: true}, false)
+	if err != nil || removed != 18 {
+		t.Fatalf("期望删除18条索引，得到 %d %v", removed, err)
+	}
+	if total, _ := indexKeyTotal(t, aggregator); total != 6 {
+		t.Errorf("期望只剩1个条目的6条索引，得到 %d", total)
+	}
+
+	// 重建索引后重新创建反向桶
+	aggregator.Close()
+	os.WriteFile(filepath.Join(dir, "gc-service_2020-01-03_001.log"), []byte(`{"timestamp":"2020-01-03T00:00:00Z","level":"info","msg":"x","trace_id":"t1"}`+"\n"), 0644)
+	if _, err := RebuildIndex(dir, "gc-service"); err != nil {
+		t.Fatalf("重建索引失败: %v", err)
+	}
+	db, err := bbolt.Open(filepath.Join(dir, "index", "gc-service.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("打开索引数据库失败: %v", err)
+	}
+	defer db.Close()
+	counts, err := countBucketKeys(db)
+	if err != nil || counts[filePostingsBucket] == 0 || counts[filePostingsBucket] != counts["trace_id"]+counts["level"]+counts["time"]+counts["trace_time"]+counts["service"]+counts["service_level"] {
+		t.Errorf("期望重建后反向桶记录所有索引键，得到 %v %v", counts, err)
+	}
+}
@@ -0,0 +1,152 @@
+package aggregate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// indexItem 索引队列中的条目，seq用于跟踪索引进度
+type indexItem struct {
+	entry LogEntry
+	seq   int64
+}
+
+// pendingIndex 已写入文件但尚未建立索引的条目位置
+type pendingIndex struct {
+	fileID    string
+	offset    int64
+	writtenAt time.Time
+	done      bool
+}
+
+// indexLag 跟踪已写入但尚未建立索引的条目
+// 条目按写入顺序登记，多个索引工作线程可能乱序完成，最早的未完成条目之前的都已建立索引
+type indexLag struct {
+	mu      sync.Mutex
+	pending []pendingIndex // 按写入顺序，第一个总是未完成的
+	headSeq int64          // pending[0]的序号
+	nextSeq int64
+	count   int // pending中未完成的条目数
+}
+
+// add 登记一条已写入文件的条目，返回其序号，调用方需持有batchMutex以保证登记顺序与写入顺序一致
+func (l *indexLag) add(fileID string, offset int64, writtenAt time.Time) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.pending) == 0 {
+		l.headSeq = l.nextSeq
+	}
+	seq := l.nextSeq
+	l.nextSeq++
+	l.pending = append(l.pending, pendingIndex{fileID: fileID, offset: offset, writtenAt: writtenAt})
+	l.count++
+	return seq
+}
+
+// done 标记条目已建立索引（或被跳过）
+func (l *indexLag) done(seq int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	i := seq - l.headSeq
+	if i < 0 || i >= int64(len(l.pending)) || l.pending[i].done {
+		return
+	}
+	l.pending[i].done = true
+	l.count--
+	for len(l.pending) > 0 && l.pending[0].done {
+		l.pending = l.pending[1:]
+		l.headSeq++
+	}
+}
+
+// next 返回下一条登记条目的序号，调用方需持有batchMutex
+func (l *indexLag) next() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.nextSeq
+}
+
+// indexedBefore 序号小于seq的条目是否都已建立索引（或被跳过）
+func (l *indexLag) indexedBefore(seq int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.pending) == 0 || l.headSeq >= seq
+}
+
+// lag 返回尚未建立索引的条目数，以及其中最早的条目已等待的时间
+func (l *indexLag) lag(now time.Time) (int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.pending) == 0 {
+		return 0, 0
+	}
+	return l.count, now.Sub(l.pending[0].writtenAt)
+}
+
+// unindexed 返回每个文件中第一条尚未建立索引的条目位置，按写入顺序
+func (l *indexLag) unindexed() []pendingIndex {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var tails []pendingIndex
+	seen := make(map[string]bool)
+	for _, p := range l.pending {
+		if p.done || seen[p.fileID] {
+			continue
+		}
+		seen[p.fileID] = true
+		tails = append(tails, p)
+	}
+	return tails
+}
+
+// appendUnindexed 扫描尚未建立索引的文件尾部，将匹配且不在entries中的条目追加到entries
+// 每个文件只从第一条未建立索引的条目读到文件末尾，使索引查询能读到刚写入的日志
+func appendUnindexed(ctx context.Context, entries []LogEntry, tails []pendingIndex, query LogQuery, logDir string, stats *queryStats) ([]LogEntry, error) {
+	stats.considered(len(tails))
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		seen[entry.FileID+":"+strconv.FormatInt(entry.Offset, 10)] = true
+	}
+
+	for _, tail := range tails {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		file, err := openLogFrom(filepath.Join(logDir, tail.fileID+".log"), tail.offset)
+		if err != nil {
+			continue // 文件可能已被清理，已压缩的文件从.gz中读取
+		}
+		stats.opened()
+
+		reader := bufio.NewReader(file)
+		offset := tail.offset
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				break // 未写完的行不读取
+			}
+			lineOffset := offset
+			offset += int64(len(line))
+			stats.scanned(1)
+
+			var entry LogEntry
+			if json.Unmarshal(bytes.TrimSpace(line), &entry) != nil {
+				continue
+			}
+			entry.FileID = tail.fileID
+			entry.Offset = lineOffset
+			if seen[entry.FileID+":"+strconv.FormatInt(entry.Offset, 10)] || !matchesQuery(entry, query) {
+				continue
+			}
+			entries = append(entries, entry)
+		}
+		file.Close()
+	}
+	return entries, nil
+}
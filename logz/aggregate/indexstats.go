@@ -0,0 +1,95 @@
+package aggregate
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// IndexStatsCacheTTL GetIndexStats缓存统计结果的时间，统计需要遍历级别和服务索引桶的所有键
+var IndexStatsCacheTTL = 10 * time.Second
+
+// IndexStats 按级别和服务索引的倒排列表长度统计的条目数，不读取数据文件
+// 只包括已建立索引的条目：尚在索引队列中的条目、已被保留策略清理的文件中的条目不计入，
+// 没有服务名的条目不计入EntriesByService
+type IndexStats struct {
+	EntriesByLevel   map[string]int `json:"entries_by_level"`
+	EntriesByService map[string]int `json:"entries_by_service"`
+	IndexSizeBytes   int64          `json:"index_size_bytes"` // 索引数据库文件的大小
+	ComputedAt       time.Time      `json:"computed_at"`
+}
+
+// indexStatsCache GetIndexStats的缓存
+type indexStatsCache struct {
+	mutex sync.Mutex
+	stats IndexStats
+}
+
+// GetIndexStats 统计聚合器索引中各级别和各服务的条目数，结果缓存IndexStatsCacheTTL
+// 用游标遍历level和service索引桶的键，按键中的值部分计数，不解码条目；aggregator为nil时返回ErrNoAggregator
+func GetIndexStats(aggregator *LogAggregator) (IndexStats, error) {
+	if aggregator == nil {
+		return IndexStats{}, ErrNoAggregator
+	}
+	cache := &aggregator.indexStats
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if !cache.stats.ComputedAt.IsZero() && time.Since(cache.stats.ComputedAt) < IndexStatsCacheTTL {
+		return cache.stats.clone(), nil
+	}
+
+	stats := IndexStats{EntriesByLevel: make(map[string]int), EntriesByService: make(map[string]int)}
+	err := aggregator.viewIndex(func(tx *bbolt.Tx) error {
+		stats.IndexSizeBytes = tx.Size()
+		if err := countTerms(tx, "level", stats.EntriesByLevel); err != nil {
+			return err
+		}
+		return countTerms(tx, "service", stats.EntriesByService)
+	})
+	if err != nil {
+		return IndexStats{}, err
+	}
+	stats.ComputedAt = time.Now()
+	cache.stats = stats
+	return stats.clone(), nil
+}
+
+// countTerms 遍历倒排索引桶，按值统计倒排列表的长度，跳过旧格式的键
+func countTerms(tx *bbolt.Tx, name string, counts map[string]int) error {
+	bucket := tx.Bucket([]byte(name))
+	if bucket == nil {
+		return fmt.Errorf("索引桶%s不存在", name)
+	}
+	cursor := bucket.Cursor()
+	var term []byte
+	n := 0
+	for k, _ := cursor.First(); k != nil; k, _ = cursor.Next() {
+		i := bytes.IndexByte(k, postingSeparator)
+		if i < 0 {
+			continue
+		}
+		// 同一个值的键连续存放，值变化时记录上一个值的计数
+		if !bytes.Equal(k[:i], term) {
+			if n > 0 {
+				counts[string(term)] += n
+			}
+			term, n = append(term[:0], k[:i]...), 0
+		}
+		n++
+	}
+	if n > 0 {
+		counts[string(term)] += n
+	}
+	return nil
+}
+
+// clone 返回可以由调用方修改的副本
+func (s IndexStats) clone() IndexStats {
+	s.EntriesByLevel = maps.Clone(s.EntriesByLevel)
+	s.EntriesByService = maps.Clone(s.EntriesByService)
+	return s
+}
@@ -0,0 +1,61 @@
+package aggregate
+
+import (
+	"errors"
+	"maps"
+	"testing"
+	"time"
+)
+
+func TestGetIndexStats(t *testing.T) {
+	if _, err := GetIndexStats(nil); !errors.Is(err, ErrNoAggregator) {
+		t.Errorf("期望没有聚合器时返回ErrNoAggregator，得到 %v", err)
+	}
+
+	aggregator, err := NewLogAggregatorWithOptions(t.TempDir(), "stats-service")
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+	write := func(service, level string, n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			entry := LogEntry{Timestamp: time.Now().Format(time.RFC3339), Level: level, Service: service, Message: "m"}
+			if _, err := aggregator.WriteLogSync(entry, true); err != nil {
+				t.Fatalf("写入失败: %v", err)
+			}
+		}
+	}
+	write("api", "info", 5)
+	write("api", "ERROR", 2)
+	write("worker", "warning", 3)
+	write("worker", "debug", 1)
+	write("", "info", 4)
+
+	stats, err := GetIndexStats(aggregator)
+	if err != nil {
+		t.Fatalf("统计索引失败: %v", err)
+	}
+	if want := map[string]int{"info": 9, "error": 2, "warn": 3, "debug": 1}; !maps.Equal(stats.EntriesByLevel, want) {
+		t.Errorf("期望按级别统计 %v，得到 %v", want, stats.EntriesByLevel)
+	}
+	if want := map[string]int{"api": 7, "worker": 4}; !maps.Equal(stats.EntriesByService, want) {
+		t.Errorf("期望按服务统计 %v，得到 %v", want, stats.EntriesByService)
+	}
+	if stats.IndexSizeBytes <= 0 || stats.ComputedAt.IsZero() {
+		t.Errorf("期望返回索引大小和统计时间，得到 %+v", stats)
+	}
+
+	// 缓存期间返回相同的结果，修改返回值不影响缓存
+	stats.EntriesByLevel["info"] = 100
+	write("api", "info", 1)
+	if cached, _ := GetIndexStats(aggregator); cached.EntriesByLevel["info"] != 9 || !cached.ComputedAt.Equal(stats.ComputedAt) {
+		t.Errorf("期望返回缓存的统计，得到 %+v", cached)
+	}
+
+	defer func(ttl time.Duration) { IndexStatsCacheTTL = ttl }(IndexStatsCacheTTL)
+	IndexStatsCacheTTL = 0
+	if fresh, _ := GetIndexStats(aggregator); fresh.EntriesByLevel["info"] != 10 || fresh.EntriesByService["api"] != 8 {
+		t.Errorf("期望缓存过期后重新统计，得到 %+v", fresh)
+	}
+}
@@ -0,0 +1,212 @@
+package aggregate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz"
+)
+
+// 已弃用的logz.InitWithAggregation和logz.Close通过注册的函数初始化和关闭聚合器
+func init() {
+	logz.RegisterAggregation(InitWithAggregation, CloseAggregator)
+}
+
+// InitWithAggregation 初始化带聚合功能的日志系统
+// serviceName为空时依次使用OTEL_SERVICE_NAME环境变量和当前程序的文件名
+func InitWithAggregation(logFile, aggregateDir, serviceName string, rotationSize int64, maxBackups int) error {
+	var opts []AggregatorOption
+	if rotationSize > 0 {
+		opts = append(opts, WithRotationSize(rotationSize))
+	}
+	if maxBackups > 0 {
+		opts = append(opts, WithMaxBackups(maxBackups))
+	}
+	return InitWithAggregationOptions(logFile, aggregateDir, serviceName, opts...)
+}
+
+// InitWithAggregationOptions 使用聚合器配置选项初始化带聚合功能的日志系统，serviceName为空时自动检测
+// 可以重复调用，之前初始化的聚合器被关闭，聚合Hook被替换
+func InitWithAggregationOptions(logFile, aggregateDir, serviceName string, opts ...AggregatorOption) error {
+	if serviceName == "" {
+		serviceName = detectServiceName()
+	}
+
+	// 初始化基本配置
+	logz.SetLevel(logz.LevelInfo)
+	logz.SetFormat(logz.FormatJSON)
+	logz.EnableCaller()
+
+	// 设置文件输出
+	if logFile != "" {
+		if err := logz.SetFileOutput(logFile); err != nil {
+			return err
+		}
+	}
+
+	// 重复初始化时先关闭之前的聚合Hook和聚合器，同一目录的索引数据库才能再次打开，条目也不会重复写入
+	logger := logz.GetDefaultLogger()
+	if previous, ok := logger.NamedHook(logz.HookNameAggregator).(*AggregatorHook); ok {
+		logger.RemoveHook(logz.HookNameAggregator)
+		if GlobalAggregator() == previous.aggregator {
+			SetGlobalAggregator(nil)
+		}
+		if err := previous.aggregator.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "[关闭聚合器错误] %v\n", err)
+		}
+	}
+
+	// 创建聚合器
+	aggregator, err := NewLogAggregatorWithOptions(aggregateDir, serviceName, opts...)
+	if err != nil {
+		return err
+	}
+
+	// 设置全局聚合器
+	SetGlobalAggregator(aggregator)
+
+	// 添加聚合Hook，排在脱敏等修改条目的Hook之后
+	logger.AddNamedHook(logz.HookNameAggregator, NewAggregatorHook(aggregator, serviceName), logz.HookPriorityAggregator)
+
+	return nil
+}
+
+// detectServiceName 返回OTEL_SERVICE_NAME环境变量，未设置时返回当前程序的文件名（去掉.exe后缀）
+func detectServiceName() string {
+	if name := strings.TrimSpace(os.Getenv("OTEL_SERVICE_NAME")); name != "" {
+		return name
+	}
+	if len(os.Args) > 0 {
+		if name := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe"); name != "" && name != "." && name != string(filepath.Separator) {
+			return name
+		}
+	}
+	return "app"
+}
+
+// QueryLogsByTraceID 根据TraceID查询日志，结果按时间升序排列
+func QueryLogsByTraceID(traceID, logDir string, limit, offset int) (*LogQueryResult, error) {
+	return QueryLogsByTraceIDInRange(traceID, time.Time{}, time.Time{}, logDir, limit, offset)
+}
+
+// QueryLogsByTraceIDInRange 根据TraceID查询start到end之间（含）的日志，结果按时间升序排列
+// start或end为零值时不限制该端
+func QueryLogsByTraceIDInRange(traceID string, start, end time.Time, logDir string, limit, offset int) (*LogQueryResult, error) {
+	query := TraceQuery(traceID, start, end)
+	query.Limit = limit
+	query.Offset = offset
+	return QueryLogs(query, logDir)
+}
+
+// TraceQuery 返回查询一个trace在start到end之间（含）的日志的查询条件，结果按时间升序排列
+// 同时指定TraceID和时间范围时使用trace_time组合索引，旧版本的索引数据库使用trace_id索引后按时间过滤
+func TraceQuery(traceID string, start, end time.Time) LogQuery {
+	return LogQuery{
+		TraceID:   traceID,
+		StartTime: start,
+		EndTime:   end,
+		UseIndex:  true, // 启用索引
+		SortOrder: SortAsc,
+	}
+}
+
+// QueryLogsBySpanID 根据SpanID查询日志
+func QueryLogsBySpanID(spanID, logDir string, limit, offset int) (*LogQueryResult, error) {
+	query := LogQuery{
+		SpanID:   spanID,
+		Limit:    limit,
+		Offset:   offset,
+		UseIndex: true, // 启用索引
+	}
+	return QueryLogs(query, logDir)
+}
+
+// QueryLogsByTimeRange 根据时间范围查询日志
+func QueryLogsByTimeRange(startTime, endTime time.Time, logDir string, limit, offset int) (*LogQueryResult, error) {
+	query := LogQuery{
+		StartTime: startTime,
+		EndTime:   endTime,
+		Limit:     limit,
+		Offset:    offset,
+		UseIndex:  false, // 时间范围查询不使用索引
+	}
+	return QueryLogs(query, logDir)
+}
+
+// QueryLogsByLevel 根据日志级别查询
+func QueryLogsByLevel(level, logDir string, limit, offset int) (*LogQueryResult, error) {
+	query := LogQuery{
+		Level:    level,
+		Limit:    limit,
+		Offset:   offset,
+		UseIndex: true, // 启用索引
+	}
+	return QueryLogs(query, logDir)
+}
+
+// QueryLogsByService 根据服务名查询日志
+func QueryLogsByService(service, logDir string, limit, offset int) (*LogQueryResult, error) {
+	query := LogQuery{
+		Service:  service,
+		Limit:    limit,
+		Offset:   offset,
+		UseIndex: true, // 启用索引
+	}
+	return QueryLogs(query, logDir)
+}
+
+// QueryLogsByMessage 根据消息内容查询日志（支持正则表达式）
+func QueryLogsByMessage(message, logDir string, limit, offset int) (*LogQueryResult, error) {
+	query := LogQuery{
+		Message:  message,
+		Limit:    limit,
+		Offset:   offset,
+		UseIndex: false, // 消息内容查询不使用索引
+	}
+	return QueryLogs(query, logDir)
+}
+
+// QueryLogsWithIndex 使用索引的复杂查询，索引无法处理查询时返回ErrIndexUnavailable，不回退到文件扫描
+func QueryLogsWithIndex(query LogQuery, logDir string) (*LogQueryResult, error) {
+	query.UseIndex = true
+	query.RequireIndex = true
+	return QueryLogs(query, logDir)
+}
+
+// QueryLogsWithoutIndex 不使用索引的查询（强制文件扫描）
+func QueryLogsWithoutIndex(query LogQuery, logDir string) (*LogQueryResult, error) {
+	query.UseIndex = false
+	return QueryLogs(query, logDir)
+}
+
+// CleanupOldLogsDefault 清理一周前的日志文件
+func CleanupOldLogsDefault(logDir string) error {
+	report, err := CleanupOldLogs(logDir, 7)
+	if err != nil {
+		return err
+	}
+
+	logz.Infof("清理旧日志完成: 删除%d个文件, 释放%d字节, 清理%d条索引",
+		report.FilesDeleted, report.BytesFreed, report.IndexPostingsRemoved)
+	for _, cleanupErr := range report.Errors {
+		logz.Warnf("清理旧日志出错: %v", cleanupErr)
+	}
+	return nil
+}
+
+// GetLogStatsDefault 获取日志统计信息
+func GetLogStatsDefault(logDir string) (map[string]any, error) {
+	return GetLogStats(logDir)
+}
+
+// CloseAggregator 关闭全局聚合器
+func CloseAggregator() error {
+	aggregator := GlobalAggregator()
+	if aggregator != nil {
+		return aggregator.Close()
+	}
+	return nil
+}
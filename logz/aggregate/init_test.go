@@ -0,0 +1,87 @@
+package aggregate
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/HsiaoL1/trace/logz"
+)
+
+func TestInitWithAggregationIdempotent(t *testing.T) {
+	prevLogger := logz.GetDefaultLogger()
+	logz.SetDefaultLogger(logz.NewDefaultLogger(&logz.LoggerConfig{Level: logz.LevelInfo, Format: logz.FormatJSON, Output: io.Discard}))
+	prevAggregator := GlobalAggregator()
+	defer func() {
+		logz.SetDefaultLogger(prevLogger)
+		SetGlobalAggregator(prevAggregator)
+	}()
+
+	dir := t.TempDir()
+	if err := InitWithAggregation("", dir, "svc", 0, 0); err != nil {
+		t.Fatalf("初始化失败: %v", err)
+	}
+	first := GetGlobalAggregator()
+	logz.EnableBaggageFields("tenant_id")
+	logz.EnableBaggageFields("tenant_id")
+	// 再次初始化同一目录时关闭之前的聚合器并替换聚合Hook
+	if err := InitWithAggregation("", dir, "svc", 0, 0); err != nil {
+		t.Fatalf("再次初始化失败: %v", err)
+	}
+	aggregator := GetGlobalAggregator()
+	defer aggregator.Close()
+	if aggregator == first {
+		t.Fatal("期望再次初始化创建新的聚合器")
+	}
+	if err := first.WriteLog(LogEntry{Message: "closed"}); err == nil {
+		t.Error("期望之前的聚合器已关闭")
+	}
+
+	var names []string
+	for _, info := range logz.Hooks() {
+		names = append(names, info.Name)
+	}
+	if want := []string{logz.HookNameBaggage, logz.HookNameAggregator}; !reflect.DeepEqual(names, want) {
+		t.Errorf("期望每个内置Hook只注册一次 %v，得到 %v", want, names)
+	}
+
+	logz.Info("once")
+	result, err := aggregator.Query(context.Background(), LogQuery{Message: "once", Limit: 10})
+	if err != nil || result.Total != 1 {
+		t.Errorf("期望聚合文件中只有 1 条日志，得到 %+v %v", result, err)
+	}
+}
+
+func TestDeprecatedInitWithAggregation(t *testing.T) {
+	prevLogger := logz.GetDefaultLogger()
+	logz.SetDefaultLogger(logz.NewDefaultLogger(&logz.LoggerConfig{Level: logz.LevelInfo, Format: logz.FormatJSON, Output: io.Discard}))
+	prevAggregator := GlobalAggregator()
+	defer func() {
+		logz.SetDefaultLogger(prevLogger)
+		SetGlobalAggregator(prevAggregator)
+	}()
+
+	// 导入本包后logz.InitWithAggregation转发到本包
+	dir := t.TempDir()
+	if err := logz.InitWithAggregation("", dir, "svc", 0, 0); err != nil {
+		t.Fatalf("初始化失败: %v", err)
+	}
+	aggregator := GetGlobalAggregator()
+	if aggregator == nil || logz.GetDefaultLogger().NamedHook(logz.HookNameAggregator) == nil {
+		t.Fatal("期望创建全局聚合器并注册聚合Hook")
+	}
+	logz.Info("forwarded")
+	result, err := aggregator.Query(context.Background(), LogQuery{Message: "forwarded", Limit: 10})
+	if err != nil || result.Total != 1 {
+		t.Errorf("期望聚合文件中有 1 条日志，得到 %+v %v", result, err)
+	}
+
+	// logz.Close同时关闭全局聚合器
+	if err := logz.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+	if err := aggregator.WriteLog(LogEntry{Message: "closed"}); err == nil {
+		t.Error("期望logz.Close关闭全局聚合器")
+	}
+}
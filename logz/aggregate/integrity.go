@@ -0,0 +1,162 @@
+package aggregate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// verifyPatterns 完整性检查默认查找的文件，包括压缩后的日志
+var verifyPatterns = []string{"*.log", "*.log.gz"}
+
+// maxLineIssues 每个文件最多逐行报告的无法解析的行数，超出部分合并为一条
+const maxLineIssues = 20
+
+// IntegrityIssue 日志文件完整性问题
+type IntegrityIssue struct {
+	File    string `json:"file"`           // 相对日志目录的路径
+	Line    int    `json:"line,omitempty"` // 问题所在行号，文件级问题为0
+	Problem string `json:"problem"`
+}
+
+// FileChecksum 计算文件的SHA-256校验和（十六进制），ctx取消时停止读取
+func FileChecksum(ctx context.Context, path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, ctxReader{ctx: ctx, r: file}); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ctxReader 每次读取前检查ctx，使长时间的读取可以取消
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read 实现io.Reader接口
+func (c ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// VerifyLogDir 检查日志目录中的日志文件：gzip文件能完整解压，每个非空行都是有效的JSON日志
+func VerifyLogDir(logDir string) ([]IntegrityIssue, error) {
+	return VerifyLogDirContext(context.Background(), logDir, DiscoverOptions{})
+}
+
+// VerifyLogDirContext 检查日志目录中的日志文件，未指定匹配模式时检查*.log和*.log.gz
+// 文件本身的问题作为IntegrityIssue返回，只有查找文件失败或ctx取消时返回错误
+func VerifyLogDirContext(ctx context.Context, logDir string, opts DiscoverOptions) ([]IntegrityIssue, error) {
+	if len(opts.Patterns) == 0 {
+		opts.Patterns = verifyPatterns
+	}
+	files, err := DiscoverLogFiles(logDir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []IntegrityIssue
+	for _, path := range files {
+		fileIssues, err := VerifyLogFile(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		for i := range fileIssues {
+			fileIssues[i].File = RelativeLogPath(logDir, path)
+		}
+		issues = append(issues, fileIssues...)
+	}
+	return issues, nil
+}
+
+// VerifyLogFile 检查单个日志文件，返回的问题中File为path
+// 只有ctx取消时返回错误，文件无法打开或读取作为问题返回
+func VerifyLogFile(ctx context.Context, path string) ([]IntegrityIssue, error) {
+	issue := func(line int, format string, args ...interface{}) IntegrityIssue {
+		return IntegrityIssue{File: path, Line: line, Problem: fmt.Sprintf(format, args...)}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return []IntegrityIssue{issue(0, "打开文件失败: %v", err)}, nil
+	}
+	defer file.Close()
+
+	var reader io.Reader = ctxReader{ctx: ctx, r: file}
+	if strings.HasSuffix(path, ".gz") {
+		gzReader, err := gzip.NewReader(reader)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return nil, ctxErr
+			}
+			return []IntegrityIssue{issue(0, "无效的gzip文件: %v", err)}, nil
+		}
+		defer gzReader.Close()
+		reader = gzReader
+	}
+
+	var issues []IntegrityIssue
+	malformed := 0
+	scanner := NewLineReader(reader)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		if scanner.TooLong() {
+			malformed++
+			if malformed <= maxLineIssues {
+				issues = append(issues, issue(lineNum, "日志行超过 %d 字节", MaxLineSize()))
+			}
+			continue
+		}
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var entry LogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			malformed++
+			if malformed <= maxLineIssues {
+				issues = append(issues, issue(lineNum, "无法解析的日志行: %v", err))
+			}
+		}
+	}
+
+	var readIssue *IntegrityIssue
+	if err := scanner.Err(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		problem := issue(lineNum, "读取文件失败: %v", err)
+		if err == io.ErrUnexpectedEOF {
+			problem = issue(lineNum, "文件被截断")
+			// 截断处的不完整行不单独报告
+			if n := len(issues); n > 0 && malformed <= maxLineIssues && issues[n-1].Line == lineNum {
+				issues = issues[:n-1]
+			}
+		}
+		readIssue = &problem
+	}
+	if malformed > maxLineIssues {
+		issues = append(issues, issue(0, "另有 %d 行无法解析", malformed-maxLineIssues))
+	}
+	if readIssue != nil {
+		issues = append(issues, *readIssue)
+	}
+	return issues, nil
+}
@@ -0,0 +1,118 @@
+package aggregate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeGzipLog 写入gzip压缩的日志文件，返回压缩后的内容
+func writeGzipLog(t *testing.T, path string, lines int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(gz, `{"timestamp":"2024-01-15T10:00:00Z","level":"info","message":"request %d"}`+"\n", i)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("压缩失败: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestFileChecksum(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(path, []byte("hello\n"), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+
+	first, err := FileChecksum(context.Background(), path)
+	if err != nil {
+		t.Fatalf("计算校验和失败: %v", err)
+	}
+	// sha256("hello\n")
+	if first != "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03" {
+		t.Errorf("校验和错误: %s", first)
+	}
+	second, _ := FileChecksum(context.Background(), path)
+	if first != second {
+		t.Errorf("期望校验和稳定，得到 %s 和 %s", first, second)
+	}
+
+	// 复制到其他位置后校验和不变
+	copyPath := filepath.Join(dir, "copy.log")
+	data, _ := os.ReadFile(path)
+	os.WriteFile(copyPath, data, 0644)
+	if copied, _ := FileChecksum(context.Background(), copyPath); copied != first {
+		t.Errorf("期望复制后校验和不变，得到 %s", copied)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := FileChecksum(ctx, path); !errors.Is(err, context.Canceled) {
+		t.Errorf("期望 context.Canceled，得到 %v", err)
+	}
+}
+
+func TestVerifyLogDir(t *testing.T) {
+	dir := t.TempDir()
+	writeGzipLog(t, filepath.Join(dir, "good.log.gz"), 100)
+	data := writeGzipLog(t, filepath.Join(dir, "truncated.log.gz"), 100)
+	if err := os.WriteFile(filepath.Join(dir, "truncated.log.gz"), data[:len(data)/2], 0644); err != nil {
+		t.Fatalf("截断文件失败: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "notgzip.log.gz"), []byte("plain text"), 0644)
+	os.WriteFile(filepath.Join(dir, "app.log"), []byte(`{"level":"info","message":"ok"}`+"\n\n"+`{"level":`+"\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "other.txt"), []byte("not a log"), 0644)
+
+	issues, err := VerifyLogDir(dir)
+	if err != nil {
+		t.Fatalf("检查失败: %v", err)
+	}
+
+	byFile := make(map[string][]IntegrityIssue)
+	for _, issue := range issues {
+		byFile[issue.File] = append(byFile[issue.File], issue)
+	}
+	if len(byFile["good.log.gz"]) != 0 {
+		t.Errorf("期望完整的gzip文件没有问题，得到 %v", byFile["good.log.gz"])
+	}
+	if got := byFile["truncated.log.gz"]; len(got) != 1 || got[0].Problem != "文件被截断" {
+		t.Errorf("期望检测到截断的gzip文件，得到 %v", got)
+	}
+	if got := byFile["notgzip.log.gz"]; len(got) != 1 || !strings.Contains(got[0].Problem, "gzip") {
+		t.Errorf("期望检测到无效的gzip文件，得到 %v", got)
+	}
+	if got := byFile["app.log"]; len(got) != 1 || got[0].Line != 3 {
+		t.Errorf("期望第3行无法解析，得到 %v", got)
+	}
+	if len(byFile["other.txt"]) != 0 {
+		t.Errorf("期望不检查非日志文件，得到 %v", byFile["other.txt"])
+	}
+}
+
+func TestVerifyLogFileLimitsLineIssues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.log")
+	os.WriteFile(path, bytes.Repeat([]byte("not json\n"), maxLineIssues+5), 0644)
+
+	issues, err := VerifyLogFile(context.Background(), path)
+	if err != nil {
+		t.Fatalf("检查失败: %v", err)
+	}
+	if len(issues) != maxLineIssues+1 {
+		t.Fatalf("期望 %d 个问题，得到 %d", maxLineIssues+1, len(issues))
+	}
+	if last := issues[len(issues)-1]; last.Line != 0 || !strings.Contains(last.Problem, "另有 5 行") {
+		t.Errorf("期望汇总剩余的行，得到 %v", last)
+	}
+}
@@ -0,0 +1,61 @@
+package aggregate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/HsiaoL1/trace/logz"
+	"go.etcd.io/bbolt"
+)
+
+// canonicalLevel 规范化日志级别，无法识别时返回去除空白的小写形式
+// 用于写入和查询路径，保证同一级别的不同写法得到相同的值
+func canonicalLevel(level string) string {
+	switch level {
+	case "trace", "debug", "info", "warn", "error", "fatal", "panic":
+		return level
+	}
+	if normalized, err := logz.NormalizeLevel(level); err == nil {
+		return normalized
+	}
+	return strings.ToLower(strings.TrimSpace(level))
+}
+
+// migrateLevelIndex 将级别索引中以别名（如"warning"、"ERROR"）写入的倒排条目合并到规范化的级别
+func migrateLevelIndex(tx *bbolt.Tx) error {
+	bucket := tx.Bucket([]byte("level"))
+	if bucket == nil {
+		return nil
+	}
+
+	type aliasKey struct {
+		key       []byte
+		canonical []byte
+		value     []byte
+	}
+	var aliases []aliasKey
+	err := bucket.ForEach(func(k, v []byte) error {
+		level, posting, ok := splitPostingKey(k)
+		if ok && canonicalLevel(level) != level {
+			aliases = append(aliases, aliasKey{
+				key:       append([]byte(nil), k...),
+				canonical: postingKey(canonicalLevel(level), posting),
+				value:     append([]byte(nil), v...),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, alias := range aliases {
+		if err := bucket.Put(alias.canonical, alias.value); err != nil {
+			return fmt.Errorf("迁移级别索引%s失败: %w", alias.key, err)
+		}
+		if err := bucket.Delete(alias.key); err != nil {
+			return fmt.Errorf("删除级别索引%s失败: %w", alias.key, err)
+		}
+	}
+	return nil
+}
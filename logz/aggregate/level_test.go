@@ -0,0 +1,142 @@
+package aggregate
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// indexLevelAliasTests 每个级别写法及其规范化结果，与logz中NormalizeLevel的测试相同
+var indexLevelAliasTests = []struct {
+	input string
+	want  string
+}{
+	{"trace", "trace"},
+	{"TRACE", "trace"},
+	{"debug", "debug"},
+	{"Debug", "debug"},
+	{"dbg", "debug"},
+	{"info", "info"},
+	{" INFO ", "info"},
+	{"information", "info"},
+	{"warn", "warn"},
+	{"WARN", "warn"},
+	{"warning", "warn"},
+	{"Warning", "warn"},
+	{"error", "error"},
+	{"ERROR", "error"},
+	{"err", "error"},
+	{"fatal", "fatal"},
+	{"Fatal", "fatal"},
+	{"panic", "panic"},
+	{"PANIC", "panic"},
+}
+
+func TestQueryLevelAliases(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "level-service", WithBatchSize(1))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+
+	// 每个规范级别以不同写法写入一条日志
+	written := map[string]string{
+		"trace": "TRACE", "debug": "dbg", "info": "Information", "warn": "WARNING",
+		"error": "err", "fatal": "Fatal", "panic": "panic",
+	}
+	for _, input := range written {
+		if err := aggregator.WriteLog(LogEntry{Level: input, Message: "level " + input}); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+	}
+
+	// 索引由后台线程异步写入
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		info, err := aggregator.Describe()
+		if err != nil {
+			t.Fatalf("获取聚合器信息失败: %v", err)
+		}
+		if info.IndexBuckets["level"] == len(written) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, tt := range indexLevelAliasTests {
+		t.Run(tt.input, func(t *testing.T) {
+			query := LogQuery{Level: tt.input, Limit: 100}
+
+			entries, err := queryWithIndex(context.Background(), query, dir, aggregator, nil)
+			if err != nil {
+				t.Fatalf("索引查询失败: %v", err)
+			}
+			if len(entries) != 1 || entries[0].Level != tt.want {
+				t.Errorf("索引查询期望1条%s日志，得到 %+v", tt.want, entries)
+			}
+
+			result, err := QueryLogsWithoutIndex(query, dir)
+			if err != nil {
+				t.Fatalf("扫描查询失败: %v", err)
+			}
+			if result.Total != 1 || result.Entries[0].Level != tt.want {
+				t.Errorf("扫描查询期望1条%s日志，得到 %+v", tt.want, result.Entries)
+			}
+		})
+	}
+}
+
+func TestMigrateLevelIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.db")
+	db, err := bbolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	defer db.Close()
+
+	// 旧版本每个级别只保存一个位置，且可能以别名写入
+	err = db.Update(func(tx *bbolt.Tx) error {
+		bucket, err := tx.CreateBucket([]byte("level"))
+		if err != nil {
+			return err
+		}
+		seed := map[string]string{"warning": "a:1", "ERROR": "a:2", "error": "a:3", "Info": "a:4"}
+		for k, v := range seed {
+			if err := bucket.Put([]byte(k), []byte(v)); err != nil {
+				return err
+			}
+		}
+		return migrateIndex(tx)
+	})
+	if err != nil {
+		t.Fatalf("迁移级别索引失败: %v", err)
+	}
+
+	got := make(map[string]string)
+	db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket([]byte("level")).ForEach(func(k, v []byte) error {
+			got[string(k)] = string(v)
+			return nil
+		})
+	})
+
+	// 别名合并到规范级别的倒排列表
+	want := map[string]string{
+		"warn\x00a:1":  "a:1",
+		"error\x00a:2": "a:2",
+		"error\x00a:3": "a:3",
+		"info\x00a:4":  "a:4",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("期望 %q，得到 %q", want, got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("键%q期望 %q，得到 %q", k, v, got[k])
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package aggregate
+
+import (
+	"fmt"
+	"sort"
+)
+
+// minIngestLimitBytes 消息和字段值限制的最小字节数，截断后至少保留开头的一部分内容
+const minIngestLimitBytes = 64
+
+// IngestLimits 写入时对单条日志的限制，为0的限制不生效
+// 用于避免单条异常的日志（如把整个响应body写进消息或字段）拖慢批量写入和Web界面
+type IngestLimits struct {
+	// MaxMessageBytes 消息超过时按UTF-8字符截断（包括truncatedSuffix不超过该长度），条目带有"truncated":true
+	MaxMessageBytes int `json:"max_message_bytes,omitempty"`
+	// MaxFieldValueBytes 字段值超过时截断：字符串直接截断，其他类型截断JSON编码后的内容
+	MaxFieldValueBytes int `json:"max_field_value_bytes,omitempty"`
+	// MaxFieldsCount 字段数超过时按键排序保留前面的字段，去掉的字段数记录在fields_dropped中
+	MaxFieldsCount int `json:"max_fields_count,omitempty"`
+	// MaxEntryBytes 截断后序列化的条目（不包括写入时分配的文件ID、偏移量和序号）仍然超过时拒绝写入，返回*EntryTooLargeError
+	MaxEntryBytes int `json:"max_entry_bytes,omitempty"`
+}
+
+// EntryTooLargeError 条目超过IngestLimits.MaxEntryBytes被拒绝，errors.Is(err, ErrEntryTooLarge)为true
+type EntryTooLargeError struct {
+	Size  int // 截断后序列化的字节数
+	Limit int
+}
+
+// Error 实现error接口
+func (e *EntryTooLargeError) Error() string {
+	return fmt.Sprintf("%s: %d字节（限制%d字节）", ErrEntryTooLarge, e.Size, e.Limit)
+}
+
+// Unwrap 返回ErrEntryTooLarge
+func (e *EntryTooLargeError) Unwrap() error {
+	return ErrEntryTooLarge
+}
+
+// WithIngestLimits 设置WriteLog对单条日志的限制，默认不限制
+// 与WithMaxEntrySize不同，这些限制在写入缓冲区之前生效，超过MaxEntryBytes的条目直接返回错误
+func WithIngestLimits(limits IngestLimits) AggregatorOption {
+	return func(o *aggregatorOptions) error {
+		if err := limits.Validate(); err != nil {
+			return err
+		}
+		o.ingestLimits = limits
+		return nil
+	}
+}
+
+// Validate 检查限制不为负数，消息和字段值的限制为0或不小于64字节，条目的限制为0或在1024到MaxLineSize之间
+func (l IngestLimits) Validate() error {
+	for _, limit := range []struct {
+		name  string
+		value int
+		min   int
+	}{
+		{"消息", l.MaxMessageBytes, minIngestLimitBytes},
+		{"字段值", l.MaxFieldValueBytes, minIngestLimitBytes},
+		{"字段数", l.MaxFieldsCount, 1},
+		{"条目", l.MaxEntryBytes, minEntrySize},
+	} {
+		if limit.value != 0 && limit.value < limit.min {
+			return fmt.Errorf("%s限制必须为0或不小于%d: %d", limit.name, limit.min, limit.value)
+		}
+	}
+	if l.MaxEntryBytes > MaxLineSize() {
+		return fmt.Errorf("条目限制不能超过%d: %d", MaxLineSize(), l.MaxEntryBytes)
+	}
+	return nil
+}
+
+// Enabled 是否设置了任何限制
+func (l IngestLimits) Enabled() bool {
+	return l != IngestLimits{}
+}
+
+// Apply 按限制截断条目的消息和字段值、去掉多余的字段，截断时设置Truncated，去掉的字段数累加到FieldsDropped
+// 调用方的Fields不会被修改；截断后仍然超过MaxEntryBytes时返回*EntryTooLargeError
+func (l IngestLimits) Apply(entry *LogEntry) error {
+	if l.MaxMessageBytes > 0 && len(entry.Message) > l.MaxMessageBytes {
+		entry.Message = truncateToLimit(entry.Message, l.MaxMessageBytes)
+		entry.Truncated = true
+	}
+	if err := l.limitFields(entry); err != nil {
+		return err
+	}
+	if l.MaxEntryBytes == 0 {
+		return nil
+	}
+
+	enc := getEntryEncoder()
+	defer putEntryEncoder(enc)
+	if err := enc.appendEntry(entry); err != nil {
+		return fmt.Errorf("序列化日志条目失败: %w", err)
+	}
+	if len(enc.buf) > l.MaxEntryBytes {
+		return &EntryTooLargeError{Size: len(enc.buf), Limit: l.MaxEntryBytes}
+	}
+	return nil
+}
+
+// limitFields 去掉超过MaxFieldsCount的字段并截断超过MaxFieldValueBytes的字段值，需要修改时复制Fields
+func (l IngestLimits) limitFields(entry *LogEntry) error {
+	fields := entry.Fields
+	if len(fields) == 0 || (l.MaxFieldValueBytes == 0 && (l.MaxFieldsCount == 0 || len(fields) <= l.MaxFieldsCount)) {
+		return nil
+	}
+	copied := false
+	clone := func() {
+		if !copied {
+			fields = make(map[string]any, len(entry.Fields))
+			for key, value := range entry.Fields {
+				fields[key] = value
+			}
+			copied = true
+		}
+	}
+
+	if l.MaxFieldsCount > 0 && len(fields) > l.MaxFieldsCount {
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		clone()
+		for _, key := range keys[l.MaxFieldsCount:] {
+			delete(fields, key)
+		}
+		entry.FieldsDropped += len(keys) - l.MaxFieldsCount
+	}
+
+	if l.MaxFieldValueBytes > 0 {
+		for key, value := range fields {
+			truncated, ok, err := truncateFieldValue(value, l.MaxFieldValueBytes)
+			if err != nil {
+				return fmt.Errorf("字段%s: %w", key, err)
+			}
+			if ok {
+				clone()
+				fields[key] = truncated
+				entry.Truncated = true
+			}
+		}
+	}
+	entry.Fields = fields
+	return nil
+}
+
+// truncateFieldValue 返回截断后的字段值，不超过limit字节时ok为false
+// 数值和布尔值不截断，其他非字符串的值按JSON编码后截断为字符串
+func truncateFieldValue(value any, limit int) (any, bool, error) {
+	switch v := value.(type) {
+	case string:
+		if len(v) <= limit {
+			return nil, false, nil
+		}
+		return truncateToLimit(v, limit), true, nil
+	case nil, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return nil, false, nil
+	}
+	encoded, err := appendJSONValue(nil, value)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(encoded) <= limit {
+		return nil, false, nil
+	}
+	return truncateToLimit(string(encoded), limit), true, nil
+}
+
+// truncateToLimit 将s按UTF-8字符截断，加上truncatedSuffix后不超过limit字节
+func truncateToLimit(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return truncateString(s, limit-len(truncatedSuffix))
+}
@@ -0,0 +1,96 @@
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestIngestLimitsUTF8Boundary(t *testing.T) {
+	limits := IngestLimits{MaxMessageBytes: 64, MaxFieldValueBytes: 64}
+	// 每个汉字3字节，截断位置（64-len(truncatedSuffix)=50字节）落在字符中间
+	message := strings.Repeat("日志", 30)
+	fields := map[string]any{"body": "x" + strings.Repeat("é", 100), "list": []any{strings.Repeat("数", 40)}, "n": 12345}
+	entry := LogEntry{Message: message, Fields: fields}
+	if err := limits.Apply(&entry); err != nil {
+		t.Fatalf("应用限制失败: %v", err)
+	}
+
+	if !entry.Truncated || len(entry.Message) > 64 || !utf8.ValidString(entry.Message) || !strings.HasSuffix(entry.Message, truncatedSuffix) {
+		t.Errorf("期望消息按字符截断到64字节以内，得到 %d 字节 %q", len(entry.Message), entry.Message)
+	}
+	if !strings.HasPrefix(message, strings.TrimSuffix(entry.Message, truncatedSuffix)) {
+		t.Errorf("期望保留消息开头，得到 %q", entry.Message)
+	}
+	for _, key := range []string{"body", "list"} {
+		value, ok := entry.Fields[key].(string)
+		if !ok || len(value) > 64 || !utf8.ValidString(value) || !strings.HasSuffix(value, truncatedSuffix) {
+			t.Errorf("期望字段%s按字符截断为字符串，得到 %#v", key, entry.Fields[key])
+		}
+	}
+	if entry.Fields["n"] != 12345 {
+		t.Errorf("期望数值字段不变，得到 %v", entry.Fields["n"])
+	}
+	if fields["body"] == entry.Fields["body"] {
+		t.Error("期望不修改调用方的Fields")
+	}
+
+	// 恰好等于限制的内容不截断
+	exact := LogEntry{Message: strings.Repeat("日", 21) + "a", Fields: map[string]any{"v": strings.Repeat("a", 64)}}
+	if err := limits.Apply(&exact); err != nil || exact.Truncated || len(exact.Message) != 64 {
+		t.Errorf("期望不截断等于限制的内容，得到 %+v %v", exact, err)
+	}
+}
+
+func TestIngestLimitsManyFields(t *testing.T) {
+	aggregator, err := NewLogAggregatorWithOptions(t.TempDir(), "limits",
+		WithIngestLimits(IngestLimits{MaxFieldsCount: 100, MaxEntryBytes: 64 << 10}))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+
+	fields := make(map[string]any, 10000)
+	for i := 0; i < 10000; i++ {
+		fields[fmt.Sprintf("field_%05d", i)] = i
+	}
+	if err := aggregator.WriteLog(LogEntry{Level: "info", Message: "many fields", TraceID: "t1", Fields: fields}); err != nil {
+		t.Fatalf("写入日志失败: %v", err)
+	}
+	if len(fields) != 10000 {
+		t.Errorf("期望不修改调用方的Fields，剩余 %d 个", len(fields))
+	}
+	if err := aggregator.Flush(); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+
+	result, err := aggregator.Query(t.Context(), LogQuery{TraceID: "t1", Limit: 1})
+	if err != nil || len(result.Entries) != 1 {
+		t.Fatalf("查询失败: %v", err)
+	}
+	entry := result.Entries[0]
+	if len(entry.Fields) != 100 || entry.FieldsDropped != 9900 || entry.Truncated {
+		t.Errorf("期望保留100个字段并记录去掉9900个，得到 %d 个字段、fields_dropped=%d", len(entry.Fields), entry.FieldsDropped)
+	}
+	if _, ok := entry.Fields["field_00099"]; !ok {
+		t.Error("期望按键排序保留前面的字段")
+	}
+
+	// 去掉字段后仍然超过条目限制时拒绝写入
+	err = aggregator.WriteLog(LogEntry{Level: "info", Message: strings.Repeat("x", 70<<10)})
+	var tooLarge *EntryTooLargeError
+	if !errors.As(err, &tooLarge) || !errors.Is(err, ErrEntryTooLarge) || ErrorCode(err) != CodeEntryTooLarge || tooLarge.Limit != 64<<10 {
+		t.Errorf("期望返回EntryTooLargeError，得到 %v", err)
+	}
+	if _, err := aggregator.WriteLogSync(LogEntry{Level: "info", Message: strings.Repeat("x", 70<<10)}, false); !errors.Is(err, ErrEntryTooLarge) {
+		t.Errorf("期望同步写入同样拒绝，得到 %v", err)
+	}
+
+	for _, limits := range []IngestLimits{{MaxMessageBytes: -1}, {MaxFieldValueBytes: 10}, {MaxEntryBytes: 100}, {MaxEntryBytes: MaxLineSize() + 1}} {
+		if _, err := NewMemoryAggregator("limits", WithIngestLimits(limits)); err == nil {
+			t.Errorf("期望拒绝无效的限制 %+v", limits)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package aggregate
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"sync/atomic"
+)
+
+// DefaultMaxLineSize 读取日志时单行的默认最大字节数
+const DefaultMaxLineSize = 4 << 20
+
+// ErrLineTooLong 日志行超过MaxLineSize，严格模式下查询返回包装了该错误的*ParseError
+var ErrLineTooLong = errors.New("日志行超过最大长度")
+
+// maxLineSize SetMaxLineSize设置的单行最大字节数，为0时使用DefaultMaxLineSize
+var maxLineSize atomic.Int64
+
+// SetMaxLineSize 设置查询、统计、校验和跟踪日志时单行的最大字节数，n不大于0时恢复DefaultMaxLineSize
+// 超过的行被跳过并计入无法解析的行数，不会中止读取；只影响之后开始的读取
+func SetMaxLineSize(n int) {
+	maxLineSize.Store(int64(max(n, 0)))
+}
+
+// MaxLineSize 返回读取日志时单行的最大字节数
+func MaxLineSize() int {
+	if n := maxLineSize.Load(); n > 0 {
+		return int(n)
+	}
+	return DefaultMaxLineSize
+}
+
+// LineReader 逐行读取日志，去掉行尾的\n或\r\n，最后一行没有换行符时同样返回
+// 超过MaxLineSize的行不保留内容，只占用MaxLineSize大小的内存：Scan照常返回true，TooLong为true，Bytes为空
+type LineReader struct {
+	reader  *bufio.Reader
+	max     int
+	line    []byte
+	lineNo  int
+	pos     int64 // 已读取的字节数
+	start   int64 // 当前行的起始位置
+	tooLong bool
+	done    bool
+	err     error
+}
+
+// NewLineReader 返回读取r的LineReader，单行最大字节数为当前的MaxLineSize
+func NewLineReader(r io.Reader) *LineReader {
+	return &LineReader{reader: bufio.NewReaderSize(r, 64*1024), max: MaxLineSize()}
+}
+
+// Scan 读取下一行，读到末尾或出错后返回false，出错时Err返回错误
+func (lr *LineReader) Scan() bool {
+	if lr.done {
+		return false
+	}
+	lr.line = lr.line[:0]
+	lr.tooLong = false
+	lr.start = lr.pos
+	read := false
+	for {
+		chunk, err := lr.reader.ReadSlice('\n')
+		read = read || len(chunk) > 0
+		lr.pos += int64(len(chunk))
+		if !lr.tooLong {
+			lr.line = append(lr.line, chunk...)
+			// 留出行尾\r\n的位置，去掉换行符后再精确判断
+			if len(lr.line) > lr.max+2 {
+				lr.tooLong = true
+				lr.line = lr.line[:0]
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			// 与bufio.Scanner一样，出错前读到的不完整行作为最后一行返回
+			lr.done = true
+			if err != io.EOF {
+				lr.err = err
+			}
+			if !read {
+				return false
+			}
+		}
+		break
+	}
+
+	lr.lineNo++
+	lr.line = bytes.TrimSuffix(lr.line, []byte("\n"))
+	lr.line = bytes.TrimSuffix(lr.line, []byte("\r"))
+	if len(lr.line) > lr.max {
+		lr.tooLong = true
+		lr.line = lr.line[:0]
+	}
+	return true
+}
+
+// Bytes 返回当前行的内容，在下次调用Scan前有效；行超过最大长度时为空
+func (lr *LineReader) Bytes() []byte {
+	return lr.line
+}
+
+// Text 返回当前行的内容
+func (lr *LineReader) Text() string {
+	return string(lr.line)
+}
+
+// Line 返回当前行的行号，从1开始
+func (lr *LineReader) Line() int {
+	return lr.lineNo
+}
+
+// Offset 返回当前行在读取内容中的起始位置（字节）
+func (lr *LineReader) Offset() int64 {
+	return lr.start
+}
+
+// TooLong 当前行是否超过最大长度
+func (lr *LineReader) TooLong() bool {
+	return lr.tooLong
+}
+
+// Err 返回读取中遇到的错误，正常读到末尾时返回nil
+func (lr *LineReader) Err() error {
+	return lr.err
+}
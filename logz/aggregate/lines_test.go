@@ -0,0 +1,144 @@
+package aggregate
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestQuerySkipsOversizedLine(t *testing.T) {
+	dir := t.TempDir()
+	var data bytes.Buffer
+	data.WriteString(`{"timestamp":"2024-01-15T10:00:00Z","level":"info","msg":"before","trace_id":"t1"}` + "\n")
+	// 10MB的行超过默认的4MB限制
+	data.WriteString(`{"level":"info","msg":"` + strings.Repeat("x", 10<<20) + `","trace_id":"t1"}` + "\n")
+	data.WriteString(`{"timestamp":"2024-01-15T10:00:02Z","level":"info","msg":"after","trace_id":"t1"}` + "\n")
+	data.WriteString(`{"timestamp":"2024-01-15T10:00:03Z","level":"error","msg":"last","trace_id":"t1"}`)
+	path := filepath.Join(dir, "big.log")
+	if err := os.WriteFile(path, data.Bytes(), 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+
+	result, err := QueryLogs(LogQuery{TraceID: "t1", Limit: 10}, dir)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if got := strings.Join(messages(result.Entries), ","); got != "before,after,last" {
+		t.Errorf("期望超长行之后的条目仍被找到，得到 %s", got)
+	}
+	if result.ParseErrors["big.log"] != 1 || len(result.ReadErrors) != 0 {
+		t.Errorf("期望超长行计入无效行，得到 %v %v", result.ParseErrors, result.ReadErrors)
+	}
+
+	total, malformed, err := CountLines(path)
+	if err != nil || total != 4 || malformed != 1 {
+		t.Errorf("期望共 4 行、1 行无效，得到 %d %d %v", total, malformed, err)
+	}
+
+	// 调高限制后可以读取
+	SetMaxLineSize(16 << 20)
+	defer SetMaxLineSize(0)
+	result, err = QueryLogs(LogQuery{TraceID: "t1", Limit: 10}, dir)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if result.Total != 4 || len(result.ParseErrors) != 0 {
+		t.Errorf("期望调高限制后匹配 4 条，得到 %d %v", result.Total, result.ParseErrors)
+	}
+}
+
+func TestLineReader(t *testing.T) {
+	SetMaxLineSize(8)
+	defer SetMaxLineSize(0)
+
+	reader := NewLineReader(strings.NewReader("short\r\n0123456789\n12345678\n\nlast"))
+	var lines []string
+	var offsets []int64
+	for reader.Scan() {
+		offsets = append(offsets, reader.Offset())
+		if reader.TooLong() {
+			lines = append(lines, "<too long>")
+			continue
+		}
+		lines = append(lines, reader.Text())
+	}
+	if err := reader.Err(); err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if got := strings.Join(lines, "|"); got != "short|<too long>|12345678||last" {
+		t.Errorf("读取结果错误: %s", got)
+	}
+	if reader.Line() != 5 {
+		t.Errorf("期望行号 5，得到 %d", reader.Line())
+	}
+	if want := []int64{0, 7, 18, 27, 28}; !reflect.DeepEqual(offsets, want) {
+		t.Errorf("期望行的起始位置 %v，得到 %v", want, offsets)
+	}
+}
+
+func TestWriteLogTruncatesOversizedEntry(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "truncate", WithBatchSize(1), WithMaxEntrySize(4096))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+
+	fields := map[string]any{"payload": strings.Repeat("p", 8192), "user": "alice"}
+	entries := []LogEntry{
+		{Level: "info", Message: strings.Repeat("日志", 4096), TraceID: "t1"},
+		{Level: "info", Message: "big fields", Fields: fields, TraceID: "t1"},
+		{Level: "info", Message: "small", TraceID: "t1"},
+	}
+	for _, entry := range entries {
+		if err := aggregator.WriteLog(entry); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+	}
+	if err := aggregator.Flush(); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+	if len(fields["payload"].(string)) != 8192 {
+		t.Error("期望不修改调用方的字段")
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "truncate_*.log"))
+	if len(files) != 1 {
+		t.Fatalf("期望 1 个日志文件，得到 %v", files)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("读取日志文件失败: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("期望 3 行，得到 %d", len(lines))
+	}
+	var written []LogEntry
+	for _, line := range lines {
+		if len(line) > 4096 {
+			t.Errorf("期望每行不超过 4096 字节，得到 %d", len(line))
+		}
+		var entry LogEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("解析日志失败: %v", err)
+		}
+		written = append(written, entry)
+	}
+
+	if !written[0].Truncated || !strings.HasSuffix(written[0].Message, truncatedSuffix) || !utf8.ValidString(written[0].Message) {
+		t.Errorf("期望消息被截断且保持UTF-8完整，得到 %v %q", written[0].Truncated, written[0].Message[len(written[0].Message)-20:])
+	}
+	payload, _ := written[1].Fields["payload"].(string)
+	if !written[1].Truncated || written[1].Message != "big fields" || !strings.HasSuffix(payload, truncatedSuffix) || written[1].Fields["user"] != "alice" {
+		t.Errorf("期望只截断过长的字段，得到 %+v", written[1])
+	}
+	if written[2].Truncated || written[2].Message != "small" {
+		t.Errorf("期望未超过限制的条目不被截断，得到 %+v", written[2])
+	}
+}
@@ -0,0 +1,299 @@
+package aggregate
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Writer 日志聚合器的公共行为，LogAggregator和MemoryAggregator都实现了该接口
+// AggregatorHook、WriteToAggregator和QueryAggregator通过它访问全局聚合器
+type Writer interface {
+	// WriteLog 写入一条日志，未设置的时间戳、主机名和进程ID由聚合器补充
+	WriteLog(entry LogEntry) error
+	// Query 查询聚合器中的日志，返回之前写入的所有条目中匹配的部分
+	Query(ctx context.Context, query LogQuery) (*LogQueryResult, error)
+	// Flush 写入缓冲的条目，返回后可以查询到之前写入的所有条目
+	Flush() error
+	// Close 关闭聚合器，之后的写入返回错误
+	Close() error
+}
+
+var (
+	_ Writer = (*LogAggregator)(nil)
+	_ Writer = (*MemoryAggregator)(nil)
+)
+
+// MemoryAggregator 只在内存中保存日志的聚合器，用于测试，不创建文件和索引数据库
+// 条目保存在按条目数和字节数限制的环形缓冲区中，超过限制时丢弃最早的条目；
+// 索引字段（TraceID、SpanID、级别、服务名、主机名）建立内存倒排列表，查询结果与LogAggregator一致
+type MemoryAggregator struct {
+	serviceName  string
+	hostname     string
+	pid          int
+	maxEntrySize int
+	limits       IngestLimits
+	maxEntries   int
+	maxBytes     int64
+
+	mutex   sync.RWMutex
+	ring    []memoryEntry
+	head    int    // ring中最早条目的位置
+	count   int    // ring中的条目数
+	first   uint64 // 最早条目的序号
+	bytes   int64  // 所有条目序列化后的总字节数
+	index   map[indexCondition][]uint64
+	enc     entryEncoder
+	evicted uint64
+	closed  bool
+}
+
+// memoryEntry 内存中的一条日志及其序列化后的字节数
+type memoryEntry struct {
+	entry LogEntry
+	size  int64
+}
+
+// NewMemoryAggregator 创建内存聚合器
+// 支持WithMemoryLimit、WithMaxEntrySize、WithIngestLimits、WithHostname和WithPID，其他只对文件生效的配置被忽略
+func NewMemoryAggregator(serviceName string, opts ...AggregatorOption) (*MemoryAggregator, error) {
+	options, err := applyAggregatorOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &MemoryAggregator{
+		serviceName:  serviceName,
+		hostname:     options.hostname,
+		pid:          options.pid,
+		maxEntrySize: options.maxEntrySize,
+		limits:       options.ingestLimits,
+		maxEntries:   options.memoryMaxEntries,
+		maxBytes:     options.memoryMaxBytes,
+		index:        make(map[indexCondition][]uint64),
+	}, nil
+}
+
+// ServiceName 返回服务名
+func (m *MemoryAggregator) ServiceName() string {
+	return m.serviceName
+}
+
+// WriteLog 写入日志，与LogAggregator一样补充时间戳、主机名和进程ID，并截断超过单条大小限制的条目
+// 内存中的条目没有文件ID和偏移量
+func (m *MemoryAggregator) WriteLog(entry LogEntry) error {
+	if entry.Timestamp == "" {
+		entry.Timestamp = time.Now().Format(time.RFC3339Nano)
+	}
+	entry.Level = canonicalLevel(entry.Level)
+	if entry.Hostname == "" {
+		entry.Hostname = m.hostname
+	}
+	if entry.PID == 0 {
+		entry.PID = m.pid
+	}
+	entry.FileID, entry.Offset = "", 0
+	if err := m.limits.Apply(&entry); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		return errors.New("聚合器已关闭")
+	}
+
+	// 与LogAggregator一样从1开始分配条目序号，即环形缓冲区中的序号加一
+	entry.Seq = m.first + uint64(m.count) + 1
+	m.enc.buf = m.enc.buf[:0]
+	if err := m.enc.appendEntry(&entry); err != nil {
+		return err
+	}
+	if len(m.enc.buf) > m.maxEntrySize {
+		m.enc.buf = m.enc.buf[:0]
+		if err := m.enc.appendTruncated(&entry, m.maxEntrySize); err != nil {
+			return err
+		}
+	}
+	// 与文件中一样计入换行符
+	size := int64(len(m.enc.buf) + 1)
+	if cap(m.enc.buf) > maxPooledEncoderBuffer {
+		m.enc.buf = nil
+	}
+
+	// 至少保留最新的一条
+	for m.count > 0 && (m.count >= m.maxEntries || m.bytes+size > m.maxBytes) {
+		m.evictOldest()
+	}
+	m.push(memoryEntry{entry: entry, size: size})
+	return nil
+}
+
+// push 将条目放入环形缓冲区并加入倒排列表，缓冲区已满时扩容（不超过maxEntries）
+func (m *MemoryAggregator) push(item memoryEntry) {
+	if m.count == len(m.ring) {
+		ring := make([]memoryEntry, min(max(2*len(m.ring), 64), m.maxEntries))
+		for i := 0; i < m.count; i++ {
+			ring[i] = m.ring[(m.head+i)%len(m.ring)]
+		}
+		m.ring, m.head = ring, 0
+	}
+	seq := m.first + uint64(m.count)
+	m.ring[(m.head+m.count)%len(m.ring)] = item
+	m.count++
+	m.bytes += item.size
+	for _, cond := range entryConditions(item.entry) {
+		m.index[cond] = append(m.index[cond], seq)
+	}
+}
+
+// evictOldest 丢弃最早的条目，倒排列表按序号递增，被丢弃的条目总在列表开头
+func (m *MemoryAggregator) evictOldest() {
+	item := m.ring[m.head]
+	for _, cond := range entryConditions(item.entry) {
+		if seqs := m.index[cond][1:]; len(seqs) > 0 {
+			m.index[cond] = seqs
+		} else {
+			delete(m.index, cond)
+		}
+	}
+	m.ring[m.head] = memoryEntry{}
+	m.head = (m.head + 1) % len(m.ring)
+	m.count--
+	m.first++
+	m.bytes -= item.size
+	m.evicted++
+}
+
+// at 返回序号为seq的条目，调用方需持有mutex且seq在缓冲区中
+func (m *MemoryAggregator) at(seq uint64) *LogEntry {
+	return &m.ring[(m.head+int(seq-m.first))%len(m.ring)].entry
+}
+
+// entryConditions 返回条目在倒排列表中的键，与文件索引使用的字段相同
+func entryConditions(entry LogEntry) []indexCondition {
+	return indexConditions(LogQuery{
+		TraceID:  entry.TraceID,
+		SpanID:   entry.SpanID,
+		Level:    entry.Level,
+		Service:  entry.Service,
+		Hostname: entry.Hostname,
+	})
+}
+
+// Query 查询内存中的日志，参数校验、过滤、排序和分页与QueryLogs相同
+// 包含索引字段时只检查倒排列表中最短的一个，否则检查所有条目；文件相关的条件（PathPatterns等）不生效
+func (m *MemoryAggregator) Query(ctx context.Context, query LogQuery) (*LogQueryResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	stats := newQueryStats(query)
+
+	m.mutex.RLock()
+	start := stats.phaseStart()
+	conditions := indexConditions(query)
+	var candidates []uint64
+	if len(conditions) > 0 {
+		candidates = m.index[conditions[0]]
+		for _, cond := range conditions[1:] {
+			if seqs := m.index[cond]; len(seqs) < len(candidates) {
+				candidates = seqs
+			}
+		}
+		if stats != nil {
+			stats.explain.Strategy = StrategyIndex
+			for _, cond := range conditions {
+				stats.explain.IndexBuckets = append(stats.explain.IndexBuckets, cond.bucket)
+			}
+			stats.postings(len(candidates))
+		}
+		stats.phaseEnd("index_lookup", start)
+		start = stats.phaseStart()
+	}
+
+	entries := make([]LogEntry, 0)
+	check := func(seq uint64) {
+		if entry := m.at(seq); matchesQuery(*entry, query) {
+			entries = append(entries, *entry)
+		}
+	}
+	if len(conditions) > 0 {
+		for _, seq := range candidates {
+			check(seq)
+		}
+		stats.scanned(len(candidates))
+	} else {
+		for i := 0; i < m.count; i++ {
+			check(m.first + uint64(i))
+		}
+		stats.scanned(m.count)
+	}
+	m.mutex.RUnlock()
+	stats.phaseEnd("scan", start)
+
+	result := &LogQueryResult{
+		Entries: mergeByTime([][]LogEntry{entries}, query.sortOrder()),
+		Limit:   query.Limit,
+		Offset:  query.Offset,
+	}
+	paginate(result, query)
+	stats.finish(result)
+	return result, nil
+}
+
+// Entries 按写入顺序返回内存中的所有条目
+func (m *MemoryAggregator) Entries() []LogEntry {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	entries := make([]LogEntry, m.count)
+	for i := range entries {
+		entries[i] = *m.at(m.first + uint64(i))
+	}
+	return entries
+}
+
+// Evicted 返回超过容量限制被丢弃的条目数
+func (m *MemoryAggregator) Evicted() uint64 {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.evicted
+}
+
+// Reset 清空内存中的条目
+func (m *MemoryAggregator) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.ring, m.head, m.count, m.bytes, m.evicted = nil, 0, 0, 0, 0
+	m.first = 0
+	m.index = make(map[indexCondition][]uint64)
+}
+
+// Flush 条目写入后立即可以查询，已关闭时返回错误
+func (m *MemoryAggregator) Flush() error {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	if m.closed {
+		return errors.New("聚合器已关闭")
+	}
+	return nil
+}
+
+// Close 关闭聚合器，之后的写入返回错误，已写入的条目仍然可以查询
+func (m *MemoryAggregator) Close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.closed = true
+	return nil
+}
+
+// QueryAggregator 查询全局聚合器，全局聚合器可以是LogAggregator或MemoryAggregator，没有聚合器时返回ErrNoAggregator
+func QueryAggregator(ctx context.Context, query LogQuery) (*LogQueryResult, error) {
+	aggregator := GlobalAggregator()
+	if aggregator == nil {
+		return nil, ErrNoAggregator
+	}
+	return aggregator.Query(ctx, query)
+}
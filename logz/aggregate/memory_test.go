@@ -0,0 +1,263 @@
+package aggregate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz"
+	"github.com/sirupsen/logrus"
+)
+
+// TestAggregatorConformance 对LogAggregator和MemoryAggregator运行相同的测试，保证两者的写入和查询行为一致
+func TestAggregatorConformance(t *testing.T) {
+	t.Run("LogAggregator", func(t *testing.T) {
+		testAggregatorConformance(t, func(t *testing.T, opts ...AggregatorOption) Writer {
+			aggregator, err := NewLogAggregatorWithOptions(t.TempDir(), "conformance", opts...)
+			if err != nil {
+				t.Fatalf("创建聚合器失败: %v", err)
+			}
+			t.Cleanup(func() { aggregator.Close() })
+			return aggregator
+		})
+	})
+	t.Run("MemoryAggregator", func(t *testing.T) {
+		testAggregatorConformance(t, func(t *testing.T, opts ...AggregatorOption) Writer {
+			aggregator, err := NewMemoryAggregator("conformance", opts...)
+			if err != nil {
+				t.Fatalf("创建聚合器失败: %v", err)
+			}
+			return aggregator
+		})
+	})
+}
+
+func testAggregatorConformance(t *testing.T, newAggregator func(t *testing.T, opts ...AggregatorOption) Writer) {
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	at := func(second int) string {
+		return base.Add(time.Duration(second) * time.Second).Format(time.RFC3339)
+	}
+
+	t.Run("查询", func(t *testing.T) {
+		aggregator := newAggregator(t, WithHostname("host-a"), WithPID(42))
+		entries := []LogEntry{
+			{Timestamp: at(3), Level: "INFO", Message: "order created", TraceID: "t1", Service: "orders"},
+			{Timestamp: at(1), Level: "error", Message: "payment failed", TraceID: "t1", SpanID: "s1", Service: "payments"},
+			{Timestamp: at(2), Level: "warning", Message: "retrying payment", TraceID: "t2", Service: "payments", Hostname: "host-b"},
+			{Timestamp: at(0), Level: "info", Message: "started", Service: "orders"},
+			{Timestamp: at(4), Level: "error", Message: "order failed", TraceID: "t1", Service: "orders", Fields: map[string]any{"attempt": float64(2)}},
+		}
+		for _, entry := range entries {
+			if err := aggregator.WriteLog(entry); err != nil {
+				t.Fatalf("写入日志失败: %v", err)
+			}
+		}
+		if err := aggregator.Flush(); err != nil {
+			t.Fatalf("刷新失败: %v", err)
+		}
+
+		tests := []struct {
+			name  string
+			query LogQuery
+			want  []string
+		}{
+			{"全部", LogQuery{}, []string{"started", "payment failed", "retrying payment", "order created", "order failed"}},
+			{"TraceID", LogQuery{TraceID: "t1", UseIndex: true}, []string{"payment failed", "order created", "order failed"}},
+			{"TraceID和级别", LogQuery{TraceID: "t1", Level: "ERROR", UseIndex: true}, []string{"payment failed", "order failed"}},
+			{"SpanID", LogQuery{SpanID: "s1"}, []string{"payment failed"}},
+			{"级别别名", LogQuery{Level: "warn", UseIndex: true}, []string{"retrying payment"}},
+			{"服务名", LogQuery{Service: "orders", UseIndex: true}, []string{"started", "order created", "order failed"}},
+			{"主机名", LogQuery{Hostname: "host-b"}, []string{"retrying payment"}},
+			{"消息", LogQuery{Message: "^order"}, []string{"order created", "order failed"}},
+			{"时间范围", LogQuery{StartTime: base.Add(time.Second), EndTime: base.Add(3 * time.Second)}, []string{"payment failed", "retrying payment", "order created"}},
+			{"降序", LogQuery{Service: "orders", SortOrder: SortDesc, UseIndex: true}, []string{"order failed", "order created", "started"}},
+			{"没有匹配", LogQuery{TraceID: "missing", UseIndex: true}, []string{}},
+		}
+		for _, tt := range tests {
+			query := tt.query
+			query.Limit = 100
+			result, err := aggregator.Query(context.Background(), query)
+			if err != nil {
+				t.Fatalf("%s: 查询失败: %v", tt.name, err)
+			}
+			if got := messages(result.Entries); !reflect.DeepEqual(got, tt.want) || result.Total != len(tt.want) {
+				t.Errorf("%s: 期望 %v，得到 %d %v", tt.name, tt.want, result.Total, got)
+			}
+		}
+
+		// 分页
+		result, err := aggregator.Query(context.Background(), LogQuery{Limit: 2, Offset: 1})
+		if err != nil {
+			t.Fatalf("查询失败: %v", err)
+		}
+		if got := messages(result.Entries); result.Total != 5 || result.Limit != 2 || result.Offset != 1 ||
+			!reflect.DeepEqual(got, []string{"payment failed", "retrying payment"}) {
+			t.Errorf("分页结果错误: %d %v", result.Total, got)
+		}
+
+		// 写入时补充的字段
+		result, err = aggregator.Query(context.Background(), LogQuery{TraceID: "t1", Level: "info", Limit: 10})
+		if err != nil || len(result.Entries) != 1 {
+			t.Fatalf("查询失败: %v %+v", err, result)
+		}
+		entry := result.Entries[0]
+		if entry.Level != "info" || entry.Hostname != "host-a" || entry.PID != 42 || entry.Service != "orders" {
+			t.Errorf("期望统一级别并补充主机名和进程ID，得到 %+v", entry)
+		}
+		result, err = aggregator.Query(context.Background(), LogQuery{Message: "order failed", Limit: 10})
+		if err != nil || len(result.Entries) != 1 || result.Entries[0].Fields["attempt"] != float64(2) {
+			t.Errorf("期望保留字段，得到 %v %+v", err, result)
+		}
+
+		if _, err := aggregator.Query(context.Background(), LogQuery{Level: "verbose"}); err == nil {
+			t.Error("期望无效的查询返回错误")
+		}
+	})
+
+	t.Run("截断", func(t *testing.T) {
+		aggregator := newAggregator(t, WithMaxEntrySize(1024))
+		if err := aggregator.WriteLog(LogEntry{Level: "info", Message: strings.Repeat("m", 4096), TraceID: "big"}); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+		result, err := aggregator.Query(context.Background(), LogQuery{TraceID: "big", Limit: 10})
+		if err != nil || len(result.Entries) != 1 {
+			t.Fatalf("查询失败: %v %+v", err, result)
+		}
+		if entry := result.Entries[0]; !entry.Truncated || len(entry.Message) >= 1024 || !strings.HasSuffix(entry.Message, truncatedSuffix) {
+			t.Errorf("期望截断超过大小限制的条目，得到 %v %d", entry.Truncated, len(entry.Message))
+		}
+	})
+
+	t.Run("Hook", func(t *testing.T) {
+		aggregator := newAggregator(t)
+		logger := logrus.New()
+		logger.SetOutput(io.Discard)
+		logger.AddHook(NewAggregatorHook(aggregator, "hooked"))
+		logger.WithFields(logrus.Fields{"trace_id": "t9", "user": "alice"}).Warn("from hook")
+
+		result, err := aggregator.Query(context.Background(), LogQuery{TraceID: "t9", Limit: 10})
+		if err != nil || len(result.Entries) != 1 {
+			t.Fatalf("查询失败: %v %+v", err, result)
+		}
+		if entry := result.Entries[0]; entry.Message != "from hook" || entry.Level != "warn" || entry.Service != "hooked" || entry.Fields["user"] != "alice" {
+			t.Errorf("Hook写入的条目错误: %+v", entry)
+		}
+	})
+
+	t.Run("全局聚合器", func(t *testing.T) {
+		aggregator := newAggregator(t)
+		SetGlobalAggregator(aggregator)
+		defer SetGlobalAggregator(nil)
+
+		if err := WriteToAggregator(LogEntry{Level: "error", Message: "global", TraceID: "g1"}); err != nil {
+			t.Fatalf("写入全局聚合器失败: %v", err)
+		}
+		if err := FlushAggregator(); err != nil {
+			t.Fatalf("刷新失败: %v", err)
+		}
+		result, err := QueryAggregator(context.Background(), LogQuery{TraceID: "g1", Limit: 10})
+		if err != nil || result.Total != 1 || result.Entries[0].Message != "global" {
+			t.Errorf("期望查询到全局聚合器中的条目，得到 %v %+v", err, result)
+		}
+	})
+
+	t.Run("关闭", func(t *testing.T) {
+		aggregator := newAggregator(t)
+		if err := aggregator.WriteLog(LogEntry{Level: "info", Message: "before close"}); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+		if err := aggregator.Close(); err != nil {
+			t.Fatalf("关闭失败: %v", err)
+		}
+		if err := aggregator.WriteLog(LogEntry{Level: "info", Message: "after close"}); err == nil {
+			t.Error("期望关闭后写入返回错误")
+		}
+		if err := aggregator.Flush(); err == nil {
+			t.Error("期望关闭后刷新返回错误")
+		}
+		result, err := aggregator.Query(context.Background(), LogQuery{Limit: 10})
+		if err != nil || !reflect.DeepEqual(messages(result.Entries), []string{"before close"}) {
+			t.Errorf("期望关闭后仍能查询已写入的条目，得到 %v %+v", err, result)
+		}
+	})
+}
+
+func TestMemoryAggregatorLimits(t *testing.T) {
+	aggregator, err := NewMemoryAggregator("limits", WithMemoryLimit(3, 1<<20))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := aggregator.WriteLog(LogEntry{Level: "info", Message: fmt.Sprint(i), TraceID: fmt.Sprintf("t%d", i%2)}); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+	}
+	if got := messages(aggregator.Entries()); !reflect.DeepEqual(got, []string{"2", "3", "4"}) || aggregator.Evicted() != 2 {
+		t.Errorf("期望按条目数丢弃最早的条目，得到 %v，丢弃 %d", got, aggregator.Evicted())
+	}
+	// 被丢弃的条目同时从倒排列表中移除
+	result, err := aggregator.Query(context.Background(), LogQuery{TraceID: "t0", Limit: 10, Explain: true})
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if got := messages(result.Entries); !reflect.DeepEqual(got, []string{"2", "4"}) {
+		t.Errorf("期望 [2 4]，得到 %v", got)
+	}
+	if explain := result.Explain; explain.Strategy != StrategyIndex || explain.Postings != 2 || explain.LinesScanned != 2 {
+		t.Errorf("期望只检查倒排列表中的条目，得到 %+v", explain)
+	}
+
+	// 按字节数限制时至少保留最新的一条
+	aggregator, err = NewMemoryAggregator("limits", WithMemoryLimit(100, 300), WithMaxEntrySize(1024))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	for _, msg := range []string{"a", "b", strings.Repeat("c", 500)} {
+		if err := aggregator.WriteLog(LogEntry{Level: "info", Message: msg}); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+	}
+	if entries := aggregator.Entries(); len(entries) != 1 || len(entries[0].Message) != 500 {
+		t.Errorf("期望只保留超过字节限制的最新条目，得到 %d 条", len(entries))
+	}
+
+	aggregator.Reset()
+	if len(aggregator.Entries()) != 0 || aggregator.Evicted() != 0 {
+		t.Error("期望Reset清空条目")
+	}
+
+	if _, err := NewMemoryAggregator("limits", WithMemoryLimit(0, 1)); err == nil {
+		t.Error("期望非法的容量返回错误")
+	}
+}
+
+func TestInitForTesting(t *testing.T) {
+	t.Run("安装", func(t *testing.T) {
+		aggregator := InitForTesting(t)
+		if GlobalAggregator() != aggregator || GetGlobalAggregator() != nil {
+			t.Fatal("期望安装为全局聚合器")
+		}
+
+		logz.WithField("trace_id", "init-1").Error("captured")
+		result, err := QueryAggregator(context.Background(), LogQuery{TraceID: "init-1", Limit: 10})
+		if err != nil || len(result.Entries) != 1 || result.Entries[0].Message != "captured" || result.Entries[0].Level != "error" {
+			t.Errorf("期望默认日志器的日志写入内存聚合器，得到 %v %+v", err, result)
+		}
+	})
+
+	// 测试结束后恢复全局聚合器并移除Hook
+	if GlobalAggregator() != nil {
+		t.Error("期望测试结束后清除全局聚合器")
+	}
+	for _, hooks := range logz.Logrus.Hooks {
+		for _, hook := range hooks {
+			if _, ok := hook.(*AggregatorHook); ok {
+				t.Fatal("期望测试结束后移除聚合Hook")
+			}
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// 聚合器配置默认值
+const (
+	DefaultRotationSize   int64         = 100 * 1024 * 1024 // 100MB
+	DefaultMaxBackups                   = 10
+	DefaultBatchSize                    = 100
+	DefaultFlushInterval  time.Duration = 5 * time.Second
+	DefaultCompressAfter  time.Duration = 24 * time.Hour
+	DefaultIndexWorkers                 = 2
+	DefaultIndexQueueSize               = 1000
+	DefaultRetentionDays                = 7
+	DefaultMaxEntrySize                 = 1 << 20 // 1MB
+)
+
+// MemoryAggregator的默认容量
+const (
+	DefaultMemoryMaxEntries       = 10000
+	DefaultMemoryMaxBytes   int64 = 64 << 20 // 64MB
+)
+
+// 聚合器配置取值范围
+const (
+	maxBatchSize      = 10000
+	maxIndexWorkers   = 64
+	maxIndexQueueSize = 1000000
+	minEntrySize      = 1024
+)
+
+// aggregatorOptions 聚合器可选配置
+type aggregatorOptions struct {
+	rotationSize   int64
+	maxBackups     int
+	batchSize      int
+	maxEntrySize   int
+	ingestLimits   IngestLimits // WriteLog对单条日志的限制
+	flushInterval  time.Duration
+	compressAfter  time.Duration
+	indexWorkers   int
+	indexQueueSize int
+	retentionDays  int
+	levelRetention map[string]int // 按级别拆分文件的保留天数
+	diskGuard      DiskGuard
+	statDisk       func(path string) (DiskUsage, error) // 测试中可替换
+	openIndex      func(path string) (*bbolt.DB, error) // 打开索引数据库，测试中可替换
+	hostname       string                               // 写入条目的主机名，默认为os.Hostname()
+	pid            int                                  // 写入条目的进程ID，默认为os.Getpid()
+
+	memoryMaxEntries int   // MemoryAggregator保留的最大条目数
+	memoryMaxBytes   int64 // MemoryAggregator保留条目序列化后的最大总字节数
+
+	compactMaxSize   int64   // 索引文件超过此大小时压缩
+	compactFreeRatio float64 // 索引空闲页比例超过此值时压缩
+
+	indexSweepInterval time.Duration // 全量扫描索引、删除指向已不存在文件的条目的间隔
+
+	lockStaleTimeout time.Duration // 目录锁心跳的过期时间
+
+	adaptiveMaxLatency time.Duration // 自适应刷新的最大延迟，0表示使用固定的批量大小和刷新间隔
+	adaptiveMaxBytes   int           // 自适应刷新的最大批次字节数
+
+	hookQueueSize  int            // 聚合Hook异步队列容量，0表示同步写入
+	hookOverflow   OverflowPolicy // 异步队列已满时的处理方式
+	hookDropReport time.Duration  // 报告丢弃条目数的间隔，测试中可替换
+
+	writeRetryBuffer    int                         // 写入失败期间最多缓冲的条目数
+	writeFailureTimeout time.Duration               // 写入持续失败超过此时间后拒绝新条目
+	wrapFile            func(w io.Writer) io.Writer // 包装聚合文件的写入，测试中可替换以模拟写入失败
+}
+
+// AggregatorOption 聚合器配置选项
+type AggregatorOption func(*aggregatorOptions) error
+
+// defaultAggregatorOptions 返回默认的聚合器配置
+func defaultAggregatorOptions() *aggregatorOptions {
+	return &aggregatorOptions{
+		rotationSize:   DefaultRotationSize,
+		maxBackups:     DefaultMaxBackups,
+		batchSize:      DefaultBatchSize,
+		maxEntrySize:   DefaultMaxEntrySize,
+		flushInterval:  DefaultFlushInterval,
+		compressAfter:  DefaultCompressAfter,
+		indexWorkers:   DefaultIndexWorkers,
+		indexQueueSize: DefaultIndexQueueSize,
+		retentionDays:  DefaultRetentionDays,
+		statDisk:       statDisk,
+		openIndex:      openIndexDB,
+		hostname:       defaultHostname(),
+		pid:            os.Getpid(),
+
+		memoryMaxEntries: DefaultMemoryMaxEntries,
+		memoryMaxBytes:   DefaultMemoryMaxBytes,
+
+		lockStaleTimeout: DefaultLockStaleTimeout,
+
+		compactFreeRatio: DefaultIndexCompactFreeRatio,
+		hookDropReport:   DefaultHookDropReportInterval,
+
+		indexSweepInterval: DefaultIndexSweepInterval,
+
+		writeRetryBuffer:    DefaultWriteRetryBuffer,
+		writeFailureTimeout: DefaultWriteFailureTimeout,
+	}
+}
+
+// defaultHostname 返回本机主机名，获取失败时返回空字符串，条目不记录主机名
+func defaultHostname() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return hostname
+}
+
+// applyAggregatorOptions 依次应用配置选项，遇到非法取值立即返回错误
+func applyAggregatorOptions(opts []AggregatorOption) (*aggregatorOptions, error) {
+	options := defaultAggregatorOptions()
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt(options); err != nil {
+			return nil, err
+		}
+	}
+	return options, nil
+}
+
+// WithRotationSize 设置单个聚合文件的轮转大小（字节）
+func WithRotationSize(size int64) AggregatorOption {
+	return func(o *aggregatorOptions) error {
+		if size <= 0 {
+			return fmt.Errorf("轮转大小必须大于0: %d", size)
+		}
+		o.rotationSize = size
+		return nil
+	}
+}
+
+// WithMaxBackups 设置最大备份文件数
+func WithMaxBackups(n int) AggregatorOption {
+	return func(o *aggregatorOptions) error {
+		if n <= 0 {
+			return fmt.Errorf("最大备份数必须大于0: %d", n)
+		}
+		o.maxBackups = n
+		return nil
+	}
+}
+
+// WithBatchSize 设置批量写入的条目数（1-10000）
+func WithBatchSize(n int) AggregatorOption {
+	return func(o *aggregatorOptions) error {
+		if n < 1 || n > maxBatchSize {
+			return fmt.Errorf("批量大小必须在1到%d之间: %d", maxBatchSize, n)
+		}
+		o.batchSize = n
+		return nil
+	}
+}
+
+// WithMaxEntrySize 设置单条日志序列化后的最大字节数（1024到MaxLineSize之间）
+// 超过时依次截断消息和较长的字段值，仍然超过时去掉所有字段，写入的条目带有"truncated":true
+func WithMaxEntrySize(n int) AggregatorOption {
+	return func(o *aggregatorOptions) error {
+		if n < minEntrySize || n > MaxLineSize() {
+			return fmt.Errorf("单条日志大小必须在%d到%d之间: %d", minEntrySize, MaxLineSize(), n)
+		}
+		o.maxEntrySize = n
+		return nil
+	}
+}
+
+// WithMemoryLimit 设置MemoryAggregator保留的最大条目数和序列化后的最大总字节数，超过时丢弃最早的条目
+// 对写入文件的LogAggregator不生效
+func WithMemoryLimit(maxEntries int, maxBytes int64) AggregatorOption {
+	return func(o *aggregatorOptions) error {
+		if maxEntries <= 0 {
+			return fmt.Errorf("内存条目数必须大于0: %d", maxEntries)
+		}
+		if maxBytes <= 0 {
+			return fmt.Errorf("内存字节数必须大于0: %d", maxBytes)
+		}
+		o.memoryMaxEntries = maxEntries
+		o.memoryMaxBytes = maxBytes
+		return nil
+	}
+}
+
+// WithFlushInterval 设置定时刷新间隔
+func WithFlushInterval(d time.Duration) AggregatorOption {
+	return func(o *aggregatorOptions) error {
+		if d <= 0 {
+			return fmt.Errorf("刷新间隔必须大于0: %v", d)
+		}
+		o.flushInterval = d
+		return nil
+	}
+}
+
+// WithCompressAfter 设置文件在多久之后被压缩
+func WithCompressAfter(d time.Duration) AggregatorOption {
+	return func(o *aggregatorOptions) error {
+		if d <= 0 {
+			return fmt.Errorf("压缩延迟必须大于0: %v", d)
+		}
+		o.compressAfter = d
+		return nil
+	}
+}
+
+// WithIndexWorkers 设置索引工作线程数（1-64）
+func WithIndexWorkers(n int) AggregatorOption {
+	return func(o *aggregatorOptions) error {
+		if n < 1 || n > maxIndexWorkers {
+			return fmt.Errorf("索引工作线程数必须在1到%d之间: %d", maxIndexWorkers, n)
+		}
+		o.indexWorkers = n
+		return nil
+	}
+}
+
+// WithIndexQueueSize 设置索引队列容量
+func WithIndexQueueSize(n int) AggregatorOption {
+	return func(o *aggregatorOptions) error {
+		if n < 1 || n > maxIndexQueueSize {
+			return fmt.Errorf("索引队列容量必须在1到%d之间: %d", maxIndexQueueSize, n)
+		}
+		o.indexQueueSize = n
+		return nil
+	}
+}
+
+// WithRetentionDays 设置聚合文件的保留天数
+func WithRetentionDays(days int) AggregatorOption {
+	return func(o *aggregatorOptions) error {
+		if days < 1 {
+			return fmt.Errorf("保留天数必须大于0: %d", days)
+		}
+		o.retentionDays = days
+		return nil
+	}
+}
+
+// WithRetentionPolicy 设置按级别的保留策略，Levels中的级别写入单独的文件并按各自的天数清理
+// policy.Default为0时保持WithRetentionDays设置的默认保留天数
+func WithRetentionPolicy(policy RetentionPolicy) AggregatorOption {
+	return func(o *aggregatorOptions) error {
+		if policy.Default < 0 {
+			return fmt.Errorf("保留天数必须大于0: %d", policy.Default)
+		}
+		levels, err := normalizeRetentionLevels(policy.Levels, 1)
+		if err != nil {
+			return err
+		}
+		if policy.Default > 0 {
+			o.retentionDays = policy.Default
+		}
+		o.levelRetention = levels
+		return nil
+	}
+}
+
+// WithDiskGuard 设置磁盘空间保护，定期检查输出目录所在磁盘的可用空间，空间不足时逐步清理、丢弃低级别条目并拒绝写入
+func WithDiskGuard(guard DiskGuard) AggregatorOption {
+	return func(o *aggregatorOptions) error {
+		if guard.MinFreePercent < 0 || guard.MinFreePercent > 100 {
+			return fmt.Errorf("可用空间百分比必须在0到100之间: %v", guard.MinFreePercent)
+		}
+		if !guard.enabled() {
+			return errors.New("磁盘空间保护需要设置MinFreeBytes或MinFreePercent")
+		}
+		if guard.CheckInterval < 0 {
+			return fmt.Errorf("检查间隔不能为负数: %v", guard.CheckInterval)
+		}
+		if guard.CheckInterval == 0 {
+			guard.CheckInterval = DefaultDiskCheckInterval
+		}
+		o.diskGuard = guard
+		return nil
+	}
+}
+
+// WithHostname 设置写入条目的主机名，用于区分共享聚合目录中同一服务的多个副本（如容器中的Pod名）
+func WithHostname(hostname string) AggregatorOption {
+	return func(o *aggregatorOptions) error {
+		hostname = strings.TrimSpace(hostname)
+		if hostname == "" {
+			return errors.New("主机名不能为空")
+		}
+		o.hostname = hostname
+		return nil
+	}
+}
+
+// WithPID 设置写入条目的进程ID
+func WithPID(pid int) AggregatorOption {
+	return func(o *aggregatorOptions) error {
+		if pid <= 0 {
+			return fmt.Errorf("进程ID必须大于0: %d", pid)
+		}
+		o.pid = pid
+		return nil
+	}
+}
+
+// WithIndexCompaction 设置维护任务自动压缩索引数据库的条件：
+// 索引文件超过maxSize字节，或空闲页占文件大小的比例超过freeRatio（只对64MB以上的索引生效）
+// 取值为0时不按该条件压缩，默认只按空闲页比例0.5压缩
+func WithIndexCompaction(maxSize int64, freeRatio float64) AggregatorOption {
+	return func(o *aggregatorOptions) error {
+		if maxSize < 0 {
+			return fmt.Errorf("索引压缩大小不能为负数: %d", maxSize)
+		}
+		if freeRatio < 0 || freeRatio >= 1 {
+			return fmt.Errorf("索引空闲页比例必须在0到1之间: %v", freeRatio)
+		}
+		o.compactMaxSize = maxSize
+		o.compactFreeRatio = freeRatio
+		return nil
+	}
+}
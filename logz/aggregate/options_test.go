@@ -0,0 +1,106 @@
+package aggregate
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNewLogAggregatorWithOptions(t *testing.T) {
+	aggregator, err := NewLogAggregatorWithOptions(t.TempDir(), "options-service",
+		WithRotationSize(1024),
+		WithMaxBackups(3),
+		WithBatchSize(50),
+		WithFlushInterval(time.Second),
+		WithCompressAfter(time.Hour),
+		WithIndexWorkers(4),
+		WithIndexQueueSize(64),
+		WithRetentionDays(30),
+	)
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+
+	if aggregator.rotationSize != 1024 {
+		t.Errorf("期望轮转大小 1024，得到 %d", aggregator.rotationSize)
+	}
+	if aggregator.maxBackups != 3 {
+		t.Errorf("期望最大备份数 3，得到 %d", aggregator.maxBackups)
+	}
+	if aggregator.batchSize != 50 {
+		t.Errorf("期望批量大小 50，得到 %d", aggregator.batchSize)
+	}
+	if aggregator.flushInterval != time.Second {
+		t.Errorf("期望刷新间隔 1s，得到 %v", aggregator.flushInterval)
+	}
+	if aggregator.compressAfter != time.Hour {
+		t.Errorf("期望压缩延迟 1h，得到 %v", aggregator.compressAfter)
+	}
+	if aggregator.indexWorkers != 4 {
+		t.Errorf("期望索引工作线程数 4，得到 %d", aggregator.indexWorkers)
+	}
+	if cap(aggregator.indexQueue) != 64 {
+		t.Errorf("期望索引队列容量 64，得到 %d", cap(aggregator.indexQueue))
+	}
+	if aggregator.retention.Default != 30 {
+		t.Errorf("期望保留天数 30，得到 %d", aggregator.retention.Default)
+	}
+}
+
+func TestAggregatorOptionDefaults(t *testing.T) {
+	options, err := applyAggregatorOptions(nil)
+	if err != nil {
+		t.Fatalf("应用默认配置失败: %v", err)
+	}
+
+	if options.rotationSize != DefaultRotationSize {
+		t.Errorf("期望默认轮转大小 %d，得到 %d", DefaultRotationSize, options.rotationSize)
+	}
+	if options.batchSize != DefaultBatchSize {
+		t.Errorf("期望默认批量大小 %d，得到 %d", DefaultBatchSize, options.batchSize)
+	}
+	if options.retentionDays != DefaultRetentionDays {
+		t.Errorf("期望默认保留天数 %d，得到 %d", DefaultRetentionDays, options.retentionDays)
+	}
+	if options.pid != os.Getpid() {
+		t.Errorf("期望默认进程ID %d，得到 %d", os.Getpid(), options.pid)
+	}
+}
+
+func TestAggregatorOptionValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  AggregatorOption
+	}{
+		{"RotationSizeZero", WithRotationSize(0)},
+		{"MaxBackupsNegative", WithMaxBackups(-1)},
+		{"BatchSizeZero", WithBatchSize(0)},
+		{"BatchSizeTooLarge", WithBatchSize(10001)},
+		{"FlushIntervalZero", WithFlushInterval(0)},
+		{"CompressAfterNegative", WithCompressAfter(-time.Minute)},
+		{"IndexWorkersZero", WithIndexWorkers(0)},
+		{"IndexWorkersTooMany", WithIndexWorkers(65)},
+		{"IndexQueueSizeZero", WithIndexQueueSize(0)},
+		{"RetentionDaysZero", WithRetentionDays(0)},
+		{"HostnameEmpty", WithHostname(" ")},
+		{"PIDZero", WithPID(0)},
+		{"IndexCompactionSizeNegative", WithIndexCompaction(-1, 0)},
+		{"IndexCompactionRatioTooLarge", WithIndexCompaction(0, 1)},
+		{"HookQueueSizeZero", WithHookQueue(0, OverflowDrop)},
+		{"HookQueuePolicyUnknown", WithHookQueue(16, OverflowPolicy("spill"))},
+		{"MaxEntrySizeTooSmall", WithMaxEntrySize(100)},
+		{"MaxEntrySizeTooLarge", WithMaxEntrySize(MaxLineSize() + 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			aggregator, err := NewLogAggregatorWithOptions(dir, "invalid-service", tt.opt)
+			if err == nil {
+				aggregator.Close()
+				t.Fatal("期望非法配置返回错误")
+			}
+		})
+	}
+}
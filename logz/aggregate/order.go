@@ -0,0 +1,126 @@
+package aggregate
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"time"
+)
+
+// 查询结果的排列顺序
+const (
+	SortAsc  = "asc"  // 按时间戳和序号从早到晚
+	SortDesc = "desc" // 按时间戳和序号从晚到早
+)
+
+// sortOrder 返回查询结果的排列顺序，未指定时按时间升序
+func (q LogQuery) sortOrder() string {
+	if q.SortOrder == SortDesc {
+		return SortDesc
+	}
+	return SortAsc
+}
+
+// orderKey 条目的排序键：时间戳相同时按聚合器分配的序号排列，同一服务的条目因此有确定的全序
+type orderKey struct {
+	time int64
+	seq  uint64
+}
+
+// entryKey 返回条目的排序键，无法解析的时间戳视为最早（升序时在最前，降序时在最后）
+func entryKey(entry LogEntry) orderKey {
+	t, err := time.Parse(time.RFC3339, entry.Timestamp)
+	if err != nil {
+		return orderKey{math.MinInt64, entry.Seq}
+	}
+	return orderKey{t.UnixNano(), entry.Seq}
+}
+
+// compareKeys 按时间戳、再按序号比较排序键
+func compareKeys(a, b orderKey) int {
+	return cmp.Or(cmp.Compare(a.time, b.time), cmp.Compare(a.seq, b.seq))
+}
+
+// sortedRun 按排序键稳定排序后的一组条目及其排序键
+type sortedRun struct {
+	entries []LogEntry
+	keys    []orderKey
+}
+
+// newSortedRun 按排序键对entries稳定排序，entries已经有序时（通常如此）不重新排列
+func newSortedRun(entries []LogEntry, desc bool) sortedRun {
+	keys := make([]orderKey, len(entries))
+	for i := range entries {
+		keys[i] = entryKey(entries[i])
+	}
+	compare := keyOrder(desc)
+	if slices.IsSortedFunc(keys, compare) {
+		return sortedRun{entries, keys}
+	}
+
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return compare(keys[a], keys[b]) })
+	run := sortedRun{make([]LogEntry, len(entries)), make([]orderKey, len(entries))}
+	for i, j := range order {
+		run.entries[i], run.keys[i] = entries[j], keys[j]
+	}
+	return run
+}
+
+// keyOrder 返回排序键的比较函数，desc为true时晚的在前
+func keyOrder(desc bool) func(a, b orderKey) int {
+	if desc {
+		return func(a, b orderKey) int { return compareKeys(b, a) }
+	}
+	return compareKeys
+}
+
+// mergeByTime 将按文件分组的条目合并为按时间戳和序号排列的结果
+// 每组先稳定排序，再两两归并；排序键相同的条目（如没有序号的旧条目）保持组的顺序和组内的顺序
+func mergeByTime(groups [][]LogEntry, order string) []LogEntry {
+	desc := order == SortDesc
+	runs := make([]sortedRun, 0, len(groups))
+	for _, group := range groups {
+		if len(group) > 0 {
+			runs = append(runs, newSortedRun(group, desc))
+		}
+	}
+	if len(runs) == 0 {
+		return make([]LogEntry, 0)
+	}
+	for len(runs) > 1 {
+		merged := runs[:0]
+		for i := 0; i < len(runs); i += 2 {
+			if i+1 == len(runs) {
+				merged = append(merged, runs[i])
+				break
+			}
+			merged = append(merged, mergeRuns(runs[i], runs[i+1], desc))
+		}
+		runs = merged
+	}
+	return runs[0].entries
+}
+
+// mergeRuns 归并两组有序的条目，排序键相同时a中的条目在前
+func mergeRuns(a, b sortedRun, desc bool) sortedRun {
+	n := len(a.entries) + len(b.entries)
+	out := sortedRun{make([]LogEntry, 0, n), make([]orderKey, 0, n)}
+	compare := keyOrder(desc)
+	i, j := 0, 0
+	for i < len(a.keys) && j < len(b.keys) {
+		if compare(b.keys[j], a.keys[i]) < 0 {
+			out.entries, out.keys = append(out.entries, b.entries[j]), append(out.keys, b.keys[j])
+			j++
+		} else {
+			out.entries, out.keys = append(out.entries, a.entries[i]), append(out.keys, a.keys[i])
+			i++
+		}
+	}
+	out.entries, out.keys = append(out.entries, a.entries[i:]...), append(out.keys, a.keys[i:]...)
+	out.entries, out.keys = append(out.entries, b.entries[j:]...), append(out.keys, b.keys[j:]...)
+	return out
+}
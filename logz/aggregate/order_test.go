@@ -0,0 +1,141 @@
+package aggregate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// messages 返回条目的消息
+func messages(entries []LogEntry) []string {
+	result := make([]string, len(entries))
+	for i, entry := range entries {
+		result[i] = entry.Message
+	}
+	return result
+}
+
+func TestQueryOrderAcrossFiles(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	line := func(second int, msg string) string {
+		return fmt.Sprintf(`{"timestamp":%q,"level":"info","msg":%q,"trace_id":"t1"}`, base.Add(time.Duration(second)*time.Second).Format(time.RFC3339), msg)
+	}
+	// 文件之间和文件内都不按时间顺序写入，new.log修改时间更晚
+	files := map[string][]string{
+		"new.log": {line(3, "3"), line(1, "1"), line(5, "5"), line(2, "2-new")},
+		"old.log": {line(2, "2-old"), line(4, "4"), line(0, "0"), `{"level":"info","msg":"no-time","trace_id":"t1"}`},
+	}
+	for name, lines := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+			t.Fatalf("创建测试日志文件失败: %v", err)
+		}
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "old.log"), old, old); err != nil {
+		t.Fatalf("修改文件时间失败: %v", err)
+	}
+
+	// 时间戳相同的条目按文件修改时间从新到旧排列，无法解析的时间戳视为最早
+	tests := []struct {
+		order string
+		want  []string
+	}{
+		{"", []string{"no-time", "0", "1", "2-new", "2-old", "3", "4", "5"}},
+		{SortAsc, []string{"no-time", "0", "1", "2-new", "2-old", "3", "4", "5"}},
+		{SortDesc, []string{"5", "4", "3", "2-new", "2-old", "1", "0", "no-time"}},
+	}
+	for _, tt := range tests {
+		result, err := QueryLogs(LogQuery{TraceID: "t1", SortOrder: tt.order, Limit: 100}, dir)
+		if err != nil {
+			t.Fatalf("查询失败: %v", err)
+		}
+		if got := messages(result.Entries); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("顺序%q: 期望 %v，得到 %v", tt.order, tt.want, got)
+		}
+
+		// 分页在排序之后
+		page, err := QueryLogs(LogQuery{TraceID: "t1", SortOrder: tt.order, Limit: 3, Offset: 2}, dir)
+		if err != nil {
+			t.Fatalf("查询失败: %v", err)
+		}
+		if got := messages(page.Entries); !reflect.DeepEqual(got, tt.want[2:5]) {
+			t.Errorf("顺序%q: 期望分页结果 %v，得到 %v", tt.order, tt.want[2:5], got)
+		}
+	}
+
+	if _, err := QueryLogs(LogQuery{SortOrder: "newest"}, dir); err == nil {
+		t.Error("期望无效的排列顺序返回错误")
+	}
+}
+
+func TestQueryLogsByTraceIDInRange(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "order", WithBatchSize(1))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+	SetGlobalAggregator(aggregator)
+	defer SetGlobalAggregator(nil)
+
+	// 两个文件中的条目都不按时间顺序写入
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	write := func(seconds ...int) {
+		for _, second := range seconds {
+			entry := LogEntry{
+				Timestamp: base.Add(time.Duration(second) * time.Second).Format(time.RFC3339),
+				Level:     "info",
+				Message:   fmt.Sprint(second),
+				TraceID:   "trace-a",
+			}
+			if err := aggregator.WriteLog(entry); err != nil {
+				t.Fatalf("写入日志失败: %v", err)
+			}
+		}
+	}
+	write(50, 10, 30)
+	if err := aggregator.Rotate(); err != nil {
+		t.Fatalf("轮转文件失败: %v", err)
+	}
+	write(40, 0, 20)
+	if err := aggregator.Flush(); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+
+	result, err := QueryLogsByTraceID("trace-a", dir, 100, 0)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if got, want := messages(result.Entries), []string{"0", "10", "20", "30", "40", "50"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("期望按时间升序 %v，得到 %v", want, got)
+	}
+
+	// 同时指定时间范围时使用trace_time组合索引，并按时间过滤
+	query := TraceQuery("trace-a", base.Add(10*time.Second), base.Add(40*time.Second))
+	query.Limit = 100
+	query.Explain = true
+	result, err = QueryLogs(query, dir)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if got, want := messages(result.Entries), []string{"10", "20", "30", "40"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("期望时间范围内的条目 %v，得到 %v", want, got)
+	}
+	if result.Explain.Strategy != StrategyIndex || !reflect.DeepEqual(result.Explain.IndexBuckets, []string{"trace_time"}) {
+		t.Errorf("期望使用trace_time索引，得到 %+v", result.Explain)
+	}
+
+	// 只限定开始时间，分页
+	result, err = QueryLogsByTraceIDInRange("trace-a", base.Add(25*time.Second), time.Time{}, dir, 2, 1)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if got, want := messages(result.Entries), []string{"40", "50"}; result.Total != 3 || !reflect.DeepEqual(got, want) {
+		t.Errorf("期望共 3 条、返回 %v，得到 %d %v", want, result.Total, got)
+	}
+}
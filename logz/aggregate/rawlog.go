@@ -0,0 +1,216 @@
+package aggregate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz"
+)
+
+// 原始日志文件（InitWithAggregation写入的logrus文件，如./logs/app.log）的解析规则
+// logrus的JSONFormatter和TextFormatter都把Data字段展开在顶层，时间、级别和消息的键也与聚合日志不同，
+// LogQuery.IncludeRawLogs为true时按下面的映射转换为LogEntry
+
+// rawTimeKeys 时间戳的键，按顺序取第一个存在的
+var rawTimeKeys = []string{"time", "ts", "@timestamp", "timestamp"}
+
+// rawLevelKeys 级别的键
+var rawLevelKeys = []string{"level", "lvl", "severity"}
+
+// rawMessageKeys 消息的键
+var rawMessageKeys = []string{"msg", "message"}
+
+// rawEntryKeys 映射到LogEntry字段的键，其他键保存到Fields中
+// logrus启用ReportCaller时调用位置在file（本包的CallerPrettyfier输出"main.go:42"），函数名在func
+var rawEntryKeys = map[string]func(entry *LogEntry, value any){
+	"caller":   func(entry *LogEntry, value any) { entry.Caller = rawString(value) },
+	"file":     func(entry *LogEntry, value any) { entry.Caller = rawString(value) },
+	"trace_id": func(entry *LogEntry, value any) { entry.TraceID = rawString(value) },
+	"span_id":  func(entry *LogEntry, value any) { entry.SpanID = rawString(value) },
+	"service":  func(entry *LogEntry, value any) { entry.Service = rawString(value) },
+	"hostname": func(entry *LogEntry, value any) { entry.Hostname = rawString(value) },
+	"pid": func(entry *LogEntry, value any) {
+		entry.PID, _ = strconv.Atoi(rawString(value))
+	},
+}
+
+// rawTimeLayouts 时间戳的格式，按顺序尝试；没有时区的格式按本地时间解析
+var rawTimeLayouts = []string{
+	time.RFC3339Nano,                          // logrus默认格式和本包设置的RFC3339
+	"2006-01-02T15:04:05.999999999Z0700",      // 时区没有冒号
+	"2006-01-02 15:04:05.999999999Z07:00",     // 日期和时间以空格分隔
+	"2006-01-02 15:04:05.999999999 -0700 MST", // time.Time.String()
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006/01/02 15:04:05.999999999", // 标准库log包
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// rawLevelAliases 级别的别名，包括logrus在终端输出时截断的四个字母的级别；其他写法按NormalizeLevel规范化
+var rawLevelAliases = map[string]string{
+	"trac":     "trace",
+	"debu":     logz.LevelDebug,
+	"dbg":      logz.LevelDebug,
+	"inf":      logz.LevelInfo,
+	"notice":   logz.LevelInfo,
+	"warning":  logz.LevelWarn,
+	"wrn":      logz.LevelWarn,
+	"erro":     logz.LevelError,
+	"err":      logz.LevelError,
+	"eror":     logz.LevelError,
+	"fata":     logz.LevelFatal,
+	"crit":     logz.LevelFatal,
+	"critical": logz.LevelFatal,
+	"pani":     logz.LevelPanic,
+}
+
+// decodeEntryLine 解析一行日志，raw为true时还接受原始的logrus JSON和文本行，converted表示按原始日志转换
+// 聚合日志格式的行总是优先按LogEntry解析，只有缺少timestamp而带有原始时间键的JSON行和不是JSON的行才按原始日志转换
+func decodeEntryLine(line []byte, raw bool) (entry LogEntry, converted bool, err error) {
+	err = json.Unmarshal(line, &entry)
+	if !raw {
+		return entry, false, err
+	}
+	if err == nil {
+		if entry.Timestamp != "" || !hasRawTimeKey(entry.Extra) {
+			return entry, false, nil
+		}
+		var fields map[string]any
+		if err := json.Unmarshal(line, &fields); err != nil {
+			return LogEntry{}, false, err
+		}
+		return rawEntry(fields), true, nil
+	}
+	if line = bytes.TrimSpace(line); len(line) > 0 && line[0] != '{' {
+		if fields, ok := parseLogfmt(line); ok {
+			return rawEntry(fields), true, nil
+		}
+	}
+	return LogEntry{}, false, err
+}
+
+// hasRawTimeKey 检查解析到Extra中的顶层字段是否包含原始日志的时间键
+func hasRawTimeKey(extra map[string]json.RawMessage) bool {
+	for _, key := range rawTimeKeys {
+		if _, ok := extra[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// rawEntry 按映射规则将原始日志的顶层字段转换为LogEntry，时间戳规范化为RFC3339Nano，无法解析时保留原文
+func rawEntry(fields map[string]any) LogEntry {
+	var entry LogEntry
+	if key, ok := firstRawKey(fields, rawTimeKeys); ok {
+		entry.Timestamp = parseRawTime(fields[key])
+		delete(fields, key)
+	}
+	if key, ok := firstRawKey(fields, rawLevelKeys); ok {
+		entry.Level = rawLevel(rawString(fields[key]))
+		delete(fields, key)
+	}
+	if key, ok := firstRawKey(fields, rawMessageKeys); ok {
+		entry.Message = rawString(fields[key])
+		delete(fields, key)
+	}
+	for key, value := range fields {
+		if set, ok := rawEntryKeys[key]; ok {
+			set(&entry, value)
+			delete(fields, key)
+		}
+	}
+	if len(fields) > 0 {
+		entry.Fields = fields
+	}
+	return entry
+}
+
+// firstRawKey 返回keys中第一个在fields中存在的键
+func firstRawKey(fields map[string]any, keys []string) (string, bool) {
+	for _, key := range keys {
+		if _, ok := fields[key]; ok {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// rawString 将字段值转换为字符串，JSON数字不使用科学计数法
+func rawString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// parseRawTime 按rawTimeLayouts解析时间戳，数字按Unix秒解析（如zap的ts），精确到微秒
+func parseRawTime(value any) string {
+	if seconds, ok := value.(float64); ok {
+		return time.UnixMicro(int64(math.Round(seconds * 1e6))).UTC().Format(time.RFC3339Nano)
+	}
+	s := strings.TrimSpace(rawString(value))
+	for _, layout := range rawTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t.Format(time.RFC3339Nano)
+		}
+	}
+	return s
+}
+
+// rawLevel 按rawLevelAliases和NormalizeLevel规范化级别
+func rawLevel(level string) string {
+	level = strings.ToLower(strings.TrimSpace(level))
+	if canonical, ok := rawLevelAliases[level]; ok {
+		return canonical
+	}
+	return canonicalLevel(level)
+}
+
+// parseLogfmt 解析logrus TextFormatter输出的key=value行，值可以是Go语法的带引号字符串
+// 不是key=value格式或没有时间和消息时ok为false
+func parseLogfmt(line []byte) (map[string]any, bool) {
+	fields := make(map[string]any)
+	s := string(line)
+	for s = strings.TrimLeft(s, " \t"); s != ""; s = strings.TrimLeft(s, " \t") {
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || strings.ContainsAny(s[:eq], " \t\"") {
+			return nil, false
+		}
+		key := s[:eq]
+		s = s[eq+1:]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			quoted, err := strconv.QuotedPrefix(s)
+			if err != nil {
+				return nil, false
+			}
+			if value, err = strconv.Unquote(quoted); err != nil {
+				return nil, false
+			}
+			s = s[len(quoted):]
+		} else {
+			end := strings.IndexAny(s, " \t")
+			if end < 0 {
+				end = len(s)
+			}
+			value, s = s[:end], s[end:]
+		}
+		fields[key] = value
+	}
+	_, hasTime := firstRawKey(fields, rawTimeKeys)
+	_, hasMessage := firstRawKey(fields, rawMessageKeys)
+	return fields, hasTime || hasMessage
+}
@@ -0,0 +1,162 @@
+package aggregate
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRawTimeLayouts(t *testing.T) {
+	want := time.Date(2024, 1, 15, 10, 30, 0, 123000000, time.UTC)
+	local := time.Date(2024, 1, 15, 10, 30, 0, 123000000, time.Local)
+	tests := []struct {
+		value any
+		want  time.Time
+	}{
+		{"2024-01-15T10:30:00.123Z", want},
+		{"2024-01-15T18:30:00.123+08:00", want},
+		{"2024-01-15T10:30:00.123+0000", want},
+		{"2024-01-15 10:30:00.123Z", want},
+		{"2024-01-15 10:30:00.123 +0000 UTC", want},
+		{"2024-01-15T10:30:00.123", local},
+		{"2024-01-15 10:30:00.123", local},
+		{"2024/01/15 10:30:00.123", local},
+		{float64(want.UnixMilli()) / 1000, want},
+	}
+	for _, tt := range tests {
+		got, err := time.Parse(time.RFC3339Nano, parseRawTime(tt.value))
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("%v: 期望 %v，得到 %v %v", tt.value, tt.want, got, err)
+		}
+	}
+	if got := parseRawTime("yesterday"); got != "yesterday" {
+		t.Errorf("期望无法解析的时间保留原文，得到 %q", got)
+	}
+}
+
+func TestRawLevelAliases(t *testing.T) {
+	tests := map[string]string{
+		"info": "info", "INFO": "info", "warning": "warn", "WARN": "warn", "erro": "error", "err": "error",
+		"debu": "debug", "trac": "trace", "fata": "fatal", "critical": "fatal", "pani": "panic", "notice": "info",
+		"custom": "custom",
+	}
+	for level, want := range tests {
+		if got := rawLevel(level); got != want {
+			t.Errorf("%s: 期望 %s，得到 %s", level, want, got)
+		}
+	}
+}
+
+// writeLogrusFixture 用与本包相同的logrus格式配置写入几条日志
+func writeLogrusFixture(t *testing.T, path string, formatter logrus.Formatter) {
+	t.Helper()
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(formatter)
+	logger.SetReportCaller(true)
+	logger.SetLevel(logrus.DebugLevel)
+
+	base := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	logger.WithTime(base).WithFields(logrus.Fields{"trace_id": "raw-trace", "span_id": "s1", "user": "alice"}).Info("request started")
+	logger.WithTime(base.Add(time.Second)).WithFields(logrus.Fields{"trace_id": "raw-trace", "attempt": 2}).Warn(`retry "upstream" failed`)
+	logger.WithTime(base.Add(2 * time.Second)).Debug("tick")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+}
+
+func TestQueryRawLogrusFiles(t *testing.T) {
+	prettyfier := func(f *runtime.Frame) (string, string) {
+		return "", filepath.Base(f.File) + ":1"
+	}
+	for _, tt := range []struct {
+		name      string
+		formatter logrus.Formatter
+		attempt   any
+	}{
+		{"JSON", &logrus.JSONFormatter{TimestampFormat: time.RFC3339, CallerPrettyfier: prettyfier}, float64(2)},
+		{"Text", &logrus.TextFormatter{FullTimestamp: true, DisableColors: true, TimestampFormat: time.RFC3339, CallerPrettyfier: prettyfier}, "2"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeLogrusFixture(t, filepath.Join(dir, "app.log"), tt.formatter)
+			aggregated := `{"timestamp":"2024-01-15T10:30:01.500Z","level":"error","msg":"aggregated","trace_id":"raw-trace","service":"svc","seq":1}` + "\n"
+			if err := os.WriteFile(filepath.Join(dir, "svc_2024-01-15_001.log"), []byte(aggregated), 0644); err != nil {
+				t.Fatalf("写入文件失败: %v", err)
+			}
+
+			result, err := QueryLogs(LogQuery{TraceID: "raw-trace", SortOrder: SortAsc, Limit: 10, IncludeRawLogs: true, Strict: true}, dir)
+			if err != nil {
+				t.Fatalf("查询失败: %v", err)
+			}
+			if len(result.Entries) != 3 {
+				t.Fatalf("期望原始日志和聚合日志共3条，得到 %+v", result.Entries)
+			}
+			first, second, third := result.Entries[0], result.Entries[1], result.Entries[2]
+			if first.Message != "request started" || first.Level != "info" || first.SpanID != "s1" || first.Caller != "rawlog_test.go:1" ||
+				first.Fields["user"] != "alice" || first.Timestamp != "2024-01-15T10:30:00Z" {
+				t.Errorf("期望按映射规则转换第一条，得到 %+v", first)
+			}
+			if second.Message != `retry "upstream" failed` || second.Level != "warn" || second.Fields["attempt"] != tt.attempt || third.Message != "aggregated" {
+				t.Errorf("期望按时间与聚合日志合并，得到 %+v %+v", second, third)
+			}
+
+			// 时间范围和级别条件同样适用于原始日志
+			result, err = QueryLogs(LogQuery{Level: "debug", StartTime: time.Date(2024, 1, 15, 10, 30, 2, 0, time.UTC), Limit: 10, IncludeRawLogs: true}, dir)
+			if err != nil || len(result.Entries) != 1 || result.Entries[0].Message != "tick" {
+				t.Errorf("期望按时间和级别过滤原始日志，得到 %+v %v", result, err)
+			}
+
+			// 未开启时保持原来的行为：JSON行没有时间戳，文本行无法解析
+			result, err = QueryLogs(LogQuery{Limit: 10}, dir)
+			if err != nil {
+				t.Fatalf("查询失败: %v", err)
+			}
+			if tt.name == "Text" && (len(result.Entries) != 1 || result.ParseErrors["app.log"] != 3) {
+				t.Errorf("期望不解析文本格式的原始日志，得到 %d 条、%v", len(result.Entries), result.ParseErrors)
+			}
+		})
+	}
+}
+
+func TestParseLogfmtRejectsOtherText(t *testing.T) {
+	for _, line := range []string{"plain text line", "key=value without time", `time="unterminated`, "=value msg=x"} {
+		if _, _, err := decodeEntryLine([]byte(line), true); err == nil {
+			t.Errorf("期望拒绝 %q", line)
+		}
+	}
+	entry, converted, err := decodeEntryLine([]byte(`time="2024-01-15T10:30:00Z" level=warning msg="a \"b\"\tc" pid=42 empty=`), true)
+	if err != nil || !converted || entry.Message != "a \"b\"\tc" || entry.Level != "warn" || entry.PID != 42 || entry.Fields["empty"] != "" {
+		t.Errorf("期望解析带转义的值，得到 %+v %v", entry, err)
+	}
+}
+
+func TestLogWatcherRawLogs(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	appendLines(t, path)
+	watcher, err := NewLogWatcher(dir, WithPollingOnly(), WithWatchInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("创建LogWatcher失败: %v", err)
+	}
+	defer watcher.Close()
+	raw := watcher.Subscribe(LogQuery{IncludeRawLogs: true})
+	native := watcher.Subscribe(LogQuery{})
+
+	appendLines(t, path,
+		`time="2024-01-15T10:30:00Z" level=info msg="raw text"`,
+		`{"time":"2024-01-15T10:30:01Z","level":"info","msg":"raw json"}`,
+		`{"timestamp":"2024-01-15T10:30:02Z","level":"info","msg":"native"}`)
+	if got := receiveMessages(t, raw, 3); got[0] != "raw text" || got[1] != "raw json" || got[2] != "native" {
+		t.Errorf("期望收到原始日志和聚合日志，得到 %v", got)
+	}
+	if got := receiveMessages(t, native, 1); got[0] != "native" {
+		t.Errorf("期望未开启IncludeRawLogs的订阅者只收到聚合日志，得到 %v", got)
+	}
+}
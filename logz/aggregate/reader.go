@@ -0,0 +1,87 @@
+package aggregate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// readerName QueryReader在ParseErrors和*ParseError中使用的名称
+const readerName = "-"
+
+// QueryReader 使用与目录查询相同的匹配逻辑查询r中的日志，gzip压缩的内容按前两个字节自动解压
+// 无法解析的行数记录在ParseErrors["-"]中，严格模式下返回*ParseError
+func QueryReader(ctx context.Context, r io.Reader, query LogQuery) (*LogQueryResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	reader, err := detectGzip(r)
+	if err != nil {
+		return nil, err
+	}
+	result := &LogQueryResult{
+		Limit:  query.Limit,
+		Offset: query.Offset,
+	}
+	stats := newQueryStats(query)
+	stats.considered(1)
+	stats.opened()
+	start := stats.phaseStart()
+	entries, malformed, err := scanEntries(ctx, reader, readerName, query, stats)
+	stats.phaseEnd("scan", start)
+	if err != nil {
+		var parseErr *ParseError
+		switch {
+		case errors.As(err, &parseErr):
+			return nil, err
+		case ctx.Err() == nil:
+			return nil, fmt.Errorf("读取日志失败: %w", err)
+		case !query.AllowPartial:
+			return nil, ctx.Err()
+		}
+		result.Truncated = true
+	}
+	if malformed > 0 {
+		result.ParseErrors = map[string]int{readerName: malformed}
+	}
+	result.Entries = mergeByTime([][]LogEntry{entries}, query.sortOrder())
+	paginate(result, query)
+	stats.finish(result)
+	return result, nil
+}
+
+// QueryFiles 使用与目录查询相同的匹配逻辑按顺序查询paths中的日志文件，
+// gzip压缩的文件按内容自动解压，不依赖.gz扩展名
+// ParseErrors以传入的路径为键；文件不存在时返回错误，读取中途出错的文件与目录查询一样记录在ReadErrors中
+func QueryFiles(ctx context.Context, paths []string, query LogQuery) (*LogQueryResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+	}
+
+	stats := newQueryStats(query)
+	stats.considered(len(paths))
+	start := stats.phaseStart()
+	result, err := scanLogFiles(ctx, query, paths, openLogDetect, func(path string) string {
+		return path
+	}, stats)
+	if err != nil {
+		return nil, err
+	}
+	stats.phaseEnd("scan", start)
+	stats.finish(result)
+	return result, nil
+}
@@ -0,0 +1,106 @@
+package aggregate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readerLogs 两条有效日志和一行无效日志
+const readerLogs = `{"timestamp":"2024-01-15T10:00:00Z","level":"error","service":"checkout","trace_id":"trace-1","message":"payment failed"}
+not json
+{"timestamp":"2024-01-15T10:00:01Z","level":"info","service":"checkout","trace_id":"trace-2","message":"order created"}
+`
+
+func gzipBytes(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatalf("压缩失败: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("压缩失败: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestQueryReader(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"plain": []byte(readerLogs),
+		"gzip":  gzipBytes(t, readerLogs),
+	} {
+		t.Run(name, func(t *testing.T) {
+			result, err := QueryReader(context.Background(), bytes.NewReader(data), LogQuery{Level: "error", Limit: 10})
+			if err != nil {
+				t.Fatalf("查询失败: %v", err)
+			}
+			if result.Total != 1 || result.Entries[0].TraceID != "trace-1" {
+				t.Errorf("期望匹配1条error日志，得到 %+v", result)
+			}
+			if result.ParseErrors[readerName] != 1 {
+				t.Errorf("期望记录1行无效日志，得到 %v", result.ParseErrors)
+			}
+		})
+	}
+
+	_, err := QueryReader(context.Background(), strings.NewReader(readerLogs), LogQuery{Strict: true, Limit: 10})
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.File != readerName || parseErr.Line != 2 {
+		t.Errorf("期望严格模式返回第2行的ParseError，得到 %v", err)
+	}
+
+	// 超过长度限制的行与目录查询一样被跳过并计入无效行，严格模式下返回ParseError
+	SetMaxLineSize(64 * 1024)
+	defer SetMaxLineSize(0)
+	long := strings.Repeat("x", 128*1024) + "\n" + readerLogs
+	result, err := QueryReader(context.Background(), strings.NewReader(long), LogQuery{Limit: 10})
+	if err != nil || result.Total != 2 || result.ParseErrors[readerName] != 2 {
+		t.Errorf("期望跳过超长行，得到 %+v %v", result, err)
+	}
+	_, err = QueryReader(context.Background(), strings.NewReader(long), LogQuery{Strict: true, Limit: 10})
+	if !errors.As(err, &parseErr) || parseErr.Line != 1 || !errors.Is(err, ErrLineTooLong) {
+		t.Errorf("期望严格模式返回第1行的ErrLineTooLong，得到 %v", err)
+	}
+
+	result, err = QueryReader(context.Background(), strings.NewReader(""), LogQuery{Limit: 10})
+	if err != nil || result.Total != 0 || result.Entries == nil {
+		t.Errorf("期望空输入返回空结果，得到 %+v %v", result, err)
+	}
+}
+
+func TestQueryFiles(t *testing.T) {
+	dir := t.TempDir()
+	// 压缩文件没有.gz扩展名，按内容识别
+	gzPath := filepath.Join(dir, "customer.log")
+	if err := os.WriteFile(gzPath, gzipBytes(t, readerLogs), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	plainPath := filepath.Join(dir, "other.txt")
+	if err := os.WriteFile(plainPath, []byte(readerLogs), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+
+	result, err := QueryFiles(context.Background(), []string{gzPath, plainPath}, LogQuery{TraceID: "trace-2", Limit: 10})
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if result.Total != 2 {
+		t.Errorf("期望两个文件各匹配1条，得到 %+v", result)
+	}
+	if result.ParseErrors[gzPath] != 1 || result.ParseErrors[plainPath] != 1 {
+		t.Errorf("期望按传入路径记录无效行，得到 %v", result.ParseErrors)
+	}
+
+	if _, err := QueryFiles(context.Background(), []string{filepath.Join(dir, "missing.log")}, LogQuery{Limit: 10}); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("期望文件不存在时返回错误，得到 %v", err)
+	}
+	if _, err := QueryFiles(context.Background(), []string{gzPath}, LogQuery{Level: "verbose"}); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("期望返回ErrInvalidQuery，得到 %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package aggregate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// EntryRef 日志条目在日志目录中的位置，LogQuery.Refs为true时查询结果中返回，用于缓存查询结果后按页读取
+type EntryRef struct {
+	File   string `json:"file"`   // 相对于日志目录的路径，压缩文件为.gz文件的路径
+	Offset int64  `json:"offset"` // 行的起始位置，压缩文件为解压后的位置
+}
+
+// sourceDir Sources中日志目录本身的键，目录中增删文件时修改时间变化
+const sourceDir = "."
+
+// entryRefs 返回条目的位置，扫描文件时记录的位置优先，其次为聚合器写入的文件ID和偏移量
+// 有条目没有位置时（如QueryReader、内存聚合器）返回nil
+func entryRefs(entries []LogEntry) []EntryRef {
+	refs := make([]EntryRef, len(entries))
+	for i, entry := range entries {
+		switch {
+		case entry.ref.File != "":
+			refs[i] = entry.ref
+		case entry.FileID != "":
+			refs[i] = EntryRef{File: entry.FileID + ".log", Offset: entry.Offset}
+		default:
+			return nil
+		}
+	}
+	return refs
+}
+
+// sourceModTimes 返回日志目录和files（相对于logDir的路径）的修改时间，无法访问的文件不在结果中
+func sourceModTimes(logDir string, files []string) map[string]time.Time {
+	sources := make(map[string]time.Time, len(files)+1)
+	if stat, err := os.Stat(logDir); err == nil {
+		sources[sourceDir] = stat.ModTime()
+	}
+	addSourceModTimes(sources, logDir, files)
+	return sources
+}
+
+// addSourceModTimes 将sources中还没有的文件的修改时间加入sources
+func addSourceModTimes(sources map[string]time.Time, logDir string, files []string) {
+	for _, file := range files {
+		if _, ok := sources[file]; ok {
+			continue
+		}
+		if stat, err := os.Stat(filepath.Join(logDir, file)); err == nil {
+			sources[file] = stat.ModTime()
+		}
+	}
+}
+
+// refFiles 返回refs中出现的文件，按首次出现的顺序排列
+func refFiles(refs []EntryRef) []string {
+	seen := make(map[string]bool)
+	var files []string
+	for _, ref := range refs {
+		if !seen[ref.File] {
+			seen[ref.File] = true
+			files = append(files, ref.File)
+		}
+	}
+	return files
+}
+
+// SourcesChanged 检查查询结果读取的文件自查询以来是否被修改、删除或新增（日志目录的修改时间变化）
+// sources为LogQueryResult.Sources，返回第一个变化的文件
+func SourcesChanged(logDir string, sources map[string]time.Time) (string, bool) {
+	for file, modTime := range sources {
+		stat, err := os.Stat(filepath.Join(logDir, file))
+		if err != nil || !stat.ModTime().Equal(modTime) {
+			return file, true
+		}
+	}
+	return "", false
+}
+
+// ReadRefsPage 按位置读取refs中[offset, offset+limit)的条目，返回与查询相同格式的结果，Total为len(refs)
+// 只打开该页条目所在的文件，每个文件打开一次；explain为true时结果中的执行策略为StrategyCache
+func ReadRefsPage(ctx context.Context, logDir string, refs []EntryRef, offset, limit int, explain bool) (*LogQueryResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	stats := newQueryStats(LogQuery{Explain: explain})
+	if stats != nil {
+		stats.explain.Strategy = StrategyCache
+	}
+	result := &LogQueryResult{Entries: make([]LogEntry, 0), Total: len(refs), Limit: limit, Offset: offset}
+	if offset >= len(refs) {
+		stats.finish(result)
+		return result, nil
+	}
+	page := refs[offset:min(offset+limit, len(refs))]
+
+	start := stats.phaseStart()
+	files := refFiles(page)
+	stats.considered(len(files))
+	byFile := make(map[string][]int64, len(files))
+	for _, ref := range page {
+		byFile[ref.File] = append(byFile[ref.File], ref.Offset)
+	}
+	entries := make(map[EntryRef]LogEntry, len(page))
+	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		offsets := byFile[file]
+		sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+		path := filepath.Join(logDir, file)
+		read := readLogEntries
+		if strings.HasSuffix(file, ".gz") {
+			read = readCompressedLogEntries
+		}
+		fileEntries, err := read(path, offsets)
+		if err != nil {
+			return nil, err
+		}
+		stats.opened()
+		stats.scanned(len(fileEntries))
+		for i, entry := range fileEntries {
+			entries[EntryRef{File: file, Offset: offsets[i]}] = entry
+		}
+	}
+	for _, ref := range page {
+		result.Entries = append(result.Entries, entries[ref])
+	}
+	stats.phaseEnd("read_refs", start)
+	stats.finish(result)
+	return result, nil
+}
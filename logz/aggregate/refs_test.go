@@ -0,0 +1,118 @@
+package aggregate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadRefsPage(t *testing.T) {
+	dir := t.TempDir()
+	plain := `{"timestamp":"2024-01-15T10:00:00Z","level":"info","msg":"m0"}` + "\r\n" +
+		"not json\n" +
+		`{"timestamp":"2024-01-15T10:02:00Z","level":"info","msg":"m2"}` + "\n" +
+		`{"timestamp":"2024-01-15T10:04:00Z","level":"info","msg":"m4"}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "a.log"), []byte(plain), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(`{"timestamp":"2024-01-15T10:01:00Z","level":"info","msg":"m1"}` + "\n" +
+		`{"timestamp":"2024-01-15T10:03:00Z","level":"info","msg":"m3"}` + "\n" +
+		`{"timestamp":"2024-01-15T10:05:00Z","level":"info","msg":"m5"}` + "\n"))
+	gz.Close()
+	if err := os.WriteFile(filepath.Join(dir, "b.log.gz"), buf.Bytes(), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+
+	query := LogQuery{Limit: 2, Refs: true, PathPatterns: []string{"*.log", "*.log.gz"}}
+	result, err := QueryLogs(query, dir)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if len(result.Refs) != 6 || len(result.Entries) != 2 {
+		t.Fatalf("期望 6 个位置和 2 条结果，得到 %+v", result)
+	}
+	for _, file := range []string{sourceDir, "a.log", "b.log.gz"} {
+		if _, ok := result.Sources[file]; !ok {
+			t.Errorf("期望Sources中有 %s，得到 %v", file, result.Sources)
+		}
+	}
+
+	// 每页的条目与重新查询的结果相同
+	messages := func(entries []LogEntry) []string {
+		var out []string
+		for _, entry := range entries {
+			out = append(out, entry.Message)
+		}
+		return out
+	}
+	for offset := 0; offset < 6; offset += 2 {
+		page, err := ReadRefsPage(context.Background(), dir, result.Refs, offset, 2, true)
+		if err != nil {
+			t.Fatalf("读取第 %d 条起的一页失败: %v", offset, err)
+		}
+		query.Offset = offset
+		want, _ := QueryLogs(query, dir)
+		if !reflect.DeepEqual(messages(page.Entries), messages(want.Entries)) || page.Total != 6 {
+			t.Errorf("期望 %v，得到 %v（共 %d 条）", messages(want.Entries), messages(page.Entries), page.Total)
+		}
+		if page.Explain.Strategy != StrategyCache || page.Explain.FilesOpened != 2 {
+			t.Errorf("期望从缓存读取两个文件，得到 %+v", page.Explain)
+		}
+	}
+	page, err := ReadRefsPage(context.Background(), dir, result.Refs, 2, 1, true)
+	if err != nil || messages(page.Entries)[0] != "m2" || page.Explain.FilesOpened != 1 {
+		t.Errorf("期望只打开条目所在的文件，得到 %+v %v", page, err)
+	}
+
+	if file, changed := SourcesChanged(dir, result.Sources); changed {
+		t.Errorf("期望文件未变化，得到 %s", file)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(dir, "a.log"), later, later); err != nil {
+		t.Fatalf("修改文件时间失败: %v", err)
+	}
+	if file, changed := SourcesChanged(dir, result.Sources); !changed || file != "a.log" {
+		t.Errorf("期望 a.log 已变化，得到 %s %v", file, changed)
+	}
+}
+
+func TestQueryRefsWithIndex(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "svc")
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+	for _, message := range []string{"first", "other", "second"} {
+		traceID := "trace-refs"
+		if message == "other" {
+			traceID = "trace-other"
+		}
+		if err := aggregator.WriteLog(LogEntry{Level: "info", Message: message, TraceID: traceID}); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+	}
+
+	result, err := aggregator.Query(context.Background(), LogQuery{TraceID: "trace-refs", UseIndex: true, Limit: 1, Refs: true})
+	if err != nil || len(result.Refs) != 2 {
+		t.Fatalf("期望 2 个位置，得到 %+v %v", result, err)
+	}
+	current := aggregator.output.fileID + ".log"
+	if result.Refs[0].File != current {
+		t.Errorf("期望位置指向 %s，得到 %+v", current, result.Refs[0])
+	}
+	if _, ok := result.Sources[current]; !ok {
+		t.Errorf("期望Sources中有当前文件，得到 %v", result.Sources)
+	}
+	page, err := ReadRefsPage(context.Background(), dir, result.Refs, 1, 1, false)
+	if err != nil || len(page.Entries) != 1 || page.Entries[0].Message != "second" {
+		t.Errorf("期望读取到 second，得到 %+v %v", page, err)
+	}
+}
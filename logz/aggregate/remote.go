@@ -0,0 +1,190 @@
+package aggregate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/HsiaoL1/trace"
+)
+
+// remoteStoreTimeout RemoteStore查询和统计请求的超时时间，日志流不受此限制
+const remoteStoreTimeout = 30 * time.Second
+
+// RemoteStore 通过HTTP访问logz web服务的LogStore
+type RemoteStore struct {
+	baseURL string
+	apiKey  string
+	client  *trace.TracedHTTPClient // 查询和统计
+	stream  *trace.TracedHTTPClient // 日志流，连接时间由ctx控制
+}
+
+// NewRemoteStore 创建访问logz web服务的LogStore，baseURL如"http://localhost:8080"
+// apiKey为空时不发送密钥，否则需要具有read权限
+func NewRemoteStore(baseURL, apiKey string) *RemoteStore {
+	return &RemoteStore{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  trace.NewTracedHTTPClient(remoteStoreTimeout),
+		stream:  trace.NewTracedHTTPClient(0),
+	}
+}
+
+// remoteResponse web服务的标准响应格式
+type remoteResponse struct {
+	Success   bool            `json:"success"`
+	Data      json.RawMessage `json:"data"`
+	Error     string          `json:"error"`
+	ErrorCode string          `json:"error_code"`
+}
+
+// Query 通过/api/v1/logs/search查询日志
+// 查询条件中的文件匹配模式由服务端决定，不会发送
+func (s *RemoteStore) Query(ctx context.Context, query LogQuery) (*LogQueryResult, error) {
+	query.PathPatterns = nil
+	query.Recursive = false
+	body, err := json.Marshal(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var data struct {
+		Result *LogQueryResult `json:"result"`
+	}
+	if err := s.do(ctx, http.MethodPost, "/api/v1/logs/search", body, &data); err != nil {
+		return nil, err
+	}
+	if data.Result == nil {
+		return nil, fmt.Errorf("远程日志服务返回的查询结果为空")
+	}
+	return data.Result, nil
+}
+
+// Stats 通过/api/v1/stats获取统计信息
+func (s *RemoteStore) Stats(ctx context.Context) (*LogStats, error) {
+	var stats LogStats
+	if err := s.do(ctx, http.MethodGet, "/api/v1/stats", nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// Tail 通过/api/logs/stream（SSE）跟踪新写入的日志，连接断开时关闭channel
+func (s *RemoteStore) Tail(ctx context.Context, query LogQuery) (<-chan LogEntry, error) {
+	params := url.Values{}
+	for key, value := range map[string]string{
+		"level":    query.Level,
+		"service":  query.Service,
+		"hostname": query.Hostname,
+		"trace_id": query.TraceID,
+		"span_id":  query.SpanID,
+		"message":  query.Message,
+	} {
+		if value != "" {
+			params.Set(key, value)
+		}
+	}
+
+	req, err := s.newRequest(ctx, http.MethodGet, "/api/logs/stream?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := s.stream.Do(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("连接远程日志流失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, remoteError(resp)
+	}
+
+	entries := make(chan LogEntry)
+	go func() {
+		defer close(entries)
+		defer resp.Body.Close()
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 10<<20)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var event struct {
+				Type  string    `json:"type"`
+				Entry *LogEntry `json:"entry"`
+			}
+			if json.Unmarshal([]byte(data), &event) != nil || event.Type != "log" || event.Entry == nil {
+				continue
+			}
+			select {
+			case entries <- *event.Entry:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return entries, nil
+}
+
+// do 发送请求并将响应中的data解析到out
+func (s *RemoteStore) do(ctx context.Context, method, path string, body []byte, out any) error {
+	req, err := s.newRequest(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Do(ctx, req)
+	if err != nil {
+		return fmt.Errorf("请求远程日志服务失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return remoteError(resp)
+	}
+
+	var response remoteResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("解析远程日志服务响应失败: %w", err)
+	}
+	if !response.Success {
+		return fmt.Errorf("远程日志服务返回错误: %s", response.Error)
+	}
+	if err := json.Unmarshal(response.Data, out); err != nil {
+		return fmt.Errorf("解析远程日志服务响应失败: %w", err)
+	}
+	return nil
+}
+
+// newRequest 创建请求并设置API密钥
+func (s *RemoteStore) newRequest(ctx context.Context, method, path string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+	return req, nil
+}
+
+// remoteError 将非200响应转换为错误，优先使用响应中的错误信息，响应中的error_code还原为对应的错误
+func remoteError(resp *http.Response) error {
+	var response remoteResponse
+	if json.NewDecoder(resp.Body).Decode(&response) == nil && response.Error != "" {
+		if target := errorForCode(response.ErrorCode); target != nil {
+			return fmt.Errorf("远程日志服务返回 %d: %s: %w", resp.StatusCode, response.Error, target)
+		}
+		return fmt.Errorf("远程日志服务返回 %d: %s", resp.StatusCode, response.Error)
+	}
+	return fmt.Errorf("远程日志服务返回 %d", resp.StatusCode)
+}
@@ -0,0 +1,168 @@
+package aggregate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz"
+)
+
+// RetentionPolicy 按日志级别设置聚合文件的保留天数
+// Levels中的级别写入单独的文件集合（{service}_{level}_{date}_{seq}.log），按各自的天数清理；
+// 其他级别写入默认文件集合（{service}_{date}_{seq}.log），保留Default天
+type RetentionPolicy struct {
+	Default int            // 默认保留天数
+	Levels  map[string]int // 日志级别 -> 保留天数，级别支持别名（如warning、err）
+}
+
+// days 返回指定级别的文件保留天数，级别为空表示默认文件集合
+func (p RetentionPolicy) days(level string) int {
+	if days, ok := p.Levels[level]; ok {
+		return days
+	}
+	return p.Default
+}
+
+// normalizeRetentionLevels 规范化保留策略中的级别，天数小于minDays或级别重复时返回错误
+func normalizeRetentionLevels(levels map[string]int, minDays int) (map[string]int, error) {
+	if len(levels) == 0 {
+		return nil, nil
+	}
+	normalized := make(map[string]int, len(levels))
+	for level, days := range levels {
+		canonical, err := logz.NormalizeLevel(level)
+		if err != nil {
+			return nil, err
+		}
+		if days < minDays {
+			return nil, fmt.Errorf("级别%s的保留天数不能小于%d: %d", level, minDays, days)
+		}
+		if _, ok := normalized[canonical]; ok {
+			return nil, fmt.Errorf("级别%s重复配置保留天数", canonical)
+		}
+		normalized[canonical] = days
+	}
+	return normalized, nil
+}
+
+// fileLevel 返回按级别拆分的聚合文件的级别，默认文件集合的文件返回空
+// service为空时（未知服务名）从文件ID末尾解析{level}_{date}_{seq}
+func fileLevel(fileID, service string) string {
+	var parts []string
+	if service != "" {
+		rest, ok := strings.CutPrefix(fileID, service+"_")
+		if !ok {
+			return ""
+		}
+		parts = strings.Split(rest, "_")
+		if len(parts) != 3 {
+			return ""
+		}
+	} else {
+		parts = strings.Split(fileID, "_")
+		if len(parts) < 4 {
+			return ""
+		}
+		parts = parts[len(parts)-3:]
+	}
+
+	if _, err := time.Parse("2006-01-02", parts[1]); err != nil {
+		return ""
+	}
+	if level := parts[0]; canonicalLevel(level) == level {
+		if _, err := logz.NormalizeLevel(level); err == nil {
+			return level
+		}
+	}
+	return ""
+}
+
+// CleanupWithPolicy 按级别保留策略清理日志目录中的旧日志文件（包括已压缩的.log.gz文件）
+// 文件的级别从文件名中解析，不是按级别拆分的文件使用policy.Default；dryRun为true时只统计不删除
+// 保留策略无效时返回*QueryError（ErrInvalidQuery），日志目录不存在时返回ErrLogDirNotFound
+func CleanupWithPolicy(logDir string, policy RetentionPolicy, dryRun bool) (*CleanupReport, error) {
+	if policy.Default < 0 {
+		return nil, &QueryError{Field: "retention_days", Err: fmt.Errorf("保留天数不能为负数: %d", policy.Default)}
+	}
+	levels, err := normalizeRetentionLevels(policy.Levels, 0)
+	if err != nil {
+		return nil, &QueryError{Field: "levels", Err: err}
+	}
+	policy.Levels = levels
+	if err := checkLogDir(logDir); err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, pattern := range []string{"*.log", "*.log.gz"} {
+		matches, err := filepath.Glob(filepath.Join(logDir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+
+	// 同一目录下的全局聚合器需要同步清理索引，并跳过正在写入的文件
+	aggregator := GetGlobalAggregator()
+	if aggregator != nil && !aggregator.ownsDir(logDir) {
+		aggregator = nil
+	}
+	var current map[string]bool
+	if aggregator != nil {
+		current = aggregator.currentFileIDs()
+	}
+
+	report, deletedIDs := removeExpiredFiles(files, func(fileID string) int {
+		return policy.days(fileLevel(fileID, ""))
+	}, current, dryRun)
+
+	// 清理指向已删除文件的索引
+	if aggregator != nil && len(deletedIDs) > 0 {
+		removed, err := aggregator.removeIndexPostings(deletedIDs, dryRun)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("清理索引失败: %w", err))
+		}
+		report.IndexPostingsRemoved = removed
+	}
+
+	return report, nil
+}
+
+// removeExpiredFiles 删除修改时间早于保留期的文件，跳过current中的文件ID
+// 返回清理结果和被删除（dryRun时为将被删除）的文件ID
+func removeExpiredFiles(files []string, retentionDays func(fileID string) int, current map[string]bool, dryRun bool) (*CleanupReport, map[string]bool) {
+	now := time.Now()
+	report := &CleanupReport{DryRun: dryRun, Files: make([]string, 0)}
+	deletedIDs := make(map[string]bool)
+	for _, file := range files {
+		fileID := fileIDFromPath(file)
+		if current[fileID] {
+			continue
+		}
+
+		stat, err := os.Stat(file)
+		if err != nil {
+			report.Errors = append(report.Errors, err)
+			continue
+		}
+		if !stat.ModTime().Before(now.AddDate(0, 0, -retentionDays(fileID))) {
+			continue
+		}
+
+		if !dryRun {
+			if err := os.Remove(file); err != nil {
+				report.Errors = append(report.Errors, fmt.Errorf("删除文件%s失败: %w", filepath.Base(file), err))
+				continue
+			}
+		}
+
+		report.FilesDeleted++
+		report.BytesFreed += stat.Size()
+		report.Files = append(report.Files, filepath.Base(file))
+		deletedIDs[fileID] = true
+	}
+	return report, deletedIDs
+}
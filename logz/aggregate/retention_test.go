@@ -0,0 +1,234 @@
+package aggregate
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// agedFile 创建修改时间为days天前的日志文件
+func agedFile(t *testing.T, dir, name string, days int) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(`{"level":"info","message":"old"}`+"\n"), 0644); err != nil {
+		t.Fatalf("创建文件失败: %v", err)
+	}
+	modTime := time.Now().AddDate(0, 0, -days)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("修改文件时间失败: %v", err)
+	}
+}
+
+// remainingFiles 返回目录中的日志文件名
+func remainingFiles(t *testing.T, dir string) map[string]bool {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("读取目录失败: %v", err)
+	}
+	names := make(map[string]bool)
+	for _, entry := range entries {
+		if strings.Contains(entry.Name(), ".log") {
+			names[entry.Name()] = true
+		}
+	}
+	return names
+}
+
+func TestRetentionPolicyRoutesLevels(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "svc", WithBatchSize(10), WithRetentionPolicy(RetentionPolicy{
+		Default: 7,
+		Levels:  map[string]int{"DEBUG": 1, "err": 30},
+	}))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+	SetGlobalAggregator(aggregator)
+	defer SetGlobalAggregator(nil)
+
+	for _, level := range []string{"debug", "info", "error", "warning", "debug"} {
+		if err := aggregator.WriteLog(LogEntry{Level: level, Message: level, TraceID: "trace-1", Service: "svc"}); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+	}
+	if err := aggregator.Flush(); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+
+	date := time.Now().Format("2006-01-02")
+	for name, want := range map[string]int{
+		"svc_" + date + "_001.log":       2, // info、warn
+		"svc_debug_" + date + "_001.log": 2,
+		"svc_error_" + date + "_001.log": 1,
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("读取%s失败: %v", name, err)
+		}
+		if got := strings.Count(string(data), "\n"); got != want {
+			t.Errorf("期望%s中有 %d 条，得到 %d", name, want, got)
+		}
+	}
+
+	info, err := aggregator.Describe()
+	if err != nil {
+		t.Fatalf("获取聚合器信息失败: %v", err)
+	}
+	if info.LevelFiles["debug"] != "svc_debug_"+date+"_001" || info.LevelFiles["error"] != "svc_error_"+date+"_001" {
+		t.Errorf("级别文件错误: %v", info.LevelFiles)
+	}
+	if info.RetentionDays != 7 || info.LevelRetentionDays["debug"] != 1 || info.LevelRetentionDays["error"] != 30 {
+		t.Errorf("保留策略错误: %d %v", info.RetentionDays, info.LevelRetentionDays)
+	}
+	current := 0
+	for _, file := range info.Files {
+		if file.Current {
+			current++
+		}
+	}
+	if current != 3 {
+		t.Errorf("期望 3 个正在写入的文件，得到 %d", current)
+	}
+
+	// 查询覆盖所有级别的文件
+	waitIndexed(t, aggregator)
+	for _, useIndex := range []bool{false, true} {
+		result, err := QueryLogs(LogQuery{TraceID: "trace-1", UseIndex: useIndex, Limit: 100}, dir)
+		if err != nil {
+			t.Fatalf("查询失败: %v", err)
+		}
+		if result.Total != 5 {
+			t.Errorf("UseIndex=%v: 期望查询到 5 条，得到 %d", useIndex, result.Total)
+		}
+		for _, entry := range result.Entries {
+			got, err := readLogEntry(filepath.Join(dir, entry.FileID+".log"), entry.Offset)
+			if err != nil || got.Message != entry.Message {
+				t.Errorf("条目位置错误: %s:%d %v", entry.FileID, entry.Offset, err)
+			}
+		}
+	}
+}
+
+func TestRetentionPolicySelectiveCleanup(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "svc", WithRetentionPolicy(RetentionPolicy{
+		Default: 7,
+		Levels:  map[string]int{"debug": 1, "error": 30},
+	}))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+
+	agedFile(t, dir, "svc_debug_2024-01-01_001.log", 3)
+	agedFile(t, dir, "svc_debug_2024-01-02_001.log.gz", 0)
+	agedFile(t, dir, "svc_2024-01-01_001.log", 3)
+	agedFile(t, dir, "svc_2024-01-01_002.log.gz", 10)
+	agedFile(t, dir, "svc_error_2024-01-01_001.log.gz", 10)
+	agedFile(t, dir, "svc_error_2023-11-01_001.log.gz", 40)
+	agedFile(t, dir, "other_2024-01-01_001.log", 40)
+
+	if err := aggregator.cleanupOldFiles(); err != nil {
+		t.Fatalf("清理失败: %v", err)
+	}
+
+	remaining := remainingFiles(t, dir)
+	for name, kept := range map[string]bool{
+		"svc_debug_2024-01-01_001.log":    false,
+		"svc_debug_2024-01-02_001.log.gz": true,
+		"svc_2024-01-01_001.log":          true,
+		"svc_2024-01-01_002.log.gz":       false,
+		"svc_error_2024-01-01_001.log.gz": true,
+		"svc_error_2023-11-01_001.log.gz": false,
+		"other_2024-01-01_001.log":        true, // 其他服务的文件
+	} {
+		if remaining[name] != kept {
+			t.Errorf("%s: 期望保留=%v，得到 %v", name, kept, remaining[name])
+		}
+	}
+	if !remaining[aggregator.output.fileID+".log"] {
+		t.Error("正在写入的文件被删除")
+	}
+}
+
+func TestCleanupWithPolicy(t *testing.T) {
+	dir := t.TempDir()
+	agedFile(t, dir, "api_debug_2024-01-01_001.log", 3)
+	agedFile(t, dir, "api_warn_2024-01-01_001.log", 3)
+	agedFile(t, dir, "my_app_error_2024-01-01_001.log.gz", 10)
+	agedFile(t, dir, "my_app_2024-01-01_001.log", 10)
+
+	policy := RetentionPolicy{Default: 7, Levels: map[string]int{"debug": 1, "ERROR": 30}}
+	report, err := CleanupWithPolicy(dir, policy, true)
+	if err != nil {
+		t.Fatalf("清理失败: %v", err)
+	}
+	sort.Strings(report.Files)
+	if len(report.Files) != 2 || report.Files[0] != "api_debug_2024-01-01_001.log" || report.Files[1] != "my_app_2024-01-01_001.log" {
+		t.Errorf("期望清理debug和默认文件，得到 %v", report.Files)
+	}
+	if len(remainingFiles(t, dir)) != 4 {
+		t.Error("dryRun不应删除文件")
+	}
+
+	if _, err := CleanupWithPolicy(dir, RetentionPolicy{Default: 7, Levels: map[string]int{"verbose": 1}}, true); err == nil {
+		t.Error("期望无效级别返回错误")
+	}
+}
+
+func TestWithRetentionPolicyValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+	}{
+		{"无效级别", RetentionPolicy{Levels: map[string]int{"verbose": 1}}},
+		{"天数为0", RetentionPolicy{Levels: map[string]int{"debug": 0}}},
+		{"别名重复", RetentionPolicy{Levels: map[string]int{"warn": 1, "warning": 2}}},
+		{"默认天数为负", RetentionPolicy{Default: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := applyAggregatorOptions([]AggregatorOption{WithRetentionPolicy(tt.policy)}); err == nil {
+				t.Error("期望返回错误")
+			}
+		})
+	}
+
+	// Default为0时保留WithRetentionDays的设置
+	options, err := applyAggregatorOptions([]AggregatorOption{
+		WithRetentionDays(14),
+		WithRetentionPolicy(RetentionPolicy{Levels: map[string]int{"Error": 90}}),
+	})
+	if err != nil {
+		t.Fatalf("应用配置失败: %v", err)
+	}
+	if options.retentionDays != 14 || options.levelRetention["error"] != 90 {
+		t.Errorf("期望默认 14 天、error 90 天，得到 %d %v", options.retentionDays, options.levelRetention)
+	}
+}
+
+func TestFileLevel(t *testing.T) {
+	tests := []struct {
+		fileID, service, want string
+	}{
+		{"svc_error_2024-01-15_001", "svc", "error"},
+		{"svc_2024-01-15_001", "svc", ""},
+		{"my_svc_debug_2024-01-15_002", "my_svc", "debug"},
+		{"info_2024-01-15_001", "info", ""},
+		{"other_error_2024-01-15_001", "svc", ""},
+		{"my_svc_debug_2024-01-15_002", "", "debug"},
+		{"svc_2024-01-15_001", "", ""},
+		{"svc_warning_2024-01-15_001", "", ""},
+		{"svc_error_latest_001", "", ""},
+	}
+	for _, tt := range tests {
+		if got := fileLevel(tt.fileID, tt.service); got != tt.want {
+			t.Errorf("fileLevel(%q, %q): 期望 %q，得到 %q", tt.fileID, tt.service, tt.want, got)
+		}
+	}
+}
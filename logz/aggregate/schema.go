@@ -0,0 +1,224 @@
+package aggregate
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CurrentSchemaVersion 聚合器写入的条目格式版本，LogEntry的JSON字段变化时递增
+// 没有schema_version的条目为0，即引入版本号之前写入的条目
+//
+//	1: 增加schema_version，保留未知字段
+//	2: 增加seq，时间戳精确到纳秒
+//	3: 增加fields_dropped
+const CurrentSchemaVersion = 3
+
+// entryJSONKeys LogEntry的JSON字段名，其他顶层字段解析到Extra中
+var entryJSONKeys = []string{
+	"timestamp", "level", "msg", "trace_id", "span_id", "caller", "fields", "service",
+	"hostname", "pid", "file", "file_id", "offset", "truncated", "fields_dropped",
+	"schema_version", "seq",
+}
+
+// logEntryJSON 与LogEntry字段相同但没有MarshalJSON和UnmarshalJSON，用于按json标签编解码
+type logEntryJSON LogEntry
+
+// MarshalJSON 按json标签序列化条目，Extra中的字段按键排序追加在最后，与LogEntry字段同名的键被忽略
+func (e LogEntry) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(logEntryJSON(e))
+	if err != nil || len(e.Extra) == 0 {
+		return data, err
+	}
+	b := data[:len(data)-1]
+	for _, key := range e.extraKeys() {
+		if b, err = appendExtraField(b, key, e.Extra[key]); err != nil {
+			return nil, err
+		}
+	}
+	return append(b, '}'), nil
+}
+
+// UnmarshalJSON 按json标签解析条目，不认识的顶层字段（如更新版本写入的字段）原样保存到Extra，
+// 重新序列化时不会丢失
+func (e *LogEntry) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*logEntryJSON)(e)); err != nil {
+		return err
+	}
+	e.Extra = nil
+	forEachTopLevelField(data, func(key, value []byte) bool {
+		if isQuotedEntryJSONKey(key) {
+			return true
+		}
+		name, ok := unquoteKey(key)
+		if !ok || isEntryJSONKey(name) {
+			return true
+		}
+		if e.Extra == nil {
+			e.Extra = make(map[string]json.RawMessage)
+		}
+		e.Extra[name] = json.RawMessage(bytes.Clone(value))
+		return true
+	})
+	return nil
+}
+
+// extraKeys 返回Extra中需要序列化的键，按字典序排列
+func (e *LogEntry) extraKeys() []string {
+	keys := make([]string, 0, len(e.Extra))
+	for key := range e.Extra {
+		if !isEntryJSONKey(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// appendExtraField 追加一个Extra字段，值按json.Marshal的规则压缩和转义
+func appendExtraField(b []byte, key string, value json.RawMessage) ([]byte, error) {
+	b = append(b, ',')
+	b = appendJSONString(b, key)
+	b = append(b, ':')
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, encoded...), nil
+}
+
+// isEntryJSONKey 检查键是否为LogEntry的字段，与encoding/json一样不区分大小写
+func isEntryJSONKey(name string) bool {
+	for _, known := range entryJSONKeys {
+		if strings.EqualFold(name, known) {
+			return true
+		}
+	}
+	return false
+}
+
+// isQuotedEntryJSONKey 检查不含转义字符的带引号的键是否为LogEntry的字段，不分配内存
+func isQuotedEntryJSONKey(quoted []byte) bool {
+	if len(quoted) < 2 || bytes.IndexByte(quoted, '\\') >= 0 {
+		return false
+	}
+	return isEntryJSONKey(string(quoted[1 : len(quoted)-1]))
+}
+
+// unquoteKey 去掉键的引号，只有包含转义字符时才完整解析
+func unquoteKey(quoted []byte) (string, bool) {
+	if len(quoted) < 2 {
+		return "", false
+	}
+	if bytes.IndexByte(quoted, '\\') < 0 {
+		return string(quoted[1 : len(quoted)-1]), true
+	}
+	var name string
+	if json.Unmarshal(quoted, &name) != nil {
+		return "", false
+	}
+	return name, true
+}
+
+// schemaVersionOf 返回一行日志的格式版本，没有schema_version时为0，不是JSON对象时ok为false
+// 只扫描顶层字段，不解析整个条目
+func schemaVersionOf(line []byte) (version int, ok bool) {
+	ok = forEachTopLevelField(line, func(key, value []byte) bool {
+		if string(key) != `"schema_version"` {
+			return true
+		}
+		version, _ = strconv.Atoi(string(value))
+		return false
+	})
+	return version, ok
+}
+
+// forEachTopLevelField 依次对JSON对象的每个顶层字段调用fn，key带引号，value为原始的值，fn返回false时停止
+// 不完整校验JSON，data不以{开头时返回false；调用方需要完整校验时先用json.Unmarshal解析
+func forEachTopLevelField(data []byte, fn func(key, value []byte) bool) bool {
+	i := skipJSONSpace(data, 0)
+	if i >= len(data) || data[i] != '{' {
+		return false
+	}
+	i++
+	for {
+		i = skipJSONSpace(data, i)
+		if i >= len(data) || data[i] != '"' {
+			return true
+		}
+		keyEnd := skipJSONString(data, i)
+		key := data[i:keyEnd]
+		i = skipJSONSpace(data, keyEnd)
+		if i >= len(data) || data[i] != ':' {
+			return true
+		}
+		start := skipJSONSpace(data, i+1)
+		end := skipJSONValue(data, start)
+		if !fn(key, bytes.TrimRight(data[start:end], " \t\r\n")) {
+			return true
+		}
+		i = skipJSONSpace(data, end)
+		if i >= len(data) || data[i] != ',' {
+			return true
+		}
+		i++
+	}
+}
+
+// skipJSONSpace 返回从i开始第一个非空白字符的位置
+func skipJSONSpace(data []byte, i int) int {
+	for i < len(data) {
+		switch data[i] {
+		case ' ', '\t', '\r', '\n':
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// skipJSONString 返回从i处的引号开始的字符串结束后的位置
+func skipJSONString(data []byte, i int) int {
+	for j := i + 1; j < len(data); j++ {
+		switch data[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1
+		}
+	}
+	return len(data)
+}
+
+// skipJSONValue 返回从i开始的值结束后的位置，标量值结束于所在对象或数组的逗号或右括号
+func skipJSONValue(data []byte, i int) int {
+	depth := 0
+	for j := i; j < len(data); {
+		switch data[j] {
+		case '"':
+			j = skipJSONString(data, j)
+			if depth == 0 {
+				return j
+			}
+			continue
+		case '{', '[':
+			depth++
+		case '}', ']':
+			if depth == 0 {
+				return j
+			}
+			if depth--; depth == 0 {
+				return j + 1
+			}
+		case ',':
+			if depth == 0 {
+				return j
+			}
+		}
+		j++
+	}
+	return len(data)
+}
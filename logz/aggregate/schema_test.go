@@ -0,0 +1,136 @@
+package aggregate
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEntryExtraFieldsSurviveRewrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.log")
+	raw := `{"timestamp":"2024-01-15T10:00:00Z","level":"info","msg":"keep","trace_id":"t1","schema_version":4,"stack":["a.go:1", "b.go:2"],"zone":{"name":"<eu>","id":7}}` + "\n" +
+		`{"timestamp":"2024-01-15T10:01:00Z","level":"info","msg":"drop","trace_id":"t2"}` + "\n"
+	if err := os.WriteFile(path, []byte(raw), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+
+	info, err := DescribeLogDir(dir)
+	if err != nil {
+		t.Fatalf("获取目录信息失败: %v", err)
+	}
+	if want := map[int]int{0: 1, 4: 1}; !reflect.DeepEqual(info.SchemaVersions, want) || !reflect.DeepEqual(info.Files[0].SchemaVersions, want) {
+		t.Errorf("期望版本分布 %v，得到 %v", want, info.SchemaVersions)
+	}
+
+	query := func() []LogEntry {
+		t.Helper()
+		result, err := QueryLogs(LogQuery{SortOrder: "asc", Limit: 10, PathPatterns: []string{"*.log"}}, dir)
+		if err != nil {
+			t.Fatalf("查询失败: %v", err)
+		}
+		return result.Entries
+	}
+	entries := query()
+	if len(entries) != 2 || entries[0].SchemaVersion != 4 || len(entries[0].Extra) != 2 || entries[1].Extra != nil {
+		t.Fatalf("期望保留未知字段，得到 %+v", entries)
+	}
+	wantExtra := map[string]any{"stack": []any{"a.go:1", "b.go:2"}, "zone": map[string]any{"name": "<eu>", "id": float64(7)}}
+	checkExtra := func(entry LogEntry) {
+		t.Helper()
+		got := make(map[string]any)
+		for key, value := range entry.Extra {
+			var v any
+			if err := json.Unmarshal(value, &v); err != nil {
+				t.Fatalf("解析字段%s失败: %v", key, err)
+			}
+			got[key] = v
+		}
+		if !reflect.DeepEqual(got, wantExtra) {
+			t.Errorf("期望未知字段 %v，得到 %v", wantExtra, got)
+		}
+	}
+	checkExtra(entries[0])
+
+	// 重写文件去掉另一条日志，未知字段和版本号不变
+	enc := getEntryEncoder()
+	defer putEntryEncoder(enc)
+	for i := range entries {
+		if entries[i].Message == "drop" {
+			continue
+		}
+		if err := enc.appendEntry(&entries[i]); err != nil {
+			t.Fatalf("序列化失败: %v", err)
+		}
+		enc.buf = append(enc.buf, '\n')
+	}
+	expected, err := json.Marshal(entries[0])
+	if err != nil || !bytes.Equal(bytes.TrimSpace(enc.buf), expected) {
+		t.Errorf("输出与json.Marshal不一致\n期望: %s\n得到: %s", expected, enc.buf)
+	}
+	if err := os.WriteFile(path, enc.buf, 0644); err != nil {
+		t.Fatalf("重写文件失败: %v", err)
+	}
+	entries = query()
+	if len(entries) != 1 || entries[0].Message != "keep" || entries[0].SchemaVersion != 4 {
+		t.Fatalf("期望只剩 keep，得到 %+v", entries)
+	}
+	checkExtra(entries[0])
+
+	// 导入到聚合器时保留版本号和未知字段，新条目使用当前版本
+	aggregator, err := NewLogAggregatorWithOptions(t.TempDir(), "schema-service")
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+	for _, entry := range []LogEntry{entries[0], {Level: "info", Message: "new"}} {
+		if err := aggregator.WriteLog(entry); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+	}
+	if err := aggregator.Flush(); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+	info, err = aggregator.Describe()
+	if err != nil {
+		t.Fatalf("获取聚合器信息失败: %v", err)
+	}
+	if want := map[int]int{4: 1, CurrentSchemaVersion: 1}; !reflect.DeepEqual(info.SchemaVersions, want) {
+		t.Errorf("期望版本分布 %v，得到 %v", want, info.SchemaVersions)
+	}
+	result, err := aggregator.Query(t.Context(), LogQuery{TraceID: "t1", Limit: 10})
+	if err != nil || len(result.Entries) != 1 {
+		t.Fatalf("期望查询到导入的日志，得到 %+v %v", result, err)
+	}
+	checkExtra(result.Entries[0])
+}
+
+func TestEntryExtraIgnoresKnownKeys(t *testing.T) {
+	var entry LogEntry
+	if err := json.Unmarshal([]byte(`{"MSG":"upper","level":"info","tsA":1,"fields":{"stack":1}}`), &entry); err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if entry.Message != "upper" || len(entry.Extra) != 1 || string(entry.Extra["tsA"]) != "1" {
+		t.Errorf("期望不区分大小写匹配已知字段，只保留tsA，得到 %+v", entry)
+	}
+
+	entry.Extra["msg"] = json.RawMessage(`"shadow"`)
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatalf("序列化失败: %v", err)
+	}
+	var decoded LogEntry
+	if err := json.Unmarshal(data, &decoded); err != nil || decoded.Message != "upper" {
+		t.Errorf("期望忽略与已知字段同名的键，得到 %s", data)
+	}
+
+	if version, ok := schemaVersionOf([]byte(`{"msg":"{\"schema_version\":9}","fields":{"schema_version":8},"schema_version":3}`)); !ok || version != 3 {
+		t.Errorf("期望只读取顶层的schema_version，得到 %d %v", version, ok)
+	}
+	if _, ok := schemaVersionOf([]byte("not json")); ok {
+		t.Error("期望非JSON行不计入版本分布")
+	}
+}
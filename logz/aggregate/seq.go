@@ -0,0 +1,139 @@
+package aggregate
+
+import (
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// 从文件末尾查找最后一条日志时第一次读取的字节数，之后每次加倍
+const seqTailWindow = 64 << 10
+
+// seqFile 服务的一个数据文件，按日期和文件序列号排序
+type seqFile struct {
+	path string
+	date string
+	num  int
+}
+
+// recoverSeq 返回服务之前写入的最大条目序号，新的聚合器从下一个序号开始
+// 文件中的序号递增，因此只需读取每个文件集合（默认文件和按级别拆分的文件）中最新的非空文件的最后一条日志；
+// 聚合器每次启动都创建新文件，没有写入就退出时最新的文件为空，继续读取之前的文件
+func recoverSeq(dir, serviceName string) (uint64, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, serviceName+"_*.log*"))
+	if err != nil {
+		return 0, err
+	}
+	sets := make(map[string][]seqFile)
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".gz")
+		if service, ok := dataFileService(name); !ok || service != serviceName {
+			continue
+		}
+		m := dataFileName.FindStringSubmatch(name)
+		date, num, _ := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(name, m[1]+"_"), ".log"), "_")
+		n, _ := strconv.Atoi(num)
+		sets[m[1]] = append(sets[m[1]], seqFile{path: path, date: date, num: n})
+	}
+
+	var maxSeq uint64
+	for _, files := range sets {
+		slices.SortFunc(files, func(a, b seqFile) int {
+			return cmp.Or(cmp.Compare(b.date, a.date), cmp.Compare(b.num, a.num))
+		})
+		for _, file := range files {
+			seq, found, err := lastEntrySeq(file.path)
+			if err != nil {
+				return maxSeq, fmt.Errorf("读取%s的条目序号失败: %w", filepath.Base(file.path), err)
+			}
+			if found {
+				maxSeq = max(maxSeq, seq)
+				break
+			}
+		}
+	}
+	return maxSeq, nil
+}
+
+// lastEntrySeq 返回文件中最后一条可以解析的日志的序号，文件中没有日志时found为false
+// 未写完的最后一行（进程崩溃）无法解析，会被跳过
+func lastEntrySeq(path string) (seq uint64, found bool, err error) {
+	if strings.HasSuffix(path, ".gz") {
+		return lastCompressedEntrySeq(path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, false, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, false, err
+	}
+
+	size := stat.Size()
+	for window := int64(seqTailWindow); ; window *= 2 {
+		start := max(size-window, 0)
+		buf := make([]byte, size-start)
+		if _, err := file.ReadAt(buf, start); err != nil && err != io.EOF {
+			return 0, false, err
+		}
+		lines := bytes.Split(buf, []byte{'\n'})
+		if start > 0 {
+			lines = lines[1:] // 第一行可能不完整
+		}
+		for i := len(lines) - 1; i >= 0; i-- {
+			if seq, ok := entrySeq(lines[i]); ok {
+				return seq, true, nil
+			}
+		}
+		if start == 0 {
+			return 0, false, nil
+		}
+	}
+}
+
+// lastCompressedEntrySeq 顺序解压.gz文件，返回最后一条可以解析的日志的序号
+func lastCompressedEntrySeq(path string) (seq uint64, found bool, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, false, err
+	}
+	defer file.Close()
+	gzReader, err := gzip.NewReader(file)
+	if err != nil {
+		return 0, false, err
+	}
+	defer gzReader.Close()
+
+	lr := NewLineReader(gzReader)
+	for lr.Scan() {
+		if s, ok := entrySeq(lr.Bytes()); ok {
+			seq, found = s, true
+		}
+	}
+	return seq, found, lr.Err()
+}
+
+// entrySeq 返回一行日志的序号，不是JSON对象时ok为false
+func entrySeq(line []byte) (uint64, bool) {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || line[0] != '{' {
+		return 0, false
+	}
+	var v struct {
+		Seq uint64 `json:"seq"`
+	}
+	if err := json.Unmarshal(line, &v); err != nil {
+		return 0, false
+	}
+	return v.Seq, true
+}
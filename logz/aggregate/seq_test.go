@@ -0,0 +1,132 @@
+package aggregate
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestEntrySeqOrdering(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "seq-service", WithBatchSize(64))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+
+	// 1000条日志的时间戳都在同一秒内，只能按序号确定顺序
+	second := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	const total = 1000
+	for i := 0; i < total; i++ {
+		entry := LogEntry{Timestamp: second, Level: "info", Message: fmt.Sprint(i), TraceID: "same-second"}
+		if err := aggregator.WriteLog(entry); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+	}
+	if err := aggregator.Flush(); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+
+	// 文件扫描和组合索引分页后拼接的结果都是连续的序号
+	start := time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)
+	for _, query := range []LogQuery{
+		{TraceID: "same-second"},
+		{TraceID: "same-second", StartTime: start, RequireIndex: true},
+	} {
+		for _, order := range []string{SortAsc, SortDesc} {
+			var seqs []uint64
+			for offset := 0; offset < total; offset += 128 {
+				query.SortOrder, query.Offset, query.Limit = order, offset, 128
+				result, err := aggregator.Query(t.Context(), query)
+				if err != nil {
+					t.Fatalf("查询失败: %v", err)
+				}
+				for _, entry := range result.Entries {
+					seqs = append(seqs, entry.Seq)
+				}
+			}
+			if len(seqs) != total {
+				t.Fatalf("%s: 期望分页共 %d 条，得到 %d", order, total, len(seqs))
+			}
+			for i, seq := range seqs {
+				want := uint64(i + 1)
+				if order == SortDesc {
+					want = total - uint64(i)
+				}
+				if seq != want {
+					t.Fatalf("%s %+v: 第 %d 条期望序号 %d，得到 %d", order, query, i, want, seq)
+				}
+			}
+		}
+	}
+
+	// 重启后从之前的最大序号继续，没有写入就退出的聚合器留下的空文件不影响恢复
+	if err := aggregator.Close(); err != nil {
+		t.Fatalf("关闭聚合器失败: %v", err)
+	}
+	empty, err := NewLogAggregatorWithOptions(dir, "seq-service")
+	if err != nil {
+		t.Fatalf("重新创建聚合器失败: %v", err)
+	}
+	empty.Close()
+	reopened, err := NewLogAggregatorWithOptions(dir, "seq-service")
+	if err != nil {
+		t.Fatalf("重新创建聚合器失败: %v", err)
+	}
+	defer reopened.Close()
+	position, err := reopened.WriteLogSync(LogEntry{Level: "info", Message: "after-restart"}, false)
+	if err != nil || position.Seq != total+1 {
+		t.Fatalf("期望重启后的序号为 %d，得到 %+v %v", total+1, position, err)
+	}
+}
+
+func TestSeqAcrossLevelFiles(t *testing.T) {
+	dir := t.TempDir()
+	policy := RetentionPolicy{Default: 7, Levels: map[string]int{"error": 30}}
+	aggregator, err := NewLogAggregatorWithOptions(dir, "levels", WithRetentionPolicy(policy))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	levels := []string{"info", "error", "info", "error", "info", "error"}
+	for i, level := range levels {
+		entry := LogEntry{Timestamp: "2024-01-15T10:00:00Z", Level: level, Message: fmt.Sprint(i), TraceID: "split"}
+		if err := aggregator.WriteLog(entry); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+	}
+	if err := aggregator.Flush(); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+
+	// 同一秒内写入两个文件的条目按写入顺序合并，而不是按文件排列
+	result, err := aggregator.Query(t.Context(), LogQuery{TraceID: "split", Limit: 10})
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if got := messages(result.Entries); fmt.Sprint(got) != "[0 1 2 3 4 5]" {
+		t.Errorf("期望按序号合并两个文件，得到 %v", got)
+	}
+	aggregator.Close()
+
+	// 最大的序号在按级别拆分的文件中
+	seq, err := recoverSeq(dir, "levels")
+	if err != nil || seq != uint64(len(levels)) {
+		t.Fatalf("期望恢复序号%d，得到 %d %v", len(levels), seq, err)
+	}
+	if seq, err := recoverSeq(dir, "lev"); err != nil || seq != 0 {
+		t.Errorf("期望前缀相同的其他服务没有序号，得到 %d %v", seq, err)
+	}
+}
+
+func TestMemoryAggregatorSeq(t *testing.T) {
+	aggregator, err := NewMemoryAggregator("memory-seq", WithMemoryLimit(2, 1<<20))
+	if err != nil {
+		t.Fatalf("创建内存聚合器失败: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		aggregator.WriteLog(LogEntry{Timestamp: "2024-01-15T10:00:00Z", Level: "info", Message: fmt.Sprint(i)})
+	}
+	result, err := aggregator.Query(t.Context(), LogQuery{SortOrder: SortDesc, Limit: 10})
+	if err != nil || len(result.Entries) != 2 || result.Entries[0].Seq != 5 || result.Entries[1].Seq != 4 {
+		t.Fatalf("期望保留序号5和4，得到 %+v %v", result.Entries, err)
+	}
+}
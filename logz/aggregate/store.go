@@ -0,0 +1,152 @@
+package aggregate
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// LogStore 日志存储，调用方无需了解日志目录布局和文件命名即可查询日志
+type LogStore interface {
+	// Query 按条件查询日志并分页
+	Query(ctx context.Context, query LogQuery) (*LogQueryResult, error)
+	// Stats 返回日志文件统计信息
+	Stats(ctx context.Context) (*LogStats, error)
+	// Tail 跟踪调用之后新写入的日志，返回匹配query的条目，分页条件不生效
+	// ctx取消或跟踪出错时关闭channel
+	Tail(ctx context.Context, query LogQuery) (<-chan LogEntry, error)
+}
+
+// LogStats 日志文件统计信息
+type LogStats struct {
+	TotalFiles     int       `json:"total_files"`
+	TotalSize      int64     `json:"total_size"`
+	OldestFile     string    `json:"oldest_file"`
+	NewestFile     string    `json:"newest_file"`
+	OldestTime     time.Time `json:"oldest_time"`
+	NewestTime     time.Time `json:"newest_time"`
+	MalformedLines int       `json:"malformed_lines"`
+}
+
+// DirStore 基于本地日志目录的LogStore，查询时使用全局聚合器的索引或扫描文件
+type DirStore struct {
+	logDir       string
+	discovery    DiscoverOptions
+	tailInterval time.Duration
+
+	watchMutex sync.Mutex
+	watcher    *LogWatcher // Tail共享的LogWatcher，没有调用方时为nil
+	watchers   int
+}
+
+// DirStoreOption DirStore配置选项
+type DirStoreOption func(*DirStore)
+
+// WithDiscoverOptions 设置日志文件匹配模式和是否查找子目录，查询条件中未指定时使用
+func WithDiscoverOptions(opts DiscoverOptions) DirStoreOption {
+	return func(s *DirStore) {
+		s.discovery = opts
+	}
+}
+
+// WithTailInterval 设置Tail的轮询间隔，默认为DefaultTailInterval
+func WithTailInterval(interval time.Duration) DirStoreOption {
+	return func(s *DirStore) {
+		s.tailInterval = interval
+	}
+}
+
+// NewDirStore 创建基于日志目录的LogStore
+func NewDirStore(logDir string, opts ...DirStoreOption) *DirStore {
+	s := &DirStore{logDir: logDir, tailInterval: DefaultTailInterval}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// LogDir 返回日志目录
+func (s *DirStore) LogDir() string {
+	return s.logDir
+}
+
+// Query 查询日志，参见QueryLogsContext
+func (s *DirStore) Query(ctx context.Context, query LogQuery) (*LogQueryResult, error) {
+	return QueryLogsContext(ctx, s.withDiscovery(query), s.logDir)
+}
+
+// Stats 统计日志目录中的文件，参见CollectLogStats
+func (s *DirStore) Stats(ctx context.Context) (*LogStats, error) {
+	return CollectLogStats(ctx, s.logDir, s.discovery)
+}
+
+// Tail 跟踪日志目录中新追加的内容，参见LogWatcher
+// 使用DirStore文件匹配模式的调用共享同一个LogWatcher，最后一个调用的ctx取消后停止跟踪
+// 调用方处理过慢导致积压超过DefaultSubscriberBuffer条时丢弃新条目
+func (s *DirStore) Tail(ctx context.Context, query LogQuery) (<-chan LogEntry, error) {
+	query = s.withDiscovery(query)
+	watcher, release, err := s.watch(query.DiscoverOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	sub := watcher.Subscribe(query)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-watcher.done:
+		}
+		sub.Close()
+		release()
+	}()
+	return sub.C, nil
+}
+
+// watch 返回跟踪opts匹配文件的LogWatcher，以及使用结束后调用的release
+// 与DirStore的文件匹配模式相同时返回共享的LogWatcher，否则创建单独的LogWatcher
+func (s *DirStore) watch(opts DiscoverOptions) (*LogWatcher, func(), error) {
+	if !sameDiscovery(opts, s.discovery) {
+		watcher, err := NewLogWatcher(s.logDir, WithWatchDiscovery(opts), WithWatchInterval(s.tailInterval))
+		if err != nil {
+			return nil, nil, err
+		}
+		return watcher, func() { watcher.Close() }, nil
+	}
+
+	s.watchMutex.Lock()
+	defer s.watchMutex.Unlock()
+	if s.watcher == nil {
+		watcher, err := NewLogWatcher(s.logDir, WithWatchDiscovery(s.discovery), WithWatchInterval(s.tailInterval))
+		if err != nil {
+			return nil, nil, err
+		}
+		s.watcher = watcher
+	}
+	watcher := s.watcher
+	s.watchers++
+	return watcher, func() {
+		s.watchMutex.Lock()
+		defer s.watchMutex.Unlock()
+		s.watchers--
+		if s.watchers == 0 && s.watcher == watcher {
+			s.watcher = nil
+			watcher.Close()
+		}
+	}, nil
+}
+
+// sameDiscovery 判断查询条件中的文件匹配模式是否与DirStore的配置相同
+func sameDiscovery(a, b DiscoverOptions) bool {
+	return slices.Equal(a.Patterns, b.Patterns) && a.Recursive == b.Recursive && slices.Equal(a.Subdirs, b.Subdirs)
+}
+
+// withDiscovery 查询条件未指定文件匹配模式时使用DirStore的配置
+func (s *DirStore) withDiscovery(query LogQuery) LogQuery {
+	if len(query.PathPatterns) == 0 {
+		query.PathPatterns = s.discovery.Patterns
+		query.Recursive = s.discovery.Recursive
+		query.Subdirs = s.discovery.Subdirs
+	}
+	return query
+}
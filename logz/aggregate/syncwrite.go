@@ -0,0 +1,82 @@
+package aggregate
+
+import (
+	"fmt"
+	"time"
+)
+
+// WritePosition 条目写入的位置，可以用FileID和Offset直接读取该条目
+type WritePosition struct {
+	FileID  string `json:"file_id"`
+	Offset  int64  `json:"offset"`
+	Durable bool   `json:"durable"`       // 文件已同步到磁盘，写入聚合器时还已建立索引
+	Seq     uint64 `json:"seq,omitempty"` // 聚合器分配的条目序号，写入备用文件时为0
+}
+
+// WriteLogSync 立即写入日志条目并返回其位置，返回后文件扫描和查询（包括尚未建立索引的文件尾部）都能读到该条目
+// 批量缓冲区中之前的条目先写入，保持写入顺序；被磁盘空间保护丢弃的条目返回空位置和nil
+// durable为true时还会将文件同步到磁盘并在当前goroutine中建立索引，返回后可以通过RequireIndex的查询读到该条目；
+// 每次调用都有一次文件fsync和一次索引事务提交，延迟通常为毫秒级，只用于需要确认落盘的写入
+// 写入文件失败时归还已分配的序号，序号不会因失败的写入出现空缺；同步到磁盘失败时条目已写入文件，保留其序号
+func (la *LogAggregator) WriteLogSync(entry LogEntry, durable bool) (WritePosition, error) {
+	if ok, err := la.admit(entry.Level); !ok {
+		return WritePosition{}, err
+	}
+	if err := la.limits.Apply(&entry); err != nil {
+		return WritePosition{}, err
+	}
+
+	la.batchMutex.Lock()
+	if err := la.prepareEntry(&entry); err != nil {
+		la.batchMutex.Unlock()
+		return WritePosition{}, err
+	}
+	if err := la.flushBatch(); err != nil {
+		la.releaseSeq(entry.Seq)
+		la.batchMutex.Unlock()
+		return WritePosition{}, err
+	}
+
+	set := la.outputFor(entry.Level)
+	entries := []LogEntry{entry}
+	enc := getEntryEncoder()
+	la.mutex.Lock()
+	err := la.writeEntries(set, entries, enc)
+	la.mutex.Unlock()
+	putEntryEncoder(enc)
+	if err != nil {
+		la.releaseSeq(entry.Seq)
+		la.batchMutex.Unlock()
+		return WritePosition{}, err
+	}
+	position := WritePosition{FileID: entries[0].FileID, Offset: entries[0].Offset, Seq: entries[0].Seq}
+	if !durable {
+		la.enqueueIndex(entries)
+		la.batchMutex.Unlock()
+		return position, nil
+	}
+
+	// 轮转需要持有batchMutex，同步期间文件不会被关闭
+	if err := set.file.Sync(); err != nil {
+		la.batchMutex.Unlock()
+		return position, fmt.Errorf("同步日志文件失败: %w", err)
+	}
+	seq := la.indexLag.add(position.FileID, position.Offset, time.Now())
+	la.batchMutex.Unlock()
+
+	err = la.addToIndex(entries[0])
+	la.indexLag.done(seq)
+	if err != nil {
+		return position, fmt.Errorf("建立索引失败: %w", err)
+	}
+	position.Durable = true
+	return position, nil
+}
+
+// releaseSeq 归还没有写入文件的条目的序号，调用方需持有batchMutex
+// 只有最后分配的序号可以归还，之后已分配其他序号时保留空缺
+func (la *LogAggregator) releaseSeq(seq uint64) {
+	if seq == la.seq {
+		la.seq--
+	}
+}
@@ -0,0 +1,94 @@
+package aggregate
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestWriteLogSync(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := NewLogAggregatorWithOptions(dir, "syncwrite", WithBatchSize(maxBatchSize), WithFlushInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+
+	// 之前缓冲的条目先写入，保持写入顺序
+	if err := aggregator.WriteLog(LogEntry{Level: "info", Message: "buffered", TraceID: "trace-buffered"}); err != nil {
+		t.Fatalf("写入日志失败: %v", err)
+	}
+	position, err := aggregator.WriteLogSync(LogEntry{Level: "warn", Message: "durable", TraceID: "trace-durable"}, true)
+	if err != nil {
+		t.Fatalf("同步写入失败: %v", err)
+	}
+	if !position.Durable || position.FileID != aggregator.output.fileID || position.Offset == 0 {
+		t.Fatalf("期望返回缓冲条目之后的位置，得到 %+v", position)
+	}
+
+	entry, err := readLogEntry(filepath.Join(dir, position.FileID+".log"), position.Offset)
+	if err != nil || entry.Message != "durable" || entry.FileID != position.FileID || entry.Offset != position.Offset {
+		t.Fatalf("期望在返回的位置读到条目，得到 %+v %v", entry, err)
+	}
+
+	// 返回时已建立索引，不需要Flush
+	var postings []string
+	err = aggregator.indexDB.View(func(tx *bbolt.Tx) error {
+		postings, err = lookupPostings(tx, LogQuery{TraceID: "trace-durable"})
+		return err
+	})
+	if want := fmt.Sprintf("%s:%d", position.FileID, position.Offset); err != nil || len(postings) != 1 || postings[0] != want {
+		t.Fatalf("期望索引中有 %s，得到 %v %v", want, postings, err)
+	}
+	result, err := queryLogs(context.Background(), LogQuery{TraceID: "trace-durable", RequireIndex: true, Limit: 10}, dir, aggregator)
+	if err != nil || len(result.Entries) != 1 || result.Entries[0].Offset != position.Offset {
+		t.Fatalf("期望通过索引查询到条目，得到 %+v %v", result, err)
+	}
+
+	// 非durable写入立即写入文件，不同步到磁盘
+	position, err = aggregator.WriteLogSync(LogEntry{Level: "info", Message: "fast"}, false)
+	if err != nil || position.Durable {
+		t.Fatalf("期望非durable写入成功，得到 %+v %v", position, err)
+	}
+	if entry, err := readLogEntry(filepath.Join(dir, position.FileID+".log"), position.Offset); err != nil || entry.Message != "fast" {
+		t.Errorf("期望立即读到条目，得到 %+v %v", entry, err)
+	}
+}
+
+func TestWriteLogSyncFailureKeepsSeq(t *testing.T) {
+	dir := t.TempDir()
+	var failing atomic.Bool
+	aggregator, err := NewLogAggregatorWithOptions(dir, "syncwrite", withFlakyFiles(&failing), WithFlushInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+
+	first, err := aggregator.WriteLogSync(LogEntry{Level: "info", Message: "first"}, false)
+	if err != nil || first.Seq != 1 {
+		t.Fatalf("期望第一条的序号为1，得到 %+v %v", first, err)
+	}
+
+	// 写入失败的条目不占用序号
+	failing.Store(true)
+	for i := 0; i < 3; i++ {
+		if position, err := aggregator.WriteLogSync(LogEntry{Level: "info", Message: "failed"}, true); err == nil {
+			t.Fatalf("期望写入失败返回错误，得到 %+v", position)
+		}
+	}
+	failing.Store(false)
+
+	second, err := aggregator.WriteLogSync(LogEntry{Level: "info", Message: "second"}, true)
+	if err != nil || second.Seq != 2 {
+		t.Fatalf("期望写入失败后序号连续，得到 %+v %v", second, err)
+	}
+	entry, err := readLogEntry(filepath.Join(dir, second.FileID+".log"), second.Offset)
+	if err != nil || entry.Message != "second" || entry.Seq != 2 {
+		t.Errorf("期望在返回的位置读到序号为2的条目，得到 %+v %v", entry, err)
+	}
+}
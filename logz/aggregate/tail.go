@@ -0,0 +1,37 @@
+package aggregate
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultTailInterval TailLogs检查新内容的默认间隔
+const DefaultTailInterval = time.Second
+
+// TailLogs 持续读取logDir中日志文件新追加的内容，将匹配query的条目依次传给fn，直到ctx取消
+// 已有文件从当前末尾开始读取，之后新出现的文件（如轮转产生的文件）从头读取，文件被截断时从头重新读取
+// 只处理以换行结尾的完整行，无法解析的行被跳过；query中的分页条件不生效
+// 基于LogWatcher实现，interval为轮询间隔；fn处理过慢导致积压超过DefaultSubscriberBuffer条时丢弃新条目
+// ctx取消时返回nil，fn返回错误时停止并返回该错误
+func TailLogs(ctx context.Context, query LogQuery, logDir string, interval time.Duration, fn func(LogEntry) error) error {
+	watcher, err := NewLogWatcher(logDir, WithWatchDiscovery(query.DiscoverOptions()), WithWatchInterval(interval))
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	sub := watcher.Subscribe(query)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case entry, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package aggregate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTailLogs(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "app_2024-01-15_001.log")
+	if err := os.WriteFile(existing, []byte(`{"level":"error","msg":"old"}`+"\n"), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	received := make(chan LogEntry, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- TailLogs(ctx, LogQuery{Level: "err"}, dir, 10*time.Millisecond, func(entry LogEntry) error {
+			received <- entry
+			return nil
+		})
+	}()
+
+	// 等待TailLogs记录已有文件的末尾位置
+	time.Sleep(50 * time.Millisecond)
+
+	file, err := os.OpenFile(existing, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	defer file.Close()
+	file.WriteString(`{"level":"info","msg":"skipped"}` + "\n")
+	file.WriteString("not json\n")
+	file.WriteString(`{"level":"error","msg":"first"}` + "\n")
+	file.WriteString(`{"level":"error","msg":"sec`)
+
+	// 新文件从头读取
+	rotated := filepath.Join(dir, "app_2024-01-15_002.log")
+	if err := os.WriteFile(rotated, []byte(`{"level":"ERROR","msg":"rotated"}`+"\n"), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+
+	var messages []string
+	timeout := time.After(2 * time.Second)
+	for len(messages) < 3 {
+		select {
+		case entry := <-received:
+			messages = append(messages, entry.Message)
+			if len(messages) == 2 {
+				// 补全未写完的行
+				file.WriteString(`ond"}` + "\n")
+			}
+		case <-timeout:
+			t.Fatalf("等待日志超时，已收到 %v", messages)
+		}
+	}
+
+	want := map[string]bool{"first": true, "rotated": true, "second": true}
+	for _, msg := range messages {
+		if !want[msg] {
+			t.Errorf("收到意外的日志 %q，全部: %v", msg, messages)
+		}
+	}
+	if messages[2] != "second" {
+		t.Errorf("期望未写完的行补全后才被读取，得到 %v", messages)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("期望ctx取消后返回nil，得到 %v", err)
+	}
+}
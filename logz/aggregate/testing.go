@@ -0,0 +1,34 @@
+package aggregate
+
+import (
+	"testing"
+
+	"github.com/HsiaoL1/trace/logz"
+)
+
+// InitForTesting 创建MemoryAggregator并安装为全局聚合器，同时为默认日志器注册聚合Hook（替换已有的聚合Hook），
+// 测试中通过Info等函数和WriteToAggregator写入的日志都可以用返回的聚合器或QueryAggregator查询
+// 测试结束时移除Hook、关闭聚合器并恢复之前的全局聚合器；由于修改了全局状态，使用它的测试不应调用t.Parallel
+func InitForTesting(t testing.TB, opts ...AggregatorOption) *MemoryAggregator {
+	t.Helper()
+
+	aggregator, err := NewMemoryAggregator(detectServiceName(), opts...)
+	if err != nil {
+		t.Fatalf("创建内存聚合器失败: %v", err)
+	}
+
+	// 替换之前的聚合Hook，测试结束时原样恢复之前的Hook
+	logger := logz.GetDefaultLogger()
+	restoreHooks := logger.SaveHooks()
+	logger.AddNamedHook(logz.HookNameAggregator, NewAggregatorHook(aggregator, aggregator.ServiceName()), logz.HookPriorityAggregator)
+
+	// 测试结束时恢复之前的全局聚合器，不关闭它
+	prev := swapGlobalAggregator(aggregator)
+
+	t.Cleanup(func() {
+		restoreHooks()
+		swapGlobalAggregator(prev)
+		aggregator.Close()
+	})
+	return aggregator
+}
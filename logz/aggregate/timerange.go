@@ -0,0 +1,67 @@
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ResolveTimeRange 将相对时间since和until解析为查询的开始和结束时间，为空的一端返回零值
+// 支持的格式：
+//   - Go时长（如15m、2h、1h30m），表示now之前多久
+//   - now
+//   - today、yesterday：按loc（为nil时为time.Local）的日期边界，since取当天零点，until取当天最后一刻
+//   - RFC3339时间
+//
+// 参数无效或开始时间晚于结束时间时返回*QueryError，Field为since或until
+func ResolveTimeRange(since, until string, now time.Time, loc *time.Location) (start, end time.Time, err error) {
+	if start, err = resolveRelativeTime(since, now, loc, false); err != nil {
+		return time.Time{}, time.Time{}, &QueryError{Field: "since", Err: err}
+	}
+	if end, err = resolveRelativeTime(until, now, loc, true); err != nil {
+		return time.Time{}, time.Time{}, &QueryError{Field: "until", Err: err}
+	}
+	if !start.IsZero() && !end.IsZero() && end.Before(start) {
+		return time.Time{}, time.Time{}, &QueryError{Field: "until", Err: errors.New("不能早于since")}
+	}
+	return start, end, nil
+}
+
+// resolveRelativeTime 解析一端的相对时间，isEnd为true时日期关键字取当天最后一刻，为空时返回零值
+func resolveRelativeTime(value string, now time.Time, loc *time.Location, isEnd bool) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+
+	switch keyword := strings.ToLower(value); keyword {
+	case "now":
+		return now, nil
+	case "today", "yesterday":
+		year, month, day := now.In(loc).Date()
+		start := time.Date(year, month, day, 0, 0, 0, 0, loc)
+		if keyword == "yesterday" {
+			start = start.AddDate(0, 0, -1)
+		}
+		if isEnd {
+			return start.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+		}
+		return start, nil
+	}
+
+	if d, err := time.ParseDuration(value); err == nil {
+		if d < 0 {
+			return time.Time{}, fmt.Errorf("时长不能为负数: %s", value)
+		}
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("应为时长（如15m）、now、today、yesterday或RFC3339时间: %s", value)
+	}
+	return t, nil
+}
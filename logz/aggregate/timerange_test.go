@@ -0,0 +1,50 @@
+package aggregate
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestResolveTimeRange(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	now := time.Date(2024, 1, 15, 1, 30, 0, 0, time.UTC) // 东八区的1月15日9:30
+	today := time.Date(2024, 1, 15, 0, 0, 0, 0, loc)
+
+	tests := []struct {
+		name         string
+		since, until string
+		start, end   time.Time
+	}{
+		{"时长", "15m", "", now.Add(-15 * time.Minute), time.Time{}},
+		{"组合时长", "1h30m", "5m", now.Add(-90 * time.Minute), now.Add(-5 * time.Minute)},
+		{"今天", "today", "now", today, now},
+		{"昨天", "Yesterday", "yesterday", today.AddDate(0, 0, -1), today.Add(-time.Nanosecond)},
+		{"RFC3339", "2024-01-14T00:00:00Z", "", time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC), time.Time{}},
+		{"都为空", "", "", time.Time{}, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end, err := ResolveTimeRange(tt.since, tt.until, now, loc)
+			if err != nil {
+				t.Fatalf("解析失败: %v", err)
+			}
+			if !start.Equal(tt.start) || !end.Equal(tt.end) {
+				t.Errorf("期望 %v - %v，得到 %v - %v", tt.start, tt.end, start, end)
+			}
+		})
+	}
+
+	for _, tt := range []struct{ since, until, field string }{
+		{"last week", "", "since"},
+		{"", "-5m", "until"},
+		{"10m", "1h", "until"},
+		{"today", "yesterday", "until"},
+	} {
+		_, _, err := ResolveTimeRange(tt.since, tt.until, now, loc)
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) || queryErr.Field != tt.field || !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("since=%q until=%q: 期望 %s 参数错误，得到 %v", tt.since, tt.until, tt.field, err)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+package aggregate
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultSubscriberBuffer 每个订阅者channel的默认容量
+const DefaultSubscriberBuffer = 1024
+
+// watcherOptions LogWatcher的配置
+type watcherOptions struct {
+	discovery   DiscoverOptions
+	interval    time.Duration
+	buffer      int
+	pollingOnly bool
+}
+
+// WatcherOption LogWatcher配置选项
+type WatcherOption func(*watcherOptions)
+
+// WithWatchDiscovery 设置跟踪的日志文件匹配模式和是否查找子目录
+func WithWatchDiscovery(opts DiscoverOptions) WatcherOption {
+	return func(o *watcherOptions) {
+		o.discovery = opts
+	}
+}
+
+// WithWatchInterval 设置轮询间隔，默认为DefaultTailInterval
+// 使用文件系统通知时也按此间隔重新扫描，弥补丢失的通知
+func WithWatchInterval(interval time.Duration) WatcherOption {
+	return func(o *watcherOptions) {
+		o.interval = interval
+	}
+}
+
+// WithSubscriberBuffer 设置每个订阅者channel的容量，默认为DefaultSubscriberBuffer
+func WithSubscriberBuffer(size int) WatcherOption {
+	return func(o *watcherOptions) {
+		o.buffer = size
+	}
+}
+
+// WithPollingOnly 不使用文件系统通知，只按间隔轮询，用于不支持inotify等机制的文件系统
+func WithPollingOnly() WatcherOption {
+	return func(o *watcherOptions) {
+		o.pollingOnly = true
+	}
+}
+
+// LogWatcher 跟踪日志目录中新追加的内容，解析为LogEntry后分发给订阅者
+// 优先使用文件系统通知，不可用时按间隔轮询；SSE推送、TailLogs和DirStore.Tail共用此实现
+type LogWatcher struct {
+	logDir  string
+	options watcherOptions
+	files   map[string]*watchedFile // 只由run协程访问
+	fsw     *fsnotify.Watcher       // 不可用时为nil
+
+	mutex       sync.RWMutex
+	subscribers map[*Subscription]struct{}
+	closed      bool
+
+	closing chan struct{}
+	done    chan struct{}
+}
+
+// watchedFile 被跟踪的文件及下次读取的偏移量
+type watchedFile struct {
+	info   os.FileInfo
+	offset int64
+}
+
+// Subscription LogWatcher的订阅，C中依次收到匹配查询条件的条目
+// 订阅者处理不及时导致channel已满时丢弃新条目并计数
+type Subscription struct {
+	C       <-chan LogEntry
+	ch      chan LogEntry
+	query   LogQuery
+	watcher *LogWatcher
+	dropped atomic.Uint64
+}
+
+// Dropped 返回因channel已满被丢弃的条目数
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close 取消订阅并关闭C，可重复调用
+func (s *Subscription) Close() {
+	s.watcher.unsubscribe(s)
+}
+
+// NewLogWatcher 创建跟踪logDir的LogWatcher
+// 返回前已记录现有文件的末尾位置，之后追加的内容和新出现的文件都会被读取
+func NewLogWatcher(logDir string, opts ...WatcherOption) (*LogWatcher, error) {
+	options := watcherOptions{interval: DefaultTailInterval, buffer: DefaultSubscriberBuffer}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.interval <= 0 {
+		options.interval = DefaultTailInterval
+	}
+	if options.buffer <= 0 {
+		options.buffer = DefaultSubscriberBuffer
+	}
+
+	w := &LogWatcher{
+		logDir:      logDir,
+		options:     options,
+		files:       make(map[string]*watchedFile),
+		subscribers: make(map[*Subscription]struct{}),
+		closing:     make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	paths, err := DiscoverLogFiles(logDir, options.discovery)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		if isCompressedLog(path) {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			w.files[path] = &watchedFile{info: info, offset: info.Size()}
+		}
+	}
+
+	if !options.pollingOnly {
+		w.fsw = w.startNotify()
+	}
+	go w.run()
+	return w, nil
+}
+
+// startNotify 为日志目录及需要查找的子目录注册文件系统通知，失败时返回nil并改为轮询
+func (w *LogWatcher) startNotify() *fsnotify.Watcher {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil
+	}
+	if err := fsw.Add(w.logDir); err != nil {
+		fsw.Close()
+		return nil
+	}
+	for _, dir := range w.watchDirs() {
+		fsw.Add(dir) // 子目录可能尚不存在，由轮询补充
+	}
+	return fsw
+}
+
+// watchDirs 返回除日志目录外需要注册通知的子目录
+func (w *LogWatcher) watchDirs() []string {
+	opts := w.options.discovery
+	if !opts.Recursive {
+		dirs := make([]string, 0, len(opts.Subdirs))
+		for _, sub := range opts.Subdirs {
+			dirs = append(dirs, filepath.Join(w.logDir, filepath.FromSlash(sub)))
+		}
+		return dirs
+	}
+
+	maxDepth := opts.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+	var dirs []string
+	filepath.WalkDir(w.logDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() || path == w.logDir {
+			return nil
+		}
+		rel, err := filepath.Rel(w.logDir, path)
+		if err != nil || pathDepth(rel) > maxDepth {
+			return filepath.SkipDir
+		}
+		dirs = append(dirs, path)
+		return nil
+	})
+	return dirs
+}
+
+// run 等待文件系统通知或轮询间隔，读取新内容，直到Close
+func (w *LogWatcher) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.options.interval)
+	defer ticker.Stop()
+
+	var events chan fsnotify.Event
+	var errs chan error
+	if w.fsw != nil {
+		events, errs = w.fsw.Events, w.fsw.Errors
+	}
+	for {
+		select {
+		case <-w.closing:
+			return
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if event.Has(fsnotify.Write) && w.files[event.Name] != nil {
+				w.readFile(event.Name, w.files[event.Name])
+				continue
+			}
+			if event.Has(fsnotify.Create) && w.options.discovery.Recursive {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					w.fsw.Add(event.Name)
+				}
+			}
+			w.scan()
+		case _, ok := <-errs:
+			if !ok {
+				errs = nil
+			}
+			// 通知队列溢出等错误由下次轮询补充
+		case <-ticker.C:
+			w.scan()
+		}
+	}
+}
+
+// scan 查找匹配的日志文件并读取新内容
+// 新出现的文件从头读取；与已跟踪文件是同一文件的（被重命名）沿用原偏移量；消失的文件不再跟踪
+func (w *LogWatcher) scan() {
+	paths, err := DiscoverLogFiles(w.logDir, w.options.discovery)
+	if err != nil {
+		return
+	}
+
+	present := make(map[string]bool, len(paths))
+	var added []string
+	for _, path := range paths {
+		if isCompressedLog(path) {
+			continue // 压缩后的副本内容已读取过
+		}
+		present[path] = true
+		if _, ok := w.files[path]; !ok {
+			added = append(added, path)
+		}
+	}
+
+	for _, path := range added {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		file := &watchedFile{info: info}
+		// 原路径可能已不存在，或已被轮转重新创建的文件占用，后者在readFile中从头读取
+		for oldPath, old := range w.files {
+			if os.SameFile(old.info, info) {
+				file.offset = old.offset
+				if !present[oldPath] {
+					delete(w.files, oldPath)
+				}
+				break
+			}
+		}
+		w.files[path] = file
+	}
+	for path := range w.files {
+		if !present[path] {
+			delete(w.files, path)
+		}
+	}
+
+	for _, path := range paths {
+		if file, ok := w.files[path]; ok {
+			w.readFile(path, file)
+		}
+	}
+}
+
+// readFile 从记录的偏移量开始读取文件中的完整行并分发
+// 路径指向了另一个文件（轮转后重新创建）或文件被截断时从头读取
+func (w *LogWatcher) readFile(path string, file *watchedFile) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return // 文件可能已被删除或压缩，由下次扫描清理
+	}
+	if !os.SameFile(file.info, info) || info.Size() < file.offset {
+		file.offset = 0
+	}
+	file.info = info
+	if info.Size() == file.offset {
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if _, err := f.Seek(file.offset, io.SeekStart); err != nil {
+		return
+	}
+
+	// 超过MaxLineSize的行被跳过，避免未换行的大文件占用内存
+	reader := bufio.NewReader(f)
+	limit := MaxLineSize()
+	var line []byte
+	var pending int64
+	oversized := false
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		pending += int64(len(chunk))
+		if err == bufio.ErrBufferFull {
+			// 超长的行只累计长度，不保留内容
+			if !oversized {
+				line = append(line, chunk...)
+				if len(line) > limit {
+					oversized = true
+					line = line[:0]
+				}
+			}
+			continue
+		}
+		if err != nil {
+			// 未写完的行留到下次读取
+			return
+		}
+		file.offset += pending
+		pending = 0
+		if oversized {
+			oversized = false
+			continue
+		}
+		line = append(line, chunk...)
+		data := bytes.TrimSpace(line)
+		line = line[:0]
+
+		entry, raw, err := decodeEntryLine(data, true)
+		if err != nil {
+			continue
+		}
+		w.publish(entry, raw)
+	}
+}
+
+// publish 将条目发给查询条件匹配的订阅者，channel已满时丢弃并计数
+// raw表示条目由原始的logrus日志转换而来，只发给设置了IncludeRawLogs的订阅者
+func (w *LogWatcher) publish(entry LogEntry, raw bool) {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	for sub := range w.subscribers {
+		if (raw && !sub.query.IncludeRawLogs) || !matchesQuery(entry, sub.query) {
+			continue
+		}
+		select {
+		case sub.ch <- entry:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// Subscribe 注册订阅者，返回的Subscription收到之后读取的匹配query的条目
+// query中的文件匹配模式和分页条件不生效；LogWatcher已关闭时返回的C已关闭
+func (w *LogWatcher) Subscribe(query LogQuery) *Subscription {
+	ch := make(chan LogEntry, w.options.buffer)
+	sub := &Subscription{C: ch, ch: ch, query: query, watcher: w}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		close(ch)
+		return sub
+	}
+	w.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// unsubscribe 移除订阅者并关闭其channel
+func (w *LogWatcher) unsubscribe(sub *Subscription) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if _, ok := w.subscribers[sub]; ok {
+		delete(w.subscribers, sub)
+		close(sub.ch)
+	}
+}
+
+// Subscribers 返回当前订阅者数量
+func (w *LogWatcher) Subscribers() int {
+	w.mutex.RLock()
+	defer w.mutex.RUnlock()
+	return len(w.subscribers)
+}
+
+// Close 停止跟踪并关闭所有订阅者的channel，可重复调用
+func (w *LogWatcher) Close() error {
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mutex.Unlock()
+
+	close(w.closing)
+	<-w.done
+	var err error
+	if w.fsw != nil {
+		err = w.fsw.Close()
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for sub := range w.subscribers {
+		close(sub.ch)
+	}
+	w.subscribers = make(map[*Subscription]struct{})
+	return err
+}
+
+// isCompressedLog 判断是否为压缩后的日志文件
+func isCompressedLog(path string) bool {
+	return strings.HasSuffix(path, ".gz")
+}
@@ -0,0 +1,159 @@
+package aggregate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// appendLines 向文件追加日志行
+func appendLines(t *testing.T, path string, lines ...string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	defer file.Close()
+	for _, line := range lines {
+		if _, err := file.WriteString(line + "\n"); err != nil {
+			t.Fatalf("写入文件失败: %v", err)
+		}
+	}
+}
+
+// receiveMessages 从订阅中读取n条日志的消息
+func receiveMessages(t *testing.T, sub *Subscription, n int) []string {
+	t.Helper()
+	var messages []string
+	timeout := time.After(5 * time.Second)
+	for len(messages) < n {
+		select {
+		case entry, ok := <-sub.C:
+			if !ok {
+				t.Fatalf("订阅被关闭，已收到 %v", messages)
+			}
+			messages = append(messages, entry.Message)
+		case <-timeout:
+			t.Fatalf("等待日志超时，已收到 %v", messages)
+		}
+	}
+	return messages
+}
+
+func TestLogWatcherRotation(t *testing.T) {
+	modes := []struct {
+		name string
+		opts []WatcherOption
+	}{
+		{"文件系统通知", nil},
+		{"轮询", []WatcherOption{WithPollingOnly()}},
+	}
+	for _, mode := range modes {
+		t.Run(mode.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "app.log")
+			appendLines(t, path, `{"level":"info","msg":"before"}`)
+
+			watcher, err := NewLogWatcher(dir, append(mode.opts, WithWatchInterval(10*time.Millisecond))...)
+			if err != nil {
+				t.Fatalf("创建LogWatcher失败: %v", err)
+			}
+			defer watcher.Close()
+			sub := watcher.Subscribe(LogQuery{})
+
+			appendLines(t, path, `{"level":"info","msg":"first"}`)
+			if got := receiveMessages(t, sub, 1); got[0] != "first" {
+				t.Fatalf("期望从末尾开始读取，得到 %v", got)
+			}
+
+			// 轮转：原文件重命名后仍有写入，同名文件重新创建
+			rotated := filepath.Join(dir, "app-1.log")
+			if err := os.Rename(path, rotated); err != nil {
+				t.Fatalf("重命名失败: %v", err)
+			}
+			appendLines(t, rotated, `{"level":"info","msg":"late"}`)
+			appendLines(t, path, `{"level":"info","msg":"fresh"}`)
+
+			got := receiveMessages(t, sub, 2)
+			want := map[string]bool{"late": true, "fresh": true}
+			for _, msg := range got {
+				if !want[msg] {
+					t.Errorf("收到意外的日志 %q，全部: %v", msg, got)
+				}
+				delete(want, msg)
+			}
+
+			// 压缩后删除：压缩副本不被重复读取
+			if err := os.WriteFile(rotated+".gz", []byte("not really gzip"), 0644); err != nil {
+				t.Fatalf("写入文件失败: %v", err)
+			}
+			os.Remove(rotated)
+			appendLines(t, path, `{"level":"info","msg":"after compress"}`)
+			if got := receiveMessages(t, sub, 1); got[0] != "after compress" {
+				t.Errorf("期望只收到新写入的日志，得到 %v", got)
+			}
+			select {
+			case entry := <-sub.C:
+				t.Errorf("收到重复的日志 %+v", entry)
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestLogWatcherSlowSubscriber(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	watcher, err := NewLogWatcher(dir, WithWatchInterval(10*time.Millisecond), WithSubscriberBuffer(2))
+	if err != nil {
+		t.Fatalf("创建LogWatcher失败: %v", err)
+	}
+	slow := watcher.Subscribe(LogQuery{})
+	failures := watcher.Subscribe(LogQuery{Level: "error"})
+
+	for i := 0; i < 10; i++ {
+		appendLines(t, path, fmt.Sprintf(`{"level":"info","msg":"entry %d"}`, i))
+	}
+	appendLines(t, path, `{"level":"error","msg":"failed"}`)
+
+	// 过滤条件不匹配的条目不占用缓冲区
+	if got := receiveMessages(t, failures, 1); got[0] != "failed" {
+		t.Errorf("期望只收到错误日志，得到 %v", got)
+	}
+	if failures.Dropped() != 0 {
+		t.Errorf("期望过滤订阅没有丢弃，得到 %d", failures.Dropped())
+	}
+
+	// 慢订阅者只保留缓冲区容量的条目，其余被丢弃
+	if got := receiveMessages(t, slow, 2); got[0] != "entry 0" || got[1] != "entry 1" {
+		t.Errorf("期望保留最早的 2 条，得到 %v", got)
+	}
+	deadline := time.Now().Add(time.Second)
+	for slow.Dropped() != 9 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if slow.Dropped() != 9 {
+		t.Errorf("期望丢弃 9 条，得到 %d", slow.Dropped())
+	}
+
+	// 取消订阅和关闭时关闭channel
+	slow.Close()
+	slow.Close()
+	if _, ok := <-slow.C; ok {
+		t.Error("期望取消订阅后channel关闭")
+	}
+	if watcher.Subscribers() != 1 {
+		t.Errorf("期望剩余 1 个订阅者，得到 %d", watcher.Subscribers())
+	}
+	if err := watcher.Close(); err != nil {
+		t.Errorf("关闭失败: %v", err)
+	}
+	if _, ok := <-failures.C; ok {
+		t.Error("期望关闭后channel关闭")
+	}
+	if _, ok := <-watcher.Subscribe(LogQuery{}).C; ok {
+		t.Error("期望关闭后订阅的channel已关闭")
+	}
+}
@@ -0,0 +1,206 @@
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultWriteRetryBuffer 写入文件失败期间最多缓冲等待重试的条目数
+const DefaultWriteRetryBuffer = 10000
+
+// DefaultWriteFailureTimeout 写入文件持续失败超过此时间后，WriteLog返回错误而不再缓冲新条目
+const DefaultWriteFailureTimeout = time.Minute
+
+// writeFailureReportInterval 持续失败期间定时刷新向标准错误报告的最小间隔
+const writeFailureReportInterval = time.Minute
+
+// WithWriteRetry 设置写入文件失败（磁盘抖动、轮转时无法创建新文件）时的缓冲和重试
+// 失败期间WriteLog把条目留在批量缓冲区中并返回nil，由定时刷新重试写入，恢复后按原顺序写入文件；
+// 缓冲的条目超过maxBuffered条或持续失败超过failureTimeout后，新条目返回ErrWriteFailing
+func WithWriteRetry(maxBuffered int, failureTimeout time.Duration) AggregatorOption {
+	return func(o *aggregatorOptions) error {
+		if maxBuffered <= 0 {
+			return fmt.Errorf("写入重试缓冲条目数必须大于0: %d", maxBuffered)
+		}
+		if failureTimeout <= 0 {
+			return fmt.Errorf("写入失败超时时间必须大于0: %v", failureTimeout)
+		}
+		o.writeRetryBuffer = maxBuffered
+		o.writeFailureTimeout = failureTimeout
+		return nil
+	}
+}
+
+// WriteFailureStats 写入文件失败的情况
+type WriteFailureStats struct {
+	Failing             bool      `json:"failing"`
+	ConsecutiveFailures uint64    `json:"consecutive_failures"` // 最近一次成功之后连续失败的写入次数
+	FailingSince        time.Time `json:"failing_since,omitempty"`
+	LastError           string    `json:"last_error,omitempty"`
+	Buffered            int       `json:"buffered"`  // 失败期间缓冲区中等待重试的条目数
+	Rejected            uint64    `json:"rejected"`  // 缓冲已满或失败超时后返回错误的条目数
+	Recovered           uint64    `json:"recovered"` // 失败后重试成功写入的条目数
+}
+
+// fileWriteError 写入、刷新或创建文件失败，条目留在缓冲区中重试；序列化失败等其他错误不重试
+type fileWriteError struct {
+	err error
+}
+
+// Error 实现error接口
+func (e *fileWriteError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap 返回底层错误
+func (e *fileWriteError) Unwrap() error {
+	return e.err
+}
+
+// isRetryableWrite 检查错误是否为可以重试的文件写入失败
+func isRetryableWrite(err error) bool {
+	var writeErr *fileWriteError
+	return errors.As(err, &writeErr)
+}
+
+// writeFailure 写入文件失败的状态，失败期间条目留在批量缓冲区中，由定时刷新重试
+// 状态在持有batchMutex时修改，mutex保护Stats读取
+type writeFailure struct {
+	maxBuffered int
+	timeout     time.Duration
+
+	mutex       sync.Mutex
+	since       time.Time // 第一次失败的时间，零值表示没有失败
+	consecutive uint64
+	lastErr     string
+	lastReport  time.Time
+	buffered    int
+	rejected    uint64
+	recovered   uint64
+}
+
+// failing 是否处于写入失败状态，buffered为缓冲区中的条目数，失败期间记录到统计中
+func (f *writeFailure) failing(buffered int) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.since.IsZero() {
+		return false
+	}
+	f.buffered = buffered
+	return true
+}
+
+// admit 失败期间决定是否缓冲新条目，buffered为缓冲区中的条目数，返回非nil时拒绝条目
+func (f *writeFailure) admit(buffered int, now time.Time) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.since.IsZero() {
+		return nil
+	}
+	var reason string
+	switch {
+	case now.Sub(f.since) >= f.timeout:
+		reason = fmt.Sprintf("已持续%s", now.Sub(f.since).Round(time.Second))
+	case buffered >= f.maxBuffered:
+		reason = fmt.Sprintf("缓冲区已满（%d条）", buffered)
+	default:
+		return nil
+	}
+	f.rejected++
+	return fmt.Errorf("%w: %s，最近的错误: %s", ErrWriteFailing, reason, f.lastErr)
+}
+
+// fail 记录一次写入失败，buffered为留在缓冲区中的条目数，返回是否需要向标准错误报告（第一次失败和之后每个报告间隔一次）
+func (f *writeFailure) fail(err error, buffered int, now time.Time) bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.since.IsZero() {
+		f.since = now
+	}
+	f.consecutive++
+	f.lastErr = err.Error()
+	f.buffered = buffered
+	if f.consecutive == 1 || now.Sub(f.lastReport) >= writeFailureReportInterval {
+		f.lastReport = now
+		return true
+	}
+	return false
+}
+
+// succeed 记录写入成功，之前处于失败状态时写入标准错误报告恢复
+func (f *writeFailure) succeed(written int, now time.Time) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.since.IsZero() {
+		return
+	}
+	f.recovered += uint64(written)
+	fmt.Fprintf(os.Stderr, "[写入恢复] 连续失败%d次、持续%s后恢复写入，补写了%d条缓冲的日志\n",
+		f.consecutive, now.Sub(f.since).Round(time.Millisecond), written)
+	f.since, f.consecutive, f.lastErr, f.buffered = time.Time{}, 0, "", 0
+}
+
+// snapshot 返回写入失败的统计
+func (f *writeFailure) snapshot() WriteFailureStats {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return WriteFailureStats{
+		Failing:             !f.since.IsZero(),
+		ConsecutiveFailures: f.consecutive,
+		FailingSince:        f.since,
+		LastError:           f.lastErr,
+		Buffered:            f.buffered,
+		Rejected:            f.rejected,
+		Recovered:           f.recovered,
+	}
+}
+
+// discardPartialWrite 写入失败后丢弃bufio中未写出的数据，并截掉文件末尾写了一半的行，重试时从set.offset继续写入
+func (set *fileSet) discardPartialWrite() {
+	set.writer.Reset(set.out)
+	if stat, err := set.file.Stat(); err == nil && stat.Size() > set.offset {
+		set.file.Truncate(set.offset)
+	}
+}
+
+// DefaultHookErrorReportInterval 聚合Hook写入失败时向标准错误报告的最小间隔
+const DefaultHookErrorReportInterval = time.Minute
+
+// hookErrorReporter 对Hook的写入失败计数，每个间隔最多向标准错误报告一次（包括期间的失败次数），
+// Fire不把错误返回给logrus，避免logrus为每条日志输出"Failed to fire hook"
+type hookErrorReporter struct {
+	interval time.Duration // 为0时使用DefaultHookErrorReportInterval
+
+	mutex      sync.Mutex
+	total      uint64
+	unreported uint64
+	lastReport time.Time
+}
+
+// record 记录一次写入失败，距上次报告超过间隔时报告
+func (r *hookErrorReporter) record(err error, now time.Time) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.total++
+	r.unreported++
+	interval := r.interval
+	if interval == 0 {
+		interval = DefaultHookErrorReportInterval
+	}
+	if !r.lastReport.IsZero() && now.Sub(r.lastReport) < interval {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "[聚合Hook] 写入日志失败%d次（累计%d次），最近的错误: %v\n", r.unreported, r.total, err)
+	r.unreported = 0
+	r.lastReport = now
+}
+
+// count 返回累计的写入失败次数
+func (r *hookErrorReporter) count() uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.total
+}
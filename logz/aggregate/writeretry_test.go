@@ -0,0 +1,180 @@
+package aggregate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// flakyWriter 可以临时失败的文件写入，失败时只写入一半数据，模拟磁盘抖动留下的半行
+type flakyWriter struct {
+	w       io.Writer
+	failing *atomic.Bool
+}
+
+func (f flakyWriter) Write(p []byte) (int, error) {
+	if f.failing.Load() {
+		n, _ := f.w.Write(p[:len(p)/2])
+		return n, errors.New("input/output error")
+	}
+	return f.w.Write(p)
+}
+
+// withFlakyFiles 使聚合文件的写入在failing为true时失败
+func withFlakyFiles(failing *atomic.Bool) AggregatorOption {
+	return func(o *aggregatorOptions) error {
+		o.wrapFile = func(w io.Writer) io.Writer { return flakyWriter{w, failing} }
+		return nil
+	}
+}
+
+func TestWriteRetryRecoversOutage(t *testing.T) {
+	dir := t.TempDir()
+	var failing atomic.Bool
+	aggregator, err := NewLogAggregatorWithOptions(dir, "flaky", withFlakyFiles(&failing),
+		WithBatchSize(5), WithFlushInterval(20*time.Millisecond), WithRotationSize(2048))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+	hook := NewAggregatorHook(aggregator, "flaky")
+
+	write := func(message string) {
+		t.Helper()
+		entry := &logrus.Entry{Time: time.Now(), Level: logrus.InfoLevel, Message: message, Data: logrus.Fields{}}
+		if err := hook.Fire(entry); err != nil {
+			t.Fatalf("Fire失败: %v", err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		write(fmt.Sprintf("before-%d", i))
+	}
+
+	// 故障期间写入不返回错误，条目留在缓冲区中，期间需要轮转的文件也等恢复后再轮转
+	failing.Store(true)
+	for i := 0; i < 60; i++ {
+		write(fmt.Sprintf("outage-%d", i))
+	}
+	if hook.Errors() != 0 {
+		t.Errorf("期望故障期间Hook没有写入失败，得到 %d", hook.Errors())
+	}
+	time.Sleep(50 * time.Millisecond)
+	stats := aggregator.Stats().Writes
+	if !stats.Failing || stats.ConsecutiveFailures < 2 || stats.Buffered == 0 || stats.LastError == "" {
+		t.Errorf("期望统计中报告连续的写入失败，得到 %+v", stats)
+	}
+	if health := aggregator.Health(); !health.Writes.Failing {
+		t.Errorf("期望健康状态中报告写入失败，得到 %+v", health.Writes)
+	}
+	if err := aggregator.Flush(); err == nil {
+		t.Error("期望故障期间Flush返回错误")
+	}
+
+	// 恢复后由定时刷新补写
+	failing.Store(false)
+	deadline := time.Now().Add(2 * time.Second)
+	for aggregator.Stats().Writes.Failing {
+		if time.Now().After(deadline) {
+			t.Fatal("期望恢复后定时刷新重试成功")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		write(fmt.Sprintf("after-%d", i))
+	}
+	if err := aggregator.Flush(); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+	if stats := aggregator.Stats().Writes; stats.Recovered == 0 || stats.ConsecutiveFailures != 0 || stats.Rejected != 0 {
+		t.Errorf("期望记录补写的条目，得到 %+v", stats)
+	}
+
+	// 所有条目按写入顺序写入文件，写了一半的行已被截掉
+	result, err := aggregator.Query(t.Context(), LogQuery{Service: "flaky", Limit: 200, SortOrder: "asc", Strict: true})
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if result.Total != 80 {
+		t.Fatalf("期望写入80条，得到 %d", result.Total)
+	}
+	for i, entry := range result.Entries {
+		if entry.Seq != uint64(i+1) {
+			t.Fatalf("第 %d 条期望序号 %d，得到 %d（%s）", i, i+1, entry.Seq, entry.Message)
+		}
+	}
+	info, err := aggregator.Describe()
+	if err != nil {
+		t.Fatalf("获取聚合器信息失败: %v", err)
+	}
+	if len(info.Files) < 2 || info.TotalEntries != 80 {
+		t.Errorf("期望恢复后完成轮转且没有写了一半的行，得到 %d 个文件、%d 条", len(info.Files), info.TotalEntries)
+	}
+}
+
+func TestWriteRetryLimits(t *testing.T) {
+	if _, err := applyAggregatorOptions([]AggregatorOption{WithWriteRetry(0, time.Second)}); err == nil {
+		t.Error("期望拒绝0条的缓冲")
+	}
+
+	var failing atomic.Bool
+	aggregator, err := NewLogAggregatorWithOptions(t.TempDir(), "limits", withFlakyFiles(&failing),
+		WithBatchSize(1), WithFlushInterval(time.Hour), WithWriteRetry(5, 100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+
+	// 缓冲已满后返回ErrWriteFailing
+	failing.Store(true)
+	for i := 0; i < 5; i++ {
+		if err := aggregator.WriteLog(LogEntry{Level: "info", Message: "buffered"}); err != nil {
+			t.Fatalf("期望缓冲第 %d 条，得到 %v", i, err)
+		}
+	}
+	if err := aggregator.WriteLog(LogEntry{Level: "info", Message: "overflow"}); !errors.Is(err, ErrWriteFailing) || ErrorCode(err) != CodeWriteFailing {
+		t.Errorf("期望缓冲已满时返回ErrWriteFailing，得到 %v", err)
+	}
+	if stats := aggregator.Stats().Writes; stats.Buffered != 5 || stats.Rejected != 1 {
+		t.Errorf("期望缓冲5条、拒绝1条，得到 %+v", stats)
+	}
+
+	// 持续失败超时后同样返回错误；恢复后缓冲的条目写入文件
+	time.Sleep(120 * time.Millisecond)
+	if err := aggregator.Flush(); err == nil {
+		t.Error("期望故障期间Flush返回错误")
+	}
+	failing.Store(false)
+	if err := aggregator.WriteLog(LogEntry{Level: "info", Message: "timeout"}); !errors.Is(err, ErrWriteFailing) {
+		t.Errorf("期望持续失败超时后返回ErrWriteFailing，得到 %v", err)
+	}
+	if err := aggregator.Flush(); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+	result, err := aggregator.Query(t.Context(), LogQuery{Limit: 10})
+	if err != nil || result.Total != 5 {
+		t.Fatalf("期望恢复后写入缓冲的5条，得到 %d %v", result.Total, err)
+	}
+	if err := aggregator.WriteLog(LogEntry{Level: "info", Message: "after"}); err != nil {
+		t.Errorf("期望恢复后正常写入，得到 %v", err)
+	}
+}
+
+func TestHookErrorReporterSampling(t *testing.T) {
+	reporter := hookErrorReporter{interval: time.Minute}
+	now := time.Now()
+	for i := 0; i < 1000; i++ {
+		reporter.record(errors.New("disk full"), now.Add(time.Duration(i)*time.Millisecond))
+	}
+	if reporter.count() != 1000 || reporter.unreported != 999 {
+		t.Errorf("期望一个间隔内只报告一次，得到累计 %d、未报告 %d", reporter.count(), reporter.unreported)
+	}
+	reporter.record(errors.New("disk full"), now.Add(time.Minute))
+	if reporter.unreported != 0 {
+		t.Errorf("期望超过间隔后报告期间的失败次数，未报告 %d", reporter.unreported)
+	}
+}
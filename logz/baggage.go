@@ -0,0 +1,107 @@
+package logz
+
+import (
+	"context"
+	"sync"
+
+	"github.com/HsiaoL1/trace"
+	"github.com/sirupsen/logrus"
+)
+
+// 需要作为日志字段输出的baggage键
+var baggageFieldKeys []string
+var baggageMutex sync.RWMutex
+
+// BaggageHook 将允许列表中的baggage作为日志字段的Hook
+// 需要通过WithContext传入携带baggage的context
+type BaggageHook struct {
+	keys []string
+}
+
+// NewBaggageHook 创建baggage Hook
+func NewBaggageHook(keys ...string) *BaggageHook {
+	return &BaggageHook{keys: keys}
+}
+
+// Levels 返回支持的日志级别
+func (h *BaggageHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire 将baggage添加到日志字段
+func (h *BaggageHook) Fire(entry *logrus.Entry) error {
+	addBaggageFields(entry, h.keys)
+	return nil
+}
+
+// EnableBaggageFields 为默认日志器启用baggage字段（如tenant_id、user_id）
+// 聚合Hook也会读取同一份允许列表，因此与InitWithAggregation的调用顺序无关
+func EnableBaggageFields(keys ...string) {
+	baggageMutex.Lock()
+	baggageFieldKeys = append([]string(nil), keys...)
+	baggageMutex.Unlock()
+
+	// 默认日志器可能被SetDefaultLogger替换，每次都为当前的默认日志器注册，同名Hook只保留一个
+	GetDefaultLogger().AddNamedHook(HookNameBaggage, &globalBaggageHook{}, HookPriorityEnrich)
+}
+
+// getBaggageFieldKeys 获取当前的baggage字段允许列表
+func getBaggageFieldKeys() []string {
+	baggageMutex.RLock()
+	defer baggageMutex.RUnlock()
+	return baggageFieldKeys
+}
+
+// globalBaggageHook 使用全局允许列表的baggage Hook
+type globalBaggageHook struct{}
+
+// Levels 返回支持的日志级别
+func (h *globalBaggageHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire 将baggage添加到日志字段
+func (h *globalBaggageHook) Fire(entry *logrus.Entry) error {
+	AddBaggageFields(entry)
+	return nil
+}
+
+// AddBaggageFields 将EnableBaggageFields允许列表中的baggage添加到日志字段，不覆盖已有字段
+// 供排在baggage Hook之前也需要这些字段的Hook调用，如聚合Hook
+func AddBaggageFields(entry *logrus.Entry) {
+	addBaggageFields(entry, getBaggageFieldKeys())
+}
+
+// addBaggageFields 将允许列表中的baggage添加到日志字段，不覆盖已有字段
+func addBaggageFields(entry *logrus.Entry, keys []string) {
+	if entry.Context == nil || len(keys) == 0 {
+		return
+	}
+
+	for _, key := range keys {
+		if _, exists := entry.Data[key]; exists {
+			continue
+		}
+		if value := trace.GetBaggage(entry.Context, key); value != "" {
+			entry.Data[key] = value
+		}
+	}
+}
+
+// WithContext 添加context（用于提取baggage等上下文信息）
+// ctx中有追踪上下文时添加trace_id和span_id字段，有OpenTelemetry span时与导出的span一致，可以按TraceID查询日志
+func (l *DefaultLogger) WithContext(ctx context.Context) *logrus.Entry {
+	entry := l.logrus.WithContext(ctx)
+	if ctx == nil {
+		return entry
+	}
+	if traceCtx := trace.CurrentTraceContext(ctx); traceCtx.IsValid() {
+		entry = entry.WithFields(createTraceFields(traceCtx.TraceID, traceCtx.SpanID))
+	}
+	return entry
+}
+
+// WithContext 添加context（全局函数）
+func WithContext(ctx context.Context) *logrus.Entry {
+	return defaultLogger.WithContext(ctx)
+}
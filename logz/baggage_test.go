@@ -0,0 +1,69 @@
+package logz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/HsiaoL1/trace"
+	"github.com/HsiaoL1/trace/tracetest"
+	"github.com/sirupsen/logrus"
+)
+
+func TestBaggageHook(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logrus.New()
+	logger.SetOutput(&buf)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.AddHook(NewBaggageHook("tenant_id"))
+
+	ctx, err := trace.SetBaggage(context.Background(), "tenant_id", "acme")
+	if err != nil {
+		t.Fatalf("设置baggage失败: %v", err)
+	}
+	ctx, _ = trace.SetBaggage(ctx, "secret", "hidden")
+
+	logger.WithContext(ctx).Info("处理订单")
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &fields); err != nil {
+		t.Fatalf("解析日志输出失败: %v", err)
+	}
+	if fields["tenant_id"] != "acme" {
+		t.Errorf("期望tenant_id为acme，得到 %v", fields["tenant_id"])
+	}
+	if _, exists := fields["secret"]; exists {
+		t.Error("不在允许列表中的baggage不应输出")
+	}
+}
+
+func TestWithContextTraceFields(t *testing.T) {
+	tracetest.Start(t)
+	var buf bytes.Buffer
+	logger := NewDefaultLogger(&LoggerConfig{Level: LevelInfo, Format: FormatJSON, Output: &buf})
+
+	ctx, span := trace.StartSpan(context.Background(), "handle")
+	defer span.End()
+	logger.WithContext(ctx).Info("处理订单")
+	logger.WithContext(context.Background()).Info("没有追踪上下文")
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("期望2行日志，得到 %q", buf.String())
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(lines[0], &fields); err != nil {
+		t.Fatalf("解析日志输出失败: %v", err)
+	}
+	if fields["trace_id"] != span.SpanContext().TraceID().String() || fields["span_id"] != span.SpanContext().SpanID().String() {
+		t.Errorf("期望日志带有span的ID，得到 %v", fields)
+	}
+	fields = nil
+	if err := json.Unmarshal(lines[1], &fields); err != nil {
+		t.Fatalf("解析日志输出失败: %v", err)
+	}
+	if _, exists := fields["trace_id"]; exists {
+		t.Errorf("没有追踪上下文时不应输出trace_id，得到 %v", fields)
+	}
+}
@@ -0,0 +1,152 @@
+package logz
+
+import (
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxCallerDepth callerHook查找调用位置时最多展开的栈帧数
+const maxCallerDepth = 32
+
+// logrusPackage和logzPackage callerHook跳过的包，logz包中测试文件的栈帧不跳过
+var (
+	logrusPackage = "github.com/sirupsen/logrus"
+	logzPackage   = func() string {
+		pc, _, _, _ := runtime.Caller(0)
+		return funcPackage(runtime.FuncForPC(pc).Name())
+	}()
+)
+
+// funcPackage 返回完整函数名（如"github.com/HsiaoL1/trace/logz.(*DefaultLogger).Info"）中的包路径
+func funcPackage(name string) string {
+	slash := strings.LastIndexByte(name, '/')
+	if dot := strings.IndexByte(name[slash+1:], '.'); dot >= 0 {
+		return name[:slash+1+dot]
+	}
+	return name
+}
+
+// findCaller 返回logrus和本包之外的第一个栈帧，即调用logz.Info、DefaultLogger.Info或logrus的业务代码
+func findCaller() *runtime.Frame {
+	var pcs [maxCallerDepth]uintptr
+	n := runtime.Callers(3, pcs[:]) // 跳过runtime.Callers、findCaller和callerHook.Fire
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		pkg := funcPackage(frame.Function)
+		if pkg != logrusPackage && (pkg != logzPackage || strings.HasSuffix(frame.File, "_test.go")) {
+			return &frame
+		}
+		if !more {
+			return nil
+		}
+	}
+}
+
+// callerHook 只为指定级别的日志设置调用位置，其他级别不展开调用栈
+type callerHook struct {
+	levels []logrus.Level
+}
+
+// Levels 实现logrus.Hook接口
+func (h *callerHook) Levels() []logrus.Level {
+	return h.levels
+}
+
+// Fire 设置条目的调用位置，logrus已经设置时（启用了ReportCaller）不修改
+func (h *callerHook) Fire(entry *logrus.Entry) error {
+	if entry.Caller == nil {
+		entry.Caller = findCaller()
+	}
+	return nil
+}
+
+// callerFormatter 按级别设置调用位置时logrus的ReportCaller为false，内置格式不会输出调用位置；
+// 格式化有调用位置的条目时使用ReportCaller为true的日志器副本
+type callerFormatter struct {
+	logrus.Formatter
+}
+
+// Format 实现logrus.Formatter接口
+func (f *callerFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	if entry.Caller == nil || entry.Logger == nil || entry.Logger.ReportCaller {
+		return f.Formatter.Format(entry)
+	}
+	withCaller := *entry
+	withCaller.Logger = &logrus.Logger{Out: entry.Logger.Out, Level: entry.Logger.Level, ReportCaller: true}
+	return f.Formatter.Format(&withCaller)
+}
+
+// installFormatter 设置logrus的输出格式，按级别设置调用位置时包装为callerFormatter
+func (l *DefaultLogger) installFormatter(formatter logrus.Formatter) {
+	if inner, ok := formatter.(*callerFormatter); ok {
+		formatter = inner.Formatter
+	}
+	if l.callerLevels != nil {
+		formatter = &callerFormatter{Formatter: formatter}
+	}
+	l.logrus.SetFormatter(formatter)
+}
+
+// SetCallerLevels 只为指定级别的日志记录调用位置，如[]string{"warn", "error", "fatal", "panic"}
+// logrus的ReportCaller为每条日志展开调用栈（每条约1.5µs），调试日志较多时开销明显；
+// 设置级别后关闭ReportCaller，由callerHook只在这些级别展开调用栈，输出和聚合文件中的caller字段只在这些级别有值
+// levels为空时不记录调用位置，与DisableCaller相同；EnableCaller恢复为所有级别
+func (l *DefaultLogger) SetCallerLevels(levels []string) error {
+	var parsed []logrus.Level
+	for _, level := range levels {
+		canonical, err := NormalizeLevel(level)
+		if err != nil {
+			return err
+		}
+		lv, err := logrus.ParseLevel(canonical)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(parsed, lv) {
+			parsed = append(parsed, lv)
+		}
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.logrus.SetReportCaller(false)
+	l.config.EnableCaller = len(parsed) > 0
+	if len(parsed) == 0 {
+		l.resetCallerLevelsLocked()
+		return nil
+	}
+	l.callerLevels = parsed
+	l.setNamedHookLocked(HookNameCaller, &callerHook{levels: parsed}, HookPriorityCaller)
+	l.installFormatter(l.logrus.Formatter)
+	return nil
+}
+
+// CallerLevels 返回SetCallerLevels设置的级别，没有按级别设置时返回nil
+func (l *DefaultLogger) CallerLevels() []string {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	var levels []string
+	for _, level := range l.callerLevels {
+		levels = append(levels, canonicalLevel(level.String()))
+	}
+	return levels
+}
+
+// resetCallerLevelsLocked 取消按级别设置调用位置，移除callerHook和callerFormatter，调用方需持有l.mutex
+func (l *DefaultLogger) resetCallerLevelsLocked() {
+	if l.callerLevels == nil {
+		return
+	}
+	l.callerLevels = nil
+	l.removeNamedHookLocked(HookNameCaller)
+	l.installFormatter(l.logrus.Formatter)
+}
+
+// SetCallerLevels 只为指定级别的日志记录调用位置（全局函数），见DefaultLogger.SetCallerLevels
+func SetCallerLevels(levels []string) error {
+	return GetDefaultLogger().SetCallerLevels(levels)
+}
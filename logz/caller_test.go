@@ -0,0 +1,169 @@
+package logz
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// here 返回调用处的"caller_test.go:行号"，offset为相对于调用处的行数
+func here(offset int) string {
+	_, _, line, _ := runtime.Caller(1)
+	return fmt.Sprintf("caller_test.go:%d", line+offset)
+}
+
+// decodeLines 解析JSON格式输出的每一行
+func decodeLines(t *testing.T, output *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var fields map[string]any
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			t.Fatalf("解析输出失败: %v: %s", err, line)
+		}
+		lines = append(lines, fields)
+	}
+	return lines
+}
+
+func TestSetCallerLevels(t *testing.T) {
+	var output bytes.Buffer
+	logger := NewDefaultLogger(&LoggerConfig{Level: LevelDebug, Format: FormatJSON, Output: &output, EnableCaller: true})
+	// 排在callerHook之后的Hook（如聚合Hook）读取到的调用位置
+	var hookCallers []string
+	logger.AddNamedHook("record", &funcHook{fire: func(entry *logrus.Entry) {
+		caller := ""
+		if entry.Caller != nil {
+			caller = fmt.Sprintf("%s:%d", filepath.Base(entry.Caller.File), entry.Caller.Line)
+		}
+		hookCallers = append(hookCallers, caller)
+	}}, HookPriorityAggregator)
+
+	if err := logger.SetCallerLevels([]string{"warning", "ERROR", "error"}); err != nil {
+		t.Fatalf("设置调用位置级别失败: %v", err)
+	}
+	if levels := logger.CallerLevels(); strings.Join(levels, ",") != "warn,error" || logger.logrus.ReportCaller {
+		t.Fatalf("期望只为warn和error记录调用位置并关闭ReportCaller，得到 %v %v", levels, logger.logrus.ReportCaller)
+	}
+
+	logger.Debug("debug message")
+	logger.Info("info message")
+	warnCaller := here(1)
+	logger.Warn("warn message")
+	errorCaller := here(1)
+	logger.logrus.WithField("k", "v").Error("error message")
+
+	lines := decodeLines(t, &output)
+	want := []string{"", "", warnCaller, errorCaller}
+	for i, line := range lines {
+		if file, _ := line["file"].(string); file != want[i] {
+			t.Errorf("%s: 期望调用位置 %q，得到 %q", line["msg"], want[i], file)
+		}
+	}
+	if len(hookCallers) != 4 {
+		t.Fatalf("期望Hook收到4条日志，得到 %d", len(hookCallers))
+	}
+	for i, caller := range hookCallers {
+		if caller != want[i] {
+			t.Errorf("%s: 期望Hook读取到的调用位置 %q，得到 %q", lines[i]["msg"], want[i], caller)
+		}
+	}
+
+	// 文本格式同样输出调用位置
+	output.Reset()
+	logger.setFormat(FormatText)
+	textCaller := here(1)
+	logger.Errorf("text %s", "error")
+	logger.Infof("text %s", "info")
+	if text := output.String(); !strings.Contains(text, "file=\""+textCaller+"\"") || strings.Count(text, "file=") != 1 {
+		t.Errorf("期望只有error日志带调用位置 %s，得到 %s", textCaller, text)
+	}
+
+	// 无效的级别返回错误，不修改设置
+	if err := logger.SetCallerLevels([]string{"error", "verbose"}); err == nil || len(logger.CallerLevels()) != 2 {
+		t.Errorf("期望无效级别返回错误，得到 %v %v", err, logger.CallerLevels())
+	}
+
+	// 级别为空时不记录调用位置，并移除Hook和格式包装
+	if err := logger.SetCallerLevels(nil); err != nil {
+		t.Fatalf("取消调用位置失败: %v", err)
+	}
+	if _, wrapped := logger.logrus.Formatter.(*callerFormatter); wrapped || logger.NamedHook(HookNameCaller) != nil || logger.config.EnableCaller {
+		t.Errorf("期望移除callerHook和callerFormatter，得到 %T", logger.logrus.Formatter)
+	}
+	output.Reset()
+	logger.Error("no caller")
+	if strings.Contains(output.String(), "file=") {
+		t.Errorf("期望不记录调用位置，得到 %s", output.String())
+	}
+}
+
+func TestSetCallerLevelsGlobal(t *testing.T) {
+	var output bytes.Buffer
+	logger := GetDefaultLogger()
+	previous := logger.logrus.Out
+	SetOutput(&output)
+	SetFormat(FormatJSON)
+	t.Cleanup(func() {
+		DisableCaller()
+		SetFormat(FormatText)
+		SetOutput(previous)
+	})
+
+	if err := SetCallerLevels([]string{LevelError}); err != nil {
+		t.Fatalf("设置调用位置级别失败: %v", err)
+	}
+	// 全局函数和WithField包装的调用跳过本包的栈帧
+	errorCaller := here(1)
+	Error("global error")
+	Info("global info")
+	fieldCaller := here(1)
+	WithField("k", "v").Error("field error")
+	lines := decodeLines(t, &output)
+	if len(lines) != 3 || lines[0]["file"] != errorCaller || lines[1]["file"] != nil || lines[2]["file"] != fieldCaller {
+		t.Errorf("期望调用位置 %s 和 %s，得到 %v", errorCaller, fieldCaller, lines)
+	}
+
+	// 切换格式后仍然输出调用位置，EnableCaller恢复为所有级别
+	output.Reset()
+	SetFormat(FormatText)
+	EnableCaller()
+	if GetDefaultLogger().CallerLevels() != nil || GetDefaultLogger().NamedHook(HookNameCaller) != nil {
+		t.Errorf("期望EnableCaller取消按级别设置")
+	}
+	Info("all levels")
+	if !strings.Contains(output.String(), "file=") {
+		t.Errorf("期望EnableCaller后info日志带调用位置，得到 %s", output.String())
+	}
+}
+
+// BenchmarkCallerLevels 比较为所有级别记录调用位置（logrus的ReportCaller）、只为error及以上记录和不记录时info日志的耗时
+func BenchmarkCallerLevels(b *testing.B) {
+	modes := []struct {
+		name  string
+		setup func(l *DefaultLogger)
+	}{
+		{"all", func(l *DefaultLogger) { l.logrus.SetReportCaller(true) }},
+		{"error+", func(l *DefaultLogger) { l.SetCallerLevels([]string{"error", "fatal", "panic"}) }},
+		{"none", func(l *DefaultLogger) {}},
+	}
+	for _, mode := range modes {
+		b.Run(mode.name, func(b *testing.B) {
+			logger := NewDefaultLogger(&LoggerConfig{Level: LevelInfo, Format: FormatJSON, Output: io.Discard})
+			mode.setup(logger)
+			entry := logger.logrus.WithFields(logrus.Fields{"trace_id": "trace-00000001", "user_id": 1})
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				entry.Info("处理请求")
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package logz
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ConsoleColor 控制台格式的颜色模式
+type ConsoleColor int
+
+const (
+	ColorAuto   ConsoleColor = iota // 输出是终端且没有设置NO_COLOR环境变量时使用颜色
+	ColorAlways                     // 总是使用颜色
+	ColorNever                      // 不使用颜色
+)
+
+// ANSI颜色
+const (
+	ansiReset   = "\x1b[0m"
+	ansiDim     = "\x1b[2m"
+	ansiGray    = "\x1b[90m"
+	ansiRed     = "\x1b[31m"
+	ansiYellow  = "\x1b[33m"
+	ansiCyan    = "\x1b[36m"
+	ansiMagenta = "\x1b[1;35m"
+)
+
+// 控制台格式的默认值
+const (
+	defaultConsoleMessageWidth = 40
+	consoleIDLength            = 8 // 截断显示的TraceID和SpanID长度
+	consoleBadgeWidth          = 5
+)
+
+// ConsoleFormatter 开发环境使用的控制台格式：
+// 右对齐的时间、带颜色的级别、消息、按键排序的字段、调用位置和变暗的[trace_id/span_id]
+// 多行消息和多行字段（如错误堆栈）缩进显示在条目下方
+type ConsoleFormatter struct {
+	Color        ConsoleColor
+	FullIDs      bool // 显示完整的TraceID和SpanID，默认只显示前8个字符
+	Clock24      bool // 使用24小时制（15:04:05），默认为12小时制（3:04:05PM）
+	MessageWidth int  // 消息的最小显示宽度，用于对齐后面的字段，默认40
+}
+
+// Format 实现logrus.Formatter接口
+func (f *ConsoleFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	b := entry.Buffer
+	if b == nil {
+		b = &bytes.Buffer{}
+	}
+	color := f.useColor(entry.Logger)
+	paint := func(code, s string) string {
+		if !color || s == "" {
+			return s
+		}
+		return code + s + ansiReset
+	}
+
+	layout, timeWidth := "3:04:05PM", len("12:04:05PM")
+	if f.Clock24 {
+		layout, timeWidth = "15:04:05", len("15:04:05")
+	}
+	fmt.Fprintf(b, "%*s ", timeWidth, entry.Time.Format(layout))
+	b.WriteString(paint(levelColor(entry.Level), fmt.Sprintf("%-*s", consoleBadgeWidth, levelBadge(entry.Level))))
+	indent := strings.Repeat(" ", timeWidth+1+consoleBadgeWidth+1)
+
+	// 单行字段显示在消息后面，多行字段显示在条目下方
+	keys := make([]string, 0, len(entry.Data))
+	for key := range entry.Data {
+		if key != "trace_id" && key != "span_id" {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	var inline []string
+	var blocks []string
+	for _, key := range keys {
+		value := fmt.Sprint(entry.Data[key])
+		if strings.Contains(value, "\n") {
+			blocks = append(blocks, key)
+			continue
+		}
+		inline = append(inline, paint(levelColor(entry.Level), key)+"="+quoteConsoleValue(value))
+	}
+
+	var suffix []string
+	suffix = append(suffix, inline...)
+	if entry.HasCaller() {
+		suffix = append(suffix, shortCaller(entry.Caller.File, entry.Caller.Line))
+	}
+	if ids := f.formatIDs(entry.Data); ids != "" {
+		suffix = append(suffix, paint(ansiDim, ids))
+	}
+
+	lines := strings.Split(strings.TrimRight(entry.Message, "\n"), "\n")
+	b.WriteByte(' ')
+	b.WriteString(lines[0])
+	if len(suffix) > 0 {
+		width := f.MessageWidth
+		if width <= 0 {
+			width = defaultConsoleMessageWidth
+		}
+		if pad := width - utf8.RuneCountInString(lines[0]); pad > 0 {
+			b.WriteString(strings.Repeat(" ", pad))
+		}
+		b.WriteByte(' ')
+		b.WriteString(strings.Join(suffix, " "))
+	}
+	b.WriteByte('\n')
+
+	for _, line := range lines[1:] {
+		b.WriteString(indent + line + "\n")
+	}
+	for _, key := range blocks {
+		b.WriteString(indent + paint(levelColor(entry.Level), key) + ":\n")
+		for _, line := range strings.Split(strings.TrimRight(fmt.Sprint(entry.Data[key]), "\n"), "\n") {
+			b.WriteString(indent + "  " + line + "\n")
+		}
+	}
+	return b.Bytes(), nil
+}
+
+// useColor 按颜色模式、NO_COLOR环境变量和输出是否为终端决定是否使用颜色
+func (f *ConsoleFormatter) useColor(logger *logrus.Logger) bool {
+	switch f.Color {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" || logger == nil {
+		return false
+	}
+	return isTerminal(logger.Out)
+}
+
+// formatIDs 返回[trace_id/span_id]，没有追踪字段时返回空字符串
+func (f *ConsoleFormatter) formatIDs(data logrus.Fields) string {
+	var ids []string
+	for _, key := range []string{"trace_id", "span_id"} {
+		value, ok := data[key]
+		if !ok {
+			continue
+		}
+		id := fmt.Sprint(value)
+		if !f.FullIDs && utf8.RuneCountInString(id) > consoleIDLength {
+			id = string([]rune(id)[:consoleIDLength]) + "…"
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(ids, "/") + "]"
+}
+
+// isTerminal 检查输出是否为终端
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	stat, err := file.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// levelBadge 返回级别的显示名称，最长5个字符
+func levelBadge(level logrus.Level) string {
+	if level == logrus.WarnLevel {
+		return "WARN"
+	}
+	return strings.ToUpper(level.String())
+}
+
+// levelColor 返回级别的颜色
+func levelColor(level logrus.Level) string {
+	switch level {
+	case logrus.TraceLevel, logrus.DebugLevel:
+		return ansiGray
+	case logrus.WarnLevel:
+		return ansiYellow
+	case logrus.ErrorLevel:
+		return ansiRed
+	case logrus.FatalLevel, logrus.PanicLevel:
+		return ansiMagenta
+	}
+	return ansiCyan
+}
+
+// shortCaller 返回pkg/file.go:42形式的调用位置
+func shortCaller(file string, line int) string {
+	file = path.Join(path.Base(path.Dir(file)), path.Base(file))
+	return file + ":" + strconv.Itoa(line)
+}
+
+// quoteConsoleValue 字段值为空或包含空格、等号、引号时加引号
+func quoteConsoleValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " =\"\t") {
+		return strconv.Quote(value)
+	}
+	return value
+}
@@ -0,0 +1,133 @@
+package logz
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var update = flag.Bool("update", false, "更新testdata中的golden文件")
+
+// consoleEntries 覆盖各级别、追踪ID、调用位置、多行消息和错误堆栈的日志条目
+func consoleEntries(logger *logrus.Logger) []*logrus.Entry {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 15, hour, minute, 5, 0, time.UTC)
+	}
+	newEntry := func(t time.Time, level logrus.Level, message string, data logrus.Fields) *logrus.Entry {
+		entry := logrus.NewEntry(logger).WithFields(data).WithTime(t)
+		entry.Level = level
+		entry.Message = message
+		return entry
+	}
+
+	withCaller := newEntry(at(9, 30), logrus.InfoLevel, "order created", logrus.Fields{
+		"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736",
+		"span_id":  "00f067aa0ba902b7",
+		"order_id": 42,
+		"customer": "Ada Lovelace",
+	})
+	withCaller.Caller = &runtime.Frame{File: "/src/github.com/acme/shop/orders/handler.go", Line: 42}
+	logger.SetReportCaller(true)
+
+	stack := errors.New("db timeout\ngoroutine 1 [running]:\nmain.main()")
+	return []*logrus.Entry{
+		newEntry(at(14, 3), logrus.DebugLevel, "cache warmed", logrus.Fields{"entries": 128}),
+		withCaller,
+		newEntry(at(23, 59), logrus.WarnLevel, "slow query", logrus.Fields{"trace_id": "abc123", "elapsed": "1.2s", "sql": "SELECT 1"}),
+		newEntry(at(0, 0), logrus.ErrorLevel, "payment failed\nretrying in 5s", logrus.Fields{
+			"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736",
+			"error":    stack,
+			"attempt":  2,
+		}),
+		newEntry(at(12, 0), logrus.FatalLevel, "shutting down", nil),
+	}
+}
+
+func TestConsoleFormatterGolden(t *testing.T) {
+	tests := []struct {
+		golden    string
+		formatter *ConsoleFormatter
+	}{
+		{"console_color.golden", &ConsoleFormatter{Color: ColorAlways}},
+		{"console_plain.golden", &ConsoleFormatter{Color: ColorNever}},
+		{"console_full.golden", &ConsoleFormatter{Color: ColorNever, FullIDs: true, Clock24: true, MessageWidth: 20}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			logger := logrus.New()
+			var out bytes.Buffer
+			for _, entry := range consoleEntries(logger) {
+				data, err := tt.formatter.Format(entry)
+				if err != nil {
+					t.Fatalf("格式化失败: %v", err)
+				}
+				out.Write(data)
+			}
+
+			path := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.MkdirAll("testdata", 0755); err != nil {
+					t.Fatalf("创建testdata目录失败: %v", err)
+				}
+				if err := os.WriteFile(path, out.Bytes(), 0644); err != nil {
+					t.Fatalf("写入golden文件失败: %v", err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("读取golden文件失败: %v", err)
+			}
+			if got := out.String(); got != string(want) {
+				t.Errorf("输出与%s不一致\n期望:\n%s\n得到:\n%s", tt.golden, want, got)
+			}
+		})
+	}
+}
+
+func TestConsoleFormatterAutoColor(t *testing.T) {
+	formatter := &ConsoleFormatter{}
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+	if formatter.useColor(logger) {
+		t.Error("期望输出不是终端时不使用颜色")
+	}
+
+	// 设置NO_COLOR时即使输出是终端也不使用颜色
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		t.Skipf("没有可用的终端: %v", err)
+	}
+	defer tty.Close()
+	logger.SetOutput(tty)
+	t.Setenv("NO_COLOR", "")
+	if !formatter.useColor(logger) {
+		t.Error("期望输出是终端时使用颜色")
+	}
+	t.Setenv("NO_COLOR", "1")
+	if formatter.useColor(logger) {
+		t.Error("期望设置NO_COLOR时不使用颜色")
+	}
+}
+
+func TestInitDevelopmentUsesConsoleFormatter(t *testing.T) {
+	previous := GetDefaultLogger().logrus.Formatter
+	t.Cleanup(func() {
+		GetDefaultLogger().logrus.SetFormatter(previous)
+		SetLevel(LevelInfo)
+		SetFormat(FormatText)
+		DisableCaller()
+	})
+
+	InitDevelopment()
+	if _, ok := GetDefaultLogger().logrus.Formatter.(*ConsoleFormatter); !ok {
+		t.Errorf("期望使用ConsoleFormatter，得到 %T", GetDefaultLogger().logrus.Formatter)
+	}
+}
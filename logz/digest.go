@@ -0,0 +1,191 @@
+package logz
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultDigestInterval 摘要模式下未设置DigestInterval时发送摘要的间隔
+const DefaultDigestInterval = 30 * time.Minute
+
+// maxDigestTraceIDs 摘要中每组通知最多保留的不同TraceID数量
+const maxDigestTraceIDs = 3
+
+// digestGroup 摘要中按指纹汇总的一组通知
+type digestGroup struct {
+	Level    string
+	Message  string // 归一化后的消息
+	Sample   string // 最近一条原始消息
+	Caller   string
+	Count    int
+	First    time.Time
+	Last     time.Time
+	TraceIDs []string
+}
+
+// emailDigest 摘要模式下一个周期内累积的通知
+type emailDigest struct {
+	start  time.Time
+	total  int
+	groups map[notificationKey]*digestGroup
+}
+
+// emailDigestTemplate 摘要邮件正文，按出现次数从多到少列出各组通知，消息内容会被转义
+var emailDigestTemplate = template.Must(template.New("digest").Parse(`
+		<h2>系统日志摘要</h2>
+		<p><strong>时间段:</strong> {{.Start}} - {{.End}}</p>
+		<p><strong>通知总数:</strong> {{.Total}}（{{len .Groups}} 类）</p>
+		<table border="1" cellpadding="4" cellspacing="0">
+			<tr><th>级别</th><th>次数</th><th>消息</th><th>首次</th><th>最近</th><th>TraceID</th></tr>
+			{{- range .Groups}}
+			<tr>
+				<td>{{.Level}}</td>
+				<td>{{.Count}}</td>
+				<td>{{.Message}}{{if ne .Message .Sample}}<br><small>{{.Sample}}</small>{{end}}{{if .Caller}}<br><small>{{.Caller}}</small>{{end}}</td>
+				<td>{{.First.Format "2006-01-02 15:04:05"}}</td>
+				<td>{{.Last.Format "2006-01-02 15:04:05"}}</td>
+				<td>{{range $i, $id := .TraceIDs}}{{if $i}}<br>{{end}}{{$id}}{{end}}</td>
+			</tr>
+			{{- end}}
+		</table>
+		<hr>
+		<p><em>此邮件由系统自动发送，fatal和panic级别的通知已单独发送。</em></p>
+	`))
+
+// digestInterval 返回发送摘要的间隔
+func (c *EmailConfig) digestInterval() time.Duration {
+	if c.DigestInterval > 0 {
+		return c.DigestInterval
+	}
+	return DefaultDigestInterval
+}
+
+// startDigest 开始摘要周期，ticks为nil时按DigestInterval创建Ticker，每次触发时发送摘要
+func (n *EmailNotifier) startDigest(ticks <-chan time.Time) {
+	n.digest = &emailDigest{start: n.now(), groups: make(map[notificationKey]*digestGroup)}
+	n.digestStop = make(chan struct{})
+	n.digestDone = make(chan struct{})
+	stop := func() {}
+	if ticks == nil {
+		ticker := time.NewTicker(n.config.digestInterval())
+		ticks, stop = ticker.C, ticker.Stop
+	}
+	go func() {
+		defer close(n.digestDone)
+		defer stop()
+		for {
+			select {
+			case <-ticks:
+				n.sendDigest()
+			case <-n.digestStop:
+				return
+			}
+		}
+	}()
+}
+
+// record 将通知计入当前周期的摘要，key与限流使用的相同，caller为"文件:行号"
+func (n *EmailNotifier) record(key notificationKey, message, traceID, caller string) {
+	now := n.now()
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.digest.total++
+	group, ok := n.digest.groups[key]
+	if !ok {
+		group = &digestGroup{
+			Level:   strings.ToUpper(key.level),
+			Message: NormalizeErrorMessage(message),
+			Caller:  caller,
+			First:   now,
+		}
+		n.digest.groups[key] = group
+	}
+	group.Count++
+	group.Last = now
+	group.Sample = message
+	if traceID != "" && len(group.TraceIDs) < maxDigestTraceIDs && !containsString(group.TraceIDs, traceID) {
+		group.TraceIDs = append(group.TraceIDs, traceID)
+	}
+}
+
+// containsString 检查values中是否有value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// sendDigest 发送当前周期的摘要并开始新的周期，周期内没有通知时不发送
+// 同步发送，发送失败时输出到标准错误
+func (n *EmailNotifier) sendDigest() {
+	if n.digestStop == nil {
+		return
+	}
+	now := n.now()
+	n.mutex.Lock()
+	digest := n.digest
+	n.digest = &emailDigest{start: now, groups: make(map[notificationKey]*digestGroup)}
+	n.mutex.Unlock()
+	if digest.total == 0 {
+		return
+	}
+
+	groups := make([]*digestGroup, 0, len(digest.groups))
+	for _, group := range digest.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Count != groups[j].Count {
+			return groups[i].Count > groups[j].Count
+		}
+		return groups[i].First.Before(groups[j].First)
+	})
+
+	const layout = "2006-01-02 15:04:05"
+	subject := fmt.Sprintf("[DIGEST] 系统日志摘要 - %d条通知 (%s - %s)", digest.total, digest.start.Format(layout), now.Format(layout))
+	var body strings.Builder
+	err := emailDigestTemplate.Execute(&body, map[string]any{
+		"Start":  digest.start.Format(layout),
+		"End":    now.Format(layout),
+		"Total":  digest.total,
+		"Groups": groups,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[邮件通知失败] 渲染摘要邮件失败: %v\n", err)
+		return
+	}
+	for _, to := range n.recipients() {
+		if err := n.send(to, subject, body.String()); err != nil {
+			fmt.Fprintf(os.Stderr, "[邮件通知失败] %v\n", err)
+		}
+	}
+}
+
+// Flush 立即发送摘要模式下累积的通知（没有通知时不发送），并等待异步发送的邮件完成
+func (n *EmailNotifier) Flush() {
+	n.sendDigest()
+	n.pending.Wait()
+}
+
+// Close 停止摘要定时器，发送最后一份摘要并等待异步发送的邮件完成，之后不再发送通知
+// 可重复调用
+func (n *EmailNotifier) Close() {
+	n.closeOnce.Do(func() {
+		n.mutex.Lock()
+		n.closed = true
+		n.mutex.Unlock()
+		if n.digestStop != nil {
+			close(n.digestStop)
+			<-n.digestDone
+		}
+		n.Flush()
+	})
+}
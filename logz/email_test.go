@@ -0,0 +1,418 @@
+package logz
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/HsiaoL1/trace"
+)
+
+func TestValidateEmailSetup(t *testing.T) {
+	t.Cleanup(func() { SetEmailConfig(&EmailConfig{Throttle: 5 * time.Minute}) })
+
+	SetEmailConfig(&EmailConfig{Enabled: false})
+	if err := ValidateEmailSetup(); !errors.Is(err, ErrEmailDisabled) {
+		t.Errorf("期望 ErrEmailDisabled，得到 %v", err)
+	}
+
+	SetEmailConfig(&EmailConfig{Enabled: true})
+	if err := ValidateEmailSetup(); err == nil {
+		t.Error("期望未配置收件人时返回错误")
+	}
+
+	// 监听后立即关闭，得到一个无法连接的端口
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听失败: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	t.Setenv("SMTP_HOST", "127.0.0.1")
+	t.Setenv("SMTP_PORT", strconv.Itoa(port))
+	t.Setenv("SMTP_USER", "sender@example.com")
+	t.Setenv("SMTP_PASSWORD", "secret")
+	t.Setenv("SMTP_DIAL_TIMEOUT", "500ms")
+
+	SetEmailConfig(&EmailConfig{Enabled: true, ToEmail: "ops@example.com"})
+	if err := ValidateEmailSetup(); err == nil || errors.Is(err, ErrEmailDisabled) {
+		t.Errorf("期望SMTP连接失败，得到 %v", err)
+	}
+}
+
+func TestEmailNotifierRecipientFallback(t *testing.T) {
+	t.Cleanup(func() { trace.SetEmail("") })
+	trace.SetEmail("default@example.com")
+
+	notifier := NewEmailNotifier(&EmailConfig{Enabled: true, ToEmail: "config@example.com"})
+	if got := notifier.recipient(); got != "config@example.com" {
+		t.Errorf("期望优先使用EmailConfig.ToEmail，得到 %q", got)
+	}
+
+	notifier = NewEmailNotifier(&EmailConfig{Enabled: true})
+	if got := notifier.recipient(); got != "default@example.com" {
+		t.Errorf("期望回退到trace.GetEmail()，得到 %q", got)
+	}
+	if !notifier.shouldSendEmail(notificationKey{level: "error"}, notifier.recipient()) {
+		t.Error("期望使用默认收件人时可以发送邮件")
+	}
+
+	trace.SetEmail("")
+	notifier = NewEmailNotifier(&EmailConfig{Enabled: true})
+	if notifier.shouldSendEmail(notificationKey{level: "error"}, notifier.recipient()) {
+		t.Error("期望没有收件人时不发送邮件")
+	}
+}
+
+// sentEmail 记录的邮件
+type sentEmail struct {
+	to, subject, body string
+}
+
+// recordingSender 记录发送的邮件而不连接SMTP服务器
+type recordingSender struct {
+	mutex sync.Mutex
+	sent  []sentEmail
+}
+
+func (r *recordingSender) send(to, subject, body string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.sent = append(r.sent, sentEmail{to: to, subject: subject, body: body})
+	return nil
+}
+
+func (r *recordingSender) emails() []sentEmail {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]sentEmail(nil), r.sent...)
+}
+
+// useRecordingSender 使用config设置全局邮件通知器，并用recordingSender替换发送函数
+// 默认日志器的输出和退出函数在测试结束后恢复
+func useRecordingSender(t *testing.T, config *EmailConfig) (*EmailNotifier, *recordingSender) {
+	t.Helper()
+	SetEmailConfig(config)
+	notifier := getEmailNotifier()
+	sender := &recordingSender{}
+	notifier.send = sender.send
+
+	output := Logrus.Out
+	Logrus.SetOutput(io.Discard)
+	t.Cleanup(func() {
+		SetEmailConfig(&EmailConfig{Throttle: 5 * time.Minute})
+		SetExitFunc(nil)
+		Logrus.SetOutput(output)
+	})
+	return notifier, sender
+}
+
+func TestEmailNotifyThrottle(t *testing.T) {
+	notifier, sender := useRecordingSender(t, &EmailConfig{
+		Enabled:  true,
+		ToEmail:  "ops@example.com",
+		OnLevels: []string{"warn", "error", "fatal", "panic"},
+		Throttle: time.Hour,
+	})
+	SetExitFunc(func(int) {})
+
+	for i := 0; i < 2; i++ {
+		WarnWithEmail(true, "disk slow")
+		WarnfWithEmail(true, "disk slow %d", i)
+		ErrorWithEmail(true, "db down")
+		ErrorfWithTraceAndEmail("trace-1", "span-1", true, "db down %d", i)
+		FatalWithEmail(true, "config broken")
+		FatalfWithEmail(true, "config broken %d", i)
+		for _, panicFunc := range []func(){
+			func() { PanicWithEmail(true, "out of memory") },
+			func() { PanicfWithEmail(true, "out of memory %d", i) },
+		} {
+			func() {
+				defer func() { recover() }()
+				panicFunc()
+			}()
+		}
+	}
+	ErrorWithEmail(false, "not sent")
+	notifier.pending.Wait()
+
+	levels := make(map[string]int)
+	for _, email := range sender.emails() {
+		if email.to != "ops@example.com" {
+			t.Errorf("期望发送给ops@example.com，得到 %q", email.to)
+		}
+		levels[strings.Fields(email.subject)[0]]++
+	}
+	// 每个级别有两类通知（调用位置不同），每类限流后只发送一封
+	want := map[string]int{"[WARN]": 2, "[ERROR]": 2, "[FATAL]": 2, "[PANIC]": 2}
+	if len(levels) != len(want) {
+		t.Fatalf("期望每类通知限流后只发送一封邮件，得到 %v", levels)
+	}
+	for level, count := range want {
+		if levels[level] != count {
+			t.Errorf("期望%s发送%d封邮件，得到 %v", level, count, levels)
+		}
+	}
+}
+
+func TestEmailNotifyLevelFilter(t *testing.T) {
+	notifier, sender := useRecordingSender(t, &EmailConfig{
+		Enabled:  true,
+		ToEmail:  "ops@example.com",
+		OnLevels: []string{"error"},
+	})
+	SetExitFunc(func(int) {})
+
+	WarnWithEmail(true, "disk slow")
+	FatalWithEmail(true, "config broken")
+	ErrorWithTraceAndEmail("trace-1", "span-1", true, "<b>db down</b>")
+	notifier.pending.Wait()
+
+	emails := sender.emails()
+	if len(emails) != 1 {
+		t.Fatalf("期望只发送OnLevels中级别的邮件，得到 %+v", emails)
+	}
+	body := emails[0].body
+	if !strings.Contains(body, "&lt;b&gt;db down&lt;/b&gt;") || strings.Contains(body, "<b>db down") {
+		t.Errorf("期望消息内容被转义，得到 %s", body)
+	}
+	if !strings.Contains(body, "trace-1") || !strings.Contains(body, "span-1") {
+		t.Errorf("期望邮件包含TraceID和SpanID，得到 %s", body)
+	}
+	if !strings.Contains(body, "email_test.go") {
+		t.Errorf("期望调用位置指向调用方，得到 %s", body)
+	}
+}
+
+func TestFatalWithEmailSendsBeforeExit(t *testing.T) {
+	_, sender := useRecordingSender(t, &EmailConfig{Enabled: true, ToEmail: "ops@example.com"})
+
+	// 异步发送的错误邮件较慢，退出前也需要等待完成
+	send := sender.send
+	getEmailNotifier().send = func(to, subject, body string) error {
+		if strings.HasPrefix(subject, "[ERROR]") {
+			time.Sleep(50 * time.Millisecond)
+		}
+		return send(to, subject, body)
+	}
+
+	var sentAtExit []int
+	SetExitFunc(func(code int) {
+		sentAtExit = append(sentAtExit, len(sender.emails()), code)
+	})
+	ErrorWithEmail(true, "db down")
+	FatalfWithEmail(true, "config broken: %s", "missing key")
+
+	if len(sentAtExit) != 2 || sentAtExit[0] != 2 || sentAtExit[1] != 1 {
+		t.Fatalf("期望退出前已发送两封邮件并以1退出，得到 %v", sentAtExit)
+	}
+	if body := sender.emails()[0].body; !strings.Contains(body, "config broken: missing key") {
+		t.Errorf("期望同步发送的致命错误邮件先完成，得到 %s", body)
+	}
+}
+
+// fakeClock 手动推进的时钟
+type fakeClock struct {
+	mutex sync.Mutex
+	t     time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func TestEmailDigest(t *testing.T) {
+	_, sender := useRecordingSender(t, &EmailConfig{Throttle: 5 * time.Minute})
+	clock := &fakeClock{t: time.Date(2024, 1, 15, 10, 0, 0, 0, time.Local)}
+	ticks := make(chan time.Time)
+	notifier := newEmailNotifier(&EmailConfig{
+		Enabled:        true,
+		ToEmail:        "ops@example.com",
+		OnLevels:       []string{"error", "fatal", "panic"},
+		Digest:         true,
+		DigestInterval: 30 * time.Minute,
+	}, clock.now, ticks)
+	notifier.send = sender.send
+	emailMutex.Lock()
+	globalEmailNotifier = notifier
+	emailMutex.Unlock()
+
+	for i := 0; i < 3; i++ {
+		ErrorfWithTraceAndEmail(fmt.Sprintf("trace-%d", i), "span", true, "db timeout after %dms", 100+i)
+		clock.advance(time.Minute)
+	}
+	ErrorWithEmail(true, "<cache> miss")
+	WarnWithEmail(true, "not in OnLevels")
+	func() {
+		defer func() { recover() }()
+		PanicWithEmail(true, "out of memory")
+	}()
+	notifier.pending.Wait()
+
+	// panic立即发送，其余通知等待摘要
+	emails := sender.emails()
+	if len(emails) != 1 || !strings.HasPrefix(emails[0].subject, "[PANIC]") {
+		t.Fatalf("期望只立即发送panic邮件，得到 %+v", emails)
+	}
+
+	clock.advance(26 * time.Minute)
+	ticks <- clock.now()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(sender.emails()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	emails = sender.emails()
+	if len(emails) != 2 {
+		t.Fatalf("期望定时发送一封摘要，得到 %+v", emails)
+	}
+	digest := emails[1]
+	if want := "[DIGEST] 系统日志摘要 - 5条通知 (2024-01-15 10:00:00 - 2024-01-15 10:29:00)"; digest.subject != want {
+		t.Errorf("期望主题 %q，得到 %q", want, digest.subject)
+	}
+	for _, want := range []string{
+		"db timeout after &lt;n&gt;ms", "<td>3</td>", "trace-0<br>trace-1<br>trace-2",
+		"&lt;cache&gt; miss", "PANIC", "10:02:00",
+	} {
+		if !strings.Contains(digest.body, want) {
+			t.Errorf("期望摘要包含 %q，得到 %s", want, digest.body)
+		}
+	}
+	if strings.Contains(digest.body, "not in OnLevels") {
+		t.Errorf("期望摘要不包含不在OnLevels中的通知，得到 %s", digest.body)
+	}
+
+	// 周期内没有通知时不发送
+	clock.advance(30 * time.Minute)
+	notifier.sendDigest()
+	if n := len(sender.emails()); n != 2 {
+		t.Errorf("期望空周期不发送摘要，得到 %d 封邮件", n)
+	}
+
+	// 关闭时发送最后一份摘要，之后不再发送
+	ErrorWithEmail(true, "shutting down")
+	notifier.Close()
+	notifier.Close()
+	ErrorWithEmail(true, "after close")
+	notifier.Flush()
+	emails = sender.emails()
+	if len(emails) != 3 || !strings.Contains(emails[2].subject, "1条通知") || !strings.Contains(emails[2].body, "shutting down") {
+		t.Fatalf("期望关闭时发送包含 1 条通知的摘要，得到 %+v", emails)
+	}
+}
+
+func TestEmailThrottlePerKey(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)}
+	notifier := newEmailNotifier(&EmailConfig{
+		Enabled:  true,
+		ToEmail:  "ops@example.com, dba@example.com",
+		Throttle: time.Minute,
+	}, clock.now, nil)
+	sender := &recordingSender{}
+	notifier.send = sender.send
+
+	notifyAt := func(message string) {
+		notifier.notify(LevelError, message, "", "")
+	}
+	for i := 0; i < 3; i++ {
+		notifyAt(fmt.Sprintf("db timeout after %dms", i)) // 归一化后为同一类
+		notifyAt("disk full")
+	}
+	notifier.notify(LevelFatal, "disk full", "", "")
+	notifier.pending.Wait()
+
+	// 每类通知发送给每个收件人一次，不同级别分别限流
+	perRecipient := make(map[string]int)
+	for _, email := range sender.emails() {
+		perRecipient[email.to]++
+	}
+	if len(perRecipient) != 2 || perRecipient["ops@example.com"] != 3 || perRecipient["dba@example.com"] != 3 {
+		t.Fatalf("期望每个收件人收到 3 封邮件，得到 %v", perRecipient)
+	}
+	stats := notifier.Stats()
+	if stats.Sent != 6 || stats.Suppressed != 8 || len(stats.Throttled) != 6 || stats.Throttled[0].Suppressed != 2 {
+		t.Errorf("期望发送 6 封、抑制 8 次，得到 %+v", stats)
+	}
+
+	// 限流窗口过后重新发送，过期的键不出现在统计中
+	clock.advance(time.Minute)
+	notifyAt("disk full")
+	notifier.pending.Wait()
+	if n := len(sender.emails()); n != 8 {
+		t.Errorf("期望窗口过后重新发送，得到 %d 封邮件", n)
+	}
+	if stats := notifier.Stats(); len(stats.Throttled) != 2 || stats.Throttled[0].Suppressed != 0 {
+		t.Errorf("期望只剩重新发送的 2 个键，得到 %+v", stats.Throttled)
+	}
+}
+
+func TestEmailThrottleStress(t *testing.T) {
+	const capacity = 64
+	clock := &fakeClock{t: time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)}
+	notifier := newEmailNotifier(&EmailConfig{
+		Enabled:      true,
+		ToEmail:      "ops@example.com",
+		Throttle:     time.Hour,
+		ThrottleKeys: capacity,
+	}, clock.now, nil)
+	notifier.send = func(to, subject, body string) error { return nil }
+
+	// 并发发送大量不同的通知和少量重复的热点通知
+	hot := []notificationKey{
+		newNotificationKey(LevelError, "hot-a", ""),
+		newNotificationKey(LevelError, "hot-b", ""),
+	}
+	var hotSent [2]atomic.Int64
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				n := i % len(hot)
+				if notifier.shouldSendEmail(hot[n], "ops@example.com") {
+					hotSent[n].Add(1)
+				}
+				notifier.shouldSendEmail(newNotificationKey(LevelError, fmt.Sprintf("storm-%c-%c", 'a'+g, 'a'+i%26)+strings.Repeat("x", i/26), ""), "ops@example.com")
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	notifier.mutex.Lock()
+	keys, listLen := len(notifier.throttle.entries), notifier.throttle.order.Len()
+	notifier.mutex.Unlock()
+	if keys > capacity || listLen != keys {
+		t.Errorf("期望最多记录 %d 个键，得到 %d（列表 %d）", capacity, keys, listLen)
+	}
+	// 热点通知一直在使用，不会被淘汰，窗口内各只发送一次
+	for n := range hot {
+		if got := hotSent[n].Load(); got != 1 {
+			t.Errorf("期望热点通知 %d 只发送一次，得到 %d", n, got)
+		}
+	}
+	stats := notifier.Stats()
+	if stats.Sent+stats.Suppressed != 8*500*2 {
+		t.Errorf("期望每次通知都计入统计，得到 %+v", stats)
+	}
+	for _, stat := range stats.Throttled[:2] {
+		if stat.Suppressed != 8*250-1 {
+			t.Errorf("期望热点通知被抑制 %d 次，得到 %+v", 8*250-1, stat)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package logz
+
+import (
+	"container/list"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultEmailThrottleKeys 未设置EmailConfig.ThrottleKeys时限流最多记录的键数
+const DefaultEmailThrottleKeys = 1024
+
+// notificationKey 通知的级别和错误指纹，摘要按它汇总通知，限流时再加上收件人
+type notificationKey struct {
+	level       string
+	fingerprint string
+}
+
+// newNotificationKey 根据级别、消息和调用位置（"文件:行号"）计算通知的键
+func newNotificationKey(level, message, caller string) notificationKey {
+	return notificationKey{level: strings.ToLower(level), fingerprint: ErrorFingerprint(message, caller)}
+}
+
+// throttleKey 限流的键：同一收件人的同级别同类通知在Throttle内只发送一次
+type throttleKey struct {
+	notificationKey
+	recipient string
+}
+
+// throttleEntry 一个限流键最近一次发送的时间和之后被抑制的次数
+type throttleEntry struct {
+	key        throttleKey
+	lastSent   time.Time
+	suppressed int
+}
+
+// throttleCache 按最近使用顺序排列、容量有限的限流记录，超过Throttle的记录视为过期
+// 不是并发安全的，由EmailNotifier.mutex保护
+type throttleCache struct {
+	capacity int
+	ttl      time.Duration
+	entries  map[throttleKey]*list.Element
+	order    *list.List // 最近使用的在前
+}
+
+// newThrottleCache 创建最多记录capacity个键、记录在ttl后过期的限流缓存
+func newThrottleCache(capacity int, ttl time.Duration) *throttleCache {
+	if capacity <= 0 {
+		capacity = DefaultEmailThrottleKeys
+	}
+	return &throttleCache{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  make(map[throttleKey]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// allow 检查key在now时是否可以发送，可以发送时记录发送时间，否则计入被抑制的次数
+// ttl不大于0时不限流，也不记录
+func (c *throttleCache) allow(key throttleKey, now time.Time) bool {
+	if c.ttl <= 0 {
+		return true
+	}
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*throttleEntry)
+		c.order.MoveToFront(elem)
+		if now.Sub(entry.lastSent) < c.ttl {
+			entry.suppressed++
+			return false
+		}
+		entry.lastSent = now
+		entry.suppressed = 0
+		return true
+	}
+
+	c.evict(now)
+	c.entries[key] = c.order.PushFront(&throttleEntry{key: key, lastSent: now})
+	return true
+}
+
+// evict 从最久未使用的一端删除过期的记录，再删除超出容量的记录，为新记录留出位置
+func (c *throttleCache) evict(now time.Time) {
+	for elem := c.order.Back(); elem != nil; elem = c.order.Back() {
+		entry := elem.Value.(*throttleEntry)
+		if len(c.entries) < c.capacity && now.Sub(entry.lastSent) < c.ttl {
+			return
+		}
+		c.order.Remove(elem)
+		delete(c.entries, entry.key)
+	}
+}
+
+// EmailThrottleStat 一个限流键在当前限流窗口内的状态
+type EmailThrottleStat struct {
+	Level       string    `json:"level"`
+	Recipient   string    `json:"recipient"`
+	Fingerprint string    `json:"fingerprint"`
+	LastSent    time.Time `json:"last_sent"`
+	Suppressed  int       `json:"suppressed"` // 最近一次发送之后被抑制的通知数
+}
+
+// EmailStats 邮件通知器的发送和限流统计
+type EmailStats struct {
+	Sent       int64               `json:"sent"`       // 通过限流的通知邮件数（按收件人计），不含摘要邮件
+	Suppressed int64               `json:"suppressed"` // 被限流抑制的通知数（按收件人计）
+	Throttled  []EmailThrottleStat `json:"throttled"`  // 未过期的限流键，按被抑制次数从多到少排列
+}
+
+// Stats 返回通知器的发送和限流统计
+func (n *EmailNotifier) Stats() EmailStats {
+	now := n.now()
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	stats := EmailStats{Sent: n.sent, Suppressed: n.suppressed, Throttled: []EmailThrottleStat{}}
+	for elem := n.throttle.order.Front(); elem != nil; elem = elem.Next() {
+		entry := elem.Value.(*throttleEntry)
+		if now.Sub(entry.lastSent) >= n.throttle.ttl {
+			continue
+		}
+		stats.Throttled = append(stats.Throttled, EmailThrottleStat{
+			Level:       entry.key.level,
+			Recipient:   entry.key.recipient,
+			Fingerprint: entry.key.fingerprint,
+			LastSent:    entry.lastSent,
+			Suppressed:  entry.suppressed,
+		})
+	}
+	sort.SliceStable(stats.Throttled, func(i, j int) bool {
+		return stats.Throttled[i].Suppressed > stats.Throttled[j].Suppressed
+	})
+	return stats
+}
@@ -0,0 +1,113 @@
+package logz
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WithErrorDetailed记录的错误字段
+const (
+	ErrorStackKey = "error.stack" // 调用栈，每帧两行：函数名和缩进的文件:行号
+	ErrorChainKey = "error.chain" // 被包装的错误链，从外到内，只有包装了其他错误时才记录
+)
+
+// 调用栈记录的最大帧数
+const maxStackFrames = 32
+
+// logzPackagePrefix logz包中函数名的前缀，调用栈中跳过这些帧（测试文件除外）
+const logzPackagePrefix = "github.com/HsiaoL1/trace/logz."
+
+// ErrorWithStack 输出带调用栈和错误链的error级别日志，args为空时使用err.Error()作为消息
+func ErrorWithStack(err error, args ...any) {
+	entry := defaultLogger.WithErrorDetailed(err)
+	if len(args) == 0 && err != nil {
+		args = []any{err.Error()}
+	}
+	entry.Error(args...)
+}
+
+// WithErrorDetailed 添加错误、调用栈和错误链字段
+func WithErrorDetailed(err error) *logrus.Entry {
+	return defaultLogger.WithErrorDetailed(err)
+}
+
+// WithErrorDetailed 添加错误、调用栈和错误链字段
+// 错误链中有提供StackTrace()的错误时使用最内层的调用栈，否则记录调用处的调用栈（跳过logz内部的帧）
+func (l *DefaultLogger) WithErrorDetailed(err error) *logrus.Entry {
+	return l.logrus.WithFields(errorDetailFields(err))
+}
+
+// errorDetailFields 返回错误、调用栈和错误链字段
+func errorDetailFields(err error) logrus.Fields {
+	if err == nil {
+		return logrus.Fields{}
+	}
+	fields := logrus.Fields{logrus.ErrorKey: err.Error()}
+
+	var chain []string
+	stack := ""
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		chain = append(chain, fmt.Sprintf("%T: %v", e, e))
+		if trace := errorStackTrace(e); trace != "" {
+			stack = trace
+		}
+	}
+	if len(chain) > 1 {
+		fields[ErrorChainKey] = chain
+	}
+	if stack == "" {
+		stack = callerStack()
+	}
+	if stack != "" {
+		fields[ErrorStackKey] = stack
+	}
+	return fields
+}
+
+// errorStackTrace 调用错误的StackTrace()方法（如github.com/pkg/errors创建的错误）并以%+v格式化
+// 通过反射调用以避免依赖具体的返回类型，错误没有此方法时返回空字符串
+func errorStackTrace(err error) string {
+	method := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !method.IsValid() || method.Type().NumIn() != 0 || method.Type().NumOut() != 1 {
+		return ""
+	}
+	trace := fmt.Sprintf("%+v", method.Call(nil)[0].Interface())
+	return strings.TrimSpace(trace)
+}
+
+// callerStack 返回当前调用栈，跳过logz内部和runtime的帧
+func callerStack() string {
+	pcs := make([]uintptr, maxStackFrames+16)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var b strings.Builder
+	count := 0
+	for count < maxStackFrames {
+		frame, more := frames.Next()
+		if !isInternalFrame(frame) {
+			if count > 0 {
+				b.WriteByte('\n')
+			}
+			fmt.Fprintf(&b, "%s\n\t%s:%d", frame.Function, frame.File, frame.Line)
+			count++
+		}
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+// isInternalFrame 是否为logz内部（测试文件除外）或runtime的帧
+func isInternalFrame(frame runtime.Frame) bool {
+	if strings.HasPrefix(frame.Function, "runtime.") {
+		return true
+	}
+	return strings.HasPrefix(frame.Function, logzPackagePrefix) && !strings.HasSuffix(frame.File, "_test.go")
+}
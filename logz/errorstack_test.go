@@ -0,0 +1,101 @@
+package logz
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeStack 模拟github.com/pkg/errors的StackTrace，只支持%+v
+type fakeStack []string
+
+func (s fakeStack) Format(f fmt.State, verb rune) {
+	for _, frame := range s {
+		fmt.Fprintf(f, "\n%s", frame)
+	}
+}
+
+// stackError 带调用栈的错误
+type stackError struct {
+	msg   string
+	stack fakeStack
+}
+
+func (e *stackError) Error() string         { return e.msg }
+func (e *stackError) StackTrace() fakeStack { return e.stack }
+
+// captureDefaultLogger 将默认日志器替换为输出JSON到缓冲区的日志器
+func captureDefaultLogger(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	previous := GetDefaultLogger()
+	SetDefaultLogger(NewDefaultLogger(&LoggerConfig{Level: LevelInfo, Format: FormatJSON, Output: &buf}))
+	t.Cleanup(func() { SetDefaultLogger(previous) })
+	return &buf
+}
+
+// decodeLogLine 解析一行JSON日志
+func decodeLogLine(t *testing.T, buf *bytes.Buffer) map[string]any {
+	t.Helper()
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("解析日志失败: %v\n%s", err, buf.String())
+	}
+	buf.Reset()
+	return line
+}
+
+func TestErrorWithStack(t *testing.T) {
+	buf := captureDefaultLogger(t)
+	base := errors.New("connection refused")
+	err := fmt.Errorf("load order 42: %w", base)
+
+	_, file, line, _ := runtime.Caller(0)
+	ErrorWithStack(err) // 调用栈的第一帧应指向这一行
+
+	entry := decodeLogLine(t, buf)
+	if entry["level"] != "error" || entry["msg"] != err.Error() || entry["error"] != err.Error() {
+		t.Errorf("期望error级别日志，消息和error字段为 %q，得到 %v", err.Error(), entry)
+	}
+
+	stack, _ := entry[ErrorStackKey].(string)
+	frames := strings.Split(stack, "\n")
+	if len(frames) < 2 || !strings.HasSuffix(frames[0], ".TestErrorWithStack") || frames[1] != fmt.Sprintf("\t%s:%d", file, line+1) {
+		t.Fatalf("期望调用栈从调用处开始，得到:\n%s", stack)
+	}
+	for _, frame := range frames {
+		if strings.Contains(frame, "logz/errorstack.go") || strings.HasPrefix(frame, "github.com/sirupsen/logrus") {
+			t.Errorf("调用栈不应包含logz和logrus内部的帧: %s", frame)
+		}
+	}
+
+	chain, _ := entry[ErrorChainKey].([]any)
+	if len(chain) != 2 || chain[0] != "*fmt.wrapError: load order 42: connection refused" || chain[1] != "*errors.errorString: connection refused" {
+		t.Errorf("错误链错误: %v", chain)
+	}
+
+	// 指定消息时使用指定的消息，未包装其他错误时不记录错误链
+	ErrorWithStack(base, "query failed")
+	entry = decodeLogLine(t, buf)
+	if entry["msg"] != "query failed" || entry[ErrorChainKey] != nil || entry[ErrorStackKey] == nil {
+		t.Errorf("期望消息为query failed且没有错误链，得到 %v", entry)
+	}
+}
+
+func TestWithErrorDetailedUsesErrorStackTrace(t *testing.T) {
+	buf := captureDefaultLogger(t)
+	origin := &stackError{msg: "disk io", stack: fakeStack{"main.origin", "\t/src/origin.go:10"}}
+	WithErrorDetailed(fmt.Errorf("flush: %w", origin)).Warn("flush failed")
+
+	entry := decodeLogLine(t, buf)
+	if entry["level"] != "warning" || entry[ErrorStackKey] != "main.origin\n\t/src/origin.go:10" {
+		t.Errorf("期望使用错误自带的调用栈，得到 %v", entry)
+	}
+	if WithErrorDetailed(nil).Data[ErrorStackKey] != nil {
+		t.Error("err为nil时不应记录调用栈")
+	}
+}
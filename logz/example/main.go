@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/HsiaoL1/trace/logz"
+	"github.com/HsiaoL1/trace/logz/aggregate"
 	"github.com/sirupsen/logrus"
 )
 
@@ -121,7 +122,7 @@ func demonstrateAggregationFeatures() {
 	fmt.Println("\n=== 演示日志聚合功能 ===")
 
 	// 初始化带聚合功能的日志系统
-	err := logz.InitWithAggregation(
+	err := aggregate.InitWithAggregation(
 		"./logs/app.log",    // 普通日志文件
 		"./logs/aggregated", // 聚合日志目录
 		"user-service",      // 服务名
@@ -132,7 +133,7 @@ func demonstrateAggregationFeatures() {
 		log.Printf("初始化聚合日志系统失败: %v", err)
 		return
 	}
-	defer logz.CloseAggregator()
+	defer aggregate.CloseAggregator()
 
 	// 生成一些测试日志
 	generateTestLogs()
@@ -181,7 +182,7 @@ func demonstrateQueryFeatures() {
 
 	// 1. 根据TraceID查询
 	fmt.Println("1. 根据TraceID查询:")
-	result, err := logz.QueryLogsByTraceID("trace-001", "./logs/aggregated", 10, 0)
+	result, err := aggregate.QueryLogsByTraceID("trace-001", "./logs/aggregated", 10, 0)
 	if err != nil {
 		fmt.Printf("查询失败: %v\n", err)
 	} else {
@@ -196,7 +197,7 @@ func demonstrateQueryFeatures() {
 	fmt.Println("\n2. 根据时间范围查询:")
 	startTime := time.Now().Add(-1 * time.Hour)
 	endTime := time.Now()
-	result, err = logz.QueryLogsByTimeRange(startTime, endTime, "./logs/aggregated", 5, 0)
+	result, err = aggregate.QueryLogsByTimeRange(startTime, endTime, "./logs/aggregated", 5, 0)
 	if err != nil {
 		fmt.Printf("查询失败: %v\n", err)
 	} else {
@@ -209,7 +210,7 @@ func demonstrateQueryFeatures() {
 
 	// 3. 根据日志级别查询
 	fmt.Println("\n3. 根据日志级别查询:")
-	result, err = logz.QueryLogsByLevel("error", "./logs/aggregated", 10, 0)
+	result, err = aggregate.QueryLogsByLevel("error", "./logs/aggregated", 10, 0)
 	if err != nil {
 		fmt.Printf("查询失败: %v\n", err)
 	} else {
@@ -225,7 +226,7 @@ func demonstrateStatsFeatures() {
 	fmt.Println("\n演示统计功能:")
 
 	// 获取日志统计信息
-	stats, err := logz.GetLogStatsDefault("./logs/aggregated")
+	stats, err := aggregate.GetLogStatsDefault("./logs/aggregated")
 	if err != nil {
 		fmt.Printf("获取统计信息失败: %v\n", err)
 		return
@@ -249,7 +250,7 @@ func demonstrateCleanupFeatures() {
 
 	// 清理一周前的日志文件
 	fmt.Println("清理一周前的日志文件...")
-	err := logz.CleanupOldLogsDefault("./logs/aggregated")
+	err := aggregate.CleanupOldLogsDefault("./logs/aggregated")
 	if err != nil {
 		fmt.Printf("清理失败: %v\n", err)
 	} else {
@@ -258,7 +259,7 @@ func demonstrateCleanupFeatures() {
 
 	// 清理后再次获取统计信息
 	fmt.Println("\n清理后的统计信息:")
-	stats, err := logz.GetLogStatsDefault("./logs/aggregated")
+	stats, err := aggregate.GetLogStatsDefault("./logs/aggregated")
 	if err != nil {
 		fmt.Printf("获取统计信息失败: %v\n", err)
 		return
@@ -272,7 +273,7 @@ func demonstrateLargeScaleFeatures() {
 	fmt.Println("\n=== 大规模日志处理演示 ===")
 
 	// 初始化针对大规模日志优化的聚合器
-	err := logz.InitWithAggregation(
+	err := aggregate.InitWithAggregation(
 		"./logs/large-scale.log", // 普通日志文件
 		"./logs/large-scale-agg", // 聚合日志目录
 		"high-volume-service",    // 服务名
@@ -283,7 +284,7 @@ func demonstrateLargeScaleFeatures() {
 		log.Printf("初始化大规模日志系统失败: %v", err)
 		return
 	}
-	defer logz.CloseAggregator()
+	defer aggregate.CloseAggregator()
 
 	// 演示大规模日志生成
 	demonstrateLargeScaleLogging()
@@ -379,32 +380,32 @@ func demonstrateHighPerformanceQuery() {
 	// 测试索引查询性能
 	testQueries := []struct {
 		name string
-		fn   func() (*logz.LogQueryResult, error)
+		fn   func() (*aggregate.LogQueryResult, error)
 	}{
 		{
 			name: "TraceID索引查询",
-			fn: func() (*logz.LogQueryResult, error) {
-				return logz.QueryLogsByTraceID("trace-user-001", "./logs/large-scale-agg", 100, 0)
+			fn: func() (*aggregate.LogQueryResult, error) {
+				return aggregate.QueryLogsByTraceID("trace-user-001", "./logs/large-scale-agg", 100, 0)
 			},
 		},
 		{
 			name: "SpanID索引查询",
-			fn: func() (*logz.LogQueryResult, error) {
-				return logz.QueryLogsBySpanID("span-db", "./logs/large-scale-agg", 100, 0)
+			fn: func() (*aggregate.LogQueryResult, error) {
+				return aggregate.QueryLogsBySpanID("span-db", "./logs/large-scale-agg", 100, 0)
 			},
 		},
 		{
 			name: "级别索引查询",
-			fn: func() (*logz.LogQueryResult, error) {
-				return logz.QueryLogsByLevel("error", "./logs/large-scale-agg", 100, 0)
+			fn: func() (*aggregate.LogQueryResult, error) {
+				return aggregate.QueryLogsByLevel("error", "./logs/large-scale-agg", 100, 0)
 			},
 		},
 		{
 			name: "时间范围查询",
-			fn: func() (*logz.LogQueryResult, error) {
+			fn: func() (*aggregate.LogQueryResult, error) {
 				startTime := time.Now().Add(-1 * time.Hour)
 				endTime := time.Now()
-				return logz.QueryLogsByTimeRange(startTime, endTime, "./logs/large-scale-agg", 100, 0)
+				return aggregate.QueryLogsByTimeRange(startTime, endTime, "./logs/large-scale-agg", 100, 0)
 			},
 		},
 	}
@@ -430,7 +431,7 @@ func demonstrateIndexFeatures() {
 
 	// 使用索引查询
 	startTime := time.Now()
-	resultWithIndex, err := logz.QueryLogsWithIndex(logz.LogQuery{
+	resultWithIndex, err := aggregate.QueryLogsWithIndex(aggregate.LogQuery{
 		TraceID: traceID,
 		Limit:   100,
 		Offset:  0,
@@ -439,7 +440,7 @@ func demonstrateIndexFeatures() {
 
 	// 不使用索引查询
 	startTime = time.Now()
-	resultWithoutIndex, err2 := logz.QueryLogsWithoutIndex(logz.LogQuery{
+	resultWithoutIndex, err2 := aggregate.QueryLogsWithoutIndex(aggregate.LogQuery{
 		TraceID: traceID,
 		Limit:   100,
 		Offset:  0,
@@ -474,7 +475,7 @@ func demonstrateConcurrentProcessing() {
 			defer wg.Done()
 
 			startTime := time.Now()
-			result, err := logz.QueryLogsByTraceID(
+			result, err := aggregate.QueryLogsByTraceID(
 				fmt.Sprintf("trace-user-%03d", queryID%10),
 				"./logs/large-scale-agg",
 				10,
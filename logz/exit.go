@@ -0,0 +1,62 @@
+package logz
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// emailFlushTimeout 致命错误退出前等待异步邮件发送完成的最长时间
+const emailFlushTimeout = 10 * time.Second
+
+var (
+	exitFunc  = os.Exit
+	exitMutex sync.RWMutex
+)
+
+// SetExitFunc 设置致命错误日志退出进程的函数，默认为os.Exit，传入nil时恢复默认
+// Fatal系列函数先关闭聚合器和日志输出，等待异步邮件发送完成，再调用此函数
+func SetExitFunc(fn func(code int)) {
+	if fn == nil {
+		fn = os.Exit
+	}
+	exitMutex.Lock()
+	exitFunc = fn
+	exitMutex.Unlock()
+}
+
+// exit 作为logrus的退出函数：刷新聚合器的批量缓冲区、syslog队列和邮件队列后退出进程
+func exit(code int) {
+	if err := Close(); err != nil {
+		fmt.Fprintf(os.Stderr, "[退出] 关闭日志失败: %v\n", err)
+	}
+	emailMutex.RLock()
+	notifier := globalEmailNotifier
+	emailMutex.RUnlock()
+	if notifier != nil && !notifier.flush(emailFlushTimeout) {
+		fmt.Fprintf(os.Stderr, "[退出] 等待邮件发送超时(%s)\n", emailFlushTimeout)
+	}
+
+	exitMutex.RLock()
+	fn := exitFunc
+	exitMutex.RUnlock()
+	fn(code)
+}
+
+// flush 发送摘要模式下累积的通知并等待异步发送的邮件完成，超时返回false
+func (n *EmailNotifier) flush(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		n.Flush()
+		close(done)
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
@@ -0,0 +1,179 @@
+package logz
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrNoFileOutput 未配置文件输出
+var ErrNoFileOutput = errors.New("未配置日志文件输出")
+
+// ErrLogFileRotated 日志文件已被外部轮转或删除
+var ErrLogFileRotated = errors.New("日志文件已被轮转或删除")
+
+// DefaultWatchInterval 文件输出监控的默认检查间隔
+const DefaultWatchInterval = 5 * time.Second
+
+// swapFile 将日志输出切换到新文件并关闭旧文件，调用方需持有锁
+func (l *DefaultLogger) swapFile(file *os.File) {
+	info, err := file.Stat()
+	if err != nil {
+		info = nil
+	}
+
+	// logrus在写入时持有自身的锁，切换后旧文件上不会再有写入
+	l.logrus.SetOutput(file)
+	if l.file != nil {
+		l.file.Close()
+	}
+	l.file = file
+	l.fileInfo = info
+}
+
+// FileOutputExists 配置的日志文件路径是否存在
+func (l *DefaultLogger) FileOutputExists() bool {
+	l.mutex.RLock()
+	path := l.config.FilePath
+	l.mutex.RUnlock()
+
+	if path == "" {
+		return false
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// ValidateFileOutput 检查当前写入的文件是否仍是配置路径上的文件
+// 文件被外部轮转或删除时返回ErrLogFileRotated
+func (l *DefaultLogger) ValidateFileOutput() error {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return l.validateFileOutput()
+}
+
+// validateFileOutput 检查文件输出，调用方需持有锁
+func (l *DefaultLogger) validateFileOutput() error {
+	if l.file == nil || l.config.FilePath == "" {
+		return ErrNoFileOutput
+	}
+
+	info, err := os.Stat(l.config.FilePath)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s 不存在", ErrLogFileRotated, l.config.FilePath)
+	}
+	if err != nil {
+		return fmt.Errorf("获取日志文件信息失败: %w", err)
+	}
+	if l.fileInfo == nil || !os.SameFile(info, l.fileInfo) {
+		return fmt.Errorf("%w: %s 已被替换", ErrLogFileRotated, l.config.FilePath)
+	}
+	return nil
+}
+
+// ReopenLogFile 重新打开配置路径上的日志文件，用于外部轮转之后
+func (l *DefaultLogger) ReopenLogFile() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.config.FilePath == "" {
+		return ErrNoFileOutput
+	}
+	return l.setFileOutput(l.config.FilePath)
+}
+
+// WatchFileOutput 启动后台检查，发现日志文件被轮转或删除时自动重新打开
+// 重复调用会替换之前的监控，Close会停止监控
+func (l *DefaultLogger) WatchFileOutput(interval time.Duration) error {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	l.stopWatch()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file == nil {
+		return ErrNoFileOutput
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	l.watchStop = stop
+	l.watchDone = done
+	go l.watchFileOutput(interval, stop, done)
+	return nil
+}
+
+// watchFileOutput 文件输出监控循环
+func (l *DefaultLogger) watchFileOutput(interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			l.mutex.Lock()
+			if errors.Is(l.validateFileOutput(), ErrLogFileRotated) {
+				if err := l.setFileOutput(l.config.FilePath); err != nil {
+					fmt.Fprintf(os.Stderr, "重新打开日志文件失败: %v\n", err)
+				}
+			}
+			l.mutex.Unlock()
+		}
+	}
+}
+
+// stopWatch 停止文件输出监控
+func (l *DefaultLogger) stopWatch() {
+	l.mutex.Lock()
+	stop, done := l.watchStop, l.watchDone
+	l.watchStop, l.watchDone = nil, nil
+	l.mutex.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// Close 停止文件监控，关闭syslog输出和日志文件
+func (l *DefaultLogger) Close() error {
+	l.stopWatch()
+	l.CloseSyslogOutput()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	l.fileInfo = nil
+	return err
+}
+
+// ReopenLogFile 重新打开默认日志器的日志文件（全局函数），可在SIGHUP处理中调用
+func ReopenLogFile() error {
+	return defaultLogger.ReopenLogFile()
+}
+
+// WatchFileOutput 为默认日志器启动文件输出监控（全局函数）
+func WatchFileOutput(interval time.Duration) error {
+	return defaultLogger.WatchFileOutput(interval)
+}
+
+// ValidateFileOutput 检查默认日志器的文件输出（全局函数）
+func ValidateFileOutput() error {
+	return defaultLogger.ValidateFileOutput()
+}
+
+// FileOutputExists 默认日志器配置的日志文件是否存在（全局函数）
+func FileOutputExists() bool {
+	return defaultLogger.FileOutputExists()
+}
@@ -0,0 +1,109 @@
+package logz
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newFileLogger 创建输出到指定文件的日志器
+func newFileLogger(t *testing.T, path string) *DefaultLogger {
+	t.Helper()
+	logger := NewDefaultLogger(&LoggerConfig{
+		Level:    LevelInfo,
+		Format:   FormatJSON,
+		Output:   os.Stdout,
+		FilePath: path,
+	})
+	if logger.file == nil {
+		t.Fatalf("打开日志文件失败: %s", path)
+	}
+	t.Cleanup(func() { logger.Close() })
+	return logger
+}
+
+// readFile 读取文件内容
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("读取文件失败: %v", err)
+	}
+	return string(data)
+}
+
+func TestReopenLogFileAfterRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	logger := newFileLogger(t, path)
+
+	logger.Info("before rotation")
+	if err := logger.ValidateFileOutput(); err != nil {
+		t.Fatalf("期望文件输出有效，得到 %v", err)
+	}
+
+	rotated := path + ".1"
+	if err := os.Rename(path, rotated); err != nil {
+		t.Fatalf("重命名日志文件失败: %v", err)
+	}
+	if err := logger.ValidateFileOutput(); !errors.Is(err, ErrLogFileRotated) {
+		t.Fatalf("期望ErrLogFileRotated，得到 %v", err)
+	}
+
+	if err := logger.ReopenLogFile(); err != nil {
+		t.Fatalf("重新打开日志文件失败: %v", err)
+	}
+	logger.Info("after rotation")
+
+	if content := readFile(t, rotated); !strings.Contains(content, "before rotation") || strings.Contains(content, "after rotation") {
+		t.Errorf("轮转后的文件内容错误: %s", content)
+	}
+	if content := readFile(t, path); !strings.Contains(content, "after rotation") {
+		t.Errorf("新文件应包含轮转后的日志: %s", content)
+	}
+}
+
+func TestWatchFileOutput(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	logger := newFileLogger(t, path)
+
+	if err := logger.WatchFileOutput(10 * time.Millisecond); err != nil {
+		t.Fatalf("启动文件监控失败: %v", err)
+	}
+
+	logger.Info("before rotation")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("重命名日志文件失败: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !logger.FileOutputExists() {
+		if time.Now().After(deadline) {
+			t.Fatal("监控未重新创建日志文件")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	logger.Info("after rotation")
+	if content := readFile(t, path); !strings.Contains(content, "after rotation") {
+		t.Errorf("新文件应包含轮转后的日志: %s", content)
+	}
+
+	if err := logger.Close(); err != nil {
+		t.Fatalf("关闭日志器失败: %v", err)
+	}
+	if logger.watchStop != nil {
+		t.Error("Close应停止文件监控")
+	}
+}
+
+func TestWatchFileOutputWithoutFile(t *testing.T) {
+	logger := NewDefaultLogger(nil)
+	if err := logger.WatchFileOutput(time.Second); !errors.Is(err, ErrNoFileOutput) {
+		t.Errorf("期望ErrNoFileOutput，得到 %v", err)
+	}
+}
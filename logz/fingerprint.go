@@ -0,0 +1,37 @@
+package logz
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+)
+
+// 归一化错误消息时替换为占位符的片段，邮件限流、摘要和aggregate的错误分组使用相同的指纹
+var (
+	uuidPattern   = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+	hexIDPattern  = regexp.MustCompile(`(?i)\b(?:0x)?[0-9a-f]{8,}\b`)
+	numberPattern = regexp.MustCompile(`\d+`)
+)
+
+// NormalizeErrorMessage 将消息中的UUID、十六进制ID和数字替换为占位符，使同类错误得到相同的消息
+func NormalizeErrorMessage(msg string) string {
+	msg = uuidPattern.ReplaceAllString(msg, "<id>")
+	msg = hexIDPattern.ReplaceAllStringFunc(msg, func(s string) string {
+		// 不含数字的片段可能是普通单词（如"deadbeef"），保留原样
+		if !strings.ContainsAny(s, "0123456789") {
+			return s
+		}
+		return "<hex>"
+	})
+	return numberPattern.ReplaceAllString(msg, "<n>")
+}
+
+// ErrorFingerprint 根据归一化后的消息和调用位置计算错误指纹
+func ErrorFingerprint(msg, caller string) string {
+	h := fnv.New64a()
+	h.Write([]byte(NormalizeErrorMessage(msg)))
+	h.Write([]byte{'|'})
+	h.Write([]byte(caller))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
@@ -0,0 +1,21 @@
+package logz
+
+import "testing"
+
+func TestNormalizeErrorMessage(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want string
+	}{
+		{"timeout after 31ms", "timeout after <n>ms"},
+		{"user 550e8400-e29b-41d4-a716-446655440000 not found", "user <id> not found"},
+		{"request 4bf92f3577b34da6 failed", "request <hex> failed"},
+		{"invalid deadbeef header", "invalid deadbeef header"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeErrorMessage(tt.msg); got != tt.want {
+			t.Errorf("NormalizeErrorMessage(%q) 期望 %q，得到 %q", tt.msg, tt.want, got)
+		}
+	}
+}
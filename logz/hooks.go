@@ -0,0 +1,201 @@
+package logz
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 内置功能注册的Hook名称，同名的Hook只保留最后注册的一个
+const (
+	HookNameBaggage    = "baggage"    // EnableBaggageFields
+	HookNameAggregator = "aggregator" // aggregate.InitWithAggregation、aggregate.InitForTesting
+	HookNameSyslog     = "syslog"     // SetSyslogOutput
+	HookNameCaller     = "caller"     // SetCallerLevels
+)
+
+// Hook优先级，数值小的先执行，相同优先级按注册顺序执行
+// 修改条目的Hook（补充字段、脱敏）排在聚合和输出之前，聚合文件和syslog收到的是修改后的条目
+const (
+	HookPriorityCaller     = 50   // 设置调用位置，在其他Hook读取条目之前
+	HookPriorityEnrich     = 100  // 补充字段，如baggage
+	HookPriorityRedaction  = 200  // 脱敏
+	HookPriorityDefault    = 500  // 没有特殊顺序要求的Hook；直接通过logrus.AddHook添加的Hook视为此优先级
+	HookPriorityAggregator = 700  // 写入聚合器
+	HookPriorityOutput     = 800  // syslog等附加输出
+	HookPriorityMetrics    = 1000 // 统计，最后执行
+)
+
+// HookInfo 已注册的命名Hook
+type HookInfo struct {
+	Name     string   `json:"name"`
+	Priority int      `json:"priority"`
+	Type     string   `json:"type"`
+	Levels   []string `json:"levels"`
+}
+
+// namedHook 日志器中注册的命名Hook
+type namedHook struct {
+	name     string
+	hook     logrus.Hook
+	priority int
+}
+
+// AddNamedHook 以name注册Hook，已有同名Hook时替换，被替换的Hook不再执行
+// Hook按priority从小到大执行，直接通过logrus.AddHook添加的Hook排在优先级小于HookPriorityDefault的命名Hook之后、其余命名Hook之前
+func (l *DefaultLogger) AddNamedHook(name string, hook logrus.Hook, priority int) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.setNamedHookLocked(name, hook, priority)
+}
+
+// RemoveHook 移除名为name的Hook，没有该Hook时返回false
+// 移除syslog输出时同时关闭连接，与CloseSyslogOutput相同；其他Hook持有的资源由调用方释放
+func (l *DefaultLogger) RemoveHook(name string) bool {
+	l.mutex.Lock()
+	removed := l.removeNamedHookLocked(name)
+	var syslog *SyslogHook
+	if removed != nil && removed == logrus.Hook(l.syslog) {
+		syslog, l.syslog = l.syslog, nil
+	}
+	l.mutex.Unlock()
+
+	if syslog != nil {
+		syslog.Close()
+	}
+	return removed != nil
+}
+
+// Hooks 按执行顺序返回已注册的命名Hook
+func (l *DefaultLogger) Hooks() []HookInfo {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	infos := make([]HookInfo, 0, len(l.hooks))
+	for _, nh := range l.hooks {
+		levels := make([]string, 0, len(nh.hook.Levels()))
+		for _, level := range nh.hook.Levels() {
+			levels = append(levels, level.String())
+		}
+		infos = append(infos, HookInfo{
+			Name:     nh.name,
+			Priority: nh.priority,
+			Type:     fmt.Sprintf("%T", nh.hook),
+			Levels:   levels,
+		})
+	}
+	return infos
+}
+
+// NamedHook 返回名为name的Hook，没有时返回nil
+func (l *DefaultLogger) NamedHook(name string) logrus.Hook {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	for _, nh := range l.hooks {
+		if nh.name == name {
+			return nh.hook
+		}
+	}
+	return nil
+}
+
+// setNamedHookLocked 注册或替换命名Hook并重建logrus的Hook列表，返回被替换的Hook，调用方需持有l.mutex
+func (l *DefaultLogger) setNamedHookLocked(name string, hook logrus.Hook, priority int) logrus.Hook {
+	previous := l.deleteNamedHookLocked(name)
+	// 插入到相同优先级的Hook之后，保持注册顺序
+	i := sort.Search(len(l.hooks), func(i int) bool { return l.hooks[i].priority > priority })
+	l.hooks = append(l.hooks, namedHook{})
+	copy(l.hooks[i+1:], l.hooks[i:])
+	l.hooks[i] = namedHook{name: name, hook: hook, priority: priority}
+	l.applyHooksLocked(previous)
+	return previous
+}
+
+// removeNamedHookLocked 移除命名Hook并重建logrus的Hook列表，返回被移除的Hook，调用方需持有l.mutex
+func (l *DefaultLogger) removeNamedHookLocked(name string) logrus.Hook {
+	previous := l.deleteNamedHookLocked(name)
+	if previous != nil {
+		l.applyHooksLocked(previous)
+	}
+	return previous
+}
+
+// deleteNamedHookLocked 从注册表中删除命名Hook，不修改logrus的Hook列表
+func (l *DefaultLogger) deleteNamedHookLocked(name string) logrus.Hook {
+	for i, nh := range l.hooks {
+		if nh.name == name {
+			l.hooks = append(l.hooks[:i], l.hooks[i+1:]...)
+			return nh.hook
+		}
+	}
+	return nil
+}
+
+// applyHooksLocked 按优先级重建logrus的Hook列表，removed为已从注册表删除、需要从logrus中移除的Hook
+// 不在注册表中的Hook（直接通过logrus.AddHook添加）保持原来的相对顺序
+func (l *DefaultLogger) applyHooksLocked(removed logrus.Hook) {
+	isNamed := func(h logrus.Hook) bool {
+		if removed != nil && h == removed {
+			return true
+		}
+		for _, nh := range l.hooks {
+			if nh.hook == h {
+				return true
+			}
+		}
+		return false
+	}
+
+	hooks := make(logrus.LevelHooks)
+	i := 0
+	for ; i < len(l.hooks) && l.hooks[i].priority < HookPriorityDefault; i++ {
+		hooks.Add(l.hooks[i].hook)
+	}
+	for level, levelHooks := range l.logrus.Hooks {
+		for _, h := range levelHooks {
+			if !isNamed(h) {
+				hooks[level] = append(hooks[level], h)
+			}
+		}
+	}
+	for ; i < len(l.hooks); i++ {
+		hooks.Add(l.hooks[i].hook)
+	}
+	l.logrus.ReplaceHooks(hooks)
+}
+
+// SaveHooks 保存命名Hook和logrus的Hook列表，返回恢复函数，用于测试中临时替换Hook
+func (l *DefaultLogger) SaveHooks() (restore func()) {
+	l.mutex.Lock()
+	named := append([]namedHook(nil), l.hooks...)
+	// 在新的map中修改Hook，恢复时原样放回之前的map
+	prev := l.logrus.ReplaceHooks(make(logrus.LevelHooks))
+	hooks := make(logrus.LevelHooks, len(prev))
+	for level, levelHooks := range prev {
+		hooks[level] = append([]logrus.Hook(nil), levelHooks...)
+	}
+	l.logrus.ReplaceHooks(hooks)
+	l.mutex.Unlock()
+
+	return func() {
+		l.mutex.Lock()
+		defer l.mutex.Unlock()
+		l.hooks = named
+		l.logrus.ReplaceHooks(prev)
+	}
+}
+
+// AddNamedHook 为默认日志器注册命名Hook（全局函数）
+func AddNamedHook(name string, hook logrus.Hook, priority int) {
+	GetDefaultLogger().AddNamedHook(name, hook, priority)
+}
+
+// RemoveHook 移除默认日志器的命名Hook（全局函数）
+func RemoveHook(name string) bool {
+	return GetDefaultLogger().RemoveHook(name)
+}
+
+// Hooks 返回默认日志器已注册的命名Hook（全局函数）
+func Hooks() []HookInfo {
+	return GetDefaultLogger().Hooks()
+}
@@ -0,0 +1,90 @@
+package logz
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// funcHook 对每条日志调用fire的Hook
+type funcHook struct {
+	fire func(entry *logrus.Entry)
+}
+
+func (h *funcHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (h *funcHook) Fire(entry *logrus.Entry) error {
+	h.fire(entry)
+	return nil
+}
+
+func TestNamedHooks(t *testing.T) {
+	logger := NewDefaultLogger(&LoggerConfig{Level: LevelDebug, Format: FormatJSON, Output: io.Discard})
+	var order []string
+	record := func(name string) *funcHook {
+		return &funcHook{fire: func(*logrus.Entry) { order = append(order, name) }}
+	}
+	redact := &funcHook{fire: func(entry *logrus.Entry) {
+		order = append(order, "redact")
+		if _, ok := entry.Data["password"]; ok {
+			entry.Data["password"] = "***"
+		}
+	}}
+
+	// 注册顺序与优先级相反，执行时按优先级排列
+	logger.AddNamedHook("metrics", record("metrics"), HookPriorityMetrics)
+	// 聚合Hook记录收到的password字段
+	var received []any
+	logger.AddNamedHook(HookNameAggregator, &funcHook{fire: func(entry *logrus.Entry) {
+		received = append(received, entry.Data["password"])
+	}}, HookPriorityAggregator)
+	logger.logrus.AddHook(record("plain"))
+	logger.AddNamedHook("redact", redact, HookPriorityRedaction)
+	logger.AddNamedHook("audit", record("audit"), HookPriorityDefault)
+
+	var names []string
+	for _, info := range logger.Hooks() {
+		names = append(names, info.Name)
+	}
+	if want := []string{"redact", "audit", HookNameAggregator, "metrics"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("期望Hook顺序 %v，得到 %v", want, names)
+	}
+
+	logger.WithField("password", "hunter2").Info("login")
+	if want := []string{"redact", "plain", "audit", "metrics"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("期望执行顺序 %v，得到 %v", want, order)
+	}
+	if len(received) != 1 || received[0] != "***" {
+		t.Fatalf("期望聚合Hook收到脱敏后的字段，得到 %v", received)
+	}
+
+	// 同名Hook被替换，移除后不再执行
+	logger.AddNamedHook("metrics", record("metrics2"), HookPriorityMetrics)
+	if !logger.RemoveHook("redact") || logger.RemoveHook("redact") {
+		t.Error("期望只能移除一次已注册的Hook")
+	}
+	order = nil
+	logger.WithField("password", "hunter2").Info("login")
+	if want := []string{"plain", "audit", "metrics2"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("期望执行顺序 %v，得到 %v", want, order)
+	}
+	if len(received) != 2 || received[1] != "hunter2" {
+		t.Errorf("期望移除脱敏Hook后聚合Hook收到原值，得到 %v", received)
+	}
+	if n := len(logger.logrus.Hooks[logrus.InfoLevel]); n != 4 {
+		t.Errorf("期望logrus中有 4 个Hook，得到 %d", n)
+	}
+}
+
+func TestInitWithAggregationRequiresAggregate(t *testing.T) {
+	// 本包的测试没有链接logz/aggregate，已弃用的InitWithAggregation返回错误，不修改日志器
+	if err := InitWithAggregation("", t.TempDir(), "svc", 0, 0); err == nil || !strings.Contains(err.Error(), "logz/aggregate") {
+		t.Errorf("期望提示导入logz/aggregate，得到 %v", err)
+	}
+	if hook := GetDefaultLogger().NamedHook(HookNameAggregator); hook != nil {
+		t.Errorf("期望没有注册聚合Hook，得到 %T", hook)
+	}
+}
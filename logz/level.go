@@ -0,0 +1,30 @@
+package logz
+
+import (
+	"strings"
+
+	"github.com/HsiaoL1/trace"
+)
+
+// ErrInvalidLevel 无法识别的日志级别
+var ErrInvalidLevel = trace.ErrInvalidLogLevel
+
+// NormalizeLevel 将日志级别规范化为 trace、debug、info、warn、error、fatal、panic 之一
+// 忽略大小写并支持常见别名（warning→warn、err→error等），无法识别时返回包含ErrInvalidLevel的错误，
+// 错误信息中列出所有可用级别
+func NormalizeLevel(level string) (string, error) {
+	return trace.NormalizeLogLevel(level)
+}
+
+// canonicalLevel 规范化日志级别，无法识别时返回去除空白的小写形式
+// 用于写入和查询路径，保证同一级别的不同写法得到相同的值
+func canonicalLevel(level string) string {
+	switch level {
+	case "trace", "debug", "info", "warn", "error", "fatal", "panic":
+		return level
+	}
+	if normalized, err := NormalizeLevel(level); err == nil {
+		return normalized
+	}
+	return strings.ToLower(strings.TrimSpace(level))
+}
@@ -0,0 +1,51 @@
+package logz
+
+import (
+	"errors"
+	"testing"
+)
+
+// levelAliasTests 每个级别写法及其规范化结果
+var levelAliasTests = []struct {
+	input string
+	want  string
+}{
+	{"trace", "trace"},
+	{"TRACE", "trace"},
+	{"debug", "debug"},
+	{"Debug", "debug"},
+	{"dbg", "debug"},
+	{"info", "info"},
+	{" INFO ", "info"},
+	{"information", "info"},
+	{"warn", "warn"},
+	{"WARN", "warn"},
+	{"warning", "warn"},
+	{"Warning", "warn"},
+	{"error", "error"},
+	{"ERROR", "error"},
+	{"err", "error"},
+	{"fatal", "fatal"},
+	{"Fatal", "fatal"},
+	{"panic", "panic"},
+	{"PANIC", "panic"},
+}
+
+func TestNormalizeLevel(t *testing.T) {
+	for _, tt := range levelAliasTests {
+		got, err := NormalizeLevel(tt.input)
+		if err != nil {
+			t.Errorf("NormalizeLevel(%q) 返回错误: %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeLevel(%q) 期望 %q，得到 %q", tt.input, tt.want, got)
+		}
+	}
+
+	for _, input := range []string{"", "verbose", "warnings", "critical"} {
+		if _, err := NormalizeLevel(input); !errors.Is(err, ErrInvalidLevel) {
+			t.Errorf("NormalizeLevel(%q) 期望 ErrInvalidLevel，得到 %v", input, err)
+		}
+	}
+}
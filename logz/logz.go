@@ -2,7 +2,9 @@ package logz
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"html/template"
 	"io"
 	"os"
 	"path/filepath"
@@ -39,6 +41,21 @@ type DefaultLogger struct {
 	logrus *logrus.Logger
 	mutex  sync.RWMutex
 	config *LoggerConfig
+
+	// 文件输出状态
+	file      *os.File
+	fileInfo  os.FileInfo
+	watchStop chan struct{}
+	watchDone chan struct{}
+
+	// syslog输出
+	syslog *SyslogHook
+
+	// 命名Hook，按执行顺序排列，见AddNamedHook
+	hooks []namedHook
+
+	// SetCallerLevels设置的级别，nil表示由logrus的ReportCaller决定是否记录调用位置
+	callerLevels []logrus.Level
 }
 
 // LoggerConfig 日志器配置
@@ -54,12 +71,21 @@ type LoggerConfig struct {
 
 // EmailConfig 邮件配置
 type EmailConfig struct {
-	Enabled   bool
-	ToEmail   string
-	OnLevels  []string // 哪些级别发送邮件
-	Throttle  time.Duration // 邮件限流
-	lastSent  time.Time
-	mutex     sync.Mutex
+	Enabled  bool
+	ToEmail  string        // 收件人，多个收件人用逗号分隔，每个收件人单独发送和限流
+	OnLevels []string      // 哪些级别发送邮件
+	Throttle time.Duration // 邮件限流：同一收件人的同级别同类通知（错误指纹相同）在此时间内只发送一次
+
+	// 限流最多记录的键数（级别、收件人、错误指纹），超出时淘汰最久未使用的，默认DefaultEmailThrottleKeys
+	ThrottleKeys int
+
+	// 摘要模式：通知不立即发送，按级别和错误指纹汇总后每隔DigestInterval（默认30分钟）发送一封摘要邮件，
+	// 期间没有通知时不发送；fatal和panic仍按限流立即发送，同时计入摘要
+	Digest         bool
+	DigestInterval time.Duration
+
+	lastSent time.Time
+	mutex    sync.Mutex
 }
 
 // RotationConfig 轮转配置
@@ -88,8 +114,9 @@ const (
 
 // 日志格式常量
 const (
-	FormatText = "text"
-	FormatJSON = "json"
+	FormatText    = "text"
+	FormatJSON    = "json"
+	FormatConsole = "console" // 带颜色和对齐的开发环境格式，见ConsoleFormatter
 )
 
 // 初始化函数
@@ -102,7 +129,7 @@ func init() {
 		EnableCaller: false,
 	}
 	defaultLogger = NewDefaultLogger(defaultConfig)
-	
+
 	// 兼容性设置
 	Logrus = defaultLogger.logrus
 }
@@ -117,12 +144,13 @@ func NewDefaultLogger(config *LoggerConfig) *DefaultLogger {
 			EnableCaller: false,
 		}
 	}
-	
+
 	logger := &DefaultLogger{
 		logrus: logrus.New(),
 		config: config,
 	}
-	
+	logger.logrus.ExitFunc = exit
+
 	logger.applyConfig()
 	return logger
 }
@@ -131,12 +159,12 @@ func NewDefaultLogger(config *LoggerConfig) *DefaultLogger {
 func (l *DefaultLogger) applyConfig() {
 	l.mutex.Lock()
 	defer l.mutex.Unlock()
-	
+
 	l.setLevel(l.config.Level)
 	l.setFormat(l.config.Format)
 	l.logrus.SetOutput(l.config.Output)
 	l.logrus.SetReportCaller(l.config.EnableCaller)
-	
+
 	if l.config.FilePath != "" {
 		l.setFileOutput(l.config.FilePath)
 	}
@@ -159,7 +187,9 @@ func SetDefaultLogger(logger *DefaultLogger) {
 
 // setLevel 设置日志级别（内部方法）
 func (l *DefaultLogger) setLevel(level string) {
-	switch strings.ToLower(level) {
+	switch canonicalLevel(level) {
+	case "trace":
+		l.logrus.SetLevel(logrus.TraceLevel)
 	case LevelDebug:
 		l.logrus.SetLevel(logrus.DebugLevel)
 	case LevelInfo:
@@ -189,17 +219,19 @@ func (l *DefaultLogger) setFormat(format string) {
 		filename := filepath.Base(f.File)
 		return "", fmt.Sprintf("%s:%d", filename, f.Line)
 	}
-	
+
 	switch strings.ToLower(format) {
 	case FormatJSON:
-		l.logrus.SetFormatter(&logrus.JSONFormatter{
+		l.installFormatter(&logrus.JSONFormatter{
 			TimestampFormat:  time.RFC3339,
 			CallerPrettyfier: callerPrettyfier,
 		})
+	case FormatConsole:
+		l.installFormatter(&ConsoleFormatter{})
 	case FormatText:
 		fallthrough
 	default:
-		l.logrus.SetFormatter(&logrus.TextFormatter{
+		l.installFormatter(&logrus.TextFormatter{
 			FullTimestamp:    true,
 			TimestampFormat:  time.RFC3339,
 			CallerPrettyfier: callerPrettyfier,
@@ -208,6 +240,12 @@ func (l *DefaultLogger) setFormat(format string) {
 	l.config.Format = format
 }
 
+// SetConsoleFormatter 使用自定义选项的控制台格式
+func SetConsoleFormatter(formatter *ConsoleFormatter) {
+	defaultLogger.installFormatter(formatter)
+	defaultLogger.config.Format = FormatConsole
+}
+
 // SetFormat 设置日志格式（全局函数，兼容性）
 func SetFormat(format string) {
 	defaultLogger.setFormat(format)
@@ -226,7 +264,7 @@ func (l *DefaultLogger) setFileOutput(filePath string) error {
 	if filePath == "" {
 		return fmt.Errorf("文件路径不能为空")
 	}
-	
+
 	// 确保目录存在
 	dir := filepath.Dir(filePath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -240,13 +278,15 @@ func (l *DefaultLogger) setFileOutput(filePath string) error {
 	}
 
 	// 设置输出到文件
-	l.logrus.SetOutput(file)
+	l.swapFile(file)
 	l.config.FilePath = filePath
 	return nil
 }
 
 // SetFileOutput 设置日志文件输出（全局函数，兼容性）
 func SetFileOutput(filePath string) error {
+	defaultLogger.mutex.Lock()
+	defer defaultLogger.mutex.Unlock()
 	return defaultLogger.setFileOutput(filePath)
 }
 
@@ -258,21 +298,22 @@ func SetFileOutputWithRotation(filePath string, maxSize int64, maxBackups int) e
 	if maxBackups <= 0 {
 		maxBackups = 3
 	}
-	
+
 	defaultLogger.config.RotationConfig = &RotationConfig{
 		MaxSize:    maxSize,
 		MaxBackups: maxBackups,
 		Enabled:    true,
 	}
-	
+
 	// TODO: 这里可以集成 logrotate 或其他轮转库
 	return SetFileOutput(filePath)
 }
 
-// EnableCaller 启用调用者信息（全局函数，兼容性）
+// EnableCaller 为所有级别启用调用者信息（全局函数，兼容性），取消SetCallerLevels的设置
 func EnableCaller() {
 	defaultLogger.mutex.Lock()
 	defer defaultLogger.mutex.Unlock()
+	defaultLogger.resetCallerLevelsLocked()
 	defaultLogger.logrus.SetReportCaller(true)
 	defaultLogger.config.EnableCaller = true
 }
@@ -281,38 +322,100 @@ func EnableCaller() {
 func DisableCaller() {
 	defaultLogger.mutex.Lock()
 	defer defaultLogger.mutex.Unlock()
+	defaultLogger.resetCallerLevelsLocked()
 	defaultLogger.logrus.SetReportCaller(false)
 	defaultLogger.config.EnableCaller = false
 }
 
 // EmailNotifier 邮件通知器
 type EmailNotifier struct {
-	config    *EmailConfig
-	throttle  map[string]time.Time
-	mutex     sync.Mutex
+	config   *EmailConfig
+	throttle *throttleCache // 由mutex保护
+	mutex    sync.Mutex
+	send     func(to, subject, body string) error // 发送邮件，默认为trace.SendEmail，测试中可替换
+	pending  sync.WaitGroup                       // 正在异步发送的邮件
+	now      func() time.Time                     // 时钟，测试中可替换
+
+	sent       int64 // 通过限流的通知数，由mutex保护
+	suppressed int64 // 被限流抑制的通知数，由mutex保护
+
+	// 摘要模式下当前周期累积的通知，由mutex保护；digestStop为nil时不是摘要模式
+	digest     *emailDigest
+	digestStop chan struct{}
+	digestDone chan struct{}
+
+	closed    bool
+	closeOnce sync.Once
 }
 
-// NewEmailNotifier 创建邮件通知器
+// NewEmailNotifier 创建邮件通知器，摘要模式下启动发送摘要的定时器，不再使用时调用Close
 func NewEmailNotifier(config *EmailConfig) *EmailNotifier {
+	return newEmailNotifier(config, time.Now, nil)
+}
+
+// newEmailNotifier 使用时钟now创建邮件通知器，摘要模式下ticks为nil时按DigestInterval创建Ticker
+func newEmailNotifier(config *EmailConfig, now func() time.Time, ticks <-chan time.Time) *EmailNotifier {
 	if config == nil {
 		config = &EmailConfig{
 			Enabled:  false,
 			Throttle: 5 * time.Minute,
 		}
 	}
-	
-	return &EmailNotifier{
+
+	n := &EmailNotifier{
 		config:   config,
-		throttle: make(map[string]time.Time),
+		throttle: newThrottleCache(config.ThrottleKeys, config.Throttle),
+		send:     trace.SendEmail,
+		now:      now,
+	}
+	if config.Enabled && config.Digest {
+		n.startDigest(ticks)
+	}
+	return n
+}
+
+// recipient 返回通知收件人：优先使用EmailConfig.ToEmail，为空时使用trace.SetEmail设置的默认收件人
+func (n *EmailNotifier) recipient() string {
+	if n.config.ToEmail != "" {
+		return n.config.ToEmail
 	}
+	return trace.GetEmail()
 }
 
-// shouldSendEmail 检查是否应该发送邮件
-func (n *EmailNotifier) shouldSendEmail(level string) bool {
-	if !n.config.Enabled || n.config.ToEmail == "" {
+// recipients 返回逗号分隔的各个收件人
+func (n *EmailNotifier) recipients() []string {
+	var recipients []string
+	for _, to := range strings.Split(n.recipient(), ",") {
+		if to = strings.TrimSpace(to); to != "" {
+			recipients = append(recipients, to)
+		}
+	}
+	return recipients
+}
+
+// shouldSendEmail 检查是否应该向recipient发送key对应的通知，按级别过滤并按(级别, 收件人, 错误指纹)限流
+func (n *EmailNotifier) shouldSendEmail(key notificationKey, recipient string) bool {
+	if !n.acceptsLevel(key.level) {
+		return false
+	}
+
+	now := n.now()
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if !n.throttle.allow(throttleKey{notificationKey: key, recipient: recipient}, now) {
+		n.suppressed++
 		return false
 	}
-	
+	n.sent++
+	return true
+}
+
+// acceptsLevel 检查是否启用了通知、有收件人且级别在允许列表中，不检查限流
+func (n *EmailNotifier) acceptsLevel(level string) bool {
+	if !n.config.Enabled || n.recipient() == "" {
+		return false
+	}
+
 	// 检查级别是否在允许列表中
 	if len(n.config.OnLevels) > 0 {
 		found := false
@@ -326,62 +429,97 @@ func (n *EmailNotifier) shouldSendEmail(level string) bool {
 			return false
 		}
 	}
-	
-	// 检查限流
-	n.mutex.Lock()
-	defer n.mutex.Unlock()
-	
-	lastSent, exists := n.throttle[level]
-	if exists && time.Since(lastSent) < n.config.Throttle {
-		return false
-	}
-	
-	n.throttle[level] = time.Now()
 	return true
 }
 
-// sendEmailNotification 发送邮件通知
-func (n *EmailNotifier) sendEmailNotification(_ context.Context, level, message string) {
-	if !n.shouldSendEmail(level) {
+// emailBodyTemplate 通知邮件正文，消息内容会被转义
+var emailBodyTemplate = template.Must(template.New("email").Parse(`
+		<h2>系统日志告警</h2>
+		<p><strong>级别:</strong> {{.Level}}</p>
+		<p><strong>时间:</strong> {{.Time}}</p>
+		<p><strong>消息:</strong> {{.Message}}</p>
+		{{- if .TraceID}}
+		<p><strong>TraceID:</strong> {{.TraceID}}</p>
+		{{- end}}
+		{{- if .SpanID}}
+		<p><strong>SpanID:</strong> {{.SpanID}}</p>
+		{{- end}}
+		{{- if .Caller}}
+		<p><strong>调用位置: {{.Caller}}</strong></p>
+		{{- end}}
+		<hr>
+		<p><em>此邮件由系统自动发送，请及时处理。</em></p>
+	`))
+
+// emailCallerSkip notify中获取调用者信息时跳过的栈帧：notify、notifyEmail、*WithEmail函数
+const emailCallerSkip = 3
+
+// notify 发送邮件通知，按级别过滤，并对每个收件人按级别和错误指纹（归一化后的消息和调用位置）限流
+// fatal和panic级别同步发送，因为进程即将退出；其他级别异步发送，避免阻塞日志记录
+// 摘要模式下通知计入摘要，只有fatal和panic级别立即发送
+// 发送失败时输出到标准错误，避免循环调用日志
+func (n *EmailNotifier) notify(level, message, traceID, spanID string) {
+	n.mutex.Lock()
+	closed := n.closed
+	n.mutex.Unlock()
+	if closed || !n.acceptsLevel(level) {
 		return
 	}
 
 	// 获取调用者信息
-	var callerInfo string
-	if pc, file, line, ok := runtime.Caller(4); ok {
-		funcName := runtime.FuncForPC(pc).Name()
-		callerInfo = fmt.Sprintf("调用位置: %s:%d (%s)", filepath.Base(file), line, funcName)
+	var position, caller string
+	if pc, file, line, ok := runtime.Caller(emailCallerSkip); ok {
+		position = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+		caller = fmt.Sprintf("%s (%s)", position, runtime.FuncForPC(pc).Name())
+	}
+	key := newNotificationKey(level, message, position)
+	if n.digestStop != nil {
+		n.record(key, message, traceID, position)
+		if level != LevelFatal && level != LevelPanic {
+			return
+		}
+	}
+	var recipients []string
+	for _, to := range n.recipients() {
+		if n.shouldSendEmail(key, to) {
+			recipients = append(recipients, to)
+		}
+	}
+	if len(recipients) == 0 {
+		return
 	}
 
-	// 构建邮件内容
-	now := time.Now()
-	subject := fmt.Sprintf("[%s] 系统日志告警 - %s", strings.ToUpper(level), now.Format("2006-01-02 15:04:05"))
-
-	body := fmt.Sprintf(`
-		<h2>系统日志告警</h2>
-		<p><strong>级别:</strong> %s</p>
-		<p><strong>时间:</strong> %s</p>
-		<p><strong>消息:</strong> %s</p>
-		<p><strong>%s</strong></p>
-		<hr>
-		<p><em>此邮件由系统自动发送，请及时处理。</em></p>
-	`, strings.ToUpper(level), now.Format("2006-01-02 15:04:05"), message, callerInfo)
+	now := time.Now().Format("2006-01-02 15:04:05")
+	subject := fmt.Sprintf("[%s] 系统日志告警 - %s", strings.ToUpper(level), now)
+	var body strings.Builder
+	err := emailBodyTemplate.Execute(&body, map[string]string{
+		"Level":   strings.ToUpper(level),
+		"Time":    now,
+		"Message": message,
+		"TraceID": traceID,
+		"SpanID":  spanID,
+		"Caller":  caller,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[邮件通知失败] 渲染邮件失败: %v\n", err)
+		return
+	}
 
-	// 异步发送邮件，避免阻塞日志记录
-	go func() {
-		// 使用带超时的context
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-		
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			if err := trace.SendEmail(n.config.ToEmail, subject, body); err != nil {
-				// 避免循环调用，使用简单的输出
+	send := func() {
+		for _, to := range recipients {
+			if err := n.send(to, subject, body.String()); err != nil {
 				fmt.Fprintf(os.Stderr, "[邮件通知失败] %v\n", err)
 			}
 		}
+	}
+	if level == LevelFatal || level == LevelPanic {
+		send()
+		return
+	}
+	n.pending.Add(1)
+	go func() {
+		defer n.pending.Done()
+		send()
 	}()
 }
 
@@ -389,21 +527,27 @@ func (n *EmailNotifier) sendEmailNotification(_ context.Context, level, message
 var globalEmailNotifier *EmailNotifier
 var emailMutex sync.RWMutex
 
-// SetEmailConfig 设置邮件配置
+// SetEmailConfig 设置邮件配置，之前的通知器被关闭，摘要模式下累积的通知随之发送
 func SetEmailConfig(config *EmailConfig) {
 	emailMutex.Lock()
-	defer emailMutex.Unlock()
-	
+	previous := globalEmailNotifier
+	defer func() {
+		emailMutex.Unlock()
+		if previous != nil {
+			previous.Close()
+		}
+	}()
+
 	if config == nil {
 		// 从环境变量加载配置
 		config = &EmailConfig{
-			Enabled:   os.Getenv("TRACE_EMAIL_ENABLED") == "true",
-			ToEmail:   os.Getenv("TRACE_EMAIL_TO"),
-			OnLevels:  []string{"error", "fatal", "panic"},
-			Throttle:  5 * time.Minute,
+			Enabled:  os.Getenv("TRACE_EMAIL_ENABLED") == "true",
+			ToEmail:  os.Getenv("TRACE_EMAIL_TO"),
+			OnLevels: []string{"error", "fatal", "panic"},
+			Throttle: 5 * time.Minute,
 		}
 	}
-	
+
 	globalEmailNotifier = NewEmailNotifier(config)
 	defaultLogger.config.EmailConfig = config
 }
@@ -411,26 +555,48 @@ func SetEmailConfig(config *EmailConfig) {
 // getEmailNotifier 获取邮件通知器
 func getEmailNotifier() *EmailNotifier {
 	emailMutex.RLock()
-	defer emailMutex.RUnlock()
-	
-	if globalEmailNotifier == nil {
+	notifier := globalEmailNotifier
+	emailMutex.RUnlock()
+
+	if notifier == nil {
 		SetEmailConfig(nil) // 懒加载
+		emailMutex.RLock()
+		notifier = globalEmailNotifier
+		emailMutex.RUnlock()
 	}
-	return globalEmailNotifier
+	return notifier
 }
 
-// sendEmailNotification 发送邮件通知（兼容性函数）
-func sendEmailNotification(level, message string) {
+// ErrEmailDisabled 邮件通知未启用
+var ErrEmailDisabled = errors.New("邮件通知未启用")
+
+// ValidateEmailSetup 检查邮件通知配置，并验证SMTP服务器可以连接和认证（不发送邮件）
+// 邮件通知未启用时返回ErrEmailDisabled
+func ValidateEmailSetup() error {
+	return ValidateEmailSetupContext(context.Background())
+}
+
+// ValidateEmailSetupContext 与ValidateEmailSetup相同，ctx可用于限制连接时间
+func ValidateEmailSetupContext(ctx context.Context) error {
 	notifier := getEmailNotifier()
-	if notifier != nil {
-		notifier.sendEmailNotification(context.Background(), level, message)
+	if !notifier.config.Enabled {
+		return ErrEmailDisabled
+	}
+	if notifier.recipient() == "" {
+		return fmt.Errorf("未配置收件人，请设置TRACE_EMAIL_TO环境变量或调用trace.SetEmail")
 	}
+
+	if err := trace.VerifySMTPConnection(ctx, trace.GetSMTPConfig()); err != nil {
+		return fmt.Errorf("SMTP连接验证失败: %w", err)
+	}
+	return nil
 }
 
-// sendEmailNotificationWithFormat 发送邮件通知（带格式化，兼容性函数）
-func sendEmailNotificationWithFormat(level, format string, args ...any) {
-	message := fmt.Sprintf(format, args...)
-	sendEmailNotification(level, message)
+// NotifyEmail 使用全局邮件通知器发送邮件通知，不写日志；*WithEmail函数写日志后调用它，未配置邮件时不发送
+func NotifyEmail(level, message, traceID, spanID string) {
+	if notifier := getEmailNotifier(); notifier != nil {
+		notifier.notify(level, message, traceID, spanID)
+	}
 }
 
 // 实现Logger接口
@@ -526,6 +692,22 @@ func Warnf(format string, args ...any) {
 	defaultLogger.Warnf(format, args...)
 }
 
+// WarnWithEmail 警告日志（带邮件通知）
+func WarnWithEmail(sendEmail bool, args ...any) {
+	defaultLogger.Warn(args...)
+	if sendEmail {
+		NotifyEmail(LevelWarn, fmt.Sprint(args...), "", "")
+	}
+}
+
+// WarnfWithEmail 格式化警告日志（带邮件通知）
+func WarnfWithEmail(sendEmail bool, format string, args ...any) {
+	defaultLogger.Warnf(format, args...)
+	if sendEmail {
+		NotifyEmail(LevelWarn, fmt.Sprintf(format, args...), "", "")
+	}
+}
+
 // Error 错误日志
 func Error(args ...any) {
 	defaultLogger.Error(args...)
@@ -535,8 +717,7 @@ func Error(args ...any) {
 func ErrorWithEmail(sendEmail bool, args ...any) {
 	defaultLogger.Error(args...)
 	if sendEmail {
-		message := fmt.Sprint(args...)
-		sendEmailNotification("error", message)
+		NotifyEmail(LevelError, fmt.Sprint(args...), "", "")
 	}
 }
 
@@ -549,31 +730,22 @@ func Errorf(format string, args ...any) {
 func ErrorfWithEmail(sendEmail bool, format string, args ...any) {
 	defaultLogger.Errorf(format, args...)
 	if sendEmail {
-		sendEmailNotificationWithFormat("error", format, args...)
+		NotifyEmail(LevelError, fmt.Sprintf(format, args...), "", "")
 	}
 }
 
-// Fatal 致命错误日志（会调用os.Exit(1)）
+// Fatal 致命错误日志，刷新聚合器和日志输出后调用SetExitFunc设置的退出函数（默认os.Exit(1)）
 func Fatal(args ...any) {
 	defaultLogger.Fatal(args...)
 }
 
-// FatalWithEmail 致命错误日志（带邮件通知，会调用os.Exit(1)）
+// FatalWithEmail 致命错误日志（带邮件通知，会退出进程）
+// 邮件在退出前同步发送
 func FatalWithEmail(sendEmail bool, args ...any) {
 	if sendEmail {
-		message := fmt.Sprint(args...)
-		// 先发送邮件，再调用Fatal
-		notifier := getEmailNotifier()
-		if notifier != nil {
-			// 同步发送，因为Fatal会立即退出
-			if notifier.shouldSendEmail("fatal") {
-				trace.SendEmail(notifier.config.ToEmail, 
-					fmt.Sprintf("[FATAL] 系统致命错误 - %s", time.Now().Format("2006-01-02 15:04:05")),
-					fmt.Sprintf("<h2>系统致命错误</h2><p>%s</p>", message))
-			}
-		}
+		NotifyEmail(LevelFatal, fmt.Sprint(args...), "", "")
 	}
-	Logrus.Fatal(args...)
+	defaultLogger.Fatal(args...)
 }
 
 // Fatalf 格式化致命错误日志
@@ -584,16 +756,9 @@ func Fatalf(format string, args ...any) {
 // FatalfWithEmail 格式化致命错误日志（带邮件通知）
 func FatalfWithEmail(sendEmail bool, format string, args ...any) {
 	if sendEmail {
-		message := fmt.Sprintf(format, args...)
-		// 先发送邮件，再调用Fatalf
-		notifier := getEmailNotifier()
-		if notifier != nil && notifier.shouldSendEmail("fatal") {
-			trace.SendEmail(notifier.config.ToEmail, 
-				fmt.Sprintf("[FATAL] 系统致命错误 - %s", time.Now().Format("2006-01-02 15:04:05")),
-				fmt.Sprintf("<h2>系统致命错误</h2><p>%s</p>", message))
-		}
+		NotifyEmail(LevelFatal, fmt.Sprintf(format, args...), "", "")
 	}
-	Logrus.Fatalf(format, args...)
+	defaultLogger.Fatalf(format, args...)
 }
 
 // Panic 恐慌日志（会调用panic）
@@ -602,18 +767,12 @@ func Panic(args ...any) {
 }
 
 // PanicWithEmail 恐慌日志（带邮件通知，会调用panic）
+// 邮件在panic前同步发送
 func PanicWithEmail(sendEmail bool, args ...any) {
 	if sendEmail {
-		message := fmt.Sprint(args...)
-		// 先发送邮件，再panic
-		notifier := getEmailNotifier()
-		if notifier != nil && notifier.shouldSendEmail("panic") {
-			trace.SendEmail(notifier.config.ToEmail, 
-				fmt.Sprintf("[PANIC] 系统恐慌 - %s", time.Now().Format("2006-01-02 15:04:05")),
-				fmt.Sprintf("<h2>系统恐慌</h2><p>%s</p>", message))
-		}
+		NotifyEmail(LevelPanic, fmt.Sprint(args...), "", "")
 	}
-	Logrus.Panic(args...)
+	defaultLogger.Panic(args...)
 }
 
 // Panicf 格式化恐慌日志
@@ -624,16 +783,9 @@ func Panicf(format string, args ...any) {
 // PanicfWithEmail 格式化恐慌日志（带邮件通知）
 func PanicfWithEmail(sendEmail bool, format string, args ...any) {
 	if sendEmail {
-		message := fmt.Sprintf(format, args...)
-		// 先发送邮件，再panic
-		notifier := getEmailNotifier()
-		if notifier != nil && notifier.shouldSendEmail("panic") {
-			trace.SendEmail(notifier.config.ToEmail, 
-				fmt.Sprintf("[PANIC] 系统恐慌 - %s", time.Now().Format("2006-01-02 15:04:05")),
-				fmt.Sprintf("<h2>系统恐慌</h2><p>%s</p>", message))
-		}
+		NotifyEmail(LevelPanic, fmt.Sprintf(format, args...), "", "")
 	}
-	Logrus.Panicf(format, args...)
+	defaultLogger.Panicf(format, args...)
 }
 
 // WithField 添加字段
@@ -694,8 +846,7 @@ func ErrorWithTrace(traceID, spanID string, args ...any) {
 func ErrorWithTraceAndEmail(traceID, spanID string, sendEmail bool, args ...any) {
 	defaultLogger.WithFields(createTraceFields(traceID, spanID)).Error(args...)
 	if sendEmail {
-		message := fmt.Sprint(args...)
-		sendEmailNotification("error", message)
+		NotifyEmail(LevelError, fmt.Sprint(args...), traceID, spanID)
 	}
 }
 
@@ -708,7 +859,7 @@ func ErrorfWithTrace(traceID, spanID, format string, args ...any) {
 func ErrorfWithTraceAndEmail(traceID, spanID string, sendEmail bool, format string, args ...any) {
 	defaultLogger.WithFields(createTraceFields(traceID, spanID)).Errorf(format, args...)
 	if sendEmail {
-		sendEmailNotificationWithFormat("error", format, args...)
+		NotifyEmail(LevelError, fmt.Sprintf(format, args...), traceID, spanID)
 	}
 }
 
@@ -734,155 +885,69 @@ func InitProduction(logFile string) error {
 	return nil
 }
 
-// InitDevelopment 初始化开发环境配置
+// InitDevelopment 初始化开发环境配置，使用控制台格式输出
 func InitDevelopment() {
 	SetLevel(LevelDebug)
-	SetFormat(FormatText)
+	SetFormat(FormatConsole)
 	SetOutput(os.Stdout)
 	EnableCaller()
 }
 
 // 日志聚合相关方法
 
-// InitWithAggregation 初始化带聚合功能的日志系统
-func InitWithAggregation(logFile, aggregateDir, serviceName string, rotationSize int64, maxBackups int) error {
-	// 初始化基本配置
-	SetLevel(LevelInfo)
-	SetFormat(FormatJSON)
-	EnableCaller()
-
-	// 设置文件输出
-	if logFile != "" {
-		if err := SetFileOutput(logFile); err != nil {
-			return err
-		}
-	}
-
-	// 创建聚合器
-	aggregator, err := NewLogAggregator(aggregateDir, serviceName, rotationSize, maxBackups)
-	if err != nil {
-		return err
-	}
-
-	// 设置全局聚合器
-	SetGlobalAggregator(aggregator)
-
-	// 添加聚合Hook
-	hook := NewAggregatorHook(aggregator, serviceName)
-	Logrus.AddHook(hook)
-
-	return nil
-}
-
-// QueryLogsByTraceID 根据TraceID查询日志
-func QueryLogsByTraceID(traceID, logDir string, limit, offset int) (*LogQueryResult, error) {
-	query := LogQuery{
-		TraceID:  traceID,
-		Limit:    limit,
-		Offset:   offset,
-		UseIndex: true, // 启用索引
-	}
-	return QueryLogs(query, logDir)
-}
-
-// QueryLogsBySpanID 根据SpanID查询日志
-func QueryLogsBySpanID(spanID, logDir string, limit, offset int) (*LogQueryResult, error) {
-	query := LogQuery{
-		SpanID:   spanID,
-		Limit:    limit,
-		Offset:   offset,
-		UseIndex: true, // 启用索引
-	}
-	return QueryLogs(query, logDir)
-}
-
-// QueryLogsByTimeRange 根据时间范围查询日志
-func QueryLogsByTimeRange(startTime, endTime time.Time, logDir string, limit, offset int) (*LogQueryResult, error) {
-	query := LogQuery{
-		StartTime: startTime,
-		EndTime:   endTime,
-		Limit:     limit,
-		Offset:    offset,
-		UseIndex:  false, // 时间范围查询不使用索引
-	}
-	return QueryLogs(query, logDir)
+// aggregation logz/aggregate包在init中注册的聚合功能，程序没有导入该包时为空
+var aggregation struct {
+	mutex sync.RWMutex
+	init  func(logFile, aggregateDir, serviceName string, rotationSize int64, maxBackups int) error
+	close func() error
 }
 
-// QueryLogsByLevel 根据日志级别查询
-func QueryLogsByLevel(level, logDir string, limit, offset int) (*LogQueryResult, error) {
-	query := LogQuery{
-		Level:    level,
-		Limit:    limit,
-		Offset:   offset,
-		UseIndex: true, // 启用索引
-	}
-	return QueryLogs(query, logDir)
+// RegisterAggregation 注册InitWithAggregation转发到的初始化函数和Close调用的关闭函数，由logz/aggregate包在init中调用
+// 聚合器、索引和查询在logz/aggregate包中，logz不导入它，只使用分级日志的程序不会链接bbolt
+func RegisterAggregation(init func(logFile, aggregateDir, serviceName string, rotationSize int64, maxBackups int) error, close func() error) {
+	aggregation.mutex.Lock()
+	defer aggregation.mutex.Unlock()
+	aggregation.init = init
+	aggregation.close = close
 }
 
-// QueryLogsByService 根据服务名查询日志
-func QueryLogsByService(service, logDir string, limit, offset int) (*LogQueryResult, error) {
-	query := LogQuery{
-		Service:  service,
-		Limit:    limit,
-		Offset:   offset,
-		UseIndex: true, // 启用索引
-	}
-	return QueryLogs(query, logDir)
-}
-
-// QueryLogsByMessage 根据消息内容查询日志（支持正则表达式）
-func QueryLogsByMessage(message, logDir string, limit, offset int) (*LogQueryResult, error) {
-	query := LogQuery{
-		Message:  message,
-		Limit:    limit,
-		Offset:   offset,
-		UseIndex: false, // 消息内容查询不使用索引
-	}
-	return QueryLogs(query, logDir)
-}
-
-// QueryLogsWithIndex 使用索引的复杂查询
-func QueryLogsWithIndex(query LogQuery, logDir string) (*LogQueryResult, error) {
-	query.UseIndex = true
-	return QueryLogs(query, logDir)
-}
-
-// QueryLogsWithoutIndex 不使用索引的查询（强制文件扫描）
-func QueryLogsWithoutIndex(query LogQuery, logDir string) (*LogQueryResult, error) {
-	query.UseIndex = false
-	return QueryLogs(query, logDir)
-}
-
-// CleanupOldLogsDefault 清理一周前的日志文件
-func CleanupOldLogsDefault(logDir string) error {
-	return CleanupOldLogs(logDir, 7)
-}
-
-// GetLogStatsDefault 获取日志统计信息
-func GetLogStatsDefault(logDir string) (map[string]any, error) {
-	return GetLogStats(logDir)
-}
-
-// CloseAggregator 关闭全局聚合器
-func CloseAggregator() error {
-	aggregator := GetGlobalAggregator()
-	if aggregator != nil {
-		return aggregator.Close()
+// InitWithAggregation 初始化带聚合功能的日志系统，转发到aggregate.InitWithAggregation
+// 程序没有导入github.com/HsiaoL1/trace/logz/aggregate时返回错误
+//
+// Deprecated: 使用github.com/HsiaoL1/trace/logz/aggregate包的InitWithAggregation或Init
+func InitWithAggregation(logFile, aggregateDir, serviceName string, rotationSize int64, maxBackups int) error {
+	aggregation.mutex.RLock()
+	init := aggregation.init
+	aggregation.mutex.RUnlock()
+	if init == nil {
+		return errors.New("日志聚合在github.com/HsiaoL1/trace/logz/aggregate包中，需要导入该包")
 	}
-	return nil
+	return init(logFile, aggregateDir, serviceName, rotationSize, maxBackups)
 }
 
 // Close 关闭默认日志器
 func Close() error {
 	// 关闭聚合器
-	if err := CloseAggregator(); err != nil {
+	aggregation.mutex.RLock()
+	closeAggregator := aggregation.close
+	aggregation.mutex.RUnlock()
+	if closeAggregator != nil {
+		if err := closeAggregator(); err != nil {
+			return err
+		}
+	}
+
+	// 停止文件监控并关闭日志文件
+	if err := defaultLogger.Close(); err != nil {
 		return err
 	}
-	
-	// 如果输出是文件，关闭文件句柄
-	if closer, ok := defaultLogger.config.Output.(io.Closer); ok {
-		return closer.Close()
+
+	// 如果输出是文件，关闭文件句柄（标准输出和标准错误除外）
+	if output := defaultLogger.config.Output; output != os.Stdout && output != os.Stderr {
+		if closer, ok := output.(io.Closer); ok {
+			return closer.Close()
+		}
 	}
-	
+
 	return nil
 }
@@ -0,0 +1,51 @@
+package logz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// LogLevelEnv 运行时重新读取日志级别的环境变量
+const LogLevelEnv = "TRACE_LOG_LEVEL"
+
+// HandleSignals 监听SIGHUP信号，收到后重新打开日志文件并根据TRACE_LOG_LEVEL调整日志级别
+// 信号处理需要显式启用，ctx取消后停止监听
+func HandleSignals(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				if err := Reload(); err != nil {
+					fmt.Fprintf(os.Stderr, "处理SIGHUP失败: %v\n", err)
+				}
+			}
+		}
+	}()
+}
+
+// Reload 重新打开默认日志器的日志文件，并根据TRACE_LOG_LEVEL调整日志级别
+// 未配置文件输出时只调整日志级别
+func Reload() error {
+	logger := GetDefaultLogger()
+
+	if level := os.Getenv(LogLevelEnv); level != "" {
+		logger.mutex.Lock()
+		logger.setLevel(level)
+		logger.mutex.Unlock()
+	}
+
+	if err := logger.ReopenLogFile(); err != nil && !errors.Is(err, ErrNoFileOutput) {
+		return err
+	}
+	return nil
+}
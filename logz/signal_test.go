@@ -0,0 +1,49 @@
+//go:build !windows
+
+package logz
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestHandleSignals(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	logger := newFileLogger(t, path)
+
+	previous := GetDefaultLogger()
+	SetDefaultLogger(logger)
+	defer SetDefaultLogger(previous)
+
+	t.Setenv(LogLevelEnv, "debug")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	HandleSignals(ctx)
+
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("重命名日志文件失败: %v", err)
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatalf("发送SIGHUP失败: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !logger.FileOutputExists() || logger.logrus.GetLevel() != logrus.DebugLevel {
+		if time.Now().After(deadline) {
+			t.Fatalf("SIGHUP未生效: 文件存在=%v, 级别=%s", logger.FileOutputExists(), logger.logrus.GetLevel())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := logger.ValidateFileOutput(); err != nil {
+		t.Errorf("期望重新打开的文件有效，得到 %v", err)
+	}
+}
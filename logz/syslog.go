@@ -0,0 +1,359 @@
+package logz
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SyslogFacility syslog设施（RFC5424 6.2.1）
+type SyslogFacility int
+
+const (
+	FacilityKern   SyslogFacility = 0
+	FacilityUser   SyslogFacility = 1
+	FacilityDaemon SyslogFacility = 3
+	FacilityAuth   SyslogFacility = 4
+	FacilityLocal0 SyslogFacility = 16
+	FacilityLocal1 SyslogFacility = 17
+	FacilityLocal2 SyslogFacility = 18
+	FacilityLocal3 SyslogFacility = 19
+	FacilityLocal4 SyslogFacility = 20
+	FacilityLocal5 SyslogFacility = 21
+	FacilityLocal6 SyslogFacility = 22
+	FacilityLocal7 SyslogFacility = 23
+)
+
+// syslog严重程度（RFC5424 6.2.1）
+const (
+	severityAlert   = 1
+	severityCrit    = 2
+	severityErr     = 3
+	severityWarning = 4
+	severityInfo    = 6
+	severityDebug   = 7
+)
+
+// SyslogSDID 结构化数据元素的ID，参数为trace_id、span_id和service
+// 32473是RFC5612保留给文档示例的企业编号
+const SyslogSDID = "trace@32473"
+
+// 默认的本地syslog套接字
+const (
+	defaultSyslogNetwork = "unixgram"
+	defaultSyslogAddr    = "/dev/log"
+)
+
+// syslog输出的发送队列和重连参数
+const (
+	syslogQueueSize     = 1024
+	syslogMinBackoff    = 100 * time.Millisecond
+	syslogMaxBackoff    = 30 * time.Second
+	syslogMaxAppNameLen = 48
+)
+
+// SyslogHook 以RFC5424格式将日志发送到syslog的logrus Hook
+// 日志在后台goroutine中发送，不会阻塞调用方；连接断开时按指数退避重连，
+// 断开期间和发送队列已满时丢弃日志并计数
+type SyslogHook struct {
+	network  string
+	addr     string
+	tag      string
+	facility SyslogFacility
+	hostname string
+	pid      int
+
+	queue     chan []byte
+	connected atomic.Bool
+	dropped   atomic.Uint64
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewSyslogHook 连接syslog并创建Hook，network支持udp和unixgram
+// network和addr为空时使用本地的/dev/log，连接失败时返回错误
+func NewSyslogHook(network, addr, tag string, facility SyslogFacility) (*SyslogHook, error) {
+	if network == "" && addr == "" {
+		network, addr = defaultSyslogNetwork, defaultSyslogAddr
+	}
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+	default:
+		return nil, fmt.Errorf("不支持的syslog网络类型: %q", network)
+	}
+	if facility < FacilityKern || facility > FacilityLocal7 {
+		return nil, fmt.Errorf("无效的syslog设施: %d", facility)
+	}
+
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("连接syslog失败: %w", err)
+	}
+
+	hostname, _ := os.Hostname()
+	h := &SyslogHook{
+		network:  network,
+		addr:     addr,
+		tag:      syslogAppName(tag),
+		facility: facility,
+		hostname: hostname,
+		pid:      os.Getpid(),
+		queue:    make(chan []byte, syslogQueueSize),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	h.connected.Store(true)
+	go h.run(conn)
+	return h, nil
+}
+
+// Levels 实现logrus.Hook接口
+func (h *SyslogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire 实现logrus.Hook接口，格式化后放入发送队列
+func (h *SyslogHook) Fire(entry *logrus.Entry) error {
+	if !h.connected.Load() {
+		h.dropped.Add(1)
+		return nil
+	}
+	select {
+	case h.queue <- h.format(entry):
+	default:
+		h.dropped.Add(1)
+	}
+	return nil
+}
+
+// Dropped 返回因连接断开或队列已满而丢弃的日志数
+func (h *SyslogHook) Dropped() uint64 {
+	return h.dropped.Load()
+}
+
+// Close 发送队列中剩余的日志并关闭连接，可以重复调用
+func (h *SyslogHook) Close() error {
+	h.closeOnce.Do(func() {
+		h.connected.Store(false)
+		close(h.stop)
+	})
+	<-h.done
+	return nil
+}
+
+// run 发送队列中的日志，写入失败时关闭连接并按指数退避重连
+func (h *SyslogHook) run(conn net.Conn) {
+	defer close(h.done)
+
+	backoff := syslogMinBackoff
+	retry := time.NewTimer(backoff)
+	retry.Stop()
+	defer retry.Stop()
+
+	send := func(msg []byte) {
+		if conn == nil {
+			h.dropped.Add(1)
+			return
+		}
+		if _, err := conn.Write(msg); err != nil {
+			h.dropped.Add(1)
+			conn.Close()
+			conn = nil
+			h.connected.Store(false)
+			backoff = syslogMinBackoff
+			retry.Reset(backoff)
+		}
+	}
+
+	for {
+		select {
+		case msg := <-h.queue:
+			send(msg)
+		case <-retry.C:
+			c, err := net.Dial(h.network, h.addr)
+			if err != nil {
+				backoff = min(backoff*2, syslogMaxBackoff)
+				retry.Reset(backoff)
+				continue
+			}
+			conn = c
+			h.connected.Store(true)
+		case <-h.stop:
+			for drained := false; !drained; {
+				select {
+				case msg := <-h.queue:
+					send(msg)
+				default:
+					drained = true
+				}
+			}
+			if conn != nil {
+				conn.Close()
+			}
+			return
+		}
+	}
+}
+
+// format 按RFC5424格式化日志：<PRI>1 时间 主机名 应用名 进程ID - [结构化数据] 消息
+// 除trace_id、span_id和service以外的字段按键排序以key=value的形式附加在消息后面
+func (h *SyslogHook) format(entry *logrus.Entry) []byte {
+	var b strings.Builder
+	priority := int(h.facility)*8 + syslogSeverity(entry.Level)
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %d - ",
+		priority,
+		entry.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogHeaderValue(h.hostname),
+		syslogHeaderValue(h.tag),
+		h.pid)
+
+	var params []string
+	for _, key := range []string{"trace_id", "span_id", "service"} {
+		if value, ok := entry.Data[key]; ok {
+			params = append(params, key+`="`+escapeSDParam(fmt.Sprint(value))+`"`)
+		}
+	}
+	if len(params) == 0 {
+		b.WriteString("-")
+	} else {
+		b.WriteString("[" + SyslogSDID + " " + strings.Join(params, " ") + "]")
+	}
+
+	b.WriteString(" ")
+	b.WriteString(entry.Message)
+	keys := make([]string, 0, len(entry.Data))
+	for key := range entry.Data {
+		if key != "trace_id" && key != "span_id" && key != "service" {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		value := entry.Data[key]
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		b.WriteString(" " + key + "=" + quoteConsoleValue(fmt.Sprint(value)))
+	}
+	return []byte(b.String())
+}
+
+// syslogSeverity 将logrus级别映射为syslog严重程度
+func syslogSeverity(level logrus.Level) int {
+	switch level {
+	case logrus.PanicLevel:
+		return severityAlert
+	case logrus.FatalLevel:
+		return severityCrit
+	case logrus.ErrorLevel:
+		return severityErr
+	case logrus.WarnLevel:
+		return severityWarning
+	case logrus.InfoLevel:
+		return severityInfo
+	}
+	return severityDebug
+}
+
+// syslogAppName 将tag转换为RFC5424的APP-NAME：最长48个可打印ASCII字符，不含空格
+func syslogAppName(tag string) string {
+	if tag == "" {
+		tag = os.Args[0]
+		if i := strings.LastIndexAny(tag, `/\`); i >= 0 {
+			tag = tag[i+1:]
+		}
+	}
+	name := []byte(tag)
+	for i, c := range name {
+		if c <= ' ' || c > '~' {
+			name[i] = '_'
+		}
+	}
+	if len(name) > syslogMaxAppNameLen {
+		name = name[:syslogMaxAppNameLen]
+	}
+	return string(name)
+}
+
+// syslogHeaderValue 头部字段为空时使用NILVALUE
+func syslogHeaderValue(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// escapeSDParam 转义结构化数据参数值中的"、\和]
+func escapeSDParam(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+}
+
+// SetSyslogOutput 为日志器增加syslog输出，与标准输出、文件等输出同时生效
+// 已设置syslog输出时先关闭原来的连接
+func (l *DefaultLogger) SetSyslogOutput(network, addr, tag string, facility SyslogFacility) error {
+	hook, err := NewSyslogHook(network, addr, tag, facility)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	previous := l.syslog
+	l.syslog = hook
+	l.setNamedHookLocked(HookNameSyslog, hook, HookPriorityOutput)
+	l.mutex.Unlock()
+
+	if previous != nil {
+		previous.Close()
+	}
+	return nil
+}
+
+// CloseSyslogOutput 移除syslog输出并关闭连接，没有设置syslog输出时什么都不做
+func (l *DefaultLogger) CloseSyslogOutput() error {
+	l.mutex.Lock()
+	hook := l.syslog
+	l.syslog = nil
+	if hook != nil {
+		l.removeNamedHookLocked(HookNameSyslog)
+	}
+	l.mutex.Unlock()
+
+	if hook == nil {
+		return nil
+	}
+	return hook.Close()
+}
+
+// SyslogDropped 返回syslog输出丢弃的日志数，没有设置syslog输出时返回0
+func (l *DefaultLogger) SyslogDropped() uint64 {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	if l.syslog == nil {
+		return 0
+	}
+	return l.syslog.Dropped()
+}
+
+// SetSyslogOutput 为默认日志器增加syslog输出（全局函数）
+func SetSyslogOutput(network, addr, tag string, facility SyslogFacility) error {
+	return defaultLogger.SetSyslogOutput(network, addr, tag, facility)
+}
+
+// CloseSyslogOutput 关闭默认日志器的syslog输出（全局函数）
+func CloseSyslogOutput() error {
+	return defaultLogger.CloseSyslogOutput()
+}
+
+// SyslogDropped 返回默认日志器的syslog输出丢弃的日志数（全局函数）
+func SyslogDropped() uint64 {
+	return defaultLogger.SyslogDropped()
+}
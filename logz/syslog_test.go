@@ -0,0 +1,174 @@
+//go:build !windows
+
+package logz
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// listenSyslog 在临时目录中创建unixgram监听器模拟syslog
+func listenSyslog(t *testing.T, path string) *net.UnixConn {
+	t.Helper()
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("创建unixgram监听器失败: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readSyslog 读取一条syslog消息
+func readSyslog(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+	buf := make([]byte, 64*1024)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("读取syslog消息失败: %v", err)
+	}
+	return string(buf[:n])
+}
+
+// newSyslogLogger 创建只输出到syslog的日志器
+func newSyslogLogger(t *testing.T, path string) *DefaultLogger {
+	t.Helper()
+	logger := NewDefaultLogger(&LoggerConfig{Level: LevelDebug, Format: FormatJSON, Output: io.Discard})
+	if err := logger.SetSyslogOutput("unixgram", path, "orders api", FacilityLocal0); err != nil {
+		t.Fatalf("设置syslog输出失败: %v", err)
+	}
+	t.Cleanup(func() { logger.Close() })
+	return logger
+}
+
+func TestSyslogOutputFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	listener := listenSyslog(t, path)
+	logger := newSyslogLogger(t, path)
+
+	logger.logrus.WithFields(logrus.Fields{
+		"trace_id": "4bf92f3577b34da6",
+		"span_id":  "00f067aa",
+		"service":  `shop"]\`,
+		"order_id": 42,
+		"customer": "Ada Lovelace",
+	}).Error("payment failed")
+
+	hostname, _ := os.Hostname()
+	msg := readSyslog(t, listener)
+	prefix := "<131>1 " // local0(16)*8 + err(3)
+	if !strings.HasPrefix(msg, prefix) {
+		t.Fatalf("期望以 %q 开头，得到 %q", prefix, msg)
+	}
+	fields := strings.SplitN(msg, " ", 7)
+	if fields[2] != hostname || fields[3] != "orders_api" || fields[4] != fmt.Sprint(os.Getpid()) || fields[5] != "-" {
+		t.Errorf("头部字段错误: %q", msg)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, fields[1]); err != nil {
+		t.Errorf("时间戳不是RFC3339格式: %q", fields[1])
+	}
+	want := `[trace@32473 trace_id="4bf92f3577b34da6" span_id="00f067aa" service="shop\"\]\\"] payment failed customer="Ada Lovelace" order_id=42`
+	if fields[6] != want {
+		t.Errorf("期望结构化数据和消息为\n%s\n得到\n%s", want, fields[6])
+	}
+
+	// 没有追踪字段时结构化数据为NILVALUE
+	logger.Info("started")
+	if msg := readSyslog(t, listener); !strings.HasPrefix(msg, "<134>1 ") || !strings.HasSuffix(msg, " - - started") {
+		t.Errorf("期望info级别且没有结构化数据，得到 %q", msg)
+	}
+}
+
+func TestSyslogSeverity(t *testing.T) {
+	tests := []struct {
+		level    logrus.Level
+		severity int
+	}{
+		{logrus.PanicLevel, 1},
+		{logrus.FatalLevel, 2},
+		{logrus.ErrorLevel, 3},
+		{logrus.WarnLevel, 4},
+		{logrus.InfoLevel, 6},
+		{logrus.DebugLevel, 7},
+		{logrus.TraceLevel, 7},
+	}
+	for _, tt := range tests {
+		if got := syslogSeverity(tt.level); got != tt.severity {
+			t.Errorf("%s: 期望严重程度 %d，得到 %d", tt.level, tt.severity, got)
+		}
+	}
+}
+
+func TestSyslogReconnect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log.sock")
+	listener := listenSyslog(t, path)
+	logger := newSyslogLogger(t, path)
+
+	logger.Info("first")
+	readSyslog(t, listener)
+
+	// 监听器关闭后写入失败，断开期间的日志被丢弃并计数，调用方不会阻塞
+	listener.Close()
+	os.Remove(path)
+	deadline := time.Now().Add(5 * time.Second)
+	for logger.SyslogDropped() < 3 && time.Now().Before(deadline) {
+		logger.Info("lost")
+		time.Sleep(5 * time.Millisecond)
+	}
+	if logger.SyslogDropped() < 3 {
+		t.Fatalf("期望断开期间丢弃日志，得到丢弃数 %d", logger.SyslogDropped())
+	}
+
+	// 监听器恢复后重新连接
+	listener = listenSyslog(t, path)
+	deadline = time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		logger.Info("recovered")
+		listener.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		buf := make([]byte, 4096)
+		if n, err := listener.Read(buf); err == nil {
+			if !strings.HasSuffix(string(buf[:n]), "recovered") {
+				t.Errorf("期望收到重连后的日志，得到 %q", buf[:n])
+			}
+			return
+		}
+	}
+	t.Fatal("监听器恢复后没有重新连接")
+}
+
+func TestSyslogOutputOptions(t *testing.T) {
+	if _, err := NewSyslogHook("tcp", "127.0.0.1:514", "app", FacilityUser); err == nil {
+		t.Error("期望不支持tcp")
+	}
+	if _, err := NewSyslogHook("udp", "127.0.0.1:514", "app", SyslogFacility(24)); err == nil {
+		t.Error("期望拒绝无效的设施")
+	}
+	if _, err := NewSyslogHook("unixgram", filepath.Join(t.TempDir(), "missing.sock"), "app", FacilityUser); err == nil {
+		t.Error("期望连接不存在的套接字时返回错误")
+	}
+
+	// 重复设置时替换原来的Hook，关闭后移除
+	path := filepath.Join(t.TempDir(), "log.sock")
+	listenSyslog(t, path)
+	logger := newSyslogLogger(t, path)
+	if err := logger.SetSyslogOutput("unixgram", path, "app", FacilityUser); err != nil {
+		t.Fatalf("设置syslog输出失败: %v", err)
+	}
+	if n := len(logger.logrus.Hooks[logrus.InfoLevel]); n != 1 {
+		t.Errorf("期望只有一个syslog Hook，得到 %d", n)
+	}
+	if err := logger.CloseSyslogOutput(); err != nil {
+		t.Fatalf("关闭syslog输出失败: %v", err)
+	}
+	if n := len(logger.logrus.Hooks[logrus.InfoLevel]); n != 0 {
+		t.Errorf("期望关闭后移除Hook，得到 %d", n)
+	}
+}
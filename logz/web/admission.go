@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"os"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// 查询准入控制的默认值和环境变量
+const (
+	defaultQueryQueueSize    = 16
+	defaultQueryQueueTimeout = 10 * time.Second
+
+	// cheapQueryBytes 候选文件总大小不超过该值的查询不占用并发名额
+	cheapQueryBytes = 1 << 20
+
+	queryConcurrencyEnv  = "QUERY_MAX_CONCURRENT"
+	queryQueueSizeEnv    = "QUERY_QUEUE_SIZE"
+	queryQueueTimeoutEnv = "QUERY_QUEUE_TIMEOUT"
+)
+
+// errQueryBusy 并发查询已满且排队超时或队列已满
+var errQueryBusy = errors.New("too many concurrent queries, retry later")
+
+// defaultQueryConcurrency 默认的并发文件扫描查询数，为CPU核数的一半
+func defaultQueryConcurrency() int {
+	return max(1, runtime.NumCPU()/2)
+}
+
+// WithQueryConcurrency 设置同时执行的文件扫描查询数，<=0时使用CPU核数的一半
+func WithQueryConcurrency(n int) WebServerOption {
+	return func(ws *WebServer) {
+		if n <= 0 {
+			n = defaultQueryConcurrency()
+		}
+		ws.admission = newQueryAdmission(n, ws.admission.queueSize, ws.admission.queueTimeout)
+	}
+}
+
+// WithQueryQueue 设置并发已满时最多排队的查询数和排队超时时间
+// 队列已满或排队超时的请求返回503和Retry-After
+func WithQueryQueue(size int, timeout time.Duration) WebServerOption {
+	return func(ws *WebServer) {
+		if size < 0 {
+			size = 0
+		}
+		if timeout <= 0 {
+			timeout = defaultQueryQueueTimeout
+		}
+		ws.admission = newQueryAdmission(cap(ws.admission.slots), size, timeout)
+	}
+}
+
+// queryOptionsFromEnv 从环境变量读取查询准入配置，未设置或无效的值使用默认值
+func queryOptionsFromEnv() []WebServerOption {
+	var opts []WebServerOption
+	if n, err := strconv.Atoi(os.Getenv(queryConcurrencyEnv)); err == nil && n > 0 {
+		opts = append(opts, WithQueryConcurrency(n))
+	}
+
+	size := defaultQueryQueueSize
+	timeout := defaultQueryQueueTimeout
+	if n, err := strconv.Atoi(os.Getenv(queryQueueSizeEnv)); err == nil && n >= 0 {
+		size = n
+	}
+	if d, err := time.ParseDuration(os.Getenv(queryQueueTimeoutEnv)); err == nil && d > 0 {
+		timeout = d
+	}
+	return append(opts, WithQueryQueue(size, timeout))
+}
+
+// queryAdmission 限制同时执行的文件扫描查询，超出时排队等待
+type queryAdmission struct {
+	slots        chan struct{} // 信号量，容量为最大并发数
+	queueSize    int
+	queueTimeout time.Duration
+
+	waiting  atomic.Int64
+	admitted atomic.Int64
+	bypassed atomic.Int64
+	rejected atomic.Int64
+}
+
+// QueryAdmissionStats 查询准入控制的当前状态
+type QueryAdmissionStats struct {
+	MaxConcurrent int   `json:"max_concurrent"`
+	Running       int   `json:"running"`
+	MaxQueue      int   `json:"max_queue"`
+	Waiting       int64 `json:"waiting"`
+	Admitted      int64 `json:"admitted"`
+	Bypassed      int64 `json:"bypassed"` // 使用索引或候选文件很小而未占用名额的查询
+	Rejected      int64 `json:"rejected"`
+}
+
+func newQueryAdmission(concurrency, queueSize int, queueTimeout time.Duration) *queryAdmission {
+	return &queryAdmission{
+		slots:        make(chan struct{}, concurrency),
+		queueSize:    queueSize,
+		queueTimeout: queueTimeout,
+	}
+}
+
+// acquire 获取执行名额，返回释放函数
+// 队列已满或排队超时返回errQueryBusy，ctx取消时返回ctx.Err()
+func (qa *queryAdmission) acquire(ctx context.Context) (func(), error) {
+	release := func() { <-qa.slots }
+
+	select {
+	case qa.slots <- struct{}{}:
+		qa.admitted.Add(1)
+		return release, nil
+	default:
+	}
+
+	if qa.waiting.Add(1) > int64(qa.queueSize) {
+		qa.waiting.Add(-1)
+		qa.rejected.Add(1)
+		return nil, errQueryBusy
+	}
+	defer qa.waiting.Add(-1)
+
+	timer := time.NewTimer(qa.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case qa.slots <- struct{}{}:
+		qa.admitted.Add(1)
+		return release, nil
+	case <-timer.C:
+		qa.rejected.Add(1)
+		return nil, errQueryBusy
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// retryAfter 建议客户端重试前等待的秒数
+func (qa *queryAdmission) retryAfter() int {
+	return max(1, int(math.Ceil(qa.queueTimeout.Seconds())))
+}
+
+// stats 返回当前状态
+func (qa *queryAdmission) stats() QueryAdmissionStats {
+	return QueryAdmissionStats{
+		MaxConcurrent: cap(qa.slots),
+		Running:       len(qa.slots),
+		MaxQueue:      qa.queueSize,
+		Waiting:       qa.waiting.Load(),
+		Admitted:      qa.admitted.Load(),
+		Bypassed:      qa.bypassed.Load(),
+		Rejected:      qa.rejected.Load(),
+	}
+}
+
+// admitQuery 根据查询成本决定是否需要占用并发名额，返回执行查询应使用的context
+// 使用索引的查询和候选文件很小的查询直接执行，返回的释放函数不为nil
+// 使用索引的查询在索引读取失败、回退到文件扫描时仍需通过返回的context获取名额
+func (ws *WebServer) admitQuery(ctx context.Context, query aggregate.LogQuery) (context.Context, func(), error) {
+	if aggregate.CanUseIndex(query) {
+		ws.admission.bypassed.Add(1)
+		return aggregate.WithScanAdmission(ctx, ws.admission.acquire), func() {}, nil
+	}
+	if ws.estimateQueryCost(query) <= cheapQueryBytes {
+		ws.admission.bypassed.Add(1)
+		return ctx, func() {}, nil
+	}
+	release, err := ws.admission.acquire(ctx)
+	return ctx, release, err
+}
+
+// estimateQueryCost 估算文件扫描查询需要扫描的字节数，查找文件的选项与查询使用的相同
+func (ws *WebServer) estimateQueryCost(query aggregate.LogQuery) int64 {
+	files, err := aggregate.DiscoverLogFiles(ws.logDir, query.DiscoverOptions())
+	if err != nil {
+		return math.MaxInt64 // 无法估算时按高成本查询处理
+	}
+	var total int64
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+// queryErrorStatus 返回查询错误对应的状态码和错误码
+func queryErrorStatus(err error) (int, string) {
+	if errors.Is(err, errQueryBusy) {
+		return http.StatusServiceUnavailable, "query_busy"
+	}
+	code := aggregate.ErrorCode(err)
+	switch code {
+	case aggregate.CodeInvalidQuery:
+		return http.StatusBadRequest, code
+	case aggregate.CodeLogDirNotFound:
+		return http.StatusNotFound, code
+	case aggregate.CodeIndexUnavailable, aggregate.CodeNoAggregator:
+		return http.StatusServiceUnavailable, code
+	case aggregate.CodeTimeout:
+		return http.StatusGatewayTimeout, code
+	case aggregate.CodeLogFileRemoved:
+		return http.StatusGone, code
+	}
+	return http.StatusInternalServerError, code
+}
+
+// sendQueryError 返回查询错误，查询被限流时返回503并设置Retry-After，其他错误按queryErrorStatus返回
+func (ws *WebServer) sendQueryError(w http.ResponseWriter, err error) {
+	status, _ := queryErrorStatus(err)
+	if errors.Is(err, errQueryBusy) {
+		w.Header().Set("Retry-After", strconv.Itoa(ws.admission.retryAfter()))
+	}
+	ws.sendJSONError(w, status, err.Error())
+}
+
+// sendQueryError 返回查询错误和错误码，查询被限流时返回503并设置Retry-After
+func (api *APIServer) sendQueryError(w http.ResponseWriter, err error) {
+	status, code := queryErrorStatus(err)
+	if errors.Is(err, errQueryBusy) {
+		w.Header().Set("Retry-After", strconv.Itoa(api.ws.admission.retryAfter()))
+	}
+	api.sendErrorResponseWithCode(w, err.Error(), status, code)
+}
+
+// handleMetrics 返回服务运行指标
+func (api *APIServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		api.sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	api.sendSuccessResponse(w, map[string]interface{}{
+		"queries":     api.ws.admission.stats(),
+		"api_keys":    api.ws.apiKeyStats(),
+		"requests":    api.ws.requestStats.snapshot(),
+		"query_cache": api.ws.queryCache.snapshot(),
+	})
+}
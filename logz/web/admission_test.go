@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// writeBigFixture 写入超过cheapQueryBytes的日志文件，使查询需要占用并发名额
+func writeBigFixture(t *testing.T, dir string) {
+	t.Helper()
+	line := `{"timestamp":"2024-01-15T10:30:00Z","level":"info","msg":"` + strings.Repeat("x", 200) + `"}` + "\n"
+	content := strings.Repeat(line, cheapQueryBytes/len(line)+100)
+	if err := os.WriteFile(filepath.Join(dir, "big.log"), []byte(content), 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+}
+
+// slowQueries 模拟慢查询的LogStore，查询阻塞到release关闭或ctx取消，并记录最大并发数
+type slowQueries struct {
+	aggregate.LogStore
+	release chan struct{}
+	running atomic.Int64
+	peak    atomic.Int64
+}
+
+func newSlowQueries() *slowQueries {
+	return &slowQueries{release: make(chan struct{})}
+}
+
+func (sq *slowQueries) Query(ctx context.Context, query aggregate.LogQuery) (*aggregate.LogQueryResult, error) {
+	n := sq.running.Add(1)
+	defer sq.running.Add(-1)
+	for {
+		peak := sq.peak.Load()
+		if n <= peak || sq.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	select {
+	case <-sq.release:
+		return &aggregate.LogQueryResult{Entries: []aggregate.LogEntry{}}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// waitFor 等待条件成立，超时后测试失败
+func waitFor(t *testing.T, desc string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待%s超时", desc)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func searchRequest() *http.Request {
+	req := httptest.NewRequest("POST", "/api/v1/logs/search", strings.NewReader(`{"message":"x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestQueryAdmission(t *testing.T) {
+	tempDir := t.TempDir()
+	writeBigFixture(t, tempDir)
+	sq := newSlowQueries()
+
+	ws := NewWebServer(tempDir, "8080", WithLogStore(sq), WithQueryConcurrency(2), WithQueryQueue(2, 5*time.Second))
+	api := NewAPIServer(ws)
+
+	const requests = 8
+	codes := make([]int, requests)
+	retryAfter := make([]string, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			api.handleLogSearch(w, searchRequest())
+			codes[i] = w.Code
+			retryAfter[i] = w.Header().Get("Retry-After")
+		}(i)
+	}
+
+	// 2个执行、2个排队，其余立即被拒绝
+	waitFor(t, "查询排队", func() bool {
+		stats := ws.admission.stats()
+		return stats.Running == 2 && stats.Waiting == 2 && stats.Rejected == 4
+	})
+
+	w := httptest.NewRecorder()
+	api.handleMetrics(w, httptest.NewRequest("GET", "/api/v1/metrics", nil))
+	var response APIResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	queries := response.Data.(map[string]interface{})["queries"].(map[string]interface{})
+	if queries["running"] != float64(2) || queries["waiting"] != float64(2) || queries["max_concurrent"] != float64(2) {
+		t.Errorf("指标中的占用情况错误: %v", queries)
+	}
+
+	close(sq.release)
+	wg.Wait()
+
+	if peak := sq.peak.Load(); peak != 2 {
+		t.Errorf("期望最大并发查询数为2，得到 %d", peak)
+	}
+	var ok, busy int
+	for i, code := range codes {
+		switch code {
+		case http.StatusOK:
+			ok++
+		case http.StatusServiceUnavailable:
+			busy++
+			if retryAfter[i] != "5" {
+				t.Errorf("期望Retry-After为5，得到 %q", retryAfter[i])
+			}
+		default:
+			t.Errorf("意外的状态码 %d", code)
+		}
+	}
+	if ok != 4 || busy != 4 {
+		t.Errorf("期望4个成功、4个503，得到 %d 个成功、%d 个503", ok, busy)
+	}
+}
+
+func TestQueryAdmissionTimeout(t *testing.T) {
+	tempDir := t.TempDir()
+	writeBigFixture(t, tempDir)
+	sq := newSlowQueries()
+	defer close(sq.release)
+
+	ws := NewWebServer(tempDir, "8080", WithLogStore(sq), WithQueryConcurrency(1), WithQueryQueue(1, 50*time.Millisecond))
+	api := NewAPIServer(ws)
+
+	go api.handleLogSearch(httptest.NewRecorder(), searchRequest())
+	waitFor(t, "第一个查询开始", func() bool { return sq.running.Load() == 1 })
+
+	// 排队超时后返回503
+	start := time.Now()
+	w := httptest.NewRecorder()
+	api.handleLogSearch(w, searchRequest())
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("期望503和Retry-After 1，得到 %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("期望排队等待超时时间，实际 %v", elapsed)
+	}
+
+	// 取消的请求离开队列
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		api.handleLogSearch(httptest.NewRecorder(), searchRequest().WithContext(ctx))
+	}()
+	waitFor(t, "请求排队", func() bool { return ws.admission.stats().Waiting == 1 })
+	cancel()
+	<-done
+	if waiting := ws.admission.stats().Waiting; waiting != 0 {
+		t.Errorf("期望取消后队列为空，得到 %d", waiting)
+	}
+
+	// 小文件的查询不占用名额
+	smallDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(smallDir, "small.log"), []byte(`{"level":"info","msg":"x"}`+"\n"), 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+	small := NewWebServer(smallDir, "8080", WithQueryConcurrency(1), WithQueryQueue(0, time.Second))
+	small.admission = ws.admission // 共享已满的名额
+	if _, _, err := small.admitQuery(context.Background(), small.logQuery(aggregate.LogQuery{})); err != nil {
+		t.Errorf("期望小查询绕过准入控制，得到 %v", err)
+	}
+	if _, _, err := ws.admitQuery(context.Background(), ws.logQuery(aggregate.LogQuery{})); err == nil {
+		t.Error("期望大查询在名额已满时被拒绝")
+	}
+
+	// 估算包含查询会扫描的子目录
+	receivedPath := filepath.Join(smallDir, receivedDir, "remote.log")
+	if err := os.MkdirAll(filepath.Dir(receivedPath), 0755); err != nil {
+		t.Fatalf("创建子目录失败: %v", err)
+	}
+	if err := os.WriteFile(receivedPath, bytes.Repeat([]byte("x"), cheapQueryBytes+1), 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+	if _, _, err := small.admitQuery(context.Background(), small.logQuery(aggregate.LogQuery{})); err == nil {
+		t.Error("期望子目录中的大文件计入查询成本")
+	}
+}
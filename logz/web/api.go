@@ -1,11 +1,13 @@
 package main
 
 import (
-	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -13,8 +15,12 @@ import (
 	"time"
 
 	"github.com/HsiaoL1/trace/logz"
+	"github.com/HsiaoL1/trace/logz/aggregate"
 )
 
+// healthCheckTimeout 健康检查中外部依赖检查的超时时间
+const healthCheckTimeout = 5 * time.Second
+
 // APIResponse 标准API响应格式
 type APIResponse struct {
 	Success   bool        `json:"success"`
@@ -22,8 +28,10 @@ type APIResponse struct {
 	Error     string      `json:"error,omitempty"`
 	Message   string      `json:"message,omitempty"`
 	Code      int         `json:"code,omitempty"`
+	ErrorCode string      `json:"error_code,omitempty"` // 错误类型，如invalid_query、log_dir_not_found
 	Timestamp time.Time   `json:"timestamp"`
 	RequestID string      `json:"request_id,omitempty"`
+	Total     *int        `json:"total,omitempty"` // 分页的列表接口返回过滤后的总数
 }
 
 // LogQueryRequest 日志查询请求
@@ -32,18 +40,105 @@ type LogQueryRequest struct {
 	SpanID    string    `json:"span_id,omitempty"`
 	Level     string    `json:"level,omitempty"`
 	Service   string    `json:"service,omitempty"`
+	Hostname  string    `json:"hostname,omitempty"`
 	Message   string    `json:"message,omitempty"`
 	StartTime time.Time `json:"start_time,omitempty"`
 	EndTime   time.Time `json:"end_time,omitempty"`
 	Limit     int       `json:"limit,omitempty"`
 	Offset    int       `json:"offset,omitempty"`
 	UseIndex  bool      `json:"use_index,omitempty"`
+	Strict    bool      `json:"strict,omitempty"`
+	HasStack  bool      `json:"has_stack,omitempty"` // 只返回带有error.stack字段的日志
+
+	// 相对时间，如"15m"、"2h"、"today"、"yesterday"，按服务器时钟解析；start_time和end_time优先
+	Since string `json:"since,omitempty"`
+	Until string `json:"until,omitempty"`
+
+	// 索引无法处理查询时返回503，不回退到文件扫描
+	RequireIndex bool `json:"require_index,omitempty"`
+
+	// 请求超时或客户端断开时返回部分结果
+	AllowPartial bool `json:"allow_partial,omitempty"`
+
+	// 在服务端缓存完整的匹配结果并返回query_id，之后传入query_id和offset、limit翻页，只读取该页的条目
+	Cache   bool   `json:"cache,omitempty"`
+	QueryID string `json:"query_id,omitempty"` // 从缓存读取之前查询的结果，忽略其他查询条件
+
+	// 在结果中返回查询的执行过程，也可以通过explain=true查询参数开启
+	Explain bool `json:"explain,omitempty"`
+
+	// 按时间戳排列的顺序：asc（默认）或desc（最新的在前）
+	SortOrder string `json:"sort_order,omitempty"`
+}
+
+// parseTimeRangeParams 解析start_time和end_time（RFC3339）以及since和until查询参数，未设置的一端为零值
+// 相对时间的解析见resolveTimeRange，loc为today、yesterday的时区
+func parseTimeRangeParams(params url.Values, loc *time.Location) (start, end time.Time, err error) {
+	if value := params.Get("start_time"); value != "" {
+		if start, err = time.Parse(time.RFC3339, value); err != nil {
+			return start, end, fmt.Errorf("无效的start_time参数: %q", value)
+		}
+	}
+	if value := params.Get("end_time"); value != "" {
+		if end, err = time.Parse(time.RFC3339, value); err != nil {
+			return start, end, fmt.Errorf("无效的end_time参数: %q", value)
+		}
+	}
+	return resolveTimeRange(start, end, params.Get("since"), params.Get("until"), loc)
+}
+
+// resolveTimeRange 用since和until补充未设置的开始和结束时间
+// 相对时间按服务器时钟解析，today、yesterday按loc（为nil时为服务器时区）的日期边界解析
+// 同一端同时指定绝对时间和相对时间（start_time和since、end_time和until）、相对时间无效或开始时间晚于结束时间时返回*aggregate.QueryError
+func resolveTimeRange(start, end time.Time, since, until string, loc *time.Location) (time.Time, time.Time, error) {
+	if !start.IsZero() && since != "" {
+		return start, end, &aggregate.QueryError{Field: "since", Err: errors.New("start_time和since不能同时指定")}
+	}
+	if !end.IsZero() && until != "" {
+		return start, end, &aggregate.QueryError{Field: "until", Err: errors.New("end_time和until不能同时指定")}
+	}
+	relStart, relEnd, err := aggregate.ResolveTimeRange(since, until, time.Now(), loc)
+	if err != nil {
+		return start, end, err
+	}
+	if start.IsZero() {
+		start = relStart
+	}
+	if end.IsZero() {
+		end = relEnd
+	}
+	if !start.IsZero() && !end.IsZero() && start.After(end) {
+		return start, end, &aggregate.QueryError{Field: "until", Err: fmt.Errorf("结束时间 %s 早于开始时间 %s", end.Format(time.RFC3339), start.Format(time.RFC3339))}
+	}
+	return start, end, nil
+}
+
+// addTimeRangeInfo 在query_info中记录请求的相对时间和解析后的时间范围
+func addTimeRangeInfo(info map[string]interface{}, since, until string, start, end time.Time) {
+	if since != "" {
+		info["since"] = since
+	}
+	if until != "" {
+		info["until"] = until
+	}
+	if !start.IsZero() {
+		info["start_time"] = start.Format(time.RFC3339Nano)
+	}
+	if !end.IsZero() {
+		info["end_time"] = end.Format(time.RFC3339Nano)
+	}
+}
+
+// wantExplain 请求是否要求返回查询的执行过程
+func wantExplain(r *http.Request) bool {
+	value := strings.ToLower(r.URL.Query().Get("explain"))
+	return value == "true" || value == "1"
 }
 
 // LogWriteRequest 日志写入请求
 type LogWriteRequest struct {
-	Level     string                 `json:"level" validate:"required,oneof=debug info warn error fatal panic"`
-	Message   string                 `json:"message" validate:"required,min=1,max=10000"`
+	Level     string                 `json:"level" validate:"required,oneof=trace debug info warn error fatal panic"`
+	Message   string                 `json:"message" validate:"required,min=1"`
 	TraceID   string                 `json:"trace_id,omitempty" validate:"omitempty,min=1,max=64"`
 	SpanID    string                 `json:"span_id,omitempty" validate:"omitempty,min=1,max=32"`
 	Service   string                 `json:"service,omitempty" validate:"omitempty,min=1,max=100"`
@@ -54,14 +149,16 @@ type LogWriteRequest struct {
 
 // FileInfoResponse 文件信息响应
 type FileInfoResponse struct {
-	Name         string    `json:"name"`
-	Size         int64     `json:"size"`
-	SizeHuman    string    `json:"size_human"`
-	ModTime      time.Time `json:"mod_time"`
-	IsCompressed bool      `json:"is_compressed"`
-	Path         string    `json:"path,omitempty"`
-	Checksum     string    `json:"checksum,omitempty"`
-	LineCount    int       `json:"line_count,omitempty"`
+	Name            string    `json:"name"`
+	Size            int64     `json:"size"`
+	SizeHuman       string    `json:"size_human"`
+	ModTime         time.Time `json:"mod_time"`
+	IsCompressed    bool      `json:"is_compressed"`
+	Path            string    `json:"path,omitempty"`
+	Checksum        string    `json:"checksum,omitempty"`         // SHA-256，请求checksum=true时返回
+	ChecksumPending bool      `json:"checksum_pending,omitempty"` // 校验和正在后台计算，稍后重新请求
+	LineCount       int       `json:"line_count,omitempty"`
+	MalformedLines  int       `json:"malformed_lines,omitempty"`
 }
 
 // StatsResponse 统计信息响应
@@ -93,10 +190,10 @@ func (api *APIServer) validateRequest(r *http.Request) error {
 			return fmt.Errorf("unsupported content type: %s", contentType)
 		}
 	}
-	
+
 	// 检查请求大小
 	r.Body = http.MaxBytesReader(nil, r.Body, 1<<20) // 1MB limit
-	
+
 	return nil
 }
 
@@ -105,32 +202,69 @@ func generateRequestID() string {
 	return fmt.Sprintf("%d-%d", time.Now().UnixNano(), time.Now().Nanosecond()%1000)
 }
 
-// SetupAPIRoutes 设置API路由
+// responseRequestID 返回响应头中的X-Request-ID，没有经过request_id中间件时生成新的ID
+func responseRequestID(w http.ResponseWriter) string {
+	if id := w.Header().Get(requestIDHeader); id != "" {
+		return id
+	}
+	return generateRequestID()
+}
+
+// SetupAPIRoutes 在默认的ServeMux上设置API路由
 func (api *APIServer) SetupAPIRoutes() {
+	api.registerRoutes(func(pattern string, handler http.HandlerFunc, exempt ...string) {
+		http.DefaultServeMux.HandleFunc(pattern, handler)
+	})
+}
+
+// registerRoutes 通过handle注册API路由，健康检查和运行指标不限流
+func (api *APIServer) registerRoutes(handle routeHandler) {
 	// 日志查询API
-	http.HandleFunc("/api/v1/logs/search", api.handleLogSearch)
-	http.HandleFunc("/api/v1/logs/trace/", api.handleLogSearchByTraceID)
-	http.HandleFunc("/api/v1/logs/span/", api.handleLogSearchBySpanID)
-	http.HandleFunc("/api/v1/logs/level/", api.handleLogSearchByLevel)
-	http.HandleFunc("/api/v1/logs/service/", api.handleLogSearchByService)
-	http.HandleFunc("/api/v1/logs/errors", api.handleErrorLogs)
+	handle("/api/v1/logs/search", api.handleLogSearch)
+	handle("/api/v1/logs/trace/", api.handleLogSearchByTraceID)
+	handle("/api/v1/logs/span/", api.handleLogSearchBySpanID)
+	handle("/api/v1/logs/level/", api.handleLogSearchByLevel)
+	handle("/api/v1/logs/service/", api.handleLogSearchByService)
+	handle("/api/v1/logs/errors", api.handleErrorLogs)
+	handle("/api/v1/errors/grouped", api.handleGroupedErrors)
+	handle("/api/v1/dashboard", api.handleDashboard)
+	handle("/api/v1/preferences", api.handlePreferences)
+	handle("/api/v1/config/ui", api.handleUIConfig)
+	handle(exportPath, api.handleLogExport)
+	handle(queriesPath, api.handleDeleteQuery)
+	handle(federatedSearchPath, api.handleFederatedSearch)
 
 	// 日志写入API
-	http.HandleFunc("/api/v1/logs/write", api.handleLogWrite)
+	handle("/api/v1/logs/write", api.handleLogWrite)
+	handle(batchWritePath, api.handleLogBatchWrite)
 
 	// 文件管理API
-	http.HandleFunc("/api/v1/files", api.handleGetFiles)
-	http.HandleFunc("/api/v1/files/", api.handleFileOperations)
-	http.HandleFunc("/api/v1/files/content/", api.handleGetFileContent)
+	handle("/api/v1/files", api.handleGetFiles)
+	handle("/api/v1/files/", api.handleFileOperations)
+	handle("/api/v1/files/content/", api.handleGetFileContent)
 
 	// 统计信息API
-	http.HandleFunc("/api/v1/stats", api.handleGetStats)
+	handle("/api/v1/stats", api.handleGetStats)
+
+	// 维护API
+	handle("/api/v1/maintenance/cleanup", api.handleMaintenanceCleanup)
+
+	// 聚合器信息API
+	handle("/api/v1/aggregator/info", api.handleAggregatorInfo)
+	handle("/api/v1/aggregator/flush", api.handleAggregatorFlush)
+	handle("/api/v1/aggregator/rotate", api.handleAggregatorRotate)
+	handle("/api/v1/aggregator/files", api.handleAggregatorFiles)
+	handle("/api/v1/index/compact", api.handleIndexCompact)
 
-	// 健康检查API
-	http.HandleFunc("/api/v1/health", api.handleHealthCheck)
+	// 健康检查和运行指标不限流
+	handle("/api/v1/health", api.handleHealthCheck, MiddlewareRateLimit)
+	handle("/api/v1/metrics", api.handleMetrics, MiddlewareRateLimit)
 }
 
-// handleLogSearch 处理日志搜索
+// maxSearchLimit /api/v1/logs/search每页的最大条数，超过时使用默认的100条
+const maxSearchLimit = 10000
+
+// 日志搜索API
 func (api *APIServer) handleLogSearch(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		api.sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -143,6 +277,12 @@ func (api *APIServer) handleLogSearch(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	loc, err := parseTimezoneParam(r)
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var req LogQueryRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		api.sendErrorResponse(w, "Invalid JSON format", http.StatusBadRequest)
@@ -150,61 +290,156 @@ func (api *APIServer) handleLogSearch(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 验证和设置默认值
-	if req.Limit <= 0 || req.Limit > 10000 {
+	if req.Limit <= 0 || req.Limit > maxSearchLimit {
 		req.Limit = 100
 	}
 	if req.Offset < 0 {
 		req.Offset = 0
 	}
+	if req.QueryID != "" {
+		api.handleCachedSearch(w, r, req, loc)
+		return
+	}
 
 	// 验证时间范围
 	if !req.StartTime.IsZero() && !req.EndTime.IsZero() && req.StartTime.After(req.EndTime) {
 		api.sendErrorResponse(w, "Start time cannot be after end time", http.StatusBadRequest)
 		return
 	}
+	if req.StartTime, req.EndTime, err = resolveTimeRange(req.StartTime, req.EndTime, req.Since, req.Until, loc); err != nil {
+		api.sendQueryError(w, err)
+		return
+	}
+
+	level, err := parseLevelParam(req.Level)
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	start := time.Now()
-	query := logz.LogQuery{
+	query := aggregate.LogQuery{
 		TraceID:   strings.TrimSpace(req.TraceID),
 		SpanID:    strings.TrimSpace(req.SpanID),
-		Level:     strings.ToLower(strings.TrimSpace(req.Level)),
+		Level:     level,
 		Service:   strings.TrimSpace(req.Service),
+		Hostname:  strings.TrimSpace(req.Hostname),
 		Message:   strings.TrimSpace(req.Message),
 		StartTime: req.StartTime,
 		EndTime:   req.EndTime,
 		Limit:     req.Limit,
 		Offset:    req.Offset,
 		UseIndex:  req.UseIndex,
+		Strict:    req.Strict,
+
+		HasStack:     req.HasStack,
+		RequireIndex: req.RequireIndex,
+		AllowPartial: req.AllowPartial,
+		Explain:      req.Explain || wantExplain(r),
+		SortOrder:    req.SortOrder,
+		Refs:         req.Cache && api.ws.queryCache.enabled(),
 	}
 
-	result, err := logz.QueryLogs(query, api.ws.logDir)
+	result, err := api.ws.queryLogs(r.Context(), query)
 	if err != nil {
-		api.sendErrorResponse(w, fmt.Sprintf("Search failed: %v", err), http.StatusInternalServerError)
+		api.sendQueryError(w, fmt.Errorf("Search failed: %w", err))
 		return
 	}
 
-	// 添加性能指标
-	duration := time.Since(start)
-	enhancedResult := map[string]interface{}{
-		"result":     result,
+	queryInfo := map[string]interface{}{
+		"use_index": req.UseIndex,
+		"limit":     req.Limit,
+		"offset":    req.Offset,
+		"strict":    req.Strict,
+	}
+	addTimeRangeInfo(queryInfo, req.Since, req.Until, req.StartTime, req.EndTime)
+	response := api.ws.searchResponse(result, loc, time.Since(start), queryInfo)
+	if query.Refs {
+		if id := api.ws.cacheQuery(result, queryInfo); id != "" {
+			response["query_id"] = id
+		}
+	}
+
+	api.sendSuccessResponse(w, response)
+}
+
+// handleCachedSearch 按query_id从缓存的查询结果中读取一页，只读取该页条目所在的文件
+// 查询不存在、已过期或日志文件已变化时返回404 query_not_found，客户端需重新查询
+func (api *APIServer) handleCachedSearch(w http.ResponseWriter, r *http.Request, req LogQueryRequest, loc *time.Location) {
+	start := time.Now()
+	cached, err := api.ws.queryCache.get(req.QueryID)
+	if err != nil {
+		api.sendErrorResponseWithCode(w, err.Error(), http.StatusNotFound, "query_not_found")
+		return
+	}
+	result, err := aggregate.ReadRefsPage(r.Context(), cached.logDir, cached.refs, req.Offset, req.Limit, req.Explain || wantExplain(r))
+	if err != nil {
+		api.ws.queryCache.invalidate(cached.id)
+		api.sendQueryError(w, fmt.Errorf("Search failed: %w", err))
+		return
+	}
+	result.ParseErrors = cached.parseErrors
+
+	queryInfo := make(map[string]interface{}, len(cached.queryInfo)+1)
+	for key, value := range cached.queryInfo {
+		queryInfo[key] = value
+	}
+	queryInfo["limit"] = req.Limit
+	queryInfo["offset"] = req.Offset
+	queryInfo["cached"] = true
+	response := api.ws.searchResponse(result, loc, time.Since(start), queryInfo)
+	response["query_id"] = cached.id
+	api.sendSuccessResponse(w, response)
+}
+
+// cacheQuery 缓存查询结果的条目位置，返回query_id
+// 日志存储不是本地目录、结果没有条目位置或不完整时不缓存，返回空字符串
+func (ws *WebServer) cacheQuery(result *aggregate.LogQueryResult, queryInfo map[string]interface{}) string {
+	logDir, ok := ws.storeLogDir()
+	if !ok || result.Refs == nil || result.Truncated || len(result.ReadErrors) > 0 {
+		return ""
+	}
+	return ws.queryCache.put(&cachedQuery{
+		logDir:      logDir,
+		refs:        result.Refs,
+		sources:     result.Sources,
+		parseErrors: result.ParseErrors,
+		queryInfo:   queryInfo,
+	})
+}
+
+// searchResponse 返回搜索接口的响应：查询结果、耗时、查询条件和被跳过的无效行
+func (ws *WebServer) searchResponse(result *aggregate.LogQueryResult, loc *time.Location, duration time.Duration, queryInfo map[string]interface{}) map[string]interface{} {
+	// 汇总被跳过的无效行
+	var skippedLines int
+	for _, count := range result.ParseErrors {
+		skippedLines += count
+	}
+	return map[string]interface{}{
+		"result":     ws.displayResult(result, loc),
 		"duration":   duration.String(),
-		"query_info": map[string]interface{}{
-			"use_index": req.UseIndex,
-			"limit":     req.Limit,
-			"offset":    req.Offset,
+		"query_info": queryInfo,
+		"parse_errors": map[string]interface{}{
+			"skipped_lines": skippedLines,
+			"files":         len(result.ParseErrors),
 		},
 	}
-
-	api.sendSuccessResponse(w, enhancedResult)
 }
 
-// handleLogSearchByTraceID 根据TraceID搜索日志
+// handleLogSearchByTraceID 根据TraceID搜索日志，按时间升序排列，用于trace时间线
+// 可用start_time和end_time（RFC3339）限定时间范围，sort_order=desc时最新的在前
 func (api *APIServer) handleLogSearchByTraceID(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		api.sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	loc, err := parseTimezoneParam(r)
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	traceID := strings.TrimPrefix(r.URL.Path, "/api/v1/logs/trace/")
 	if traceID == "" {
 		api.sendErrorResponse(w, "TraceID is required", http.StatusBadRequest)
@@ -218,13 +453,26 @@ func (api *APIServer) handleLogSearchByTraceID(w http.ResponseWriter, r *http.Re
 
 	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
 
-	result, err := logz.QueryLogsByTraceID(traceID, api.ws.logDir, limit, offset)
+	start, end, err := parseTimeRangeParams(r.URL.Query(), loc)
 	if err != nil {
-		api.sendErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	api.sendSuccessResponse(w, result)
+	query := aggregate.TraceQuery(traceID, start, end)
+	query.Limit = limit
+	query.Offset = offset
+	query.Explain = wantExplain(r)
+	if order := r.URL.Query().Get("sort_order"); order != "" {
+		query.SortOrder = order
+	}
+	result, err := api.ws.queryLogs(r.Context(), query)
+	if err != nil {
+		api.sendQueryError(w, err)
+		return
+	}
+
+	api.sendSuccessResponse(w, api.ws.displayResult(result, loc))
 }
 
 // handleLogSearchBySpanID 根据SpanID搜索日志
@@ -234,6 +482,12 @@ func (api *APIServer) handleLogSearchBySpanID(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	loc, err := parseTimezoneParam(r)
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	spanID := strings.TrimPrefix(r.URL.Path, "/api/v1/logs/span/")
 	if spanID == "" {
 		api.sendErrorResponse(w, "SpanID is required", http.StatusBadRequest)
@@ -247,13 +501,20 @@ func (api *APIServer) handleLogSearchBySpanID(w http.ResponseWriter, r *http.Req
 
 	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
 
-	result, err := logz.QueryLogsBySpanID(spanID, api.ws.logDir, limit, offset)
+	query := aggregate.LogQuery{
+		SpanID:   spanID,
+		Limit:    limit,
+		Offset:   offset,
+		UseIndex: true,
+		Explain:  wantExplain(r),
+	}
+	result, err := api.ws.queryLogs(r.Context(), query)
 	if err != nil {
-		api.sendErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		api.sendQueryError(w, err)
 		return
 	}
 
-	api.sendSuccessResponse(w, result)
+	api.sendSuccessResponse(w, api.ws.displayResult(result, loc))
 }
 
 // handleLogSearchByLevel 根据日志级别搜索
@@ -263,11 +524,22 @@ func (api *APIServer) handleLogSearchByLevel(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	loc, err := parseTimezoneParam(r)
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	level := strings.TrimPrefix(r.URL.Path, "/api/v1/logs/level/")
 	if level == "" {
 		api.sendErrorResponse(w, "Level is required", http.StatusBadRequest)
 		return
 	}
+	level, err = logz.NormalizeLevel(level)
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
 	if limit == 0 {
@@ -276,13 +548,20 @@ func (api *APIServer) handleLogSearchByLevel(w http.ResponseWriter, r *http.Requ
 
 	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
 
-	result, err := logz.QueryLogsByLevel(level, api.ws.logDir, limit, offset)
+	query := aggregate.LogQuery{
+		Level:    level,
+		Limit:    limit,
+		Offset:   offset,
+		UseIndex: true,
+		Explain:  wantExplain(r),
+	}
+	result, err := api.ws.queryLogs(r.Context(), query)
 	if err != nil {
-		api.sendErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		api.sendQueryError(w, err)
 		return
 	}
 
-	api.sendSuccessResponse(w, result)
+	api.sendSuccessResponse(w, api.ws.displayResult(result, loc))
 }
 
 // handleLogSearchByService 根据服务名搜索
@@ -292,6 +571,12 @@ func (api *APIServer) handleLogSearchByService(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	loc, err := parseTimezoneParam(r)
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	service := strings.TrimPrefix(r.URL.Path, "/api/v1/logs/service/")
 	if service == "" {
 		api.sendErrorResponse(w, "Service name is required", http.StatusBadRequest)
@@ -305,13 +590,20 @@ func (api *APIServer) handleLogSearchByService(w http.ResponseWriter, r *http.Re
 
 	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
 
-	result, err := logz.QueryLogsByService(service, api.ws.logDir, limit, offset)
+	query := aggregate.LogQuery{
+		Service:  service,
+		Limit:    limit,
+		Offset:   offset,
+		UseIndex: true,
+		Explain:  wantExplain(r),
+	}
+	result, err := api.ws.queryLogs(r.Context(), query)
 	if err != nil {
-		api.sendErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		api.sendQueryError(w, err)
 		return
 	}
 
-	api.sendSuccessResponse(w, result)
+	api.sendSuccessResponse(w, api.ws.displayResult(result, loc))
 }
 
 // handleErrorLogs 获取错误日志
@@ -321,6 +613,12 @@ func (api *APIServer) handleErrorLogs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	loc, err := parseTimezoneParam(r)
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
 	if limit == 0 {
 		limit = 100
@@ -328,13 +626,84 @@ func (api *APIServer) handleErrorLogs(w http.ResponseWriter, r *http.Request) {
 
 	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
 
-	result, err := logz.QueryLogsByLevel("error", api.ws.logDir, limit, offset)
+	query := aggregate.LogQuery{
+		Level:    "error",
+		Limit:    limit,
+		Offset:   offset,
+		UseIndex: true,
+	}
+	result, err := api.ws.queryLogs(r.Context(), query)
 	if err != nil {
-		api.sendErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		api.sendQueryError(w, err)
 		return
 	}
 
-	api.sendSuccessResponse(w, result)
+	api.sendSuccessResponse(w, api.ws.displayResult(result, loc))
+}
+
+// handleGroupedErrors 按指纹分组返回时间窗口内的错误日志
+func (api *APIServer) handleGroupedErrors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		api.sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	window, err := parseWindowParam(r, 24*time.Hour)
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// 指定开始时间时不使用window
+	params := r.URL.Query()
+	if params.Get("window") != "" && (params.Get("start_time") != "" || params.Get("since") != "") {
+		api.sendErrorResponse(w, "window cannot be combined with start_time or since", http.StatusBadRequest)
+		return
+	}
+	start, end, err := parseTimeRangeParams(params, nil)
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if start.IsZero() {
+		start = time.Now().Add(-window)
+	}
+
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+
+	level, err := parseLevelParam(r.URL.Query().Get("level"))
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := aggregate.LogQuery{
+		Level:     level,
+		Service:   r.URL.Query().Get("service"),
+		StartTime: start,
+		EndTime:   end,
+		Limit:     limit,
+	}
+	query = api.ws.logQuery(query)
+	ctx, release, err := api.ws.admitQuery(r.Context(), query)
+	if err != nil {
+		api.sendQueryError(w, err)
+		return
+	}
+	defer release()
+
+	groups, err := aggregate.GroupErrorsContext(ctx, query, api.ws.logDir)
+	if err != nil {
+		api.sendQueryError(w, err)
+		return
+	}
+
+	queryInfo := make(map[string]interface{})
+	addTimeRangeInfo(queryInfo, params.Get("since"), params.Get("until"), start, end)
+	api.sendSuccessResponse(w, map[string]interface{}{
+		"window":     window.String(),
+		"groups":     groups,
+		"query_info": queryInfo,
+	})
 }
 
 // handleLogWrite 处理日志写入
@@ -343,12 +712,18 @@ func (api *APIServer) handleLogWrite(w http.ResponseWriter, r *http.Request) {
 		api.sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	receivedAt := time.Now()
 
 	// 验证请求
 	if err := api.validateRequest(r); err != nil {
 		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	mode, err := parseWriteMode(r.URL.Query())
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	var req LogWriteRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -362,19 +737,57 @@ func (api *APIServer) handleLogWrite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 设置默认时间戳
+	// 创建日志条目，按写入限制截断后记录来源并调用增强函数
+	entry := newLogEntry(&req, receivedAt)
+	if err := api.ws.limitEntry(&entry); err != nil {
+		api.sendErrorResponseWithCode(w, fmt.Sprintf("Log entry rejected: %v", err), writeErrorStatus(err), aggregate.ErrorCode(err))
+		return
+	}
+	if err := api.ws.enrichEntry(&entry, r, receivedAt); err != nil {
+		api.sendErrorResponseWithCode(w, fmt.Sprintf("Log entry rejected: %v", err), http.StatusUnprocessableEntity, "entry_rejected")
+		return
+	}
+
+	// 写入到聚合器，没有聚合器时按配置写入received目录或默认日志器
+	// sync或durable时立即写入并返回条目的位置，否则进入聚合器的批量缓冲区
+	var destination aggregate.WriteDestination
+	var position aggregate.WritePosition
+	if mode.sync {
+		destination, position, err = aggregate.WriteWithFallbackSync(entry, api.ws.writeFallbackConfig(), mode.durable)
+	} else {
+		destination, err = aggregate.WriteWithFallback(entry, api.ws.writeFallbackConfig())
+	}
+	if err != nil {
+		api.sendErrorResponseWithCode(w, fmt.Sprintf("Failed to write log: %v", err), writeErrorStatus(err), aggregate.ErrorCode(err))
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":     "Log entry written successfully",
+		"entry_id":    fmt.Sprintf("%s-%d", req.Service, req.Timestamp.UnixNano()),
+		"timestamp":   req.Timestamp.Format(time.RFC3339Nano),
+		"destination": destination,
+	}
+	if mode.sync {
+		response["position"] = position
+		setWritePosition(w, position)
+	}
+
+	api.sendSuccessResponseWithMessage(w, response, "Log written successfully")
+}
+
+// newLogEntry 由验证后的写入请求创建日志条目，未设置时间戳时使用收到请求的时间
+func newLogEntry(req *LogWriteRequest, receivedAt time.Time) aggregate.LogEntry {
 	if req.Timestamp.IsZero() {
-		req.Timestamp = time.Now()
+		req.Timestamp = receivedAt
 	}
 
-	// 清理和规范化字段
-	req.Level = strings.ToLower(strings.TrimSpace(req.Level))
+	// 清理和规范化字段（级别已在验证时规范化）
 	req.Message = strings.TrimSpace(req.Message)
 	req.Service = strings.TrimSpace(req.Service)
 
-	// 创建日志条目
-	entry := logz.LogEntry{
-		Timestamp: req.Timestamp.Format(time.RFC3339),
+	return aggregate.LogEntry{
+		Timestamp: req.Timestamp.Format(time.RFC3339Nano),
 		Level:     req.Level,
 		Message:   req.Message,
 		TraceID:   req.TraceID,
@@ -383,40 +796,36 @@ func (api *APIServer) handleLogWrite(w http.ResponseWriter, r *http.Request) {
 		Caller:    req.Caller,
 		Fields:    req.Fields,
 	}
+}
 
-	// 写入到聚合器
-	if err := logz.WriteToAggregator(entry); err != nil {
-		api.sendErrorResponse(w, fmt.Sprintf("Failed to write log: %v", err), http.StatusInternalServerError)
-		return
-	}
-
-	response := map[string]interface{}{
-		"message":   "Log entry written successfully",
-		"entry_id":  fmt.Sprintf("%s-%d", req.Service, req.Timestamp.UnixNano()),
-		"timestamp": req.Timestamp.Format(time.RFC3339),
-	}
-
-	api.sendSuccessResponseWithMessage(w, response, "Log written successfully")
+// writeErrorStatus 返回写入失败时的状态码
+func writeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, aggregate.ErrNoAggregator):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, aggregate.ErrDiskFull):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, aggregate.ErrWriteFailing):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, aggregate.ErrEntryTooLarge):
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusInternalServerError
 }
 
 // validateLogWriteRequest 验证日志写入请求
 func (api *APIServer) validateLogWriteRequest(req *LogWriteRequest) error {
-	// 验证级别
-	validLevels := map[string]bool{
-		"debug": true, "info": true, "warn": true,
-		"error": true, "fatal": true, "panic": true,
-	}
-	if !validLevels[strings.ToLower(req.Level)] {
-		return fmt.Errorf("invalid log level: %s", req.Level)
+	// 验证并规范化级别
+	level, err := logz.NormalizeLevel(req.Level)
+	if err != nil {
+		return err
 	}
+	req.Level = level
 
-	// 验证消息长度
+	// 验证消息不为空，过长的消息由写入限制截断
 	if len(req.Message) == 0 {
 		return fmt.Errorf("message cannot be empty")
 	}
-	if len(req.Message) > 10000 {
-		return fmt.Errorf("message too long (max 10000 characters)")
-	}
 
 	// 验证其他字段长度
 	if len(req.TraceID) > 64 {
@@ -439,13 +848,21 @@ func (api *APIServer) handleGetFiles(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	files, err := api.ws.getLogFilesList()
+	list, err := parseFileListOptions(r.URL.Query())
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	files, total, err := api.ws.getLogFilesList(list)
 	if err != nil {
 		api.sendErrorResponse(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if wantChecksum(r) {
+		api.ws.withChecksums(files)
+	}
 
-	api.sendSuccessResponse(w, files)
+	api.writeResponse(w, APIResponse{Success: true, Data: files, Total: &total, Code: http.StatusOK})
 }
 
 // handleFileOperations 处理文件操作
@@ -456,12 +873,51 @@ func (api *APIServer) handleFileOperations(w http.ResponseWriter, r *http.Reques
 	case "DELETE":
 		api.handleDeleteFile(w, r, filename)
 	case "GET":
+		if name, ok := strings.CutSuffix(filename, "/verify"); ok {
+			api.handleVerifyFile(w, r, name)
+			return
+		}
+		if name, ok := strings.CutSuffix(filename, "/download"); ok {
+			api.handleDownloadFile(w, r, name)
+			return
+		}
 		api.handleGetFileInfo(w, r, filename)
 	default:
 		api.sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
+// handleDownloadFile 以附件下载日志文件的原始内容（压缩文件不解压），支持Range请求
+// 默认使用日志文件名，可用filename参数指定，扩展名与日志文件相同；下载大文件不受路由超时限制
+func (api *APIServer) handleDownloadFile(w http.ResponseWriter, r *http.Request, filename string) {
+	path, err := api.validateFilename(filename)
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), fileErrorStatus(err))
+		return
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil || !stat.Mode().IsRegular() {
+		api.sendErrorResponse(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	base := filepath.Base(path)
+	ext := strings.TrimPrefix(filepath.Ext(base), ".")
+	defaultName := sanitizeFilename(strings.TrimSuffix(base, filepath.Ext(base)), ext)
+	setAttachment(w, requestedFilename(r, defaultName, ext))
+	// 不使用可压缩的内容类型，避免gzip中间件与Range请求冲突
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", stat.ModTime(), file)
+}
+
 // handleGetFileContent 获取文件内容
 func (api *APIServer) handleGetFileContent(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
@@ -481,22 +937,51 @@ func (api *APIServer) handleGetFileContent(w http.ResponseWriter, r *http.Reques
 	}
 
 	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
-	search := r.URL.Query().Get("search")
+	filter, err := parseContentFilter(r.URL.Query())
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	content, total, err := api.ws.readLogFile(filepath.Join(api.ws.logDir, filename), limit, offset, search)
+	mode, err := parseContentMode(r.URL.Query(), filter)
 	if err != nil {
-		api.sendErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	result := map[string]interface{}{
-		"content":  content,
-		"total":    total,
-		"limit":    limit,
-		"offset":   offset,
-		"filename": filename,
+	path, err := aggregate.ResolveLogPath(api.ws.logDir, filename)
+	if err != nil {
+		api.sendErrorResponse(w, "Invalid filename", http.StatusBadRequest)
+		return
+	}
+
+	switch mode.mode {
+	case contentModeTail:
+		content, err := api.ws.readTail(r.Context(), path, mode.lines, filter)
+		if err != nil {
+			api.sendErrorResponse(w, err.Error(), contentModeStatus(err))
+			return
+		}
+		result := content.result(filter, mode.lines)
+		result["filename"] = filename
+		api.sendSuccessResponse(w, result)
+		return
+	case contentModeRange:
+		if err := api.ws.serveByteRange(w, path, mode); err != nil {
+			api.sendErrorResponse(w, err.Error(), contentModeStatus(err))
+		}
+		return
+	}
+
+	content, err := api.ws.readLogFile(r.Context(), path, limit, offset, filter)
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), fileErrorStatus(err))
+		return
 	}
 
+	result := content.result(filter, limit, offset)
+	result["filename"] = filename
+
 	api.sendSuccessResponse(w, result)
 }
 
@@ -507,15 +992,24 @@ func (api *APIServer) handleGetStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stats, err := logz.GetLogStats(api.ws.logDir)
+	stats, err := api.ws.collectStats(r.Context())
 	if err != nil {
-		api.sendErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		api.sendQueryError(w, err)
 		return
 	}
 
 	api.sendSuccessResponse(w, stats)
 }
 
+// handleUIConfig 返回页面使用的配置：追踪界面的链接模板
+func (api *APIServer) handleUIConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		api.sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	api.sendSuccessResponse(w, api.ws.traceLinks)
+}
+
 // handleHealthCheck 健康检查
 func (api *APIServer) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
@@ -530,17 +1024,190 @@ func (api *APIServer) handleHealthCheck(w http.ResponseWriter, r *http.Request)
 		"version":   "1.0.0",
 	}
 
+	// 邮件通知子检查：启用邮件通知时验证SMTP服务器可以连接和认证
+	emailCheck := map[string]interface{}{"status": "ok"}
+	ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+	defer cancel()
+	if err := logz.ValidateEmailSetupContext(ctx); err != nil {
+		if errors.Is(err, logz.ErrEmailDisabled) {
+			emailCheck["status"] = "disabled"
+		} else {
+			emailCheck["status"] = "error"
+			emailCheck["error"] = err.Error()
+			health["status"] = "degraded"
+		}
+	}
+	checks := map[string]interface{}{
+		"email": emailCheck,
+	}
+
+	// 磁盘空间子检查：全局聚合器设置了磁盘空间保护时返回当前阶段
+	if aggregator := aggregate.GetGlobalAggregator(); aggregator != nil {
+		aggregatorHealth := aggregator.Health()
+		if aggregatorHealth.DiskStage != "" {
+			checks["disk"] = map[string]interface{}{
+				"status":     aggregatorHealth.DiskStage,
+				"free_bytes": aggregatorHealth.DiskFreeBytes,
+				"dropped":    aggregatorHealth.DiskDropped,
+			}
+			if aggregatorHealth.DiskStage != aggregate.DiskOK.String() {
+				health["status"] = "degraded"
+			}
+		}
+
+		// 写入子检查：写入数据文件持续失败时，条目在缓冲区中等待重试
+		writes := aggregatorHealth.Writes
+		writeCheck := map[string]interface{}{
+			"status":    "ok",
+			"rejected":  writes.Rejected,
+			"recovered": writes.Recovered,
+		}
+		if writes.Failing {
+			writeCheck["status"] = "failing"
+			writeCheck["consecutive_failures"] = writes.ConsecutiveFailures
+			writeCheck["failing_since"] = writes.FailingSince.Format(time.RFC3339)
+			writeCheck["last_error"] = writes.LastError
+			writeCheck["buffered"] = writes.Buffered
+			health["status"] = "degraded"
+		}
+		checks["write"] = writeCheck
+	}
+	health["checks"] = checks
+
 	api.sendSuccessResponse(w, health)
 }
 
+// handleMaintenanceCleanup 清理过期日志文件
+func (api *APIServer) handleMaintenanceCleanup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		api.sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	days := 7
+	if daysStr := r.URL.Query().Get("days"); daysStr != "" {
+		parsed, err := strconv.Atoi(daysStr)
+		if err != nil || parsed < 1 {
+			api.sendErrorResponse(w, "days must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		days = parsed
+	}
+
+	dryRun := false
+	if dryRunStr := r.URL.Query().Get("dry_run"); dryRunStr != "" {
+		parsed, err := strconv.ParseBool(dryRunStr)
+		if err != nil {
+			api.sendErrorResponse(w, "dry_run must be a boolean", http.StatusBadRequest)
+			return
+		}
+		dryRun = parsed
+	}
+
+	report, err := aggregate.CleanupOldLogsWithDryRun(api.ws.logDir, days, dryRun)
+	if err != nil {
+		api.sendQueryError(w, fmt.Errorf("Cleanup failed: %w", err))
+		return
+	}
+
+	errorMessages := make([]string, 0, len(report.Errors))
+	for _, cleanupErr := range report.Errors {
+		errorMessages = append(errorMessages, cleanupErr.Error())
+	}
+
+	result := map[string]interface{}{
+		"report": report,
+		"days":   days,
+		"errors": errorMessages,
+	}
+
+	api.sendSuccessResponse(w, result)
+}
+
+// handleAggregatorInfo 获取聚合器元数据（数据文件、索引桶、队列状态）
+func (api *APIServer) handleAggregatorInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		api.sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	info, err := aggregate.DescribeLogDir(api.ws.logDir)
+	if err != nil {
+		api.sendErrorResponse(w, fmt.Sprintf("Describe failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	api.sendSuccessResponse(w, info)
+}
+
+// handleAggregatorFlush 将全局聚合器缓冲的日志写入文件并等待索引完成
+func (api *APIServer) handleAggregatorFlush(w http.ResponseWriter, r *http.Request) {
+	api.handleAggregatorAction(w, r, "Flush", aggregate.FlushAggregator)
+}
+
+// handleAggregatorRotate 立即轮转全局聚合器的文件，用于备份目录之前
+func (api *APIServer) handleAggregatorRotate(w http.ResponseWriter, r *http.Request) {
+	api.handleAggregatorAction(w, r, "Rotate", aggregate.RotateAggregator)
+}
+
+// handleAggregatorFiles 返回全局聚合器的文件注册表，包括每个文件的状态和轮转、压缩、清理时间
+func (api *APIServer) handleAggregatorFiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		api.sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	files, err := aggregate.AggregatorFiles()
+	if err != nil {
+		api.sendQueryError(w, err)
+		return
+	}
+	api.sendSuccessResponse(w, files)
+}
+
+// handleAggregatorAction 对全局聚合器执行操作，返回操作后的聚合器信息
+func (api *APIServer) handleAggregatorAction(w http.ResponseWriter, r *http.Request, name string, action func() error) {
+	if r.Method != "POST" {
+		api.sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := action(); err != nil {
+		api.sendQueryError(w, fmt.Errorf("%s failed: %w", name, err))
+		return
+	}
+
+	info, err := aggregate.DescribeLogDir(api.ws.logDir)
+	if err != nil {
+		api.sendErrorResponse(w, fmt.Sprintf("Describe failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+	api.sendSuccessResponse(w, info)
+}
+
+// handleIndexCompact 压缩全局聚合器的索引数据库，返回压缩前后的大小
+func (api *APIServer) handleIndexCompact(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		api.sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats, err := aggregate.CompactAggregatorIndex(r.Context())
+	if err != nil {
+		api.sendQueryError(w, fmt.Errorf("Compact failed: %w", err))
+		return
+	}
+	api.sendSuccessResponse(w, stats)
+}
+
 // handleDeleteFile 处理文件删除
 func (api *APIServer) handleDeleteFile(w http.ResponseWriter, r *http.Request, filename string) {
-	if strings.Contains(filename, "..") || strings.Contains(filename, "/") {
+	filepath, err := aggregate.ResolveLogPath(api.ws.logDir, filename)
+	if err != nil {
 		api.sendErrorResponse(w, "Invalid filename", http.StatusBadRequest)
 		return
 	}
 
-	filepath := filepath.Join(api.ws.logDir, filename)
 	if err := os.Remove(filepath); err != nil {
 		api.sendErrorResponse(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -551,12 +1218,12 @@ func (api *APIServer) handleDeleteFile(w http.ResponseWriter, r *http.Request, f
 
 // handleGetFileInfo 获取文件信息
 func (api *APIServer) handleGetFileInfo(w http.ResponseWriter, r *http.Request, filename string) {
-	if err := api.validateFilename(filename); err != nil {
+	filepath, err := api.validateFilename(filename)
+	if err != nil {
 		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	filepath := filepath.Join(api.ws.logDir, filename)
 	stat, err := os.Stat(filepath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -567,57 +1234,68 @@ func (api *APIServer) handleGetFileInfo(w http.ResponseWriter, r *http.Request,
 		return
 	}
 
-	// 计算行数（对于文本文件）
-	lineCount, _ := api.countFileLines(filepath)
+	// 计算行数和无效行数，压缩文件按解压后的内容统计
+	lineCount, malformedLines, err := aggregate.CountLinesContext(r.Context(), filepath)
+	if err != nil {
+		api.sendErrorResponse(w, fmt.Sprintf("Failed to read file: %v", err), fileErrorStatus(err))
+		return
+	}
 
 	// 格式化文件大小
 	sizeHuman := api.formatFileSize(stat.Size())
 
 	fileInfo := FileInfoResponse{
-		Name:         stat.Name(),
-		Size:         stat.Size(),
-		SizeHuman:    sizeHuman,
-		ModTime:      stat.ModTime(),
-		IsCompressed: strings.HasSuffix(filepath, ".gz"),
-		Path:         filepath,
-		LineCount:    lineCount,
+		Name:           aggregate.RelativeLogPath(api.ws.logDir, filepath),
+		Size:           stat.Size(),
+		SizeHuman:      sizeHuman,
+		ModTime:        stat.ModTime(),
+		IsCompressed:   strings.HasSuffix(filepath, ".gz"),
+		Path:           filepath,
+		LineCount:      lineCount,
+		MalformedLines: malformedLines,
+	}
+	if wantChecksum(r) {
+		fileInfo.Checksum, _ = api.ws.checksums.lookup(filepath, stat)
+		fileInfo.ChecksumPending = fileInfo.Checksum == ""
 	}
 
 	api.sendSuccessResponse(w, fileInfo)
 }
 
-// validateFilename 验证文件名
-func (api *APIServer) validateFilename(filename string) error {
+// validateFilename 验证相对于日志目录的文件路径，返回日志目录内的完整路径
+func (api *APIServer) validateFilename(filename string) (string, error) {
 	if filename == "" {
-		return fmt.Errorf("filename cannot be empty")
-	}
-	if strings.Contains(filename, "..") {
-		return fmt.Errorf("filename cannot contain '..'")
+		return "", fmt.Errorf("filename cannot be empty")
 	}
-	if strings.Contains(filename, "/") || strings.Contains(filename, "\\") {
-		return fmt.Errorf("filename cannot contain path separators")
+	if len(filename) > 4096 {
+		return "", fmt.Errorf("filename too long")
 	}
-	if len(filename) > 255 {
-		return fmt.Errorf("filename too long")
+	path, err := aggregate.ResolveLogPath(api.ws.logDir, filename)
+	if err != nil {
+		return "", fmt.Errorf("invalid filename: %w", err)
 	}
-	return nil
+	return path, nil
 }
 
-// countFileLines 计算文件行数
-func (api *APIServer) countFileLines(filepath string) (int, error) {
-	file, err := os.Open(filepath)
-	if err != nil {
-		return 0, err
+// parseWindowParam 解析window参数（如"1h"），未指定时返回defaultWindow
+func parseWindowParam(r *http.Request, defaultWindow time.Duration) (time.Duration, error) {
+	value := r.URL.Query().Get("window")
+	if value == "" {
+		return defaultWindow, nil
 	}
-	defer file.Close()
-
-	var count int
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		count++
+	window, err := time.ParseDuration(value)
+	if err != nil || window <= 0 {
+		return 0, errors.New("Invalid window")
 	}
+	return window, nil
+}
 
-	return count, scanner.Err()
+// parseLevelParam 规范化请求中的日志级别，为空时不过滤级别
+func parseLevelParam(level string) (string, error) {
+	if strings.TrimSpace(level) == "" {
+		return "", nil
+	}
+	return logz.NormalizeLevel(level)
 }
 
 // formatFileSize 格式化文件大小
@@ -651,7 +1329,7 @@ func (api *APIServer) sendSuccessResponseWithMessage(w http.ResponseWriter, data
 		Message:   message,
 		Code:      http.StatusOK,
 		Timestamp: time.Now(),
-		RequestID: generateRequestID(),
+		RequestID: responseRequestID(w),
 	}
 
 	json.NewEncoder(w).Encode(response)
@@ -662,20 +1340,24 @@ func (api *APIServer) sendErrorResponse(w http.ResponseWriter, message string, s
 	api.sendResponse(w, false, nil, message, statusCode)
 }
 
+// sendErrorResponseWithCode 发送带错误码的错误响应
+func (api *APIServer) sendErrorResponseWithCode(w http.ResponseWriter, message string, statusCode int, errorCode string) {
+	api.writeResponse(w, APIResponse{Error: message, Code: statusCode, ErrorCode: errorCode})
+}
+
 // sendResponse 统一响应处理
 func (api *APIServer) sendResponse(w http.ResponseWriter, success bool, data interface{}, errorMsg string, statusCode int) {
+	api.writeResponse(w, APIResponse{Success: success, Data: data, Error: errorMsg, Code: statusCode})
+}
+
+// writeResponse 补充时间戳和请求ID后以response.Code为状态码写出响应
+func (api *APIServer) writeResponse(w http.ResponseWriter, response APIResponse) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
-	w.WriteHeader(statusCode)
+	w.WriteHeader(response.Code)
 
-	response := APIResponse{
-		Success:   success,
-		Data:      data,
-		Error:     errorMsg,
-		Code:      statusCode,
-		Timestamp: time.Now(),
-		RequestID: generateRequestID(),
-	}
+	response.Timestamp = time.Now()
+	response.RequestID = responseRequestID(w)
 
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		log.Printf("Failed to encode response: %v", err)
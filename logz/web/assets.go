@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// templateReloadEnv 设为true时每次请求重新解析磁盘上的模板，用于开发
+const templateReloadEnv = "TEMPLATE_RELOAD"
+
+// staticMaxAge 静态文件的缓存时间（秒），内嵌文件通过ETag校验
+const staticMaxAge = 3600
+
+// embeddedFiles 编译进程序的默认模板和静态文件，工作目录中没有templates目录时使用
+//
+//go:embed templates static
+var embeddedFiles embed.FS
+
+// webAssets 页面模板和静态文件
+type webAssets struct {
+	source    string             // 来源，启动时打印
+	templates fs.FS              // 包含index.html、view.html、errors.html
+	static    fs.FS              // /static/下的文件
+	pages     *template.Template // 启动时解析的模板集合
+	etags     map[string]string  // 静态文件路径 -> ETag
+	reload    bool               // 每次请求重新解析模板
+}
+
+// WithTemplateReload 设置是否每次请求都重新解析模板，修改磁盘上的模板后无需重启，只用于开发
+func WithTemplateReload(reload bool) WebServerOption {
+	return func(ws *WebServer) {
+		ws.reloadTemplates = reload
+	}
+}
+
+// embeddedAssets 解析内嵌的模板和静态文件，只解析一次；内嵌模板无效时panic
+var embeddedAssets = sync.OnceValue(func() *webAssets {
+	templates, err := fs.Sub(embeddedFiles, "templates")
+	if err != nil {
+		panic(err)
+	}
+	static, err := fs.Sub(embeddedFiles, "static")
+	if err != nil {
+		panic(err)
+	}
+	assets, err := newWebAssets("内嵌", templates, static, false)
+	if err != nil {
+		panic(err)
+	}
+	return assets
+})
+
+// findAssetDir 在当前目录和web子目录中查找包含templates的目录，找不到时返回空字符串
+func findAssetDir() string {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for _, dir := range []string{currentDir, filepath.Join(currentDir, "web")} {
+		if stat, err := os.Stat(filepath.Join(dir, "templates")); err == nil && stat.IsDir() {
+			return dir
+		}
+	}
+	return ""
+}
+
+// loadAssets 优先使用工作目录中的templates和static，找不到时使用内嵌的默认资源
+func (ws *WebServer) loadAssets() error {
+	dir := findAssetDir()
+	if dir == "" {
+		ws.assets = embeddedAssets()
+		return nil
+	}
+	assets, err := newWebAssets("磁盘 "+dir, os.DirFS(filepath.Join(dir, "templates")), os.DirFS(filepath.Join(dir, "static")), ws.reloadTemplates)
+	if err != nil {
+		return err
+	}
+	ws.assets = assets
+	return nil
+}
+
+// newWebAssets 解析模板并计算静态文件的ETag
+func newWebAssets(source string, templates, static fs.FS, reload bool) (*webAssets, error) {
+	pages, err := template.ParseFS(templates, "*.html")
+	if err != nil {
+		return nil, fmt.Errorf("解析模板失败: %w", err)
+	}
+
+	assets := &webAssets{source: source, templates: templates, static: static, pages: pages, reload: reload}
+	if reload {
+		// 静态文件可能随时修改，不计算ETag
+		return assets, nil
+	}
+	assets.etags = make(map[string]string)
+	err = fs.WalkDir(static, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(static, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		// gzipHandler可能压缩响应，使用弱ETag
+		assets.etags[name] = `W/"` + hex.EncodeToString(sum[:8]) + `"`
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取静态文件失败: %w", err)
+	}
+	return assets, nil
+}
+
+// render 渲染页面模板，先渲染到缓冲区，出错时返回500而不是半个页面
+func (a *webAssets) render(w http.ResponseWriter, name string, data any) {
+	pages := a.pages
+	if a.reload {
+		var err error
+		if pages, err = template.ParseFS(a.templates, "*.html"); err != nil {
+			http.Error(w, fmt.Sprintf("解析模板失败: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pages.ExecuteTemplate(&buf, name, data); err != nil {
+		http.Error(w, fmt.Sprintf("渲染模板失败: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	buf.WriteTo(w)
+}
+
+// staticHandler 提供/static/下的文件，内容类型由扩展名决定
+// 启动时计算过ETag的文件带Cache-Control和ETag，客户端可以用If-None-Match校验
+func (a *webAssets) staticHandler() http.Handler {
+	files := http.StripPrefix("/static/", http.FileServer(http.FS(a.static)))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Clean(strings.TrimPrefix(r.URL.Path, "/static/"))
+		if etag, ok := a.etags[name]; ok {
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", staticMaxAge))
+		} else {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		files.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// attachmentTimeLayout 附件文件名中的时间格式，不含冒号，Windows和Excel都能直接打开
+const attachmentTimeLayout = "20060102T150405Z"
+
+// maxAttachmentNameLength 附件文件名（不含扩展名）的最大字节数，超过时在UTF-8字符边界截断
+const maxAttachmentNameLength = 120
+
+// attachmentName 返回导出文件的默认名称logs_<service>_<start>_<end>.<ext>，时间为UTC
+// 没有服务名或时间范围时省略对应部分
+func attachmentName(service string, start, end time.Time, ext string) string {
+	parts := []string{"logs"}
+	if service != "" {
+		parts = append(parts, service)
+	}
+	for _, t := range []time.Time{start, end} {
+		if !t.IsZero() {
+			parts = append(parts, t.UTC().Format(attachmentTimeLayout))
+		}
+	}
+	return sanitizeFilename(strings.Join(parts, "_"), ext)
+}
+
+// requestedFilename 返回附件的文件名：请求带filename参数时使用该参数，否则使用defaultName
+// 两者都经过sanitizeFilename处理，扩展名固定为ext，参数中已经带有相同扩展名时不重复添加
+func requestedFilename(r *http.Request, defaultName, ext string) string {
+	name := r.URL.Query().Get("filename")
+	if strings.TrimSpace(name) == "" {
+		return defaultName
+	}
+	if ext != "" {
+		name = strings.TrimSuffix(name, "."+ext)
+	}
+	return sanitizeFilename(name, ext)
+}
+
+// sanitizeFilename 清理文件名并加上扩展名：去掉控制字符（包括CR、LF），
+// 路径分隔符和Windows不允许的字符替换为下划线，去掉开头的点和首尾空白，超长时截断，为空时使用"logs"
+func sanitizeFilename(name, ext string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r == utf8.RuneError, unicode.IsControl(r):
+			continue
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			b.WriteByte('_')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	base := strings.TrimLeft(strings.TrimSpace(b.String()), ".")
+	if len(base) > maxAttachmentNameLength {
+		cut := maxAttachmentNameLength
+		for cut > 0 && !utf8.RuneStart(base[cut]) {
+			cut--
+		}
+		base = strings.TrimSpace(base[:cut])
+	}
+	if base == "" {
+		base = "logs"
+	}
+	if ext == "" {
+		return base
+	}
+	return base + "." + ext
+}
+
+// setAttachment 设置以附件下载的Content-Disposition，filename必须已经过sanitizeFilename处理
+// filename参数为ASCII回退名称，非ASCII字符替换为下划线；filename*按RFC 5987以UTF-8百分号编码
+func setAttachment(w http.ResponseWriter, filename string) {
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`,
+		asciiFilename(filename), encodeRFC5987(filename)))
+}
+
+// asciiFilename 返回只包含可打印ASCII字符的文件名，用于不支持filename*的客户端
+func asciiFilename(filename string) string {
+	var b strings.Builder
+	for _, r := range filename {
+		if r < ' ' || r > '~' || r == '"' || r == '\\' || r == '%' {
+			b.WriteByte('_')
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// encodeRFC5987 按RFC 5987的attr-char对值进行百分号编码
+func encodeRFC5987(value string) string {
+	const attrChars = "!#$&+-.^_`|~"
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte(attrChars, c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestAttachmentName(t *testing.T) {
+	start := time.Date(2024, 1, 15, 18, 30, 0, 0, time.FixedZone("CST", 8*3600))
+	end := time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		service    string
+		start, end time.Time
+		want       string
+	}{
+		{"完整", "payments", start, end, "logs_payments_20240115T103000Z_20240116T000000Z.jsonl"},
+		{"中文服务名", "支付服务", time.Time{}, end, "logs_支付服务_20240116T000000Z.jsonl"},
+		{"路径和换行", "../etc/pass\r\nwd", time.Time{}, time.Time{}, "logs_.._etc_passwd.jsonl"},
+		{"引号和冒号", `a"b:c`, time.Time{}, time.Time{}, "logs_a_b_c.jsonl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := attachmentName(tt.service, tt.start, tt.end, "jsonl"); got != tt.want {
+				t.Errorf("期望 %q，得到 %q", tt.want, got)
+			}
+		})
+	}
+
+	// 超长的名称在UTF-8字符边界截断，保留扩展名
+	long := attachmentName(strings.Repeat("服务", 100), start, end, "jsonl")
+	if !utf8.ValidString(long) || !strings.HasSuffix(long, ".jsonl") || len(long) > maxAttachmentNameLength+len(".jsonl") {
+		t.Errorf("截断后的文件名无效: %q (%d 字节)", long, len(long))
+	}
+
+	for _, name := range []string{"", "...", " \r\n "} {
+		if got := sanitizeFilename(name, "log"); got != "logs.log" {
+			t.Errorf("%q: 期望 logs.log，得到 %q", name, got)
+		}
+	}
+}
+
+func TestSetAttachment(t *testing.T) {
+	for _, tt := range []struct {
+		filename, ascii, encoded string
+	}{
+		{"logs_payments.jsonl", "logs_payments.jsonl", "logs_payments.jsonl"},
+		{"日志 导出.jsonl", "__ __.jsonl", "%E6%97%A5%E5%BF%97%20%E5%AF%BC%E5%87%BA.jsonl"},
+		{"a%b;c=d.log", "a_b;c=d.log", "a%25b%3Bc%3Dd.log"},
+	} {
+		w := httptest.NewRecorder()
+		setAttachment(w, tt.filename)
+		want := `attachment; filename="` + tt.ascii + `"; filename*=UTF-8''` + tt.encoded
+		if got := w.Header().Get("Content-Disposition"); got != want {
+			t.Errorf("期望 %s，得到 %s", want, got)
+		}
+		if decoded, err := url.PathUnescape(tt.encoded); err != nil || decoded != tt.filename {
+			t.Errorf("编码后的文件名无法还原: %q %v", decoded, err)
+		}
+	}
+}
+
+func TestAttachmentEndpoints(t *testing.T) {
+	logDir := t.TempDir()
+	content := `{"timestamp":"2024-01-15T10:30:00Z","level":"info","msg":"ok","service":"订单"}` + "\n"
+	if err := os.WriteFile(filepath.Join(logDir, "app.log"), []byte(content), 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+	ws := NewWebServer(logDir, "8080")
+	defer close(ws.shutdownCh)
+	handler := ws.routes()
+
+	disposition := func(path string) (*httptest.ResponseRecorder, string) {
+		t.Helper()
+		w := serve(handler, path, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: 期望状态码 200，得到 %d: %s", path, w.Code, w.Body.String())
+		}
+		header := w.Header().Get("Content-Disposition")
+		if strings.ContainsAny(header, "\r\n") {
+			t.Fatalf("%s: 响应头包含换行: %q", path, header)
+		}
+		return w, header
+	}
+
+	// 导出文件名包含服务名和时间范围
+	_, header := disposition(exportPath + "?service=" + url.QueryEscape("订单") + "&start_time=2024-01-15T00:00:00Z&end_time=2024-01-16T00:00:00Z")
+	if want := "filename*=UTF-8''" + encodeRFC5987("logs_订单_20240115T000000Z_20240116T000000Z.jsonl"); !strings.HasSuffix(header, want) {
+		t.Errorf("期望 %s，得到 %s", want, header)
+	}
+	// filename参数同样经过清理，不能注入响应头或路径
+	_, header = disposition(exportPath + "?filename=" + url.QueryEscape("../../evil\r\nSet-Cookie: x=1.jsonl"))
+	if !strings.Contains(header, `filename="_.._evilSet-Cookie_ x=1.jsonl"`) {
+		t.Errorf("期望清理后的文件名，得到 %s", header)
+	}
+
+	// 下载原始文件，默认使用日志文件名
+	w, header := disposition("/api/v1/files/app.log/download")
+	if w.Body.String() != content || !strings.Contains(header, `filename="app.log"`) {
+		t.Errorf("期望下载原始内容，得到 %s %q", header, w.Body.String())
+	}
+	_, header = disposition("/api/v1/files/app.log/download?filename=" + url.QueryEscape("备份\n.log"))
+	if !strings.HasSuffix(header, "''"+encodeRFC5987("备份.log")) {
+		t.Errorf("期望使用指定的文件名，得到 %s", header)
+	}
+	if w := serve(handler, "/api/v1/files/missing.log/download", nil); w.Code != http.StatusNotFound {
+		t.Errorf("期望不存在的文件返回404，得到 %d", w.Code)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// API密钥的环境变量
+const (
+	// apiKeysEnv 逗号分隔的"名称:密钥:权限"，多个权限用"+"连接，如"agent:abc123:write,ops:def456:read+admin"
+	apiKeysEnv = "API_KEYS"
+	// apiKeysFileEnv 密钥文件路径，每行一个密钥，格式同API_KEYS，#开头的行为注释
+	apiKeysFileEnv = "API_KEYS_FILE"
+)
+
+// API密钥的权限，admin包含read和write
+const (
+	scopeRead  = "read"
+	scopeWrite = "write"
+	scopeAdmin = "admin"
+)
+
+// apiKey 一个客户端的API密钥
+type apiKey struct {
+	name   string
+	digest [sha256.Size]byte // 密钥的SHA-256，比较时长度固定
+	scopes map[string]bool
+}
+
+// allows 检查密钥是否具有指定权限
+func (k *apiKey) allows(scope string) bool {
+	return k.scopes[scopeAdmin] || k.scopes[scope]
+}
+
+// apiKeyUsage 单个API密钥的使用计数，重新加载配置后保留
+type apiKeyUsage struct {
+	requests    atomic.Int64
+	denied      atomic.Int64
+	rateLimited atomic.Int64
+}
+
+// APIKeyStats API密钥的使用统计
+type APIKeyStats struct {
+	Requests    int64 `json:"requests"`     // 认证通过的请求数
+	Denied      int64 `json:"denied"`       // 权限不足被拒绝的请求数
+	RateLimited int64 `json:"rate_limited"` // 被限流的请求数
+}
+
+// apiKeyContextKey 认证通过的API密钥在请求上下文中的键
+type apiKeyContextKey struct{}
+
+// apiKeyFromContext 返回请求使用的API密钥，未配置密钥时返回nil
+func apiKeyFromContext(ctx context.Context) *apiKey {
+	key, _ := ctx.Value(apiKeyContextKey{}).(*apiKey)
+	return key
+}
+
+// parseAPIKeys 解析逗号或换行分隔的"名称:密钥:权限"列表
+func parseAPIKeys(spec string) ([]*apiKey, error) {
+	var keys []*apiKey
+	for _, item := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == '\n' }) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.Split(item, ":")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("API密钥格式应为 名称:密钥:权限，得到 %q", redactAPIKey(item))
+		}
+		key := &apiKey{name: parts[0], digest: sha256.Sum256([]byte(parts[1])), scopes: make(map[string]bool)}
+		for _, scope := range strings.Split(parts[2], "+") {
+			switch scope {
+			case scopeRead, scopeWrite, scopeAdmin:
+				key.scopes[scope] = true
+			default:
+				return nil, fmt.Errorf("API密钥%s的权限无效: %q", key.name, scope)
+			}
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// redactAPIKey 隐藏错误信息中的密钥部分
+func redactAPIKey(item string) string {
+	parts := strings.Split(item, ":")
+	if len(parts) > 1 {
+		parts[1] = "***"
+	}
+	return strings.Join(parts, ":")
+}
+
+// loadAPIKeys 从API_KEYS环境变量和API_KEYS_FILE指定的文件读取API密钥
+// 名称或密钥重复时返回错误，两者都未设置时返回空列表（不启用认证）
+func loadAPIKeys() ([]*apiKey, error) {
+	keys, err := parseAPIKeys(os.Getenv(apiKeysEnv))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", apiKeysEnv, err)
+	}
+
+	if path := os.Getenv(apiKeysFileEnv); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取%s失败: %w", apiKeysFileEnv, err)
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for lineNo := 1; scanner.Scan(); lineNo++ {
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(line, "#") {
+				continue
+			}
+			fileKeys, err := parseAPIKeys(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s第%d行: %w", path, lineNo, err)
+			}
+			keys = append(keys, fileKeys...)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("读取%s失败: %w", apiKeysFileEnv, err)
+		}
+	}
+
+	names := make(map[string]bool)
+	digests := make(map[[sha256.Size]byte]bool)
+	for _, key := range keys {
+		if names[key.name] {
+			return nil, fmt.Errorf("API密钥名称重复: %s", key.name)
+		}
+		if digests[key.digest] {
+			return nil, fmt.Errorf("API密钥%s与其他密钥相同", key.name)
+		}
+		names[key.name] = true
+		digests[key.digest] = true
+	}
+	return keys, nil
+}
+
+// requiredScope 返回请求需要的权限，空字符串表示不需要认证（页面、静态文件和健康检查）
+func requiredScope(r *http.Request) string {
+	path := r.URL.Path
+	switch {
+	case !strings.HasPrefix(path, "/api/"), path == "/api/v1/health":
+		return ""
+	case strings.HasPrefix(path, "/api/v1/logs/write"):
+		return scopeWrite
+	case strings.HasPrefix(path, "/api/files/delete/"),
+		strings.HasPrefix(path, "/api/files/upload"),
+		strings.HasPrefix(path, "/api/v1/maintenance/"),
+		path == "/api/v1/aggregator/flush", path == "/api/v1/aggregator/rotate",
+		path == "/api/v1/index/compact",
+		strings.HasPrefix(path, "/api/v1/files/") && r.Method == http.MethodDelete:
+		return scopeAdmin
+	default:
+		return scopeRead
+	}
+}
+
+// bearerToken 从Authorization: Bearer或X-API-Key请求头中读取密钥
+func bearerToken(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if scheme, token, found := strings.Cut(auth, " "); found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// lookupAPIKey 查找与token匹配的密钥，比较所有密钥以保持耗时恒定
+func (ws *WebServer) lookupAPIKey(token string) *apiKey {
+	digest := sha256.Sum256([]byte(token))
+	var found *apiKey
+	for _, key := range ws.currentAPIKeys() {
+		if subtle.ConstantTimeCompare(digest[:], key.digest[:]) == 1 && found == nil {
+			found = key
+		}
+	}
+	return found
+}
+
+// currentAPIKeys 获取当前的API密钥配置
+func (ws *WebServer) currentAPIKeys() []*apiKey {
+	ws.settingsMutex.RLock()
+	defer ws.settingsMutex.RUnlock()
+	return ws.apiKeys
+}
+
+// authHandler 配置了API密钥时校验API请求的密钥和权限
+// 缺少或无效的密钥返回401，权限不足返回403；认证通过的密钥保存在请求上下文中，限流按密钥计数
+func (ws *WebServer) authHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope := requiredScope(r)
+		if scope == "" || r.Method == http.MethodOptions || len(ws.currentAPIKeys()) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := ws.lookupAPIKey(bearerToken(r))
+		if key == nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="logz"`)
+			http.Error(w, "Invalid or missing API key", http.StatusUnauthorized)
+			return
+		}
+		usage := ws.apiKeyUsage(key.name)
+		if !key.allows(scope) {
+			usage.denied.Add(1)
+			http.Error(w, fmt.Sprintf("API key %q lacks %s scope", key.name, scope), http.StatusForbidden)
+			return
+		}
+		usage.requests.Add(1)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, key)))
+	})
+}
+
+// apiKeyUsage 返回密钥的使用计数，不存在时创建
+func (ws *WebServer) apiKeyUsage(name string) *apiKeyUsage {
+	usage, _ := ws.keyUsage.LoadOrStore(name, &apiKeyUsage{})
+	return usage.(*apiKeyUsage)
+}
+
+// apiKeyStats 返回当前配置的每个API密钥的使用统计
+func (ws *WebServer) apiKeyStats() map[string]APIKeyStats {
+	stats := make(map[string]APIKeyStats)
+	for _, key := range ws.currentAPIKeys() {
+		usage := ws.apiKeyUsage(key.name)
+		stats[key.name] = APIKeyStats{
+			Requests:    usage.requests.Load(),
+			Denied:      usage.denied.Load(),
+			RateLimited: usage.rateLimited.Load(),
+		}
+	}
+	return stats
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// newAuthServer 创建配置了API密钥的服务器，返回经过中间件链的处理器
+func newAuthServer(t *testing.T, keys string) (*WebServer, http.Handler) {
+	t.Helper()
+	t.Setenv(apiKeysEnv, keys)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app.log"), []byte(`{"level":"info","msg":"hello"}`+"\n"), 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+	aggregator, err := aggregate.NewLogAggregatorWithOptions(filepath.Join(dir, "aggregated"), "auth-test")
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	aggregate.SetGlobalAggregator(aggregator)
+	t.Cleanup(func() {
+		aggregate.SetGlobalAggregator(nil)
+		aggregator.Close()
+	})
+
+	ws := NewWebServer(dir, "8080")
+	return ws, ws.routes()
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	t.Setenv(corsAllowedOriginsEnv, "https://ui.example.com")
+	_, handler := newAuthServer(t, "agent:w-secret:write,reader:r-secret:read,ops:a-secret:admin")
+
+	writeBody := `{"level":"info","message":"from agent"}`
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		header string
+		key    string
+		want   int
+	}{
+		{"写入无密钥", "POST", "/api/v1/logs/write", writeBody, "", "", http.StatusUnauthorized},
+		{"写入错误密钥", "POST", "/api/v1/logs/write", writeBody, "Authorization", "Bearer nope", http.StatusUnauthorized},
+		{"写入密钥写日志", "POST", "/api/v1/logs/write", writeBody, "Authorization", "Bearer w-secret", http.StatusOK},
+		{"X-API-Key写日志", "POST", "/api/v1/logs/write", writeBody, "X-API-Key", "w-secret", http.StatusOK},
+		{"写入密钥查询", "GET", "/api/v1/logs/level/info", "", "X-API-Key", "w-secret", http.StatusForbidden},
+		{"写入密钥旧版查询", "POST", "/api/search", `{"limit":10}`, "X-API-Key", "w-secret", http.StatusForbidden},
+		{"写入密钥删除文件", "DELETE", "/api/v1/files/app.log", "", "X-API-Key", "w-secret", http.StatusForbidden},
+		{"只读密钥写日志", "POST", "/api/v1/logs/write", writeBody, "X-API-Key", "r-secret", http.StatusForbidden},
+		{"只读密钥查询", "GET", "/api/v1/logs/level/info", "", "X-API-Key", "r-secret", http.StatusOK},
+		{"只读密钥读取文件信息", "GET", "/api/v1/files/app.log", "", "X-API-Key", "r-secret", http.StatusOK},
+		{"只读密钥删除文件", "DELETE", "/api/v1/files/app.log", "", "X-API-Key", "r-secret", http.StatusForbidden},
+		{"只读密钥上传文件", "POST", "/api/files/upload", "", "X-API-Key", "r-secret", http.StatusForbidden},
+		{"只读密钥清理", "POST", "/api/v1/maintenance/cleanup", "{}", "X-API-Key", "r-secret", http.StatusForbidden},
+		{"只读密钥刷新聚合器", "POST", "/api/v1/aggregator/flush", "", "X-API-Key", "r-secret", http.StatusForbidden},
+		{"只读密钥轮转聚合器", "POST", "/api/v1/aggregator/rotate", "", "X-API-Key", "r-secret", http.StatusForbidden},
+		{"只读密钥压缩索引", "POST", "/api/v1/index/compact", "", "X-API-Key", "r-secret", http.StatusForbidden},
+		{"管理密钥查询", "GET", "/api/v1/logs/level/info", "", "Authorization", "bearer a-secret", http.StatusOK},
+		{"管理密钥删除文件", "DELETE", "/api/v1/files/app.log", "", "Authorization", "Bearer a-secret", http.StatusOK},
+		{"健康检查不需要密钥", "GET", "/api/v1/health", "", "", "", http.StatusOK},
+		{"CORS预检不需要密钥", "OPTIONS", "/api/v1/logs/write", "", "Origin", "https://ui.example.com", http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.key)
+			}
+			if tt.method == "OPTIONS" {
+				req.Header.Set("Access-Control-Request-Method", "POST")
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("期望状态码 %d，得到 %d: %s", tt.want, w.Code, w.Body.String())
+			}
+			if w.Code == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401响应应包含WWW-Authenticate")
+			}
+		})
+	}
+}
+
+func TestAPIKeyRateLimit(t *testing.T) {
+	t.Setenv(rateLimitEnv, "2")
+	ws, handler := newAuthServer(t, "agent-a:secret-a:write,agent-b:secret-b:write,monitor:secret-m:read")
+
+	send := func(key, remoteAddr string) int {
+		req := httptest.NewRequest("POST", "/api/v1/logs/write", strings.NewReader(`{"level":"info","message":"m"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 同一个密钥从不同地址发送的请求共享限额
+	codes := []int{send("secret-a", "10.0.0.1:1000"), send("secret-a", "10.0.0.2:1000"), send("secret-a", "10.0.0.3:1000")}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("期望第3个请求被限流，得到 %v", codes)
+	}
+
+	// 同一地址的其他密钥有独立的限额
+	if code := send("secret-b", "10.0.0.1:1000"); code != http.StatusOK {
+		t.Errorf("期望其他密钥不受影响，得到 %d", code)
+	}
+
+	// 使用统计出现在运行指标中，不包含密钥本身
+	req := httptest.NewRequest("GET", "/api/v1/metrics", nil)
+	req.Header.Set("Authorization", "Bearer secret-m")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if strings.Contains(w.Body.String(), "secret-a") {
+		t.Fatal("运行指标不应包含密钥")
+	}
+	var resp struct {
+		Data struct {
+			APIKeys map[string]APIKeyStats `json:"api_keys"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	want := map[string]APIKeyStats{
+		"agent-a": {Requests: 3, RateLimited: 1},
+		"agent-b": {Requests: 1},
+	}
+	for name, stats := range want {
+		if resp.Data.APIKeys[name] != stats {
+			t.Errorf("%s期望 %+v，得到 %+v", name, stats, resp.Data.APIKeys[name])
+		}
+	}
+	if got := ws.apiKeyStats()["agent-a"]; got != want["agent-a"] {
+		t.Errorf("期望 %+v，得到 %+v", want["agent-a"], got)
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "keys")
+	content := "# 运维密钥\nops:file-secret:read+admin\n\nci:ci-secret:write\n"
+	if err := os.WriteFile(keyFile, []byte(content), 0600); err != nil {
+		t.Fatalf("写入密钥文件失败: %v", err)
+	}
+	t.Setenv(apiKeysEnv, "agent:env-secret:write")
+	t.Setenv(apiKeysFileEnv, keyFile)
+
+	keys, err := loadAPIKeys()
+	if err != nil {
+		t.Fatalf("加载密钥失败: %v", err)
+	}
+	if len(keys) != 3 {
+		t.Fatalf("期望3个密钥，得到 %d", len(keys))
+	}
+	if keys[1].name != "ops" || !keys[1].allows(scopeRead) || !keys[1].allows(scopeWrite) {
+		t.Errorf("期望ops具有所有权限，得到 %+v", keys[1].scopes)
+	}
+
+	t.Setenv(apiKeysFileEnv, "")
+	for _, spec := range []string{
+		"agent:secret",
+		"agent::write",
+		"agent:secret:delete",
+		"agent:secret:write,agent:other:read",
+		"a:same:write,b:same:read",
+	} {
+		t.Setenv(apiKeysEnv, spec)
+		_, err := loadAPIKeys()
+		if err == nil {
+			t.Errorf("%q 期望返回错误", spec)
+			continue
+		}
+		if strings.Contains(err.Error(), "secret") && !strings.Contains(spec, "delete") {
+			t.Errorf("错误信息不应包含密钥: %v", err)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// checksumCache 按文件路径缓存SHA-256校验和，文件大小或修改时间变化后失效
+// 计算在后台进行，同一时间只运行一个计算任务，避免大文件占满磁盘IO
+type checksumCache struct {
+	mu      sync.Mutex
+	entries map[string]checksumEntry
+	pending map[string]bool
+
+	sem  chan struct{}   // 校验和计算和完整性检查共用，容量为1
+	done <-chan struct{} // 关闭时取消后台计算
+}
+
+// checksumEntry 缓存的校验和及计算时的文件状态
+type checksumEntry struct {
+	size    int64
+	modTime time.Time
+	sum     string
+}
+
+// matches 文件大小和修改时间是否与计算时一致
+func (e checksumEntry) matches(stat os.FileInfo) bool {
+	return e.size == stat.Size() && e.modTime.Equal(stat.ModTime())
+}
+
+// newChecksumCache 创建校验和缓存，done关闭时取消后台计算
+func newChecksumCache(done <-chan struct{}) *checksumCache {
+	return &checksumCache{
+		entries: make(map[string]checksumEntry),
+		pending: make(map[string]bool),
+		sem:     make(chan struct{}, 1),
+		done:    done,
+	}
+}
+
+// lookup 返回文件当前内容的校验和，没有缓存或文件已变化时启动后台计算并返回false
+func (c *checksumCache) lookup(path string, stat os.FileInfo) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[path]; ok && entry.matches(stat) {
+		return entry.sum, true
+	}
+	if !c.pending[path] {
+		c.pending[path] = true
+		go c.background(path)
+	}
+	return "", false
+}
+
+// background 在后台计算并缓存校验和，服务关闭时取消
+func (c *checksumCache) background(path string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, path)
+		c.mu.Unlock()
+	}()
+	c.run(ctx, func() {
+		c.compute(ctx, path)
+	})
+}
+
+// run 等待计算槽位后执行fn，ctx取消时放弃等待并返回ctx.Err()
+func (c *checksumCache) run(ctx context.Context, fn func()) error {
+	select {
+	case c.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-c.sem }()
+	fn()
+	return nil
+}
+
+// compute 计算文件的校验和，计算期间文件未变化时写入缓存，调用方需持有计算槽位
+func (c *checksumCache) compute(ctx context.Context, path string) (checksumEntry, error) {
+	before, err := os.Stat(path)
+	if err != nil {
+		return checksumEntry{}, err
+	}
+	sum, err := aggregate.FileChecksum(ctx, path)
+	if err != nil {
+		return checksumEntry{}, err
+	}
+	entry := checksumEntry{size: before.Size(), modTime: before.ModTime(), sum: sum}
+	if after, err := os.Stat(path); err == nil && entry.matches(after) {
+		c.mu.Lock()
+		c.entries[path] = entry
+		c.mu.Unlock()
+	}
+	return entry, nil
+}
+
+// cached 返回缓存的校验和，不检查文件是否变化
+func (c *checksumCache) cached(path string) (checksumEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[path]
+	return entry, ok
+}
+
+// FileVerifyResponse 文件校验结果
+type FileVerifyResponse struct {
+	Name           string                     `json:"name"`
+	Checksum       string                     `json:"checksum"`                  // 重新计算的校验和
+	CachedChecksum string                     `json:"cached_checksum,omitempty"` // 之前缓存的校验和，指定expected时为该值
+	Match          bool                       `json:"match"`                     // 重新计算的校验和与之前的一致
+	Modified       bool                       `json:"modified"`                  // 缓存后文件大小或修改时间发生变化
+	Issues         []aggregate.IntegrityIssue `json:"issues"`
+}
+
+// withChecksums 为文件列表填充已缓存的校验和，未缓存的文件在后台计算
+func (ws *WebServer) withChecksums(files []FileInfo) {
+	for i := range files {
+		path := filepath.Join(ws.logDir, filepath.FromSlash(files[i].Name))
+		stat, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if sum, ok := ws.checksums.lookup(path, stat); ok {
+			files[i].Checksum = sum
+		} else {
+			files[i].ChecksumPending = true
+		}
+	}
+}
+
+// wantChecksum 请求是否要求返回校验和
+func wantChecksum(r *http.Request) bool {
+	value := strings.ToLower(r.URL.Query().Get("checksum"))
+	return value == "true" || value == "1"
+}
+
+// handleVerifyFile 重新计算文件的校验和并与缓存的值（或expected参数）比较，同时检查文件内容
+func (api *APIServer) handleVerifyFile(w http.ResponseWriter, r *http.Request, filename string) {
+	path, err := api.validateFilename(filename)
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			api.sendErrorResponse(w, "File not found", http.StatusNotFound)
+		} else {
+			api.sendErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	checksums := api.ws.checksums
+	previous, hasPrevious := checksums.cached(path)
+	expected := strings.ToLower(r.URL.Query().Get("expected"))
+
+	var current checksumEntry
+	var issues []aggregate.IntegrityIssue
+	var verifyErr error
+	err = checksums.run(r.Context(), func() {
+		current, verifyErr = checksums.compute(r.Context(), path)
+		if verifyErr == nil {
+			issues, verifyErr = aggregate.VerifyLogFile(r.Context(), path)
+		}
+	})
+	if err == nil {
+		err = verifyErr
+	}
+	if err != nil {
+		if r.Context().Err() != nil {
+			return // 客户端已断开
+		}
+		api.sendErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result := FileVerifyResponse{
+		Name:     aggregate.RelativeLogPath(api.ws.logDir, path),
+		Checksum: current.sum,
+		Issues:   issues,
+	}
+	for i := range result.Issues {
+		result.Issues[i].File = result.Name
+	}
+	if result.Issues == nil {
+		result.Issues = []aggregate.IntegrityIssue{}
+	}
+
+	switch {
+	case expected != "":
+		result.CachedChecksum = expected
+		result.Match = current.sum == expected
+	case hasPrevious:
+		result.CachedChecksum = previous.sum
+		result.Match = current.sum == previous.sum
+		result.Modified = !previous.matches(stat)
+		if !result.Match && !result.Modified {
+			// 文件大小和修改时间未变但内容不同，保留原校验和以便再次校验时仍能发现
+			checksums.mu.Lock()
+			checksums.entries[path] = previous
+			checksums.mu.Unlock()
+		}
+	}
+
+	api.sendSuccessResponse(w, result)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// getAPI 请求API并将data解析到out
+func getAPI(t *testing.T, handler http.Handler, path string, out interface{}) int {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	var response struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if out != nil && w.Code == http.StatusOK {
+		if err := json.Unmarshal(response.Data, out); err != nil {
+			t.Fatalf("解析数据失败: %v", err)
+		}
+	}
+	return w.Code
+}
+
+func TestFileChecksumAPI(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte(`{"level":"info","message":"hello"}` + "\n")
+	path := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	sum := sha256.Sum256(content)
+	want := hex.EncodeToString(sum[:])
+
+	ws := NewWebServer(dir, "8080")
+	defer close(ws.shutdownCh)
+	handler := ws.routes()
+
+	var info FileInfoResponse
+	getAPI(t, handler, "/api/v1/files/app.log", &info)
+	if info.Checksum != "" || info.ChecksumPending {
+		t.Errorf("期望未请求时不计算校验和，得到 %+v", info)
+	}
+
+	// 第一次请求启动后台计算，之后返回缓存的值
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		info = FileInfoResponse{}
+		getAPI(t, handler, "/api/v1/files/app.log?checksum=true", &info)
+		if info.Checksum != "" {
+			break
+		}
+		if !info.ChecksumPending {
+			t.Fatalf("期望校验和正在计算，得到 %+v", info)
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("等待校验和超时")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if info.Checksum != want || info.ChecksumPending {
+		t.Errorf("期望校验和 %s，得到 %+v", want, info)
+	}
+
+	var files []FileInfo
+	getAPI(t, handler, "/api/v1/files?checksum=true", &files)
+	if len(files) != 1 || files[0].Checksum != want {
+		t.Errorf("期望文件列表返回相同的校验和，得到 %+v", files)
+	}
+
+	var result FileVerifyResponse
+	if code := getAPI(t, handler, "/api/v1/files/app.log/verify", &result); code != http.StatusOK {
+		t.Fatalf("期望状态码 200，得到 %d", code)
+	}
+	if !result.Match || result.Modified || result.Checksum != want || len(result.Issues) != 0 {
+		t.Errorf("期望校验通过，得到 %+v", result)
+	}
+
+	// 修改内容但保持大小和修改时间不变，缓存的校验和不会失效，校验能发现差异
+	stat, _ := os.Stat(path)
+	corrupted := bytes.Replace(content, []byte("hello"), []byte("hellx"), 1)
+	os.WriteFile(path, corrupted, 0644)
+	os.Chtimes(path, stat.ModTime(), stat.ModTime())
+	for i := 0; i < 2; i++ {
+		result = FileVerifyResponse{}
+		getAPI(t, handler, "/api/v1/files/app.log/verify", &result)
+		if result.Match || result.Modified || result.CachedChecksum != want {
+			t.Errorf("第 %d 次校验期望发现内容不一致，得到 %+v", i+1, result)
+		}
+	}
+
+	result = FileVerifyResponse{}
+	getAPI(t, handler, "/api/v1/files/app.log/verify?expected="+want, &result)
+	if result.Match {
+		t.Errorf("期望与expected不一致，得到 %+v", result)
+	}
+
+	if code := getAPI(t, handler, "/api/v1/files/missing.log/verify", nil); code != http.StatusNotFound {
+		t.Errorf("期望状态码 404，得到 %d", code)
+	}
+}
+
+func TestVerifyTruncatedGzip(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	for i := 0; i < 200; i++ {
+		gz.Write([]byte(`{"level":"info","message":"compressed entry"}` + "\n"))
+	}
+	gz.Close()
+	data := buf.Bytes()
+	os.WriteFile(filepath.Join(dir, "old.log.gz"), data[:len(data)-10], 0644)
+
+	ws := NewWebServer(dir, "8080")
+	defer close(ws.shutdownCh)
+
+	var result FileVerifyResponse
+	getAPI(t, ws.routes(), "/api/v1/files/old.log.gz/verify", &result)
+	if len(result.Issues) != 1 || result.Issues[0].File != "old.log.gz" || result.Issues[0].Problem != "文件被截断" {
+		t.Errorf("期望检测到截断的gzip文件，得到 %+v", result.Issues)
+	}
+}
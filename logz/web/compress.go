@@ -0,0 +1,206 @@
+package main
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// gzipEnabledEnv 设为false时不压缩响应，用于入口代理已经压缩的部署
+const gzipEnabledEnv = "GZIP_ENABLED"
+
+// gzipMinSize 小于此字节数的响应不压缩，压缩收益抵不上开销
+const gzipMinSize = 1024
+
+// compressibleTypes 可以压缩的内容类型，text/event-stream除外
+var compressibleTypes = map[string]bool{
+	"application/json":       true,
+	"application/javascript": true,
+	"application/xml":        true,
+	"image/svg+xml":          true,
+}
+
+var gzipWriterPool = sync.Pool{
+	New: func() any { return gzip.NewWriter(nil) },
+}
+
+// WithGzip 设置是否压缩响应，默认开启
+func WithGzip(enabled bool) WebServerOption {
+	return func(ws *WebServer) {
+		ws.gzipEnabled = enabled
+	}
+}
+
+// isCompressible 检查内容类型是否值得压缩，日志流需要逐条推送，不压缩
+func isCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if mediaType == "text/event-stream" {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || compressibleTypes[mediaType]
+}
+
+// acceptsGzip 检查Accept-Encoding是否接受gzip，q=0表示拒绝
+func acceptsGzip(r *http.Request) bool {
+	for _, value := range r.Header.Values("Accept-Encoding") {
+		for _, item := range strings.Split(value, ",") {
+			coding, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding != "gzip" && coding != "*" {
+				continue
+			}
+			if q, ok := strings.CutPrefix(strings.ReplaceAll(params, " ", ""), "q="); ok {
+				if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// gzipHandler 压缩客户端接受gzip、内容类型可压缩且超过gzipMinSize的响应
+// 响应先缓冲到gzipMinSize再决定是否压缩；不可压缩的响应（如日志流）和Flush之后的内容直接写出
+func (ws *WebServer) gzipHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		gw := &gzipResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		defer gw.close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+// gzipResponseWriter 缓冲响应开头的内容，决定是否压缩后再写出响应头
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool         // 处理函数调用过WriteHeader
+	decided     bool         // 已写出响应头
+	buf         []byte       // 决定之前缓冲的内容
+	gz          *gzip.Writer // 压缩时不为nil
+}
+
+func (w *gzipResponseWriter) WriteHeader(statusCode int) {
+	if w.decided || w.wroteHeader {
+		return
+	}
+	// 1xx信息响应直接转发
+	if statusCode >= 100 && statusCode < 200 {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	w.statusCode = statusCode
+	w.wroteHeader = true
+}
+
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		if !w.mayCompress() {
+			w.decide(false)
+		} else {
+			w.buf = append(w.buf, b...)
+			if len(w.buf) >= gzipMinSize {
+				if err := w.decide(true); err != nil {
+					return 0, err
+				}
+			}
+			return len(b), nil
+		}
+	}
+	if w.gz != nil {
+		return w.gz.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush 立即写出已缓冲的内容，之前不足gzipMinSize的响应不再压缩
+func (w *gzipResponseWriter) Flush() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap 供http.ResponseController访问底层的ResponseWriter
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// mayCompress 检查响应头是否允许压缩：只压缩200响应，且没有其他编码
+func (w *gzipResponseWriter) mayCompress() bool {
+	header := w.Header()
+	if w.statusCode != http.StatusOK || header.Get("Content-Encoding") != "" {
+		return false
+	}
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		// 与net/http相同，根据内容推断类型
+		return true
+	}
+	return isCompressible(contentType)
+}
+
+// decide 写出响应头和已缓冲的内容，compress为true时之后的内容都经过gzip
+func (w *gzipResponseWriter) decide(compress bool) error {
+	w.decided = true
+	header := w.Header()
+	if compress && header.Get("Content-Type") == "" {
+		contentType := http.DetectContentType(w.buf)
+		header.Set("Content-Type", contentType)
+		compress = isCompressible(contentType)
+	}
+
+	if compress {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", "gzip")
+		w.ResponseWriter.WriteHeader(w.statusCode)
+		w.gz = gzipWriterPool.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	} else if w.wroteHeader || len(w.buf) > 0 {
+		w.ResponseWriter.WriteHeader(w.statusCode)
+	}
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if w.gz != nil {
+		_, err = w.gz.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// close 写出不足gzipMinSize的响应并结束压缩
+func (w *gzipResponseWriter) close() {
+	if !w.decided {
+		// 整个响应都在缓冲区中，可以给出准确的Content-Length
+		if len(w.buf) > 0 && w.Header().Get("Content-Length") == "" {
+			w.Header().Set("Content-Length", strconv.Itoa(len(w.buf)))
+		}
+		w.decide(false)
+	}
+	if w.gz != nil {
+		w.gz.Close()
+		gzipWriterPool.Put(w.gz)
+		w.gz = nil
+	}
+}
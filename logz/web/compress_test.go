@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// searchResult 提取搜索响应中与请求时间无关的查询结果
+func searchResult(t *testing.T, body []byte) json.RawMessage {
+	t.Helper()
+	var response struct {
+		Data struct {
+			Result json.RawMessage `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	return response.Data.Result
+}
+
+func TestGzipLargeSearchResponse(t *testing.T) {
+	dir := t.TempDir()
+	var content strings.Builder
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&content, `{"timestamp":"2024-01-15T10:30:00Z","level":"error","msg":"request %d failed","service":"api"}`+"\n", i)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "app.log"), []byte(content.String()), 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+	handler := NewWebServer(dir, "8080").routes()
+
+	search := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v1/logs/search", strings.NewReader(`{"level":"error","limit":5000}`))
+		req.Header.Set("Content-Type", "application/json")
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("期望状态码 200，得到 %d", w.Code)
+		}
+		return w
+	}
+
+	plain := search("")
+	if plain.Header().Get("Content-Encoding") != "" {
+		t.Errorf("期望未声明gzip的客户端收到未压缩的响应")
+	}
+
+	compressed := search("br, gzip")
+	if compressed.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("期望响应使用gzip压缩，得到 %q", compressed.Header().Get("Content-Encoding"))
+	}
+	if compressed.Header().Get("Content-Length") != "" {
+		t.Error("压缩的响应不应带有未压缩内容的Content-Length")
+	}
+	if !strings.Contains(compressed.Header().Get("Vary"), "Accept-Encoding") {
+		t.Error("期望响应带有Vary: Accept-Encoding")
+	}
+	if !strings.HasPrefix(compressed.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("期望保留Content-Type，得到 %q", compressed.Header().Get("Content-Type"))
+	}
+	if compressed.Body.Len()*5 > plain.Body.Len() {
+		t.Errorf("期望压缩后显著变小，压缩前 %d 字节，压缩后 %d 字节", plain.Body.Len(), compressed.Body.Len())
+	}
+
+	reader, err := gzip.NewReader(compressed.Body)
+	if err != nil {
+		t.Fatalf("创建gzip读取器失败: %v", err)
+	}
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("解压响应失败: %v", err)
+	}
+	if !bytes.Equal(searchResult(t, decoded), searchResult(t, plain.Body.Bytes())) {
+		t.Error("解压后的查询结果与未压缩的响应不一致")
+	}
+
+	// 拒绝gzip的客户端
+	if w := search("gzip;q=0, identity"); w.Header().Get("Content-Encoding") != "" {
+		t.Error("期望q=0时不压缩")
+	}
+}
+
+func TestGzipSmallAndDisabled(t *testing.T) {
+	handler := NewWebServer(t.TempDir(), "8080").routes()
+	req := httptest.NewRequest("GET", "/api/v1/health", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Header().Get("Content-Encoding") != "" {
+		t.Error("期望小响应不压缩")
+	}
+	if w.Header().Get("Content-Length") != fmt.Sprint(w.Body.Len()) {
+		t.Errorf("期望小响应带有准确的Content-Length，得到 %q，实际 %d 字节", w.Header().Get("Content-Length"), w.Body.Len())
+	}
+
+	// 静态文件压缩后仍可用ETag校验
+	req = httptest.NewRequest("GET", "/static/style.css", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("ETag") == "" {
+		t.Errorf("期望静态文件压缩并带有ETag，得到 %v", w.Header())
+	}
+	req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified || w.Header().Get("Content-Encoding") != "" || w.Body.Len() != 0 {
+		t.Errorf("期望304且没有响应体，得到 %d %v", w.Code, w.Header())
+	}
+
+	// 关闭压缩
+	handler = NewWebServer(t.TempDir(), "8080", WithGzip(false)).routes()
+	req = httptest.NewRequest("GET", "/static/style.css", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Header().Get("Content-Encoding") != "" {
+		t.Error("期望关闭压缩后不压缩响应")
+	}
+}
+
+func TestGzipBypassesEventStream(t *testing.T) {
+	ws := NewWebServer(t.TempDir(), "8080")
+	server := httptest.NewServer(ws.routes())
+	defer server.Close()
+	defer close(ws.shutdownCh)
+
+	req, _ := http.NewRequest("GET", server.URL+"/api/logs/stream", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Encoding") != "" {
+		t.Errorf("期望日志流不压缩，得到 %q", resp.Header.Get("Content-Encoding"))
+	}
+
+	// 不足gzipMinSize的connected消息也立即送达
+	line := make(chan string, 1)
+	go func() {
+		text, _ := bufio.NewReader(resp.Body).ReadString('\n')
+		line <- text
+	}()
+	select {
+	case text := <-line:
+		if !strings.Contains(text, `"type":"connected"`) {
+			t.Errorf("期望收到connected消息，得到 %q", text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("日志流消息被缓冲，没有立即送达")
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := map[string]bool{
+		"":                  false,
+		"gzip":              true,
+		"deflate, GZIP":     true,
+		"gzip;q=0.5":        true,
+		"gzip; q=0":         false,
+		"*":                 true,
+		"identity, br":      false,
+		"x-gzip-custom, br": false,
+	}
+	for header, want := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", header)
+		if got := acceptsGzip(req); got != want {
+			t.Errorf("Accept-Encoding %q: 期望 %v，得到 %v", header, want, got)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/HsiaoL1/trace/logz"
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// contentFilter 文件内容接口的过滤和解析参数
+type contentFilter struct {
+	search string   // 按原始行的子串过滤（忽略大小写）
+	parse  bool     // 将每行解析为LogEntry并返回结构化的行
+	fields []string // 解析时只返回这些字段，为空时返回全部字段
+	level  string   // 解析时按规范化后的级别过滤
+}
+
+// parseContentFilter 读取search、parse、fields和level参数，指定fields或level时自动启用parse
+func parseContentFilter(params url.Values) (contentFilter, error) {
+	filter := contentFilter{search: params.Get("search")}
+
+	if value := params.Get("parse"); value != "" {
+		parse, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("无效的parse参数: %q", value)
+		}
+		filter.parse = parse
+	}
+	for _, field := range strings.Split(params.Get("fields"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			filter.fields = append(filter.fields, field)
+		}
+	}
+
+	level, err := parseLevelParam(params.Get("level"))
+	if err != nil {
+		return filter, err
+	}
+	filter.level = level
+
+	if len(filter.fields) > 0 || filter.level != "" {
+		filter.parse = true
+	}
+	return filter, nil
+}
+
+// cacheKey 区分不同过滤条件的缓存
+func (f contentFilter) cacheKey() string {
+	return fmt.Sprintf("%s:%t:%s:%s", f.search, f.parse, strings.Join(f.fields, ","), f.level)
+}
+
+// matchKey 区分匹配的行不同的过滤条件，fields只影响返回的字段
+func (f contentFilter) matchKey() string {
+	return fmt.Sprintf("%s:%t:%s", f.search, f.parse, f.level)
+}
+
+// LogRow 解析后的一行日志，无法解析的行只有Raw和Error
+type LogRow struct {
+	Line  int            `json:"line,omitempty"`  // 在文件中的行号，从1开始；tail模式不统计行号，不返回
+	Entry map[string]any `json:"entry,omitempty"` // 解析后的字段，按fields参数投影
+	Raw   string         `json:"raw,omitempty"`   // 无法解析的原始内容
+	Error string         `json:"error,omitempty"` // 解析错误
+}
+
+// fileContent 文件内容接口的一页结果
+type fileContent struct {
+	lines   []string // parse为false时的原始行
+	rows    []LogRow // parse为true时的结构化行
+	total   int      // 文件总行数
+	matched int      // 匹配过滤条件的行数，用于分页
+	skipped int      // 超过logz.MaxLineSize被跳过的行数
+}
+
+// seek 从检查点开始统计行数
+func (c *fileContent) seek(cp lineCheckpoint) {
+	c.total, c.matched, c.skipped = cp.line, cp.matched, cp.skipped
+}
+
+// checkpoint 返回位于offset的下一行开始时的状态
+func (c *fileContent) checkpoint(offset int64) lineCheckpoint {
+	return lineCheckpoint{offset: offset, line: c.total, matched: c.matched, skipped: c.skipped}
+}
+
+// result 返回文件内容接口的响应数据
+func (c *fileContent) result(filter contentFilter, limit, offset int) map[string]interface{} {
+	result := map[string]interface{}{
+		"total":   c.total,
+		"matched": c.matched,
+		"limit":   limit,
+		"offset":  offset,
+	}
+	if c.skipped > 0 {
+		result["skipped_lines"] = c.skipped
+	}
+	if filter.parse {
+		result["rows"] = c.rows
+		if len(filter.fields) > 0 {
+			result["fields"] = filter.fields
+		}
+	} else {
+		result["content"] = c.lines
+	}
+	return result
+}
+
+// parseRow 解析一行日志，ok为false表示不匹配级别过滤条件
+// 设置了级别过滤时无法解析的行不匹配
+func (f contentFilter) parseRow(lineNo int, line string) (row LogRow, ok bool) {
+	row.Line = lineNo
+	var entry aggregate.LogEntry
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		row.Raw = line
+		row.Error = err.Error()
+		return row, f.level == ""
+	}
+	if f.level != "" && normalizedLevel(entry.Level) != f.level {
+		return row, false
+	}
+	row.Entry = projectEntry(entry, f.fields)
+	return row, true
+}
+
+// normalizedLevel 规范化条目的级别，无法识别时返回小写形式
+func normalizedLevel(level string) string {
+	if normalized, err := logz.NormalizeLevel(level); err == nil {
+		return normalized
+	}
+	return strings.ToLower(strings.TrimSpace(level))
+}
+
+// projectEntry 将条目转换为以JSON字段名为键的map，fields不为空时只保留这些字段
+// 自定义字段可以用fields.<名称>选择，条目中不存在的字段不返回
+func projectEntry(entry aggregate.LogEntry, fields []string) map[string]any {
+	data, _ := json.Marshal(entry)
+	var all map[string]any
+	json.Unmarshal(data, &all)
+	if len(fields) == 0 {
+		return all
+	}
+
+	projected := make(map[string]any, len(fields))
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			projected[field] = value
+		} else if name, found := strings.CutPrefix(field, "fields."); found {
+			if value, ok := entry.Fields[name]; ok {
+				projected[field] = value
+			}
+		}
+	}
+	return projected
+}
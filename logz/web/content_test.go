@@ -0,0 +1,140 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeMixedLog 写入混合了有效JSON、无法解析的行和空行的日志文件
+func writeMixedLog(t *testing.T, dir string) string {
+	t.Helper()
+	lines := []string{
+		`{"timestamp":"2024-01-15T10:00:00Z","level":"info","msg":"started","trace_id":"t1","fields":{"port":8080}}`,
+		`not json at all`,
+		`{"timestamp":"2024-01-15T10:00:01Z","level":"ERROR","msg":"db down","trace_id":"t2","caller":"db.go:42"}`,
+		``,
+		`{"timestamp":"2024-01-15T10:00:02Z","level":"warning","msg":"slow","trace_id":"t3"}`,
+		`{"timestamp":"2024-01-15T10:00:03Z","level":"error","msg":"retry failed","trace_id":"t4"}`,
+	}
+	path := filepath.Join(dir, "mixed.log")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	return path
+}
+
+// contentRows 取出响应中的结构化行
+func contentRows(t *testing.T, data interface{}) (map[string]interface{}, []map[string]interface{}) {
+	t.Helper()
+	result, _ := data.(map[string]interface{})
+	raw, ok := result["rows"].([]interface{})
+	if !ok {
+		t.Fatalf("期望返回rows，得到 %v", data)
+	}
+	rows := make([]map[string]interface{}, len(raw))
+	for i, row := range raw {
+		rows[i], _ = row.(map[string]interface{})
+	}
+	return result, rows
+}
+
+func TestFileContentParse(t *testing.T) {
+	dir := t.TempDir()
+	writeMixedLog(t, dir)
+	handler := NewWebServer(dir, "8080").routes()
+
+	for _, prefix := range []string{"/api/files/content/", "/api/v1/files/content/"} {
+		status, response := doAPI(t, handler, "GET", prefix+"mixed.log?parse=true", "")
+		if status != http.StatusOK {
+			t.Fatalf("%s: 期望状态码 200，得到 %d %s", prefix, status, response.Error)
+		}
+		result, rows := contentRows(t, response.Data)
+		if len(rows) != 5 || result["matched"] != float64(5) || result["total"] != float64(6) || result["content"] != nil {
+			t.Fatalf("%s: 期望 5 行（跳过空行），得到 %v", prefix, result)
+		}
+
+		// 无法解析的行返回原始内容和错误，行号对应文件中的位置
+		if rows[1]["line"] != float64(2) || rows[1]["raw"] != "not json at all" || rows[1]["error"] == nil || rows[1]["entry"] != nil {
+			t.Errorf("%s: 期望第 2 行为原始内容，得到 %v", prefix, rows[1])
+		}
+		entry, _ := rows[0]["entry"].(map[string]interface{})
+		if rows[0]["line"] != float64(1) || entry["msg"] != "started" || entry["trace_id"] != "t1" || rows[0]["raw"] != nil {
+			t.Errorf("%s: 期望第 1 行解析为条目，得到 %v", prefix, rows[0])
+		}
+	}
+}
+
+func TestFileContentFieldProjection(t *testing.T) {
+	dir := t.TempDir()
+	writeMixedLog(t, dir)
+	handler := NewWebServer(dir, "8080").routes()
+
+	status, response := doAPI(t, handler, "GET", "/api/v1/files/content/mixed.log?fields=level,msg,fields.port,missing&limit=1", "")
+	if status != http.StatusOK {
+		t.Fatalf("期望状态码 200，得到 %d %s", status, response.Error)
+	}
+	result, rows := contentRows(t, response.Data)
+	if len(rows) != 1 || result["matched"] != float64(5) {
+		t.Fatalf("期望指定fields时自动解析并分页，得到 %v", result)
+	}
+	entry, _ := rows[0]["entry"].(map[string]interface{})
+	if len(entry) != 3 || entry["level"] != "info" || entry["msg"] != "started" || entry["fields.port"] != float64(8080) {
+		t.Errorf("期望只返回level、msg和fields.port，得到 %v", entry)
+	}
+}
+
+func TestFileContentLevelFilter(t *testing.T) {
+	dir := t.TempDir()
+	writeMixedLog(t, dir)
+	handler := NewWebServer(dir, "8080").routes()
+
+	// 按解析后的级别过滤：ERROR和error都匹配，消息中包含error的行和无法解析的行不匹配
+	status, response := doAPI(t, handler, "GET", "/api/files/content/mixed.log?level=error&offset=1", "")
+	if status != http.StatusOK {
+		t.Fatalf("期望状态码 200，得到 %d %s", status, response.Error)
+	}
+	result, rows := contentRows(t, response.Data)
+	entry, _ := rows[0]["entry"].(map[string]interface{})
+	if result["matched"] != float64(2) || len(rows) != 1 || entry["msg"] != "retry failed" || rows[0]["line"] != float64(6) {
+		t.Errorf("期望第二条error日志，得到 %v", result)
+	}
+
+	status, response = doAPI(t, handler, "GET", "/api/files/content/mixed.log?level=warning", "")
+	if _, rows := contentRows(t, response.Data); status != http.StatusOK || len(rows) != 1 {
+		t.Errorf("期望级别别名warning匹配warn，得到 %d %v", status, response.Data)
+	}
+
+	if status, _ := doAPI(t, handler, "GET", "/api/v1/files/content/mixed.log?level=loud", ""); status != http.StatusBadRequest {
+		t.Errorf("期望无效级别返回 400，得到 %d", status)
+	}
+	if status, _ := doAPI(t, handler, "GET", "/api/files/content/mixed.log?parse=maybe", ""); status != http.StatusBadRequest {
+		t.Errorf("期望无效的parse参数返回 400，得到 %d", status)
+	}
+}
+
+func TestFileContentCacheKeyIncludesFilter(t *testing.T) {
+	dir := t.TempDir()
+	path := writeMixedLog(t, dir)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(path, old, old)
+	handler := NewWebServer(dir, "8080").routes()
+
+	// 同一文件和分页的原始内容、解析结果和级别过滤结果分别缓存
+	_, raw := doAPI(t, handler, "GET", "/api/files/content/mixed.log", "")
+	_, parsed := doAPI(t, handler, "GET", "/api/files/content/mixed.log?parse=true", "")
+	_, filtered := doAPI(t, handler, "GET", "/api/files/content/mixed.log?level=error", "")
+
+	if data, _ := raw.Data.(map[string]interface{}); data["content"] == nil || data["rows"] != nil {
+		t.Errorf("期望原始内容，得到 %v", raw.Data)
+	}
+	if _, rows := contentRows(t, parsed.Data); len(rows) != 5 {
+		t.Errorf("期望 5 行解析结果，得到 %d", len(rows))
+	}
+	if _, rows := contentRows(t, filtered.Data); len(rows) != 2 {
+		t.Errorf("期望 2 行error日志，得到 %d", len(rows))
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HsiaoL1/trace"
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// 文件内容接口的读取方式（mode参数）
+const (
+	contentModeLines = "lines" // 默认：按行分页，返回JSON数组
+	contentModeTail  = "tail"  // 从文件末尾倒序读取最后lines行
+	contentModeRange = "range" // 以原始字节返回[start_byte, end_byte)
+)
+
+const (
+	defaultTailLines = 500
+	maxTailLines     = 10000
+)
+
+// tailBlockSize tail模式从文件末尾倒序读取时每次读取的字节数
+var tailBlockSize int64 = 64 << 10
+
+// errTailCompressed 压缩文件无法从末尾读取
+var errTailCompressed = errors.New("tail模式不支持压缩文件，请使用默认模式分页读取")
+
+// errRangeNotSatisfiable range模式的起始位置超过文件大小
+var errRangeNotSatisfiable = errors.New("start_byte超过文件大小")
+
+// contentMode 文件内容接口的读取方式和参数
+type contentMode struct {
+	mode      string
+	lines     int   // tail模式返回的行数
+	startByte int64 // range模式的起始位置
+	endByte   int64 // range模式的结束位置（不包含），为-1时到文件末尾
+}
+
+// parseContentMode 读取mode、lines、start_byte和end_byte参数
+// tail和range模式读取文件本身，不支持search和level过滤；range模式也不支持解析
+func parseContentMode(params url.Values, filter contentFilter) (contentMode, error) {
+	mode := contentMode{mode: params.Get("mode"), lines: defaultTailLines, endByte: -1}
+	switch mode.mode {
+	case "", contentModeLines:
+		mode.mode = contentModeLines
+		return mode, nil
+	case contentModeTail:
+		if value := params.Get("lines"); value != "" {
+			lines, err := strconv.Atoi(value)
+			if err != nil || lines <= 0 || lines > maxTailLines {
+				return mode, fmt.Errorf("无效的lines参数: %q（1到%d）", value, maxTailLines)
+			}
+			mode.lines = lines
+		}
+	case contentModeRange:
+		if filter.parse {
+			return mode, errors.New("range模式不支持parse、fields和level参数")
+		}
+		for _, param := range []struct {
+			name  string
+			value *int64
+		}{{"start_byte", &mode.startByte}, {"end_byte", &mode.endByte}} {
+			value := params.Get(param.name)
+			if value == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return mode, fmt.Errorf("无效的%s参数: %q", param.name, value)
+			}
+			*param.value = n
+		}
+		if mode.endByte >= 0 && mode.endByte <= mode.startByte {
+			return mode, fmt.Errorf("end_byte必须大于start_byte: %d <= %d", mode.endByte, mode.startByte)
+		}
+	default:
+		return mode, fmt.Errorf("无效的mode参数: %q（lines、tail或range）", mode.mode)
+	}
+	if filter.search != "" || filter.level != "" {
+		return mode, fmt.Errorf("%s模式不支持search和level参数", mode.mode)
+	}
+	return mode, nil
+}
+
+// contentModeStatus 返回tail和range模式错误的状态码
+func contentModeStatus(err error) int {
+	switch {
+	case errors.Is(err, errTailCompressed):
+		return http.StatusBadRequest
+	case errors.Is(err, errRangeNotSatisfiable):
+		return http.StatusRequestedRangeNotSatisfiable
+	}
+	return fileErrorStatus(err)
+}
+
+// tailContent tail模式的结果
+type tailContent struct {
+	lines     []string // parse为false时的原始行
+	rows      []LogRow // parse为true时的结构化行，没有行号
+	startByte int64    // 第一行在文件中的起始位置
+	size      int64    // 读取时的文件大小
+	skipped   int      // 超过logz.MaxLineSize被跳过的行数
+}
+
+// result 返回tail模式的响应数据，不统计文件的总行数
+func (c *tailContent) result(filter contentFilter, lines int) map[string]interface{} {
+	result := map[string]interface{}{
+		"mode":       contentModeTail,
+		"lines":      lines,
+		"start_byte": c.startByte,
+		"size":       c.size,
+	}
+	if c.skipped > 0 {
+		result["skipped_lines"] = c.skipped
+	}
+	if filter.parse {
+		result["rows"] = c.rows
+		if len(filter.fields) > 0 {
+			result["fields"] = filter.fields
+		}
+	} else {
+		result["content"] = c.lines
+	}
+	return result
+}
+
+// readTail 从文件末尾按块倒序读取，直到包含n个完整的行或读到文件开头，只读取最后n行所在的块
+// 最后一行没有换行符时同样返回；超过logz.MaxLineSize的行计入n但不返回
+func (ws *WebServer) readTail(ctx context.Context, path string, n int, filter contentFilter) (*tailContent, error) {
+	ctx, span := trace.StartInternalSpan(ctx, "logz.web.readTail")
+	defer span.End()
+	trace.SetAttribute(span, "logz.file", aggregate.RelativeLogPath(ws.logDir, path))
+
+	if strings.HasSuffix(path, ".gz") {
+		return nil, errTailCompressed
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	size := stat.Size()
+	pos := size
+	var data []byte
+	newlines := 0
+	for pos > 0 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		block := min(tailBlockSize, pos)
+		buf := make([]byte, block, int64(len(data))+block)
+		if _, err := file.ReadAt(buf, pos-block); err != nil && err != io.EOF {
+			return nil, err
+		}
+		newlines += bytes.Count(buf, []byte("\n"))
+		if pos == size && buf[block-1] == '\n' {
+			newlines-- // 文件末尾的换行符结束最后一行，不开始新的行
+		}
+		data = append(buf, data...)
+		pos -= block
+		if newlines >= n {
+			break
+		}
+	}
+	trace.SetAttribute(span, "logz.bytes_scanned", size-pos)
+
+	content := &tailContent{startByte: pos, size: size}
+	if pos > 0 {
+		// 第一块的开头是不完整的行
+		first := bytes.IndexByte(data, '\n') + 1
+		data = data[first:]
+		content.startByte += int64(first)
+	}
+	type tailLine struct {
+		offset  int64
+		text    string
+		tooLong bool
+	}
+	var lines []tailLine
+	reader := aggregate.NewLineReader(bytes.NewReader(data))
+	for reader.Scan() {
+		lines = append(lines, tailLine{offset: reader.Offset(), text: reader.Text(), tooLong: reader.TooLong()})
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	if len(lines) > 0 {
+		content.startByte += lines[0].offset
+	}
+	for _, line := range lines {
+		switch {
+		case line.tooLong:
+			content.skipped++
+		case filter.parse:
+			row, _ := filter.parseRow(0, line.text)
+			content.rows = append(content.rows, row)
+		default:
+			content.lines = append(content.lines, line.text)
+		}
+	}
+	return content, nil
+}
+
+// serveByteRange 以application/octet-stream流式返回文件[start_byte, end_byte)的原始字节，压缩文件返回压缩的字节
+// end_byte超过文件大小时到文件末尾；写出响应之前的错误由调用方返回，start_byte超过文件大小时返回errRangeNotSatisfiable
+func (ws *WebServer) serveByteRange(w http.ResponseWriter, path string, mode contentMode) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	size := stat.Size()
+	if mode.startByte > size {
+		return fmt.Errorf("%w: %d > %d", errRangeNotSatisfiable, mode.startByte, size)
+	}
+	end := size
+	if mode.endByte >= 0 && mode.endByte < size {
+		end = mode.endByte
+	}
+
+	// 与下载一样不受路由超时的写超时限制
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Length", strconv.FormatInt(end-mode.startByte, 10))
+	w.Header().Set("X-File-Size", strconv.FormatInt(size, 10))
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, io.NewSectionReader(file, mode.startByte, end-mode.startByte))
+	return nil
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// numberedLines 返回从first开始的n行"line 00001"格式的内容
+func numberedLines(first, n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line %05d", first+i)
+	}
+	return lines
+}
+
+// contentLines 取出响应中的原始行
+func contentLines(t *testing.T, data interface{}) (map[string]interface{}, []string) {
+	t.Helper()
+	result, _ := data.(map[string]interface{})
+	raw, ok := result["content"].([]interface{})
+	if !ok && result["content"] != nil {
+		t.Fatalf("期望返回content，得到 %v", data)
+	}
+	lines := make([]string, len(raw))
+	for i, line := range raw {
+		lines[i], _ = line.(string)
+	}
+	return result, lines
+}
+
+func TestFileContentTail(t *testing.T) {
+	dir := t.TempDir()
+	lines := numberedLines(1, 50)
+	files := map[string]string{
+		"newline.log":    strings.Join(lines, "\n") + "\n",
+		"partial.log":    strings.Join(lines, "\n"),
+		"crlf.log":       strings.Join(lines, "\r\n") + "\r\n",
+		"empty.log":      "",
+		"single.log":     "only line",
+		"blank-tail.log": strings.Join(lines, "\n") + "\n\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("写入文件失败: %v", err)
+		}
+	}
+	handler := NewWebServer(dir, "8080").routes()
+
+	// 块大小小于一行、跨越多行和大于文件时，各种行数都返回文件的最后n行
+	defer func(size int64) { tailBlockSize = size }(tailBlockSize)
+	for _, blockSize := range []int64{7, 64, 64 << 10} {
+		tailBlockSize = blockSize
+		for _, name := range []string{"newline.log", "partial.log", "crlf.log"} {
+			for _, n := range []int{1, 2, 25, 49, 50, 51, 500} {
+				status, response := doAPI(t, handler, "GET", fmt.Sprintf("/api/v1/files/content/%s?mode=tail&lines=%d", name, n), "")
+				if status != http.StatusOK {
+					t.Fatalf("%s lines=%d: 期望状态码 200，得到 %d %s", name, n, status, response.Error)
+				}
+				result, got := contentLines(t, response.Data)
+				want := lines[max(len(lines)-n, 0):]
+				if !slices.Equal(got, want) {
+					t.Fatalf("块大小 %d，%s lines=%d: 期望 %v，得到 %v", blockSize, name, n, want, got)
+				}
+				data, _ := os.ReadFile(filepath.Join(dir, name))
+				start := int(result["start_byte"].(float64))
+				if !strings.HasPrefix(string(data[start:]), want[0]) || result["size"] != float64(len(data)) {
+					t.Errorf("%s lines=%d: start_byte %d 或 size %v 不正确", name, n, start, result["size"])
+				}
+			}
+		}
+	}
+
+	for _, tt := range []struct {
+		name string
+		want []string
+	}{
+		{"empty.log", nil},
+		{"single.log", []string{"only line"}},
+		{"blank-tail.log", []string{lines[49], ""}},
+	} {
+		status, response := doAPI(t, handler, "GET", "/api/files/content/"+tt.name+"?mode=tail&lines=2", "")
+		if _, got := contentLines(t, response.Data); status != http.StatusOK || !slices.Equal(got, tt.want) {
+			t.Errorf("%s: 期望 %q，得到 %d %q", tt.name, tt.want, status, got)
+		}
+	}
+
+	// 解析模式返回没有行号的结构化行
+	writeMixedLog(t, dir)
+	status, response := doAPI(t, handler, "GET", "/api/v1/files/content/mixed.log?mode=tail&lines=2&fields=msg", "")
+	if status != http.StatusOK {
+		t.Fatalf("期望状态码 200，得到 %d %s", status, response.Error)
+	}
+	_, rows := contentRows(t, response.Data)
+	if len(rows) != 2 || rows[1]["entry"].(map[string]interface{})["msg"] != "retry failed" || rows[1]["line"] != nil {
+		t.Errorf("期望最后两行解析后的消息，得到 %v", rows)
+	}
+}
+
+func TestFileContentModeErrors(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app.log"), []byte("0123456789\nabcdef\n"), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	file, err := os.Create(filepath.Join(dir, "old.log.gz"))
+	if err != nil {
+		t.Fatalf("创建文件失败: %v", err)
+	}
+	gz := gzip.NewWriter(file)
+	io.WriteString(gz, "compressed\n")
+	gz.Close()
+	file.Close()
+	handler := NewWebServer(dir, "8080").routes()
+
+	for _, prefix := range []string{"/api/files/content/", "/api/v1/files/content/"} {
+		for _, tt := range []struct {
+			query  string
+			status int
+		}{
+			{"old.log.gz?mode=tail", http.StatusBadRequest},
+			{"app.log?mode=tail&lines=0", http.StatusBadRequest},
+			{"app.log?mode=tail&search=abc", http.StatusBadRequest},
+			{"app.log?mode=tail&level=error", http.StatusBadRequest},
+			{"app.log?mode=head", http.StatusBadRequest},
+			{"app.log?mode=range&start_byte=5&end_byte=5", http.StatusBadRequest},
+			{"app.log?mode=range&start_byte=-1", http.StatusBadRequest},
+			{"app.log?mode=range&parse=true", http.StatusBadRequest},
+			{"app.log?mode=range&start_byte=100", http.StatusRequestedRangeNotSatisfiable},
+			{"missing.log?mode=tail", http.StatusNotFound},
+		} {
+			status, response := doAPI(t, handler, "GET", prefix+tt.query, "")
+			if status != tt.status || response.Success {
+				t.Errorf("%s%s: 期望状态码 %d，得到 %d %+v", prefix, tt.query, tt.status, status, response)
+			}
+		}
+	}
+}
+
+func TestFileContentRange(t *testing.T) {
+	dir := t.TempDir()
+	data := "0123456789\nabcdef\n"
+	if err := os.WriteFile(filepath.Join(dir, "app.log"), []byte(data), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	handler := NewWebServer(dir, "8080").routes()
+
+	for _, tt := range []struct {
+		query string
+		want  string
+	}{
+		{"mode=range", data},
+		{"mode=range&start_byte=11", "abcdef\n"},
+		{"mode=range&start_byte=3&end_byte=8", "34567"},
+		{"mode=range&start_byte=11&end_byte=1000", "abcdef\n"},
+		{"mode=range&start_byte=18", ""},
+	} {
+		for _, prefix := range []string{"/api/files/content/", "/api/v1/files/content/"} {
+			w := serve(handler, prefix+"app.log?"+tt.query, nil)
+			if w.Code != http.StatusOK || w.Body.String() != tt.want {
+				t.Errorf("%s: 期望 200 %q，得到 %d %q", tt.query, tt.want, w.Code, w.Body.String())
+			}
+			if w.Header().Get("Content-Type") != "application/octet-stream" || w.Header().Get("X-File-Size") != "18" ||
+				w.Header().Get("Content-Length") != fmt.Sprint(len(tt.want)) {
+				t.Errorf("%s: 响应头不正确: %v", tt.query, w.Header())
+			}
+		}
+	}
+}
+
+func TestFileContentOffsetCache(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "big.log")
+	appendLines := func(content string) {
+		t.Helper()
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			t.Fatalf("打开文件失败: %v", err)
+		}
+		defer file.Close()
+		if _, err := file.WriteString(content); err != nil {
+			t.Fatalf("写入文件失败: %v", err)
+		}
+	}
+	appendLines(strings.Join(numberedLines(1, 3500), "\n") + "\n")
+
+	ws := NewWebServer(dir, "8080")
+	ctx := context.Background()
+	// check 比较使用缓存的结果与不使用缓存从头读取的结果
+	check := func(limit, offset int, filter contentFilter) (*fileContent, int64) {
+		t.Helper()
+		got, scanned, err := ws.readFileContent(ctx, path, limit, offset, filter)
+		if err != nil {
+			t.Fatalf("读取文件失败: %v", err)
+		}
+		want, _, err := NewWebServer(dir, "8080").readFileContent(ctx, path, limit, offset, filter)
+		if err != nil {
+			t.Fatalf("读取文件失败: %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("offset=%d %+v: 使用缓存的结果与从头读取的不同\n得到 %+v\n期望 %+v", offset, filter, got, want)
+		}
+		return got, scanned
+	}
+
+	content, scanned := check(10, 2500, contentFilter{})
+	stat, _ := os.Stat(path)
+	if content.lines[0] != "line 02501" || content.total != 3500 || scanned != stat.Size() {
+		t.Fatalf("期望第一次读取整个文件，得到 %v total=%d scanned=%d", content.lines, content.total, scanned)
+	}
+	// 之后的分页从最近的检查点开始读取，不再读取前面的页
+	content, scanned = check(10, 3200, contentFilter{})
+	if content.lines[0] != "line 03201" || content.total != 3500 || scanned > stat.Size()/4 {
+		t.Errorf("期望从检查点读取，得到 %v total=%d scanned=%d（文件 %d 字节）", content.lines, content.total, scanned, stat.Size())
+	}
+
+	// 文件增长后只读取新增的内容，最后一行没有写完时同样返回，写完后重新读取
+	appendLines(strings.Join(numberedLines(3501, 1000), "\n") + "\n" + "line 04")
+	content, scanned = check(20, 4490, contentFilter{})
+	if content.total != 4501 || content.lines[len(content.lines)-1] != "line 04" || scanned > 20000 {
+		t.Errorf("期望读取新增的行，得到 %v total=%d scanned=%d", content.lines, content.total, scanned)
+	}
+	appendLines("501\n" + strings.Join(numberedLines(4502, 10), "\n") + "\n")
+	content, _ = check(20, 4490, contentFilter{})
+	if content.total != 4511 || content.lines[10] != "line 04501" {
+		t.Errorf("期望写完的行被重新读取，得到 %v total=%d", content.lines, content.total)
+	}
+	for _, offset := range []int{0, 999, 1000, 1001, 4510, 4511, 6000} {
+		check(7, offset, contentFilter{})
+	}
+
+	// 过滤条件分别缓存
+	filter := contentFilter{search: "7"}
+	for _, offset := range []int{0, 1500, 1499, 20} {
+		check(5, offset, filter)
+	}
+	appendLines(strings.Join(numberedLines(7000, 100), "\n") + "\n")
+	for _, offset := range []int{1900, 1300} {
+		check(5, offset, filter)
+	}
+
+	// 文件被截断或替换后重新读取
+	if err := os.WriteFile(path, []byte(strings.Join(numberedLines(1, 30), "\n")+"\n"), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	if content, _ := check(5, 10, contentFilter{}); content.total != 30 || content.lines[0] != "line 00011" {
+		t.Errorf("期望截断后重新读取，得到 %v total=%d", content.lines, content.total)
+	}
+	replacement := filepath.Join(dir, "new.log")
+	if err := os.WriteFile(replacement, []byte(strings.Join(numberedLines(100, 4000), "\n")+"\n"), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	if err := os.Rename(replacement, path); err != nil {
+		t.Fatalf("替换文件失败: %v", err)
+	}
+	if content, _ := check(5, 3000, contentFilter{}); content.total != 4000 || content.lines[0] != "line 03100" {
+		t.Errorf("期望替换后重新读取，得到 %v total=%d", content.lines, content.total)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CORS配置的环境变量
+const (
+	corsAllowedOriginsEnv = "CORS_ALLOWED_ORIGINS"   // 逗号分隔的来源，未设置时不启用CORS
+	corsAllowedMethodsEnv = "CORS_ALLOWED_METHODS"   // 逗号分隔的方法
+	corsAllowedHeadersEnv = "CORS_ALLOWED_HEADERS"   // 逗号分隔的请求头
+	corsCredentialsEnv    = "CORS_ALLOW_CREDENTIALS" // 为true时允许携带cookie和认证头
+)
+
+// CORS默认允许的方法和请求头
+var (
+	defaultCORSMethods = []string{"GET", "POST", "PUT", "DELETE"}
+	defaultCORSHeaders = []string{"Content-Type", "Authorization", "X-API-Key", requestIDHeader}
+)
+
+// corsMaxAge 预检结果的缓存时间（秒）
+const corsMaxAge = 86400
+
+// corsConfig 跨域访问配置，origins为空时不启用CORS
+type corsConfig struct {
+	origins     []originPattern
+	methods     []string
+	headers     []string
+	credentials bool
+}
+
+// originPattern 允许的来源：完整匹配、任意子域名（https://*.example.com）或任意来源（*）
+type originPattern struct {
+	any       bool
+	scheme    string
+	host      string // 子域名匹配时为".example.com"
+	port      string
+	subdomain bool
+}
+
+// loadCORSConfig 从环境变量读取CORS配置，无效的来源被忽略
+func loadCORSConfig() corsConfig {
+	var config corsConfig
+	for _, value := range splitList(os.Getenv(corsAllowedOriginsEnv)) {
+		pattern, ok := parseOriginPattern(value)
+		if !ok {
+			log.Printf("无效的%s: %s", corsAllowedOriginsEnv, value)
+			continue
+		}
+		config.origins = append(config.origins, pattern)
+	}
+
+	config.methods = defaultCORSMethods
+	if methods := splitList(os.Getenv(corsAllowedMethodsEnv)); len(methods) > 0 {
+		config.methods = nil
+		for _, method := range methods {
+			config.methods = append(config.methods, strings.ToUpper(method))
+		}
+	}
+	config.headers = defaultCORSHeaders
+	if headers := splitList(os.Getenv(corsAllowedHeadersEnv)); len(headers) > 0 {
+		config.headers = headers
+	}
+	if value := os.Getenv(corsCredentialsEnv); value != "" {
+		credentials, err := strconv.ParseBool(value)
+		if err != nil {
+			log.Printf("无效的%s: %s", corsCredentialsEnv, value)
+		}
+		config.credentials = credentials
+	}
+	return config
+}
+
+// splitList 拆分逗号分隔的列表，去掉空白和空项
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseOriginPattern 解析"*"、"https://app.example.com"或"https://*.example.com:8443"形式的来源
+func parseOriginPattern(value string) (originPattern, bool) {
+	if value == "*" {
+		return originPattern{any: true}, true
+	}
+	u, err := url.Parse(strings.ToLower(strings.TrimSuffix(value, "/")))
+	if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" || u.RawQuery != "" || u.User != nil {
+		return originPattern{}, false
+	}
+	pattern := originPattern{scheme: u.Scheme, host: u.Hostname(), port: u.Port()}
+	if rest, ok := strings.CutPrefix(pattern.host, "*."); ok {
+		if rest == "" || strings.Contains(rest, "*") {
+			return originPattern{}, false
+		}
+		pattern.host = "." + rest
+		pattern.subdomain = true
+	} else if strings.Contains(pattern.host, "*") {
+		return originPattern{}, false
+	}
+	return pattern, true
+}
+
+// matches 判断请求的Origin是否匹配，子域名匹配不包括域名本身
+func (p originPattern) matches(origin *url.URL) bool {
+	if p.any {
+		return true
+	}
+	if origin.Scheme != p.scheme || origin.Port() != p.port {
+		return false
+	}
+	if p.subdomain {
+		host := origin.Hostname()
+		return strings.HasSuffix(host, p.host) && len(host) > len(p.host)
+	}
+	return origin.Hostname() == p.host
+}
+
+// allowOrigin 判断Origin请求头是否在允许列表中
+func (c corsConfig) allowOrigin(origin string) bool {
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+	for _, pattern := range c.origins {
+		if pattern.matches(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowMethod 判断预检请求的方法是否允许，简单方法总是允许
+func (c corsConfig) allowMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost:
+		return true
+	}
+	return slices.Contains(c.methods, method)
+}
+
+// corsSettings 获取当前的CORS配置
+func (ws *WebServer) corsSettings() corsConfig {
+	ws.settingsMutex.RLock()
+	defer ws.settingsMutex.RUnlock()
+	return ws.cors
+}
+
+// corsHandler 为允许的来源添加CORS响应头并处理预检请求
+// 没有配置允许的来源时不启用CORS；不允许的来源不返回CORS响应头，预检请求返回403
+// 允许携带凭据或只配置了部分来源时回显请求的Origin，而不是"*"
+func (ws *WebServer) corsHandler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		config := ws.corsSettings()
+		if len(config.origins) == 0 {
+			next(w, r)
+			return
+		}
+
+		origin := r.Header.Get("Origin")
+		w.Header().Add("Vary", "Origin")
+		requestMethod := r.Header.Get("Access-Control-Request-Method")
+		preflight := r.Method == http.MethodOptions && origin != "" && requestMethod != ""
+		if origin == "" || !config.allowOrigin(origin) {
+			if preflight {
+				http.Error(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+			next(w, r)
+			return
+		}
+
+		allowOrigin := origin
+		if !config.credentials && slices.ContainsFunc(config.origins, func(p originPattern) bool { return p.any }) {
+			allowOrigin = "*"
+		}
+		w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+		if config.credentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			next(w, r)
+			return
+		}
+		if !config.allowMethod(requestMethod) {
+			w.Header().Del("Access-Control-Allow-Origin")
+			w.Header().Del("Access-Control-Allow-Credentials")
+			http.Error(w, "Method not allowed", http.StatusForbidden)
+			return
+		}
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(config.methods, ", "))
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(config.headers, ", "))
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(corsMaxAge))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
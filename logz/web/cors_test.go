@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// corsRequest 发送带Origin的请求，preflightMethod不为空时发送预检请求
+func corsRequest(handler http.Handler, origin, preflightMethod string) *httptest.ResponseRecorder {
+	method := http.MethodGet
+	if preflightMethod != "" {
+		method = http.MethodOptions
+	}
+	req := httptest.NewRequest(method, "/api/v1/stats", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if preflightMethod != "" {
+		req.Header.Set("Access-Control-Request-Method", preflightMethod)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORSDisabledByDefault(t *testing.T) {
+	ws := NewWebServer(t.TempDir(), "8080")
+	defer close(ws.shutdownCh)
+
+	w := corsRequest(ws.routes(), "https://evil.example.com", "")
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("期望未配置来源时不返回CORS响应头，得到 %d %v", w.Code, w.Header())
+	}
+}
+
+func TestCORSAllowList(t *testing.T) {
+	t.Setenv(corsAllowedOriginsEnv, "https://ui.example.com, https://*.corp.example.com:8443, not-an-origin")
+	t.Setenv(corsAllowedMethodsEnv, "get,post,delete")
+	ws := NewWebServer(t.TempDir(), "8080")
+	defer close(ws.shutdownCh)
+	handler := ws.routes()
+
+	tests := []struct {
+		name   string
+		origin string
+		allow  bool
+	}{
+		{"完整匹配", "https://ui.example.com", true},
+		{"大小写不敏感", "HTTPS://UI.example.com", true},
+		{"协议不同", "http://ui.example.com", false},
+		{"子域名", "https://logs.corp.example.com:8443", true},
+		{"多级子域名", "https://a.b.corp.example.com:8443", true},
+		{"子域名匹配不包括域名本身", "https://corp.example.com:8443", false},
+		{"子域名端口不同", "https://logs.corp.example.com", false},
+		{"后缀相同的其他域名", "https://evilcorp.example.com:8443", false},
+		{"不在列表中", "https://evil.example.com", false},
+		{"null来源", "null", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := corsRequest(handler, tt.origin, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("期望请求正常处理，得到 %d", w.Code)
+			}
+			got := w.Header().Get("Access-Control-Allow-Origin")
+			if tt.allow && got != tt.origin {
+				t.Errorf("期望回显Origin %q，得到 %q", tt.origin, got)
+			}
+			if !tt.allow && got != "" {
+				t.Errorf("期望不返回CORS响应头，得到 %q", got)
+			}
+			if w.Header().Get("Access-Control-Allow-Credentials") != "" {
+				t.Error("期望未启用凭据时不返回Allow-Credentials")
+			}
+		})
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	t.Setenv(corsAllowedOriginsEnv, "https://ui.example.com")
+	t.Setenv(corsAllowedMethodsEnv, "GET,POST,DELETE")
+	t.Setenv(corsCredentialsEnv, "true")
+	ws := NewWebServer(t.TempDir(), "8080")
+	defer close(ws.shutdownCh)
+	handler := ws.routes()
+
+	w := corsRequest(handler, "https://ui.example.com", "DELETE")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("期望预检返回204，得到 %d", w.Code)
+	}
+	header := w.Header()
+	if header.Get("Access-Control-Allow-Origin") != "https://ui.example.com" || header.Get("Access-Control-Allow-Credentials") != "true" ||
+		header.Get("Access-Control-Allow-Methods") != "GET, POST, DELETE" || header.Get("Access-Control-Max-Age") == "" {
+		t.Errorf("预检响应头错误: %v", header)
+	}
+
+	// 不允许的方法和来源返回403且没有CORS响应头
+	for _, tt := range []struct{ origin, method string }{
+		{"https://ui.example.com", "PUT"},
+		{"https://evil.example.com", "GET"},
+	} {
+		w := corsRequest(handler, tt.origin, tt.method)
+		if w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("期望%s %s的预检被拒绝，得到 %d %v", tt.origin, tt.method, w.Code, w.Header())
+		}
+	}
+
+	// 允许任意来源且启用凭据时回显Origin而不是*
+	t.Setenv(corsAllowedOriginsEnv, "*")
+	ws.ReloadSettings()
+	if got := corsRequest(handler, "https://any.example.org", "").Header().Get("Access-Control-Allow-Origin"); got != "https://any.example.org" {
+		t.Errorf("期望启用凭据时回显Origin，得到 %q", got)
+	}
+	t.Setenv(corsCredentialsEnv, "false")
+	ws.ReloadSettings()
+	if got := corsRequest(handler, "https://any.example.org", "").Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("期望未启用凭据时返回*，得到 %q", got)
+	}
+}
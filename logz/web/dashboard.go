@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// 仪表盘的默认配置和环境变量
+const (
+	defaultDashboardWindow   = time.Hour
+	defaultDashboardCacheTTL = 15 * time.Second
+	dashboardCacheTTLEnv     = "DASHBOARD_CACHE_TTL"
+
+	// dashboardLagThreshold 最早的未建立索引条目等待超过此时间时认为聚合器延迟
+	dashboardLagThreshold = 30 * time.Second
+)
+
+// WithDashboardCacheTTL 设置仪表盘统计结果的缓存时间，默认15秒，为0时不缓存
+func WithDashboardCacheTTL(ttl time.Duration) WebServerOption {
+	return func(ws *WebServer) {
+		ws.dashboard.ttl = ttl
+	}
+}
+
+// DashboardResponse 仪表盘汇总信息
+type DashboardResponse struct {
+	Window           string               `json:"window"`
+	GeneratedAt      time.Time            `json:"generated_at"`
+	Total            int                  `json:"total"`
+	ErrorCount       int                  `json:"error_count"`
+	RecentErrors     []aggregate.LogEntry `json:"recent_errors"`      // 最近10条错误
+	TopTraces        []aggregate.KeyCount `json:"top_traces"`         // 条目数最多的5个TraceID
+	TopErrorServices []aggregate.KeyCount `json:"top_error_services"` // 错误数最多的5个服务
+	DiskUsage        int64                `json:"disk_usage"`         // 日志目录占用的字节数（包括索引）
+	Aggregator       DashboardAggregator  `json:"aggregator"`
+}
+
+// DashboardAggregator 全局聚合器的状态
+type DashboardAggregator struct {
+	Status string `json:"status"` // none（未设置）、ok、lagging（索引延迟）或closed
+	*aggregate.AggregatorHealth
+}
+
+// dashboardCache 按时间窗口缓存仪表盘统计结果，同一时间只计算一次
+type dashboardCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[time.Duration]*DashboardResponse
+}
+
+// get 返回未过期的缓存结果，否则调用compute计算并缓存
+func (c *dashboardCache) get(window time.Duration, compute func() (*DashboardResponse, error)) (*DashboardResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.entries[window]; ok && time.Since(cached.GeneratedAt) < c.ttl {
+		return cached, nil
+	}
+
+	result, err := compute()
+	if err != nil {
+		return nil, err
+	}
+	if c.ttl > 0 {
+		if c.entries == nil {
+			c.entries = make(map[time.Duration]*DashboardResponse)
+		}
+		c.entries[window] = result
+	}
+	return result, nil
+}
+
+// handleDashboard 返回时间窗口内的日志统计、最近错误、排行、磁盘占用和聚合器状态
+func (api *APIServer) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		api.sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	window, err := parseWindowParam(r, defaultDashboardWindow)
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := api.ws.dashboard.get(window, func() (*DashboardResponse, error) {
+		return api.ws.computeDashboard(r.Context(), window)
+	})
+	if err != nil {
+		api.sendQueryError(w, err)
+		return
+	}
+
+	api.sendSuccessResponse(w, result)
+}
+
+// computeDashboard 扫描时间窗口内的日志并汇总仪表盘信息
+func (ws *WebServer) computeDashboard(ctx context.Context, window time.Duration) (*DashboardResponse, error) {
+	now := time.Now()
+	query := ws.logQuery(aggregate.LogQuery{StartTime: now.Add(-window)})
+	ctx, release, err := ws.admitQuery(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	aggregation, err := aggregate.AggregateLogsContext(ctx, query, ws.logDir, aggregate.AggregateOptions{TopN: 5, RecentErrors: 10})
+	if err != nil {
+		return nil, err
+	}
+
+	return &DashboardResponse{
+		Window:           window.String(),
+		GeneratedAt:      now,
+		Total:            aggregation.Total,
+		ErrorCount:       aggregation.ErrorCount,
+		RecentErrors:     aggregation.RecentErrors,
+		TopTraces:        aggregation.TopTraces,
+		TopErrorServices: aggregation.TopErrorServices,
+		DiskUsage:        dirUsage(ws.logDir),
+		Aggregator:       aggregatorStatus(),
+	}, nil
+}
+
+// aggregatorStatus 返回全局聚合器的状态
+func aggregatorStatus() DashboardAggregator {
+	aggregator := aggregate.GetGlobalAggregator()
+	if aggregator == nil {
+		return DashboardAggregator{Status: "none"}
+	}
+
+	health := aggregator.Health()
+	status := "ok"
+	switch {
+	case health.Closed:
+		status = "closed"
+	case health.IndexLagDuration > dashboardLagThreshold,
+		health.IndexQueueCapacity > 0 && health.IndexQueueDepth >= health.IndexQueueCapacity:
+		status = "lagging"
+	}
+	return DashboardAggregator{Status: status, AggregatorHealth: &health}
+}
+
+// dirUsage 统计目录中所有普通文件的总大小，跳过无法读取的文件
+func dirUsage(root string) int64 {
+	var total int64
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
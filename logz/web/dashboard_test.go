@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// writeDashboardFixture 写入最近一小时内的日志和一条更早的错误日志
+func writeDashboardFixture(t *testing.T, dir string) {
+	t.Helper()
+	now := time.Now()
+	ago := func(minutes int) string {
+		return now.Add(-time.Duration(minutes) * time.Minute).Format(time.RFC3339)
+	}
+
+	var entries []aggregate.LogEntry
+	for i := 0; i < 6; i++ {
+		entries = append(entries, aggregate.LogEntry{Timestamp: ago(50 - i), Level: "info", Message: "noisy", Service: "api", TraceID: "trace-noisy"})
+	}
+	for i := 0; i < 12; i++ {
+		service := "api"
+		if i%3 == 0 {
+			service = "worker"
+		}
+		entries = append(entries, aggregate.LogEntry{Timestamp: ago(40 - i), Level: "error", Message: "failure " + string(rune('a'+i)), Service: service, TraceID: "trace-" + string(rune('a'+i%7))})
+	}
+	entries = append(entries,
+		aggregate.LogEntry{Timestamp: ago(5), Level: "fatal", Message: "crash", Service: "billing", TraceID: "trace-a"},
+		aggregate.LogEntry{Timestamp: ago(120), Level: "error", Message: "too old", Service: "legacy", TraceID: "trace-noisy"},
+	)
+
+	var sb strings.Builder
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			t.Fatalf("序列化日志失败: %v", err)
+		}
+		sb.Write(data)
+		sb.WriteByte('\n')
+	}
+	if err := os.WriteFile(filepath.Join(dir, "app.log"), []byte(sb.String()), 0644); err != nil {
+		t.Fatalf("写入日志文件失败: %v", err)
+	}
+}
+
+func TestDashboardAPI(t *testing.T) {
+	aggregate.SetGlobalAggregator(nil)
+	dir := t.TempDir()
+	writeDashboardFixture(t, dir)
+	handler := NewWebServer(dir, "8080").routes()
+
+	var dashboard DashboardResponse
+	if code := getAPI(t, handler, "/api/v1/dashboard?window=1h", &dashboard); code != http.StatusOK {
+		t.Fatalf("期望状态码 200，得到 %d", code)
+	}
+
+	if dashboard.Window != "1h0m0s" || dashboard.Total != 19 || dashboard.ErrorCount != 13 {
+		t.Errorf("期望1小时内共 19 条、错误 13 条，得到 %s %d %d", dashboard.Window, dashboard.Total, dashboard.ErrorCount)
+	}
+
+	if len(dashboard.RecentErrors) != 10 {
+		t.Fatalf("期望 10 条最近错误，得到 %d", len(dashboard.RecentErrors))
+	}
+	if dashboard.RecentErrors[0].Message != "crash" || dashboard.RecentErrors[1].Message != "failure l" || dashboard.RecentErrors[9].Message != "failure d" {
+		t.Errorf("最近错误顺序错误: %s ... %s", dashboard.RecentErrors[0].Message, dashboard.RecentErrors[9].Message)
+	}
+
+	wantTraces := []aggregate.KeyCount{{Key: "trace-noisy", Count: 6}, {Key: "trace-a", Count: 3}, {Key: "trace-b", Count: 2}, {Key: "trace-c", Count: 2}, {Key: "trace-d", Count: 2}}
+	if len(dashboard.TopTraces) != len(wantTraces) {
+		t.Fatalf("期望 %v，得到 %v", wantTraces, dashboard.TopTraces)
+	}
+	for i, want := range wantTraces {
+		if dashboard.TopTraces[i] != want {
+			t.Errorf("第%d个trace: 期望 %v，得到 %v", i, want, dashboard.TopTraces[i])
+		}
+	}
+
+	wantServices := []aggregate.KeyCount{{Key: "api", Count: 8}, {Key: "worker", Count: 4}, {Key: "billing", Count: 1}}
+	if len(dashboard.TopErrorServices) != len(wantServices) {
+		t.Fatalf("期望 %v，得到 %v", wantServices, dashboard.TopErrorServices)
+	}
+	for i, want := range wantServices {
+		if dashboard.TopErrorServices[i] != want {
+			t.Errorf("第%d个服务: 期望 %v，得到 %v", i, want, dashboard.TopErrorServices[i])
+		}
+	}
+
+	stat, err := os.Stat(filepath.Join(dir, "app.log"))
+	if err != nil {
+		t.Fatalf("获取文件信息失败: %v", err)
+	}
+	if dashboard.DiskUsage != stat.Size() {
+		t.Errorf("期望磁盘占用 %d，得到 %d", stat.Size(), dashboard.DiskUsage)
+	}
+	if dashboard.Aggregator.Status != "none" || dashboard.Aggregator.AggregatorHealth != nil {
+		t.Errorf("期望没有聚合器，得到 %+v", dashboard.Aggregator)
+	}
+
+	// 更大的时间窗口包含更早的日志
+	if code := getAPI(t, handler, "/api/v1/dashboard?window=3h", &dashboard); code != http.StatusOK || dashboard.Total != 20 {
+		t.Errorf("期望3小时内共 20 条，得到 %d %d", code, dashboard.Total)
+	}
+	if code := getAPI(t, handler, "/api/v1/dashboard?window=-1h", nil); code != http.StatusBadRequest {
+		t.Errorf("期望状态码 400，得到 %d", code)
+	}
+}
+
+func TestDashboardAggregatorHealth(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := aggregate.NewLogAggregatorWithOptions(filepath.Join(dir, "aggregated"), "dashboard-test")
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	aggregate.SetGlobalAggregator(aggregator)
+	defer aggregate.SetGlobalAggregator(nil)
+
+	handler := NewWebServer(dir, "8080", WithDashboardCacheTTL(0)).routes()
+	var dashboard DashboardResponse
+	if code := getAPI(t, handler, "/api/v1/dashboard", &dashboard); code != http.StatusOK {
+		t.Fatalf("期望状态码 200，得到 %d", code)
+	}
+	health := dashboard.Aggregator.AggregatorHealth
+	if dashboard.Aggregator.Status != "ok" || health == nil || health.ServiceName != "dashboard-test" || health.IndexQueueCapacity == 0 {
+		t.Errorf("聚合器状态错误: %+v %+v", dashboard.Aggregator, health)
+	}
+
+	aggregator.Close()
+	if code := getAPI(t, handler, "/api/v1/dashboard", &dashboard); code != http.StatusOK || dashboard.Aggregator.Status != "closed" {
+		t.Errorf("期望聚合器已关闭，得到 %d %s", code, dashboard.Aggregator.Status)
+	}
+}
+
+func TestDashboardCache(t *testing.T) {
+	aggregate.SetGlobalAggregator(nil)
+	line := `{"timestamp":"` + time.Now().Format(time.RFC3339) + `","level":"error","message":"late","service":"api"}` + "\n"
+
+	for _, tt := range []struct {
+		name string
+		ttl  time.Duration
+		want int
+	}{
+		{"缓存未过期", time.Minute, 19},
+		{"不缓存", 0, 20},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeDashboardFixture(t, dir)
+			handler := NewWebServer(dir, "8080", WithDashboardCacheTTL(tt.ttl)).routes()
+
+			var dashboard DashboardResponse
+			getAPI(t, handler, "/api/v1/dashboard", &dashboard)
+			if err := os.WriteFile(filepath.Join(dir, "late.log"), []byte(line), 0644); err != nil {
+				t.Fatalf("写入日志文件失败: %v", err)
+			}
+			if code := getAPI(t, handler, "/api/v1/dashboard", &dashboard); code != http.StatusOK || dashboard.Total != tt.want {
+				t.Errorf("期望共 %d 条，得到 %d %d", tt.want, code, dashboard.Total)
+			}
+		})
+	}
+}
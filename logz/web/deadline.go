@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// 路由分组，每组使用各自的请求超时
+const (
+	RouteGroupDefault = "default" // 文件列表、统计、健康检查、页面等开销小的路由
+	RouteGroupSearch  = "search"  // 日志查询、文件内容、校验和上传等可能读取大量数据的路由
+	RouteGroupStream  = "stream"  // 日志流和导出，自行管理连接的生命周期，不设超时
+)
+
+// 路由超时的默认值和环境变量
+const (
+	defaultRouteTimeout = 10 * time.Second
+	searchRouteTimeout  = 60 * time.Second
+
+	routeTimeoutDefaultEnv = "ROUTE_TIMEOUT_DEFAULT"
+	routeTimeoutSearchEnv  = "ROUTE_TIMEOUT_SEARCH"
+)
+
+// deadlineWriteGrace 请求超时后写出504响应的时间，连接的写超时比请求超时晚这么久
+const deadlineWriteGrace = 5 * time.Second
+
+// routeGroups 内置路由所属的分组，未列出的路由属于RouteGroupDefault
+var routeGroups = map[string]string{
+	"/api/search":         RouteGroupSearch,
+	"/api/errors":         RouteGroupSearch,
+	"/api/files/content/": RouteGroupSearch,
+	"/api/files/upload":   RouteGroupSearch,
+
+	"/api/v1/logs/search":         RouteGroupSearch,
+	"/api/v1/logs/trace/":         RouteGroupSearch,
+	"/api/v1/logs/span/":          RouteGroupSearch,
+	"/api/v1/logs/level/":         RouteGroupSearch,
+	"/api/v1/logs/service/":       RouteGroupSearch,
+	"/api/v1/logs/errors":         RouteGroupSearch,
+	"/api/v1/errors/grouped":      RouteGroupSearch,
+	"/api/v1/dashboard":           RouteGroupSearch,
+	"/api/v1/files/":              RouteGroupSearch,
+	"/api/v1/files/content/":      RouteGroupSearch,
+	"/api/v1/maintenance/cleanup": RouteGroupSearch,
+	"/api/v1/index/compact":       RouteGroupSearch,
+	federatedSearchPath:           RouteGroupSearch,
+
+	streamPath: RouteGroupStream,
+	exportPath: RouteGroupStream,
+}
+
+// routeGroup 返回路由模式所属的分组
+func routeGroup(pattern string) string {
+	if group, ok := routeGroups[pattern]; ok {
+		return group
+	}
+	return RouteGroupDefault
+}
+
+// WithRouteTimeout 设置路由分组的请求超时，为0时不设超时
+// RouteGroupStream始终不设超时，日志流和导出可以超过服务器的WriteTimeout
+func WithRouteTimeout(group string, timeout time.Duration) WebServerOption {
+	return func(ws *WebServer) {
+		if group != RouteGroupDefault && group != RouteGroupSearch {
+			log.Printf("无效的路由分组: %s", group)
+			return
+		}
+		if timeout < 0 {
+			log.Printf("无效的路由超时: %s=%v", group, timeout)
+			return
+		}
+		ws.routeTimeouts[group] = timeout
+	}
+}
+
+// routeTimeoutsFromEnv 从环境变量读取路由超时配置，无效的值被忽略
+func routeTimeoutsFromEnv() []WebServerOption {
+	var opts []WebServerOption
+	for _, config := range []struct{ group, env string }{
+		{RouteGroupDefault, routeTimeoutDefaultEnv},
+		{RouteGroupSearch, routeTimeoutSearchEnv},
+	} {
+		group, env := config.group, config.env
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		if timeout, err := time.ParseDuration(value); err == nil && timeout >= 0 {
+			opts = append(opts, WithRouteTimeout(group, timeout))
+		} else {
+			log.Printf("无效的%s: %s", env, value)
+		}
+	}
+	return opts
+}
+
+// deadlineHandler 为请求上下文设置所属路由分组的超时，并把连接的写超时延长到请求超时之后
+// 处理函数把上下文传给查询，超时后查询停止并返回504；处理函数没有写出响应时由这里返回504
+// 不设超时的路由清除服务器的写超时，由处理函数自行管理
+func (ws *WebServer) deadlineHandler(pattern string, next http.Handler) http.Handler {
+	timeout := ws.routeTimeouts[routeGroup(pattern)]
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		if timeout == 0 {
+			rc.SetWriteDeadline(time.Time{})
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		rc.SetWriteDeadline(time.Now().Add(timeout + deadlineWriteGrace))
+
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		if ctx.Err() == context.DeadlineExceeded && rec.statusCode == 0 && rec.bytes == 0 {
+			ws.sendTimeout(w, r, timeout)
+		}
+	})
+}
+
+// sendTimeout 返回504，API路由使用APIResponse格式，其他路由使用LogViewResponse格式
+func (ws *WebServer) sendTimeout(w http.ResponseWriter, r *http.Request, timeout time.Duration) {
+	message := fmt.Sprintf("请求超过 %v 未完成", timeout)
+	if strings.HasPrefix(r.URL.Path, "/api/v1/") {
+		NewAPIServer(ws).sendErrorResponseWithCode(w, message, http.StatusGatewayTimeout, aggregate.CodeTimeout)
+		return
+	}
+	ws.sendJSONError(w, http.StatusGatewayTimeout, message)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// delayedStore 查询前等待delay的LogStore，等待期间ctx超时则返回ctx的错误
+type delayedStore struct {
+	aggregate.LogStore
+	delay time.Duration
+}
+
+func (ds *delayedStore) Query(ctx context.Context, query aggregate.LogQuery) (*aggregate.LogQueryResult, error) {
+	select {
+	case <-time.After(ds.delay):
+		return ds.LogStore.Query(ctx, query)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestRouteDeadline(t *testing.T) {
+	logDir := t.TempDir()
+	var content strings.Builder
+	for i := 0; i < 3; i++ {
+		fmt.Fprintf(&content, `{"timestamp":"2024-01-15T10:30:0%dZ","level":"info","msg":"export me","trace_id":"trace-1"}`+"\n", i)
+	}
+	if err := os.WriteFile(filepath.Join(logDir, "app.log"), []byte(content.String()), 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+	store := &delayedStore{LogStore: aggregate.NewDirStore(logDir), delay: 300 * time.Millisecond}
+	ws := NewWebServer(logDir, "8080", WithLogStore(store), WithRouteTimeout(RouteGroupSearch, 50*time.Millisecond))
+	defer close(ws.shutdownCh)
+	handler := ws.routes()
+
+	// 查询在路由超时时停止，返回504和JSON响应体
+	start := time.Now()
+	status, response := doAPI(t, handler, "POST", "/api/v1/logs/search", `{"message":"export"}`)
+	if status != http.StatusGatewayTimeout || response.ErrorCode != aggregate.CodeTimeout || response.Success {
+		t.Errorf("期望 504 和 %s，得到 %d %+v", aggregate.CodeTimeout, status, response)
+	}
+	if elapsed := time.Since(start); elapsed >= store.delay {
+		t.Errorf("期望查询在路由超时时停止，耗时 %v", elapsed)
+	}
+	status, response = doAPI(t, handler, "GET", "/api/v1/logs/trace/trace-1", "")
+	if status != http.StatusGatewayTimeout || response.ErrorCode != aggregate.CodeTimeout {
+		t.Errorf("期望 504 和 %s，得到 %d %+v", aggregate.CodeTimeout, status, response)
+	}
+
+	// 导出不设超时，可以超过查询的路由超时
+	w := serve(handler, exportPath+"?trace_id=trace-1", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("期望导出状态码 200，得到 %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Header().Get("Content-Disposition"), "attachment") {
+		t.Errorf("期望以附件下载，得到 %q", w.Header().Get("Content-Disposition"))
+	}
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("期望导出 3 行，得到 %d: %s", len(lines), w.Body.String())
+	}
+	var first aggregate.LogEntry
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil || first.Timestamp != "2024-01-15T10:30:00Z" {
+		t.Errorf("期望按时间升序导出，得到 %s (%v)", lines[0], err)
+	}
+}
+
+func TestFileContentDeadline(t *testing.T) {
+	logDir := t.TempDir()
+	line := `{"timestamp":"2024-01-15T10:30:00Z","level":"info","msg":"line"}` + "\n"
+	if err := os.WriteFile(filepath.Join(logDir, "big.log"), []byte(strings.Repeat(line, 2*contentCtxCheckInterval)), 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+	ws := NewWebServer(logDir, "8080", WithRouteTimeout(RouteGroupSearch, time.Nanosecond))
+	defer close(ws.shutdownCh)
+	handler := ws.routes()
+
+	status, response := doAPI(t, handler, "GET", "/api/v1/files/content/big.log", "")
+	if status != http.StatusGatewayTimeout || !strings.Contains(response.Error, context.DeadlineExceeded.Error()) {
+		t.Errorf("期望读取文件内容在超时后停止并返回504，得到 %d %+v", status, response)
+	}
+	// 文件列表属于默认分组，不受查询超时影响
+	if w := serve(handler, "/api/v1/files", nil); w.Code != http.StatusOK {
+		t.Errorf("期望文件列表状态码 200，得到 %d", w.Code)
+	}
+}
+
+func TestDeadlineHandler(t *testing.T) {
+	t.Setenv(routeTimeoutSearchEnv, "2s")
+	t.Setenv(routeTimeoutDefaultEnv, "soon")
+	logs := captureLog(t)
+	ws := NewWebServer(t.TempDir(), "8080", routeTimeoutsFromEnv()...)
+	defer close(ws.shutdownCh)
+	if !strings.Contains(logs.String(), "无效的"+routeTimeoutDefaultEnv) {
+		t.Errorf("期望记录无效的配置，得到 %s", logs.String())
+	}
+
+	// 每个路由的上下文带有所属分组的超时，日志流和导出没有超时
+	for pattern, want := range map[string]time.Duration{
+		"/api/v1/stats":       defaultRouteTimeout,
+		"/api/v1/logs/search": 2 * time.Second,
+		streamPath:            0,
+		exportPath:            0,
+	} {
+		var got time.Duration
+		handler := ws.deadlineHandler(pattern, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if deadline, ok := r.Context().Deadline(); ok {
+				got = time.Until(deadline)
+			}
+		}))
+		serve(handler, pattern, nil)
+		if got > want || (want > 0 && got < want-time.Second) {
+			t.Errorf("%s: 期望超时 %v，得到 %v", pattern, want, got)
+		}
+	}
+
+	// 处理函数超时后没有写出响应时返回504
+	ws.routeTimeouts[RouteGroupDefault] = 10 * time.Millisecond
+	blocking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	status, response := doAPI(t, ws.deadlineHandler("/api/v1/stats", blocking), "GET", "/api/v1/stats", "")
+	if status != http.StatusGatewayTimeout || response.ErrorCode != aggregate.CodeTimeout || response.Timestamp.IsZero() {
+		t.Errorf("期望 504 和 %s，得到 %d %+v", aggregate.CodeTimeout, status, response)
+	}
+	w := httptest.NewRecorder()
+	ws.deadlineHandler("/api/files", blocking).ServeHTTP(w, httptest.NewRequest("GET", "/api/files", nil))
+	var legacy LogViewResponse
+	if err := json.NewDecoder(w.Body).Decode(&legacy); err != nil || w.Code != http.StatusGatewayTimeout || legacy.Success {
+		t.Errorf("期望旧接口返回504的LogViewResponse，得到 %d %+v (%v)", w.Code, legacy, err)
+	}
+}
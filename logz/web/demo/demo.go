@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/HsiaoL1/trace/logz"
+	"github.com/HsiaoL1/trace/logz/aggregate"
 )
 
 func main() {
@@ -18,7 +19,7 @@ func main() {
 	}
 
 	// 初始化带聚合功能的日志系统
-	err := logz.InitWithAggregation(
+	err := aggregate.InitWithAggregation(
 		filepath.Join(logDir, "demo.log"), // 日志文件
 		logDir,                            // 聚合目录
 		"demo-service",                    // 服务名
@@ -28,7 +29,7 @@ func main() {
 	if err != nil {
 		log.Fatal("初始化日志系统失败:", err)
 	}
-	defer logz.CloseAggregator()
+	defer aggregate.CloseAggregator()
 
 	fmt.Println("开始生成测试日志...")
 	fmt.Println("日志目录:", logDir)
@@ -0,0 +1,51 @@
+//go:build !windows
+
+package main
+
+import (
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz"
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+func TestDiskFullWriteAndHealth(t *testing.T) {
+	logz.SetEmailConfig(&logz.EmailConfig{Enabled: false})
+	t.Cleanup(func() { logz.SetEmailConfig(&logz.EmailConfig{Throttle: 5 * time.Minute}) })
+
+	// 阈值大于任何磁盘的可用空间，启动后的第一次检查即进入full阶段
+	dir := t.TempDir()
+	aggregator, err := aggregate.NewLogAggregatorWithOptions(dir, "disk-test",
+		aggregate.WithDiskGuard(aggregate.DiskGuard{MinFreeBytes: math.MaxUint64, CheckInterval: time.Hour}))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+	aggregate.SetGlobalAggregator(aggregator)
+	defer aggregate.SetGlobalAggregator(nil)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for aggregator.Health().DiskStage != aggregate.DiskFull.String() {
+		if time.Now().After(deadline) {
+			t.Fatalf("等待进入full阶段超时，当前 %q", aggregator.Health().DiskStage)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	handler := NewWebServer(dir, "8080").routes()
+	status, response := doAPI(t, handler, "POST", "/api/v1/logs/write", `{"level":"error","message":"no space"}`)
+	if status != http.StatusInsufficientStorage || response.ErrorCode != aggregate.CodeDiskFull {
+		t.Errorf("期望状态码 507 和 %s，得到 %d %q", aggregate.CodeDiskFull, status, response.ErrorCode)
+	}
+
+	status, response = doAPI(t, handler, "GET", "/api/v1/health", "")
+	data, _ := response.Data.(map[string]interface{})
+	checks, _ := data["checks"].(map[string]interface{})
+	disk, _ := checks["disk"].(map[string]interface{})
+	if status != http.StatusOK || data["status"] != "degraded" || disk["status"] != "full" {
+		t.Errorf("期望磁盘检查为full且服务降级，得到 %d %v", status, data)
+	}
+}
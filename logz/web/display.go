@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// displayTimeLayout display_time字段的格式
+const displayTimeLayout = "2006-01-02 15:04:05.000 MST"
+
+// displayEntry 带有按请求时区格式化时间和追踪界面链接的日志条目
+type displayEntry struct {
+	aggregate.LogEntry
+	DisplayTime string `json:"display_time,omitempty"` // 时间戳无法解析时为空
+	TraceURL    string `json:"trace_url,omitempty"`    // 未配置链接模板或条目没有TraceID时为空
+	Source      string `json:"source,omitempty"`       // 联合查询时条目来自的远程服务
+}
+
+// MarshalJSON 在条目的字段之后追加display_time、trace_url和source，logz.LogEntry实现了MarshalJSON，嵌入后不会自动序列化其他字段
+func (e displayEntry) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(e.LogEntry)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range []struct{ name, value string }{{"display_time", e.DisplayTime}, {"trace_url", e.TraceURL}, {"source", e.Source}} {
+		if field.value == "" {
+			continue
+		}
+		value, err := json.Marshal(field.value)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data[:len(data)-1], `,"`+field.name+`":`...)
+		data = append(data, value...)
+		data = append(data, '}')
+	}
+	return data, nil
+}
+
+// displayQueryResult 条目带有display_time或trace_url的查询结果，其他字段与logz.LogQueryResult相同
+type displayQueryResult struct {
+	*aggregate.LogQueryResult
+	Entries []displayEntry `json:"entries"`
+}
+
+// parseTimezoneParam 解析tz查询参数（IANA时区名），未设置时返回nil
+func parseTimezoneParam(r *http.Request) (*time.Location, error) {
+	name := r.URL.Query().Get("tz")
+	if name == "" {
+		return nil, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tz: %s", name)
+	}
+	return loc, nil
+}
+
+// displayResult loc不为nil时为每个条目添加按loc格式化的display_time，配置了链接模板时添加trace_url，
+// 都不需要时原样返回result
+func (ws *WebServer) displayResult(result *aggregate.LogQueryResult, loc *time.Location) any {
+	if loc == nil && !ws.traceLinks.enabled() {
+		return result
+	}
+	entries := make([]displayEntry, len(result.Entries))
+	for i, entry := range result.Entries {
+		entries[i] = displayEntry{LogEntry: entry, TraceURL: ws.traceLinks.url(entry)}
+		if loc == nil {
+			continue
+		}
+		if t, err := time.Parse(time.RFC3339Nano, entry.Timestamp); err == nil {
+			entries[i].DisplayTime = t.In(loc).Format(displayTimeLayout)
+		}
+	}
+	return displayQueryResult{LogQueryResult: result, Entries: entries}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// doAPI 调用接口，返回状态码和响应
+func doAPI(t *testing.T, handler http.Handler, method, path, body string) (int, APIResponse) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var response APIResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	return w.Code, response
+}
+
+func TestQueryErrorStatus(t *testing.T) {
+	aggregate.SetGlobalAggregator(nil)
+	dir := t.TempDir()
+	writeDashboardFixture(t, dir)
+	handler := NewWebServer(dir, "8080").routes()
+	missingHandler := NewWebServer(filepath.Join(dir, "missing"), "8080").routes()
+	noFallbackHandler := NewWebServer(dir, "8080", WithWriteFallback(aggregate.FallbackNone)).routes()
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		method  string
+		path    string
+		body    string
+		status  int
+		code    string
+	}{
+		{"无效的正则", handler, "POST", "/api/v1/logs/search", `{"message":"("}`, http.StatusBadRequest, aggregate.CodeInvalidQuery},
+		{"强制使用索引但没有聚合器", handler, "POST", "/api/v1/logs/search", `{"trace_id":"trace-a","require_index":true}`, http.StatusServiceUnavailable, aggregate.CodeIndexUnavailable},
+		{"日志目录不存在", missingHandler, "GET", "/api/v1/logs/trace/trace-a", "", http.StatusNotFound, aggregate.CodeLogDirNotFound},
+		{"分组时日志目录不存在", missingHandler, "GET", "/api/v1/errors/grouped", "", http.StatusNotFound, aggregate.CodeLogDirNotFound},
+		{"清理时日志目录不存在", missingHandler, "POST", "/api/v1/maintenance/cleanup?dry_run=true", "", http.StatusNotFound, aggregate.CodeLogDirNotFound},
+		{"写入时没有聚合器", noFallbackHandler, "POST", "/api/v1/logs/write", `{"level":"info","message":"dropped"}`, http.StatusServiceUnavailable, aggregate.CodeNoAggregator},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, response := doAPI(t, tt.handler, tt.method, tt.path, tt.body)
+			if status != tt.status || response.Code != tt.status {
+				t.Errorf("期望状态码 %d，得到 %d（%s）", tt.status, status, response.Error)
+			}
+			if response.ErrorCode != tt.code {
+				t.Errorf("期望错误码 %s，得到 %q", tt.code, response.ErrorCode)
+			}
+		})
+	}
+
+	// 正常查询不返回错误码
+	status, response := doAPI(t, handler, "GET", "/api/v1/logs/trace/trace-a", "")
+	if status != http.StatusOK || response.ErrorCode != "" {
+		t.Errorf("期望状态码 200 且没有错误码，得到 %d %q", status, response.ErrorCode)
+	}
+}
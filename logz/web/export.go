@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// exportPath 导出日志的端点，导出大量日志可能超过路由超时，属于RouteGroupStream
+const exportPath = "/api/v1/logs/export"
+
+// 导出的条目数上限和刷新间隔
+const (
+	maxExportEntries    = 100000
+	exportFlushInterval = 1000 // 每写出多少条刷新一次，客户端可以边下载边处理
+)
+
+// handleLogExport 按条件导出日志为JSON Lines，每行一条，默认按时间升序排列
+// 支持trace_id、span_id、level、service、hostname、message、start_time、end_time、since、until、sort_order、limit和filename参数，
+// 最多导出maxExportEntries条，还有更多匹配条目时响应头X-Export-Truncated为true
+func (api *APIServer) handleLogExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		api.sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	params := r.URL.Query()
+	level, err := parseLevelParam(params.Get("level"))
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	start, end, err := parseTimeRangeParams(params, nil)
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := maxExportEntries
+	if l, err := strconv.Atoi(params.Get("limit")); err == nil && l > 0 && l < maxExportEntries {
+		limit = l
+	}
+
+	query := aggregate.LogQuery{
+		TraceID:   params.Get("trace_id"),
+		SpanID:    params.Get("span_id"),
+		Level:     level,
+		Service:   params.Get("service"),
+		Hostname:  params.Get("hostname"),
+		Message:   params.Get("message"),
+		StartTime: start,
+		EndTime:   end,
+		Limit:     limit,
+		SortOrder: params.Get("sort_order"),
+	}
+	result, err := api.ws.queryLogs(r.Context(), query)
+	if err != nil {
+		api.sendQueryError(w, err)
+		return
+	}
+
+	// 文件名包含服务名和时间范围，没有结束时间时使用导出的时间
+	if end.IsZero() {
+		end = time.Now()
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	setAttachment(w, requestedFilename(r, attachmentName(query.Service, start, end, "jsonl"), "jsonl"))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if result.Total > len(result.Entries) {
+		w.Header().Set("X-Export-Truncated", "true")
+	}
+
+	rc := http.NewResponseController(w)
+	encoder := json.NewEncoder(w)
+	for i := range result.Entries {
+		if err := encoder.Encode(&result.Entries[i]); err != nil {
+			return // 客户端断开
+		}
+		if (i+1)%exportFlushInterval == 0 {
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+	rc.Flush()
+}
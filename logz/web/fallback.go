@@ -0,0 +1,28 @@
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// writeFallbackEnv 没有全局聚合器时写入接口的处理方式：file（默认）、logger或none
+const writeFallbackEnv = "WRITE_FALLBACK"
+
+// receivedDir 备用文件模式下写入的子目录，文件列表和查询会包含该目录
+const receivedDir = "received"
+
+// WithWriteFallback 设置没有全局聚合器时写入接口的处理方式，默认为logz.FallbackFile
+func WithWriteFallback(mode aggregate.FallbackMode) WebServerOption {
+	return func(ws *WebServer) {
+		ws.writeFallback = mode
+	}
+}
+
+// writeFallbackConfig 返回写入接口使用的备用写入配置
+func (ws *WebServer) writeFallbackConfig() aggregate.WriteFallback {
+	return aggregate.WriteFallback{
+		Mode: ws.writeFallback,
+		Dir:  filepath.Join(ws.logDir, receivedDir),
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz"
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// postLogWrite 调用写入接口，返回状态码和响应数据
+func postLogWrite(t *testing.T, handler http.Handler, body string) (int, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/api/v1/logs/write", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var response APIResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	data, _ := response.Data.(map[string]interface{})
+	return w.Code, data
+}
+
+const fallbackWriteBody = `{"level":"warning","message":"from agent","trace_id":"trace-fallback","service":"agent","fields":{"attempt":2}}`
+
+func TestLogWriteFallbackFile(t *testing.T) {
+	aggregate.SetGlobalAggregator(nil)
+	dir := t.TempDir()
+	ws := NewWebServer(dir, "8080")
+	handler := ws.routes()
+
+	code, data := postLogWrite(t, handler, fallbackWriteBody)
+	if code != http.StatusOK {
+		t.Fatalf("期望状态码 200，得到 %d", code)
+	}
+	if data["destination"] != string(aggregate.WrittenToFile) {
+		t.Errorf("期望写入文件，得到 %v", data["destination"])
+	}
+
+	name := "received_" + time.Now().Format("2006-01-02") + ".log"
+	content, err := os.ReadFile(filepath.Join(dir, receivedDir, name))
+	if err != nil {
+		t.Fatalf("读取备用文件失败: %v", err)
+	}
+	var entry aggregate.LogEntry
+	if err := json.Unmarshal(bytes.TrimSpace(content), &entry); err != nil {
+		t.Fatalf("解析备用文件失败: %v", err)
+	}
+	if entry.Level != "warn" || entry.TraceID != "trace-fallback" || entry.Fields["attempt"] != float64(2) {
+		t.Errorf("备用文件内容错误: %+v", entry)
+	}
+
+	// 写入的日志可以通过文件扫描查到，也出现在文件列表中
+	result, err := ws.store.Query(t.Context(), ws.logQuery(aggregate.LogQuery{TraceID: "trace-fallback", Limit: 10}))
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if result.Total != 1 {
+		t.Errorf("期望查询到 1 条，得到 %d", result.Total)
+	}
+	files, _, err := ws.getLogFilesList(fileListOptions{})
+	if err != nil {
+		t.Fatalf("获取文件列表失败: %v", err)
+	}
+	if len(files) != 1 || files[0].Name != receivedDir+"/"+name {
+		t.Errorf("期望文件列表包含备用文件，得到 %+v", files)
+	}
+}
+
+func TestLogWriteFallbackLogger(t *testing.T) {
+	aggregate.SetGlobalAggregator(nil)
+	original := logz.GetDefaultLogger()
+	defer logz.SetDefaultLogger(original)
+	var buf bytes.Buffer
+	logz.SetDefaultLogger(logz.NewDefaultLogger(&logz.LoggerConfig{Level: "info", Format: logz.FormatJSON, Output: &buf}))
+
+	dir := t.TempDir()
+	ws := NewWebServer(dir, "8080", WithWriteFallback(aggregate.FallbackLogger))
+	code, data := postLogWrite(t, ws.routes(), fallbackWriteBody)
+	if code != http.StatusOK {
+		t.Fatalf("期望状态码 200，得到 %d", code)
+	}
+	if data["destination"] != string(aggregate.WrittenToLogger) {
+		t.Errorf("期望写入日志器，得到 %v", data["destination"])
+	}
+
+	var logged map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &logged); err != nil {
+		t.Fatalf("解析日志输出失败: %v (%q)", err, buf.String())
+	}
+	if logged["level"] != "warning" || logged["msg"] != "from agent" || logged["trace_id"] != "trace-fallback" || logged["attempt"] != float64(2) {
+		t.Errorf("日志输出错误: %v", logged)
+	}
+	if _, err := os.Stat(filepath.Join(dir, receivedDir)); !os.IsNotExist(err) {
+		t.Errorf("日志器模式不应创建备用目录: %v", err)
+	}
+}
+
+func TestLogWriteFallbackNone(t *testing.T) {
+	aggregate.SetGlobalAggregator(nil)
+	ws := NewWebServer(t.TempDir(), "8080", WithWriteFallback(aggregate.FallbackNone))
+	if code, _ := postLogWrite(t, ws.routes(), fallbackWriteBody); code != http.StatusServiceUnavailable {
+		t.Errorf("期望状态码 503，得到 %d", code)
+	}
+}
+
+func TestLogWriteWithAggregator(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := aggregate.NewLogAggregatorWithOptions(filepath.Join(dir, "aggregated"), "write-test", aggregate.WithBatchSize(1))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	aggregate.SetGlobalAggregator(aggregator)
+	defer func() {
+		aggregate.SetGlobalAggregator(nil)
+		aggregator.Close()
+	}()
+
+	// 配置了备用方式时仍写入聚合器
+	for _, mode := range []aggregate.FallbackMode{aggregate.FallbackFile, aggregate.FallbackLogger} {
+		ws := NewWebServer(dir, "8080", WithWriteFallback(mode))
+		code, data := postLogWrite(t, ws.routes(), fallbackWriteBody)
+		if code != http.StatusOK || data["destination"] != string(aggregate.WrittenToAggregator) {
+			t.Errorf("%s: 期望写入聚合器，得到 %d %v", mode, code, data["destination"])
+		}
+	}
+
+	info, err := aggregator.Describe()
+	if err != nil {
+		t.Fatalf("获取聚合器信息失败: %v", err)
+	}
+	if info.TotalEntries != 2 {
+		t.Errorf("期望聚合器写入 2 条，得到 %d", info.TotalEntries)
+	}
+	if _, err := os.Stat(filepath.Join(dir, receivedDir)); !os.IsNotExist(err) {
+		t.Errorf("有聚合器时不应写入备用目录: %v", err)
+	}
+}
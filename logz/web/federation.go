@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HsiaoL1/trace"
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// federatedSearchPath 同时查询所有远程日志服务的接口
+const federatedSearchPath = "/api/v1/federated/search"
+
+// 远程日志服务的环境变量
+const (
+	// remoteSourcesEnv 逗号分隔的"名称=地址"，如"host1=https://h1:8080,host2=https://h2:8080"
+	remoteSourcesEnv = "REMOTE_SOURCES"
+	// remoteSourceTokensEnv 逗号分隔的"名称=API密钥"，发送为Authorization: Bearer
+	remoteSourceTokensEnv = "REMOTE_SOURCE_TOKENS"
+	// remoteSourceTimeoutEnv 每个远程服务的请求超时
+	remoteSourceTimeoutEnv = "REMOTE_SOURCE_TIMEOUT"
+)
+
+// defaultRemoteSourceTimeout 远程服务的默认请求超时，小于查询路由的超时，慢的服务不会拖垮整个请求
+const defaultRemoteSourceTimeout = 10 * time.Second
+
+// 远程服务查询结果的状态
+const (
+	FederatedStatusOK    = "ok"
+	FederatedStatusError = "error"
+)
+
+// RemoteSource 联合查询的远程日志服务
+type RemoteSource struct {
+	Name    string        // 结果中条目的source
+	URL     string        // 如"https://h1:8080"
+	Token   string        // 远程服务的API密钥（需要read权限），为空时不发送
+	Timeout time.Duration // 请求超时，为0时使用默认的10秒
+}
+
+// remoteSource 配置好的远程服务
+type remoteSource struct {
+	RemoteSource
+	client *trace.TracedHTTPClient
+}
+
+// WithRemoteSource 添加联合查询的远程日志服务，名称为空、重复或地址不是http(s) URL时记录日志后忽略
+func WithRemoteSource(source RemoteSource) WebServerOption {
+	return func(ws *WebServer) {
+		source.Name = strings.TrimSpace(source.Name)
+		source.URL = strings.TrimRight(strings.TrimSpace(source.URL), "/")
+		if source.Name == "" || slices.ContainsFunc(ws.remotes, func(r *remoteSource) bool { return r.Name == source.Name }) {
+			log.Printf("无效的远程日志服务: 名称为空或重复: %q", source.Name)
+			return
+		}
+		if parsed, err := url.Parse(source.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			log.Printf("无效的远程日志服务地址: %s=%s", source.Name, source.URL)
+			return
+		}
+		if source.Timeout <= 0 {
+			source.Timeout = defaultRemoteSourceTimeout
+		}
+		ws.remotes = append(ws.remotes, &remoteSource{RemoteSource: source, client: trace.NewTracedHTTPClient(source.Timeout)})
+	}
+}
+
+// parseNamedList 解析逗号分隔的"名称=值"，保持配置的顺序
+func parseNamedList(value string) ([][2]string, error) {
+	var items [][2]string
+	for _, item := range splitList(value) {
+		name, itemValue, ok := strings.Cut(item, "=")
+		name, itemValue = strings.TrimSpace(name), strings.TrimSpace(itemValue)
+		if !ok || name == "" || itemValue == "" {
+			return nil, fmt.Errorf("格式应为名称=值: %s", item)
+		}
+		items = append(items, [2]string{name, itemValue})
+	}
+	return items, nil
+}
+
+// remoteSourceOptionsFromEnv 从环境变量读取远程日志服务
+func remoteSourceOptionsFromEnv() []WebServerOption {
+	value := os.Getenv(remoteSourcesEnv)
+	if value == "" {
+		return nil
+	}
+	sources, err := parseNamedList(value)
+	if err != nil {
+		log.Printf("无效的%s: %v", remoteSourcesEnv, err)
+		return nil
+	}
+	tokens := make(map[string]string)
+	if value := os.Getenv(remoteSourceTokensEnv); value != "" {
+		items, err := parseNamedList(value)
+		if err != nil {
+			// 错误信息中可能包含密钥，不输出原始内容
+			log.Printf("无效的%s", remoteSourceTokensEnv)
+		}
+		for _, item := range items {
+			tokens[item[0]] = item[1]
+		}
+	}
+	var timeout time.Duration
+	if value := os.Getenv(remoteSourceTimeoutEnv); value != "" {
+		if timeout, err = time.ParseDuration(value); err != nil || timeout <= 0 {
+			log.Printf("无效的%s: %s", remoteSourceTimeoutEnv, value)
+			timeout = 0
+		}
+	}
+
+	opts := make([]WebServerOption, 0, len(sources))
+	for _, source := range sources {
+		opts = append(opts, WithRemoteSource(RemoteSource{Name: source[0], URL: source[1], Token: tokens[source[0]], Timeout: timeout}))
+	}
+	return opts
+}
+
+// FederatedSourceResult 一个远程服务的查询情况
+type FederatedSourceResult struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`          // ok或error
+	Total      int    `json:"total"`           // 远程服务匹配的条目数
+	Returned   int    `json:"returned"`        // 远程服务返回的条目数
+	Duration   string `json:"duration"`        // 请求耗时
+	Error      string `json:"error,omitempty"` // 请求失败的原因
+	ErrorCode  string `json:"error_code,omitempty"`
+	StatusCode int    `json:"status_code,omitempty"` // 远程服务返回的非200状态码
+}
+
+// federatedEntry 远程服务返回的条目
+type federatedEntry struct {
+	entry  aggregate.LogEntry
+	source int // 在remotes中的位置
+	time   time.Time
+	valid  bool // 时间戳可以解析
+}
+
+// federatedRemoteResult 一个远程服务的查询结果
+type federatedRemoteResult struct {
+	entries []aggregate.LogEntry
+	source  FederatedSourceResult
+}
+
+// handleFederatedSearch 将查询转发给所有远程日志服务的/api/v1/logs/search，按时间戳合并结果
+// POST的请求体与/api/v1/logs/search相同，GET使用同名的查询参数；每个远程服务返回offset+limit条（不超过maxSearchLimit），
+// 合并排序后取offset开始的limit条。单个远程服务失败时在sources中返回错误，partial为true，不影响其他服务的结果
+func (api *APIServer) handleFederatedSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		api.sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if len(api.ws.remotes) == 0 {
+		api.sendErrorResponseWithCode(w, "no remote sources configured", http.StatusServiceUnavailable, "no_remote_sources")
+		return
+	}
+	loc, err := parseTimezoneParam(r)
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req, err := parseFederatedRequest(r, loc)
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	start := time.Now()
+	results := api.ws.queryRemotes(r.Context(), req)
+
+	var entries []federatedEntry
+	sources := make([]FederatedSourceResult, len(results))
+	total, partial := 0, false
+	for i, result := range results {
+		sources[i] = result.source
+		if result.source.Status != FederatedStatusOK {
+			partial = true
+			continue
+		}
+		total += result.source.Total
+		for _, entry := range result.entries {
+			t, err := time.Parse(time.RFC3339Nano, entry.Timestamp)
+			entries = append(entries, federatedEntry{entry: entry, source: i, time: t, valid: err == nil})
+		}
+	}
+	page := mergeFederatedEntries(entries, strings.EqualFold(req.SortOrder, aggregate.SortDesc), req.Offset, req.Limit)
+
+	display := make([]displayEntry, len(page))
+	for i, item := range page {
+		display[i] = api.ws.federatedDisplayEntry(item.entry, api.ws.remotes[item.source].Name, loc)
+	}
+	api.sendSuccessResponse(w, map[string]interface{}{
+		"entries":  display,
+		"total":    total,
+		"limit":    req.Limit,
+		"offset":   req.Offset,
+		"sources":  sources,
+		"partial":  partial,
+		"duration": time.Since(start).String(),
+	})
+}
+
+// parseFederatedRequest 读取POST的请求体或GET的查询参数，相对时间在本地解析后转发，所有远程服务使用相同的时间范围
+func parseFederatedRequest(r *http.Request, loc *time.Location) (LogQueryRequest, error) {
+	var req LogQueryRequest
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(nil, r.Body, 1<<20)
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return req, fmt.Errorf("Invalid JSON format")
+		}
+	} else {
+		params := r.URL.Query()
+		req = LogQueryRequest{
+			TraceID:   params.Get("trace_id"),
+			SpanID:    params.Get("span_id"),
+			Level:     params.Get("level"),
+			Service:   params.Get("service"),
+			Hostname:  params.Get("hostname"),
+			Message:   params.Get("message"),
+			SortOrder: params.Get("sort_order"),
+		}
+		req.Limit, _ = strconv.Atoi(params.Get("limit"))
+		req.Offset, _ = strconv.Atoi(params.Get("offset"))
+		req.HasStack, _ = strconv.ParseBool(params.Get("has_stack"))
+		req.UseIndex, _ = strconv.ParseBool(params.Get("use_index"))
+		var err error
+		if req.StartTime, req.EndTime, err = parseTimeRangeParams(params, loc); err != nil {
+			return req, err
+		}
+	}
+	if req.QueryID != "" {
+		return req, fmt.Errorf("query_id is not supported by federated search")
+	}
+	if req.Limit <= 0 || req.Limit > maxSearchLimit {
+		req.Limit = 100
+	}
+	req.Offset = max(req.Offset, 0)
+	// 远程服务返回前offset+limit条，超过其每页上限时会被重置为默认条数，结果不完整
+	if req.Offset+req.Limit > maxSearchLimit {
+		return req, fmt.Errorf("offset+limit must not exceed %d for federated search", maxSearchLimit)
+	}
+
+	var err error
+	if req.StartTime, req.EndTime, err = resolveTimeRange(req.StartTime, req.EndTime, req.Since, req.Until, loc); err != nil {
+		return req, err
+	}
+	if req.Level, err = parseLevelParam(req.Level); err != nil {
+		return req, err
+	}
+	req.Since, req.Until = "", ""
+	return req, nil
+}
+
+// queryRemotes 并发查询所有远程服务，结果与remotes的顺序相同
+// 每个远程服务返回前offset+limit条，不使用缓存和执行过程
+func (ws *WebServer) queryRemotes(ctx context.Context, req LogQueryRequest) []federatedRemoteResult {
+	forwarded := req
+	forwarded.Limit = req.Offset + req.Limit
+	forwarded.Offset = 0
+	forwarded.Cache = false
+	forwarded.Explain = false
+	body, marshalErr := json.Marshal(forwarded)
+
+	results := make([]federatedRemoteResult, len(ws.remotes))
+	var wg sync.WaitGroup
+	for i, remote := range ws.remotes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			source := FederatedSourceResult{Name: remote.Name, Status: FederatedStatusOK}
+			entries, err := []aggregate.LogEntry(nil), marshalErr
+			if err == nil {
+				entries, source.Total, source.StatusCode, source.ErrorCode, err = remote.search(ctx, body)
+			}
+			if err != nil {
+				source.Status = FederatedStatusError
+				source.Error = err.Error()
+				entries = nil
+			}
+			source.Returned = len(entries)
+			source.Duration = time.Since(start).String()
+			results[i] = federatedRemoteResult{entries: entries, source: source}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// search 调用远程服务的/api/v1/logs/search，返回条目、匹配总数，以及失败时远程服务返回的状态码和错误码
+func (s *remoteSource) search(ctx context.Context, body []byte) ([]aggregate.LogEntry, int, int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL+"/api/v1/logs/search", bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	resp, err := s.client.Do(ctx, req)
+	if err != nil {
+		return nil, 0, 0, "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Success   bool   `json:"success"`
+		Error     string `json:"error"`
+		ErrorCode string `json:"error_code"`
+		Data      struct {
+			Result struct {
+				Entries []aggregate.LogEntry `json:"entries"`
+				Total   int                  `json:"total"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&response)
+	if resp.StatusCode != http.StatusOK {
+		message := http.StatusText(resp.StatusCode)
+		if decodeErr == nil && response.Error != "" {
+			message = response.Error
+		}
+		return nil, 0, resp.StatusCode, response.ErrorCode, fmt.Errorf("remote returned %d: %s", resp.StatusCode, message)
+	}
+	if decodeErr != nil {
+		return nil, 0, 0, "", fmt.Errorf("invalid response: %w", decodeErr)
+	}
+	if !response.Success {
+		return nil, 0, 0, response.ErrorCode, fmt.Errorf("remote returned error: %s", response.Error)
+	}
+	return response.Data.Result.Entries, response.Data.Result.Total, 0, "", nil
+}
+
+// mergeFederatedEntries 按时间戳排序后返回offset开始的limit条
+// 时间戳相同时按远程服务的配置顺序和远程返回的顺序排列，无法解析时间戳的条目排在最后
+func mergeFederatedEntries(entries []federatedEntry, desc bool, offset, limit int) []federatedEntry {
+	slices.SortStableFunc(entries, func(a, b federatedEntry) int {
+		switch {
+		case a.valid != b.valid:
+			if a.valid {
+				return -1
+			}
+			return 1
+		case !a.valid || a.time.Equal(b.time):
+			return a.source - b.source
+		case desc:
+			return b.time.Compare(a.time)
+		}
+		return a.time.Compare(b.time)
+	})
+	if offset >= len(entries) {
+		return nil
+	}
+	entries = entries[offset:]
+	return entries[:min(limit, len(entries))]
+}
+
+// federatedDisplayEntry 为远程条目添加source、本地的追踪链接和display_time
+// 远程服务添加的同名字段（解析后在Extra中）被本地的值替换
+func (ws *WebServer) federatedDisplayEntry(entry aggregate.LogEntry, source string, loc *time.Location) displayEntry {
+	if len(entry.Extra) > 0 {
+		extra := make(map[string]json.RawMessage, len(entry.Extra))
+		for key, value := range entry.Extra {
+			extra[key] = value
+		}
+		delete(extra, "source")
+		delete(extra, "display_time")
+		entry.Extra = extra
+	}
+	display := displayEntry{LogEntry: entry, Source: source, TraceURL: ws.traceLinks.url(entry)}
+	if display.TraceURL != "" {
+		delete(display.Extra, "trace_url")
+	}
+	if loc != nil {
+		if t, err := time.Parse(time.RFC3339Nano, entry.Timestamp); err == nil {
+			display.DisplayTime = t.In(loc).Format(displayTimeLayout)
+		}
+	}
+	return display
+}
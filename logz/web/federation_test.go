@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// cannedSearchBackend 返回固定查询结果（按时间升序）的远程日志服务，检查Authorization请求头并记录收到的查询
+func cannedSearchBackend(t *testing.T, entries []aggregate.LogEntry, total int, token string, received *LogQueryRequest) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/logs/search" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		if token != "" && r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(APIResponse{Error: "Invalid or missing API key", Code: http.StatusUnauthorized})
+			return
+		}
+		json.NewDecoder(r.Body).Decode(received)
+		result := slices.Clone(entries)
+		if received.SortOrder == "desc" {
+			slices.Reverse(result)
+		}
+		json.NewEncoder(w).Encode(APIResponse{Success: true, Data: map[string]any{
+			"result": aggregate.LogQueryResult{Entries: result[:min(received.Limit, len(result))], Total: total},
+		}})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// federatedResponse 联合查询的响应
+type federatedResponse struct {
+	Entries []struct {
+		Timestamp string `json:"timestamp"`
+		Message   string `json:"msg"`
+		Source    string `json:"source"`
+	} `json:"entries"`
+	Total   int                     `json:"total"`
+	Partial bool                    `json:"partial"`
+	Sources []FederatedSourceResult `json:"sources"`
+}
+
+func doFederated(t *testing.T, handler http.Handler, method, path, body string) federatedResponse {
+	t.Helper()
+	status, response := doAPI(t, handler, method, path, body)
+	if status != http.StatusOK || !response.Success {
+		t.Fatalf("期望联合查询成功，得到 %d %s", status, response.Error)
+	}
+	data, _ := json.Marshal(response.Data)
+	var result federatedResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatalf("解析联合查询结果失败: %v", err)
+	}
+	return result
+}
+
+func TestFederatedSearch(t *testing.T) {
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	at := func(seconds int) string {
+		return base.Add(time.Duration(seconds) * time.Second).Format(time.RFC3339Nano)
+	}
+
+	var received1, received2 LogQueryRequest
+	host1 := cannedSearchBackend(t, []aggregate.LogEntry{
+		{Timestamp: at(1), Level: "error", Message: "h1-a", TraceID: "t1"},
+		{Timestamp: at(4), Level: "error", Message: "h1-b", TraceID: "t1"},
+		{Timestamp: at(6), Level: "error", Message: "h1-c", TraceID: "t1"},
+	}, 3, "token-1", &received1)
+	host2 := cannedSearchBackend(t, []aggregate.LogEntry{
+		{Timestamp: at(2), Level: "error", Message: "h2-a", TraceID: "t1"},
+		{Timestamp: at(4), Level: "error", Message: "h2-b", TraceID: "t1"},
+		{Timestamp: at(5), Level: "error", Message: "h2-c", TraceID: "t1"},
+	}, 7, "", &received2)
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(APIResponse{Error: "query queue is full", Code: http.StatusServiceUnavailable, ErrorCode: "query_busy"})
+	}))
+	defer broken.Close()
+
+	handler := NewWebServer(t.TempDir(), "8080",
+		WithRemoteSource(RemoteSource{Name: "host1", URL: host1.URL, Token: "token-1"}),
+		WithRemoteSource(RemoteSource{Name: "host2", URL: host2.URL + "/"}),
+		WithRemoteSource(RemoteSource{Name: "broken", URL: broken.URL, Timeout: time.Second}),
+		WithRemoteSource(RemoteSource{Name: "host1", URL: broken.URL}), // 名称重复，忽略
+	).routes()
+
+	result := doFederated(t, handler, "POST", federatedSearchPath, `{"trace_id":"t1","level":"ERROR","limit":4,"offset":1,"since":"1h"}`)
+
+	// 每个远程服务返回offset+limit条，相对时间在本地解析
+	if received1.Limit != 5 || received1.Offset != 0 || received1.TraceID != "t1" || received1.Level != "error" {
+		t.Errorf("期望转发offset+limit条，得到 %+v", received1)
+	}
+	if received2.Since != "" || received2.StartTime.IsZero() {
+		t.Errorf("期望相对时间在本地解析为start_time，得到 %+v", received2)
+	}
+
+	// 按时间戳合并，相同时间按配置顺序，跳过第一条后取4条
+	var got []string
+	for _, entry := range result.Entries {
+		got = append(got, entry.Source+":"+entry.Message)
+	}
+	if want := "host2:h2-a,host1:h1-b,host2:h2-b,host2:h2-c"; strings.Join(got, ",") != want {
+		t.Errorf("期望合并顺序 %s，得到 %s", want, strings.Join(got, ","))
+	}
+	if result.Total != 10 {
+		t.Errorf("期望总数为成功的远程服务之和10，得到 %d", result.Total)
+	}
+
+	// 失败的远程服务单独报告，不影响其他结果
+	if !result.Partial || len(result.Sources) != 3 {
+		t.Fatalf("期望3个远程服务且结果不完整，得到 %+v", result.Sources)
+	}
+	failed := result.Sources[2]
+	if failed.Name != "broken" || failed.Status != FederatedStatusError || failed.StatusCode != http.StatusServiceUnavailable ||
+		failed.ErrorCode != "query_busy" || !strings.Contains(failed.Error, "query queue is full") {
+		t.Errorf("期望报告远程服务的错误，得到 %+v", failed)
+	}
+	if ok := result.Sources[0]; ok.Status != FederatedStatusOK || ok.Returned != 3 || ok.Total != 3 {
+		t.Errorf("期望host1查询成功，得到 %+v", ok)
+	}
+
+	// GET使用查询参数，sort_order=desc时最新的在前
+	result = doFederated(t, handler, "GET", federatedSearchPath+"?trace_id=t1&limit=2&sort_order=desc", "")
+	if len(result.Entries) != 2 || result.Entries[0].Message != "h1-c" || result.Entries[1].Message != "h2-c" {
+		t.Errorf("期望按时间倒序的前2条，得到 %+v", result.Entries)
+	}
+}
+
+func TestFederatedSearchErrors(t *testing.T) {
+	status, response := doAPI(t, NewWebServer(t.TempDir(), "8080").routes(), "GET", federatedSearchPath, "")
+	if status != http.StatusServiceUnavailable || response.ErrorCode != "no_remote_sources" {
+		t.Errorf("期望未配置远程服务时返回503，得到 %d %s", status, response.ErrorCode)
+	}
+
+	// 错误的密钥和无法连接的地址都只影响对应的远程服务
+	backend := cannedSearchBackend(t, nil, 0, "secret", &LogQueryRequest{})
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachable.Close()
+	handler := NewWebServer(t.TempDir(), "8080",
+		WithRemoteSource(RemoteSource{Name: "wrong-token", URL: backend.URL, Token: "wrong"}),
+		WithRemoteSource(RemoteSource{Name: "down", URL: unreachable.URL, Timeout: time.Second}),
+		WithRemoteSource(RemoteSource{Name: "invalid", URL: "ftp://example.com"}), // 不是http(s)，忽略
+	).routes()
+	result := doFederated(t, handler, "POST", federatedSearchPath, `{"message":"x"}`)
+	if !result.Partial || len(result.Sources) != 2 {
+		t.Fatalf("期望2个失败的远程服务，得到 %+v", result.Sources)
+	}
+	if result.Sources[0].StatusCode != http.StatusUnauthorized || result.Sources[1].Status != FederatedStatusError {
+		t.Errorf("期望分别报告认证失败和连接失败，得到 %+v", result.Sources)
+	}
+
+	if status, _ := doAPI(t, handler, "POST", federatedSearchPath, `{"query_id":"abc"}`); status != http.StatusBadRequest {
+		t.Errorf("期望不支持query_id，得到 %d", status)
+	}
+	if status, _ := doAPI(t, handler, "GET", federatedSearchPath+"?level=loud", ""); status != http.StatusBadRequest {
+		t.Errorf("期望无效级别返回400，得到 %d", status)
+	}
+
+	// 远程服务每页最多返回10000条，offset+limit超过时无法取得完整的页
+	if status, _ := doAPI(t, handler, "POST", federatedSearchPath, `{"offset":10050,"limit":50}`); status != http.StatusBadRequest {
+		t.Errorf("期望offset+limit超过10000时返回400，得到 %d", status)
+	}
+	if status, _ := doAPI(t, handler, "GET", federatedSearchPath+"?offset=9999&limit=2", ""); status != http.StatusBadRequest {
+		t.Errorf("期望offset+limit超过10000时返回400，得到 %d", status)
+	}
+	if status, _ := doAPI(t, handler, "GET", federatedSearchPath+"?offset=9990&limit=10", ""); status != http.StatusOK {
+		t.Errorf("期望offset+limit不超过10000时正常查询，得到 %d", status)
+	}
+}
+
+func TestParseRemoteSources(t *testing.T) {
+	t.Setenv(remoteSourcesEnv, "host1=https://h1:8080, host2=http://h2:8080")
+	t.Setenv(remoteSourceTokensEnv, "host2=tok-2")
+	t.Setenv(remoteSourceTimeoutEnv, "3s")
+	ws := NewWebServer(t.TempDir(), "8080", remoteSourceOptionsFromEnv()...)
+	if len(ws.remotes) != 2 || ws.remotes[0].Name != "host1" || ws.remotes[0].Token != "" ||
+		ws.remotes[1].URL != "http://h2:8080" || ws.remotes[1].Token != "tok-2" || ws.remotes[1].Timeout != 3*time.Second {
+		t.Errorf("期望解析两个远程服务，得到 %+v %+v", ws.remotes[0].RemoteSource, ws.remotes[len(ws.remotes)-1].RemoteSource)
+	}
+	if _, err := parseNamedList("host1"); err == nil {
+		t.Error("期望拒绝没有=的条目")
+	}
+}
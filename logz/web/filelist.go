@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fileListPatternsEnv 只用于文件列表的匹配模式，逗号分隔
+const fileListPatternsEnv = "FILE_LIST_PATTERNS"
+
+// 文件列表的排序字段
+const (
+	fileSortName  = "name"
+	fileSortSize  = "size"
+	fileSortMTime = "mtime"
+)
+
+// 文件修改时间的分组，用于界面按时间分组显示
+const (
+	FileAgeToday    = "today"     // 今天修改
+	FileAgeThisWeek = "this_week" // 本周（周一起）修改
+	FileAgeOlder    = "older"     // 更早
+)
+
+// WithFileListPatterns 设置文件列表使用的匹配模式，不影响日志查询
+// 未设置时使用WithFilePatterns的模式，都未设置时为"*.log*"
+func WithFileListPatterns(patterns ...string) WebServerOption {
+	return func(ws *WebServer) {
+		ws.listPatterns = append(ws.listPatterns, patterns...)
+	}
+}
+
+// fileListOptions 文件列表的排序、过滤和分页参数，零值返回按名称升序排列的所有文件
+type fileListOptions struct {
+	sort       string // name、size或mtime
+	desc       bool
+	query      string // 文件名包含的子串（忽略大小写）
+	compressed *bool  // 只返回压缩或未压缩的文件，nil时不过滤
+	limit      int    // 0表示不限制
+	offset     int
+}
+
+// parseFileListOptions 读取sort、order、q、compressed、limit和offset参数
+func parseFileListOptions(params url.Values) (fileListOptions, error) {
+	opts := fileListOptions{sort: fileSortName, query: strings.TrimSpace(params.Get("q"))}
+
+	switch value := strings.ToLower(params.Get("sort")); value {
+	case "":
+	case fileSortName, fileSortSize, fileSortMTime:
+		opts.sort = value
+	default:
+		return opts, fmt.Errorf("sort must be one of name, size, mtime")
+	}
+	switch strings.ToLower(params.Get("order")) {
+	case "", "asc":
+	case "desc":
+		opts.desc = true
+	default:
+		return opts, fmt.Errorf("order must be asc or desc")
+	}
+	if value := params.Get("compressed"); value != "" {
+		compressed, err := strconv.ParseBool(value)
+		if err != nil {
+			return opts, fmt.Errorf("compressed must be a boolean")
+		}
+		opts.compressed = &compressed
+	}
+	for name, target := range map[string]*int{"limit": &opts.limit, "offset": &opts.offset} {
+		if value := params.Get(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return opts, fmt.Errorf("%s must be a non-negative integer", name)
+			}
+			*target = n
+		}
+	}
+	return opts, nil
+}
+
+// apply 过滤、排序并分页，返回当前页和过滤后的总数
+// 排序是稳定的，值相同的文件按名称排列，分页结果在文件不变时前后一致
+func (opts fileListOptions) apply(files []FileInfo) ([]FileInfo, int) {
+	query := strings.ToLower(opts.query)
+	filtered := files[:0:0]
+	for _, file := range files {
+		if query != "" && !strings.Contains(strings.ToLower(file.Name), query) {
+			continue
+		}
+		if opts.compressed != nil && file.IsCompressed != *opts.compressed {
+			continue
+		}
+		filtered = append(filtered, file)
+	}
+
+	sort.SliceStable(filtered, func(i, j int) bool {
+		a, b := filtered[i], filtered[j]
+		if opts.desc {
+			a, b = b, a
+		}
+		switch opts.sort {
+		case fileSortSize:
+			if a.Size != b.Size {
+				return a.Size < b.Size
+			}
+		case fileSortMTime:
+			if !a.ModTime.Equal(b.ModTime) {
+				return a.ModTime.Before(b.ModTime)
+			}
+		}
+		return a.Name < b.Name
+	})
+
+	total := len(filtered)
+	if opts.offset >= total {
+		return []FileInfo{}, total
+	}
+	filtered = filtered[opts.offset:]
+	if opts.limit > 0 && opts.limit < len(filtered) {
+		filtered = filtered[:opts.limit]
+	}
+	return filtered, total
+}
+
+// fileAgeBucket 返回修改时间相对now的分组，按now所在的时区计算日期，一周从周一开始
+func fileAgeBucket(modTime, now time.Time) string {
+	year, month, day := now.Date()
+	today := time.Date(year, month, day, 0, 0, 0, 0, now.Location())
+	weekStart := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	switch {
+	case !modTime.Before(today):
+		return FileAgeToday
+	case !modTime.Before(weekStart):
+		return FileAgeThisWeek
+	}
+	return FileAgeOlder
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileListSortFilterPage(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	files := []struct {
+		name  string
+		size  int
+		mtime time.Time
+	}{
+		{"b.log", 30, now.Add(-time.Minute)},
+		{"a.log", 10, now.Add(-48 * time.Hour)},
+		{"c.log.gz", 20, now.Add(-30 * 24 * time.Hour)},
+		{"d.log", 10, now.Add(-2 * time.Hour)},
+		{"api-1.log", 40, now.Add(-3 * time.Hour)},
+	}
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		if err := os.WriteFile(path, []byte(strings.Repeat("x", f.size)), 0644); err != nil {
+			t.Fatalf("创建文件失败: %v", err)
+		}
+		if err := os.Chtimes(path, f.mtime, f.mtime); err != nil {
+			t.Fatalf("设置修改时间失败: %v", err)
+		}
+	}
+	handler := NewWebServer(dir, "8080").routes()
+
+	list := func(path string) ([]string, int) {
+		t.Helper()
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		var response struct {
+			Data  []FileInfo `json:"data"`
+			Total *int       `json:"total"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil || w.Code != http.StatusOK || response.Total == nil {
+			t.Fatalf("%s: 期望成功，得到 %d %v", path, w.Code, err)
+		}
+		names := make([]string, 0, len(response.Data))
+		for _, file := range response.Data {
+			names = append(names, file.Name)
+		}
+		return names, *response.Total
+	}
+
+	for _, base := range []string{"/api/files", "/api/v1/files"} {
+		for query, want := range map[string][]string{
+			"":                                  {"a.log", "api-1.log", "b.log", "c.log.gz", "d.log"},
+			"?sort=name&order=desc":             {"d.log", "c.log.gz", "b.log", "api-1.log", "a.log"},
+			"?sort=size":                        {"a.log", "d.log", "c.log.gz", "b.log", "api-1.log"}, // 大小相同时按名称
+			"?sort=size&order=desc":             {"api-1.log", "b.log", "c.log.gz", "d.log", "a.log"},
+			"?sort=mtime&order=desc":            {"b.log", "d.log", "api-1.log", "a.log", "c.log.gz"},
+			"?q=A":                              {"a.log", "api-1.log"},
+			"?compressed=true":                  {"c.log.gz"},
+			"?compressed=false&sort=mtime&q=.l": {"a.log", "api-1.log", "d.log", "b.log"},
+		} {
+			if got, total := list(base + query); !reflect.DeepEqual(got, want) || total != len(want) {
+				t.Errorf("%s%s: 期望 %v，得到 %v (total %d)", base, query, want, got, total)
+			}
+		}
+
+		// 逐页读取的结果与一次读取一致，total为过滤后的总数
+		all, _ := list(base + "?sort=size")
+		var paged []string
+		for offset := 0; offset < 6; offset += 2 {
+			page, total := list(base + "?sort=size&limit=2&offset=" + strconv.Itoa(offset))
+			if total != len(all) {
+				t.Errorf("期望total为 %d，得到 %d", len(all), total)
+			}
+			paged = append(paged, page...)
+		}
+		if !reflect.DeepEqual(paged, all) {
+			t.Errorf("期望分页结果一致，得到 %v 和 %v", paged, all)
+		}
+
+		for _, query := range []string{"?sort=owner", "?order=up", "?compressed=maybe", "?limit=-1", "?offset=x"} {
+			req := httptest.NewRequest("GET", base+query, nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("%s%s: 期望400，得到 %d", base, query, w.Code)
+			}
+		}
+	}
+
+	// 文件列表可以单独配置匹配模式
+	ws := NewWebServer(dir, "8080", WithFileListPatterns("*.gz"))
+	if files, total, err := ws.getLogFilesList(fileListOptions{}); err != nil || total != 1 || files[0].Name != "c.log.gz" || files[0].AgeBucket != FileAgeOlder {
+		t.Errorf("期望只列出 c.log.gz，得到 %+v %d %v", files, total, err)
+	}
+}
+
+func TestFileAgeBucket(t *testing.T) {
+	// 2024-01-17是周三
+	now := time.Date(2024, 1, 17, 15, 0, 0, 0, time.UTC)
+	for modTime, want := range map[time.Time]string{
+		time.Date(2024, 1, 17, 0, 0, 0, 0, time.UTC):   FileAgeToday,
+		time.Date(2024, 1, 16, 23, 59, 0, 0, time.UTC): FileAgeThisWeek,
+		time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC):   FileAgeThisWeek,
+		time.Date(2024, 1, 14, 23, 0, 0, 0, time.UTC):  FileAgeOlder,
+	} {
+		if got := fileAgeBucket(modTime, now); got != want {
+			t.Errorf("%s: 期望 %s，得到 %s", modTime, want, got)
+		}
+	}
+	// 周日属于从周一开始的同一周
+	sunday := time.Date(2024, 1, 21, 12, 0, 0, 0, time.UTC)
+	if got := fileAgeBucket(time.Date(2024, 1, 15, 1, 0, 0, 0, time.UTC), sunday); got != FileAgeThisWeek {
+		t.Errorf("期望周一属于本周，得到 %s", got)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/HsiaoL1/trace"
+	"github.com/HsiaoL1/trace/logz"
+	"github.com/HsiaoL1/trace/logz/aggregate"
+	"github.com/HsiaoL1/trace/tracetest"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// TestFullStackTraceLogs 追踪的HTTP请求通过logz.WithContext写入聚合器，再通过Web API按TraceID查回，
+// 覆盖trace、logz、聚合器和Web API之间的衔接
+func TestFullStackTraceLogs(t *testing.T) {
+	recorder := tracetest.Start(t)
+	dir := t.TempDir()
+	if err := aggregate.InitWithAggregation("", dir, "fullstack", 0, 0); err != nil {
+		t.Fatalf("初始化聚合日志失败: %v", err)
+	}
+	t.Cleanup(func() {
+		logz.GetDefaultLogger().RemoveHook(logz.HookNameAggregator)
+		aggregate.CloseAggregator()
+		aggregate.SetGlobalAggregator(nil)
+	})
+
+	client := trace.NewTracedHTTPClient(5 * time.Second)
+	mux := http.NewServeMux()
+	app := httptest.NewServer(trace.OpenTelemetryMiddleware(mux))
+	defer app.Close()
+	mux.HandleFunc("/inventory", func(w http.ResponseWriter, r *http.Request) {
+		logz.WithContext(r.Context()).Info("库存充足")
+		w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/order", func(w http.ResponseWriter, r *http.Request) {
+		logz.WithContext(r.Context()).Info("收到订单")
+		resp, err := client.Get(r.Context(), app.URL+"/inventory")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		logz.WithContext(r.Context()).Info("订单完成")
+		w.Write([]byte("ok"))
+	})
+
+	resp, err := client.Get(context.Background(), app.URL+"/order")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("期望200，得到 %d", resp.StatusCode)
+	}
+	if err := aggregate.FlushAggregator(); err != nil {
+		t.Fatalf("刷新聚合器失败: %v", err)
+	}
+
+	// 导出的服务端span：/order和/inventory各一个，与客户端span属于同一条trace
+	var traceID string
+	serverSpans := map[string]bool{}
+	for _, span := range recorder.Spans() {
+		if span.SpanKind() != oteltrace.SpanKindServer {
+			continue
+		}
+		if traceID == "" {
+			traceID = span.SpanContext().TraceID().String()
+		}
+		if span.SpanContext().TraceID().String() != traceID {
+			t.Fatalf("期望所有服务端span属于同一条trace，得到 %s 和 %s", traceID, span.SpanContext().TraceID())
+		}
+		serverSpans[span.SpanContext().SpanID().String()] = true
+	}
+	if len(serverSpans) != 2 {
+		t.Fatalf("期望2个服务端span，得到 %d", len(serverSpans))
+	}
+
+	handler := NewWebServer(dir, "8080").routes()
+	status, response := doAPI(t, handler, "GET", "/api/v1/logs/trace/"+traceID, "")
+	if status != http.StatusOK || !response.Success {
+		t.Fatalf("期望按TraceID查询成功，得到 %d %+v", status, response)
+	}
+	data, _ := json.Marshal(response.Data)
+	var result aggregate.LogQueryResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatalf("解析查询结果失败: %v", err)
+	}
+
+	messages := map[string]bool{}
+	for _, entry := range result.Entries {
+		if entry.TraceID != traceID {
+			t.Errorf("期望条目的TraceID为 %s，得到 %s", traceID, entry.TraceID)
+		}
+		if !serverSpans[entry.SpanID] {
+			t.Errorf("期望条目的SpanID是导出的服务端span，得到 %s", entry.SpanID)
+		}
+		messages[entry.Message] = true
+	}
+	for _, message := range []string{"收到订单", "库存充足", "订单完成"} {
+		if !messages[message] {
+			t.Errorf("期望查询结果包含 %q，得到 %+v", message, result.Entries)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// 写入接口在条目的Fields中记录的来源字段
+const (
+	IngestFieldRemoteIP   = "ingest.remote_ip"   // 客户端IP，经过受信任代理时取自X-Forwarded-For
+	IngestFieldUserAgent  = "ingest.user_agent"  // 请求的User-Agent，为空时不添加
+	IngestFieldAPIKeyID   = "ingest.api_key_id"  // 请求使用的API密钥名称，未配置密钥时不添加
+	IngestFieldReceivedAt = "ingest.received_at" // 服务器收到请求的时间（RFC3339Nano）
+
+	ingestFieldPrefix = "ingest."
+	ingestFieldsEnv   = "INGEST_FIELDS"
+)
+
+// 写入接口对单条日志的限制（aggregate.IngestLimits）的环境变量
+const (
+	ingestMaxMessageEnv    = "INGEST_MAX_MESSAGE_BYTES"
+	ingestMaxFieldValueEnv = "INGEST_MAX_FIELD_VALUE_BYTES"
+	ingestMaxFieldsEnv     = "INGEST_MAX_FIELDS"
+	ingestMaxEntryEnv      = "INGEST_MAX_ENTRY_BYTES"
+)
+
+// defaultIngestLimits 写入接口默认的限制：消息超过10000字节时截断
+var defaultIngestLimits = aggregate.IngestLimits{MaxMessageBytes: 10000}
+
+// 批量写入的端点和每次最多写入的条目数
+const (
+	batchWritePath       = "/api/v1/logs/write/batch"
+	maxBatchWriteEntries = 1000
+)
+
+// 同步写入时返回条目位置的响应头
+const (
+	writeFileIDHeader  = "X-Log-File-ID"
+	writeOffsetHeader  = "X-Log-Offset"
+	writeDurableHeader = "X-Log-Durable"
+)
+
+// DefaultIngestFields 默认记录的来源字段
+var DefaultIngestFields = []string{IngestFieldRemoteIP, IngestFieldUserAgent, IngestFieldAPIKeyID, IngestFieldReceivedAt}
+
+// IngestEnricher 写入接口的条目增强函数，在添加来源字段之后、写入之前按添加顺序调用
+// 可以修改条目（如添加派生字段），调用时entry.Fields不为nil；返回错误时拒绝写入，响应422和错误信息
+type IngestEnricher func(entry *aggregate.LogEntry, r *http.Request) error
+
+// ingestConfig 写入接口的来源字段、增强函数和单条日志的限制
+type ingestConfig struct {
+	fields    []string
+	enrichers []IngestEnricher
+	limits    aggregate.IngestLimits
+}
+
+// LogBatchWriteRequest 批量写入请求
+type LogBatchWriteRequest struct {
+	Entries []LogWriteRequest `json:"entries"`
+}
+
+// WithIngestFields 设置写入接口记录的来源字段，默认为DefaultIngestFields，不传参数时不记录
+func WithIngestFields(fields ...string) WebServerOption {
+	return func(ws *WebServer) {
+		ws.ingest.fields = fields
+	}
+}
+
+// WithIngestEnricher 添加写入接口的条目增强函数，单条和批量写入对每个条目调用
+func WithIngestEnricher(enricher IngestEnricher) WebServerOption {
+	return func(ws *WebServer) {
+		ws.ingest.enrichers = append(ws.ingest.enrichers, enricher)
+	}
+}
+
+// WithIngestLimits 设置写入接口对单条日志的限制，默认为消息不超过10000字节
+// 与聚合器的logz.WithIngestLimits使用相同的规则，在添加来源字段和调用增强函数之前应用，只限制客户端提交的内容；
+// 没有聚合器时写入备用文件的条目同样受限，写入聚合器时还会应用聚合器自己的限制。无效的限制记录日志后忽略
+func WithIngestLimits(limits aggregate.IngestLimits) WebServerOption {
+	return func(ws *WebServer) {
+		if err := limits.Validate(); err != nil {
+			log.Printf("无效的写入限制: %v", err)
+			return
+		}
+		ws.ingest.limits = limits
+	}
+}
+
+// ingestLimitsFromEnv 从环境变量读取写入限制，设置了任一变量时替换默认的限制
+func ingestLimitsFromEnv() []WebServerOption {
+	limits := defaultIngestLimits
+	set := false
+	for env, target := range map[string]*int{
+		ingestMaxMessageEnv:    &limits.MaxMessageBytes,
+		ingestMaxFieldValueEnv: &limits.MaxFieldValueBytes,
+		ingestMaxFieldsEnv:     &limits.MaxFieldsCount,
+		ingestMaxEntryEnv:      &limits.MaxEntryBytes,
+	} {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			log.Printf("无效的%s: %v", env, err)
+			continue
+		}
+		*target, set = n, true
+	}
+	if !set {
+		return nil
+	}
+	return []WebServerOption{WithIngestLimits(limits)}
+}
+
+// writeMode 写入接口的sync和durable参数
+type writeMode struct {
+	sync    bool // 立即写入并返回条目的位置
+	durable bool // 还要同步到磁盘并建立索引，隐含sync
+}
+
+// parseWriteMode 读取sync和durable参数，都未设置时使用批量写入的默认方式
+func parseWriteMode(params url.Values) (writeMode, error) {
+	var mode writeMode
+	for name, target := range map[string]*bool{"sync": &mode.sync, "durable": &mode.durable} {
+		if value := params.Get(name); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return mode, fmt.Errorf("%s must be a boolean", name)
+			}
+			*target = parsed
+		}
+	}
+	mode.sync = mode.sync || mode.durable
+	return mode, nil
+}
+
+// setWritePosition 在响应头中返回条目的位置，写入默认日志器时没有位置，不设置
+func setWritePosition(w http.ResponseWriter, position aggregate.WritePosition) {
+	if position.FileID == "" {
+		return
+	}
+	w.Header().Set(writeFileIDHeader, position.FileID)
+	w.Header().Set(writeOffsetHeader, strconv.FormatInt(position.Offset, 10))
+	w.Header().Set(writeDurableHeader, strconv.FormatBool(position.Durable))
+}
+
+// parseIngestFields 解析逗号分隔的来源字段，可以省略ingest.前缀，none表示不记录
+func parseIngestFields(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "none" {
+		return []string{}, nil
+	}
+	var fields []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.HasPrefix(item, ingestFieldPrefix) {
+			item = ingestFieldPrefix + item
+		}
+		if !slices.Contains(DefaultIngestFields, item) {
+			return nil, fmt.Errorf("未知的来源字段: %s", item)
+		}
+		fields = append(fields, item)
+	}
+	return fields, nil
+}
+
+// enrichEntry 去掉客户端提交的ingest.字段，添加配置的来源字段并调用增强函数
+// 增强函数返回错误时返回该错误，条目不应写入
+func (ws *WebServer) enrichEntry(entry *aggregate.LogEntry, r *http.Request, receivedAt time.Time) error {
+	if entry.Fields == nil {
+		entry.Fields = make(map[string]any)
+	}
+	for key := range entry.Fields {
+		if strings.HasPrefix(key, ingestFieldPrefix) {
+			delete(entry.Fields, key)
+		}
+	}
+	for _, field := range ws.ingest.fields {
+		var value string
+		switch field {
+		case IngestFieldRemoteIP:
+			value = ws.clientIP(r)
+		case IngestFieldUserAgent:
+			value = r.UserAgent()
+		case IngestFieldAPIKeyID:
+			if key := apiKeyFromContext(r.Context()); key != nil {
+				value = key.name
+			}
+		case IngestFieldReceivedAt:
+			value = receivedAt.Format(time.RFC3339Nano)
+		}
+		if value != "" {
+			entry.Fields[field] = value
+		}
+	}
+	for _, enrich := range ws.ingest.enrichers {
+		if err := enrich(entry, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// limitEntry 按写入限制截断客户端提交的条目，超过条目大小限制时返回包装了logz.ErrEntryTooLarge的错误
+func (ws *WebServer) limitEntry(entry *aggregate.LogEntry) error {
+	return ws.ingest.limits.Apply(entry)
+}
+
+// handleLogBatchWrite 批量写入日志：POST /api/v1/logs/write/batch，请求体为{"entries": [...]}
+// 所有条目都通过验证、写入限制和增强函数后才写入，任一条目不合法时返回400、被增强函数拒绝时返回422、
+// 超过条目大小限制时返回413，不写入任何条目
+// sync=true时返回每个条目的位置（positions），响应头为最后一个条目的位置；durable=true时全部写入后再同步一次
+func (api *APIServer) handleLogBatchWrite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		api.sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	receivedAt := time.Now()
+
+	if err := api.validateRequest(r); err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mode, err := parseWriteMode(r.URL.Query())
+	if err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var req LogBatchWriteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		api.sendErrorResponse(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	if len(req.Entries) == 0 {
+		api.sendErrorResponse(w, "entries cannot be empty", http.StatusBadRequest)
+		return
+	}
+	if len(req.Entries) > maxBatchWriteEntries {
+		api.sendErrorResponse(w, fmt.Sprintf("too many entries (max %d)", maxBatchWriteEntries), http.StatusBadRequest)
+		return
+	}
+
+	entries := make([]aggregate.LogEntry, len(req.Entries))
+	for i := range req.Entries {
+		if err := api.validateLogWriteRequest(&req.Entries[i]); err != nil {
+			api.sendErrorResponse(w, fmt.Sprintf("entries[%d]: %v", i, err), http.StatusBadRequest)
+			return
+		}
+		entries[i] = newLogEntry(&req.Entries[i], receivedAt)
+		if err := api.ws.limitEntry(&entries[i]); err != nil {
+			api.sendErrorResponseWithCode(w, fmt.Sprintf("entries[%d] rejected: %v", i, err), writeErrorStatus(err), aggregate.ErrorCode(err))
+			return
+		}
+		if err := api.ws.enrichEntry(&entries[i], r, receivedAt); err != nil {
+			api.sendErrorResponseWithCode(w, fmt.Sprintf("entries[%d] rejected: %v", i, err), http.StatusUnprocessableEntity, "entry_rejected")
+			return
+		}
+	}
+
+	fallback := api.ws.writeFallbackConfig()
+	var destination aggregate.WriteDestination
+	var positions []aggregate.WritePosition
+	for i, entry := range entries {
+		if mode.sync {
+			var position aggregate.WritePosition
+			destination, position, err = aggregate.WriteWithFallbackSync(entry, fallback, false)
+			positions = append(positions, position)
+		} else {
+			destination, err = aggregate.WriteWithFallback(entry, fallback)
+		}
+		if err != nil {
+			api.sendErrorResponseWithCode(w, fmt.Sprintf("Failed to write log entries[%d] (%d written): %v", i, i, err), writeErrorStatus(err), aggregate.ErrorCode(err))
+			return
+		}
+	}
+	if mode.durable && destination != aggregate.WrittenToLogger {
+		if err := aggregate.SyncWithFallback(fallback); err != nil {
+			api.sendErrorResponseWithCode(w, fmt.Sprintf("Failed to sync log entries (%d written): %v", len(entries), err), writeErrorStatus(err), aggregate.ErrorCode(err))
+			return
+		}
+		for i := range positions {
+			positions[i].Durable = positions[i].FileID != ""
+		}
+	}
+
+	response := map[string]interface{}{
+		"written":     len(entries),
+		"destination": destination,
+	}
+	if mode.sync {
+		response["positions"] = positions
+		setWritePosition(w, positions[len(positions)-1])
+	}
+	api.sendSuccessResponseWithMessage(w, response, "Logs written successfully")
+}
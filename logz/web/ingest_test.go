@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+func TestLogWriteIngestEnrichment(t *testing.T) {
+	aggregate.SetGlobalAggregator(nil)
+	t.Setenv(apiKeysEnv, "agent:w-secret:write")
+	dir := t.TempDir()
+	ws := NewWebServer(dir, "8080", WithIngestEnricher(func(entry *aggregate.LogEntry, r *http.Request) error {
+		if strings.Contains(entry.Message, "password") {
+			return errors.New("message contains credentials")
+		}
+		entry.Fields["region"] = r.Header.Get("X-Region")
+		return nil
+	}))
+	handler := ws.routes()
+
+	post := func(path, body string) (int, APIResponse) {
+		t.Helper()
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", "w-secret")
+		req.Header.Set("User-Agent", "agent/1.0")
+		req.Header.Set("X-Region", "eu")
+		req.RemoteAddr = "192.0.2.7:4567"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		var response APIResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("解析响应失败: %v", err)
+		}
+		return w.Code, response
+	}
+	written := func() []aggregate.LogEntry {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(dir, receivedDir, "received_"+time.Now().Format("2006-01-02")+".log"))
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatalf("读取备用文件失败: %v", err)
+		}
+		var entries []aggregate.LogEntry
+		for _, line := range bytes.Split(bytes.TrimSpace(content), []byte("\n")) {
+			var entry aggregate.LogEntry
+			if len(line) > 0 && json.Unmarshal(line, &entry) == nil {
+				entries = append(entries, entry)
+			}
+		}
+		return entries
+	}
+	checkIngest := func(entry aggregate.LogEntry) {
+		t.Helper()
+		if entry.Fields[IngestFieldRemoteIP] != "192.0.2.7" || entry.Fields[IngestFieldUserAgent] != "agent/1.0" ||
+			entry.Fields[IngestFieldAPIKeyID] != "agent" || entry.Fields["region"] != "eu" {
+			t.Errorf("期望记录来源字段，得到 %v", entry.Fields)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, entry.Fields[IngestFieldReceivedAt].(string)); err != nil {
+			t.Errorf("期望received_at为RFC3339时间，得到 %v", entry.Fields[IngestFieldReceivedAt])
+		}
+	}
+
+	// 客户端提交的ingest.字段被服务器的值覆盖
+	if status, _ := post("/api/v1/logs/write", `{"level":"info","message":"single","fields":{"ingest.remote_ip":"spoofed","attempt":1}}`); status != http.StatusOK {
+		t.Fatalf("期望写入成功，得到 %d", status)
+	}
+	entries := written()
+	if len(entries) != 1 || entries[0].Fields["attempt"] != float64(1) {
+		t.Fatalf("期望写入 1 条，得到 %+v", entries)
+	}
+	checkIngest(entries[0])
+
+	status, response := post(batchWritePath, `{"entries":[{"level":"info","message":"batch-1"},{"level":"warn","message":"batch-2","fields":{"k":"v"}}]}`)
+	if status != http.StatusOK || response.Data.(map[string]interface{})["written"] != float64(2) {
+		t.Fatalf("期望批量写入 2 条，得到 %d %+v", status, response)
+	}
+	entries = written()
+	if len(entries) != 3 || entries[2].Message != "batch-2" || entries[2].Fields["k"] != "v" {
+		t.Fatalf("期望共 3 条，得到 %+v", entries)
+	}
+	checkIngest(entries[1])
+	checkIngest(entries[2])
+
+	// 增强函数拒绝的条目返回422，批量写入时整批都不写入
+	if status, response := post("/api/v1/logs/write", `{"level":"info","message":"password=x"}`); status != http.StatusUnprocessableEntity ||
+		response.ErrorCode != "entry_rejected" || !strings.Contains(response.Error, "credentials") {
+		t.Errorf("期望返回 422 entry_rejected，得到 %d %+v", status, response)
+	}
+	if status, response := post(batchWritePath, `{"entries":[{"level":"info","message":"ok"},{"level":"info","message":"password=y"}]}`); status != http.StatusUnprocessableEntity ||
+		!strings.Contains(response.Error, "entries[1]") {
+		t.Errorf("期望返回 422 并指出被拒绝的条目，得到 %d %+v", status, response)
+	}
+	if status, response := post(batchWritePath, `{"entries":[{"level":"info","message":"ok"},{"level":"bogus","message":"m"}]}`); status != http.StatusBadRequest ||
+		!strings.Contains(response.Error, "entries[1]") {
+		t.Errorf("期望返回 400 并指出不合法的条目，得到 %d %+v", status, response)
+	}
+	if n := len(written()); n != 3 {
+		t.Errorf("期望被拒绝的批次不写入，得到 %d 条", n)
+	}
+}
+
+func TestIngestFieldsConfig(t *testing.T) {
+	aggregate.SetGlobalAggregator(nil)
+	dir := t.TempDir()
+	handler := NewWebServer(dir, "8080", WithIngestFields(IngestFieldReceivedAt)).routes()
+	if code, _ := postLogWrite(t, handler, `{"level":"info","message":"m","trace_id":"trace-ingest"}`); code != http.StatusOK {
+		t.Fatalf("期望写入成功，得到 %d", code)
+	}
+	result, err := aggregate.NewDirStore(dir, aggregate.WithDiscoverOptions(aggregate.DiscoverOptions{Subdirs: []string{receivedDir}})).
+		Query(t.Context(), aggregate.LogQuery{TraceID: "trace-ingest", Limit: 1})
+	if err != nil || len(result.Entries) != 1 {
+		t.Fatalf("期望查询到写入的日志，得到 %+v %v", result, err)
+	}
+	if fields := result.Entries[0].Fields; len(fields) != 1 || fields[IngestFieldReceivedAt] == nil {
+		t.Errorf("期望只记录received_at，得到 %v", fields)
+	}
+
+	if fields, err := parseIngestFields("remote_ip, ingest.received_at"); err != nil || len(fields) != 2 || fields[0] != IngestFieldRemoteIP {
+		t.Errorf("期望解析出 2 个字段，得到 %v %v", fields, err)
+	}
+	if fields, err := parseIngestFields("none"); err != nil || len(fields) != 0 {
+		t.Errorf("期望none不记录来源字段，得到 %v %v", fields, err)
+	}
+	if _, err := parseIngestFields("hostname"); err == nil {
+		t.Error("期望未知字段返回错误")
+	}
+}
+
+func TestLogWriteIngestLimits(t *testing.T) {
+	aggregate.SetGlobalAggregator(nil)
+	dir := t.TempDir()
+	handler := NewWebServer(dir, "8080", WithIngestFields(IngestFieldReceivedAt),
+		WithIngestLimits(aggregate.IngestLimits{MaxMessageBytes: 100, MaxFieldsCount: 50, MaxEntryBytes: 32 << 10})).routes()
+	query := func(traceID string) aggregate.LogEntry {
+		t.Helper()
+		result, err := aggregate.NewDirStore(dir, aggregate.WithDiscoverOptions(aggregate.DiscoverOptions{Subdirs: []string{receivedDir}})).
+			Query(t.Context(), aggregate.LogQuery{TraceID: traceID, Limit: 1})
+		if err != nil || len(result.Entries) != 1 {
+			t.Fatalf("期望查询到写入的日志，得到 %+v %v", result, err)
+		}
+		return result.Entries[0]
+	}
+
+	// 超过限制的消息按UTF-8字符截断而不是拒绝
+	message := strings.Repeat("长消息", 40)
+	if code, _ := postLogWrite(t, handler, `{"level":"info","message":"`+message+`","trace_id":"trace-long"}`); code != http.StatusOK {
+		t.Fatalf("期望截断后写入成功，得到 %d", code)
+	}
+	entry := query("trace-long")
+	if !entry.Truncated || len(entry.Message) > 100 || !utf8.ValidString(entry.Message) {
+		t.Errorf("期望消息截断到100字节以内，得到 %d 字节 %q", len(entry.Message), entry.Message)
+	}
+
+	// 批量写入中的10000个字段只保留50个，来源字段不计入
+	fields := make(map[string]int, 10000)
+	for i := 0; i < 10000; i++ {
+		fields[fmt.Sprintf("f%05d", i)] = i
+	}
+	body, _ := json.Marshal(map[string]any{"entries": []any{map[string]any{"level": "info", "message": "wide", "trace_id": "trace-wide", "fields": fields}}})
+	if code, response := doAPI(t, handler, "POST", batchWritePath, string(body)); code != http.StatusOK {
+		t.Fatalf("期望批量写入成功，得到 %d %s", code, response.Error)
+	}
+	entry = query("trace-wide")
+	if len(entry.Fields) != 51 || entry.FieldsDropped != 9950 || entry.Fields[IngestFieldReceivedAt] == nil {
+		t.Errorf("期望保留50个字段和来源字段，得到 %d 个字段、fields_dropped=%d", len(entry.Fields), entry.FieldsDropped)
+	}
+
+	// 截断后仍然超过条目大小限制时返回413，批量写入不写入任何条目
+	big := make(map[string]string, 40)
+	for i := 0; i < 40; i++ {
+		big[fmt.Sprintf("k%02d", i)] = strings.Repeat("v", 1024)
+	}
+	body, _ = json.Marshal(map[string]any{"entries": []any{
+		map[string]any{"level": "info", "message": "ok", "trace_id": "trace-rejected"},
+		map[string]any{"level": "info", "message": "big", "fields": big},
+	}})
+	code, response := doAPI(t, handler, "POST", batchWritePath, string(body))
+	if code != http.StatusRequestEntityTooLarge || response.ErrorCode != aggregate.CodeEntryTooLarge || !strings.Contains(response.Error, "entries[1]") {
+		t.Errorf("期望返回413和entry_too_large，得到 %d %+v", code, response)
+	}
+	if result, _ := aggregate.QueryLogs(aggregate.LogQuery{TraceID: "trace-rejected", Limit: 1, Subdirs: []string{receivedDir}}, dir); result != nil && len(result.Entries) != 0 {
+		t.Error("期望拒绝后不写入任何条目")
+	}
+
+	t.Setenv(ingestMaxFieldsEnv, "20")
+	ws := NewWebServer(dir, "8080", ingestLimitsFromEnv()...)
+	if want := (aggregate.IngestLimits{MaxMessageBytes: 10000, MaxFieldsCount: 20}); ws.ingest.limits != want {
+		t.Errorf("期望从环境变量读取限制 %+v，得到 %+v", want, ws.ingest.limits)
+	}
+}
+
+func TestLogWriteSyncPosition(t *testing.T) {
+	dir := t.TempDir()
+	aggregator, err := aggregate.NewLogAggregatorWithOptions(filepath.Join(dir, "aggregated"), "write-sync", aggregate.WithFlushInterval(time.Hour))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	aggregate.SetGlobalAggregator(aggregator)
+	defer func() {
+		aggregate.SetGlobalAggregator(nil)
+		aggregator.Close()
+	}()
+	handler := NewWebServer(dir, "8080").routes()
+	post := func(path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	readAt := func(fileID, offset string) string {
+		t.Helper()
+		content, err := os.ReadFile(filepath.Join(dir, "aggregated", fileID+".log"))
+		n, convErr := strconv.Atoi(offset)
+		if err != nil || convErr != nil || n >= len(content) {
+			t.Fatalf("读取 %s@%s 失败: %v %v", fileID, offset, err, convErr)
+		}
+		line, _, _ := bytes.Cut(content[n:], []byte("\n"))
+		return string(line)
+	}
+
+	w := post("/api/v1/logs/write?durable=true", `{"level":"info","message":"durable-entry","trace_id":"trace-durable"}`)
+	if w.Code != http.StatusOK || w.Header().Get(writeDurableHeader) != "true" {
+		t.Fatalf("期望durable写入成功，得到 %d %v", w.Code, w.Header())
+	}
+	if line := readAt(w.Header().Get(writeFileIDHeader), w.Header().Get(writeOffsetHeader)); !strings.Contains(line, "durable-entry") {
+		t.Errorf("期望在返回的位置读到条目，得到 %s", line)
+	}
+
+	w = post(batchWritePath+"?sync=true", `{"entries":[{"level":"info","message":"batch-1"},{"level":"info","message":"batch-2"}]}`)
+	var response struct {
+		Data struct {
+			Positions []aggregate.WritePosition `json:"positions"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil || len(response.Data.Positions) != 2 {
+		t.Fatalf("期望返回 2 个位置，得到 %d %+v %v", w.Code, response, err)
+	}
+	for i, position := range response.Data.Positions {
+		if line := readAt(position.FileID, strconv.FormatInt(position.Offset, 10)); position.Durable || !strings.Contains(line, fmt.Sprintf("batch-%d", i+1)) {
+			t.Errorf("期望第 %d 个位置指向对应的条目，得到 %+v %s", i, position, line)
+		}
+	}
+
+	// 默认方式不返回位置
+	if w := post("/api/v1/logs/write", `{"level":"info","message":"fast"}`); w.Code != http.StatusOK || w.Header().Get(writeFileIDHeader) != "" {
+		t.Errorf("期望默认写入不返回位置，得到 %d %v", w.Code, w.Header())
+	}
+	if w := post("/api/v1/logs/write?sync=maybe", `{"level":"info","message":"m"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("期望无效的sync参数返回400，得到 %d", w.Code)
+	}
+}
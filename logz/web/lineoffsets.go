@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// contentCheckpointInterval 按行分页读取文件内容时每隔多少个匹配行记录一次字节偏移
+const contentCheckpointInterval = 1000
+
+// maxLineOffsetEntries 最多缓存多少个文件和过滤条件的行偏移，超过时去掉最久未使用的
+const maxLineOffsetEntries = 64
+
+// lineCheckpoint 文件中一行的起始位置和之前的行数
+type lineCheckpoint struct {
+	offset  int64 // 行的起始字节
+	line    int   // 之前的行数
+	matched int   // 之前匹配过滤条件的行数
+	skipped int   // 之前超过最大长度的行数
+}
+
+// lineOffsets 一个文件在一组过滤条件下的行偏移，分页时从不超过offset的最近的检查点开始读取，
+// 总行数从上次读取到的末尾继续统计，文件只追加时不需要重新读取前面的内容
+type lineOffsets struct {
+	file        os.FileInfo      // 用os.SameFile检查文件是否被替换（轮转）
+	checkpoints []lineCheckpoint // 按offset递增，第一个为文件开头
+	end         lineCheckpoint   // 已读取的最后一个完整行之后的位置
+	used        time.Time
+}
+
+// newLineOffsets 返回从文件开头开始的行偏移
+func newLineOffsets(file os.FileInfo) *lineOffsets {
+	return &lineOffsets{file: file, checkpoints: []lineCheckpoint{{}}}
+}
+
+// before 返回matched不超过offset的最后一个检查点
+func (o *lineOffsets) before(offset int) lineCheckpoint {
+	i, found := slices.BinarySearchFunc(o.checkpoints, offset, func(cp lineCheckpoint, target int) int {
+		return cp.matched - target
+	})
+	if !found {
+		i--
+	}
+	return o.checkpoints[max(i, 0)]
+}
+
+// record 距上一个检查点超过contentCheckpointInterval个匹配行时记录cp
+func (o *lineOffsets) record(cp lineCheckpoint) {
+	if cp.matched-o.checkpoints[len(o.checkpoints)-1].matched >= contentCheckpointInterval {
+		o.checkpoints = append(o.checkpoints, cp)
+	}
+}
+
+// valid 检查文件没有被替换或截断：仍然是同一个文件，大小不小于已读取的位置，并且该位置之前是换行符
+func (o *lineOffsets) valid(file *os.File, stat os.FileInfo) bool {
+	if !os.SameFile(o.file, stat) || stat.Size() < o.end.offset {
+		return false
+	}
+	if o.end.offset == 0 {
+		return true
+	}
+	var last [1]byte
+	_, err := file.ReadAt(last[:], o.end.offset-1)
+	return err == nil && last[0] == '\n'
+}
+
+// clone 返回可以继续追加检查点的副本
+func (o *lineOffsets) clone(file os.FileInfo) *lineOffsets {
+	return &lineOffsets{file: file, checkpoints: slices.Clone(o.checkpoints), end: o.end}
+}
+
+// lineOffsetCache 按文件路径和过滤条件缓存行偏移
+type lineOffsetCache struct {
+	mutex   sync.Mutex
+	entries map[string]*lineOffsets
+}
+
+// get 返回缓存的行偏移，调用方不能修改
+func (c *lineOffsetCache) get(key string) *lineOffsets {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	offsets := c.entries[key]
+	if offsets != nil {
+		offsets.used = time.Now()
+	}
+	return offsets
+}
+
+// put 保存行偏移，超过maxLineOffsetEntries时去掉最久未使用的
+func (c *lineOffsetCache) put(key string, offsets *lineOffsets) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*lineOffsets)
+	}
+	offsets.used = time.Now()
+	c.entries[key] = offsets
+	for len(c.entries) > maxLineOffsetEntries {
+		var oldest string
+		for k, entry := range c.entries {
+			if oldest == "" || entry.used.Before(c.entries[oldest].used) {
+				oldest = k
+			}
+		}
+		delete(c.entries, oldest)
+	}
+}
+
+// remove 去掉文件被替换或截断后失效的行偏移
+func (c *lineOffsetCache) remove(key string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.entries, key)
+}
@@ -1,125 +1,294 @@
 package main
 
 import (
-	"bufio"
 	"compress/gzip"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"html/template"
 	"io"
+	"io/fs"
 	"log"
+	"math"
 	"net/http"
+	"net/netip"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
-	"github.com/HsiaoL1/trace/logz"
+	"github.com/HsiaoL1/trace"
+	"github.com/HsiaoL1/trace/logz/aggregate"
 )
 
 type WebServer struct {
-	logDir      string
-	port        string
-	fileCache   map[string]*fileCacheEntry
-	cacheMutex  sync.RWMutex
-	server      *http.Server
-	shutdownCh  chan struct{}
-	clients     map[string]chan []byte // WebSocket clients for real-time logs
-	clientsMutex sync.RWMutex
+	logDir     string
+	port       string
+	fileCache  map[string]*fileCacheEntry
+	cacheMutex sync.RWMutex
+	server     *http.Server
+	shutdownCh chan struct{}
+
+	// 可在运行时重新加载的配置
+	settingsMutex  sync.RWMutex
+	rateLimit      int            // 每个客户端每分钟允许的请求数
+	cacheTTL       time.Duration  // 文件内容缓存时间
+	apiKeys        []*apiKey      // 为空时不校验API密钥
+	trustedProxies []netip.Prefix // 来自这些代理的请求使用X-Forwarded-For中的客户端IP
+	cors           corsConfig     // 跨域访问配置
+	csp            string         // 页面的Content-Security-Policy
+
+	keyUsage sync.Map // API密钥名称 -> *apiKeyUsage
+
+	// 日志文件查找配置
+	discovery    aggregate.DiscoverOptions
+	listPatterns []string // 只用于文件列表的匹配模式，为空时使用discovery.Patterns
+	rawLogPaths  []string // 原始的logrus日志文件，查询时解析logrus格式
+
+	store aggregate.LogStore // 日志查询、统计和跟踪，默认为日志目录的DirStore
+
+	tracing bool // 是否为请求创建span
+
+	// 页面模板和静态文件，默认使用内嵌资源，Start时优先加载磁盘上的文件
+	assets          *webAssets
+	reloadTemplates bool
+
+	admission *queryAdmission // 限制并发的文件扫描查询
+
+	gzipEnabled          bool          // 是否压缩响应，入口代理已压缩时可关闭
+	slowRequestThreshold time.Duration // 超过此耗时的请求记录警告，为0时不记录
+	requestStats         requestStats
+
+	checksums *checksumCache // 文件校验和缓存，按需在后台计算
+
+	writeFallback aggregate.FallbackMode // 没有全局聚合器时写入接口的处理方式
+	ingest        ingestConfig           // 写入接口记录的来源字段和增强函数
+
+	dashboard dashboardCache // 仪表盘统计结果缓存
+
+	queryCache queryCache // 搜索结果缓存，按query_id分页读取
+
+	preferences *preferenceStore // 用户偏好设置
+
+	middlewareOrder []string     // 启用的内置中间件，从外到内
+	middleware      []Middleware // Use添加的中间件，在内置中间件之内
+
+	routeTimeouts map[string]time.Duration // 路由分组的请求超时，为0时不设超时
+
+	traceLinks traceLinks // 追踪界面的链接模板
+
+	remotes []*remoteSource // 联合查询的远程日志服务
+
+	lineOffsets lineOffsetCache // 文件内容分页的行偏移
 }
 
+// WebServerOption Web服务器配置选项
+type WebServerOption func(*WebServer)
+
+// WithFilePatterns 设置日志文件匹配模式（如"*.log"、"*.jsonl"），同时用于文件列表和日志查询
+func WithFilePatterns(patterns ...string) WebServerOption {
+	return func(ws *WebServer) {
+		ws.discovery.Patterns = append(ws.discovery.Patterns, patterns...)
+	}
+}
+
+// WithRecursive 设置是否在日志目录的子目录中查找日志文件
+func WithRecursive(recursive bool) WebServerOption {
+	return func(ws *WebServer) {
+		ws.discovery.Recursive = recursive
+	}
+}
+
+// WithLogStore 设置日志查询、统计和跟踪使用的存储，默认为日志目录的logz.DirStore
+// 文件列表、内容、上传和删除仍直接操作日志目录
+func WithLogStore(store aggregate.LogStore) WebServerOption {
+	return func(ws *WebServer) {
+		ws.store = store
+	}
+}
+
+// 运行时配置的默认值和环境变量
+const (
+	defaultRateLimit = 100
+	defaultCacheTTL  = 5 * time.Minute
+
+	rateLimitEnv      = "RATE_LIMIT_PER_MINUTE"
+	cacheTTLEnv       = "CACHE_TTL"
+	trustedProxiesEnv = "TRUSTED_PROXIES"
+)
+
+// 未配置匹配模式时文件列表显示的文件（包括压缩文件）
+var defaultListPatterns = []string{"*.log*"}
+
 type fileCacheEntry struct {
-	content   []string
-	total     int
-	lastMod   time.Time
-	expiry    time.Time
+	content *fileContent
+	lastMod time.Time
+	expiry  time.Time
 }
 
 type FileInfo struct {
-	Name         string    `json:"name"`
-	Size         int64     `json:"size"`
-	ModTime      time.Time `json:"mod_time"`
-	IsCompressed bool      `json:"is_compressed"`
+	Name            string    `json:"name"`
+	Size            int64     `json:"size"`
+	ModTime         time.Time `json:"mod_time"`
+	IsCompressed    bool      `json:"is_compressed"`
+	AgeBucket       string    `json:"age_bucket"`                 // 修改时间分组：today、this_week或older
+	Checksum        string    `json:"checksum,omitempty"`         // SHA-256，请求checksum=true时返回
+	ChecksumPending bool      `json:"checksum_pending,omitempty"` // 校验和正在后台计算
 }
 
 type LogViewResponse struct {
 	Success bool        `json:"success"`
 	Data    interface{} `json:"data,omitempty"`
 	Error   string      `json:"error,omitempty"`
+	Total   *int        `json:"total,omitempty"` // 分页的列表接口返回过滤后的总数
 }
 
-func NewWebServer(logDir, port string) *WebServer {
-	return &WebServer{
+func NewWebServer(logDir, port string, opts ...WebServerOption) *WebServer {
+	ws := &WebServer{
 		logDir:     logDir,
 		port:       port,
 		fileCache:  make(map[string]*fileCacheEntry),
 		shutdownCh: make(chan struct{}),
-		clients:    make(map[string]chan []byte),
+		rateLimit:  defaultRateLimit,
+		cacheTTL:   defaultCacheTTL,
+		admission:  newQueryAdmission(defaultQueryConcurrency(), defaultQueryQueueSize, defaultQueryQueueTimeout),
+		assets:     embeddedAssets(),
+
+		gzipEnabled:          true,
+		middlewareOrder:      slices.Clone(DefaultMiddlewareOrder),
+		slowRequestThreshold: defaultSlowRequestThreshold,
+		writeFallback:        aggregate.FallbackFile,
+		ingest:               ingestConfig{fields: DefaultIngestFields, limits: defaultIngestLimits},
+		dashboard:            dashboardCache{ttl: defaultDashboardCacheTTL},
+		queryCache: queryCache{
+			ttl:        defaultQueryCacheTTL,
+			maxQueries: defaultQueryCacheQueries,
+			maxRefs:    queryCacheRefsLimit,
+		},
+		routeTimeouts: map[string]time.Duration{
+			RouteGroupDefault: defaultRouteTimeout,
+			RouteGroupSearch:  searchRouteTimeout,
+		},
 	}
+	for _, opt := range opts {
+		opt(ws)
+	}
+	ws.addRawLogSources()
+	if ws.writeFallback == aggregate.FallbackFile && !ws.discovery.Recursive {
+		ws.discovery.Subdirs = append(ws.discovery.Subdirs, receivedDir)
+	}
+	if ws.store == nil {
+		ws.store = aggregate.NewDirStore(logDir, aggregate.WithDiscoverOptions(ws.discovery))
+	}
+	ws.checksums = newChecksumCache(ws.shutdownCh)
+	ws.preferences = newPreferenceStore(logDir)
+	ws.ReloadSettings()
+	return ws
 }
 
-func (ws *WebServer) Start() error {
-	// 启动缓存清理协程
-	go ws.cacheCleanup()
+// ReloadSettings 从环境变量重新读取限流、缓存、受信任代理、CORS、CSP和API密钥配置，并清空文件缓存
+// 未设置或无效的值使用默认值，API密钥配置无效时保留原有密钥
+func (ws *WebServer) ReloadSettings() {
+	rateLimit := defaultRateLimit
+	if value := os.Getenv(rateLimitEnv); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			rateLimit = parsed
+		} else {
+			log.Printf("无效的%s: %s", rateLimitEnv, value)
+		}
+	}
 
-	// 启动实时日志推送协程
-	go ws.startLogStreaming()
-	// 获取当前工作目录
-	currentDir, err := os.Getwd()
+	cacheTTL := defaultCacheTTL
+	if value := os.Getenv(cacheTTLEnv); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed >= 0 {
+			cacheTTL = parsed
+		} else {
+			log.Printf("无效的%s: %s", cacheTTLEnv, value)
+		}
+	}
+
+	trustedProxies, err := trace.ParseTrustedProxies(os.Getenv(trustedProxiesEnv))
 	if err != nil {
-		return fmt.Errorf("获取当前目录失败: %v", err)
+		log.Printf("无效的%s: %v", trustedProxiesEnv, err)
 	}
 
-	// 确定模板和静态文件的路径
-	// 如果当前在web目录下，直接使用templates和static
-	// 如果在上级目录，使用web/templates和web/static
-	templateDir := filepath.Join(currentDir, "templates")
-	staticDir := filepath.Join(currentDir, "static")
+	cors := loadCORSConfig()
+	csp := loadCSP()
 
-	// 检查模板目录是否存在，如果不存在，尝试上级目录
-	if _, err := os.Stat(templateDir); os.IsNotExist(err) {
-		templateDir = filepath.Join(currentDir, "web", "templates")
-		staticDir = filepath.Join(currentDir, "web", "static")
+	apiKeys, err := loadAPIKeys()
+	if err != nil {
+		log.Printf("无效的API密钥配置，保留原有密钥: %v", err)
 	}
 
-	// 再次检查模板目录是否存在
-	if _, err := os.Stat(templateDir); os.IsNotExist(err) {
-		return fmt.Errorf("模板目录不存在: %s", templateDir)
+	ws.settingsMutex.Lock()
+	ws.rateLimit = rateLimit
+	ws.cacheTTL = cacheTTL
+	ws.trustedProxies = trustedProxies
+	ws.cors = cors
+	ws.csp = csp
+	if err == nil {
+		ws.apiKeys = apiKeys
 	}
+	ws.settingsMutex.Unlock()
 
-	// 静态文件服务（支持gzip压缩）
-	http.Handle("/static/", ws.gzipHandler(http.StripPrefix("/static/", http.FileServer(http.Dir(staticDir)))))
+	ws.cacheMutex.Lock()
+	ws.fileCache = make(map[string]*fileCacheEntry)
+	ws.cacheMutex.Unlock()
+}
 
-	// 添加中间件
-	http.HandleFunc("/api/files", ws.corsHandler(ws.rateLimitHandler(ws.logHandler(ws.getLogFiles))))
-	http.HandleFunc("/api/search", ws.corsHandler(ws.rateLimitHandler(ws.logHandler(ws.searchLogs))))
-	http.HandleFunc("/api/errors", ws.corsHandler(ws.rateLimitHandler(ws.logHandler(ws.getErrorLogs))))
-	http.HandleFunc("/api/stats", ws.corsHandler(ws.rateLimitHandler(ws.logHandler(ws.getLogStats))))
+// HandleSignals 收到SIGHUP时重新加载配置，ctx取消后停止监听
+func (ws *WebServer) HandleSignals(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ws.shutdownCh:
+				return
+			case <-signals:
+				ws.ReloadSettings()
+				log.Printf("已重新加载配置")
+			}
+		}
+	}()
+}
 
-	// 文件操作路由
-	http.HandleFunc("/api/files/delete/", ws.corsHandler(ws.rateLimitHandler(ws.logHandler(ws.handleDeleteFile))))
-	http.HandleFunc("/api/files/content/", ws.corsHandler(ws.rateLimitHandler(ws.logHandler(ws.handleGetContent))))
-	http.HandleFunc("/api/files/upload", ws.corsHandler(ws.rateLimitHandler(ws.logHandler(ws.handleUploadFile))))
-	http.HandleFunc("/api/logs/stream", ws.corsHandler(ws.handleLogStream))
+// settings 获取当前的限流和缓存配置
+func (ws *WebServer) settings() (int, time.Duration) {
+	ws.settingsMutex.RLock()
+	defer ws.settingsMutex.RUnlock()
+	return ws.rateLimit, ws.cacheTTL
+}
 
-	// 页面路由
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		ws.indexPage(w, r, templateDir)
-	})
-	http.HandleFunc("/view/", func(w http.ResponseWriter, r *http.Request) {
-		filename := strings.TrimPrefix(r.URL.Path, "/view/")
-		ws.viewLogPage(w, r, filename, templateDir)
-	})
-	http.HandleFunc("/errors", func(w http.ResponseWriter, r *http.Request) {
-		ws.errorsPage(w, r, templateDir)
-	})
+// clientIP 返回请求的客户端IP，经过受信任代理时取自X-Forwarded-For
+func (ws *WebServer) clientIP(r *http.Request) string {
+	ws.settingsMutex.RLock()
+	trustedProxies := ws.trustedProxies
+	ws.settingsMutex.RUnlock()
+	return trace.ClientIP(r, trustedProxies)
+}
+
+func (ws *WebServer) Start() error {
+	// 启动缓存清理协程
+	go ws.cacheCleanup()
+
+	// 如果当前在web目录或其上级目录，使用磁盘上的templates和static，否则使用内嵌的默认文件
+	if err := ws.loadAssets(); err != nil {
+		return err
+	}
 
 	ws.server = &http.Server{
 		Addr:           ":" + ws.port,
-		Handler:        nil,
+		Handler:        ws.routes(),
 		ReadTimeout:    30 * time.Second,
 		WriteTimeout:   30 * time.Second,
 		IdleTimeout:    60 * time.Second,
@@ -127,11 +296,47 @@ func (ws *WebServer) Start() error {
 	}
 
 	fmt.Printf("日志管理Web服务器启动在 http://localhost:%s\n", ws.port)
-	fmt.Printf("模板目录: %s\n", templateDir)
-	fmt.Printf("静态文件目录: %s\n", staticDir)
+	fmt.Printf("页面模板和静态文件: %s\n", ws.assets.source)
+	if ws.assets.reload {
+		fmt.Println("每次请求重新解析模板")
+	}
 	return ws.server.ListenAndServe()
 }
 
+// routes 注册所有页面和API路由，每个路由都经过中间件链
+// 健康检查、运行指标、日志流和静态文件不限流
+func (ws *WebServer) routes() http.Handler {
+	mux := http.NewServeMux()
+	handle := ws.handleFunc(mux)
+
+	// 静态文件服务
+	handle("/static/", ws.assets.staticHandler().ServeHTTP, MiddlewareRateLimit)
+
+	handle("/api/files", ws.getLogFiles)
+	handle("/api/search", ws.searchLogs)
+	handle("/api/errors", ws.getErrorLogs)
+	handle("/api/stats", ws.getLogStats)
+
+	// RESTful API
+	NewAPIServer(ws).registerRoutes(handle)
+
+	// 文件操作路由
+	handle("/api/files/delete/", ws.handleDeleteFile)
+	handle("/api/files/content/", ws.handleGetContent)
+	handle("/api/files/upload", ws.handleUploadFile)
+	handle(streamPath, ws.handleLogStream, MiddlewareRateLimit)
+
+	// 页面路由
+	handle("/", ws.securityHeaders(ws.indexPage))
+	handle("/view/", ws.securityHeaders(func(w http.ResponseWriter, r *http.Request) {
+		filename := strings.TrimPrefix(r.URL.Path, "/view/")
+		ws.viewLogPage(w, r, filename)
+	}))
+	handle("/errors", ws.securityHeaders(ws.errorsPage))
+
+	return mux
+}
+
 func (ws *WebServer) handleDeleteFile(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "DELETE" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -147,73 +352,62 @@ func (ws *WebServer) handleGetContent(w http.ResponseWriter, r *http.Request) {
 	ws.getLogContent(w, r, filename)
 }
 
-func (ws *WebServer) indexPage(w http.ResponseWriter, r *http.Request, templateDir string) {
-	tmpl, err := template.ParseFiles(filepath.Join(templateDir, "index.html"))
-	if err != nil {
-		http.Error(w, fmt.Sprintf("解析模板失败: %v", err), http.StatusInternalServerError)
-		return
-	}
-	tmpl.Execute(w, nil)
+func (ws *WebServer) indexPage(w http.ResponseWriter, r *http.Request) {
+	ws.assets.render(w, "index.html", nil)
 }
 
-func (ws *WebServer) viewLogPage(w http.ResponseWriter, r *http.Request, filename string, templateDir string) {
-	tmpl, err := template.ParseFiles(filepath.Join(templateDir, "view.html"))
+// viewLogPage 渲染日志查看页面，与文件内容接口一样校验文件名，日志目录中没有该文件时返回404
+func (ws *WebServer) viewLogPage(w http.ResponseWriter, r *http.Request, filename string) {
+	path, err := aggregate.ResolveLogPath(ws.logDir, filename)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("解析模板失败: %v", err), http.StatusInternalServerError)
+		http.NotFound(w, r)
+		return
+	}
+	if stat, err := os.Stat(path); err != nil || !stat.Mode().IsRegular() {
+		http.NotFound(w, r)
 		return
 	}
 
 	data := map[string]interface{}{
 		"Filename": filename,
 	}
-	tmpl.Execute(w, data)
+	ws.assets.render(w, "view.html", data)
 }
 
-func (ws *WebServer) errorsPage(w http.ResponseWriter, r *http.Request, templateDir string) {
-	tmpl, err := template.ParseFiles(filepath.Join(templateDir, "errors.html"))
-	if err != nil {
-		http.Error(w, fmt.Sprintf("解析模板失败: %v", err), http.StatusInternalServerError)
-		return
-	}
-	tmpl.Execute(w, nil)
+func (ws *WebServer) errorsPage(w http.ResponseWriter, r *http.Request) {
+	ws.assets.render(w, "errors.html", nil)
 }
 
 func (ws *WebServer) getLogFiles(w http.ResponseWriter, r *http.Request) {
-	files, err := filepath.Glob(filepath.Join(ws.logDir, "*.log*"))
+	list, err := parseFileListOptions(r.URL.Query())
 	if err != nil {
-		ws.sendJSONResponse(w, false, nil, err.Error())
+		ws.sendJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-
-	var fileInfos []FileInfo
-	for _, file := range files {
-		stat, err := os.Stat(file)
-		if err != nil {
-			continue
-		}
-
-		fileInfo := FileInfo{
-			Name:         filepath.Base(file),
-			Size:         stat.Size(),
-			ModTime:      stat.ModTime(),
-			IsCompressed: strings.HasSuffix(file, ".gz"),
-		}
-		fileInfos = append(fileInfos, fileInfo)
+	fileInfos, total, err := ws.getLogFilesList(list)
+	if err != nil {
+		ws.sendJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if wantChecksum(r) {
+		ws.withChecksums(fileInfos)
 	}
 
-	ws.sendJSONResponse(w, true, fileInfos, "")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	json.NewEncoder(w).Encode(LogViewResponse{Success: true, Data: fileInfos, Total: &total})
 }
 
 func (ws *WebServer) deleteLogFile(w http.ResponseWriter, r *http.Request, filename string) {
-	// 安全检查：确保文件名不包含路径遍历
-	if strings.Contains(filename, "..") || strings.Contains(filename, "/") {
-		ws.sendJSONResponse(w, false, nil, "无效的文件名")
+	// 安全检查：确保文件位于日志目录内
+	filepath, err := aggregate.ResolveLogPath(ws.logDir, filename)
+	if err != nil {
+		ws.sendJSONError(w, http.StatusBadRequest, "无效的文件名")
 		return
 	}
 
-	filepath := filepath.Join(ws.logDir, filename)
 	if err := os.Remove(filepath); err != nil {
-		ws.sendJSONResponse(w, false, nil, err.Error())
+		ws.sendJSONError(w, fileErrorStatus(err), err.Error())
 		return
 	}
 
@@ -222,17 +416,40 @@ func (ws *WebServer) deleteLogFile(w http.ResponseWriter, r *http.Request, filen
 
 func (ws *WebServer) getLogContent(w http.ResponseWriter, r *http.Request, filename string) {
 	// 安全检查
-	if strings.Contains(filename, "..") || strings.Contains(filename, "/") {
-		ws.sendJSONResponse(w, false, nil, "无效的文件名")
+	filepath, err := aggregate.ResolveLogPath(ws.logDir, filename)
+	if err != nil {
+		ws.sendJSONError(w, http.StatusBadRequest, "无效的文件名")
 		return
 	}
 
-	filepath := filepath.Join(ws.logDir, filename)
-
 	// 获取查询参数
 	limitStr := r.URL.Query().Get("limit")
 	offsetStr := r.URL.Query().Get("offset")
-	search := r.URL.Query().Get("search")
+	filter, err := parseContentFilter(r.URL.Query())
+	if err != nil {
+		ws.sendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	mode, err := parseContentMode(r.URL.Query(), filter)
+	if err != nil {
+		ws.sendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch mode.mode {
+	case contentModeTail:
+		content, err := ws.readTail(r.Context(), filepath, mode.lines, filter)
+		if err != nil {
+			ws.sendJSONError(w, contentModeStatus(err), err.Error())
+			return
+		}
+		ws.sendJSONResponse(w, true, content.result(filter, mode.lines), "")
+		return
+	case contentModeRange:
+		if err := ws.serveByteRange(w, filepath, mode); err != nil {
+			ws.sendJSONError(w, contentModeStatus(err), err.Error())
+		}
+		return
+	}
 
 	limit := 1000 // 默认限制
 	offset := 0
@@ -249,20 +466,13 @@ func (ws *WebServer) getLogContent(w http.ResponseWriter, r *http.Request, filen
 		}
 	}
 
-	content, total, err := ws.readLogFile(filepath, limit, offset, search)
+	content, err := ws.readLogFile(r.Context(), filepath, limit, offset, filter)
 	if err != nil {
-		ws.sendJSONResponse(w, false, nil, err.Error())
+		ws.sendJSONError(w, fileErrorStatus(err), err.Error())
 		return
 	}
 
-	result := map[string]interface{}{
-		"content": content,
-		"total":   total,
-		"limit":   limit,
-		"offset":  offset,
-	}
-
-	ws.sendJSONResponse(w, true, result, "")
+	ws.sendJSONResponse(w, true, content.result(filter, limit, offset), "")
 }
 
 func (ws *WebServer) searchLogs(w http.ResponseWriter, r *http.Request) {
@@ -271,39 +481,60 @@ func (ws *WebServer) searchLogs(w http.ResponseWriter, r *http.Request) {
 		SpanID    string    `json:"span_id"`
 		Level     string    `json:"level"`
 		Service   string    `json:"service"`
+		Hostname  string    `json:"hostname"`
 		Message   string    `json:"message"`
 		StartTime time.Time `json:"start_time"`
 		EndTime   time.Time `json:"end_time"`
 		Limit     int       `json:"limit"`
 		Offset    int       `json:"offset"`
 		UseIndex  bool      `json:"use_index"`
+		Strict    bool      `json:"strict"`
+		Explain   bool      `json:"explain"`
+		SortOrder string    `json:"sort_order"`
+		Since     string    `json:"since"`
+		Until     string    `json:"until"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		ws.sendJSONResponse(w, false, nil, err.Error())
+		ws.sendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var err error
+	if request.StartTime, request.EndTime, err = resolveTimeRange(request.StartTime, request.EndTime, request.Since, request.Until, nil); err != nil {
+		ws.sendQueryError(w, err)
 		return
 	}
 
-	query := logz.LogQuery{
+	level, err := parseLevelParam(request.Level)
+	if err != nil {
+		ws.sendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := aggregate.LogQuery{
 		TraceID:   request.TraceID,
 		SpanID:    request.SpanID,
-		Level:     request.Level,
+		Level:     level,
 		Service:   request.Service,
+		Hostname:  request.Hostname,
 		Message:   request.Message,
 		StartTime: request.StartTime,
 		EndTime:   request.EndTime,
 		Limit:     request.Limit,
 		Offset:    request.Offset,
 		UseIndex:  request.UseIndex,
+		Strict:    request.Strict,
+		Explain:   request.Explain || wantExplain(r),
+		SortOrder: request.SortOrder,
 	}
 
-	result, err := logz.QueryLogs(query, ws.logDir)
+	result, err := ws.queryLogs(r.Context(), query)
 	if err != nil {
-		ws.sendJSONResponse(w, false, nil, err.Error())
+		ws.sendQueryError(w, err)
 		return
 	}
 
-	ws.sendJSONResponse(w, true, result, "")
+	ws.sendJSONResponse(w, true, ws.displayResult(result, nil), "")
 }
 
 func (ws *WebServer) getErrorLogs(w http.ResponseWriter, r *http.Request) {
@@ -325,114 +556,282 @@ func (ws *WebServer) getErrorLogs(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	query := logz.LogQuery{
+	query := aggregate.LogQuery{
 		Level:    "error",
 		Limit:    limit,
 		Offset:   offset,
 		UseIndex: true,
 	}
 
-	result, err := logz.QueryLogs(query, ws.logDir)
+	result, err := ws.queryLogs(r.Context(), query)
 	if err != nil {
-		ws.sendJSONResponse(w, false, nil, err.Error())
+		ws.sendQueryError(w, err)
 		return
 	}
 
-	ws.sendJSONResponse(w, true, result, "")
+	ws.sendJSONResponse(w, true, ws.displayResult(result, nil), "")
+}
+
+// logQuery 为查询条件补充日志文件查找配置
+func (ws *WebServer) logQuery(query aggregate.LogQuery) aggregate.LogQuery {
+	query.PathPatterns = ws.discovery.Patterns
+	query.Recursive = ws.discovery.Recursive
+	query.Subdirs = ws.discovery.Subdirs
+	query.IncludeRawLogs = len(ws.rawLogPaths) > 0
+	return query
+}
+
+// logStats /api/stats和/api/v1/stats的响应：日志文件的统计，
+// 查询本地日志目录且有全局聚合器时附带索引中按级别和服务统计的条目数
+type logStats struct {
+	*aggregate.LogStats
+	EntriesByLevel   map[string]int `json:"entries_by_level,omitempty"`
+	EntriesByService map[string]int `json:"entries_by_service,omitempty"`
+	IndexSizeBytes   int64          `json:"index_size_bytes,omitempty"`
+}
+
+// collectStats 统计日志文件，索引统计失败时只返回文件统计
+func (ws *WebServer) collectStats(ctx context.Context) (*logStats, error) {
+	stats, err := ws.store.Stats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := &logStats{LogStats: stats}
+	if _, local := ws.store.(*aggregate.DirStore); !local {
+		return result, nil
+	}
+	if aggregator := aggregate.GetGlobalAggregator(); aggregator != nil {
+		indexStats, err := aggregate.GetIndexStats(aggregator)
+		if err != nil {
+			log.Printf("统计索引失败: %v", err)
+			return result, nil
+		}
+		result.EntriesByLevel = indexStats.EntriesByLevel
+		result.EntriesByService = indexStats.EntriesByService
+		result.IndexSizeBytes = indexStats.IndexSizeBytes
+	}
+	return result, nil
 }
 
 func (ws *WebServer) getLogStats(w http.ResponseWriter, r *http.Request) {
-	stats, err := logz.GetLogStats(ws.logDir)
+	stats, err := ws.collectStats(r.Context())
 	if err != nil {
-		ws.sendJSONResponse(w, false, nil, err.Error())
+		ws.sendQueryError(w, err)
 		return
 	}
 
 	ws.sendJSONResponse(w, true, stats, "")
 }
 
-func (ws *WebServer) readLogFile(filepath string, limit, offset int, search string) ([]string, int, error) {
+// readLogFile 读取文件中匹配过滤条件的一页内容，结果按文件路径、分页和过滤条件缓存
+func (ws *WebServer) readLogFile(ctx context.Context, filepath string, limit, offset int, filter contentFilter) (*fileContent, error) {
+	ctx, span := trace.StartInternalSpan(ctx, "logz.web.readLogFile")
+	defer span.End()
+	trace.SetAttribute(span, "logz.file", aggregate.RelativeLogPath(ws.logDir, filepath))
+
 	// 检查缓存
-	cacheKey := fmt.Sprintf("%s:%d:%d:%s", filepath, limit, offset, search)
-	ws.cacheMutex.RLock()
-	if entry, exists := ws.fileCache[cacheKey]; exists && time.Now().Before(entry.expiry) {
-		stat, err := os.Stat(filepath)
-		if err == nil && !stat.ModTime().After(entry.lastMod) {
-			ws.cacheMutex.RUnlock()
-			return entry.content, entry.total, nil
-		}
+	cacheKey := fmt.Sprintf("%s:%d:%d:%s", filepath, limit, offset, filter.cacheKey())
+	if entry := ws.cachedFile(ctx, cacheKey, filepath); entry != nil {
+		return entry.content, nil
 	}
-	ws.cacheMutex.RUnlock()
 
 	// 读取文件
-	content, total, err := ws.readFileContent(filepath, limit, offset, search)
+	content, scanned, err := ws.readFileContent(ctx, filepath, limit, offset, filter)
+	trace.SetAttribute(span, "logz.bytes_scanned", scanned)
 	if err != nil {
-		return nil, 0, err
+		trace.RecordError(span, err)
+		return nil, err
 	}
+	trace.SetAttribute(span, "logz.lines_total", content.total)
 
 	// 更新缓存
+	_, cacheTTL := ws.settings()
 	ws.cacheMutex.Lock()
 	stat, _ := os.Stat(filepath)
 	ws.fileCache[cacheKey] = &fileCacheEntry{
 		content: content,
-		total:   total,
 		lastMod: stat.ModTime(),
-		expiry:  time.Now().Add(5 * time.Minute), // 5分钟缓存
+		expiry:  time.Now().Add(cacheTTL),
 	}
 	ws.cacheMutex.Unlock()
 
-	return content, total, nil
+	return content, nil
+}
+
+// cachedFile 在子span中查找未过期且文件未修改的缓存，未命中时返回nil
+func (ws *WebServer) cachedFile(ctx context.Context, cacheKey, filepath string) *fileCacheEntry {
+	_, span := trace.StartInternalSpan(ctx, "logz.web.cacheLookup")
+	defer span.End()
+
+	ws.cacheMutex.RLock()
+	defer ws.cacheMutex.RUnlock()
+	if entry, exists := ws.fileCache[cacheKey]; exists && time.Now().Before(entry.expiry) {
+		stat, err := os.Stat(filepath)
+		if err == nil && !stat.ModTime().After(entry.lastMod) {
+			trace.SetAttribute(span, "logz.cache.hit", true)
+			return entry
+		}
+	}
+	trace.SetAttribute(span, "logz.cache.hit", false)
+	return nil
 }
 
-func (ws *WebServer) readFileContent(filepath string, limit, offset int, search string) ([]string, int, error) {
-	// 支持压缩文件
-	var reader *bufio.Scanner
+// contentCtxCheckInterval 读取文件内容时每隔多少行检查一次ctx
+const contentCtxCheckInterval = 1000
+
+// readFileContent 读取文件内容，同时返回从磁盘读取的字节数，ctx超时或取消后停止读取
+// 超过logz.MaxLineSize的行计入总行数，但不返回、不参与过滤
+// 未压缩的文件使用行偏移缓存：从offset之前最近的检查点开始读取这一页，总行数从上次读取的末尾继续统计
+func (ws *WebServer) readFileContent(ctx context.Context, filepath string, limit, offset int, filter contentFilter) (*fileContent, int64, error) {
 	file, err := os.Open(filepath)
 	if err != nil {
 		return nil, 0, err
 	}
 	defer file.Close()
 
-	if strings.HasSuffix(filepath, ".gz") {
-		gzReader, err := gzip.NewReader(file)
-		if err != nil {
-			return nil, 0, err
+	scan := &contentScan{content: &fileContent{}, filter: filter, search: strings.ToLower(filter.search), limit: limit, offset: offset}
+	if !strings.HasSuffix(filepath, ".gz") {
+		return ws.readPlainContent(ctx, file, filepath, scan)
+	}
+
+	// 压缩文件只能从头读取
+	counter := &countingReader{reader: file}
+	gzReader, err := gzip.NewReader(counter)
+	if err != nil {
+		return nil, counter.n, err
+	}
+	defer gzReader.Close()
+	if _, err := scan.scan(ctx, aggregate.NewLineReader(gzReader), 0, false, nil); err != nil {
+		return nil, counter.n, err
+	}
+	return scan.content, counter.n, nil
+}
+
+// readPlainContent 使用行偏移缓存读取未压缩文件的一页内容
+func (ws *WebServer) readPlainContent(ctx context.Context, file *os.File, filepath string, scan *contentScan) (*fileContent, int64, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	key := filepath + "\x00" + scan.filter.matchKey()
+	offsets := newLineOffsets(stat)
+	var read int64
+
+	if known := ws.lineOffsets.get(key); known != nil && known.valid(file, stat) {
+		// 这一页在已读取的范围内时读取到取满为止，然后跳到已读取的末尾统计新增的行
+		if start := known.before(scan.offset); start.offset < known.end.offset {
+			section := &countingReader{reader: io.NewSectionReader(file, start.offset, known.end.offset-start.offset)}
+			scan.content.seek(start)
+			_, err := scan.scan(ctx, aggregate.NewLineReader(section), start.offset, true, nil)
+			read += section.n
+			if err != nil {
+				return nil, read, err
+			}
+		}
+		offsets = known.clone(stat)
+	} else if known != nil {
+		ws.lineOffsets.remove(key)
+	}
+
+	start := offsets.end
+	section := &countingReader{reader: io.NewSectionReader(file, start.offset, math.MaxInt64-start.offset)}
+	scan.content.seek(start)
+	last, err := scan.scan(ctx, aggregate.NewLineReader(section), start.offset, false, offsets)
+	read += section.n
+	if err != nil {
+		return nil, read, err
+	}
+
+	// 最后一行没有换行符时可能还在写入，下次从这一行重新读取
+	offsets.end = scan.content.checkpoint(start.offset + section.n)
+	if section.n > 0 {
+		var lastByte [1]byte
+		if _, err := file.ReadAt(lastByte[:], start.offset+section.n-1); err != nil || lastByte[0] != '\n' {
+			offsets.end = last
 		}
-		defer gzReader.Close()
-		reader = bufio.NewScanner(gzReader)
-	} else {
-		reader = bufio.NewScanner(file)
 	}
+	ws.lineOffsets.put(key, offsets)
+	return scan.content, read, nil
+}
 
-	// 设置更大的缓冲区
-	buf := make([]byte, 0, 64*1024)
-	reader.Buffer(buf, 1024*1024)
+// contentScan 按行分页读取文件内容的过滤和分页状态
+type contentScan struct {
+	content   *fileContent
+	filter    contentFilter
+	search    string // 小写的search参数
+	limit     int
+	offset    int
+	collected int
+}
 
-	var lines []string
-	var total int
-	var matched int
+// scan 读取reader中的行，base为reader在文件中的起始位置；stopWhenFull为true时取满一页后停止
+// offsets不为nil时记录检查点，返回最后一行开始时的状态
+func (s *contentScan) scan(ctx context.Context, reader *aggregate.LineReader, base int64, stopWhenFull bool, offsets *lineOffsets) (last lineCheckpoint, err error) {
+	content := s.content
+	for !(stopWhenFull && s.collected >= s.limit) && reader.Scan() {
+		last = content.checkpoint(base + reader.Offset())
+		if offsets != nil {
+			offsets.record(last)
+		}
 
-	for reader.Scan() {
+		content.total++
+		if content.total%contentCtxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return last, err
+			}
+		}
+		if reader.TooLong() {
+			content.skipped++
+			continue
+		}
 		line := reader.Text()
-		total++
 
 		// 应用搜索过滤
-		if search != "" && !strings.Contains(strings.ToLower(line), strings.ToLower(search)) {
+		if s.search != "" && !strings.Contains(strings.ToLower(line), s.search) {
 			continue
 		}
 
+		// 解析模式下跳过空行，并按解析后的级别过滤
+		var row LogRow
+		if s.filter.parse {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			var ok bool
+			if row, ok = s.filter.parseRow(content.total, line); !ok {
+				continue
+			}
+		}
+
 		// 应用分页
-		if matched >= offset && len(lines) < limit {
-			lines = append(lines, line)
+		if content.matched >= s.offset && s.collected < s.limit {
+			if s.filter.parse {
+				content.rows = append(content.rows, row)
+			} else {
+				content.lines = append(content.lines, line)
+			}
+			s.collected++
 		}
-		matched++
+		content.matched++
 	}
-
-	return lines, total, reader.Err()
+	return last, reader.Err()
 }
 
+// sendJSONResponse 返回状态码为200的JSON响应
 func (ws *WebServer) sendJSONResponse(w http.ResponseWriter, success bool, data interface{}, errorMsg string) {
+	ws.sendJSONResponseWithStatus(w, http.StatusOK, success, data, errorMsg)
+}
+
+// sendJSONError 返回指定状态码的失败响应，响应体格式与sendJSONResponse相同
+func (ws *WebServer) sendJSONError(w http.ResponseWriter, statusCode int, errorMsg string) {
+	ws.sendJSONResponseWithStatus(w, statusCode, false, nil, errorMsg)
+}
+
+// sendJSONResponseWithStatus 返回指定状态码的JSON响应
+func (ws *WebServer) sendJSONResponseWithStatus(w http.ResponseWriter, statusCode int, success bool, data interface{}, errorMsg string) {
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(statusCode)
 
 	response := LogViewResponse{
 		Success: success,
@@ -443,11 +842,31 @@ func (ws *WebServer) sendJSONResponse(w http.ResponseWriter, success bool, data
 	json.NewEncoder(w).Encode(response)
 }
 
-func (ws *WebServer) getLogFilesList() ([]FileInfo, error) {
-	files, err := filepath.Glob(filepath.Join(ws.logDir, "*.log*"))
+// fileErrorStatus 文件不存在时返回404，读取超时返回504，其他文件错误返回500
+func fileErrorStatus(err error) int {
+	if errors.Is(err, fs.ErrNotExist) {
+		return http.StatusNotFound
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+// getLogFilesList 按list过滤、排序和分页日志文件，返回当前页和过滤后的文件总数
+func (ws *WebServer) getLogFilesList(list fileListOptions) ([]FileInfo, int, error) {
+	opts := ws.discovery
+	if len(ws.listPatterns) > 0 {
+		opts.Patterns = ws.listPatterns
+	}
+	if len(opts.Patterns) == 0 {
+		opts.Patterns = defaultListPatterns
+	}
+	files, err := aggregate.DiscoverLogFiles(ws.logDir, opts)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
+	now := time.Now()
 	var fileInfos []FileInfo
 	for _, file := range files {
 		stat, err := os.Stat(file)
@@ -455,129 +874,67 @@ func (ws *WebServer) getLogFilesList() ([]FileInfo, error) {
 			continue
 		}
 		fileInfo := FileInfo{
-			Name:         filepath.Base(file),
+			Name:         aggregate.RelativeLogPath(ws.logDir, file),
 			Size:         stat.Size(),
 			ModTime:      stat.ModTime(),
 			IsCompressed: strings.HasSuffix(file, ".gz"),
+			AgeBucket:    fileAgeBucket(stat.ModTime(), now),
 		}
 		fileInfos = append(fileInfos, fileInfo)
 	}
-	return fileInfos, nil
-}
-
-// 中间件函数
-func (ws *WebServer) corsHandler(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Max-Age", "86400")
-		
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-		
-		next(w, r)
-	}
+	page, total := list.apply(fileInfos)
+	return page, total, nil
 }
 
 func (ws *WebServer) rateLimitHandler(next http.HandlerFunc) http.HandlerFunc {
 	var requests = make(map[string][]time.Time)
 	var mutex sync.Mutex
-	
+
 	return func(w http.ResponseWriter, r *http.Request) {
-		clientIP := r.RemoteAddr
+		// 使用API密钥的请求按密钥计数，否则按客户端IP计数
+		clientID := ws.clientIP(r)
+		key := apiKeyFromContext(r.Context())
+		if key != nil {
+			clientID = "key:" + key.name
+		}
 		now := time.Now()
-		
+
 		mutex.Lock()
 		// 清理过期的请求记录
-		if times, exists := requests[clientIP]; exists {
+		if times, exists := requests[clientID]; exists {
 			var validTimes []time.Time
 			for _, t := range times {
 				if now.Sub(t) < time.Minute {
 					validTimes = append(validTimes, t)
 				}
 			}
-			requests[clientIP] = validTimes
+			requests[clientID] = validTimes
 		}
-		
-		// 检查速率限制（每分钟100次请求）
-		if len(requests[clientIP]) >= 100 {
+
+		// 检查速率限制（每分钟请求数）
+		rateLimit, _ := ws.settings()
+		if len(requests[clientID]) >= rateLimit {
 			mutex.Unlock()
+			if key != nil {
+				ws.apiKeyUsage(key.name).rateLimited.Add(1)
+			}
 			http.Error(w, "Rate limit exceeded", http.StatusTooManyRequests)
 			return
 		}
-		
+
 		// 记录当前请求
-		requests[clientIP] = append(requests[clientIP], now)
+		requests[clientID] = append(requests[clientID], now)
 		mutex.Unlock()
-		
+
 		next(w, r)
 	}
 }
 
-func (ws *WebServer) logHandler(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		
-		// 创建响应记录器
-		rec := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
-		
-		next(rec, r)
-		
-		// 记录请求日志
-		duration := time.Since(start)
-		log.Printf("%s %s %d %v %s", r.Method, r.URL.Path, rec.statusCode, duration, r.RemoteAddr)
-	}
-}
-
-func (ws *WebServer) gzipHandler(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
-			next.ServeHTTP(w, r)
-			return
-		}
-		
-		w.Header().Set("Content-Encoding", "gzip")
-		gzWriter := gzip.NewWriter(w)
-		defer gzWriter.Close()
-		
-		gzResponseWriter := &gzipResponseWriter{writer: gzWriter, ResponseWriter: w}
-		next.ServeHTTP(gzResponseWriter, r)
-	})
-}
-
-// 响应记录器
-type responseRecorder struct {
-	http.ResponseWriter
-	statusCode int
-}
-
-func (r *responseRecorder) WriteHeader(statusCode int) {
-	r.statusCode = statusCode
-	r.ResponseWriter.WriteHeader(statusCode)
-}
-
-// Gzip响应写入器
-type gzipResponseWriter struct {
-	http.ResponseWriter
-	writer *gzip.Writer
-}
-
-func (w *gzipResponseWriter) Write(b []byte) (int, error) {
-	return w.writer.Write(b)
-}
-
-func (w *gzipResponseWriter) Header() http.Header {
-	return w.ResponseWriter.Header()
-}
-
 // 缓存清理
 func (ws *WebServer) cacheCleanup() {
 	ticker := time.NewTicker(10 * time.Minute)
 	defer ticker.Stop()
-	
+
 	for {
 		select {
 		case <-ticker.C:
@@ -589,29 +946,78 @@ func (ws *WebServer) cacheCleanup() {
 				}
 			}
 			ws.cacheMutex.Unlock()
+			ws.queryCache.cleanup(now)
 		case <-ws.shutdownCh:
 			return
 		}
 	}
 }
 
-// 实时日志流
-func (ws *WebServer) startLogStreaming() {
-	// 这里可以实现实时日志推送逻辑
-	// 例如监控日志文件变化，推送到WebSocket客户端
-}
-
-// 处理日志流连接
+// handleLogStream 以SSE推送连接之后新写入的日志，可用level、service、trace_id、span_id、message参数过滤
+// 使用DirStore时所有连接共享同一个LogWatcher
+// 先推送{"type":"connected"}，之后每条日志推送{"type":"log","entry":{...}}
 func (ws *WebServer) handleLogStream(w http.ResponseWriter, r *http.Request) {
-	// 实现WebSocket连接处理逻辑
+	params := r.URL.Query()
+	level, err := parseLevelParam(params.Get("level"))
+	if err != nil {
+		ws.sendJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	query := aggregate.LogQuery{
+		Level:    level,
+		Service:  params.Get("service"),
+		Hostname: params.Get("hostname"),
+		TraceID:  params.Get("trace_id"),
+		SpanID:   params.Get("span_id"),
+		Message:  params.Get("message"),
+	}
+
+	// 在发送响应头之前开始跟踪，客户端收到响应后写入的日志都会被推送
+	entries, err := ws.store.Tail(r.Context(), query)
+	if err != nil {
+		ws.sendJSONError(w, http.StatusInternalServerError, fmt.Sprintf("跟踪日志失败: %v", err))
+		return
+	}
+
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
-	
-	// 发送初始消息
-	fmt.Fprintf(w, "data: {\"type\":\"connected\"}\n\n")
-	
-	// 这里可以实现具体的流式推送逻辑
+
+	// 日志流连接不受服务器WriteTimeout限制
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	// 每条消息按采样记录子span，而不是为整个连接创建一个span
+	stream := newStreamTracer(r.Context(), r, ws.clientIP(r))
+	send := func(messageType string, event map[string]interface{}) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		n, err := fmt.Fprintf(w, "data: %s\n\n", data)
+		if err == nil {
+			err = rc.Flush()
+		}
+		stream.message(messageType, n)
+		return err
+	}
+
+	if send("connected", map[string]interface{}{"type": "connected"}) != nil {
+		return
+	}
+	for {
+		select {
+		case entry, ok := <-entries:
+			if !ok {
+				return
+			}
+			if send("log", map[string]interface{}{"type": "log", "entry": entry}) != nil {
+				return
+			}
+		case <-ws.shutdownCh:
+			return
+		}
+	}
 }
 
 // 处理文件上传
@@ -620,41 +1026,41 @@ func (ws *WebServer) handleUploadFile(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	
+
 	// 限制上传文件大小为10MB
 	err := r.ParseMultipartForm(10 << 20)
 	if err != nil {
-		ws.sendJSONResponse(w, false, nil, "解析上传文件失败")
+		ws.sendJSONError(w, http.StatusBadRequest, "解析上传文件失败")
 		return
 	}
-	
+
 	file, handler, err := r.FormFile("file")
 	if err != nil {
-		ws.sendJSONResponse(w, false, nil, "获取上传文件失败")
+		ws.sendJSONError(w, http.StatusBadRequest, "获取上传文件失败")
 		return
 	}
 	defer file.Close()
-	
+
 	// 验证文件类型
 	if !strings.HasSuffix(handler.Filename, ".log") && !strings.HasSuffix(handler.Filename, ".log.gz") {
-		ws.sendJSONResponse(w, false, nil, "只支持.log和.log.gz文件")
+		ws.sendJSONError(w, http.StatusBadRequest, "只支持.log和.log.gz文件")
 		return
 	}
-	
+
 	// 保存文件
 	dstPath := filepath.Join(ws.logDir, handler.Filename)
 	dst, err := os.Create(dstPath)
 	if err != nil {
-		ws.sendJSONResponse(w, false, nil, "创建文件失败")
+		ws.sendJSONError(w, http.StatusInternalServerError, "创建文件失败")
 		return
 	}
 	defer dst.Close()
-	
+
 	if _, err := io.Copy(dst, file); err != nil {
-		ws.sendJSONResponse(w, false, nil, "保存文件失败")
+		ws.sendJSONError(w, http.StatusInternalServerError, "保存文件失败")
 		return
 	}
-	
+
 	ws.sendJSONResponse(w, true, map[string]string{"message": "文件上传成功"}, "")
 }
 
@@ -682,7 +1088,72 @@ func main() {
 		return
 	}
 
-	server := NewWebServer(logDir, port)
+	var opts []WebServerOption
+	if envPatterns := os.Getenv("LOG_PATTERNS"); envPatterns != "" {
+		opts = append(opts, WithFilePatterns(strings.Split(envPatterns, ",")...))
+	}
+	if envPatterns := os.Getenv(fileListPatternsEnv); envPatterns != "" {
+		opts = append(opts, WithFileListPatterns(strings.Split(envPatterns, ",")...))
+	}
+	if recursive, err := strconv.ParseBool(os.Getenv("LOG_RECURSIVE")); err == nil {
+		opts = append(opts, WithRecursive(recursive))
+	}
+	if reload, err := strconv.ParseBool(os.Getenv(templateReloadEnv)); err == nil {
+		opts = append(opts, WithTemplateReload(reload))
+	}
+	if enabled, err := strconv.ParseBool(os.Getenv(gzipEnabledEnv)); err == nil {
+		opts = append(opts, WithGzip(enabled))
+	}
+	if threshold, err := time.ParseDuration(os.Getenv(slowRequestEnv)); err == nil && threshold >= 0 {
+		opts = append(opts, WithSlowRequestThreshold(threshold))
+	}
+	if ttl, err := time.ParseDuration(os.Getenv(dashboardCacheTTLEnv)); err == nil && ttl >= 0 {
+		opts = append(opts, WithDashboardCacheTTL(ttl))
+	}
+	if ttl, err := time.ParseDuration(os.Getenv(queryCacheTTLEnv)); err == nil && ttl >= 0 {
+		opts = append(opts, WithQueryCache(ttl, defaultQueryCacheQueries))
+	}
+	if value := os.Getenv(writeFallbackEnv); value != "" {
+		if mode, err := aggregate.ParseFallbackMode(value); err == nil {
+			opts = append(opts, WithWriteFallback(mode))
+		} else {
+			log.Printf("无效的%s: %v", writeFallbackEnv, err)
+		}
+	}
+
+	if value := os.Getenv(ingestFieldsEnv); value != "" {
+		if fields, err := parseIngestFields(value); err == nil {
+			opts = append(opts, WithIngestFields(fields...))
+		} else {
+			log.Printf("无效的%s: %v", ingestFieldsEnv, err)
+		}
+	}
+
+	opts = append(opts, ingestLimitsFromEnv()...)
+	opts = append(opts, queryOptionsFromEnv()...)
+	opts = append(opts, routeTimeoutsFromEnv()...)
+	opts = append(opts, traceLinkOptionsFromEnv()...)
+	opts = append(opts, remoteSourceOptionsFromEnv()...)
+	opts = append(opts, rawLogOptionsFromEnv()...)
+
+	// API密钥配置无效时拒绝启动，避免在未认证的情况下开放接口
+	if _, err := loadAPIKeys(); err != nil {
+		fmt.Printf("加载API密钥失败: %v\n", err)
+		return
+	}
+
+	tracing, shutdownTracing, err := initTracing()
+	if err != nil {
+		fmt.Printf("初始化追踪失败: %v\n", err)
+		return
+	}
+	defer shutdownTracing()
+	if tracing {
+		opts = append(opts, WithTracing(true))
+	}
+
+	server := NewWebServer(logDir, port, opts...)
+	server.HandleSignals(context.Background())
 	if err := server.Start(); err != nil {
 		fmt.Printf("启动Web服务器失败: %v\n", err)
 	}
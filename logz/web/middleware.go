@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"github.com/HsiaoL1/trace/logz"
+	"github.com/HsiaoL1/trace/logz/aggregate"
+	"github.com/sirupsen/logrus"
+)
+
+// Middleware 包装http.Handler的中间件
+type Middleware func(http.Handler) http.Handler
+
+// 内置中间件名称，用于WithMiddlewareOrder和WithoutMiddleware
+const (
+	MiddlewareRecovery  = "recovery"   // 处理函数panic时记录堆栈、计数并返回500
+	MiddlewareTracing   = "tracing"    // 启用追踪（WithTracing）时为请求创建server span
+	MiddlewareAuth      = "auth"       // 配置了API密钥时校验API请求的密钥和权限
+	MiddlewareRequestID = "request_id" // 沿用或生成X-Request-ID，记录在访问日志中
+	MiddlewareAccessLog = "access_log" // 访问日志和慢请求统计
+	MiddlewareCORS      = "cors"       // 跨域响应头和预检请求
+	MiddlewareRateLimit = "rate_limit" // 按客户端IP或API密钥限流
+	MiddlewareDeadline  = "deadline"   // 按路由分组设置请求超时，超时未响应时返回504
+	MiddlewareGzip      = "gzip"       // 压缩响应，WithGzip(false)时不生效
+)
+
+// DefaultMiddlewareOrder 内置中间件的默认顺序，前面的在外层
+// 追踪和认证紧接在recovery之内，其他中间件和处理函数的panic都记录在请求的span上；按API密钥限流需要先认证
+// 访问日志在CORS和限流之外，预检请求和被限流的请求也会被记录
+var DefaultMiddlewareOrder = []string{
+	MiddlewareRecovery,
+	MiddlewareTracing,
+	MiddlewareAuth,
+	MiddlewareRequestID,
+	MiddlewareAccessLog,
+	MiddlewareCORS,
+	MiddlewareRateLimit,
+	MiddlewareDeadline,
+	MiddlewareGzip,
+}
+
+// requestIDHeader 请求ID的请求头和响应头
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength 沿用客户端请求ID的最大长度，超过时重新生成
+const maxRequestIDLength = 128
+
+// requiredMiddleware 不能停用的内置中间件：追踪由WithTracing控制，认证由是否配置API密钥决定
+var requiredMiddleware = []string{MiddlewareTracing, MiddlewareAuth}
+
+// WithMiddlewareOrder 设置内置中间件的顺序（从外到内），未列出的内置中间件不启用，未知的名称被忽略
+// 未列出追踪和认证时按默认顺序放在recovery之内（没有recovery时在最外层）
+func WithMiddlewareOrder(names ...string) WebServerOption {
+	return func(ws *WebServer) {
+		var order []string
+		for _, name := range names {
+			if !slices.Contains(DefaultMiddlewareOrder, name) {
+				log.Printf("未知的中间件: %s", name)
+				continue
+			}
+			if !slices.Contains(order, name) {
+				order = append(order, name)
+			}
+		}
+		ws.middlewareOrder = withRequiredMiddleware(order)
+	}
+}
+
+// withRequiredMiddleware 将order中缺少的追踪和认证插入recovery之后
+func withRequiredMiddleware(order []string) []string {
+	at := 0
+	if i := slices.Index(order, MiddlewareRecovery); i >= 0 {
+		at = i + 1
+	}
+	for _, name := range requiredMiddleware {
+		if !slices.Contains(order, name) {
+			order = slices.Insert(order, at, name)
+			at++
+		} else {
+			at = max(at, slices.Index(order, name)+1)
+		}
+	}
+	return order
+}
+
+// WithoutMiddleware 停用指定的内置中间件，追踪和认证不能停用
+func WithoutMiddleware(names ...string) WebServerOption {
+	return func(ws *WebServer) {
+		ws.middlewareOrder = slices.DeleteFunc(ws.middlewareOrder, func(name string) bool {
+			return slices.Contains(names, name) && !slices.Contains(requiredMiddleware, name)
+		})
+	}
+}
+
+// Use 添加中间件，在内置中间件之内按添加顺序包装所有路由（先添加的在外层）
+// 需要在Start之前调用
+func (ws *WebServer) Use(mw func(http.Handler) http.Handler) {
+	ws.middleware = append(ws.middleware, mw)
+}
+
+// builtinMiddleware 返回内置中间件，pattern为路由注册时的模式
+func (ws *WebServer) builtinMiddleware(name, pattern string) Middleware {
+	switch name {
+	case MiddlewareRecovery:
+		return ws.recoveryHandler
+	case MiddlewareTracing:
+		return ws.traceHandler
+	case MiddlewareAuth:
+		return ws.authHandler
+	case MiddlewareRequestID:
+		return requestIDHandler
+	case MiddlewareAccessLog:
+		return func(next http.Handler) http.Handler { return ws.logHandler(next.ServeHTTP) }
+	case MiddlewareCORS:
+		return func(next http.Handler) http.Handler { return ws.corsHandler(next.ServeHTTP) }
+	case MiddlewareRateLimit:
+		return func(next http.Handler) http.Handler { return ws.rateLimitHandler(next.ServeHTTP) }
+	case MiddlewareDeadline:
+		return func(next http.Handler) http.Handler { return ws.deadlineHandler(pattern, next) }
+	case MiddlewareGzip:
+		return func(next http.Handler) http.Handler {
+			if !ws.gzipEnabled {
+				return next
+			}
+			return ws.gzipHandler(next)
+		}
+	}
+	return func(next http.Handler) http.Handler { return next }
+}
+
+// chain 用内置中间件和Use添加的中间件包装pattern的handler，exempt中的内置中间件不应用于该路由
+func (ws *WebServer) chain(pattern string, handler http.Handler, exempt ...string) http.Handler {
+	for i := len(ws.middleware) - 1; i >= 0; i-- {
+		handler = ws.middleware[i](handler)
+	}
+	for i := len(ws.middlewareOrder) - 1; i >= 0; i-- {
+		if name := ws.middlewareOrder[i]; !slices.Contains(exempt, name) {
+			handler = ws.builtinMiddleware(name, pattern)(handler)
+		}
+	}
+	return handler
+}
+
+// routeHandler 在mux上注册应用中间件链的路由
+type routeHandler func(pattern string, handler http.HandlerFunc, exempt ...string)
+
+// handleFunc 返回在mux上注册路由的routeHandler
+func (ws *WebServer) handleFunc(mux *http.ServeMux) routeHandler {
+	return func(pattern string, handler http.HandlerFunc, exempt ...string) {
+		mux.Handle(pattern, ws.chain(pattern, handler, exempt...))
+	}
+}
+
+// recoveryHandler 处理函数panic时通过logz记录调用栈和请求信息，计入panic次数；span上的错误由traceHandler记录
+// 尚未写出响应时返回500的APIResponse，只包含请求ID，不包含panic的内容；
+// 已经开始写出响应（如日志流）时中断该连接，客户端能发现响应不完整，服务器照常处理其他请求
+// http.ErrAbortHandler照常向上抛出，由net/http中断连接
+func (ws *WebServer) recoveryHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &responseRecorder{ResponseWriter: w}
+		defer func() {
+			value := recover()
+			if value == nil {
+				return
+			}
+			if value == http.ErrAbortHandler {
+				panic(value)
+			}
+			ws.requestStats.panics.Add(1)
+
+			// recoveryHandler在request_id之外，请求ID从响应头中取得，停用request_id时在这里生成
+			requestID := w.Header().Get(requestIDHeader)
+			if requestID == "" {
+				requestID = newRequestID()
+				w.Header().Set(requestIDHeader, requestID)
+			}
+			err := fmt.Errorf("panic: %v", value)
+			logz.WithErrorDetailed(err).WithContext(r.Context()).WithFields(logrus.Fields{
+				"http.method": r.Method,
+				"http.path":   r.URL.Path,
+				"http.query":  r.URL.RawQuery,
+				"client_ip":   ws.clientIP(r),
+				"request_id":  requestID,
+			}).Errorf("[PANIC] %s %s: %v", r.Method, r.URL.Path, value)
+
+			if rec.statusCode != 0 || rec.bytes != 0 {
+				panic(http.ErrAbortHandler)
+			}
+			NewAPIServer(ws).writeResponse(w, APIResponse{
+				Error:     "Internal server error",
+				Code:      http.StatusInternalServerError,
+				ErrorCode: aggregate.CodeInternal,
+			})
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+type requestIDContextKey struct{}
+
+// requestIDHandler 沿用客户端提供的X-Request-ID，没有或无效时生成，写入响应头和请求上下文
+func requestIDHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDContextKey{}, id)))
+	})
+}
+
+// requestIDFromContext 返回请求ID，没有经过requestIDHandler时返回空字符串
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// validRequestID 检查客户端提供的请求ID是否可以写入日志：非空、不超过长度限制且只包含可打印ASCII字符
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID 生成16字节的随机请求ID
+func newRequestID() string {
+	raw := make([]byte, 16)
+	rand.Read(raw)
+	return hex.EncodeToString(raw)
+}
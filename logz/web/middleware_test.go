@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/HsiaoL1/trace/logz"
+	"github.com/HsiaoL1/trace/logz/aggregate"
+	"github.com/HsiaoL1/trace/tracetest"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// serve 发送GET请求，返回响应记录
+func serve(handler http.Handler, path string, prepare func(*http.Request)) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if prepare != nil {
+		prepare(req)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestMiddlewareDefaultOrder(t *testing.T) {
+	t.Setenv(rateLimitEnv, "1")
+	logs := captureLog(t)
+	ws := NewWebServer(t.TempDir(), "8080")
+	defer close(ws.shutdownCh)
+	handler := ws.routes()
+
+	withID := func(req *http.Request) { req.Header.Set(requestIDHeader, "req-123") }
+	if w := serve(handler, "/api/files", withID); w.Code != http.StatusOK || w.Header().Get(requestIDHeader) != "req-123" {
+		t.Fatalf("期望请求通过并沿用请求ID，得到 %d %q", w.Code, w.Header().Get(requestIDHeader))
+	}
+
+	// 被限流的请求同样记录访问日志，并带有生成的请求ID
+	w := serve(handler, "/api/files", nil)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("期望第二个请求被限流，得到 %d", w.Code)
+	}
+	generated := w.Header().Get(requestIDHeader)
+	if len(generated) != 32 {
+		t.Errorf("期望生成32位请求ID，得到 %q", generated)
+	}
+	output := logs.String()
+	if !strings.Contains(output, "GET /api/files 200") || !strings.Contains(output, "request_id=req-123") {
+		t.Errorf("期望记录通过的请求，得到 %s", output)
+	}
+	if !strings.Contains(output, "GET /api/files 429") || !strings.Contains(output, "request_id="+generated) {
+		t.Errorf("期望记录被限流的请求，得到 %s", output)
+	}
+
+	// 健康检查和静态文件不限流，但经过其他中间件
+	for _, path := range []string{"/api/v1/health", "/static/app.js"} {
+		if w := serve(handler, path, nil); w.Code == http.StatusTooManyRequests || w.Header().Get(requestIDHeader) == "" {
+			t.Errorf("期望%s不限流且带有请求ID，得到 %d", path, w.Code)
+		}
+	}
+}
+
+func TestUseWrapsAllRoutes(t *testing.T) {
+	ws := NewWebServer(t.TempDir(), "8080")
+	defer close(ws.shutdownCh)
+
+	var order []string
+	ws.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			order = append(order, "outer")
+			w.Header().Set("X-Embedder", "yes")
+			next.ServeHTTP(w, r)
+		})
+	})
+	ws.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			order = append(order, "inner")
+			next.ServeHTTP(w, r)
+		})
+	})
+	handler := ws.routes()
+
+	paths := []string{"/", "/errors", "/view/app.log", "/static/app.js", "/api/files", "/api/search",
+		"/api/files/content/app.log", "/api/v1/stats", "/api/v1/health", "/api/v1/metrics", "/api/v1/files"}
+	for _, path := range paths {
+		order = nil
+		w := serve(handler, path, nil)
+		if w.Header().Get("X-Embedder") != "yes" {
+			t.Errorf("期望%s经过添加的中间件", path)
+		}
+		if strings.Join(order, ",") != "outer,inner" {
+			t.Errorf("期望%s按添加顺序包装，得到 %v", path, order)
+		}
+	}
+}
+
+func TestMiddlewareOptions(t *testing.T) {
+	t.Setenv(rateLimitEnv, "1")
+	logs := captureLog(t)
+	ws := NewWebServer(t.TempDir(), "8080", WithMiddlewareOrder(MiddlewareRecovery, MiddlewareRateLimit, "unknown"),
+		WithoutMiddleware(MiddlewareRateLimit))
+	defer close(ws.shutdownCh)
+	ws.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/api/stats" {
+				panic("boom")
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	handler := ws.routes()
+
+	for i := 0; i < 3; i++ {
+		if w := serve(handler, "/api/files", nil); w.Code != http.StatusOK || w.Header().Get(requestIDHeader) != "" {
+			t.Fatalf("期望停用限流和请求ID，得到 %d %q", w.Code, w.Header().Get(requestIDHeader))
+		}
+	}
+
+	// recovery将panic转为500
+	if w := serve(handler, "/api/stats", nil); w.Code != http.StatusInternalServerError {
+		t.Errorf("期望panic返回500，得到 %d", w.Code)
+	}
+	output := logs.String()
+	if !strings.Contains(output, "未知的中间件: unknown") || strings.Contains(output, "GET /api/files") {
+		t.Errorf("期望忽略未知的中间件且不记录访问日志，得到 %s", output)
+	}
+}
+
+func TestRecoveryHandler(t *testing.T) {
+	spans := tracetest.Start(t)
+	memory := aggregate.InitForTesting(t)
+	ws := NewWebServer(t.TempDir(), "8080", WithTracing(true))
+	defer close(ws.shutdownCh)
+
+	mux := http.NewServeMux()
+	handle := ws.handleFunc(mux)
+	NewAPIServer(ws).registerRoutes(handle)
+	handle("/api/v1/panic", func(w http.ResponseWriter, r *http.Request) {
+		var counts map[string]int
+		counts[r.URL.Path]++
+	})
+	handle("/api/v1/panic/stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"type\":\"connected\"}\n\n")
+		http.NewResponseController(w).Flush()
+		panic("stream broken")
+	})
+	handler := mux
+
+	// 返回500的APIResponse，带请求ID，不包含panic的内容
+	w := serve(handler, "/api/v1/panic?x=1", func(r *http.Request) { r.Header.Set(requestIDHeader, "panic-test") })
+	var response APIResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if w.Code != http.StatusInternalServerError || response.Success || response.ErrorCode != aggregate.CodeInternal ||
+		response.RequestID != "panic-test" || response.Error != "Internal server error" {
+		t.Errorf("期望500的APIResponse，得到 %d %+v", w.Code, response)
+	}
+
+	// 通过logz记录调用栈和请求信息
+	result, err := memory.Query(context.Background(), aggregate.LogQuery{Level: "error", Message: `\[PANIC\] GET /api/v1/panic:`, Limit: 10})
+	if err != nil || result.Total != 1 {
+		t.Fatalf("期望记录 1 条panic日志，得到 %+v %v", result, err)
+	}
+	entry := result.Entries[0]
+	if !strings.Contains(entry.Message, "nil map") || entry.Fields["request_id"] != "panic-test" ||
+		entry.Fields["http.query"] != "x=1" || entry.Fields["client_ip"] == "" {
+		t.Errorf("panic日志缺少请求信息: %+v", entry)
+	}
+	if stack, _ := entry.Fields[logz.ErrorStackKey].(string); !strings.Contains(stack, "TestRecoveryHandler") {
+		t.Errorf("期望调用栈包含panic的位置，得到 %q", stack)
+	}
+
+	// 记录在请求的span上
+	span := spans.RequireSpan(t, "GET /api/v1/panic")
+	if span.Status().Code != codes.Error || len(span.Events()) == 0 || span.Events()[0].Name != "exception" {
+		t.Errorf("期望span记录panic，得到 %v %v", span.Status(), span.Events())
+	}
+
+	// 已经开始推送的连接被中断，服务器继续处理其他请求
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/api/v1/panic/stream")
+	if err != nil {
+		t.Fatalf("请求日志流失败: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err == nil || !strings.Contains(string(body), "connected") {
+		t.Errorf("期望收到已推送的消息后连接中断，得到 %q %v", body, err)
+	}
+	resp, err = http.Get(server.URL + "/api/v1/metrics")
+	if err != nil {
+		t.Fatalf("请求运行指标失败: %v", err)
+	}
+	defer resp.Body.Close()
+	var metrics struct {
+		Data struct {
+			Requests RequestStats `json:"requests"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil || resp.StatusCode != http.StatusOK || metrics.Data.Requests.Panics != 2 {
+		t.Errorf("期望服务器继续服务并统计 2 次panic，得到 %d %+v %v", resp.StatusCode, metrics.Data.Requests, err)
+	}
+}
+
+func TestRecoveryWrapsTracingAndAuth(t *testing.T) {
+	spans := tracetest.Start(t)
+	aggregate.InitForTesting(t)
+	t.Setenv(apiKeysEnv, "reader:r-secret:read")
+	ws := NewWebServer(t.TempDir(), "8080", WithTracing(true))
+	defer close(ws.shutdownCh)
+	ws.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/api/stats" {
+				panic("boom")
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	// Start使用的处理器，追踪和认证都在recovery之内
+	handler := ws.routes()
+
+	withKey := func(r *http.Request) { r.Header.Set("X-API-Key", "r-secret") }
+	w := serve(handler, "/api/stats", withKey)
+	var response APIResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	if w.Code != http.StatusInternalServerError || response.ErrorCode != aggregate.CodeInternal || response.RequestID == "" {
+		t.Errorf("期望500的APIResponse，得到 %d %+v", w.Code, response)
+	}
+	span := spans.RequireSpan(t, "GET /api/stats")
+	if span.Status().Code != codes.Error || len(span.Events()) == 0 || span.Events()[0].Name != "exception" {
+		t.Errorf("期望span记录panic，得到 %v %v", span.Status(), span.Events())
+	}
+	if stats := ws.apiKeyStats()["reader"]; stats.Requests != 1 {
+		t.Errorf("期望认证计入 1 次请求，得到 %+v", stats)
+	}
+
+	// 认证仍然生效
+	if w := serve(handler, "/api/stats", nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("期望没有密钥时返回 401，得到 %d", w.Code)
+	}
+
+	// 追踪和认证不能停用，未列出时放在recovery之内
+	ws = NewWebServer(t.TempDir(), "8080", WithMiddlewareOrder(MiddlewareGzip, MiddlewareRecovery), WithoutMiddleware(MiddlewareAuth))
+	defer close(ws.shutdownCh)
+	if order := strings.Join(ws.middlewareOrder, ","); order != "gzip,recovery,tracing,auth" {
+		t.Errorf("期望追踪和认证在recovery之内，得到 %s", order)
+	}
+}
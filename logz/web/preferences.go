@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz"
+)
+
+// 用户偏好设置的存储
+const (
+	preferencesDir     = "preferences" // 日志目录下保存偏好设置的子目录，不包含日志文件
+	preferencesSecret  = ".secret"     // 签名cookie的密钥文件，首次使用时生成
+	preferencesCookie  = "logz_prefs"
+	preferencesMaxSize = 4 << 10 // 偏好设置请求体的最大字节数
+	maxPreferencePage  = 1000
+)
+
+// 界面主题
+var validThemes = map[string]bool{"light": true, "dark": true, "system": true}
+
+// Preferences 界面偏好设置，启用API密钥时按密钥保存，否则按签名cookie保存
+type Preferences struct {
+	Timezone     string `json:"timezone,omitempty"`      // 显示时间使用的IANA时区，如Asia/Shanghai
+	PageSize     int    `json:"page_size,omitempty"`     // 每页显示的日志条数
+	Theme        string `json:"theme,omitempty"`         // light、dark或system
+	DefaultLevel string `json:"default_level,omitempty"` // 默认的级别过滤
+}
+
+// validate 检查偏好设置的值，并规范化级别
+func (p *Preferences) validate() error {
+	if p.Timezone != "" {
+		if _, err := time.LoadLocation(p.Timezone); err != nil {
+			return fmt.Errorf("invalid timezone: %s", p.Timezone)
+		}
+	}
+	if p.PageSize < 0 || p.PageSize > maxPreferencePage {
+		return fmt.Errorf("page_size must be between 0 and %d", maxPreferencePage)
+	}
+	if p.Theme != "" && !validThemes[p.Theme] {
+		return fmt.Errorf("invalid theme: %s", p.Theme)
+	}
+	if p.DefaultLevel != "" {
+		level, err := logz.NormalizeLevel(p.DefaultLevel)
+		if err != nil {
+			return err
+		}
+		p.DefaultLevel = level
+	}
+	return nil
+}
+
+// preferenceStore 将每个用户的偏好设置保存为日志目录下的JSON文件
+type preferenceStore struct {
+	dir    string
+	mutex  sync.Mutex
+	secret []byte // 懒加载
+}
+
+func newPreferenceStore(logDir string) *preferenceStore {
+	return &preferenceStore{dir: filepath.Join(logDir, preferencesDir)}
+}
+
+// path 返回用户偏好设置的文件路径，文件名使用用户标识的哈希
+func (s *preferenceStore) path(user string) string {
+	sum := sha256.Sum256([]byte(user))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// load 读取用户的偏好设置，不存在时返回空设置
+func (s *preferenceStore) load(user string) (Preferences, error) {
+	var prefs Preferences
+	data, err := os.ReadFile(s.path(user))
+	if errors.Is(err, os.ErrNotExist) {
+		return prefs, nil
+	}
+	if err != nil {
+		return prefs, err
+	}
+	return prefs, json.Unmarshal(data, &prefs)
+}
+
+// save 先写入临时文件再重命名，保存用户的偏好设置
+func (s *preferenceStore) save(user string, prefs Preferences) error {
+	data, err := json.Marshal(prefs)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	path := s.path(user)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// signingSecret 返回签名cookie的密钥，不存在时生成并保存，重启后cookie仍然有效
+func (s *preferenceStore) signingSecret() ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.secret != nil {
+		return s.secret, nil
+	}
+
+	path := filepath.Join(s.dir, preferencesSecret)
+	secret, err := os.ReadFile(path)
+	if err == nil && len(secret) >= 32 {
+		s.secret = secret
+		return secret, nil
+	}
+	secret = make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, secret, 0600); err != nil {
+		return nil, err
+	}
+	s.secret = secret
+	return secret, nil
+}
+
+// sign 返回"id.签名"形式的cookie值
+func (s *preferenceStore) sign(id string) (string, error) {
+	secret, err := s.signingSecret()
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(id))
+	return id + "." + hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// verify 校验cookie值的签名，返回其中的id
+func (s *preferenceStore) verify(value string) (string, bool) {
+	id, _, found := strings.Cut(value, ".")
+	if !found || id == "" {
+		return "", false
+	}
+	expected, err := s.sign(id)
+	if err != nil || !hmac.Equal([]byte(expected), []byte(value)) {
+		return "", false
+	}
+	return id, true
+}
+
+// preferencesUser 返回请求的用户标识：启用API密钥时为密钥名称，否则为签名cookie中的id
+// 没有有效cookie时生成新的id并设置cookie
+func (ws *WebServer) preferencesUser(w http.ResponseWriter, r *http.Request) (string, error) {
+	if key := apiKeyFromContext(r.Context()); key != nil {
+		return "key:" + key.name, nil
+	}
+	if cookie, err := r.Cookie(preferencesCookie); err == nil {
+		if id, ok := ws.preferences.verify(cookie.Value); ok {
+			return "cookie:" + id, nil
+		}
+	}
+
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(raw)
+	value, err := ws.preferences.sign(id)
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     preferencesCookie,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return "cookie:" + id, nil
+}
+
+// handlePreferences 读取（GET）或替换（PUT）当前用户的偏好设置
+func (api *APIServer) handlePreferences(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		api.sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, err := api.ws.preferencesUser(w, r)
+	if err != nil {
+		api.sendErrorResponse(w, fmt.Sprintf("Failed to identify user: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		prefs, err := api.ws.preferences.load(user)
+		if err != nil {
+			api.sendErrorResponse(w, fmt.Sprintf("Failed to load preferences: %v", err), http.StatusInternalServerError)
+			return
+		}
+		api.sendSuccessResponse(w, prefs)
+		return
+	}
+
+	if err := api.validateRequest(r); err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, preferencesMaxSize+1))
+	if err != nil {
+		api.sendErrorResponse(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	if len(body) > preferencesMaxSize {
+		api.sendErrorResponse(w, fmt.Sprintf("Preferences exceed %d bytes", preferencesMaxSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var prefs Preferences
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&prefs); err != nil {
+		api.sendErrorResponse(w, fmt.Sprintf("Invalid preferences: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := prefs.validate(); err != nil {
+		api.sendErrorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := api.ws.preferences.save(user, prefs); err != nil {
+		api.sendErrorResponse(w, fmt.Sprintf("Failed to save preferences: %v", err), http.StatusInternalServerError)
+		return
+	}
+	api.sendSuccessResponse(w, prefs)
+}
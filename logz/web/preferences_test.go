@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// doPreferences 发送偏好设置请求，返回响应和解析后的APIResponse
+func doPreferences(t *testing.T, handler http.Handler, method, body string, prepare func(*http.Request)) (*httptest.ResponseRecorder, APIResponse) {
+	t.Helper()
+	req := httptest.NewRequest(method, "/api/v1/preferences", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if prepare != nil {
+		prepare(req)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var response APIResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	return w, response
+}
+
+func TestPreferencesRoundTrip(t *testing.T) {
+	ws := NewWebServer(t.TempDir(), "8080")
+	defer close(ws.shutdownCh)
+	handler := ws.routes()
+
+	// 第一次请求分配签名cookie
+	w, response := doPreferences(t, handler, http.MethodGet, "", nil)
+	if w.Code != http.StatusOK || len(response.Data.(map[string]interface{})) != 0 {
+		t.Fatalf("期望返回空设置，得到 %d %+v", w.Code, response)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != preferencesCookie {
+		t.Fatalf("期望设置%s cookie，得到 %v", preferencesCookie, cookies)
+	}
+	withCookie := func(req *http.Request) { req.AddCookie(cookies[0]) }
+
+	body := `{"timezone":"Asia/Shanghai","page_size":50,"theme":"dark","default_level":"WARNING"}`
+	if w, response := doPreferences(t, handler, http.MethodPut, body, withCookie); w.Code != http.StatusOK {
+		t.Fatalf("期望保存成功，得到 %d %s", w.Code, response.Error)
+	}
+
+	// 重启后签名密钥和设置仍然有效
+	restarted := NewWebServer(ws.logDir, "8080")
+	defer close(restarted.shutdownCh)
+	w, response = doPreferences(t, restarted.routes(), http.MethodGet, "", withCookie)
+	data, _ := response.Data.(map[string]interface{})
+	if w.Code != http.StatusOK || data["timezone"] != "Asia/Shanghai" || data["page_size"] != float64(50) ||
+		data["theme"] != "dark" || data["default_level"] != "warn" {
+		t.Errorf("期望读取保存的设置，得到 %d %+v", w.Code, response)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("期望有效cookie不被替换")
+	}
+
+	// 篡改的cookie被当作新用户
+	forged := func(req *http.Request) {
+		req.AddCookie(&http.Cookie{Name: preferencesCookie, Value: strings.Split(cookies[0].Value, ".")[0] + ".00"})
+	}
+	_, response = doPreferences(t, handler, http.MethodGet, "", forged)
+	if data, _ := response.Data.(map[string]interface{}); len(data) != 0 {
+		t.Errorf("期望篡改的cookie读取不到设置，得到 %+v", data)
+	}
+
+	// 偏好设置目录中没有日志文件
+	files, err := os.ReadDir(filepath.Join(ws.logDir, preferencesDir))
+	if err != nil {
+		t.Fatalf("读取偏好设置目录失败: %v", err)
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), ".log") {
+			t.Errorf("期望偏好设置目录中没有日志文件，得到 %s", file.Name())
+		}
+	}
+}
+
+func TestPreferencesPerAPIKey(t *testing.T) {
+	t.Setenv(apiKeysEnv, "alice:a-secret:read,bob:b-secret:read")
+	ws := NewWebServer(t.TempDir(), "8080")
+	defer close(ws.shutdownCh)
+	handler := ws.routes()
+	as := func(token string) func(*http.Request) {
+		return func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) }
+	}
+
+	if w, response := doPreferences(t, handler, http.MethodPut, `{"theme":"dark"}`, as("a-secret")); w.Code != http.StatusOK {
+		t.Fatalf("期望保存成功，得到 %d %s", w.Code, response.Error)
+	}
+	w, response := doPreferences(t, handler, http.MethodGet, "", as("a-secret"))
+	if data, _ := response.Data.(map[string]interface{}); data["theme"] != "dark" {
+		t.Errorf("期望同一密钥在其他机器上读取到设置，得到 %+v", response)
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("期望启用API密钥时不设置cookie")
+	}
+	_, response = doPreferences(t, handler, http.MethodGet, "", as("b-secret"))
+	if data, _ := response.Data.(map[string]interface{}); len(data) != 0 {
+		t.Errorf("期望不同密钥的设置相互独立，得到 %+v", data)
+	}
+}
+
+func TestPreferencesValidation(t *testing.T) {
+	ws := NewWebServer(t.TempDir(), "8080")
+	defer close(ws.shutdownCh)
+	handler := ws.routes()
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"无效时区", `{"timezone":"Mars/Olympus"}`, http.StatusBadRequest},
+		{"未知字段", `{"font":"mono"}`, http.StatusBadRequest},
+		{"无效主题", `{"theme":"neon"}`, http.StatusBadRequest},
+		{"无效级别", `{"default_level":"verbose"}`, http.StatusBadRequest},
+		{"每页条数过大", `{"page_size":100000}`, http.StatusBadRequest},
+		{"超过大小限制", `{"theme":"dark","timezone":"` + strings.Repeat("x", preferencesMaxSize) + `"}`, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w, response := doPreferences(t, handler, http.MethodPut, tt.body, nil); w.Code != tt.want {
+				t.Errorf("期望状态码 %d，得到 %d %s", tt.want, w.Code, response.Error)
+			}
+		})
+	}
+
+	if w, _ := doPreferences(t, handler, http.MethodDelete, "", nil); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("期望DELETE返回405，得到 %d", w.Code)
+	}
+}
+
+func TestDisplayTimeParam(t *testing.T) {
+	dir := t.TempDir()
+	content := `{"timestamp":"2024-01-15T10:30:00Z","level":"info","msg":"started","trace_id":"trace-tz"}` + "\n" +
+		`{"timestamp":"not a time","level":"info","msg":"odd","trace_id":"trace-tz"}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "app.log"), []byte(content), 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+	ws := NewWebServer(dir, "8080")
+	defer close(ws.shutdownCh)
+	handler := ws.routes()
+
+	get := func(url string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		var response APIResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("解析响应失败: %v", err)
+		}
+		data, _ := response.Data.(map[string]interface{})
+		return w.Code, data
+	}
+
+	code, data := get("/api/v1/logs/trace/trace-tz?tz=Asia/Shanghai")
+	if code != http.StatusOK {
+		t.Fatalf("期望状态码 200，得到 %d", code)
+	}
+	entries, _ := data["entries"].([]interface{})
+	if len(entries) != 2 || data["total"] != float64(2) {
+		t.Fatalf("期望返回2条日志，得到 %+v", data)
+	}
+	times := map[string]interface{}{}
+	for _, item := range entries {
+		entry := item.(map[string]interface{})
+		times[entry["msg"].(string)] = entry["display_time"]
+		if entry["timestamp"] == nil || entry["trace_id"] != "trace-tz" {
+			t.Errorf("期望保留原有字段，得到 %+v", entry)
+		}
+	}
+	if times["started"] != "2024-01-15 18:30:00.000 CST" {
+		t.Errorf("期望按Asia/Shanghai格式化时间，得到 %v", times["started"])
+	}
+	if times["odd"] != nil {
+		t.Errorf("期望无法解析的时间没有display_time，得到 %v", times["odd"])
+	}
+
+	_, data = get("/api/v1/logs/trace/trace-tz")
+	if entry := data["entries"].([]interface{})[0].(map[string]interface{}); entry["display_time"] != nil {
+		t.Errorf("期望未指定tz时不返回display_time，得到 %+v", entry)
+	}
+
+	if code, _ := get("/api/v1/logs/trace/trace-tz?tz=Nowhere/City"); code != http.StatusBadRequest {
+		t.Errorf("期望无效tz返回400，得到 %d", code)
+	}
+}
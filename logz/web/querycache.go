@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// 查询结果缓存的默认配置和环境变量
+const (
+	defaultQueryCacheTTL     = 10 * time.Minute
+	defaultQueryCacheQueries = 64
+	queryCacheRefsLimit      = 1 << 20 // 所有缓存的查询共保存的条目位置数
+	queryCacheTTLEnv         = "QUERY_CACHE_TTL"
+
+	queriesPath = "/api/v1/queries/"
+)
+
+// errQueryNotCached 缓存中没有query_id对应的查询，或者已过期、日志文件已变化，客户端需重新查询
+var (
+	errQueryNotCached = errors.New("query not cached")
+	errQueryExpired   = fmt.Errorf("%w: expired", errQueryNotCached)
+)
+
+// WithQueryCache 设置搜索结果缓存的有效期和最多缓存的查询数，ttl为0时不缓存
+func WithQueryCache(ttl time.Duration, maxQueries int) WebServerOption {
+	return func(ws *WebServer) {
+		ws.queryCache.ttl = ttl
+		ws.queryCache.maxQueries = maxQueries
+	}
+}
+
+// cachedQuery 缓存的查询结果，只保存按结果顺序排列的条目位置，按页读取条目
+type cachedQuery struct {
+	id          string
+	logDir      string
+	refs        []aggregate.EntryRef
+	sources     map[string]time.Time
+	parseErrors map[string]int
+	queryInfo   map[string]interface{}
+	expires     time.Time
+	lastUsed    time.Time
+}
+
+// QueryCacheStats 查询结果缓存的统计
+type QueryCacheStats struct {
+	Queries     int   `json:"queries"`
+	MaxQueries  int   `json:"max_queries"`
+	Refs        int   `json:"refs"` // 缓存的条目位置总数
+	MaxRefs     int   `json:"max_refs"`
+	Hits        int64 `json:"hits"`
+	Misses      int64 `json:"misses"`      // query_id不存在
+	Expired     int64 `json:"expired"`     // 超过有效期
+	Invalidated int64 `json:"invalidated"` // 日志文件已变化
+	Evicted     int64 `json:"evicted"`     // 缓存已满时移除的最久未使用的查询
+	Deleted     int64 `json:"deleted"`     // 通过DELETE删除
+}
+
+// queryCache 搜索结果缓存，按数量和条目位置总数限制大小，超出时移除最久未使用的查询
+type queryCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxQueries int
+	maxRefs    int
+	queries    map[string]*cachedQuery
+	refs       int
+	stats      QueryCacheStats
+}
+
+// enabled 是否缓存查询结果
+func (c *queryCache) enabled() bool {
+	return c.ttl > 0 && c.maxQueries > 0
+}
+
+// put 缓存查询结果，返回query_id；位置数超过缓存容量时不缓存，返回空字符串
+func (c *queryCache) put(query *cachedQuery) string {
+	if len(query.refs) > c.maxRefs {
+		return ""
+	}
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return ""
+	}
+	query.id = hex.EncodeToString(raw)
+	now := time.Now()
+	query.expires = now.Add(c.ttl)
+	query.lastUsed = now
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.queries == nil {
+		c.queries = make(map[string]*cachedQuery)
+	}
+	for len(c.queries) >= c.maxQueries || c.refs+len(query.refs) > c.maxRefs {
+		c.evictLocked()
+	}
+	c.queries[query.id] = query
+	c.refs += len(query.refs)
+	return query.id
+}
+
+// evictLocked 移除最久未使用的查询，调用方需持有c.mu
+func (c *queryCache) evictLocked() {
+	var oldest *cachedQuery
+	for _, query := range c.queries {
+		if oldest == nil || query.lastUsed.Before(oldest.lastUsed) {
+			oldest = query
+		}
+	}
+	c.removeLocked(oldest.id)
+	c.stats.Evicted++
+}
+
+// removeLocked 移除查询，调用方需持有c.mu
+func (c *queryCache) removeLocked(id string) bool {
+	query, ok := c.queries[id]
+	if !ok {
+		return false
+	}
+	delete(c.queries, id)
+	c.refs -= len(query.refs)
+	return true
+}
+
+// get 返回未过期且日志文件未变化的查询，否则移除该查询并返回包装了errQueryNotCached的错误
+func (c *queryCache) get(id string) (*cachedQuery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	query, ok := c.queries[id]
+	if !ok {
+		c.stats.Misses++
+		return nil, errQueryNotCached
+	}
+	now := time.Now()
+	if now.After(query.expires) {
+		c.removeLocked(id)
+		c.stats.Expired++
+		return nil, errQueryExpired
+	}
+	if file, changed := aggregate.SourcesChanged(query.logDir, query.sources); changed {
+		c.removeLocked(id)
+		c.stats.Invalidated++
+		return nil, fmt.Errorf("%w: log file %s changed", errQueryNotCached, file)
+	}
+	query.lastUsed = now
+	c.stats.Hits++
+	return query, nil
+}
+
+// invalidate 移除查询，读取缓存的条目失败时调用
+func (c *queryCache) invalidate(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.removeLocked(id) {
+		c.stats.Invalidated++
+	}
+}
+
+// remove 删除查询，不存在时返回false
+func (c *queryCache) remove(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.removeLocked(id) {
+		return false
+	}
+	c.stats.Deleted++
+	return true
+}
+
+// snapshot 返回当前统计
+func (c *queryCache) snapshot() QueryCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Queries = len(c.queries)
+	stats.MaxQueries = c.maxQueries
+	stats.Refs = c.refs
+	stats.MaxRefs = c.maxRefs
+	return stats
+}
+
+// cleanup 移除过期的查询，由cacheCleanup定期调用
+func (c *queryCache) cleanup(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for id, query := range c.queries {
+		if now.After(query.expires) {
+			c.removeLocked(id)
+			c.stats.Expired++
+		}
+	}
+}
+
+// storeLogDir 返回日志存储的目录，存储不是本地目录时返回false，此时不缓存查询结果
+func (ws *WebServer) storeLogDir() (string, bool) {
+	store, ok := ws.store.(interface{ LogDir() string })
+	if !ok {
+		return "", false
+	}
+	return store.LogDir(), true
+}
+
+// handleDeleteQuery 删除缓存的查询结果：DELETE /api/v1/queries/{id}
+func (api *APIServer) handleDeleteQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "DELETE" {
+		api.sendErrorResponse(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, queriesPath)
+	if id == "" || strings.Contains(id, "/") {
+		api.sendErrorResponse(w, "Query ID required", http.StatusBadRequest)
+		return
+	}
+	if !api.ws.queryCache.remove(id) {
+		api.sendErrorResponseWithCode(w, "Query not found", http.StatusNotFound, "query_not_found")
+		return
+	}
+	api.sendSuccessResponseWithMessage(w, map[string]string{"query_id": id}, "Query deleted")
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// countingStore 统计查询次数的DirStore
+type countingStore struct {
+	*aggregate.DirStore
+	queries atomic.Int64
+}
+
+func (s *countingStore) Query(ctx context.Context, query aggregate.LogQuery) (*aggregate.LogQueryResult, error) {
+	s.queries.Add(1)
+	return s.DirStore.Query(ctx, query)
+}
+
+func TestSearchQueryCache(t *testing.T) {
+	aggregate.SetGlobalAggregator(nil)
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	for i, name := range []string{"a.log", "b.log", "c.log"} {
+		var lines []string
+		for j := 0; j < 3; j++ {
+			n := i*3 + j
+			lines = append(lines, fmt.Sprintf(`{"timestamp":%q,"level":"info","msg":"m%d"}`, base.Add(time.Duration(n)*time.Minute).Format(time.RFC3339), n))
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+			t.Fatalf("创建测试日志文件失败: %v", err)
+		}
+	}
+	store := &countingStore{DirStore: aggregate.NewDirStore(dir)}
+	handler := NewWebServer(dir, "8080", WithLogStore(store)).routes()
+
+	type page struct {
+		status  int
+		code    string
+		queryID string
+		total   float64
+		msgs    []string
+		explain map[string]interface{}
+	}
+	search := func(body string) page {
+		t.Helper()
+		status, response := doAPI(t, handler, "POST", "/api/v1/logs/search?explain=true", body)
+		data, _ := response.Data.(map[string]interface{})
+		result, _ := data["result"].(map[string]interface{})
+		p := page{status: status, code: response.ErrorCode}
+		p.queryID, _ = data["query_id"].(string)
+		p.total, _ = result["total"].(float64)
+		p.explain, _ = result["explain"].(map[string]interface{})
+		entries, _ := result["entries"].([]interface{})
+		for _, entry := range entries {
+			p.msgs = append(p.msgs, entry.(map[string]interface{})["msg"].(string))
+		}
+		return p
+	}
+	cacheStats := func() map[string]interface{} {
+		t.Helper()
+		_, response := doAPI(t, handler, "GET", "/api/v1/metrics", "")
+		stats, _ := response.Data.(map[string]interface{})["query_cache"].(map[string]interface{})
+		return stats
+	}
+
+	first := search(`{"limit":3,"cache":true}`)
+	if first.status != http.StatusOK || first.queryID == "" || first.total != 9 || strings.Join(first.msgs, ",") != "m0,m1,m2" {
+		t.Fatalf("期望第一页返回query_id，得到 %+v", first)
+	}
+	if first.explain["strategy"] != aggregate.StrategyScan || first.explain["files_opened"] != float64(3) {
+		t.Errorf("期望第一页扫描 3 个文件，得到 %v", first.explain)
+	}
+
+	// 第二页从缓存的位置读取，只打开条目所在的文件
+	second := search(fmt.Sprintf(`{"query_id":%q,"offset":3,"limit":3}`, first.queryID))
+	if second.status != http.StatusOK || second.total != 9 || strings.Join(second.msgs, ",") != "m3,m4,m5" {
+		t.Fatalf("期望从缓存读取第二页，得到 %+v", second)
+	}
+	if second.explain["strategy"] != aggregate.StrategyCache || second.explain["files_opened"] != float64(1) {
+		t.Errorf("期望第二页只打开 1 个文件，得到 %v", second.explain)
+	}
+	if n := store.queries.Load(); n != 1 {
+		t.Errorf("期望只查询 1 次，得到 %d", n)
+	}
+	if stats := cacheStats(); stats["queries"] != float64(1) || stats["hits"] != float64(1) || stats["refs"] != float64(9) {
+		t.Errorf("期望缓存统计中有 1 个查询和 1 次命中，得到 %v", stats)
+	}
+
+	// 文件修改后缓存失效
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(dir, "b.log"), later, later); err != nil {
+		t.Fatalf("修改文件时间失败: %v", err)
+	}
+	if p := search(fmt.Sprintf(`{"query_id":%q,"offset":3,"limit":3}`, first.queryID)); p.status != http.StatusNotFound || p.code != "query_not_found" {
+		t.Errorf("期望文件修改后返回 404 query_not_found，得到 %+v", p)
+	}
+	if stats := cacheStats(); stats["queries"] != float64(0) || stats["invalidated"] != float64(1) {
+		t.Errorf("期望缓存统计中有 1 次失效，得到 %v", stats)
+	}
+
+	// 显式删除
+	cached := search(`{"limit":3,"cache":true,"message":"m[0-4]"}`)
+	if cached.queryID == "" || cached.total != 5 {
+		t.Fatalf("期望重新缓存查询，得到 %+v", cached)
+	}
+	if status, _ := doAPI(t, handler, "DELETE", queriesPath+cached.queryID, ""); status != http.StatusOK {
+		t.Errorf("期望删除成功，得到 %d", status)
+	}
+	if status, response := doAPI(t, handler, "DELETE", queriesPath+cached.queryID, ""); status != http.StatusNotFound || response.ErrorCode != "query_not_found" {
+		t.Errorf("期望再次删除返回 404，得到 %d %q", status, response.ErrorCode)
+	}
+	if p := search(fmt.Sprintf(`{"query_id":%q}`, cached.queryID)); p.status != http.StatusNotFound {
+		t.Errorf("期望删除后返回 404，得到 %+v", p)
+	}
+
+	// 缓存过期
+	expiring := NewWebServer(dir, "8080", WithQueryCache(time.Nanosecond, 1)).routes()
+	status, response := doAPI(t, expiring, "POST", "/api/v1/logs/search", `{"cache":true}`)
+	id, _ := response.Data.(map[string]interface{})["query_id"].(string)
+	if status != http.StatusOK || id == "" {
+		t.Fatalf("期望返回query_id，得到 %d %v", status, response.Data)
+	}
+	time.Sleep(time.Millisecond)
+	if status, response := doAPI(t, expiring, "POST", "/api/v1/logs/search", fmt.Sprintf(`{"query_id":%q}`, id)); status != http.StatusNotFound || !strings.Contains(response.Error, "expired") {
+		t.Errorf("期望过期后返回 404，得到 %d %q", status, response.Error)
+	}
+}
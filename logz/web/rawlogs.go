@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// rawLogPathsEnv 原始日志文件的环境变量，逗号分隔的相对日志目录的路径或匹配模式
+const rawLogPathsEnv = "RAW_LOG_PATHS"
+
+// WithRawLogPaths 将原始的logrus日志文件（如InitWithAggregation写入的app.log，JSON或文本格式）加入查询和统计，
+// 路径相对于日志目录，可以使用filepath.Match语法；查询时设置LogQuery.IncludeRawLogs。
+// 聚合目录中已有同一条日志时会重复出现，适合只有原始日志的旧部署；绝对路径和日志目录之外的路径记录日志后忽略
+func WithRawLogPaths(paths ...string) WebServerOption {
+	return func(ws *WebServer) {
+		for _, p := range paths {
+			p = strings.TrimSpace(p)
+			if p == "" {
+				continue
+			}
+			cleaned := path.Clean(filepath.ToSlash(p))
+			if filepath.IsAbs(p) || path.IsAbs(cleaned) || cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+				log.Printf("无效的原始日志路径: %s（必须是日志目录中的相对路径）", p)
+				continue
+			}
+			if _, err := path.Match(cleaned, ""); err != nil {
+				log.Printf("无效的原始日志路径: %s: %v", p, err)
+				continue
+			}
+			ws.rawLogPaths = append(ws.rawLogPaths, cleaned)
+		}
+	}
+}
+
+// rawLogOptionsFromEnv 从环境变量读取原始日志文件
+func rawLogOptionsFromEnv() []WebServerOption {
+	if value := os.Getenv(rawLogPathsEnv); value != "" {
+		return []WebServerOption{WithRawLogPaths(strings.Split(value, ",")...)}
+	}
+	return nil
+}
+
+// addRawLogSources 将原始日志文件加入文件匹配模式，不递归时还需加入其所在的子目录及上级目录
+// 之前没有设置匹配模式时保留默认的模式，聚合日志仍然可以查询
+func (ws *WebServer) addRawLogSources() {
+	if len(ws.rawLogPaths) == 0 {
+		return
+	}
+	if len(ws.discovery.Patterns) == 0 {
+		ws.discovery.Patterns = slices.Clone(aggregate.DefaultPathPatterns)
+	}
+	for _, p := range ws.rawLogPaths {
+		if !slices.Contains(ws.discovery.Patterns, p) {
+			ws.discovery.Patterns = append(ws.discovery.Patterns, p)
+		}
+		if ws.discovery.Recursive {
+			continue
+		}
+		for dir := path.Dir(p); dir != "."; dir = path.Dir(dir) {
+			if !slices.Contains(ws.discovery.Subdirs, dir) {
+				ws.discovery.Subdirs = append(ws.discovery.Subdirs, dir)
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+func TestRawLogPaths(t *testing.T) {
+	aggregate.SetGlobalAggregator(nil)
+	dir := t.TempDir()
+	aggregated := `{"timestamp":"2024-01-15T10:30:02Z","level":"info","msg":"aggregated","trace_id":"trace-raw","service":"svc"}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "svc_2024-01-15_001.log"), []byte(aggregated), 0644); err != nil {
+		t.Fatalf("创建聚合日志失败: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "old"), 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	raw := `{"level":"warning","msg":"raw json","time":"2024-01-15T10:30:00Z","trace_id":"trace-raw","order_id":7}` + "\n" +
+		`time="2024-01-15T10:30:01Z" level=error msg="raw text" trace_id=trace-raw` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "old", "app.log"), []byte(raw), 0644); err != nil {
+		t.Fatalf("创建原始日志失败: %v", err)
+	}
+
+	// 未配置时原始日志不在查询范围内
+	messages := traceURLs(t, NewWebServer(dir, "8080").routes(), "GET", "/api/v1/logs/trace/trace-raw", "")
+	if len(messages) != 1 {
+		t.Errorf("期望未配置时只返回聚合日志，得到 %v", messages)
+	}
+
+	ws := NewWebServer(dir, "8080", WithRawLogPaths("old/app.log", "../outside.log", "/var/log/app.log", "[", " "))
+	if !slices.Equal(ws.rawLogPaths, []string{"old/app.log"}) {
+		t.Errorf("期望忽略无效的路径，得到 %v", ws.rawLogPaths)
+	}
+	if !slices.Contains(ws.discovery.Patterns, "*.log") || !slices.Contains(ws.discovery.Patterns, "old/app.log") || !slices.Contains(ws.discovery.Subdirs, "old") {
+		t.Errorf("期望保留默认模式并加入原始日志及其目录，得到 %+v", ws.discovery)
+	}
+
+	handler := ws.routes()
+	messages = traceURLs(t, handler, "GET", "/api/v1/logs/trace/trace-raw", "")
+	for _, message := range []string{"aggregated", "raw json", "raw text"} {
+		if _, ok := messages[message]; !ok {
+			t.Errorf("期望按trace_id查询到 %q，得到 %v", message, messages)
+		}
+	}
+	messages = traceURLs(t, handler, "POST", "/api/v1/logs/search", `{"level":"warn"}`, "result")
+	if _, ok := messages["raw json"]; !ok || len(messages) != 1 {
+		t.Errorf("期望按规范化的级别查询到原始日志，得到 %v", messages)
+	}
+}
+
+func TestRawLogOptionsFromEnv(t *testing.T) {
+	t.Setenv(rawLogPathsEnv, "")
+	if options := rawLogOptionsFromEnv(); len(options) != 0 {
+		t.Errorf("期望未设置时没有选项，得到 %d 个", len(options))
+	}
+
+	t.Setenv(rawLogPathsEnv, "app.log, old/*.log")
+	ws := NewWebServer(t.TempDir(), "8080", rawLogOptionsFromEnv()...)
+	if !slices.Equal(ws.rawLogPaths, []string{"app.log", "old/*.log"}) {
+		t.Errorf("期望从环境变量读取原始日志路径，得到 %v", ws.rawLogPaths)
+	}
+}
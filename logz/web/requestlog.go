@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// slowRequestEnv 慢请求阈值，如"2s"，为0时不记录慢请求
+const slowRequestEnv = "SLOW_REQUEST_THRESHOLD"
+
+const defaultSlowRequestThreshold = 5 * time.Second
+
+// 请求结果，记录在访问日志的outcome字段
+const (
+	outcomeOK         = "ok"
+	outcomeTimeout    = "timeout"     // 处理或写入响应超时
+	outcomeClientGone = "client_gone" // 客户端在响应写完之前断开
+)
+
+// WithSlowRequestThreshold 设置慢请求阈值，耗时超过阈值的请求记录一条警告日志，为0时不记录
+func WithSlowRequestThreshold(threshold time.Duration) WebServerOption {
+	return func(ws *WebServer) {
+		ws.slowRequestThreshold = threshold
+	}
+}
+
+// requestStats 经过logHandler的请求中异常结束和慢请求的数量
+type requestStats struct {
+	timeouts   atomic.Int64
+	clientGone atomic.Int64
+	slow       atomic.Int64
+	panics     atomic.Int64
+}
+
+// RequestStats 请求统计，在指标接口中返回
+type RequestStats struct {
+	Timeouts   int64 `json:"timeouts"`
+	ClientGone int64 `json:"client_gone"`
+	Slow       int64 `json:"slow"`
+	Panics     int64 `json:"panics"` // 处理函数panic的次数
+}
+
+func (s *requestStats) snapshot() RequestStats {
+	return RequestStats{
+		Timeouts:   s.timeouts.Load(),
+		ClientGone: s.clientGone.Load(),
+		Slow:       s.slow.Load(),
+		Panics:     s.panics.Load(),
+	}
+}
+
+// responseRecorder 记录状态码、写入的字节数和第一个写入错误
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	bytes      int64
+	writeErr   error
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	r.statusCode = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	if err != nil && r.writeErr == nil {
+		r.writeErr = err
+	}
+	return n, err
+}
+
+// Unwrap 供http.ResponseController访问底层的ResponseWriter
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// requestOutcome 根据状态码、写入错误和请求上下文判断请求是否完整返回
+// 状态码在写入失败之前就已记录，只看状态码无法发现被截断的响应；超过路由超时的请求返回504
+func requestOutcome(ctx context.Context, statusCode int, writeErr error) string {
+	switch {
+	case statusCode == http.StatusGatewayTimeout,
+		errors.Is(writeErr, http.ErrHandlerTimeout), errors.Is(writeErr, os.ErrDeadlineExceeded),
+		errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return outcomeTimeout
+	case writeErr != nil, ctx.Err() != nil:
+		return outcomeClientGone
+	default:
+		return outcomeOK
+	}
+}
+
+// logHandler 记录访问日志，包括请求结果、响应字节数和耗时，慢请求额外记录一条警告
+func (ws *WebServer) logHandler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		// 创建响应记录器
+		rec := &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+
+		next(rec, r)
+
+		duration := time.Since(start)
+		outcome := requestOutcome(r.Context(), rec.statusCode, rec.writeErr)
+		switch outcome {
+		case outcomeTimeout:
+			ws.requestStats.timeouts.Add(1)
+		case outcomeClientGone:
+			ws.requestStats.clientGone.Add(1)
+		}
+
+		// 记录请求日志，附带请求ID；启用追踪时附带trace_id以便在Jaeger中查找
+		clientIP := ws.clientIP(r)
+		line := fmt.Sprintf("%s %s %d %v %s outcome=%s bytes=%d", r.Method, r.URL.Path, rec.statusCode, duration, clientIP, outcome, rec.bytes)
+		if id := requestIDFromContext(r.Context()); id != "" {
+			line += " request_id=" + id
+		}
+		if spanCtx := oteltrace.SpanContextFromContext(r.Context()); spanCtx.HasTraceID() {
+			line += " trace_id=" + spanCtx.TraceID().String()
+		}
+		log.Print(line)
+
+		if ws.slowRequestThreshold > 0 && duration > ws.slowRequestThreshold {
+			ws.requestStats.slow.Add(1)
+			log.Printf("[WARN] 慢请求 %s %s 耗时 %v 超过阈值 %v，查询参数: %q，客户端: %s", r.Method, r.URL.Path, duration, ws.slowRequestThreshold, r.URL.RawQuery, clientIP)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer 可并发写入的日志缓冲区
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// captureLog 将标准日志重定向到缓冲区，测试结束时恢复
+func captureLog(t *testing.T) *syncBuffer {
+	t.Helper()
+	logs := &syncBuffer{}
+	log.SetOutput(logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return logs
+}
+
+func TestLogHandlerClientGone(t *testing.T) {
+	logs := captureLog(t)
+	ws := NewWebServer(t.TempDir(), "8080")
+
+	done := make(chan struct{})
+	chunk := bytes.Repeat([]byte("x"), 64*1024)
+	handler := ws.logHandler(func(w http.ResponseWriter, r *http.Request) {
+		// 持续写入直到客户端断开
+		for i := 0; i < 10000; i++ {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+		}
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		handler(w, r)
+	}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/files/content/big.log")
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	io.CopyN(io.Discard, resp.Body, 1024)
+	resp.Body.Close()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("客户端断开后处理函数没有结束")
+	}
+
+	output := logs.String()
+	if !strings.Contains(output, "GET /api/files/content/big.log 200") || !strings.Contains(output, "outcome=client_gone") {
+		t.Errorf("期望访问日志记录outcome=client_gone，得到:\n%s", output)
+	}
+	if strings.Contains(output, "bytes=655360000") {
+		t.Errorf("期望记录实际写入的字节数，得到:\n%s", output)
+	}
+	if stats := ws.requestStats.snapshot(); stats.ClientGone != 1 || stats.Timeouts != 0 {
+		t.Errorf("期望1个客户端断开的请求，得到 %+v", stats)
+	}
+}
+
+func TestLogHandlerOutcomes(t *testing.T) {
+	logs := captureLog(t)
+	ws := NewWebServer(t.TempDir(), "8080", WithSlowRequestThreshold(20*time.Millisecond))
+
+	// 正常请求
+	ok := ws.logHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	})
+	ok(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/files", nil))
+	if output := logs.String(); !strings.Contains(output, "outcome=ok bytes=5") {
+		t.Errorf("期望记录outcome=ok和字节数，得到:\n%s", output)
+	}
+
+	// 处理超时，写入返回http.ErrHandlerTimeout
+	slow := ws.logHandler(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		w.Write([]byte("too late"))
+	})
+	// TimeoutHandler返回时处理函数仍在后台执行，等待其记录日志
+	done := make(chan struct{})
+	timeout := http.TimeoutHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+		slow(w, r)
+	}), 50*time.Millisecond, "timeout")
+	w := httptest.NewRecorder()
+	timeout.ServeHTTP(w, httptest.NewRequest("GET", "/api/search?level=error&service=api", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("期望状态码 503，得到 %d", w.Code)
+	}
+	<-done
+
+	output := logs.String()
+	// TimeoutHandler在超时后才返回503，访问日志中的状态码仍是200，outcome区分出超时
+	if !strings.Contains(output, "GET /api/search 200") || !strings.Contains(output, "outcome=timeout") {
+		t.Errorf("期望记录outcome=timeout，得到:\n%s", output)
+	}
+	if !strings.Contains(output, "[WARN] 慢请求 GET /api/search") || !strings.Contains(output, "level=error&service=api") {
+		t.Errorf("期望慢请求警告包含查询参数，得到:\n%s", output)
+	}
+
+	stats := ws.requestStats.snapshot()
+	if stats.Timeouts != 1 || stats.ClientGone != 0 || stats.Slow != 1 {
+		t.Errorf("请求统计错误: %+v", stats)
+	}
+
+	// 指标接口返回请求统计
+	api := NewAPIServer(ws)
+	w = httptest.NewRecorder()
+	api.handleMetrics(w, httptest.NewRequest("GET", "/api/v1/metrics", nil))
+	if !strings.Contains(w.Body.String(), `"requests":{"timeouts":1,"client_gone":0,"slow":1,"panics":0}`) {
+		t.Errorf("期望指标包含请求统计，得到 %s", w.Body.String())
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// 页面安全响应头的环境变量
+const (
+	cspEnv           = "CONTENT_SECURITY_POLICY" // 完整的Content-Security-Policy，设置后替换默认策略
+	cspConnectSrcEnv = "CSP_CONNECT_SRC"         // 逗号分隔的来源，追加到默认策略的connect-src，如从其他域名订阅日志流
+)
+
+// cdnSource 页面模板引用的Bootstrap和Prism所在的CDN
+const cdnSource = "https://cdn.jsdelivr.net"
+
+// defaultCSP 返回页面的默认Content-Security-Policy，connectSrc追加到connect-src
+// 模板中有内联脚本和事件处理属性，script-src和style-src需要'unsafe-inline'；
+// 页面只能被同源加载资源、不能被嵌入iframe，日志流（SSE）和API请求默认只允许同源
+func defaultCSP(connectSrc []string) string {
+	connect := append([]string{"'self'"}, connectSrc...)
+	directives := []string{
+		"default-src 'self'",
+		"script-src 'self' 'unsafe-inline' " + cdnSource,
+		"style-src 'self' 'unsafe-inline' " + cdnSource,
+		"font-src 'self' " + cdnSource,
+		"img-src 'self' data:",
+		"connect-src " + strings.Join(connect, " "),
+		"object-src 'none'",
+		"base-uri 'self'",
+		"form-action 'self'",
+		"frame-ancestors 'none'",
+	}
+	return strings.Join(directives, "; ")
+}
+
+// loadCSP 从环境变量读取页面的Content-Security-Policy，包含分号或换行的来源被忽略
+func loadCSP() string {
+	if policy := strings.TrimSpace(os.Getenv(cspEnv)); policy != "" {
+		return policy
+	}
+	var sources []string
+	for _, source := range splitList(os.Getenv(cspConnectSrcEnv)) {
+		if strings.ContainsAny(source, "; \t\r\n") {
+			log.Printf("无效的%s: %s", cspConnectSrcEnv, source)
+			continue
+		}
+		sources = append(sources, source)
+	}
+	return defaultCSP(sources)
+}
+
+// contentSecurityPolicy 返回当前的页面Content-Security-Policy
+func (ws *WebServer) contentSecurityPolicy() string {
+	ws.settingsMutex.RLock()
+	defer ws.settingsMutex.RUnlock()
+	return ws.csp
+}
+
+// securityHeaders 为页面响应设置Content-Security-Policy、禁止嵌入iframe等安全响应头
+// Referrer-Policy为same-origin，查看页面URL中的文件名不会随CDN请求发送
+func (ws *WebServer) securityHeaders(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		header.Set("Content-Security-Policy", ws.contentSecurityPolicy())
+		header.Set("X-Frame-Options", "DENY")
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("Referrer-Policy", "same-origin")
+		header.Set("Cross-Origin-Opener-Policy", "same-origin")
+		next(w, r)
+	}
+}
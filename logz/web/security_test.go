@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	logDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(logDir, "app.log"), []byte(`{"level":"info","msg":"ok"}`+"\n"), 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+	ws := NewWebServer(logDir, "8080")
+	defer close(ws.shutdownCh)
+	handler := ws.routes()
+
+	for _, path := range []string{"/", "/errors", "/view/app.log"} {
+		w := serve(handler, path, nil)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: 期望状态码 200，得到 %d", path, w.Code)
+		}
+		header := w.Header()
+		csp := header.Get("Content-Security-Policy")
+		if !strings.Contains(csp, "default-src 'self'") || !strings.Contains(csp, "frame-ancestors 'none'") ||
+			!strings.Contains(csp, "connect-src 'self';") || !strings.Contains(csp, "object-src 'none'") {
+			t.Errorf("%s: Content-Security-Policy错误: %s", path, csp)
+		}
+		want := map[string]string{
+			"X-Frame-Options":            "DENY",
+			"X-Content-Type-Options":     "nosniff",
+			"Referrer-Policy":            "same-origin",
+			"Cross-Origin-Opener-Policy": "same-origin",
+		}
+		for name, value := range want {
+			if got := header.Get(name); got != value {
+				t.Errorf("%s: 期望 %s 为 %q，得到 %q", path, name, value, got)
+			}
+		}
+	}
+
+	// JSON接口不需要CSP，但都禁止MIME嗅探
+	for _, path := range []string{"/api/files", "/api/v1/stats"} {
+		w := serve(handler, path, nil)
+		if w.Header().Get("Content-Security-Policy") != "" || w.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Errorf("%s: 响应头错误: %v", path, w.Header())
+		}
+	}
+}
+
+func TestContentSecurityPolicyConfig(t *testing.T) {
+	t.Setenv(cspConnectSrcEnv, "https://stream.example.com, bad;source")
+	logs := captureLog(t)
+	ws := NewWebServer(t.TempDir(), "8080")
+	defer close(ws.shutdownCh)
+
+	csp := serve(ws.routes(), "/", nil).Header().Get("Content-Security-Policy")
+	if !strings.Contains(csp, "connect-src 'self' https://stream.example.com;") || strings.Contains(csp, "bad") {
+		t.Errorf("期望connect-src追加配置的来源，得到 %s", csp)
+	}
+	if !strings.Contains(logs.String(), "无效的"+cspConnectSrcEnv) {
+		t.Errorf("期望记录无效的来源，得到 %s", logs.String())
+	}
+
+	// 完整的策略替换默认策略，SIGHUP时重新加载
+	t.Setenv(cspEnv, "default-src 'none'")
+	ws.ReloadSettings()
+	if csp := serve(ws.routes(), "/errors", nil).Header().Get("Content-Security-Policy"); csp != "default-src 'none'" {
+		t.Errorf("期望使用配置的策略，得到 %s", csp)
+	}
+}
+
+func TestViewPageRejectsHostileFilenames(t *testing.T) {
+	root := t.TempDir()
+	logDir := filepath.Join(root, "logs")
+	if err := os.MkdirAll(filepath.Join(logDir, "subdir"), 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "secret.log"), []byte("secret\n"), 0644); err != nil {
+		t.Fatalf("创建文件失败: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(root, "secret.log"), filepath.Join(logDir, "link.log")); err != nil {
+		t.Fatalf("创建符号链接失败: %v", err)
+	}
+	hostile := `<img src=x onerror=alert(1)>";alert(2);".log`
+	if err := os.WriteFile(filepath.Join(logDir, hostile), nil, 0644); err != nil {
+		t.Fatalf("创建文件失败: %v", err)
+	}
+	ws := NewWebServer(logDir, "8080")
+	defer close(ws.shutdownCh)
+	handler := ws.routes()
+
+	for _, path := range []string{
+		"/view/missing.log",
+		"/view/..%2fsecret.log",
+		"/view/%2e%2e%2fsecret.log",
+		"/view/link.log",
+		"/view/subdir",
+		"/view/%3Cscript%3Ealert(1)%3C%2Fscript%3E.log",
+		"/view/",
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: 期望状态码 404，得到 %d", path, w.Code)
+		}
+		if strings.Contains(w.Body.String(), "<script>") {
+			t.Errorf("%s: 响应中包含未转义的文件名", path)
+		}
+	}
+
+	// 存在的文件名在页面中按上下文转义
+	w := serve(handler, "/view/"+strings.NewReplacer("<", "%3C", ">", "%3E", `"`, "%22", " ", "%20", ";", "%3B").Replace(hostile), nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("期望状态码 200，得到 %d", w.Code)
+	}
+	if body := w.Body.String(); strings.Contains(body, "<img src=x") || strings.Contains(body, `";alert(2)`) {
+		t.Error("期望文件名在HTML和脚本中被转义")
+	}
+}
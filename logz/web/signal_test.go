@@ -0,0 +1,53 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWebServerReloadSettingsOnSIGHUP(t *testing.T) {
+	server := NewWebServer(t.TempDir(), "8080")
+	if rateLimit, cacheTTL := server.settings(); rateLimit != defaultRateLimit || cacheTTL != defaultCacheTTL {
+		t.Fatalf("期望默认配置，得到 %d, %v", rateLimit, cacheTTL)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server.HandleSignals(ctx)
+
+	t.Setenv(rateLimitEnv, "2")
+	t.Setenv(cacheTTLEnv, "30s")
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatalf("发送SIGHUP失败: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rateLimit, cacheTTL := server.settings()
+		if rateLimit == 2 && cacheTTL == 30*time.Second {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("SIGHUP未重新加载配置: %d, %v", rateLimit, cacheTTL)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	handler := server.rateLimitHandler(func(w http.ResponseWriter, r *http.Request) {})
+	var codes []int
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/api/files", nil))
+		codes = append(codes, w.Code)
+	}
+	if codes[2] != http.StatusTooManyRequests {
+		t.Errorf("期望第3个请求被限流，得到 %v", codes)
+	}
+}
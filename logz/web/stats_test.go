@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+func TestLogStatsIndexBreakdown(t *testing.T) {
+	aggregate.SetGlobalAggregator(nil)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app.log"), []byte("line\n"), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	handler := NewWebServer(dir, "8080").routes()
+
+	// 只有日志文件时只返回文件统计
+	for _, path := range []string{"/api/stats", "/api/v1/stats"} {
+		status, response := doAPI(t, handler, "GET", path, "")
+		stats, _ := response.Data.(map[string]interface{})
+		if status != http.StatusOK || stats["total_files"] != float64(1) || stats["entries_by_level"] != nil || stats["index_size_bytes"] != nil {
+			t.Errorf("%s: 期望只有文件统计，得到 %d %v", path, status, response.Data)
+		}
+	}
+
+	aggregator, err := aggregate.NewLogAggregatorWithOptions(filepath.Join(dir, "aggregated"), "stats-test")
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	aggregate.SetGlobalAggregator(aggregator)
+	defer func() {
+		aggregate.SetGlobalAggregator(nil)
+		aggregator.Close()
+	}()
+	for _, entry := range []aggregate.LogEntry{
+		{Level: "info", Service: "api"},
+		{Level: "info", Service: "api"},
+		{Level: "error", Service: "api"},
+		{Level: "error", Service: "billing"},
+	} {
+		entry.Timestamp = time.Now().Format(time.RFC3339)
+		if _, err := aggregator.WriteLogSync(entry, true); err != nil {
+			t.Fatalf("写入失败: %v", err)
+		}
+	}
+
+	for _, path := range []string{"/api/stats", "/api/v1/stats"} {
+		status, response := doAPI(t, handler, "GET", path, "")
+		stats, _ := response.Data.(map[string]interface{})
+		byLevel, _ := stats["entries_by_level"].(map[string]interface{})
+		byService, _ := stats["entries_by_service"].(map[string]interface{})
+		if status != http.StatusOK || byLevel["info"] != float64(2) || byLevel["error"] != float64(2) ||
+			byService["api"] != float64(3) || byService["billing"] != float64(1) {
+			t.Errorf("%s: 期望按级别和服务统计，得到 %d %v", path, status, response.Data)
+		}
+		if size, _ := stats["index_size_bytes"].(float64); size <= 0 || stats["total_files"] == nil {
+			t.Errorf("%s: 期望返回索引大小和文件统计，得到 %v", path, stats)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+var (
+	_ aggregate.LogStore = (*aggregate.DirStore)(nil)
+	_ aggregate.LogStore = (*aggregate.RemoteStore)(nil)
+)
+
+const storeTailInterval = 20 * time.Millisecond
+
+// TestLogStoreContract 对DirStore和通过web服务访问的RemoteStore运行相同的测试
+func TestLogStoreContract(t *testing.T) {
+	t.Run("DirStore", func(t *testing.T) {
+		testLogStoreContract(t, func(t *testing.T, logDir string) aggregate.LogStore {
+			return aggregate.NewDirStore(logDir, aggregate.WithTailInterval(storeTailInterval))
+		})
+	})
+	t.Run("RemoteStore", func(t *testing.T) {
+		testLogStoreContract(t, func(t *testing.T, logDir string) aggregate.LogStore {
+			t.Setenv(apiKeysEnv, "reader:r-secret:read")
+			ws := NewWebServer(logDir, "8080", WithLogStore(aggregate.NewDirStore(logDir, aggregate.WithTailInterval(storeTailInterval))))
+			server := httptest.NewServer(ws.routes())
+			t.Cleanup(func() {
+				close(ws.shutdownCh)
+				server.Close()
+			})
+			return aggregate.NewRemoteStore(server.URL+"/", "r-secret")
+		})
+	})
+}
+
+func testLogStoreContract(t *testing.T, newStore func(t *testing.T, logDir string) aggregate.LogStore) {
+	logDir := t.TempDir()
+	path := filepath.Join(logDir, "app.log")
+	content := strings.Join([]string{
+		`{"timestamp":"2024-01-15T10:30:00Z","level":"info","msg":"started","service":"api"}`,
+		`{"timestamp":"2024-01-15T10:30:01Z","level":"error","msg":"boom 1","service":"api","trace_id":"t1"}`,
+		`{"timestamp":"2024-01-15T10:30:02Z","level":"error","msg":"boom 2","service":"worker"}`,
+		`not json`,
+	}, "\n") + "\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+	store := newStore(t, logDir)
+	ctx := context.Background()
+
+	t.Run("查询", func(t *testing.T) {
+		result, err := store.Query(ctx, aggregate.LogQuery{Level: "error", Limit: 1})
+		if err != nil {
+			t.Fatalf("查询失败: %v", err)
+		}
+		if result.Total != 2 || len(result.Entries) != 1 || result.Entries[0].Message != "boom 1" {
+			t.Errorf("期望2条匹配、返回第1条，得到 total=%d entries=%+v", result.Total, result.Entries)
+		}
+
+		result, err = store.Query(ctx, aggregate.LogQuery{TraceID: "t1", Limit: 10})
+		if err != nil {
+			t.Fatalf("查询失败: %v", err)
+		}
+		if result.Total != 1 || result.Entries[0].Service != "api" {
+			t.Errorf("期望按trace_id找到1条，得到 %+v", result)
+		}
+	})
+
+	t.Run("统计", func(t *testing.T) {
+		stats, err := store.Stats(ctx)
+		if err != nil {
+			t.Fatalf("统计失败: %v", err)
+		}
+		if stats.TotalFiles != 1 || stats.TotalSize != int64(len(content)) || stats.NewestFile != "app.log" || stats.MalformedLines != 1 {
+			t.Errorf("统计信息错误: %+v", stats)
+		}
+	})
+
+	t.Run("跟踪", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		entries, err := store.Tail(ctx, aggregate.LogQuery{Level: "error"})
+		if err != nil {
+			t.Fatalf("跟踪失败: %v", err)
+		}
+
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatalf("打开日志文件失败: %v", err)
+		}
+		file.WriteString(`{"level":"info","msg":"ignored"}` + "\n")
+		file.WriteString(`{"level":"error","msg":"tailed","service":"api"}` + "\n")
+		file.Close()
+
+		select {
+		case entry := <-entries:
+			if entry.Message != "tailed" || entry.Service != "api" {
+				t.Errorf("期望跟踪到新写入的错误日志，得到 %+v", entry)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("没有跟踪到新写入的日志")
+		}
+
+		// ctx取消后channel关闭
+		cancel()
+		deadline := time.After(5 * time.Second)
+		for {
+			select {
+			case _, ok := <-entries:
+				if !ok {
+					return
+				}
+			case <-deadline:
+				t.Fatal("ctx取消后channel没有关闭")
+			}
+		}
+	})
+}
+
+func TestRemoteStoreErrors(t *testing.T) {
+	t.Setenv(apiKeysEnv, "reader:r-secret:read")
+	ws := NewWebServer(t.TempDir(), "8080")
+	server := httptest.NewServer(ws.routes())
+	defer server.Close()
+
+	store := aggregate.NewRemoteStore(server.URL, "wrong")
+	if _, err := store.Stats(context.Background()); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("期望密钥错误返回401，得到 %v", err)
+	}
+	if _, err := store.Tail(context.Background(), aggregate.LogQuery{}); err == nil {
+		t.Error("期望密钥错误时跟踪失败")
+	}
+
+	store = aggregate.NewRemoteStore(server.URL, "r-secret")
+	if _, err := store.Query(context.Background(), aggregate.LogQuery{Level: "verbose"}); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("期望无效级别返回400，得到 %v", err)
+	}
+}
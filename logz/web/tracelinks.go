@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// 追踪界面链接模板的环境变量
+const (
+	// traceURLTemplateEnv 默认的链接模板，如"https://jaeger.internal/trace/{trace_id}"
+	traceURLTemplateEnv = "TRACE_UI_URL_TEMPLATE"
+	// serviceTraceURLTemplatesEnv 按服务名设置的链接模板，空白分隔的"服务名=模板"
+	serviceTraceURLTemplatesEnv = "TRACE_UI_URL_TEMPLATES"
+)
+
+// 链接模板中的占位符，替换为URL编码后的值，{trace_id}是必需的
+const (
+	traceIDPlaceholder = "{trace_id}"
+	spanIDPlaceholder  = "{span_id}"
+	servicePlaceholder = "{service}"
+)
+
+// traceLinks 追踪界面（Jaeger、Tempo等）的链接模板，零值不生成链接
+type traceLinks struct {
+	Default  string            `json:"trace_url_template,omitempty"`  // 没有按服务名设置时使用的模板
+	Services map[string]string `json:"trace_url_templates,omitempty"` // 服务名 -> 模板
+}
+
+// WithTraceURLTemplate 设置追踪界面的链接模板，查询接口为带有TraceID的条目返回trace_url
+// 模板必须是包含{trace_id}的http(s) URL，还可以使用{span_id}和{service}；无效的模板记录日志后忽略
+func WithTraceURLTemplate(template string) WebServerOption {
+	return func(ws *WebServer) {
+		if err := validateTraceURLTemplate(template); err != nil {
+			log.Printf("无效的追踪链接模板: %v", err)
+			return
+		}
+		ws.traceLinks.Default = template
+	}
+}
+
+// WithServiceTraceURLTemplate 为服务设置单独的链接模板，用于使用不同追踪后端的服务，优先于WithTraceURLTemplate
+func WithServiceTraceURLTemplate(service, template string) WebServerOption {
+	return func(ws *WebServer) {
+		service = strings.TrimSpace(service)
+		if service == "" {
+			log.Printf("无效的追踪链接模板: 服务名不能为空")
+			return
+		}
+		if err := validateTraceURLTemplate(template); err != nil {
+			log.Printf("无效的追踪链接模板: %s: %v", service, err)
+			return
+		}
+		if ws.traceLinks.Services == nil {
+			ws.traceLinks.Services = make(map[string]string)
+		}
+		ws.traceLinks.Services[service] = template
+	}
+}
+
+// validateTraceURLTemplate 检查模板包含{trace_id}，且替换占位符后是http(s) URL
+func validateTraceURLTemplate(template string) error {
+	if !strings.Contains(template, traceIDPlaceholder) {
+		return fmt.Errorf("模板必须包含%s: %s", traceIDPlaceholder, template)
+	}
+	parsed, err := url.Parse(renderTraceURL(template, "0", "0", "service"))
+	if err != nil {
+		return fmt.Errorf("模板不是有效的URL: %w", err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("模板必须是http或https URL: %s", template)
+	}
+	return nil
+}
+
+// parseServiceTraceURLTemplates 解析空白分隔的"服务名=模板"
+func parseServiceTraceURLTemplates(value string) (map[string]string, error) {
+	templates := make(map[string]string)
+	for _, item := range strings.Fields(value) {
+		service, template, ok := strings.Cut(item, "=")
+		if !ok || service == "" {
+			return nil, fmt.Errorf("格式应为服务名=模板: %s", item)
+		}
+		if err := validateTraceURLTemplate(template); err != nil {
+			return nil, fmt.Errorf("%s: %w", service, err)
+		}
+		templates[service] = template
+	}
+	return templates, nil
+}
+
+// traceLinkOptionsFromEnv 从环境变量读取链接模板
+func traceLinkOptionsFromEnv() []WebServerOption {
+	var opts []WebServerOption
+	if template := strings.TrimSpace(os.Getenv(traceURLTemplateEnv)); template != "" {
+		opts = append(opts, WithTraceURLTemplate(template))
+	}
+	if value := os.Getenv(serviceTraceURLTemplatesEnv); value != "" {
+		templates, err := parseServiceTraceURLTemplates(value)
+		if err != nil {
+			log.Printf("无效的%s: %v", serviceTraceURLTemplatesEnv, err)
+		}
+		for service, template := range templates {
+			opts = append(opts, WithServiceTraceURLTemplate(service, template))
+		}
+	}
+	return opts
+}
+
+// enabled 是否配置了任何模板
+func (l traceLinks) enabled() bool {
+	return l.Default != "" || len(l.Services) > 0
+}
+
+// url 返回条目的追踪界面链接，条目没有TraceID或没有适用的模板时返回空字符串
+func (l traceLinks) url(entry aggregate.LogEntry) string {
+	if entry.TraceID == "" {
+		return ""
+	}
+	template, ok := l.Services[entry.Service]
+	if !ok {
+		template = l.Default
+	}
+	if template == "" {
+		return ""
+	}
+	return renderTraceURL(template, entry.TraceID, entry.SpanID, entry.Service)
+}
+
+// renderTraceURL 将模板中的占位符替换为URL编码后的值
+func renderTraceURL(template, traceID, spanID, service string) string {
+	return strings.NewReplacer(
+		traceIDPlaceholder, url.PathEscape(traceID),
+		spanIDPlaceholder, url.PathEscape(spanID),
+		servicePlaceholder, url.PathEscape(service),
+	).Replace(template)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/HsiaoL1/trace/logz/aggregate"
+)
+
+// traceURLs 调用查询接口，返回每条消息的trace_url，entriesPath为条目数组在data中的位置
+func traceURLs(t *testing.T, handler http.Handler, method, path, body string, entriesPath ...string) map[string]string {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s 期望200，得到 %d: %s", path, w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	data := response.Data
+	for _, key := range entriesPath {
+		if err := json.Unmarshal(data[key], &data); err != nil {
+			t.Fatalf("解析 %s 失败: %v", key, err)
+		}
+	}
+	var entries []struct {
+		Message  string `json:"msg"`
+		TraceURL string `json:"trace_url"`
+	}
+	if err := json.Unmarshal(data["entries"], &entries); err != nil {
+		t.Fatalf("解析条目失败: %v", err)
+	}
+	urls := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		urls[entry.Message] = entry.TraceURL
+	}
+	return urls
+}
+
+func TestTraceURLs(t *testing.T) {
+	aggregate.SetGlobalAggregator(nil)
+	dir := t.TempDir()
+	writeDashboardFixture(t, dir)
+
+	// 未配置模板时不返回trace_url
+	handler := NewWebServer(dir, "8080").routes()
+	for message, url := range traceURLs(t, handler, "GET", "/api/v1/logs/trace/trace-a", "") {
+		if url != "" {
+			t.Errorf("期望未配置时没有trace_url，%s 得到 %s", message, url)
+		}
+	}
+	status, response := doAPI(t, handler, "GET", "/api/v1/config/ui", "")
+	if data, _ := json.Marshal(response.Data); status != http.StatusOK || string(data) != "{}" {
+		t.Errorf("期望未配置时返回空配置，得到 %d %s", status, data)
+	}
+
+	handler = NewWebServer(dir, "8080",
+		WithTraceURLTemplate("https://jaeger.internal/trace/{trace_id}"),
+		WithServiceTraceURLTemplate("billing", "https://tempo.internal/explore?trace={trace_id}&service={service}"),
+		WithTraceURLTemplate("https://jaeger.internal/trace"), // 没有{trace_id}，忽略
+	).routes()
+
+	jaeger := "https://jaeger.internal/trace/trace-a"
+	tempo := "https://tempo.internal/explore?trace=trace-a&service=billing"
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		body        string
+		entriesPath []string
+	}{
+		{"按TraceID查询", "GET", "/api/v1/logs/trace/trace-a", "", nil},
+		{"按TraceID查询并格式化时间", "GET", "/api/v1/logs/trace/trace-a?tz=Asia/Shanghai", "", nil},
+		{"搜索", "POST", "/api/v1/logs/search", `{"trace_id":"trace-a"}`, []string{"result"}},
+		{"错误日志", "GET", "/api/v1/logs/errors?limit=100", "", nil},
+		{"页面使用的错误日志", "GET", "/api/errors?limit=100", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			urls := traceURLs(t, handler, tt.method, tt.path, tt.body, tt.entriesPath...)
+			if urls["failure a"] != jaeger {
+				t.Errorf("期望默认模板生成 %s，得到 %q", jaeger, urls["failure a"])
+			}
+			// 错误日志接口只返回error级别，不包含fatal的crash
+			if url, ok := urls["crash"]; ok && url != tempo {
+				t.Errorf("期望billing使用单独的模板生成 %s，得到 %q", tempo, urls["crash"])
+			}
+		})
+	}
+
+	if urls := traceURLs(t, handler, "POST", "/api/v1/logs/search", `{"trace_id":"trace-a"}`, "result"); urls["crash"] != tempo {
+		t.Errorf("期望搜索结果中billing使用单独的模板，得到 %q", urls["crash"])
+	}
+
+	status, response = doAPI(t, handler, "GET", "/api/v1/config/ui", "")
+	data, _ := json.Marshal(response.Data)
+	var config traceLinks
+	json.Unmarshal(data, &config)
+	if status != http.StatusOK || config.Default != "https://jaeger.internal/trace/{trace_id}" ||
+		config.Services["billing"] != "https://tempo.internal/explore?trace={trace_id}&service={service}" {
+		t.Errorf("期望返回配置的模板，得到 %d %s", status, data)
+	}
+}
+
+func TestTraceURLTemplateValidation(t *testing.T) {
+	for _, template := range []string{
+		"https://jaeger.internal/search",
+		"javascript:alert('{trace_id}')",
+		"/trace/{trace_id}",
+		"",
+	} {
+		if err := validateTraceURLTemplate(template); err == nil {
+			t.Errorf("期望拒绝模板 %q", template)
+		}
+	}
+	if err := validateTraceURLTemplate("http://localhost:16686/trace/{trace_id}?uiFind={span_id}"); err != nil {
+		t.Errorf("期望接受模板，得到 %v", err)
+	}
+
+	templates, err := parseServiceTraceURLTemplates("orders=https://jaeger/trace/{trace_id}\n payments=https://tempo/t/{trace_id}")
+	if err != nil || len(templates) != 2 || templates["payments"] != "https://tempo/t/{trace_id}" {
+		t.Errorf("期望解析两个服务的模板，得到 %v %v", templates, err)
+	}
+	if _, err := parseServiceTraceURLTemplates("orders=https://jaeger/trace"); err == nil {
+		t.Error("期望拒绝没有{trace_id}的服务模板")
+	}
+	if _, err := parseServiceTraceURLTemplates("https://jaeger/trace/{trace_id}"); err == nil {
+		t.Error("期望拒绝没有服务名的条目")
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/HsiaoL1/trace"
+	"github.com/HsiaoL1/trace/logz/aggregate"
+	"go.opentelemetry.io/otel/codes"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// 追踪配置
+const (
+	tracingEnv         = "ENABLE_TRACING"
+	tracingServiceName = "logz-web"
+
+	// streamPath 日志流端点，连接持续时间很长，不为整个连接创建span
+	streamPath = "/api/logs/stream"
+	// streamSpanSampleRate 日志流每推送多少条消息记录一个子span
+	streamSpanSampleRate = 100
+)
+
+// WithTracing 设置是否为每个请求创建span
+// 只负责创建span，span的导出需要先调用trace.InitJaeger，main中由ENABLE_TRACING环境变量控制
+func WithTracing(enabled bool) WebServerOption {
+	return func(ws *WebServer) {
+		ws.tracing = enabled
+	}
+}
+
+// initTracing 当ENABLE_TRACING=true时初始化Jaeger，返回是否启用追踪和清理函数
+// 未通过OTEL_SERVICE_NAME或JAEGER_SERVICE_NAME指定服务名时使用"logz-web"
+func initTracing() (bool, func(), error) {
+	enabled, _ := strconv.ParseBool(os.Getenv(tracingEnv))
+	if !enabled {
+		return false, func() {}, nil
+	}
+
+	config := trace.LoadJaegerConfigFromEnv()
+	if os.Getenv("OTEL_SERVICE_NAME") == "" && os.Getenv("JAEGER_SERVICE_NAME") == "" {
+		config.ServiceName = tracingServiceName
+	}
+	shutdown, err := trace.InitJaeger(config)
+	if err != nil {
+		return false, nil, err
+	}
+	return true, shutdown, nil
+}
+
+// traceHandler 启用追踪时为请求创建server span，内层的panic记录在span上后继续向上抛出，由recovery返回500
+// 日志流连接只提取上游追踪上下文，由handleLogStream按消息采样记录子span
+// span使用创建时的受信任代理配置，重新加载配置不影响
+func (ws *WebServer) traceHandler(next http.Handler) http.Handler {
+	if !ws.tracing {
+		return next
+	}
+	ws.settingsMutex.RLock()
+	trustedProxies := ws.trustedProxies
+	ws.settingsMutex.RUnlock()
+	traced := trace.OpenTelemetryMiddlewareWithOptions(recordPanic(next), trace.WithTrustedProxies(trustedProxies...))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == streamPath {
+			next.ServeHTTP(w, r.WithContext(trace.ExtractOtelTraceContext(r)))
+			return
+		}
+		traced.ServeHTTP(w, r)
+	})
+}
+
+// recordPanic 在请求的span上记录panic并继续向上抛出，http.ErrAbortHandler是中断连接的信号，不记录
+func recordPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			value := recover()
+			if value == nil {
+				return
+			}
+			if value != http.ErrAbortHandler {
+				err := fmt.Errorf("panic: %v", value)
+				span := oteltrace.SpanFromContext(r.Context())
+				span.RecordError(err, oteltrace.WithStackTrace(true))
+				span.SetStatus(codes.Error, err.Error())
+			}
+			panic(value)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// queryLogs 在子span中查询日志，并补充日志文件查找配置
+// 需要扫描大量文件的查询先经过准入控制，并发已满时排队等待
+func (ws *WebServer) queryLogs(ctx context.Context, query aggregate.LogQuery) (*aggregate.LogQueryResult, error) {
+	ctx, span := trace.StartInternalSpan(ctx, "aggregate.QueryLogs")
+	defer span.End()
+
+	trace.SetAttribute(span, "logz.query.use_index", query.UseIndex)
+	trace.SetAttribute(span, "logz.query.limit", query.Limit)
+	if query.Level != "" {
+		trace.SetAttribute(span, "logz.query.level", query.Level)
+	}
+	if query.TraceID != "" {
+		trace.SetAttribute(span, "logz.query.trace_id", query.TraceID)
+	}
+	if query.Service != "" {
+		trace.SetAttribute(span, "logz.query.service", query.Service)
+	}
+
+	query = ws.logQuery(query)
+	ctx, release, err := ws.admitQuery(ctx, query)
+	if err != nil {
+		trace.RecordError(span, err)
+		return nil, err
+	}
+	defer release()
+
+	result, err := ws.store.Query(ctx, query)
+	if err != nil {
+		trace.RecordError(span, err)
+		return nil, err
+	}
+	trace.SetAttribute(span, "logz.result.total", result.Total)
+	trace.SetAttribute(span, "logz.result.returned", len(result.Entries))
+	trace.SetAttribute(span, "logz.result.truncated", result.Truncated)
+	return result, nil
+}
+
+// streamTracer 为日志流连接采样记录消息span，避免整个连接成为一个巨大的span
+type streamTracer struct {
+	ctx   context.Context
+	count atomic.Int64
+}
+
+// newStreamTracer 记录连接建立的span并返回消息追踪器
+func newStreamTracer(ctx context.Context, r *http.Request, clientIP string) *streamTracer {
+	_, span := trace.StartServerSpan(ctx, "logz.stream.connect")
+	trace.SetAttribute(span, "net.peer.addr", r.RemoteAddr)
+	trace.SetAttribute(span, "net.peer.ip", clientIP)
+	span.End()
+	return &streamTracer{ctx: oteltrace.ContextWithSpanContext(ctx, span.SpanContext())}
+}
+
+// message 记录一条推送的消息，每streamSpanSampleRate条消息（包括第一条）创建一个子span
+func (st *streamTracer) message(messageType string, size int) {
+	n := st.count.Add(1)
+	if (n-1)%streamSpanSampleRate != 0 {
+		return
+	}
+	_, span := trace.StartProducerSpan(st.ctx, "logz.stream.message")
+	trace.SetAttribute(span, "logz.stream.message_type", messageType)
+	trace.SetAttribute(span, "logz.stream.message_bytes", size)
+	trace.SetAttribute(span, "logz.stream.sequence", n)
+	span.End()
+}
+
+// countingReader 记录已读取的字节数
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
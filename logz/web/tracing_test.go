@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/HsiaoL1/trace/tracetest"
+)
+
+func TestRequestTracing(t *testing.T) {
+	rec := tracetest.Start(t)
+
+	tempDir := t.TempDir()
+	content := `{"timestamp":"2024-01-15T10:30:00Z","level":"error","msg":"boom"}` + "\n"
+	if err := os.WriteFile(filepath.Join(tempDir, "app.log"), []byte(content), 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+	ws := NewWebServer(tempDir, "8080", WithTracing(true))
+	handler := ws.routes()
+
+	serve := func(method, path, body string) {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s 期望状态码 200，得到 %d", method, path, w.Code)
+		}
+	}
+
+	t.Run("搜索", func(t *testing.T) {
+		rec.Reset()
+		serve("POST", "/api/search", `{"level":"error","limit":10}`)
+
+		server := rec.RequireSpan(t, "POST /api/search")
+		query := rec.RequireSpan(t, "aggregate.QueryLogs")
+		rec.AssertParent(t, query, server)
+		rec.AssertAttr(t, query, "logz.query.level", "error")
+		rec.AssertAttr(t, query, "logz.result.total", 1)
+	})
+
+	t.Run("读取文件和缓存", func(t *testing.T) {
+		rec.Reset()
+		serve("GET", "/api/files/content/app.log", "")
+
+		server := rec.RequireSpan(t, "GET /api/files/content/app.log")
+		read := rec.RequireSpan(t, "logz.web.readLogFile")
+		lookup := rec.RequireSpan(t, "logz.web.cacheLookup")
+		rec.AssertParent(t, read, server)
+		rec.AssertParent(t, lookup, read)
+		rec.AssertAttr(t, read, "logz.file", "app.log")
+		rec.AssertAttr(t, read, "logz.bytes_scanned", len(content))
+		rec.AssertAttr(t, lookup, "logz.cache.hit", false)
+
+		rec.Reset()
+		serve("GET", "/api/files/content/app.log", "")
+		rec.AssertAttr(t, rec.RequireSpan(t, "logz.web.cacheLookup"), "logz.cache.hit", true)
+	})
+
+	t.Run("日志流", func(t *testing.T) {
+		rec.Reset()
+		// 连接已关闭，推送connected消息后立即返回
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/logs/stream", nil).WithContext(ctx))
+		if !strings.Contains(w.Body.String(), `data: {"type":"connected"}`) {
+			t.Errorf("期望推送connected消息，得到 %q", w.Body.String())
+		}
+
+		if span := rec.SpanByName("GET /api/logs/stream"); span != nil {
+			t.Error("日志流连接不应创建覆盖整个连接的span")
+		}
+		connect := rec.RequireSpan(t, "logz.stream.connect")
+		message := rec.RequireSpan(t, "logz.stream.message")
+		rec.AssertParent(t, message, connect)
+	})
+}
+
+func TestStreamTracerSampling(t *testing.T) {
+	rec := tracetest.Start(t)
+
+	req := httptest.NewRequest("GET", streamPath, nil)
+	stream := newStreamTracer(req.Context(), req, "192.0.2.1")
+	for i := 0; i < 2*streamSpanSampleRate+1; i++ {
+		stream.message("log", 10)
+	}
+
+	var messages int
+	for _, span := range rec.Spans() {
+		if span.Name() == "logz.stream.message" {
+			messages++
+		}
+	}
+	if messages != 3 {
+		t.Errorf("期望采样记录3个消息span，得到 %d", messages)
+	}
+}
@@ -1,14 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/HsiaoL1/trace/logz"
+	"github.com/HsiaoL1/trace/logz/aggregate"
 )
 
 func TestWebServer(t *testing.T) {
@@ -177,8 +187,8 @@ func TestWebServer(t *testing.T) {
 		w := httptest.NewRecorder()
 		server.getLogContent(w, req, "../../../etc/passwd")
 
-		if w.Code != http.StatusOK {
-			t.Errorf("期望状态码 200，得到 %d", w.Code)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("期望状态码 400，得到 %d", w.Code)
 		}
 
 		var response LogViewResponse
@@ -257,3 +267,797 @@ func BenchmarkGetLogFiles(b *testing.B) {
 		server.getLogFiles(w, req)
 	}
 }
+
+func TestMaintenanceCleanup(t *testing.T) {
+	tempDir := t.TempDir()
+	oldFile := filepath.Join(tempDir, "old.log.gz")
+	if err := os.WriteFile(oldFile, []byte("compressed"), 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+	mtime := time.Now().AddDate(0, 0, -10)
+	if err := os.Chtimes(oldFile, mtime, mtime); err != nil {
+		t.Fatalf("设置文件修改时间失败: %v", err)
+	}
+
+	api := NewAPIServer(NewWebServer(tempDir, "8080"))
+
+	t.Run("DryRun", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/v1/maintenance/cleanup?days=7&dry_run=true", nil)
+		w := httptest.NewRecorder()
+		api.handleMaintenanceCleanup(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("期望状态码 200，得到 %d", w.Code)
+		}
+		if _, err := os.Stat(oldFile); err != nil {
+			t.Error("dry run不应删除文件")
+		}
+	})
+
+	t.Run("InvalidDays", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/v1/maintenance/cleanup?days=abc", nil)
+		w := httptest.NewRecorder()
+		api.handleMaintenanceCleanup(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("期望状态码 400，得到 %d", w.Code)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/api/v1/maintenance/cleanup?days=7", nil)
+		w := httptest.NewRecorder()
+		api.handleMaintenanceCleanup(w, req)
+
+		var response APIResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("解析响应失败: %v", err)
+		}
+		data, ok := response.Data.(map[string]interface{})
+		if !ok {
+			t.Fatal("响应数据类型错误")
+		}
+		report, ok := data["report"].(map[string]interface{})
+		if !ok {
+			t.Fatal("清理报告类型错误")
+		}
+		if report["files_deleted"].(float64) != 1 {
+			t.Errorf("期望删除1个文件，得到 %v", report["files_deleted"])
+		}
+		if _, err := os.Stat(oldFile); !os.IsNotExist(err) {
+			t.Error("文件应该已被删除")
+		}
+	})
+}
+
+func TestAggregatorInfo(t *testing.T) {
+	tempDir := t.TempDir()
+	content := "{\"level\":\"info\",\"msg\":\"a\"}\n{\"level\":\"info\",\"msg\":\"b\"}\n"
+	if err := os.WriteFile(filepath.Join(tempDir, "svc_2024-01-15_001.log"), []byte(content), 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+
+	api := NewAPIServer(NewWebServer(tempDir, "8080"))
+	req := httptest.NewRequest("GET", "/api/v1/aggregator/info", nil)
+	w := httptest.NewRecorder()
+	api.handleAggregatorInfo(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("期望状态码 200，得到 %d", w.Code)
+	}
+
+	var response APIResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	data, ok := response.Data.(map[string]interface{})
+	if !ok {
+		t.Fatal("响应数据类型错误")
+	}
+	if data["total_entries"].(float64) != 2 {
+		t.Errorf("期望2条日志，得到 %v", data["total_entries"])
+	}
+	if files := data["files"].([]interface{}); len(files) != 1 {
+		t.Errorf("期望1个数据文件，得到 %d", len(files))
+	}
+}
+
+func TestAggregatorFlushAndRotate(t *testing.T) {
+	tempDir := t.TempDir()
+	handler := NewWebServer(tempDir, "8080").routes()
+
+	aggregate.SetGlobalAggregator(nil)
+	if status, response := doAPI(t, handler, "POST", "/api/v1/aggregator/flush", ""); status != http.StatusServiceUnavailable || response.ErrorCode != aggregate.CodeNoAggregator {
+		t.Errorf("期望没有聚合器时返回 503 %s，得到 %d %q", aggregate.CodeNoAggregator, status, response.ErrorCode)
+	}
+
+	aggregator, err := aggregate.NewLogAggregatorWithOptions(tempDir, "admin", aggregate.WithBatchSize(1000))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+	aggregate.SetGlobalAggregator(aggregator)
+	defer aggregate.SetGlobalAggregator(nil)
+	if err := aggregator.WriteLog(aggregate.LogEntry{Level: "info", Message: "buffered", TraceID: "trace-admin"}); err != nil {
+		t.Fatalf("写入日志失败: %v", err)
+	}
+
+	// 刷新后缓冲的日志可以通过索引查询
+	status, response := doAPI(t, handler, "POST", "/api/v1/aggregator/flush", "")
+	data, _ := response.Data.(map[string]interface{})
+	if status != http.StatusOK || data["total_entries"] != float64(1) || data["index_lag_entries"] != float64(0) {
+		t.Fatalf("期望刷新后有 1 条已索引的日志，得到 %d %v", status, response.Data)
+	}
+	result, err := aggregate.QueryLogs(aggregate.LogQuery{TraceID: "trace-admin", RequireIndex: true, Limit: 10}, tempDir)
+	if err != nil || result.Total != 1 {
+		t.Errorf("期望通过索引查询到 1 条，得到 %+v %v", result, err)
+	}
+
+	status, response = doAPI(t, handler, "POST", "/api/v1/aggregator/rotate", "")
+	data, _ = response.Data.(map[string]interface{})
+	if files, _ := data["files"].([]interface{}); status != http.StatusOK || len(files) != 2 {
+		t.Errorf("期望轮转后有 2 个数据文件，得到 %d %v", status, response.Data)
+	}
+
+	// 文件注册表记录轮转前后的文件
+	status, response = doAPI(t, handler, "GET", "/api/v1/aggregator/files", "")
+	records, _ := response.Data.([]interface{})
+	if status != http.StatusOK || len(records) != 2 {
+		t.Fatalf("期望文件注册表有 2 个文件，得到 %d %v", status, response.Data)
+	}
+	if first, _ := records[0].(map[string]interface{}); first["state"] != aggregate.FileStateRotated || first["entry_count"] != float64(1) {
+		t.Errorf("期望第一个文件已轮转且有 1 条日志，得到 %v", first)
+	}
+	if second, _ := records[1].(map[string]interface{}); second["state"] != aggregate.FileStateActive {
+		t.Errorf("期望第二个文件正在写入，得到 %v", second)
+	}
+
+	if status, _ := doAPI(t, handler, "GET", "/api/v1/aggregator/rotate", ""); status != http.StatusMethodNotAllowed {
+		t.Errorf("期望状态码 405，得到 %d", status)
+	}
+}
+
+func TestIndexCompact(t *testing.T) {
+	tempDir := t.TempDir()
+	handler := NewWebServer(tempDir, "8080").routes()
+
+	aggregate.SetGlobalAggregator(nil)
+	if status, response := doAPI(t, handler, "POST", "/api/v1/index/compact", ""); status != http.StatusServiceUnavailable || response.ErrorCode != aggregate.CodeNoAggregator {
+		t.Errorf("期望没有聚合器时返回 503 %s，得到 %d %q", aggregate.CodeNoAggregator, status, response.ErrorCode)
+	}
+
+	aggregator, err := aggregate.NewLogAggregatorWithOptions(tempDir, "compact", aggregate.WithBatchSize(1))
+	if err != nil {
+		t.Fatalf("创建聚合器失败: %v", err)
+	}
+	defer aggregator.Close()
+	aggregate.SetGlobalAggregator(aggregator)
+	defer aggregate.SetGlobalAggregator(nil)
+	if err := aggregator.WriteLog(aggregate.LogEntry{Level: "info", Message: "indexed", TraceID: "trace-compact"}); err != nil {
+		t.Fatalf("写入日志失败: %v", err)
+	}
+	if err := aggregator.Flush(); err != nil {
+		t.Fatalf("刷新失败: %v", err)
+	}
+
+	status, response := doAPI(t, handler, "POST", "/api/v1/index/compact", "")
+	data, _ := response.Data.(map[string]interface{})
+	if status != http.StatusOK || data["before_size"] == nil || data["after_size"] == nil {
+		t.Fatalf("期望返回压缩前后的大小，得到 %d %v", status, response.Data)
+	}
+	result, err := aggregate.QueryLogs(aggregate.LogQuery{TraceID: "trace-compact", RequireIndex: true, Limit: 10}, tempDir)
+	if err != nil || result.Total != 1 {
+		t.Errorf("期望压缩后通过索引查询到 1 条，得到 %+v %v", result, err)
+	}
+
+	if status, _ := doAPI(t, handler, "GET", "/api/v1/index/compact", ""); status != http.StatusMethodNotAllowed {
+		t.Errorf("期望状态码 405，得到 %d", status)
+	}
+}
+
+func TestGroupedErrors(t *testing.T) {
+	tempDir := t.TempDir()
+	now := time.Now().UTC()
+	lines := []string{
+		fmt.Sprintf(`{"timestamp":%q,"level":"error","msg":"timeout after 31ms","caller":"db.go:42","trace_id":"trace-a"}`, now.Add(-time.Hour).Format(time.RFC3339)),
+		fmt.Sprintf(`{"timestamp":%q,"level":"error","msg":"timeout after 87ms","caller":"db.go:42","trace_id":"trace-b"}`, now.Add(-time.Minute).Format(time.RFC3339)),
+		fmt.Sprintf(`{"timestamp":%q,"level":"error","msg":"timeout after 10ms","caller":"db.go:42"}`, now.Add(-48*time.Hour).Format(time.RFC3339)),
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "svc_2024-01-15_001.log"), []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+
+	api := NewAPIServer(NewWebServer(tempDir, "8080"))
+	req := httptest.NewRequest("GET", "/api/v1/errors/grouped?window=24h", nil)
+	w := httptest.NewRecorder()
+	api.handleGroupedErrors(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("期望状态码 200，得到 %d", w.Code)
+	}
+
+	var response APIResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	data := response.Data.(map[string]interface{})
+	groups := data["groups"].([]interface{})
+	if len(groups) != 1 {
+		t.Fatalf("期望1个分组，得到 %d", len(groups))
+	}
+	group := groups[0].(map[string]interface{})
+	if group["count"].(float64) != 2 {
+		t.Errorf("期望窗口内2条错误，得到 %v", group["count"])
+	}
+	if ids := group["trace_ids"].([]interface{}); len(ids) != 2 {
+		t.Errorf("期望2个TraceID，得到 %v", ids)
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/errors/grouped?window=abc", nil)
+	w = httptest.NewRecorder()
+	api.handleGroupedErrors(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("期望状态码 400，得到 %d", w.Code)
+	}
+}
+
+func TestNestedLogFiles(t *testing.T) {
+	base := t.TempDir()
+	logDir := filepath.Join(base, "logs")
+	line := []byte(`{"timestamp":"2024-01-15T10:30:00Z","level":"info","msg":"nested"}` + "\n")
+	if err := os.MkdirAll(filepath.Join(logDir, "svc1"), 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(logDir, "svc1", "app.jsonl"), line, 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "secret.jsonl"), line, 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(base, "secret.jsonl"), filepath.Join(logDir, "svc1", "escape.jsonl")); err != nil {
+		t.Skipf("不支持符号链接: %v", err)
+	}
+
+	ws := NewWebServer(logDir, "8080", WithFilePatterns("*.jsonl"), WithRecursive(true))
+
+	files, _, err := ws.getLogFilesList(fileListOptions{})
+	if err != nil {
+		t.Fatalf("获取文件列表失败: %v", err)
+	}
+	if len(files) != 1 || files[0].Name != "svc1/app.jsonl" {
+		t.Fatalf("期望只返回 svc1/app.jsonl，得到 %+v", files)
+	}
+
+	getContent := func(name string) LogViewResponse {
+		req := httptest.NewRequest("GET", "/api/files/content/x", nil)
+		w := httptest.NewRecorder()
+		ws.getLogContent(w, req, name)
+		var response LogViewResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("解析响应失败: %v", err)
+		}
+		return response
+	}
+
+	if response := getContent("svc1/app.jsonl"); !response.Success {
+		t.Errorf("期望可以读取嵌套文件，得到错误: %s", response.Error)
+	}
+	for _, name := range []string{"../secret.jsonl", "svc1/../../secret.jsonl", "svc1/escape.jsonl", "/etc/passwd"} {
+		if response := getContent(name); response.Success {
+			t.Errorf("期望拒绝路径 %q", name)
+		}
+	}
+
+	api := NewAPIServer(ws)
+	req := httptest.NewRequest("GET", "/api/v1/files/content/svc1/escape.jsonl", nil)
+	w := httptest.NewRecorder()
+	api.handleGetFileContent(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("期望状态码 400，得到 %d", w.Code)
+	}
+}
+
+func TestHealthCheckEmail(t *testing.T) {
+	logz.SetEmailConfig(&logz.EmailConfig{Enabled: false})
+	t.Cleanup(func() { logz.SetEmailConfig(&logz.EmailConfig{Throttle: 5 * time.Minute}) })
+
+	api := NewAPIServer(NewWebServer(t.TempDir(), "8080"))
+	check := func() map[string]interface{} {
+		req := httptest.NewRequest("GET", "/api/v1/health", nil)
+		w := httptest.NewRecorder()
+		api.handleHealthCheck(w, req)
+
+		var response APIResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("解析响应失败: %v", err)
+		}
+		return response.Data.(map[string]interface{})
+	}
+
+	data := check()
+	email := data["checks"].(map[string]interface{})["email"].(map[string]interface{})
+	if email["status"] != "disabled" || data["status"] != "healthy" {
+		t.Errorf("期望邮件检查为disabled且服务健康，得到 %v", data)
+	}
+
+	// 启用邮件通知但SMTP服务器不可达
+	t.Setenv("SMTP_HOST", "127.0.0.1")
+	t.Setenv("SMTP_PORT", "1")
+	t.Setenv("SMTP_USER", "sender@example.com")
+	t.Setenv("SMTP_PASSWORD", "secret")
+	t.Setenv("SMTP_DIAL_TIMEOUT", "500ms")
+	logz.SetEmailConfig(&logz.EmailConfig{Enabled: true, ToEmail: "ops@example.com"})
+
+	data = check()
+	email = data["checks"].(map[string]interface{})["email"].(map[string]interface{})
+	if email["status"] != "error" || data["status"] != "degraded" {
+		t.Errorf("期望邮件检查为error且服务降级，得到 %v", data)
+	}
+}
+
+func TestLevelValidation(t *testing.T) {
+	tempDir := t.TempDir()
+	line := `{"timestamp":"2024-01-15T10:30:00Z","level":"warning","msg":"disk almost full"}` + "\n"
+	if err := os.WriteFile(filepath.Join(tempDir, "svc_2024-01-15_001.log"), []byte(line), 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+	api := NewAPIServer(NewWebServer(tempDir, "8080"))
+
+	search := func(level string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"level":%q}`, level)
+		req := httptest.NewRequest("POST", "/api/v1/logs/search", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		api.handleLogSearch(w, req)
+		return w
+	}
+
+	// 别名被规范化后可以查到以其他写法写入的日志
+	w := search("WARN")
+	if w.Code != http.StatusOK {
+		t.Fatalf("期望状态码 200，得到 %d", w.Code)
+	}
+	var response APIResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("解析响应失败: %v", err)
+	}
+	result := response.Data.(map[string]interface{})["result"].(map[string]interface{})
+	if total := result["total"]; total != float64(1) {
+		t.Errorf("期望查询到1条日志，得到 %v", total)
+	}
+
+	w = search("verbose")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("期望状态码 400，得到 %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "warn") {
+		t.Errorf("期望错误信息列出可用级别，得到 %s", w.Body.String())
+	}
+
+	for _, path := range []string{"/api/v1/logs/level/verbose", "/api/v1/errors/grouped?level=verbose"} {
+		req := httptest.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		if strings.Contains(path, "grouped") {
+			api.handleGroupedErrors(w, req)
+		} else {
+			api.handleLogSearchByLevel(w, req)
+		}
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s 期望状态码 400，得到 %d", path, w.Code)
+		}
+	}
+}
+
+func TestHostnameSearch(t *testing.T) {
+	aggregate.SetGlobalAggregator(nil)
+	tempDir := t.TempDir()
+	lines := `{"timestamp":"2024-01-15T10:30:00Z","level":"info","msg":"from a","service":"api","hostname":"host-a","pid":11}` + "\n" +
+		`{"timestamp":"2024-01-15T10:30:01Z","level":"info","msg":"from b","service":"api","hostname":"host-b","pid":12}` + "\n" +
+		`{"timestamp":"2024-01-15T10:30:02Z","level":"info","msg":"legacy","service":"api"}` + "\n"
+	if err := os.WriteFile(filepath.Join(tempDir, "api_2024-01-15_001.log"), []byte(lines), 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+	handler := NewWebServer(tempDir, "8080").routes()
+
+	status, response := doAPI(t, handler, "POST", "/api/v1/logs/search", `{"hostname":"host-b","limit":10}`)
+	data, _ := response.Data.(map[string]interface{})
+	result, _ := data["result"].(map[string]interface{})
+	entries, _ := result["entries"].([]interface{})
+	if status != http.StatusOK || len(entries) != 1 {
+		t.Fatalf("期望查询到 1 条，得到 %d %v", status, response.Data)
+	}
+	if entry := entries[0].(map[string]interface{}); entry["msg"] != "from b" || entry["pid"] != float64(12) {
+		t.Errorf("期望host-b的日志，得到 %v", entry)
+	}
+
+	// 旧版查询接口同样支持主机名过滤
+	status, response = doAPI(t, handler, "POST", "/api/search", `{"hostname":"host-a","limit":10}`)
+	legacy, _ := response.Data.(map[string]interface{})
+	if status != http.StatusOK || legacy["total"] != float64(1) {
+		t.Errorf("期望旧版接口查询到 1 条，得到 %d %v", status, response.Data)
+	}
+}
+
+func TestRelativeTimeSearch(t *testing.T) {
+	aggregate.SetGlobalAggregator(nil)
+	tempDir := t.TempDir()
+	now := time.Now()
+	var lines []string
+	for _, age := range []time.Duration{3 * time.Hour, 30 * time.Minute, time.Minute} {
+		lines = append(lines, fmt.Sprintf(`{"timestamp":%q,"level":"error","msg":"timeout after %dms","caller":"db.go:42"}`, now.Add(-age).Format(time.RFC3339), age.Milliseconds()))
+	}
+	if err := os.WriteFile(filepath.Join(tempDir, "svc_2024-01-15_001.log"), []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+	handler := NewWebServer(tempDir, "8080").routes()
+
+	search := func(body string) (int, map[string]interface{}, float64) {
+		t.Helper()
+		status, response := doAPI(t, handler, "POST", "/api/v1/logs/search", body)
+		data, _ := response.Data.(map[string]interface{})
+		result, _ := data["result"].(map[string]interface{})
+		info, _ := data["query_info"].(map[string]interface{})
+		total, _ := result["total"].(float64)
+		return status, info, total
+	}
+
+	// 相对时间在服务端解析，query_info中返回解析后的时间范围
+	status, info, total := search(`{"since":"1h"}`)
+	if status != http.StatusOK || total != 2 || info["since"] != "1h" {
+		t.Fatalf("期望最近1小时的 2 条日志，得到 %d %v %v", status, total, info)
+	}
+	if resolved, err := time.Parse(time.RFC3339Nano, fmt.Sprint(info["start_time"])); err != nil || resolved.Sub(now.Add(-time.Hour)).Abs() > time.Minute {
+		t.Errorf("期望start_time为一小时前，得到 %v (%v)", info["start_time"], err)
+	}
+	if _, _, total := search(`{"since":"2h","until":"10m"}`); total != 1 {
+		t.Errorf("期望2小时前到10分钟前的 1 条日志，得到 %v", total)
+	}
+	// 一端使用绝对时间、另一端使用相对时间
+	body := fmt.Sprintf(`{"start_time":%q,"until":"10m"}`, now.Add(-4*time.Hour).Format(time.RFC3339))
+	if _, _, total := search(body); total != 2 {
+		t.Errorf("期望start_time到10分钟前的 2 条日志，得到 %v", total)
+	}
+
+	for name, body := range map[string]string{
+		"无效的相对时间":  `{"since":"last week"}`,
+		"负数时长":     `{"until":"-5m"}`,
+		"时间范围冲突":   fmt.Sprintf(`{"start_time":%q,"until":"1h"}`, now.Add(-10*time.Minute).Format(time.RFC3339)),
+		"同时指定开始时间": fmt.Sprintf(`{"start_time":%q,"since":"1h"}`, now.Add(-4*time.Hour).Format(time.RFC3339)),
+		"同时指定结束时间": fmt.Sprintf(`{"end_time":%q,"until":"10m"}`, now.Format(time.RFC3339)),
+	} {
+		if status, response := doAPI(t, handler, "POST", "/api/v1/logs/search", body); status != http.StatusBadRequest || response.ErrorCode != aggregate.CodeInvalidQuery {
+			t.Errorf("%s: 期望 400 %s，得到 %d %q", name, aggregate.CodeInvalidQuery, status, response.ErrorCode)
+		}
+	}
+
+	// 旧版查询和错误分组接口同样支持since和until
+	status, response := doAPI(t, handler, "POST", "/api/search", `{"since":"1h","limit":10}`)
+	if legacy, _ := response.Data.(map[string]interface{}); status != http.StatusOK || legacy["total"] != float64(2) {
+		t.Errorf("期望旧版接口查询到 2 条，得到 %d %v", status, response.Data)
+	}
+	status, response = doAPI(t, handler, "GET", "/api/v1/errors/grouped?since=2h&until=10m", "")
+	data, _ := response.Data.(map[string]interface{})
+	groups, _ := data["groups"].([]interface{})
+	if status != http.StatusOK || len(groups) != 1 || groups[0].(map[string]interface{})["count"] != float64(1) {
+		t.Errorf("期望分组中有 1 条错误，得到 %d %v", status, response.Data)
+	}
+	if info, _ := data["query_info"].(map[string]interface{}); info["until"] != "10m" || info["end_time"] == nil {
+		t.Errorf("期望query_info包含解析后的结束时间，得到 %v", data["query_info"])
+	}
+	if status, _ := doAPI(t, handler, "GET", "/api/v1/errors/grouped?window=1h&since=1h", ""); status != http.StatusBadRequest {
+		t.Errorf("期望window和since同时指定时返回 400，得到 %d", status)
+	}
+	path := "/api/v1/errors/grouped?until=10m&end_time=" + url.QueryEscape(now.Format(time.RFC3339))
+	if status, _ := doAPI(t, handler, "GET", path, ""); status != http.StatusBadRequest {
+		t.Errorf("期望end_time和until同时指定时返回 400，得到 %d", status)
+	}
+}
+
+func TestSearchExplain(t *testing.T) {
+	aggregate.SetGlobalAggregator(nil)
+	tempDir := t.TempDir()
+	lines := `{"timestamp":"2024-01-15T10:30:00Z","level":"error","msg":"failed","service":"api"}` + "\n" +
+		`{"timestamp":"2024-01-15T10:30:01Z","level":"info","msg":"ok","service":"api"}` + "\n"
+	if err := os.WriteFile(filepath.Join(tempDir, "api.log"), []byte(lines), 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+	handler := NewWebServer(tempDir, "8080").routes()
+
+	explainOf := func(data interface{}) map[string]interface{} {
+		m, _ := data.(map[string]interface{})
+		if result, ok := m["result"].(map[string]interface{}); ok {
+			m = result
+		}
+		explain, _ := m["explain"].(map[string]interface{})
+		return explain
+	}
+
+	requests := []struct{ method, path, body string }{
+		{"POST", "/api/v1/logs/search", `{"level":"error","use_index":true,"explain":true}`},
+		{"POST", "/api/v1/logs/search?explain=true", `{"level":"error"}`},
+		{"POST", "/api/search", `{"level":"error","limit":10,"explain":true}`},
+		{"GET", "/api/v1/logs/level/error?explain=1", ""},
+	}
+	for _, req := range requests {
+		status, response := doAPI(t, handler, req.method, req.path, req.body)
+		explain := explainOf(response.Data)
+		if status != http.StatusOK || explain == nil {
+			t.Fatalf("%s %s: 期望返回执行过程，得到 %d %v", req.method, req.path, status, response.Data)
+		}
+		// 没有全局聚合器时回退到文件扫描
+		if explain["strategy"] != "scan" || explain["lines_scanned"] != float64(2) || explain["matched"] != float64(1) {
+			t.Errorf("%s %s: 执行过程错误: %v", req.method, req.path, explain)
+		}
+	}
+
+	if _, response := doAPI(t, handler, "POST", "/api/v1/logs/search", `{"level":"error"}`); explainOf(response.Data) != nil {
+		t.Error("期望未请求时不返回执行过程")
+	}
+}
+
+func TestTraceTimeline(t *testing.T) {
+	aggregate.SetGlobalAggregator(nil)
+	tempDir := t.TempDir()
+	write := func(name string, mtime time.Time, lines ...string) {
+		path := filepath.Join(tempDir, name)
+		if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+			t.Fatalf("创建测试日志文件失败: %v", err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatalf("修改文件时间失败: %v", err)
+		}
+	}
+	// 较新的文件中有较早的条目
+	write("b.log", time.Now(), `{"timestamp":"2024-01-15T10:30:00Z","level":"info","msg":"start","trace_id":"t1"}`,
+		`{"timestamp":"2024-01-15T10:30:03Z","level":"info","msg":"end","trace_id":"t1"}`)
+	write("a.log", time.Now().Add(-time.Hour), `{"timestamp":"2024-01-15T10:30:02Z","level":"info","msg":"db","trace_id":"t1"}`,
+		`{"timestamp":"2024-01-15T10:30:01Z","level":"info","msg":"auth","trace_id":"t1"}`)
+	handler := NewWebServer(tempDir, "8080").routes()
+
+	timeline := func(path string) []string {
+		status, response := doAPI(t, handler, "GET", path, "")
+		if status != http.StatusOK {
+			t.Fatalf("%s: 期望状态码 200，得到 %d %v", path, status, response.Data)
+		}
+		data, _ := response.Data.(map[string]interface{})
+		entries, _ := data["entries"].([]interface{})
+		var msgs []string
+		for _, entry := range entries {
+			msgs = append(msgs, entry.(map[string]interface{})["msg"].(string))
+		}
+		return msgs
+	}
+
+	if got := strings.Join(timeline("/api/v1/logs/trace/t1"), ","); got != "start,auth,db,end" {
+		t.Errorf("期望按时间升序，得到 %s", got)
+	}
+	if got := strings.Join(timeline("/api/v1/logs/trace/t1?start_time=2024-01-15T10:30:01Z&end_time=2024-01-15T10:30:02Z"), ","); got != "auth,db" {
+		t.Errorf("期望只返回时间范围内的条目，得到 %s", got)
+	}
+	if got := strings.Join(timeline("/api/v1/logs/trace/t1?sort_order=desc&limit=2"), ","); got != "end,db" {
+		t.Errorf("期望按时间降序，得到 %s", got)
+	}
+
+	for _, path := range []string{"/api/v1/logs/trace/t1?start_time=yesterday", "/api/v1/logs/trace/t1?sort_order=newest"} {
+		if status, _ := doAPI(t, handler, "GET", path, ""); status != http.StatusBadRequest {
+			t.Errorf("%s: 期望状态码 400，得到 %d", path, status)
+		}
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	t.Setenv(rateLimitEnv, "1")
+	t.Setenv(trustedProxiesEnv, "10.0.0.0/8")
+	ws := NewWebServer(t.TempDir(), "8080")
+	handler := ws.logHandler(ws.rateLimitHandler(func(w http.ResponseWriter, r *http.Request) {}))
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	send := func(remoteAddr, forwarded string) int {
+		req := httptest.NewRequest("GET", "/api/files", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", forwarded)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code
+	}
+
+	// 经过入口代理的不同客户端分别限流
+	if code := send("10.0.0.1:1000", "198.51.100.1"); code != http.StatusOK {
+		t.Errorf("期望第一个客户端的请求通过，得到 %d", code)
+	}
+	if code := send("10.0.0.1:1000", "198.51.100.2"); code != http.StatusOK {
+		t.Errorf("期望第二个客户端不受第一个客户端影响，得到 %d", code)
+	}
+	if code := send("10.0.0.1:1000", "198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Errorf("期望同一客户端的第二个请求被限流，得到 %d", code)
+	}
+
+	// 不受信任的对端伪造的X-Forwarded-For被忽略
+	if code := send("203.0.113.5:1000", "198.51.100.3"); code != http.StatusOK {
+		t.Errorf("期望请求通过，得到 %d", code)
+	}
+	if code := send("203.0.113.5:1000", "198.51.100.4"); code != http.StatusTooManyRequests {
+		t.Errorf("期望伪造X-Forwarded-For不能绕过限流，得到 %d", code)
+	}
+
+	if !strings.Contains(logs.String(), " 198.51.100.2") || strings.Contains(logs.String(), "198.51.100.4") {
+		t.Errorf("期望访问日志记录客户端IP，得到:\n%s", logs.String())
+	}
+}
+
+// failingStore 所有操作都返回错误的LogStore
+type failingStore struct {
+	err error
+}
+
+func (s failingStore) Query(ctx context.Context, query aggregate.LogQuery) (*aggregate.LogQueryResult, error) {
+	return nil, s.err
+}
+
+func (s failingStore) Stats(ctx context.Context) (*aggregate.LogStats, error) {
+	return nil, s.err
+}
+
+func (s failingStore) Tail(ctx context.Context, query aggregate.LogQuery) (<-chan aggregate.LogEntry, error) {
+	return nil, s.err
+}
+
+// multipartUpload 构造上传文件的请求
+func multipartUpload(t *testing.T, filename, content string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatalf("创建上传表单失败: %v", err)
+	}
+	part.Write([]byte(content))
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/api/files/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestLegacyEndpointStatusCodes(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "app.log"), []byte(`{"level":"info","msg":"hello"}`+"\n"), 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+	ws := NewWebServer(dir, "8080")
+	handler := ws.routes()
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		call func(w http.ResponseWriter, r *http.Request)
+		want int
+	}{
+		{"读取文件", httptest.NewRequest("GET", "/api/files/content/app.log", nil), nil, http.StatusOK},
+		{"读取不存在的文件", httptest.NewRequest("GET", "/api/files/content/missing.log", nil), nil, http.StatusNotFound},
+		{"读取无效文件名", httptest.NewRequest("GET", "/", nil), func(w http.ResponseWriter, r *http.Request) {
+			ws.getLogContent(w, r, "../secret.log")
+		}, http.StatusBadRequest},
+		{"删除不存在的文件", httptest.NewRequest("DELETE", "/api/files/delete/missing.log", nil), nil, http.StatusNotFound},
+		{"删除无效文件名", httptest.NewRequest("DELETE", "/", nil), func(w http.ResponseWriter, r *http.Request) {
+			ws.deleteLogFile(w, r, "/etc/passwd")
+		}, http.StatusBadRequest},
+		{"搜索无效JSON", httptest.NewRequest("POST", "/api/search", strings.NewReader("{")), nil, http.StatusBadRequest},
+		{"搜索无效级别", httptest.NewRequest("POST", "/api/search", strings.NewReader(`{"level":"verbose"}`)), nil, http.StatusBadRequest},
+		{"上传非表单", httptest.NewRequest("POST", "/api/files/upload", strings.NewReader("x")), nil, http.StatusBadRequest},
+		{"上传错误扩展名", multipartUpload(t, "notes.txt", "x"), nil, http.StatusBadRequest},
+		{"上传日志", multipartUpload(t, "uploaded.log", "line\n"), nil, http.StatusOK},
+		{"删除文件", httptest.NewRequest("DELETE", "/api/files/delete/uploaded.log", nil), nil, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			if tt.call != nil {
+				tt.call(w, tt.req)
+			} else {
+				handler.ServeHTTP(w, tt.req)
+			}
+			if w.Code != tt.want {
+				t.Errorf("期望状态码 %d，得到 %d: %s", tt.want, w.Code, w.Body.String())
+			}
+
+			// 响应体格式不变，失败时success为false并包含错误信息
+			var response LogViewResponse
+			if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+				t.Fatalf("解析响应失败: %v", err)
+			}
+			if response.Success != (tt.want == http.StatusOK) || (!response.Success && response.Error == "") {
+				t.Errorf("响应体不符合预期: %+v", response)
+			}
+		})
+	}
+
+	// 查询内部错误返回500
+	ws.store = failingStore{errors.New("索引损坏")}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/errors", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("期望状态码 500，得到 %d", w.Code)
+	}
+}
+
+func TestEmbeddedAssets(t *testing.T) {
+	t.Chdir(t.TempDir())
+	logDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(logDir, "app.log"), nil, 0644); err != nil {
+		t.Fatalf("创建测试日志文件失败: %v", err)
+	}
+	ws := NewWebServer(logDir, "8080")
+	if err := ws.loadAssets(); err != nil {
+		t.Fatalf("加载页面资源失败: %v", err)
+	}
+	if ws.assets.source != "内嵌" {
+		t.Fatalf("期望使用内嵌资源，得到 %s", ws.assets.source)
+	}
+	handler := ws.routes()
+
+	for _, path := range []string{"/", "/view/app.log", "/errors"} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: 期望状态码 200，得到 %d: %s", path, w.Code, w.Body.String())
+		}
+		if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/html") {
+			t.Errorf("%s: 期望text/html，得到 %s", path, contentType)
+		}
+		if path == "/view/app.log" && !strings.Contains(w.Body.String(), "app.log") {
+			t.Error("期望查看页面包含文件名")
+		}
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/static/style.css", nil))
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("期望静态文件带ETag，得到状态码 %d，ETag %q", w.Code, etag)
+	}
+	if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/css") {
+		t.Errorf("期望text/css，得到 %s", contentType)
+	}
+	if cacheControl := w.Header().Get("Cache-Control"); !strings.Contains(cacheControl, "max-age=") {
+		t.Errorf("期望静态文件可缓存，得到 %s", cacheControl)
+	}
+
+	req := httptest.NewRequest("GET", "/static/style.css", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("期望状态码 304，得到 %d", w.Code)
+	}
+}
+
+func TestTemplateReload(t *testing.T) {
+	dir := t.TempDir()
+	templates := filepath.Join(dir, "templates")
+	os.Mkdir(templates, 0755)
+	for _, name := range []string{"index.html", "view.html", "errors.html"} {
+		os.WriteFile(filepath.Join(templates, name), []byte("v1"), 0644)
+	}
+	t.Chdir(dir)
+
+	ws := NewWebServer(t.TempDir(), "8080", WithTemplateReload(true))
+	if err := ws.loadAssets(); err != nil {
+		t.Fatalf("加载页面资源失败: %v", err)
+	}
+	if !strings.HasPrefix(ws.assets.source, "磁盘") {
+		t.Fatalf("期望使用磁盘资源，得到 %s", ws.assets.source)
+	}
+	handler := ws.routes()
+
+	os.WriteFile(filepath.Join(templates, "index.html"), []byte("v2"), 0644)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Body.String() != "v2" {
+		t.Errorf("期望重新解析模板，得到 %q", w.Body.String())
+	}
+}
@@ -0,0 +1,97 @@
+package trace
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ForceSampleHeader 请求强制采样的请求头，值为"1"或配置的令牌
+const ForceSampleHeader = "X-Trace-Force-Sample"
+
+// SamplingForcedKey 被强制采样的span上的属性
+const SamplingForcedKey = "sampling.forced"
+
+// forceSampleKey ForceSample在context中的key
+type forceSampleKey struct{}
+
+// forceSampleHeaderKey 中间件记录的强制采样请求头在context中的key
+type forceSampleHeaderKey struct{}
+
+// ForceSample 返回要求强制采样的context，在此context中创建的根span总是被采样
+// 用于在代码中调试单个请求，不受AllowForceSample限制
+func ForceSample(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, forceSampleKey{}, true)
+}
+
+// withForceSampleHeader 记录请求中的强制采样请求头，是否生效由采样器根据配置决定
+func withForceSampleHeader(ctx context.Context, header http.Header) context.Context {
+	if value := strings.TrimSpace(header.Get(ForceSampleHeader)); value != "" {
+		return context.WithValue(ctx, forceSampleHeaderKey{}, value)
+	}
+	return ctx
+}
+
+// forceSampler 在基础采样器之前检查强制采样请求
+type forceSampler struct {
+	base        sdktrace.Sampler
+	allowRemote bool   // 是否接受请求头和上游的采样标志
+	token       string // 不为空时请求头的值必须与之相同
+}
+
+// NewForceSampleSampler 包装基础采样器，支持强制采样
+// ForceSample标记的context总是被采样；allowRemote为true时，还接受X-Trace-Force-Sample请求头
+// 和上游traceparent中的采样标志。token不为空时请求头的值必须等于token，否则为"1"或"true"
+func NewForceSampleSampler(base sdktrace.Sampler, allowRemote bool, token string) sdktrace.Sampler {
+	return &forceSampler{base: base, allowRemote: allowRemote, token: token}
+}
+
+// ShouldSample 实现sdktrace.Sampler
+func (s *forceSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	psc := trace.SpanContextFromContext(p.ParentContext)
+	if s.forced(p.ParentContext, psc) {
+		return sdktrace.SamplingResult{
+			Decision:   sdktrace.RecordAndSample,
+			Attributes: []attribute.KeyValue{attribute.Bool(SamplingForcedKey, true)},
+			Tracestate: psc.TraceState(),
+		}
+	}
+	return s.base.ShouldSample(p)
+}
+
+// forced 检查是否要求强制采样，本地父span已有采样决定时由基础采样器处理
+func (s *forceSampler) forced(ctx context.Context, psc trace.SpanContext) bool {
+	if psc.IsValid() && !psc.IsRemote() {
+		return false
+	}
+	if forced, _ := ctx.Value(forceSampleKey{}).(bool); forced {
+		return true
+	}
+	if !s.allowRemote {
+		return false
+	}
+	if psc.IsRemote() && psc.IsSampled() {
+		return true
+	}
+	value, _ := ctx.Value(forceSampleHeaderKey{}).(string)
+	if value == "" {
+		return false
+	}
+	if s.token != "" {
+		return subtle.ConstantTimeCompare([]byte(value), []byte(s.token)) == 1
+	}
+	return value == "1" || strings.EqualFold(value, "true")
+}
+
+// Description 实现sdktrace.Sampler
+func (s *forceSampler) Description() string {
+	return "ForceSample{" + s.base.Description() + "}"
+}
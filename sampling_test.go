@@ -0,0 +1,130 @@
+package trace
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/HsiaoL1/trace/tracetest"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// startSamplingProvider 安装与InitJaeger相同、但基础采样率为0%的TracerProvider
+func startSamplingProvider(t *testing.T, allowRemote bool, token string) *tracetest.Recorder {
+	t.Helper()
+	return tracetest.Start(t, sdktrace.WithSampler(
+		newSampler(sdktrace.TraceIDRatioBased(0), &JaegerConfig{AllowForceSample: allowRemote, ForceSampleToken: token}),
+	))
+}
+
+// serveSampled 通过中间件处理请求，处理函数中创建一个子span，返回导出的span
+func serveSampled(t *testing.T, recorder *tracetest.Recorder, headers map[string]string) []sdktrace.ReadOnlySpan {
+	t.Helper()
+	recorder.Reset()
+	handler := OpenTelemetryMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, span := StartInternalSpan(r.Context(), "load user")
+		span.End()
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/users", nil)
+	for key, value := range headers {
+		r.Header.Set(key, value)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	return recorder.Spans()
+}
+
+func TestForceSampleHeader(t *testing.T) {
+	recorder := startSamplingProvider(t, true, "")
+
+	if spans := serveSampled(t, recorder, nil); len(spans) != 0 {
+		t.Errorf("Expected unforced request to be dropped at 0%% ratio, got %d spans", len(spans))
+	}
+
+	spans := serveSampled(t, recorder, map[string]string{ForceSampleHeader: "1"})
+	if len(spans) != 2 {
+		t.Fatalf("Expected forced request and its child to be sampled, got %d spans", len(spans))
+	}
+	for _, span := range spans {
+		forced := false
+		for _, attr := range span.Attributes() {
+			if attr.Key == SamplingForcedKey && attr.Value.AsBool() {
+				forced = true
+			}
+		}
+		if forced != (span.Name() == "GET /users") {
+			t.Errorf("Expected only the root span to carry %s, span %q has it=%v", SamplingForcedKey, span.Name(), forced)
+		}
+	}
+
+	if spans := serveSampled(t, recorder, map[string]string{ForceSampleHeader: "0"}); len(spans) != 0 {
+		t.Errorf("Expected header value 0 not to force sampling, got %d spans", len(spans))
+	}
+
+	// 上游已采样的trace
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	if spans := serveSampled(t, recorder, map[string]string{"traceparent": traceparent}); len(spans) != 2 {
+		t.Errorf("Expected W3C sampled flag to force sampling, got %d spans", len(spans))
+	}
+	notSampled := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"
+	if spans := serveSampled(t, recorder, map[string]string{"traceparent": notSampled}); len(spans) != 0 {
+		t.Errorf("Expected unsampled parent to fall back to the ratio sampler, got %d spans", len(spans))
+	}
+}
+
+func TestForceSampleGating(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		recorder := startSamplingProvider(t, false, "")
+		headers := map[string]string{
+			ForceSampleHeader: "1",
+			"traceparent":     "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		}
+		if spans := serveSampled(t, recorder, headers); len(spans) != 0 {
+			t.Errorf("Expected header to be ignored when force sampling is not allowed, got %d spans", len(spans))
+		}
+
+		// 代码中的强制采样不受配置限制
+		recorder.Reset()
+		_, span := StartServerSpan(ForceSample(context.Background()), "debug job")
+		span.End()
+		if spans := recorder.Spans(); len(spans) != 1 {
+			t.Errorf("Expected ForceSample context to be sampled, got %d spans", len(spans))
+		}
+	})
+
+	t.Run("token", func(t *testing.T) {
+		recorder := startSamplingProvider(t, true, "s3cret")
+		if spans := serveSampled(t, recorder, map[string]string{ForceSampleHeader: "1"}); len(spans) != 0 {
+			t.Errorf("Expected header without token to be ignored, got %d spans", len(spans))
+		}
+		if spans := serveSampled(t, recorder, map[string]string{ForceSampleHeader: "wrong"}); len(spans) != 0 {
+			t.Errorf("Expected wrong token to be ignored, got %d spans", len(spans))
+		}
+		if spans := serveSampled(t, recorder, map[string]string{ForceSampleHeader: "s3cret"}); len(spans) != 2 {
+			t.Errorf("Expected matching token to force sampling, got %d spans", len(spans))
+		}
+	})
+}
+
+func TestCreateSamplerForceSample(t *testing.T) {
+	config := DefaultJaegerConfig()
+	config.Environment = "production"
+	config.AllowForceSample = true
+	if description := createSampler(config).Description(); !strings.HasPrefix(description, "ForceSample{") {
+		t.Errorf("Expected InitJaeger sampler to support force sampling, got %s", description)
+	}
+
+	t.Setenv("TRACE_ALLOW_FORCE_SAMPLE", "true")
+	t.Setenv("TRACE_FORCE_SAMPLE_TOKEN", "s3cret")
+	config = LoadJaegerConfigFromEnv()
+	if !config.AllowForceSample || config.ForceSampleToken != "s3cret" {
+		t.Errorf("Expected force sample settings from env, got %+v", config)
+	}
+
+	full := DefaultConfig()
+	full.Jaeger = *config
+	if s := full.String(); strings.Contains(s, "s3cret") {
+		t.Errorf("Expected token to be redacted, got %s", s)
+	}
+}
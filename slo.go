@@ -0,0 +1,180 @@
+package trace
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SLO相关的span属性和事件
+const (
+	SLOThresholdKey = "slo.threshold_ms" // span的耗时阈值（毫秒）
+	SLOBreachedKey  = "slo.breached"     // 耗时是否超过阈值
+	SLOOverageKey   = "slo.overage_ms"   // slo.breached事件上超出阈值的耗时（毫秒）
+	SLODurationKey  = "slo.duration_ms"  // slo.breached事件上span的耗时（毫秒）
+
+	SLOBreachedEvent = "slo.breached"
+)
+
+// SLOThresholds 按span名称前缀配置的默认耗时阈值，多个前缀匹配时使用最长的前缀
+type SLOThresholds map[string]time.Duration
+
+// sloKey WithSLO在context中的key
+type sloKey struct{}
+
+// sloValue WithSLO设置的阈值，parent为设置时context中的span，只作用于它的直接子span
+type sloValue struct {
+	threshold time.Duration
+	parent    trace.SpanID
+}
+
+// WithSLO 为接下来用返回的context创建的span设置耗时阈值，优先于SLOThresholds中的默认值
+// 只作用于直接用该context创建的span，不影响这些span的子span；threshold为0时该span不检查耗时
+// 需要通过WithSLOProcessor安装SLOProcessor才会生效
+func WithSLO(ctx context.Context, threshold time.Duration) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, sloKey{}, sloValue{
+		threshold: threshold,
+		parent:    trace.SpanContextFromContext(ctx).SpanID(),
+	})
+}
+
+// sloPrefix 一个span名称前缀的阈值
+type sloPrefix struct {
+	prefix    string
+	threshold time.Duration
+}
+
+// sloSpanKey 等待结束的有阈值的span
+type sloSpanKey struct {
+	traceID trace.TraceID
+	spanID  trace.SpanID
+}
+
+// SLOProcessor 在span结束时比较耗时与阈值的SpanProcessor，包装导出span的处理器
+// 有阈值的span在开始时设置slo.threshold_ms，结束时传给next的span带有slo.breached，
+// 超过阈值时还带有slo.breached事件；没有阈值的span原样传给next
+type SLOProcessor struct {
+	next     sdktrace.SpanProcessor
+	prefixes []sloPrefix // 按前缀长度从长到短排列
+
+	pending      sync.Map     // sloSpanKey -> time.Duration
+	pendingCount atomic.Int64 // 为0时OnEnd不查找pending
+}
+
+var _ sdktrace.SpanProcessor = (*SLOProcessor)(nil)
+
+// NewSLOProcessor 创建SLO处理器，结束的span传给next（如BatchSpanProcessor）
+// thresholds为按span名称前缀的默认阈值，可以为nil，此时只检查WithSLO设置了阈值的span
+func NewSLOProcessor(next sdktrace.SpanProcessor, thresholds SLOThresholds) *SLOProcessor {
+	p := &SLOProcessor{next: next}
+	for prefix, threshold := range thresholds {
+		if threshold > 0 {
+			p.prefixes = append(p.prefixes, sloPrefix{prefix: prefix, threshold: threshold})
+		}
+	}
+	sort.Slice(p.prefixes, func(i, j int) bool {
+		if len(p.prefixes[i].prefix) != len(p.prefixes[j].prefix) {
+			return len(p.prefixes[i].prefix) > len(p.prefixes[j].prefix)
+		}
+		return p.prefixes[i].prefix < p.prefixes[j].prefix
+	})
+	return p
+}
+
+// threshold 返回span的阈值，WithSLO设置的阈值优先，其次为最长匹配前缀的默认值，没有阈值时返回0
+func (p *SLOProcessor) threshold(ctx context.Context, s sdktrace.ReadWriteSpan) time.Duration {
+	if value, ok := ctx.Value(sloKey{}).(sloValue); ok && value.parent == s.Parent().SpanID() {
+		return value.threshold
+	}
+	name := s.Name()
+	for _, prefix := range p.prefixes {
+		if strings.HasPrefix(name, prefix.prefix) {
+			return prefix.threshold
+		}
+	}
+	return 0
+}
+
+// OnStart 实现SpanProcessor接口，记录有阈值的span
+func (p *SLOProcessor) OnStart(ctx context.Context, s sdktrace.ReadWriteSpan) {
+	if threshold := p.threshold(ctx, s); threshold > 0 {
+		s.SetAttributes(attribute.Float64(SLOThresholdKey, milliseconds(threshold)))
+		sc := s.SpanContext()
+		p.pending.Store(sloSpanKey{traceID: sc.TraceID(), spanID: sc.SpanID()}, threshold)
+		p.pendingCount.Add(1)
+	}
+	p.next.OnStart(ctx, s)
+}
+
+// OnEnd 实现SpanProcessor接口，为有阈值的span添加slo.breached属性和事件后传给next
+func (p *SLOProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if p.pendingCount.Load() == 0 {
+		p.next.OnEnd(s)
+		return
+	}
+	sc := s.SpanContext()
+	value, ok := p.pending.LoadAndDelete(sloSpanKey{traceID: sc.TraceID(), spanID: sc.SpanID()})
+	if !ok {
+		p.next.OnEnd(s)
+		return
+	}
+	p.pendingCount.Add(-1)
+
+	threshold := value.(time.Duration)
+	duration := s.EndTime().Sub(s.StartTime())
+	breached := duration > threshold
+	span := sloSpan{ReadOnlySpan: s, events: s.Events()}
+	span.attributes = append(make([]attribute.KeyValue, 0, len(s.Attributes())+1), s.Attributes()...)
+	span.attributes = append(span.attributes, attribute.Bool(SLOBreachedKey, breached))
+	if breached {
+		span.events = append(make([]sdktrace.Event, 0, len(span.events)+1), span.events...)
+		span.events = append(span.events, sdktrace.Event{
+			Name: SLOBreachedEvent,
+			Time: s.EndTime(),
+			Attributes: []attribute.KeyValue{
+				attribute.Float64(SLOOverageKey, milliseconds(duration-threshold)),
+				attribute.Float64(SLODurationKey, milliseconds(duration)),
+				attribute.Float64(SLOThresholdKey, milliseconds(threshold)),
+			},
+		})
+	}
+	p.next.OnEnd(span)
+}
+
+// Shutdown 实现SpanProcessor接口
+func (p *SLOProcessor) Shutdown(ctx context.Context) error {
+	return p.next.Shutdown(ctx)
+}
+
+// ForceFlush 实现SpanProcessor接口
+func (p *SLOProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+// sloSpan 结束后添加了SLO属性和事件的span
+type sloSpan struct {
+	sdktrace.ReadOnlySpan
+	attributes []attribute.KeyValue
+	events     []sdktrace.Event
+}
+
+// Attributes 返回包含slo.breached的属性
+func (s sloSpan) Attributes() []attribute.KeyValue { return s.attributes }
+
+// Events 返回包含slo.breached事件的事件
+func (s sloSpan) Events() []sdktrace.Event { return s.events }
+
+// milliseconds 将耗时转换为毫秒数
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
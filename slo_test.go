@@ -0,0 +1,95 @@
+package trace
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	sdktracetest "go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// sloAttr 返回span上的属性值，不存在时返回nil
+func sloAttr(span sdktracetest.SpanStub, key string) any {
+	for _, attr := range span.Attributes {
+		if string(attr.Key) == key {
+			return attr.Value.AsInterface()
+		}
+	}
+	return nil
+}
+
+func TestSLOProcessor(t *testing.T) {
+	exporter := sdktracetest.NewInMemoryExporter()
+	processor := NewSLOProcessor(sdktrace.NewSimpleSpanProcessor(exporter), SLOThresholds{
+		"db.":       100 * time.Millisecond,
+		"db.batch.": time.Second,
+	})
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(processor))
+	defer provider.Shutdown(context.Background())
+	tracer := provider.Tracer("test")
+
+	start := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	run := func(ctx context.Context, name string, duration time.Duration) context.Context {
+		ctx, span := tracer.Start(ctx, name, trace.WithTimestamp(start), trace.WithAttributes(attribute.String("k", "v")))
+		span.AddEvent("work", trace.WithTimestamp(start))
+		span.End(trace.WithTimestamp(start.Add(duration)))
+		return ctx
+	}
+
+	// WithSLO只作用于直接创建的span，子span按名称前缀使用默认阈值
+	ctx := run(WithSLO(context.Background(), 200*time.Millisecond), "checkout", 350*time.Millisecond)
+	run(ctx, "db.query", 50*time.Millisecond)
+	run(ctx, "db.batch.insert", 500*time.Millisecond)
+	run(ctx, "cache.get", time.Hour)
+	run(WithSLO(ctx, 0), "db.slow", time.Hour)
+
+	spans := map[string]sdktracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+
+	slow := spans["checkout"]
+	if sloAttr(slow, SLOThresholdKey) != float64(200) || sloAttr(slow, SLOBreachedKey) != true || sloAttr(slow, "k") != "v" {
+		t.Errorf("期望慢span标记为超出阈值，得到 %v", slow.Attributes)
+	}
+	if len(slow.Events) != 2 || slow.Events[1].Name != SLOBreachedEvent {
+		t.Fatalf("期望慢span带有slo.breached事件，得到 %+v", slow.Events)
+	}
+	for _, attr := range slow.Events[1].Attributes {
+		if attr.Key == SLOOverageKey && attr.Value.AsFloat64() != 150 {
+			t.Errorf("期望超出 150ms，得到 %v", attr.Value.AsFloat64())
+		}
+	}
+
+	fast := spans["db.query"]
+	if sloAttr(fast, SLOThresholdKey) != float64(100) || sloAttr(fast, SLOBreachedKey) != false || len(fast.Events) != 1 {
+		t.Errorf("期望快span没有超出阈值，得到 %v %+v", fast.Attributes, fast.Events)
+	}
+	if batch := spans["db.batch.insert"]; sloAttr(batch, SLOThresholdKey) != float64(1000) || sloAttr(batch, SLOBreachedKey) != false {
+		t.Errorf("期望使用最长的前缀，得到 %v", batch.Attributes)
+	}
+	for _, name := range []string{"cache.get", "db.slow"} {
+		if span := spans[name]; sloAttr(span, SLOThresholdKey) != nil || sloAttr(span, SLOBreachedKey) != nil || len(span.Events) != 1 {
+			t.Errorf("期望 %s 没有SLO属性，得到 %v", name, span.Attributes)
+		}
+	}
+	if n := processor.pendingCount.Load(); n != 0 {
+		t.Errorf("期望没有未结束的span，得到 %d", n)
+	}
+}
+
+func BenchmarkSLOProcessorNoThreshold(b *testing.B) {
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(NewSLOProcessor(sdktrace.NewSimpleSpanProcessor(sdktracetest.NewNoopExporter()), nil)))
+	defer provider.Shutdown(context.Background())
+	tracer := provider.Tracer("bench")
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, span := tracer.Start(ctx, "op")
+		span.End()
+	}
+}
@@ -0,0 +1,175 @@
+package trace
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultSnapshotTTL Snapshot设置的有效期，过期的快照恢复时不再作为父span
+const DefaultSnapshotTTL = 24 * time.Hour
+
+// SnapshotLinkReasonKey 快照无法作为父span时，新根span指向快照span的link上记录原因的属性
+const SnapshotLinkReasonKey = "snapshot.restore_reason"
+
+// 快照无法作为父span的原因
+const (
+	SnapshotReasonExpired = "expired" // 快照已过期
+	SnapshotReasonInvalid = "invalid" // 快照为空、traceparent不合法或与旧版ID不一致
+)
+
+// TraceSnapshot 可序列化的追踪上下文快照，用于消息队列、定时任务参数、持久化的任务等异步场景
+// 由Snapshot生成，在处理任务时通过Restore恢复
+type TraceSnapshot struct {
+	Traceparent  string            `json:"traceparent,omitempty"`    // W3C traceparent
+	Tracestate   string            `json:"tracestate,omitempty"`     // W3C tracestate
+	TraceID      string            `json:"trace_id,omitempty"`       // 旧版TraceContext的TraceID
+	SpanID       string            `json:"span_id,omitempty"`        // 旧版TraceContext的SpanID
+	ParentSpanID string            `json:"parent_span_id,omitempty"` // 旧版TraceContext的ParentSpanID
+	Baggage      map[string]string `json:"baggage,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+	ExpiresAt    time.Time         `json:"expires_at"` // 为零值时不过期
+}
+
+// IsEmpty 快照中是否没有追踪上下文
+func (s TraceSnapshot) IsEmpty() bool {
+	return s.Traceparent == "" && s.TraceID == "" && s.SpanID == ""
+}
+
+// Expired 快照在now时是否已过期
+func (s TraceSnapshot) Expired(now time.Time) bool {
+	return !s.ExpiresAt.IsZero() && now.After(s.ExpiresAt)
+}
+
+// Snapshot 获取ctx中追踪上下文的快照，有效期为DefaultSnapshotTTL，可以修改ExpiresAt调整
+// baggageKeys为要保存的baggage键，不传时保存全部baggage
+func Snapshot(ctx context.Context, baggageKeys ...string) TraceSnapshot {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	now := time.Now()
+	s := TraceSnapshot{CreatedAt: now, ExpiresAt: now.Add(DefaultSnapshotTTL)}
+
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	s.Traceparent = carrier.Get("traceparent")
+	s.Tracestate = carrier.Get("tracestate")
+
+	traceCtx := CurrentTraceContext(ctx)
+	s.TraceID, s.SpanID, s.ParentSpanID = traceCtx.TraceID, traceCtx.SpanID, traceCtx.ParentSpanID
+
+	bag := baggage.FromContext(ctx)
+	if len(baggageKeys) == 0 {
+		for _, member := range bag.Members() {
+			if s.Baggage == nil {
+				s.Baggage = make(map[string]string)
+			}
+			s.Baggage[member.Key()] = member.Value()
+		}
+	}
+	for _, key := range baggageKeys {
+		if member := bag.Member(key); member.Key() != "" {
+			if s.Baggage == nil {
+				s.Baggage = make(map[string]string)
+			}
+			s.Baggage[key] = member.Value()
+		}
+	}
+	return s
+}
+
+// spanContext 返回快照中的远程span上下文，没有traceparent时使用旧版ID
+func (s TraceSnapshot) spanContext() trace.SpanContext {
+	if s.Traceparent != "" {
+		carrier := propagation.MapCarrier{"traceparent": s.Traceparent}
+		if s.Tracestate != "" {
+			carrier.Set("tracestate", s.Tracestate)
+		}
+		return trace.SpanContextFromContext(propagation.TraceContext{}.Extract(context.Background(), carrier))
+	}
+	traceID, err := trace.TraceIDFromHex(s.TraceID)
+	if err != nil {
+		return trace.SpanContext{}
+	}
+	spanID, err := trace.SpanIDFromHex(s.SpanID)
+	if err != nil {
+		return trace.SpanContext{}
+	}
+	return trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, Remote: true})
+}
+
+// snapshotLinkKey Restore在context中保存的link的key
+type snapshotLinkKey struct{}
+
+// Restore 将快照恢复到ctx中，之后用返回的context创建的span以快照中的span为父span，
+// GetTraceContextFromContext返回快照中的旧版追踪上下文，快照中的baggage合并到ctx的baggage中
+// 快照为空、已过期或traceparent与旧版ID不一致时，之后创建的span为新的根span；
+// 能解析出快照中的span时，通过本包StartSpan等函数直接用返回的context创建的span带有指向它的link
+func Restore(ctx context.Context, s TraceSnapshot) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx = restoreBaggage(ctx, s.Baggage)
+
+	sc := s.spanContext()
+	reason := ""
+	switch {
+	case s.IsEmpty():
+		reason = SnapshotReasonInvalid
+	case s.Expired(time.Now()):
+		reason = SnapshotReasonExpired
+	case s.Traceparent != "" && (!sc.IsValid() || (s.TraceID != "" && s.TraceID != sc.TraceID().String())):
+		reason = SnapshotReasonInvalid
+	}
+
+	if reason == "" && sc.IsValid() {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, sc)
+		return WithTraceContext(ctx, TraceContext{TraceID: s.TraceID, SpanID: s.SpanID, ParentSpanID: s.ParentSpanID})
+	}
+	if reason == "" {
+		// 只有非十六进制的旧版ID，OpenTelemetry span无法关联
+		ctx = trace.ContextWithSpanContext(ctx, trace.SpanContext{})
+		return WithTraceContext(ctx, TraceContext{TraceID: s.TraceID, SpanID: s.SpanID, ParentSpanID: s.ParentSpanID})
+	}
+
+	ctx = trace.ContextWithSpanContext(ctx, trace.SpanContext{})
+	ctx = WithTraceContext(ctx, TraceContext{})
+	if sc.IsValid() {
+		ctx = context.WithValue(ctx, snapshotLinkKey{}, trace.Link{
+			SpanContext: sc,
+			Attributes:  []attribute.KeyValue{attribute.String(SnapshotLinkReasonKey, reason)},
+		})
+	}
+	return ctx
+}
+
+// restoreBaggage 将快照中的baggage合并到ctx的baggage中，不合法的成员被忽略
+func restoreBaggage(ctx context.Context, values map[string]string) context.Context {
+	if len(values) == 0 {
+		return ctx
+	}
+	bag := baggage.FromContext(ctx)
+	for key, value := range values {
+		member, err := baggage.NewMemberRaw(key, value)
+		if err != nil {
+			continue
+		}
+		if next, err := bag.SetMember(member); err == nil {
+			bag = next
+		}
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+// snapshotLinkOption 返回Restore保存的link，只作用于直接用Restore返回的context创建的根span
+func snapshotLinkOption(ctx context.Context) (trace.SpanStartOption, bool) {
+	link, ok := ctx.Value(snapshotLinkKey{}).(trace.Link)
+	if !ok || trace.SpanContextFromContext(ctx).IsValid() {
+		return nil, false
+	}
+	return trace.WithLinks(link), true
+}
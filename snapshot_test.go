@@ -0,0 +1,97 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/HsiaoL1/trace/tracetest"
+)
+
+// roundTrip 通过JSON序列化传递快照，模拟写入消息队列或数据库后再读取
+func roundTrip(t *testing.T, s TraceSnapshot) TraceSnapshot {
+	t.Helper()
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("序列化快照失败: %v", err)
+	}
+	var decoded TraceSnapshot
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("解析快照失败: %v", err)
+	}
+	return decoded
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	recorder := tracetest.Start(t)
+
+	ctx, _ := SetBaggage(context.Background(), "tenant_id", "acme")
+	ctx, _ = SetBaggage(ctx, "session", "secret")
+	ctx, producer := StartProducerSpan(ctx, "enqueue")
+	snapshot := roundTrip(t, Snapshot(ctx, "tenant_id"))
+	producer.End()
+
+	if snapshot.Traceparent == "" || snapshot.TraceID != producer.SpanContext().TraceID().String() ||
+		snapshot.SpanID != producer.SpanContext().SpanID().String() {
+		t.Fatalf("期望快照包含producer span，得到 %+v", snapshot)
+	}
+	if len(snapshot.Baggage) != 1 || snapshot.Baggage["tenant_id"] != "acme" {
+		t.Errorf("期望只保存选定的baggage，得到 %v", snapshot.Baggage)
+	}
+
+	restored := Restore(context.Background(), snapshot)
+	if traceCtx := GetTraceContextFromContext(restored); traceCtx.TraceID != snapshot.TraceID || traceCtx.SpanID != snapshot.SpanID {
+		t.Errorf("期望恢复旧版追踪上下文，得到 %+v", traceCtx)
+	}
+	if got := GetBaggage(restored, "tenant_id"); got != "acme" {
+		t.Errorf("期望恢复baggage，得到 %q", got)
+	}
+	_, consumer := StartConsumerSpan(restored, "process")
+	consumer.End()
+
+	span := recorder.RequireSpan(t, "process")
+	if span.Parent().SpanID() != producer.SpanContext().SpanID() || !span.Parent().IsRemote() ||
+		span.SpanContext().TraceID() != producer.SpanContext().TraceID() || len(span.Links()) != 0 {
+		t.Errorf("期望consumer span以快照中的span为远程父span，得到 %+v", span.Parent())
+	}
+}
+
+func TestRestoreInvalidSnapshot(t *testing.T) {
+	recorder := tracetest.Start(t)
+
+	ctx, producer := StartSpan(context.Background(), "schedule")
+	producer.End()
+	expired := Snapshot(ctx)
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	mismatched := Snapshot(ctx)
+	mismatched.TraceID = GenerateTraceID().String()
+
+	for name, s := range map[string]TraceSnapshot{"expired": expired, "mismatched": mismatched, "empty": Snapshot(context.Background())} {
+		recorder.Reset()
+		restored := Restore(ctx, roundTrip(t, s))
+		if traceCtx := GetTraceContextFromContext(restored); traceCtx.IsValid() {
+			t.Errorf("%s: 期望不恢复旧版追踪上下文，得到 %+v", name, traceCtx)
+		}
+		childCtx, job := StartSpan(restored, "job")
+		_, child := StartSpan(childCtx, "step")
+		child.End()
+		job.End()
+
+		span := recorder.RequireSpan(t, "job")
+		if span.Parent().IsValid() || span.SpanContext().TraceID() == producer.SpanContext().TraceID() {
+			t.Errorf("%s: 期望创建新的根span，得到父span %+v", name, span.Parent())
+		}
+		wantLinks := 1
+		if name == "empty" {
+			wantLinks = 0
+		}
+		if links := span.Links(); len(links) != wantLinks ||
+			(wantLinks == 1 && links[0].SpanContext.SpanID() != producer.SpanContext().SpanID()) {
+			t.Errorf("%s: 期望 %d 个指向快照span的link，得到 %+v", name, wantLinks, links)
+		}
+		if links := recorder.RequireSpan(t, "step").Links(); len(links) != 0 {
+			t.Errorf("%s: 期望子span没有link，得到 %+v", name, links)
+		}
+	}
+}
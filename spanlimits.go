@@ -0,0 +1,107 @@
+package trace
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"unicode/utf8"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// TruncatedSuffix SetAttribute截断超长字符串属性值时添加的后缀
+const TruncatedSuffix = "…(truncated)"
+
+// attributeValueLengthLimit InitJaeger配置的字符串属性值最大长度，不大于0时不截断
+var attributeValueLengthLimit atomic.Int64
+
+// setAttributeValueLengthLimit 设置SetAttribute截断字符串属性值使用的最大长度
+func setAttributeValueLengthLimit(limit int) {
+	attributeValueLengthLimit.Store(int64(limit))
+}
+
+// truncateAttributeValue 将超过最大长度的字符串截断，截断后的值以TruncatedSuffix结尾且不超过最大长度，
+// SDK不会再截掉后缀；最大长度不超过后缀长度时直接截断
+func truncateAttributeValue(value string) string {
+	limit := int(attributeValueLengthLimit.Load())
+	if limit <= 0 || len(value) <= limit || utf8.RuneCountInString(value) <= limit {
+		return value
+	}
+	keep, suffix := limit, ""
+	if suffixLen := utf8.RuneCountInString(TruncatedSuffix); limit > suffixLen {
+		keep, suffix = limit-suffixLen, TruncatedSuffix
+	}
+	for i := range value {
+		if keep == 0 {
+			return value[:i] + suffix
+		}
+		keep--
+	}
+	return value
+}
+
+// spanLimitEnv JaegerConfig中的span限制及对应的环境变量，环境变量按顺序取第一个不为空的
+var spanLimitEnv = []struct {
+	name  string
+	field func(*JaegerConfig) *int
+	keys  []string
+}{
+	{"attribute value length limit", func(c *JaegerConfig) *int { return &c.AttributeValueLengthLimit },
+		[]string{"OTEL_SPAN_ATTRIBUTE_VALUE_LENGTH_LIMIT", "OTEL_ATTRIBUTE_VALUE_LENGTH_LIMIT"}},
+	{"attribute count limit", func(c *JaegerConfig) *int { return &c.AttributeCountLimit },
+		[]string{"OTEL_SPAN_ATTRIBUTE_COUNT_LIMIT", "OTEL_ATTRIBUTE_COUNT_LIMIT"}},
+	{"event count limit", func(c *JaegerConfig) *int { return &c.EventCountLimit },
+		[]string{"OTEL_SPAN_EVENT_COUNT_LIMIT"}},
+	{"link count limit", func(c *JaegerConfig) *int { return &c.LinkCountLimit },
+		[]string{"OTEL_SPAN_LINK_COUNT_LIMIT"}},
+}
+
+// loadSpanLimitsFromEnv 从环境变量加载span限制，无法解析或为负数的值被忽略
+func loadSpanLimitsFromEnv(config *JaegerConfig) {
+	for _, limit := range spanLimitEnv {
+		if value := getFirstEnv(limit.keys...); value != "" {
+			if parsed, err := strconv.Atoi(value); err == nil && parsed >= 0 {
+				*limit.field(config) = parsed
+			}
+		}
+	}
+}
+
+// validateSpanLimits 检查span限制不为负数
+func validateSpanLimits(config *JaegerConfig) error {
+	for _, limit := range spanLimitEnv {
+		if value := *limit.field(config); value < 0 {
+			return fmt.Errorf("%s must not be negative, got %d", limit.name, value)
+		}
+	}
+	return nil
+}
+
+// fixSpanLimits 将为负数的span限制重置为0，即使用SDK的默认值
+func fixSpanLimits(config *JaegerConfig) {
+	for _, limit := range spanLimitEnv {
+		if field := limit.field(config); *field < 0 {
+			*field = 0
+		}
+	}
+}
+
+// spanLimits 返回传给TracerProvider的span限制，为0的限制使用SDK的默认值
+// 与已弃用的WithSpanLimits不同，结果通过WithRawSpanLimits原样使用，SDK默认值中的负数（不限制）不会被改写
+func spanLimits(config *JaegerConfig) sdktrace.SpanLimits {
+	limits := sdktrace.NewSpanLimits()
+	for _, pair := range []struct {
+		configured int
+		target     *int
+	}{
+		{config.AttributeValueLengthLimit, &limits.AttributeValueLengthLimit},
+		{config.AttributeCountLimit, &limits.AttributeCountLimit},
+		{config.EventCountLimit, &limits.EventCountLimit},
+		{config.LinkCountLimit, &limits.LinkCountLimit},
+	} {
+		if pair.configured > 0 {
+			*pair.target = pair.configured
+		}
+	}
+	return limits
+}
@@ -0,0 +1,108 @@
+package trace
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/HsiaoL1/trace/tracetest"
+)
+
+func TestSpanLimitsReachProvider(t *testing.T) {
+	config := &JaegerConfig{AttributeValueLengthLimit: 20, AttributeCountLimit: 3, EventCountLimit: 1, LinkCountLimit: 1}
+	recorder := tracetest.Start(t, sdktrace.WithRawSpanLimits(spanLimits(config)))
+
+	links := []trace.Link{{SpanContext: trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1}, SpanID: trace.SpanID{1}})}, {SpanContext: trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{2}, SpanID: trace.SpanID{2}})}}
+	_, span := StartSpan(context.Background(), "limited", trace.WithLinks(links...))
+	span.SetAttributes(attribute.String("a", strings.Repeat("x", 50)), attribute.Int("b", 1), attribute.Int("c", 2))
+	span.AddEvent("first")
+	span.AddEvent("second")
+	span.End()
+
+	got := recorder.RequireSpan(t, "limited")
+	// StartSpan设置的component属性也计入属性数
+	if len(got.Attributes()) != 3 || got.DroppedAttributes() != 1 {
+		t.Errorf("期望保留3个属性并丢弃1个，得到 %v（丢弃 %d）", got.Attributes(), got.DroppedAttributes())
+	}
+	for _, kv := range got.Attributes() {
+		if kv.Key == "a" && len(kv.Value.AsString()) != 20 {
+			t.Errorf("期望SDK将属性值截断为20个字符，得到 %q", kv.Value.AsString())
+		}
+	}
+	if len(got.Events()) != 1 || got.Events()[0].Name != "second" || got.DroppedEvents() != 1 {
+		t.Errorf("期望只保留最新的事件，得到 %v", got.Events())
+	}
+	if len(got.Links()) != 1 || got.DroppedLinks() != 1 {
+		t.Errorf("期望只保留1个link，得到 %v", got.Links())
+	}
+
+	defaults := spanLimits(&JaegerConfig{})
+	if defaults != sdktrace.NewSpanLimits() {
+		t.Errorf("期望未配置时使用SDK默认值，得到 %+v", defaults)
+	}
+}
+
+func TestSetAttributeTruncates(t *testing.T) {
+	recorder := tracetest.Start(t)
+	setAttributeValueLengthLimit(20)
+	t.Cleanup(func() { setAttributeValueLengthLimit(0) })
+
+	_, span := StartSpan(context.Background(), "truncate")
+	SetAttribute(span, "long", strings.Repeat("日志", 20))
+	SetAttribute(span, "short", "ok")
+	SetAttribute(span, "formatted", []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+	span.End()
+
+	got := recorder.RequireSpan(t, "truncate")
+	values := map[string]string{}
+	for _, kv := range got.Attributes() {
+		values[string(kv.Key)] = kv.Value.AsString()
+	}
+	if long := values["long"]; long != strings.Repeat("日志", 4)+TruncatedSuffix || utf8.RuneCountInString(long) != 20 {
+		t.Errorf("期望截断为20个字符并带有后缀，得到 %q", long)
+	}
+	if values["short"] != "ok" {
+		t.Errorf("期望短值不被截断，得到 %q", values["short"])
+	}
+	if formatted := values["formatted"]; !strings.HasSuffix(formatted, TruncatedSuffix) || utf8.RuneCountInString(formatted) != 20 {
+		t.Errorf("期望格式化后的值被截断，得到 %q", formatted)
+	}
+
+	setAttributeValueLengthLimit(5)
+	if got := truncateAttributeValue("abcdefgh"); got != "abcde" {
+		t.Errorf("期望限制不超过后缀长度时直接截断，得到 %q", got)
+	}
+}
+
+func TestSpanLimitsConfig(t *testing.T) {
+	t.Setenv("OTEL_SPAN_ATTRIBUTE_VALUE_LENGTH_LIMIT", "256")
+	t.Setenv("OTEL_SPAN_ATTRIBUTE_COUNT_LIMIT", "64")
+	t.Setenv("OTEL_SPAN_EVENT_COUNT_LIMIT", "-1")
+	t.Setenv("OTEL_SPAN_LINK_COUNT_LIMIT", "abc")
+
+	config := LoadJaegerConfigFromEnv()
+	if config.AttributeValueLengthLimit != 256 || config.AttributeCountLimit != 64 ||
+		config.EventCountLimit != 0 || config.LinkCountLimit != 0 {
+		t.Errorf("期望从环境变量加载合法的限制，得到 %+v", config)
+	}
+
+	full := DefaultConfig()
+	full.Jaeger.EventCountLimit = -1
+	if err := full.Validate(); err == nil || !strings.Contains(err.Error(), "event count limit") {
+		t.Errorf("期望拒绝负数限制，得到 %v", err)
+	}
+	full.Fix()
+	if full.Jaeger.EventCountLimit != 0 {
+		t.Errorf("期望Fix将负数限制重置为0，得到 %d", full.Jaeger.EventCountLimit)
+	}
+	if err := full.Validate(); err != nil {
+		t.Errorf("期望修复后的配置合法，得到 %v", err)
+	}
+}
@@ -0,0 +1,353 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// spanMetricsOtherName 超出序列上限后，新序列统一归入的span名称
+const spanMetricsOtherName = "other"
+
+// SpanMetricsConfig span指标（RED）配置
+type SpanMetricsConfig struct {
+	// Attributes 作为维度的span属性，默认只使用http.status_code
+	Attributes []string
+	// MaxSeries 最大序列数，超出后的新序列归入"other"
+	MaxSeries int
+	// Buckets 耗时直方图的桶边界
+	Buckets []time.Duration
+	// Namespace 指标名前缀，默认"span"
+	Namespace string
+}
+
+// DefaultSpanMetricsConfig 默认span指标配置
+func DefaultSpanMetricsConfig() SpanMetricsConfig {
+	return SpanMetricsConfig{
+		Attributes: []string{"http.status_code"},
+		MaxSeries:  1000,
+		Buckets: []time.Duration{
+			5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond,
+			50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond,
+			500 * time.Millisecond, time.Second, 2500 * time.Millisecond,
+			5 * time.Second, 10 * time.Second,
+		},
+		Namespace: "span",
+	}
+}
+
+// SpanMetricSeries 单个序列的聚合结果
+type SpanMetricSeries struct {
+	Name         string            `json:"name"`
+	Kind         string            `json:"kind"`
+	Status       string            `json:"status"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	Calls        uint64            `json:"calls"`
+	DurationSum  time.Duration     `json:"duration_sum"`
+	BucketCounts []uint64          `json:"bucket_counts"` // 与Buckets一一对应的非累积计数，最后一个为+Inf
+}
+
+// SpanMetrics 将结束的span聚合为调用次数和耗时直方图的SpanProcessor
+type SpanMetrics struct {
+	config SpanMetricsConfig
+	keys   []attribute.Key
+	series map[string]*SpanMetricSeries
+	mutex  sync.Mutex
+}
+
+var _ sdktrace.SpanProcessor = (*SpanMetrics)(nil)
+
+// NewSpanMetrics 创建span指标处理器
+func NewSpanMetrics(cfg SpanMetricsConfig) *SpanMetrics {
+	defaults := DefaultSpanMetricsConfig()
+	if cfg.Attributes == nil {
+		cfg.Attributes = defaults.Attributes
+	}
+	if cfg.MaxSeries <= 0 {
+		cfg.MaxSeries = defaults.MaxSeries
+	}
+	if len(cfg.Buckets) == 0 {
+		cfg.Buckets = defaults.Buckets
+	}
+	if cfg.Namespace == "" {
+		cfg.Namespace = defaults.Namespace
+	}
+
+	buckets := append([]time.Duration(nil), cfg.Buckets...)
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+	cfg.Buckets = buckets
+
+	keys := make([]attribute.Key, len(cfg.Attributes))
+	for i, attr := range cfg.Attributes {
+		keys[i] = attribute.Key(attr)
+	}
+
+	return &SpanMetrics{
+		config: cfg,
+		keys:   keys,
+		series: make(map[string]*SpanMetricSeries),
+	}
+}
+
+// 全局span指标及待注册状态
+var (
+	globalSpanMetrics   *SpanMetrics
+	globalProvider      *sdktrace.TracerProvider
+	spanMetricsRegister bool
+	providerMutex       sync.Mutex
+)
+
+// EnableSpanMetrics 启用span指标聚合
+// 如果InitJaeger已创建provider则立即注册，否则在InitJaeger时注册
+func EnableSpanMetrics(cfg SpanMetricsConfig) *SpanMetrics {
+	providerMutex.Lock()
+	defer providerMutex.Unlock()
+
+	if globalSpanMetrics != nil && spanMetricsRegister && globalProvider != nil {
+		globalProvider.UnregisterSpanProcessor(globalSpanMetrics)
+	}
+
+	globalSpanMetrics = NewSpanMetrics(cfg)
+	spanMetricsRegister = false
+	if globalProvider != nil {
+		globalProvider.RegisterSpanProcessor(globalSpanMetrics)
+		spanMetricsRegister = true
+	}
+	return globalSpanMetrics
+}
+
+// GetSpanMetrics 获取已启用的span指标，未启用时返回nil
+func GetSpanMetrics() *SpanMetrics {
+	providerMutex.Lock()
+	defer providerMutex.Unlock()
+	return globalSpanMetrics
+}
+
+// setTracerProvider 记录InitJaeger创建的provider并注册待注册的span指标
+func setTracerProvider(tp *sdktrace.TracerProvider) {
+	providerMutex.Lock()
+	defer providerMutex.Unlock()
+
+	globalProvider = tp
+	spanMetricsRegister = false
+	if globalSpanMetrics != nil && tp != nil {
+		tp.RegisterSpanProcessor(globalSpanMetrics)
+		spanMetricsRegister = true
+	}
+}
+
+// OnStart 实现SpanProcessor接口
+func (m *SpanMetrics) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+// OnEnd 实现SpanProcessor接口，聚合结束的span
+func (m *SpanMetrics) OnEnd(s sdktrace.ReadOnlySpan) {
+	kind := s.SpanKind().String()
+	status := strings.ToLower(s.Status().Code.String())
+	duration := s.EndTime().Sub(s.StartTime())
+	attrs := s.Attributes()
+
+	// 在栈上拼接序列键，命中已有序列时不产生额外分配
+	var buf [256]byte
+	key := append(buf[:0], s.Name()...)
+	key = append(key, 0)
+	key = append(key, kind...)
+	key = append(key, 0)
+	key = append(key, status...)
+	for _, attrKey := range m.keys {
+		key = append(key, 0)
+		for _, kv := range attrs {
+			if kv.Key == attrKey {
+				key = appendAttributeValue(key, kv.Value)
+				break
+			}
+		}
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	series, ok := m.series[string(key)]
+	if !ok {
+		series = m.newSeries(string(key), s.Name(), kind, status, attrs)
+	}
+
+	series.Calls++
+	series.DurationSum += duration
+	bucket := sort.Search(len(m.config.Buckets), func(i int) bool { return duration <= m.config.Buckets[i] })
+	series.BucketCounts[bucket]++
+}
+
+// newSeries 创建新序列，超出上限时归入other序列（只保留kind和status维度）
+func (m *SpanMetrics) newSeries(key, name, kind, status string, attrs []attribute.KeyValue) *SpanMetricSeries {
+	if len(m.series) >= m.config.MaxSeries {
+		key = spanMetricsOtherName + "\x00" + kind + "\x00" + status
+		if series, ok := m.series[key]; ok {
+			return series
+		}
+		name = spanMetricsOtherName
+		attrs = nil
+	}
+
+	series := &SpanMetricSeries{
+		Name:         name,
+		Kind:         kind,
+		Status:       status,
+		BucketCounts: make([]uint64, len(m.config.Buckets)+1),
+	}
+	for _, attrKey := range m.keys {
+		for _, kv := range attrs {
+			if kv.Key == attrKey {
+				if series.Attributes == nil {
+					series.Attributes = make(map[string]string, len(m.keys))
+				}
+				series.Attributes[string(attrKey)] = kv.Value.Emit()
+				break
+			}
+		}
+	}
+	m.series[key] = series
+	return series
+}
+
+// appendAttributeValue 将属性值追加到序列键中
+func appendAttributeValue(dst []byte, value attribute.Value) []byte {
+	switch value.Type() {
+	case attribute.STRING:
+		return append(dst, value.AsString()...)
+	case attribute.INT64:
+		return strconv.AppendInt(dst, value.AsInt64(), 10)
+	case attribute.BOOL:
+		return strconv.AppendBool(dst, value.AsBool())
+	default:
+		return append(dst, value.Emit()...)
+	}
+}
+
+// Shutdown 实现SpanProcessor接口
+func (m *SpanMetrics) Shutdown(context.Context) error { return nil }
+
+// ForceFlush 实现SpanProcessor接口
+func (m *SpanMetrics) ForceFlush(context.Context) error { return nil }
+
+// Snapshot 返回当前所有序列的副本，按名称、kind、status排序
+func (m *SpanMetrics) Snapshot() []SpanMetricSeries {
+	m.mutex.Lock()
+	snapshot := make([]SpanMetricSeries, 0, len(m.series))
+	for _, series := range m.series {
+		copied := *series
+		copied.BucketCounts = append([]uint64(nil), series.BucketCounts...)
+		if series.Attributes != nil {
+			copied.Attributes = make(map[string]string, len(series.Attributes))
+			for k, v := range series.Attributes {
+				copied.Attributes[k] = v
+			}
+		}
+		snapshot = append(snapshot, copied)
+	}
+	m.mutex.Unlock()
+
+	sort.Slice(snapshot, func(i, j int) bool {
+		a, b := snapshot[i], snapshot[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Status != b.Status {
+			return a.Status < b.Status
+		}
+		return fmt.Sprint(a.Attributes) < fmt.Sprint(b.Attributes)
+	})
+	return snapshot
+}
+
+// Reset 清空所有已聚合的序列
+func (m *SpanMetrics) Reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.series = make(map[string]*SpanMetricSeries)
+}
+
+// Handler 返回以Prometheus文本格式输出指标的HTTP处理器
+func (m *SpanMetrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m.writePrometheus(w)
+	})
+}
+
+// writePrometheus 以Prometheus文本格式写出指标
+func (m *SpanMetrics) writePrometheus(w http.ResponseWriter) {
+	snapshot := m.Snapshot()
+	callsName := m.config.Namespace + "_calls_total"
+	durationName := m.config.Namespace + "_duration_seconds"
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP %s Total number of ended spans.\n", callsName)
+	fmt.Fprintf(&b, "# TYPE %s counter\n", callsName)
+	for _, series := range snapshot {
+		fmt.Fprintf(&b, "%s{%s} %d\n", callsName, m.promLabels(series, ""), series.Calls)
+	}
+
+	fmt.Fprintf(&b, "# HELP %s Span duration in seconds.\n", durationName)
+	fmt.Fprintf(&b, "# TYPE %s histogram\n", durationName)
+	for _, series := range snapshot {
+		var cumulative uint64
+		for i, bound := range m.config.Buckets {
+			cumulative += series.BucketCounts[i]
+			le := strconv.FormatFloat(bound.Seconds(), 'g', -1, 64)
+			fmt.Fprintf(&b, "%s_bucket{%s} %d\n", durationName, m.promLabels(series, le), cumulative)
+		}
+		cumulative += series.BucketCounts[len(m.config.Buckets)]
+		fmt.Fprintf(&b, "%s_bucket{%s} %d\n", durationName, m.promLabels(series, "+Inf"), cumulative)
+		fmt.Fprintf(&b, "%s_sum{%s} %s\n", durationName, m.promLabels(series, ""),
+			strconv.FormatFloat(series.DurationSum.Seconds(), 'g', -1, 64))
+		fmt.Fprintf(&b, "%s_count{%s} %d\n", durationName, m.promLabels(series, ""), series.Calls)
+	}
+
+	w.Write([]byte(b.String()))
+}
+
+// promLabels 生成Prometheus标签字符串
+func (m *SpanMetrics) promLabels(series SpanMetricSeries, le string) string {
+	labels := []string{
+		fmt.Sprintf(`span_name="%s"`, escapePromLabel(series.Name)),
+		fmt.Sprintf(`span_kind="%s"`, escapePromLabel(series.Kind)),
+		fmt.Sprintf(`status_code="%s"`, escapePromLabel(series.Status)),
+	}
+	for _, attr := range m.config.Attributes {
+		if value, ok := series.Attributes[attr]; ok {
+			labels = append(labels, fmt.Sprintf(`%s="%s"`, promLabelName(attr), escapePromLabel(value)))
+		}
+	}
+	if le != "" {
+		labels = append(labels, fmt.Sprintf(`le="%s"`, le))
+	}
+	return strings.Join(labels, ",")
+}
+
+// promLabelName 将属性名转换为合法的Prometheus标签名
+func promLabelName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// escapePromLabel 转义Prometheus标签值
+func escapePromLabel(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
@@ -0,0 +1,142 @@
+package trace
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HsiaoL1/trace/tracetest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSpanMetricsAggregation(t *testing.T) {
+	metrics := NewSpanMetrics(SpanMetricsConfig{
+		Buckets: []time.Duration{time.Second},
+	})
+	tracer := tracetest.Start(t, sdktrace.WithSpanProcessor(metrics)).Provider().Tracer("test")
+
+	for i := 0; i < 3; i++ {
+		_, span := tracer.Start(context.Background(), "GET /users", trace.WithSpanKind(trace.SpanKindServer))
+		span.SetAttributes(attribute.Int("http.status_code", 200))
+		span.End()
+	}
+	_, span := tracer.Start(context.Background(), "GET /users", trace.WithSpanKind(trace.SpanKindServer))
+	span.SetAttributes(attribute.Int("http.status_code", 500))
+	span.SetStatus(codes.Error, "internal error")
+	span.End()
+
+	snapshot := metrics.Snapshot()
+	if len(snapshot) != 2 {
+		t.Fatalf("Expected 2 series, got %d", len(snapshot))
+	}
+
+	var okCalls, errorCalls uint64
+	for _, series := range snapshot {
+		if series.Kind != "server" {
+			t.Errorf("Expected span kind server, got %s", series.Kind)
+		}
+		switch series.Attributes["http.status_code"] {
+		case "200":
+			okCalls = series.Calls
+		case "500":
+			errorCalls = series.Calls
+			if series.Status != "error" {
+				t.Errorf("Expected status error, got %s", series.Status)
+			}
+		}
+		if series.BucketCounts[0] != series.Calls {
+			t.Errorf("Expected all spans in the first bucket, got %v", series.BucketCounts)
+		}
+	}
+	if okCalls != 3 || errorCalls != 1 {
+		t.Errorf("Expected 3 ok calls and 1 error call, got %d and %d", okCalls, errorCalls)
+	}
+}
+
+func TestSpanMetricsMaxSeries(t *testing.T) {
+	metrics := NewSpanMetrics(SpanMetricsConfig{MaxSeries: 2})
+	tracer := tracetest.Start(t, sdktrace.WithSpanProcessor(metrics)).Provider().Tracer("test")
+
+	for _, name := range []string{"a", "b", "c", "d"} {
+		_, span := tracer.Start(context.Background(), name)
+		span.End()
+	}
+
+	snapshot := metrics.Snapshot()
+	if len(snapshot) != 3 {
+		t.Fatalf("Expected 2 series plus other, got %d", len(snapshot))
+	}
+	last := snapshot[len(snapshot)-1]
+	if last.Name != spanMetricsOtherName || last.Calls != 2 {
+		t.Errorf("Expected other series with 2 calls, got %s with %d", last.Name, last.Calls)
+	}
+}
+
+func TestSpanMetricsHandler(t *testing.T) {
+	metrics := NewSpanMetrics(SpanMetricsConfig{})
+	recorder := tracetest.Start(t, sdktrace.WithSpanProcessor(metrics))
+
+	_, span := recorder.Provider().Tracer("test").Start(context.Background(), `GET "/quoted"`)
+	span.End()
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := w.Body.String()
+	for _, want := range []string{
+		"# TYPE span_calls_total counter",
+		`span_calls_total{span_name="GET \"/quoted\"",span_kind="internal",status_code="unset"} 1`,
+		`span_duration_seconds_bucket{span_name="GET \"/quoted\"",span_kind="internal",status_code="unset",le="+Inf"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestEnableSpanMetricsRegistersOnProvider(t *testing.T) {
+	defer setTracerProvider(nil)
+
+	metrics := EnableSpanMetrics(SpanMetricsConfig{})
+	defer func() {
+		providerMutex.Lock()
+		globalSpanMetrics = nil
+		providerMutex.Unlock()
+	}()
+
+	tp := sdktrace.NewTracerProvider()
+	defer tp.Shutdown(context.Background())
+	setTracerProvider(tp)
+
+	_, span := tp.Tracer("test").Start(context.Background(), "registered")
+	span.End()
+
+	if GetSpanMetrics() != metrics {
+		t.Error("Expected GetSpanMetrics to return the enabled metrics")
+	}
+	if snapshot := metrics.Snapshot(); len(snapshot) != 1 || snapshot[0].Calls != 1 {
+		t.Errorf("Expected 1 recorded call, got %+v", snapshot)
+	}
+}
+
+func BenchmarkSpanMetricsOnEnd(b *testing.B) {
+	metrics := NewSpanMetrics(SpanMetricsConfig{})
+	tp := sdktrace.NewTracerProvider()
+	defer tp.Shutdown(context.Background())
+
+	_, span := tp.Tracer("bench").Start(context.Background(), "GET /users/{id}", trace.WithSpanKind(trace.SpanKindServer))
+	span.SetAttributes(attribute.Int("http.status_code", 200), attribute.String("http.method", "GET"))
+	span.End()
+	readOnly := span.(sdktrace.ReadOnlySpan)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		metrics.OnEnd(readOnly)
+	}
+}
@@ -6,11 +6,11 @@ import (
 	"encoding/hex"
 	"fmt"
 	"log"
+	"sync/atomic"
 	"time"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -87,25 +87,78 @@ func (s SpanID) IsValid() bool {
 	return false
 }
 
+// DefaultComponent span的component属性默认值
+const DefaultComponent = "github.com/HsiaoL1/trace"
+
+// 当前的component属性值
+var component atomic.Value
+
+// SetComponent 设置span的component属性，传入空字符串时恢复为默认值
+func SetComponent(name string) {
+	if name == "" {
+		name = DefaultComponent
+	}
+	component.Store(name)
+}
+
+// Component 获取span的component属性
+func Component() string {
+	if name, ok := component.Load().(string); ok {
+		return name
+	}
+	return DefaultComponent
+}
+
 // StartSpan 开始一个新的span
+// span类型通过opts中的trace.WithSpanKind指定，未指定时为internal
 func StartSpan(ctx context.Context, operationName string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
-	tracer := otel.Tracer("github.com/HsiaoL1/trace")
-	ctx, span := tracer.Start(ctx, operationName, opts...)
-	// 添加基本的span属性
-	span.SetAttributes(
-		attribute.String("component", "github.com/HsiaoL1/trace"),
-		attribute.String("span.kind", "internal"),
-	)
-	return ctx, span
+	return startSpan(ctx, "github.com/HsiaoL1/trace", operationName, opts...)
+}
+
+// StartServerSpan 开始一个server类型的span，用于处理传入的请求
+func StartServerSpan(ctx context.Context, operationName string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return StartSpan(ctx, operationName, append(opts[:len(opts):len(opts)], trace.WithSpanKind(trace.SpanKindServer))...)
+}
+
+// StartClientSpan 开始一个client类型的span，用于发起对外部服务的调用
+func StartClientSpan(ctx context.Context, operationName string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return StartSpan(ctx, operationName, append(opts[:len(opts):len(opts)], trace.WithSpanKind(trace.SpanKindClient))...)
+}
+
+// StartProducerSpan 开始一个producer类型的span，用于发送异步消息
+func StartProducerSpan(ctx context.Context, operationName string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return StartSpan(ctx, operationName, append(opts[:len(opts):len(opts)], trace.WithSpanKind(trace.SpanKindProducer))...)
+}
+
+// StartConsumerSpan 开始一个consumer类型的span，用于处理异步消息
+func StartConsumerSpan(ctx context.Context, operationName string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return StartSpan(ctx, operationName, append(opts[:len(opts):len(opts)], trace.WithSpanKind(trace.SpanKindConsumer))...)
+}
+
+// StartInternalSpan 开始一个internal类型的span，用于进程内的操作
+func StartInternalSpan(ctx context.Context, operationName string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return StartSpan(ctx, operationName, append(opts[:len(opts):len(opts)], trace.WithSpanKind(trace.SpanKindInternal))...)
+}
+
+// startSpan 使用指定的tracer开始span，并添加component属性和Restore保存的link，
+// 第一次在no-op provider上开始span时记录警告（见SetNoopWarning）
+func startSpan(ctx context.Context, instrumentationName, operationName string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	warnIfNoop(operationName)
+	tracer := otel.Tracer(instrumentationName)
+	opts = append(opts[:len(opts):len(opts)], trace.WithAttributes(attribute.String("component", Component())))
+	if link, ok := snapshotLinkOption(ctx); ok {
+		opts = append(opts, link)
+	}
+	return tracer.Start(ctx, operationName, opts...)
 }
 
-// RecordError 记录错误到span
+// RecordError 记录错误到span，错误消息经过SetErrorFormatter设置的格式化函数（默认截断到1KB并脱敏）
+// 同一个span上重复记录相同的错误只添加一个exception事件，调用次数记录在exception.count属性中
 func RecordError(span trace.Span, err error) {
 	if span == nil || err == nil {
 		return
 	}
-	span.RecordError(err)
-	span.SetStatus(codes.Error, err.Error())
+	recordSpanError(span, err)
 }
 
 // AddEvent 添加事件到span
@@ -117,13 +170,14 @@ func AddEvent(span trace.Span, name string, attributes ...attribute.KeyValue) {
 }
 
 // SetAttribute 设置span属性
+// 字符串值（包括其他类型格式化后的字符串）超过JaegerConfig.AttributeValueLengthLimit时截断并加上TruncatedSuffix
 func SetAttribute(span trace.Span, key string, value any) {
 	if span == nil {
 		return
 	}
 	switch v := value.(type) {
 	case string:
-		span.SetAttributes(attribute.String(key, v))
+		span.SetAttributes(attribute.String(key, truncateAttributeValue(v)))
 	case int:
 		span.SetAttributes(attribute.Int(key, v))
 	case int32:
@@ -137,7 +191,7 @@ func SetAttribute(span trace.Span, key string, value any) {
 	case bool:
 		span.SetAttributes(attribute.Bool(key, v))
 	default:
-		span.SetAttributes(attribute.String(key, fmt.Sprintf("%v", v)))
+		span.SetAttributes(attribute.String(key, truncateAttributeValue(fmt.Sprintf("%v", v))))
 	}
 }
 
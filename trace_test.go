@@ -1,7 +1,11 @@
 package trace
 
 import (
+	"context"
 	"testing"
+
+	"github.com/HsiaoL1/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestGenerateTraceID(t *testing.T) {
@@ -98,4 +102,75 @@ func TestSpanIDValidity(t *testing.T) {
 	if invalidSpanID.IsValid() {
 		t.Error("Invalid span ID (all zeros) should return false for IsValid()")
 	}
-}
\ No newline at end of file
+}
+
+func TestStartSpanKinds(t *testing.T) {
+	recorder := tracetest.Start(t)
+
+	starters := map[string]func(context.Context, string, ...trace.SpanStartOption) (context.Context, trace.Span){
+		"server":   StartServerSpan,
+		"client":   StartClientSpan,
+		"producer": StartProducerSpan,
+		"consumer": StartConsumerSpan,
+		"internal": StartInternalSpan,
+	}
+	for name, start := range starters {
+		_, span := start(context.Background(), name)
+		span.End()
+	}
+	_, span := StartSpan(context.Background(), "default")
+	span.End()
+	_, span = StartSpan(context.Background(), "explicit", trace.WithSpanKind(trace.SpanKindProducer))
+	span.End()
+
+	want := map[string]trace.SpanKind{
+		"server":   trace.SpanKindServer,
+		"client":   trace.SpanKindClient,
+		"producer": trace.SpanKindProducer,
+		"consumer": trace.SpanKindConsumer,
+		"internal": trace.SpanKindInternal,
+		"default":  trace.SpanKindInternal,
+		"explicit": trace.SpanKindProducer,
+	}
+	for name, kind := range want {
+		recorded := recorder.RequireSpan(t, name)
+		if recorded.SpanKind() != kind {
+			t.Errorf("Span %s: expected kind %s, got %s", name, kind, recorded.SpanKind())
+		}
+		for _, attr := range recorded.Attributes() {
+			if attr.Key == "span.kind" {
+				t.Errorf("Span %s should not carry a span.kind attribute", name)
+			}
+		}
+		recorder.AssertAttr(t, recorded, "component", DefaultComponent)
+	}
+}
+
+func TestSetComponent(t *testing.T) {
+	recorder := tracetest.Start(t)
+
+	SetComponent("orders-service")
+	defer SetComponent("")
+
+	_, span := StartSpan(context.Background(), "custom")
+	span.End()
+	recorder.AssertAttr(t, recorder.RequireSpan(t, "custom"), "component", "orders-service")
+
+	SetComponent("")
+	if Component() != DefaultComponent {
+		t.Errorf("Expected component to reset to %s, got %s", DefaultComponent, Component())
+	}
+}
+
+func TestStartSpanKeepsCallerOptions(t *testing.T) {
+	tracetest.Start(t)
+
+	opts := make([]trace.SpanStartOption, 1, 4)
+	opts[0] = trace.WithSpanKind(trace.SpanKindProducer)
+	_, span := StartClientSpan(context.Background(), "client", opts...)
+	span.End()
+
+	if spare := opts[1:cap(opts)]; spare[0] != nil || spare[1] != nil {
+		t.Error("Expected span helpers not to write into the caller's option slice")
+	}
+}
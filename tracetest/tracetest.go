@@ -0,0 +1,176 @@
+// Package tracetest 提供测试用的追踪工具
+//
+// Start会将内存exporter、全量采样器和确定性ID生成器安装为全局provider，
+// 测试结束时自动恢复之前的provider和propagator。
+package tracetest
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	sdktracetest "go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Recorder 记录测试期间结束的span
+type Recorder struct {
+	exporter *sdktracetest.InMemoryExporter
+	provider *sdktrace.TracerProvider
+}
+
+// Start 为当前测试安装全局追踪provider，并在测试结束时恢复
+// opts追加在默认选项之后，可用于替换采样器或注册额外的span处理器
+// 由于修改了全局状态，使用Start的测试不应调用t.Parallel
+func Start(t *testing.T, opts ...sdktrace.TracerProviderOption) *Recorder {
+	t.Helper()
+
+	exporter := sdktracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(append([]sdktrace.TracerProviderOption{
+		sdktrace.WithSyncer(exporter),
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithIDGenerator(NewDeterministicIDGenerator()),
+	}, opts...)...)
+
+	prevProvider := otel.GetTracerProvider()
+	prevPropagator := otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+		provider.Shutdown(context.Background())
+	})
+
+	return &Recorder{
+		exporter: exporter,
+		provider: provider,
+	}
+}
+
+// Provider 返回测试使用的TracerProvider
+func (r *Recorder) Provider() *sdktrace.TracerProvider {
+	return r.provider
+}
+
+// Spans 返回所有已结束的span，按结束顺序排列
+func (r *Recorder) Spans() []sdktrace.ReadOnlySpan {
+	return r.exporter.GetSpans().Snapshots()
+}
+
+// SpanByName 返回第一个指定名称的已结束span，不存在时返回nil
+func (r *Recorder) SpanByName(name string) sdktrace.ReadOnlySpan {
+	for _, span := range r.Spans() {
+		if span.Name() == name {
+			return span
+		}
+	}
+	return nil
+}
+
+// Reset 清空已记录的span
+func (r *Recorder) Reset() {
+	r.exporter.Reset()
+}
+
+// RequireSpan 返回指定名称的span，不存在时终止测试
+func (r *Recorder) RequireSpan(t *testing.T, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	span := r.SpanByName(name)
+	if span == nil {
+		t.Fatalf("span %q not found, recorded spans: %v", name, spanNames(r.Spans()))
+	}
+	return span
+}
+
+// AssertAttr 断言span包含指定的属性值
+// 值按字符串形式比较，因此int与int64等数值类型可以互相匹配
+func (r *Recorder) AssertAttr(t *testing.T, span sdktrace.ReadOnlySpan, key string, value any) {
+	t.Helper()
+	if span == nil {
+		t.Errorf("cannot assert attribute %q on nil span", key)
+		return
+	}
+	for _, attr := range span.Attributes() {
+		if string(attr.Key) != key {
+			continue
+		}
+		if got, want := fmt.Sprint(attr.Value.AsInterface()), fmt.Sprint(value); got != want {
+			t.Errorf("span %q attribute %q = %s, want %s", span.Name(), key, got, want)
+		}
+		return
+	}
+	t.Errorf("span %q has no attribute %q", span.Name(), key)
+}
+
+// AssertParent 断言child是parent的直接子span
+func (r *Recorder) AssertParent(t *testing.T, child, parent sdktrace.ReadOnlySpan) {
+	t.Helper()
+	if child == nil || parent == nil {
+		t.Error("cannot assert parent on nil span")
+		return
+	}
+	if child.SpanContext().TraceID() != parent.SpanContext().TraceID() {
+		t.Errorf("span %q trace ID %s, want %s", child.Name(), child.SpanContext().TraceID(), parent.SpanContext().TraceID())
+	}
+	if child.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("span %q parent is %s, want %q (%s)", child.Name(), child.Parent().SpanID(), parent.Name(), parent.SpanContext().SpanID())
+	}
+}
+
+// spanNames 返回span名称列表
+func spanNames(spans []sdktrace.ReadOnlySpan) []string {
+	names := make([]string, 0, len(spans))
+	for _, span := range spans {
+		names = append(names, span.Name())
+	}
+	return names
+}
+
+// DeterministicIDGenerator 按顺序生成trace ID和span ID，便于编写golden测试
+// 第一个trace ID为00000000000000000000000000000001，第一个span ID为0000000000000001
+type DeterministicIDGenerator struct {
+	mu          sync.Mutex
+	nextTraceID uint64
+	nextSpanID  uint64
+}
+
+// NewDeterministicIDGenerator 创建确定性ID生成器
+func NewDeterministicIDGenerator() *DeterministicIDGenerator {
+	return &DeterministicIDGenerator{}
+}
+
+// NewIDs 生成新的trace ID和span ID
+func (g *DeterministicIDGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.nextTraceID++
+	var traceID trace.TraceID
+	binary.BigEndian.PutUint64(traceID[8:], g.nextTraceID)
+	return traceID, g.newSpanIDLocked()
+}
+
+// NewSpanID 生成新的span ID
+func (g *DeterministicIDGenerator) NewSpanID(ctx context.Context, traceID trace.TraceID) trace.SpanID {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.newSpanIDLocked()
+}
+
+// newSpanIDLocked 生成新的span ID，调用方需持有锁
+func (g *DeterministicIDGenerator) newSpanIDLocked() trace.SpanID {
+	g.nextSpanID++
+	var spanID trace.SpanID
+	binary.BigEndian.PutUint64(spanID[:], g.nextSpanID)
+	return spanID
+}
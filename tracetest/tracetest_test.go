@@ -0,0 +1,88 @@
+package tracetest
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestRecorderAssertions(t *testing.T) {
+	recorder := Start(t)
+
+	tracer := otel.Tracer("test")
+	ctx, parent := tracer.Start(context.Background(), "parent")
+	_, child := tracer.Start(ctx, "child")
+	child.SetAttributes(attribute.Int("retries", 3), attribute.String("db.system", "mysql"))
+	child.End()
+	parent.End()
+
+	if spans := recorder.Spans(); len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+
+	childSpan := recorder.RequireSpan(t, "child")
+	parentSpan := recorder.RequireSpan(t, "parent")
+	recorder.AssertAttr(t, childSpan, "retries", 3)
+	recorder.AssertAttr(t, childSpan, "db.system", "mysql")
+	recorder.AssertParent(t, childSpan, parentSpan)
+
+	if recorder.SpanByName("missing") != nil {
+		t.Error("Expected nil for unknown span name")
+	}
+
+	recorder.Reset()
+	if spans := recorder.Spans(); len(spans) != 0 {
+		t.Errorf("Expected no spans after reset, got %d", len(spans))
+	}
+}
+
+func TestDeterministicIDs(t *testing.T) {
+	recorder := Start(t)
+
+	tracer := otel.Tracer("test")
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, child := tracer.Start(ctx, "child")
+	child.End()
+	root.End()
+
+	rootSpan := recorder.RequireSpan(t, "root")
+	childSpan := recorder.RequireSpan(t, "child")
+	if got := rootSpan.SpanContext().TraceID().String(); got != "00000000000000000000000000000001" {
+		t.Errorf("Unexpected trace ID %s", got)
+	}
+	if got := rootSpan.SpanContext().SpanID().String(); got != "0000000000000001" {
+		t.Errorf("Unexpected root span ID %s", got)
+	}
+	if got := childSpan.SpanContext().SpanID().String(); got != "0000000000000002" {
+		t.Errorf("Unexpected child span ID %s", got)
+	}
+}
+
+func TestStartRestoresProvider(t *testing.T) {
+	before := otel.GetTracerProvider()
+
+	t.Run("inner", func(t *testing.T) {
+		recorder := Start(t)
+		if otel.GetTracerProvider() != recorder.Provider() {
+			t.Error("Expected recorder provider to be installed globally")
+		}
+	})
+
+	if otel.GetTracerProvider() != before {
+		t.Error("Expected previous provider to be restored after cleanup")
+	}
+}
+
+func TestStartOptions(t *testing.T) {
+	recorder := Start(t, sdktrace.WithSampler(sdktrace.NeverSample()))
+
+	_, span := otel.Tracer("test").Start(context.Background(), "dropped")
+	span.End()
+
+	if spans := recorder.Spans(); len(spans) != 0 {
+		t.Errorf("Expected sampler option to override AlwaysSample, got %d spans", len(spans))
+	}
+}